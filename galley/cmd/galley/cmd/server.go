@@ -77,6 +77,9 @@ func serverCmd() *cobra.Command {
 				serverArgs.ValidationArgs.KeyFile = serverArgs.CredentialOptions.KeyFile
 			}
 
+			serverArgs.ValidationArgs.MeshConfigFile = serverArgs.MeshConfigFile
+			serverArgs.ValidationArgs.DomainSuffix = serverArgs.DomainSuffix
+
 			if !serverArgs.EnableServer && !serverArgs.ValidationArgs.EnableValidation {
 				log.Fatala("Galley must be running under at least one mode: server or validation")
 			}
@@ -169,6 +172,9 @@ func serverCmd() *cobra.Command {
 	svr.PersistentFlags().BoolVar(&serverArgs.ValidationArgs.EnableReconcileWebhookConfiguration,
 		"enable-reconcileWebhookConfiguration", serverArgs.ValidationArgs.EnableReconcileWebhookConfiguration,
 		"Enable reconciliation for webhook configuration.")
+	svr.PersistentFlags().BoolVar(&serverArgs.ValidationArgs.EnableImpactEstimation,
+		"enable-impact-estimation", serverArgs.ValidationArgs.EnableImpactEstimation,
+		"Attach to the admission responses the estimated number of proxies receiving a push and the xDS types changing.")
 	svr.PersistentFlags().StringVar(&serverArgs.ValidationArgs.DeploymentAndServiceNamespace, "deployment-namespace", "istio-system",
 		"Namespace of the deployment for the validation pod")
 	svr.PersistentFlags().StringVar(&serverArgs.ValidationArgs.DeploymentName, "deployment-name", "istio-galley",
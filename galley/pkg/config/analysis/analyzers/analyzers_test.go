@@ -27,6 +27,7 @@ import (
 	"istio.io/istio/galley/pkg/config/analysis/analyzers/deprecation"
 	"istio.io/istio/galley/pkg/config/analysis/analyzers/gateway"
 	"istio.io/istio/galley/pkg/config/analysis/analyzers/injection"
+	"istio.io/istio/galley/pkg/config/analysis/analyzers/service"
 	"istio.io/istio/galley/pkg/config/analysis/analyzers/virtualservice"
 	"istio.io/istio/galley/pkg/config/analysis/diag"
 	"istio.io/istio/galley/pkg/config/analysis/local"
@@ -139,6 +140,15 @@ var testGrid = []testCase{
 			{msg.IstioProxyVersionMismatch, "Pod/enabled-namespace/details-v1-pod-old"},
 		},
 	},
+	{
+		name:       "serviceTargetPorts",
+		inputFiles: []string{"testdata/service-targetports.yaml"},
+		analyzer:   &service.TargetPortAnalyzer{},
+		expected: []message{
+			{msg.TargetPortNotFound, "Service/default/reviews"},
+			{msg.TargetPortMismatch, "Service/default/reviews"},
+		},
+	},
 	{
 		name:       "virtualServiceDestinationHosts",
 		inputFiles: []string{"testdata/virtualservice_destinationhosts.yaml"},
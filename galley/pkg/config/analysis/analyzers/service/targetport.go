@@ -0,0 +1,129 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	k8s_labels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"istio.io/istio/galley/pkg/config/analysis"
+	"istio.io/istio/galley/pkg/config/analysis/msg"
+	"istio.io/istio/galley/pkg/config/meta/metadata"
+	"istio.io/istio/galley/pkg/config/meta/schema/collection"
+	"istio.io/istio/galley/pkg/config/resource"
+)
+
+// TargetPortAnalyzer checks that the named target ports of the services resolve to a container port of each pod
+// selected by the services. The pods without the port receive no traffic on it, neither from the other workloads
+// nor from their own sidecar, which has no inbound cluster for it. The named target ports resolving to different
+// container ports across the pods are supported, and only reported for information.
+type TargetPortAnalyzer struct{}
+
+var _ analysis.Analyzer = &TargetPortAnalyzer{}
+
+// Metadata implements analysis.Analyzer
+func (*TargetPortAnalyzer) Metadata() analysis.Metadata {
+	return analysis.Metadata{
+		Name: "service.TargetPortAnalyzer",
+		Inputs: collection.Names{
+			metadata.K8SCoreV1Pods,
+			metadata.K8SCoreV1Services,
+		},
+	}
+}
+
+// Analyze implements analysis.Analyzer
+func (a *TargetPortAnalyzer) Analyze(c analysis.Context) {
+	c.ForEach(metadata.K8SCoreV1Services, func(r *resource.Entry) bool {
+		a.analyzeService(r, c)
+		return true
+	})
+}
+
+func (*TargetPortAnalyzer) analyzeService(r *resource.Entry, c analysis.Context) {
+	service := r.Item.(*v1.ServiceSpec)
+	if len(service.Selector) == 0 {
+		// The endpoints of services without selectors are not pods.
+		return
+	}
+	var namedPorts []v1.ServicePort
+	for _, port := range service.Ports {
+		if port.TargetPort.Type == intstr.String && port.TargetPort.StrVal != "" {
+			namedPorts = append(namedPorts, port)
+		}
+	}
+	if len(namedPorts) == 0 {
+		return
+	}
+
+	ns, _ := r.Metadata.Name.InterpretAsNamespaceAndName()
+	selector := k8s_labels.SelectorFromSet(service.Selector)
+	var pods []*v1.Pod
+	c.ForEach(metadata.K8SCoreV1Pods, func(rPod *resource.Entry) bool {
+		pod := rPod.Item.(*v1.Pod)
+		if pod.ObjectMeta.Namespace == ns && selector.Matches(k8s_labels.Set(pod.ObjectMeta.Labels)) {
+			pods = append(pods, pod)
+		}
+		return true
+	})
+
+	for _, port := range namedPorts {
+		containerPorts := make(map[int32]struct{})
+		for _, pod := range pods {
+			containerPort, found := findContainerPort(pod, port)
+			if !found {
+				c.Report(metadata.K8SCoreV1Services,
+					msg.NewTargetPortNotFound(r, port.TargetPort.StrVal, int(port.Port), pod.ObjectMeta.Name))
+				continue
+			}
+			containerPorts[containerPort] = struct{}{}
+		}
+		if len(containerPorts) > 1 {
+			ports := make([]string, 0, len(containerPorts))
+			for p := range containerPorts {
+				ports = append(ports, fmt.Sprint(p))
+			}
+			sort.Strings(ports)
+			c.Report(metadata.K8SCoreV1Services,
+				msg.NewTargetPortMismatch(r, port.TargetPort.StrVal, int(port.Port), strings.Join(ports, ", ")))
+		}
+	}
+}
+
+// findContainerPort resolves the named target port of the service port in the containers of the pod, as Kubernetes
+// does. The protocols default to TCP.
+func findContainerPort(pod *v1.Pod, port v1.ServicePort) (int32, bool) {
+	protocol := port.Protocol
+	if protocol == "" {
+		protocol = v1.ProtocolTCP
+	}
+	for _, container := range pod.Spec.Containers {
+		for _, p := range container.Ports {
+			containerProtocol := p.Protocol
+			if containerProtocol == "" {
+				containerProtocol = v1.ProtocolTCP
+			}
+			if p.Name == port.TargetPort.StrVal && containerProtocol == protocol {
+				return p.ContainerPort, true
+			}
+		}
+	}
+	return 0, false
+}
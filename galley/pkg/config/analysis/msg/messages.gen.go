@@ -56,6 +56,14 @@ var (
 	// UnknownAnnotation defines a diag.MessageType for message "UnknownAnnotation".
 	// Description: An Istio annotation is not recognized for any kind of resource
 	UnknownAnnotation = diag.NewMessageType(diag.Warning, "IST0108", "Unknown annotation: %s")
+
+	// TargetPortNotFound defines a diag.MessageType for message "TargetPortNotFound".
+	// Description: A named target port of a service is not a container port of a pod selected by the service.
+	TargetPortNotFound = diag.NewMessageType(diag.Warning, "IST0109", "The target port %q of service port %d is not a container port of pod %s, which receives no traffic on this port")
+
+	// TargetPortMismatch defines a diag.MessageType for message "TargetPortMismatch".
+	// Description: A named target port of a service resolves to different container ports across the pods of the service.
+	TargetPortMismatch = diag.NewMessageType(diag.Info, "IST0110", "The target port %q of service port %d resolves to different container ports across the pods of the service: %s")
 )
 
 // NewInternalError returns a new diag.Message based on InternalError.
@@ -172,6 +180,28 @@ func NewUnknownAnnotation(entry *resource.Entry, annotation string) diag.Message
 	)
 }
 
+// NewTargetPortNotFound returns a new diag.Message based on TargetPortNotFound.
+func NewTargetPortNotFound(entry *resource.Entry, targetPort string, port int, pod string) diag.Message {
+	return diag.NewMessage(
+		TargetPortNotFound,
+		originOrNil(entry),
+		targetPort,
+		port,
+		pod,
+	)
+}
+
+// NewTargetPortMismatch returns a new diag.Message based on TargetPortMismatch.
+func NewTargetPortMismatch(entry *resource.Entry, targetPort string, port int, containerPorts string) diag.Message {
+	return diag.NewMessage(
+		TargetPortMismatch,
+		originOrNil(entry),
+		targetPort,
+		port,
+		containerPorts,
+	)
+}
+
 func originOrNil(e *resource.Entry) resource.Origin {
 	var o resource.Origin
 	if e != nil {
@@ -0,0 +1,190 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	klabels "k8s.io/apimachinery/pkg/labels"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+const (
+	// impactAuditAnnotation is the audit annotation of the admission responses with the estimated impact of
+	// the change.
+	impactAuditAnnotation = "impact"
+
+	// proxyContainerName is the name of the sidecar and gateway containers counted as proxies.
+	proxyContainerName = "istio-proxy"
+)
+
+// The xDS types changed by the configurations.
+const (
+	lds = "LDS"
+	rds = "RDS"
+	cds = "CDS"
+	eds = "EDS"
+)
+
+// impact is the estimated blast radius of a configuration change: the proxies receiving a push and the xDS
+// types changing.
+type impact struct {
+	// namespace of the proxies receiving a push, all namespaces if empty.
+	namespace string
+	// selector of the proxies receiving a push, all the proxies of the namespace if empty.
+	selector map[string]string
+	// wildcard is true if the configuration has wildcard hosts.
+	wildcard bool
+	xdsTypes []string
+	// proxies is the number of proxies receiving a push, -1 if not counted.
+	proxies int
+}
+
+func (i impact) String() string {
+	scope := "mesh"
+	if i.namespace != "" {
+		scope = "namespace " + i.namespace
+	}
+	if len(i.selector) > 0 {
+		scope += " workloads " + klabels.SelectorFromSet(i.selector).String()
+	}
+	if i.wildcard {
+		scope += ", wildcard hosts"
+	}
+	proxies := "unknown number of proxies"
+	if i.proxies >= 0 {
+		proxies = fmt.Sprintf("%d proxies", i.proxies)
+	}
+	return fmt.Sprintf("%s (%s) receive %s", proxies, scope, strings.Join(i.xdsTypes, ","))
+}
+
+// estimateImpact estimates the proxies receiving a push and the xDS types changing when the configuration is
+// created or updated. The configurations of the root namespace of the mesh config apply to the whole mesh.
+func estimateImpact(cfg *model.Config, rootNamespace string) impact {
+	i := impact{namespace: cfg.Namespace, proxies: -1}
+	switch spec := cfg.Spec.(type) {
+	case *networking.VirtualService:
+		i.namespace = exportNamespace(cfg.Namespace, spec.ExportTo)
+		i.wildcard = hasWildcard(spec.Hosts)
+		i.xdsTypes = []string{rds}
+		if len(spec.Tcp) > 0 || len(spec.Tls) > 0 {
+			i.xdsTypes = append(i.xdsTypes, lds)
+		}
+	case *networking.DestinationRule:
+		i.namespace = exportNamespace(cfg.Namespace, spec.ExportTo)
+		i.wildcard = hasWildcard([]string{spec.Host})
+		i.xdsTypes = []string{cds, eds}
+	case *networking.ServiceEntry:
+		i.namespace = exportNamespace(cfg.Namespace, spec.ExportTo)
+		i.wildcard = hasWildcard(spec.Hosts)
+		i.xdsTypes = []string{cds, eds, lds, rds}
+	case *networking.Gateway:
+		// The gateways select their workloads in all the namespaces.
+		i.namespace = ""
+		i.selector = spec.Selector
+		i.xdsTypes = []string{lds, rds}
+	case *networking.Sidecar:
+		i.selector = spec.GetWorkloadSelector().GetLabels()
+		i.xdsTypes = []string{lds, rds, cds, eds}
+	case *networking.EnvoyFilter:
+		i.selector = spec.GetWorkloadSelector().GetLabels()
+		i.xdsTypes = envoyFilterXDSTypes(spec)
+	default:
+		i.xdsTypes = []string{lds}
+	}
+	if i.namespace == rootNamespace && len(i.selector) == 0 {
+		i.namespace = ""
+	}
+	sort.Strings(i.xdsTypes)
+	return i
+}
+
+// exportNamespace returns the namespace a configuration is exported to, or "" if it is exported to all the
+// namespaces.
+func exportNamespace(namespace string, exportTo []string) string {
+	if len(exportTo) == 1 && exportTo[0] == "." {
+		return namespace
+	}
+	return ""
+}
+
+func hasWildcard(hosts []string) bool {
+	for _, h := range hosts {
+		if strings.HasPrefix(h, "*") {
+			return true
+		}
+	}
+	return false
+}
+
+func envoyFilterXDSTypes(spec *networking.EnvoyFilter) []string {
+	types := make(map[string]bool)
+	for _, cp := range spec.ConfigPatches {
+		switch cp.ApplyTo {
+		case networking.EnvoyFilter_CLUSTER:
+			types[cds] = true
+		case networking.EnvoyFilter_ROUTE_CONFIGURATION, networking.EnvoyFilter_VIRTUAL_HOST,
+			networking.EnvoyFilter_HTTP_ROUTE:
+			types[rds] = true
+		default:
+			types[lds] = true
+		}
+	}
+	if len(types) == 0 {
+		// The deprecated filters are added to the listeners.
+		types[lds] = true
+	}
+	out := make([]string, 0, len(types))
+	for t := range types {
+		out = append(out, t)
+	}
+	return out
+}
+
+// countProxies counts the proxies receiving a push, i.e. the pods with a proxy container of the impact scope,
+// from the pod cache.
+func (wh *Webhook) countProxies(i *impact) error {
+	if wh.podInformer == nil || !wh.podInformer.HasSynced() {
+		return errors.New("the pod cache is not synced")
+	}
+	selector := klabels.SelectorFromSet(i.selector)
+	var pods []*v1.Pod
+	var err error
+	if i.namespace == "" {
+		pods, err = wh.podLister.List(selector)
+	} else {
+		pods, err = wh.podLister.Pods(i.namespace).List(selector)
+	}
+	if err != nil {
+		return err
+	}
+	i.proxies = 0
+	for _, pod := range pods {
+		for _, c := range pod.Spec.Containers {
+			if c.Name == proxyContainerName {
+				i.proxies++
+				break
+			}
+		}
+	}
+	return nil
+}
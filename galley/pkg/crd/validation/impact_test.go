@@ -0,0 +1,167 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestEstimateImpact(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  *model.Config
+		want impact
+	}{
+		{
+			name: "wildcard virtual service",
+			cfg: &model.Config{
+				ConfigMeta: model.ConfigMeta{Name: "vs", Namespace: "default"},
+				Spec: &networking.VirtualService{
+					Hosts: []string{"*.example.com"},
+					Tcp:   []*networking.TCPRoute{{}},
+				},
+			},
+			want: impact{wildcard: true, xdsTypes: []string{lds, rds}, proxies: -1},
+		},
+		{
+			name: "destination rule exported to its namespace",
+			cfg: &model.Config{
+				ConfigMeta: model.ConfigMeta{Name: "dr", Namespace: "default"},
+				Spec:       &networking.DestinationRule{Host: "reviews", ExportTo: []string{"."}},
+			},
+			want: impact{namespace: "default", xdsTypes: []string{cds, eds}, proxies: -1},
+		},
+		{
+			name: "sidecar of workloads",
+			cfg: &model.Config{
+				ConfigMeta: model.ConfigMeta{Name: "sidecar", Namespace: "default"},
+				Spec: &networking.Sidecar{
+					WorkloadSelector: &networking.WorkloadSelector{Labels: map[string]string{"app": "reviews"}},
+				},
+			},
+			want: impact{namespace: "default", selector: map[string]string{"app": "reviews"},
+				xdsTypes: []string{cds, eds, lds, rds}, proxies: -1},
+		},
+		{
+			name: "envoy filter of the root namespace",
+			cfg: &model.Config{
+				ConfigMeta: model.ConfigMeta{Name: "ef", Namespace: "istio-system"},
+				Spec: &networking.EnvoyFilter{
+					ConfigPatches: []*networking.EnvoyFilter_EnvoyConfigObjectPatch{
+						{ApplyTo: networking.EnvoyFilter_HTTP_FILTER},
+						{ApplyTo: networking.EnvoyFilter_CLUSTER},
+					},
+				},
+			},
+			want: impact{xdsTypes: []string{cds, lds}, proxies: -1},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := estimateImpact(c.cfg, "istio-system"); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("estimateImpact() = %#v, want %#v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestCountProxies(t *testing.T) {
+	pod := func(name string, containers ...string) *v1.Pod {
+		p := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "reviews"}}}
+		for _, c := range containers {
+			p.Spec.Containers = append(p.Spec.Containers, v1.Container{Name: c})
+		}
+		return p
+	}
+	pods := informers.NewSharedInformerFactory(fake.NewSimpleClientset(
+		pod("reviews-v1", "reviews", proxyContainerName),
+		pod("reviews-v2", "reviews", proxyContainerName),
+		pod("reviews-job", "job"),
+	), 0).Core().V1().Pods()
+	wh := &Webhook{podInformer: pods.Informer(), podLister: pods.Lister()}
+
+	i := impact{namespace: "default", selector: map[string]string{"app": "reviews"}, xdsTypes: []string{lds}, proxies: -1}
+	if err := wh.countProxies(&i); err == nil {
+		t.Error("countProxies() succeeded before the pod cache synced")
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go wh.podInformer.Run(stop)
+	if !cache.WaitForCacheSync(stop, wh.podInformer.HasSynced) {
+		t.Fatal("the pod cache did not sync")
+	}
+
+	if err := wh.countProxies(&i); err != nil {
+		t.Fatal(err)
+	}
+	if i.proxies != 2 {
+		t.Errorf("countProxies() counted %d proxies, want 2", i.proxies)
+	}
+	if want := "2 proxies (namespace default workloads app=reviews) receive LDS"; i.String() != want {
+		t.Errorf("impact.String() = %q, want %q", i.String(), want)
+	}
+}
+
+func TestRootNamespace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mesh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "mesh")
+	if err := ioutil.WriteFile(file, []byte("rootNamespace: istio-config"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := rootNamespace(file, "istio-system"); got != "istio-config" {
+		t.Errorf("rootNamespace() = %q, want istio-config", got)
+	}
+	if got := rootNamespace(filepath.Join(dir, "missing"), "istio-system"); got != "istio-system" {
+		t.Errorf("rootNamespace() of a missing file = %q, want istio-system", got)
+	}
+	if got := rootNamespace("", "istio-system"); got != "istio-system" {
+		t.Errorf("rootNamespace() without a file = %q, want istio-system", got)
+	}
+}
+
+func TestResponseWarnings(t *testing.T) {
+	response := &admissionv1beta1.AdmissionResponse{
+		Allowed:          true,
+		AuditAnnotations: map[string]string{impactAuditAnnotation: "2 proxies (mesh) receive LDS"},
+	}
+	want := []string{"estimated impact: 2 proxies (mesh) receive LDS"}
+	if got := responseWarnings(response); !reflect.DeepEqual(got, want) {
+		t.Errorf("responseWarnings() = %v, want %v", got, want)
+	}
+	if got := responseWarnings(&admissionv1beta1.AdmissionResponse{Allowed: true}); got != nil {
+		t.Errorf("responseWarnings() without impact = %v, want none", got)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	v1 "k8s.io/api/core/v1"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/kube"
+)
+
+// validateVirtualServicePorts rejects the virtual services with rules that cannot apply to the ports of the
+// Kubernetes services of their hosts because of the port protocols, see model.VirtualServicePortErrors. The hosts
+// without a service, e.g. created after the virtual service, are not validated.
+func (wh *Webhook) validateVirtualServicePorts(cfg *model.Config) error {
+	rule, ok := cfg.Spec.(*networking.VirtualService)
+	if !ok || wh.serviceInformer == nil || !wh.serviceInformer.HasSynced() {
+		return nil
+	}
+	var errs *multierror.Error
+	for _, h := range rule.Hosts {
+		name, namespace := wh.serviceOfHost(h, cfg.Namespace)
+		if name == "" {
+			continue
+		}
+		svc, err := wh.serviceLister.Services(namespace).Get(name)
+		if err != nil {
+			continue
+		}
+		for _, e := range model.VirtualServicePortErrors(rule, wh.convertService(svc)) {
+			errs = multierror.Append(errs, errors.New(e))
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// serviceOfHost returns the name and namespace of the Kubernetes service of a virtual service host, either a short
+// name in the namespace of the virtual service, name.namespace, or the FQDN of the service. It returns an empty
+// name for the wildcard and the external hosts.
+func (wh *Webhook) serviceOfHost(h, namespace string) (string, string) {
+	if strings.Contains(h, "*") {
+		return "", ""
+	}
+	if wh.domainSuffix != "" {
+		h = strings.TrimSuffix(h, ".svc."+wh.domainSuffix)
+	}
+	parts := strings.Split(h, ".")
+	switch len(parts) {
+	case 1:
+		return parts[0], namespace
+	case 2:
+		return parts[0], parts[1]
+	default:
+		return "", ""
+	}
+}
+
+// convertService converts the ports of a Kubernetes service, with their protocols as Pilot infers them.
+func (wh *Webhook) convertService(svc *v1.Service) *model.Service {
+	out := &model.Service{Hostname: host.Name(fmt.Sprintf("%s.%s.svc.%s", svc.Name, svc.Namespace, wh.domainSuffix))}
+	for _, port := range svc.Spec.Ports {
+		out.Ports = append(out.Ports, &model.Port{
+			Name:     port.Name,
+			Port:     int(port.Port),
+			Protocol: kube.ConvertProtocol(port.Port, port.Name, port.Protocol),
+		})
+	}
+	return out
+}
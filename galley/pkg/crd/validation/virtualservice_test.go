@@ -0,0 +1,71 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestValidateVirtualServicePorts(t *testing.T) {
+	services := informers.NewSharedInformerFactory(fake.NewSimpleClientset(&v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+		Spec: v1.ServiceSpec{Ports: []v1.ServicePort{
+			{Name: "http", Port: 8080, Protocol: v1.ProtocolTCP},
+			{Name: "tcp-postgres", Port: 5432, Protocol: v1.ProtocolTCP},
+		}},
+	}), 0).Core().V1().Services()
+	wh := &Webhook{domainSuffix: "cluster.local", serviceInformer: services.Informer(), serviceLister: services.Lister()}
+	stop := make(chan struct{})
+	defer close(stop)
+	go wh.serviceInformer.Run(stop)
+	if !cache.WaitForCacheSync(stop, wh.serviceInformer.HasSynced) {
+		t.Fatal("the service cache did not sync")
+	}
+
+	httpRoute := func(port uint32) []*networking.HTTPRoute {
+		return []*networking.HTTPRoute{{Match: []*networking.HTTPMatchRequest{{Port: port}}}}
+	}
+	cases := []struct {
+		name    string
+		rule    *networking.VirtualService
+		wantErr bool
+	}{
+		{"HTTP port", &networking.VirtualService{Hosts: []string{"db"}, Http: httpRoute(8080)}, false},
+		{"TCP port", &networking.VirtualService{Hosts: []string{"db"}, Http: httpRoute(5432)}, true},
+		{"FQDN", &networking.VirtualService{Hosts: []string{"db.default.svc.cluster.local"}, Http: httpRoute(5432)}, true},
+		{"other namespace", &networking.VirtualService{Hosts: []string{"db.prod"}, Http: httpRoute(5432)}, false},
+		{"external host", &networking.VirtualService{Hosts: []string{"db.example.com"}, Http: httpRoute(5432)}, false},
+		{"gateway", &networking.VirtualService{Hosts: []string{"db"}, Gateways: []string{"ingressgateway"},
+			Http: httpRoute(5432)}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := &model.Config{ConfigMeta: model.ConfigMeta{Name: "db", Namespace: "default"}, Spec: c.rule}
+			if err := wh.validateVirtualServicePorts(cfg); (err != nil) != c.wantErr {
+				t.Errorf("validateVirtualServicePorts() = %v, wantErr %v", err, c.wantErr)
+			}
+		})
+	}
+}
@@ -32,13 +32,16 @@ import (
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/informers"
 	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 
 	mixerCrd "istio.io/istio/mixer/pkg/config/crd"
 	"istio.io/istio/mixer/pkg/config/store"
 	"istio.io/istio/pilot/pkg/config/kube/crd"
 	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/config/mesh"
 	"istio.io/istio/pkg/config/schema"
 )
 
@@ -121,6 +124,14 @@ type WebhookParameters struct {
 
 	// Enable reconcile validatingwebhookconfiguration
 	EnableReconcileWebhookConfiguration bool
+
+	// EnableImpactEstimation attaches to the admission responses of the pilot configuration the estimated
+	// number of proxies receiving a push and the xDS types changing, as the impact audit annotation and as a
+	// warning.
+	EnableImpactEstimation bool
+
+	// MeshConfigFile is the mesh configuration file, read for the root namespace of the impact estimation.
+	MeshConfigFile string
 }
 
 type createInformerEndpointSource func(cl clientset.Interface, namespace, name string) cache.ListerWatcher
@@ -151,6 +162,8 @@ func (p *WebhookParameters) String() string {
 	fmt.Fprintf(buf, "ServiceName: %s\n", p.ServiceName)
 	fmt.Fprintf(buf, "EnableValidation: %v\n", p.EnableValidation)
 	fmt.Fprintf(buf, "EnableReconcileWebhookConfiguration: %v\n", p.EnableReconcileWebhookConfiguration)
+	fmt.Fprintf(buf, "EnableImpactEstimation: %v\n", p.EnableImpactEstimation)
+	fmt.Fprintf(buf, "MeshConfigFile: %s\n", p.MeshConfigFile)
 
 	return buf.String()
 }
@@ -189,6 +202,15 @@ type Webhook struct {
 	deploymentName                string
 	serviceName                   string
 	webhookName                   string
+	enableImpactEstimation        bool
+	rootNamespace                 string
+
+	// caches of the services validating the virtual service ports, and of the pods of the impact estimation
+	informers       informers.SharedInformerFactory
+	serviceInformer cache.SharedIndexInformer
+	serviceLister   corelisters.ServiceLister
+	podInformer     cache.SharedIndexInformer
+	podLister       corelisters.PodLister
 
 	// test hook for informers
 	createInformerEndpointSource createInformerEndpointSource
@@ -207,15 +229,32 @@ func NewWebhook(p WebhookParameters) (*Webhook, error) {
 		},
 		cert:                          &pair,
 		descriptor:                    p.PilotDescriptor,
+		domainSuffix:                  p.DomainSuffix,
 		validator:                     p.MixerValidator,
 		clientset:                     p.Clientset,
 		deploymentName:                p.DeploymentName,
 		serviceName:                   p.ServiceName,
 		webhookName:                   p.WebhookName,
 		deploymentAndServiceNamespace: p.DeploymentAndServiceNamespace,
+		enableImpactEstimation:        p.EnableImpactEstimation,
 		createInformerEndpointSource:  defaultCreateInformerEndpointSource,
 	}
 
+	if wh.enableImpactEstimation {
+		wh.rootNamespace = rootNamespace(p.MeshConfigFile, p.DeploymentAndServiceNamespace)
+	}
+	if p.Clientset != nil {
+		wh.informers = informers.NewSharedInformerFactory(p.Clientset, 0)
+		services := wh.informers.Core().V1().Services()
+		wh.serviceInformer = services.Informer()
+		wh.serviceLister = services.Lister()
+		if wh.enableImpactEstimation {
+			pods := wh.informers.Core().V1().Pods()
+			wh.podInformer = pods.Informer()
+			wh.podLister = pods.Lister()
+		}
+	}
+
 	// mtls disabled because apiserver webhook cert usage is still TBD.
 	wh.server.TLSConfig = &tls.Config{GetCertificate: wh.getCert}
 	h := http.NewServeMux()
@@ -227,6 +266,25 @@ func NewWebhook(p WebhookParameters) (*Webhook, error) {
 	return wh, nil
 }
 
+// rootNamespace returns the root namespace of the mesh configuration file, or the fallback namespace if the
+// file cannot be read.
+func rootNamespace(meshConfigFile, fallback string) string {
+	if meshConfigFile == "" {
+		return fallback
+	}
+	data, err := ioutil.ReadFile(meshConfigFile)
+	if err != nil {
+		scope.Warnf("cannot read the mesh config file %s, using the root namespace %s: %v", meshConfigFile, fallback, err)
+		return fallback
+	}
+	m, err := mesh.ApplyMeshConfigDefaults(string(data))
+	if err != nil || m.RootNamespace == "" {
+		scope.Warnf("invalid mesh config file %s, using the root namespace %s: %v", meshConfigFile, fallback, err)
+		return fallback
+	}
+	return m.RootNamespace
+}
+
 //Stop the server
 func (wh *Webhook) Stop() {
 	wh.server.Close() // nolint: errcheck
@@ -234,6 +292,10 @@ func (wh *Webhook) Stop() {
 
 // Run implements the webhook server
 func (wh *Webhook) Run(ready chan struct{}, stopCh <-chan struct{}) {
+	if wh.informers != nil {
+		wh.informers.Start(stopCh)
+	}
+
 	go func() {
 		if err := wh.server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
 			scope.Fatalf("admission webhook ListenAndServeTLS failed: %v", err)
@@ -266,6 +328,28 @@ func toAdmissionResponse(err error) *admissionv1beta1.AdmissionResponse {
 	return &admissionv1beta1.AdmissionResponse{Result: &v1.Status{Message: err.Error()}}
 }
 
+// admissionResponse is the admission response with the warnings shown to the client, supported by the API
+// servers 1.19 and later and ignored by the older ones.
+type admissionResponse struct {
+	*admissionv1beta1.AdmissionResponse
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// admissionReview is the admission review returned with the warnings of the response.
+type admissionReview struct {
+	v1.TypeMeta `json:",inline"`
+	Request     *admissionv1beta1.AdmissionRequest `json:"request,omitempty"`
+	Response    *admissionResponse                 `json:"response,omitempty"`
+}
+
+// responseWarnings returns the warnings of the response, i.e. the estimated impact of the change.
+func responseWarnings(response *admissionv1beta1.AdmissionResponse) []string {
+	if i, ok := response.AuditAnnotations[impactAuditAnnotation]; ok {
+		return []string{"estimated impact: " + i}
+	}
+	return nil
+}
+
 type admitFunc func(*admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse
 
 func serve(w http.ResponseWriter, r *http.Request, admit admitFunc) {
@@ -297,9 +381,12 @@ func serve(w http.ResponseWriter, r *http.Request, admit admitFunc) {
 		reviewResponse = admit(ar.Request)
 	}
 
-	response := admissionv1beta1.AdmissionReview{}
+	response := admissionReview{}
 	if reviewResponse != nil {
-		response.Response = reviewResponse
+		response.Response = &admissionResponse{
+			AdmissionResponse: reviewResponse,
+			Warnings:          responseWarnings(reviewResponse),
+		}
 		if ar.Request != nil {
 			response.Response.UID = ar.Request.UID
 		}
@@ -370,8 +457,23 @@ func (wh *Webhook) admitPilot(request *admissionv1beta1.AdmissionRequest) *admis
 		return toAdmissionResponse(err)
 	}
 
+	if err := wh.validateVirtualServicePorts(out); err != nil {
+		scope.Infof("configuration is invalid: %v", err)
+		reportValidationFailed(request, reasonInvalidConfig)
+		return toAdmissionResponse(fmt.Errorf("configuration is invalid: %v", err))
+	}
+
 	reportValidationPass(request)
-	return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	response := &admissionv1beta1.AdmissionResponse{Allowed: true}
+	if wh.enableImpactEstimation {
+		i := estimateImpact(out, wh.rootNamespace)
+		if err := wh.countProxies(&i); err != nil {
+			scope.Warnf("cannot count the proxies of %s %s/%s: %v", obj.Kind, out.Namespace, out.Name, err)
+		}
+		scope.Infof("%s %s/%s: %v", obj.Kind, out.Namespace, out.Name, i)
+		response.AuditAnnotations = map[string]string{impactAuditAnnotation: i.String()}
+	}
+	return response
 }
 
 func (wh *Webhook) admitMixer(request *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
@@ -0,0 +1,210 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"istio.io/istio/istioctl/pkg/util/handlers"
+	envoy_v2 "istio.io/istio/pilot/pkg/proxy/envoy/v2"
+)
+
+const cbOverridePath = "/debug/cb_overridez"
+
+var (
+	cbCluster            string
+	cbTTL                time.Duration
+	cbMaxConnections     uint32
+	cbMaxPendingRequests uint32
+	cbMaxRequests        uint32
+	cbMaxRetries         uint32
+)
+
+func circuitBreakerCmd() *cobra.Command {
+	cbCmd := &cobra.Command{
+		Use:     "circuit-breaker",
+		Short:   "Temporarily override the circuit breaker thresholds of a proxy [kube only]",
+		Aliases: []string{"cb"},
+		Long: `
+Temporarily override the default circuit breaker thresholds of a cluster of a proxy, to relieve an
+overload during an incident without editing and propagating DestinationRules. Pilot pushes the
+override to the proxy right away and removes it once its TTL elapsed, or when cleared.
+
+Setting and clearing an override requires a client certificate with one of the identities of
+PILOT_DEBUG_PROXY_IDENTITIES on the secure port of Pilot. The plain text debug port called by
+istioctl only lists the overrides, and Pilot rejects the other requests with 403 Forbidden.
+`,
+	}
+	cbCmd.AddCommand(circuitBreakerSetCmd(), circuitBreakerListCmd(), circuitBreakerClearCmd())
+	return cbCmd
+}
+
+func circuitBreakerSetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set <pod-name[.namespace]>",
+		Short: "Override the circuit breaker thresholds of a cluster of a proxy",
+		Example: `# Allow up to 5000 requests to the reviews service from productpage for the next 15 minutes
+istioctl experimental circuit-breaker set productpage-v1-8d69b45c-6whqc.default \
+  --cluster "outbound|9080||reviews.default.svc.cluster.local" --max-requests 5000 --ttl 15m`,
+		RunE: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				c.Println(c.UsageString())
+				return fmt.Errorf("set requires a pod name")
+			}
+			if cbCluster == "" {
+				return fmt.Errorf("--cluster is required")
+			}
+			podName, ns := handlers.InferPodInfo(args[0], handlers.HandleNamespace(namespace, defaultNamespace))
+			override := &envoy_v2.CircuitBreakerOverride{
+				ProxyID: fmt.Sprintf("%s.%s", podName, ns),
+				Cluster: cbCluster,
+				TTL:     cbTTL.String(),
+			}
+			threshold := func(flag string, value uint32) *uint32 {
+				if c.Flags().Changed(flag) {
+					return &value
+				}
+				return nil
+			}
+			override.MaxConnections = threshold("max-connections", cbMaxConnections)
+			override.MaxPendingRequests = threshold("max-pending-requests", cbMaxPendingRequests)
+			override.MaxRequests = threshold("max-requests", cbMaxRequests)
+			override.MaxRetries = threshold("max-retries", cbMaxRetries)
+			if override.MaxConnections == nil && override.MaxPendingRequests == nil &&
+				override.MaxRequests == nil && override.MaxRetries == nil {
+				return fmt.Errorf("at least one threshold must be set")
+			}
+
+			body, err := json.Marshal(override)
+			if err != nil {
+				return err
+			}
+			kubeClient, err := clientExecFactory(kubeconfig, configContext)
+			if err != nil {
+				return err
+			}
+			results, err := kubeClient.AllPilotsDiscoveryDo(istioNamespace, "POST", cbOverridePath, body)
+			if err != nil {
+				return err
+			}
+			// Only the Pilot the proxy is connected to accepts the override.
+			for _, result := range results {
+				applied := &envoy_v2.CircuitBreakerOverride{}
+				if json.Unmarshal(result, applied) == nil && applied.ProxyID != "" {
+					c.Printf("Circuit breaker of %s overridden for %s until %s\n",
+						applied.Cluster, applied.ProxyID, applied.Expires.Format(time.RFC3339))
+					return nil
+				}
+			}
+			return fmt.Errorf("proxy %s is not connected to any Pilot", override.ProxyID)
+		},
+	}
+	cmd.PersistentFlags().StringVar(&cbCluster, "cluster", "", "Name of the cluster, as listed by 'istioctl proxy-config cluster'")
+	cmd.PersistentFlags().DurationVar(&cbTTL, "ttl", 10*time.Minute, "Duration of the override, at most 24h")
+	cmd.PersistentFlags().Uint32Var(&cbMaxConnections, "max-connections", 0, "Maximum number of connections to the cluster")
+	cmd.PersistentFlags().Uint32Var(&cbMaxPendingRequests, "max-pending-requests", 0, "Maximum number of pending requests to the cluster")
+	cmd.PersistentFlags().Uint32Var(&cbMaxRequests, "max-requests", 0, "Maximum number of parallel requests to the cluster")
+	cmd.PersistentFlags().Uint32Var(&cbMaxRetries, "max-retries", 0, "Maximum number of parallel retries to the cluster")
+	return cmd
+}
+
+func circuitBreakerListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the active circuit breaker overrides",
+		RunE: func(c *cobra.Command, args []string) error {
+			kubeClient, err := clientExecFactory(kubeconfig, configContext)
+			if err != nil {
+				return err
+			}
+			results, err := kubeClient.AllPilotsDiscoveryDo(istioNamespace, "GET", cbOverridePath, nil)
+			if err != nil {
+				return err
+			}
+			var overrides []*envoy_v2.CircuitBreakerOverride
+			for pilot, result := range results {
+				var pilotOverrides []*envoy_v2.CircuitBreakerOverride
+				if err := json.Unmarshal(result, &pilotOverrides); err != nil {
+					return fmt.Errorf("invalid response from %s: %v", pilot, err)
+				}
+				overrides = append(overrides, pilotOverrides...)
+			}
+			printCircuitBreakerOverrides(c.OutOrStdout(), overrides)
+			return nil
+		},
+	}
+}
+
+func circuitBreakerClearCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "clear <pod-name[.namespace]>",
+		Short: "Remove the circuit breaker override of a cluster of a proxy",
+		RunE: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				c.Println(c.UsageString())
+				return fmt.Errorf("clear requires a pod name")
+			}
+			if cbCluster == "" {
+				return fmt.Errorf("--cluster is required")
+			}
+			podName, ns := handlers.InferPodInfo(args[0], handlers.HandleNamespace(namespace, defaultNamespace))
+			proxyID := fmt.Sprintf("%s.%s", podName, ns)
+			path := fmt.Sprintf("%s?proxyID=%s&cluster=%s", cbOverridePath, url.QueryEscape(proxyID), url.QueryEscape(cbCluster))
+			kubeClient, err := clientExecFactory(kubeconfig, configContext)
+			if err != nil {
+				return err
+			}
+			if _, err := kubeClient.AllPilotsDiscoveryDo(istioNamespace, "DELETE", path, nil); err != nil {
+				return err
+			}
+			c.Printf("Circuit breaker override of %s cleared for %s\n", cbCluster, proxyID)
+			return nil
+		},
+	}
+	cmd.PersistentFlags().StringVar(&cbCluster, "cluster", "", "Name of the cluster")
+	return cmd
+}
+
+func printCircuitBreakerOverrides(writer io.Writer, overrides []*envoy_v2.CircuitBreakerOverride) {
+	sort.Slice(overrides, func(i, j int) bool {
+		if overrides[i].ProxyID != overrides[j].ProxyID {
+			return overrides[i].ProxyID < overrides[j].ProxyID
+		}
+		return overrides[i].Cluster < overrides[j].Cluster
+	})
+	threshold := func(value *uint32) string {
+		if value == nil {
+			return "-"
+		}
+		return strconv.FormatUint(uint64(*value), 10)
+	}
+	w := new(tabwriter.Writer).Init(writer, 0, 8, 5, ' ', 0)
+	fmt.Fprintln(w, "PROXY\tCLUSTER\tMAX CONNECTIONS\tMAX PENDING\tMAX REQUESTS\tMAX RETRIES\tEXPIRES")
+	for _, o := range overrides {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", o.ProxyID, o.Cluster, threshold(o.MaxConnections),
+			threshold(o.MaxPendingRequests), threshold(o.MaxRequests), threshold(o.MaxRetries),
+			o.Expires.Format(time.RFC3339))
+	}
+	_ = w.Flush()
+}
@@ -515,6 +515,8 @@ func printPod(writer io.Writer, pod *v1.Pod) {
 		return
 	}
 
+	printProxyConcurrency(writer, pod)
+
 	// https://istio.io/docs/setup/kubernetes/additional-setup/requirements/
 	// says "We recommend adding an explicit app label and version label to deployments."
 	app, ok := pod.ObjectMeta.Labels["app"]
@@ -527,6 +529,25 @@ func printPod(writer io.Writer, pod *v1.Pod) {
 	}
 }
 
+// printProxyConcurrency prints the worker threads of the sidecar and where they come from.
+func printProxyConcurrency(writer io.Writer, pod *v1.Pod) {
+	value, annotated := pod.ObjectMeta.Annotations[inject.ProxyConcurrencyAnnotation]
+	concurrency := inject.ProxyConcurrency(pod)
+	switch {
+	case concurrency == 0 && annotated:
+		fmt.Fprintf(writer, "   Proxy Concurrency: one worker per node CPU core (%s=%s)\n",
+			inject.ProxyConcurrencyAnnotation, value)
+	case concurrency == 0:
+		// Not bounded by the mesh proxy config either, nothing worth reporting.
+	case annotated && value == inject.ProxyConcurrencyAuto:
+		fmt.Fprintf(writer, "   Proxy Concurrency: %d (auto, sized to the proxy CPU)\n", concurrency)
+	case annotated:
+		fmt.Fprintf(writer, "   Proxy Concurrency: %d (%s)\n", concurrency, inject.ProxyConcurrencyAnnotation)
+	default:
+		fmt.Fprintf(writer, "   Proxy Concurrency: %d\n", concurrency)
+	}
+}
+
 func name(config model.Config) string {
 	ns := handlers.HandleNamespace(namespace, defaultNamespace)
 	if config.ConfigMeta.Namespace == ns {
@@ -602,3 +602,54 @@ func mockInterfaceFactoryGenerator(k8sConfigs []runtime.Object) func(kubeconfig
 
 	return outFactory
 }
+
+func TestPrintProxyConcurrency(t *testing.T) {
+	pod := func(annotations map[string]string, args ...string) *coreV1.Pod {
+		return &coreV1.Pod{
+			ObjectMeta: metaV1.ObjectMeta{Annotations: annotations},
+			Spec: coreV1.PodSpec{
+				Containers: []coreV1.Container{{Name: "istio-proxy", Args: args}},
+			},
+		}
+	}
+	cases := []struct {
+		name string
+		pod  *coreV1.Pod
+		want string
+	}{
+		{
+			name: "mesh default",
+			pod:  pod(nil, "proxy", "--concurrency", "2"),
+			want: "   Proxy Concurrency: 2\n",
+		},
+		{
+			name: "unbounded",
+			pod:  pod(nil, "proxy"),
+			want: "",
+		},
+		{
+			name: "auto",
+			pod:  pod(map[string]string{"proxy.istio.io/concurrency": "auto"}, "proxy", "--concurrency", "4"),
+			want: "   Proxy Concurrency: 4 (auto, sized to the proxy CPU)\n",
+		},
+		{
+			name: "annotation",
+			pod:  pod(map[string]string{"proxy.istio.io/concurrency": "8"}, "proxy", "--concurrency=8"),
+			want: "   Proxy Concurrency: 8 (proxy.istio.io/concurrency)\n",
+		},
+		{
+			name: "all cores",
+			pod:  pod(map[string]string{"proxy.istio.io/concurrency": "0"}, "proxy"),
+			want: "   Proxy Concurrency: one worker per node CPU core (proxy.istio.io/concurrency=0)\n",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var out bytes.Buffer
+			printProxyConcurrency(&out, c.pod)
+			if out.String() != c.want {
+				t.Errorf("got %q, want %q", out.String(), c.want)
+			}
+		})
+	}
+}
@@ -43,7 +43,8 @@ var (
 
 	address, listenerType string
 
-	routeName string
+	routeName    string
+	routeVerbose bool
 
 	clusterName, status string
 )
@@ -438,6 +439,9 @@ func proxyConfig() *cobra.Command {
   # Retrieve route summary for route 9080.
   istioctl proxy-config route <pod-name[.namespace]> --name 9080
 
+  # Retrieve the routes of route 9080 with the virtual services that produced them.
+  istioctl proxy-config route <pod-name[.namespace]> --name 9080 --verbose
+
   # Retrieve full route dump for route 9080
   istioctl proxy-config route <pod-name[.namespace]> --name 9080 -o json
 `,
@@ -456,7 +460,8 @@ func proxyConfig() *cobra.Command {
 				return err
 			}
 			filter := configdump.RouteFilter{
-				Name: routeName,
+				Name:    routeName,
+				Verbose: routeVerbose,
 			}
 			switch outputFormat {
 			case summaryOutput:
@@ -470,6 +475,8 @@ func proxyConfig() *cobra.Command {
 	}
 
 	routeConfigCmd.PersistentFlags().StringVar(&routeName, "name", "", "Filter listeners by route name field")
+	routeConfigCmd.PersistentFlags().BoolVar(&routeVerbose, "verbose", false,
+		"Output the routes of each virtual host with the virtual service that produced them")
 
 	endpointConfigCmd := &cobra.Command{
 		Use:   "endpoint <pod-name[.namespace]>",
@@ -26,6 +26,7 @@ import (
 
 	"istio.io/istio/istioctl/cmd/istioctl/gendeployment"
 	"istio.io/istio/istioctl/pkg/install"
+	"istio.io/istio/istioctl/pkg/install/overlay"
 	"istio.io/istio/istioctl/pkg/multicluster"
 	"istio.io/istio/istioctl/pkg/validate"
 	"istio.io/istio/pilot/pkg/serviceregistry/kube/controller"
@@ -142,6 +143,8 @@ debug and diagnose their Istio mesh.
 	experimentalCmd.AddCommand(removeFromMeshCmd())
 	experimentalCmd.AddCommand(Analyze())
 	experimentalCmd.AddCommand(waitCmd())
+	experimentalCmd.AddCommand(circuitBreakerCmd())
+	experimentalCmd.AddCommand(simulateCmd())
 
 	postInstallCmd.AddCommand(Webhook())
 	experimentalCmd.AddCommand(postInstallCmd)
@@ -153,6 +156,7 @@ debug and diagnose their Istio mesh.
 	profileCmd := mesh.ProfileCmd()
 	hideInheritedFlags(profileCmd, "namespace", "istioNamespace")
 	experimentalCmd.AddCommand(profileCmd)
+	experimentalCmd.AddCommand(overlay.NewCommand())
 
 	experimentalCmd.AddCommand(multicluster.NewCreateRemoteSecretCommand())
 	experimentalCmd.AddCommand(multicluster.NewCreateTrustAnchorCommand())
@@ -0,0 +1,186 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"istio.io/istio/istioctl/pkg/util/handlers"
+	"istio.io/istio/pilot/pkg/model"
+	envoy_v2 "istio.io/istio/pilot/pkg/proxy/envoy/v2"
+)
+
+const simulatePath = "/debug/simulate"
+
+var (
+	simulateProxyID string
+	simulateLabels  []string
+	simulateOutput  string
+)
+
+func simulateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "simulate [<pod-name[.namespace]>]",
+		Short: "Show the configuration Pilot would push to a proxy, without the proxy connecting [kube only]",
+		Long: `
+Generates the listeners, routes, clusters and endpoints Pilot would push right now to the proxy of a pod, or
+to a synthetic proxy described by its node ID and labels, to review the configuration of a workload before
+rolling it out. The labels override the ones of the pod, e.g. to simulate a new version of a workload.
+`,
+		Example: `# Show the configuration of the proxy of a pod
+istioctl experimental simulate productpage-v1-8d69b45c-6whqc.default
+
+# Show the configuration of the proxy of a pod once relabeled as version v2
+istioctl experimental simulate productpage-v1-8d69b45c-6whqc.default --labels app=productpage,version=v2
+
+# Show the full configuration of a synthetic proxy, as JSON
+istioctl experimental simulate --proxy-id "sidecar~10.1.1.1~reviews-v4.default~default.svc.cluster.local" \
+  --labels app=reviews,version=v4 -o json`,
+		RunE: func(c *cobra.Command, args []string) error {
+			if (len(args) == 0) == (simulateProxyID == "") {
+				c.Println(c.UsageString())
+				return fmt.Errorf("simulate requires either a pod name or --proxy-id")
+			}
+			if simulateOutput != "short" && simulateOutput != "json" {
+				return fmt.Errorf("unknown output format %q, must be short or json", simulateOutput)
+			}
+			simulation := &envoy_v2.SimulationRequest{ProxyID: simulateProxyID}
+			if len(args) == 1 {
+				podName, ns := handlers.InferPodInfo(args[0], handlers.HandleNamespace(namespace, defaultNamespace))
+				client, err := interfaceFactory(kubeconfig)
+				if err != nil {
+					return err
+				}
+				pod, err := client.CoreV1().Pods(ns).Get(podName, metav1.GetOptions{})
+				if err != nil {
+					return err
+				}
+				if pod.Status.PodIP == "" {
+					return fmt.Errorf("pod %s.%s has no IP yet", podName, ns)
+				}
+				simulation.ProxyID = fmt.Sprintf("%s~%s~%s.%s~%s.svc.cluster.local",
+					model.SidecarProxy, pod.Status.PodIP, podName, ns, ns)
+			}
+			if len(simulateLabels) > 0 {
+				labels := map[string]string{}
+				for _, l := range simulateLabels {
+					kv := strings.SplitN(l, "=", 2)
+					if len(kv) != 2 || kv[0] == "" {
+						return fmt.Errorf("invalid label %q, must be key=value", l)
+					}
+					labels[kv[0]] = kv[1]
+				}
+				simulation.Metadata = &model.NodeMetadata{Labels: labels}
+			}
+
+			body, err := json.Marshal(simulation)
+			if err != nil {
+				return err
+			}
+			kubeClient, err := clientExecFactory(kubeconfig, configContext)
+			if err != nil {
+				return err
+			}
+			// Any Pilot can simulate a proxy, regardless of the one it is connected to.
+			out, err := kubeClient.PilotDiscoveryDo(istioNamespace, "POST", simulatePath, body)
+			if err != nil {
+				return err
+			}
+			if simulateOutput == "json" {
+				_, err = c.OutOrStdout().Write(out)
+				return err
+			}
+			result := &envoy_v2.SimulationResult{}
+			if err := json.Unmarshal(out, result); err != nil {
+				return fmt.Errorf("invalid response from Pilot: %v: %s", err, string(out))
+			}
+			return printSimulation(c.OutOrStdout(), result)
+		},
+	}
+	cmd.PersistentFlags().StringVar(&simulateProxyID, "proxy-id", "",
+		"The xDS node ID of a synthetic proxy, instead of the proxy of a pod")
+	cmd.PersistentFlags().StringSliceVarP(&simulateLabels, "labels", "l", nil,
+		"The labels of the proxy, overriding the ones of the pod, e.g. app=reviews,version=v2")
+	cmd.PersistentFlags().StringVarP(&simulateOutput, "output", "o", "short", "Output format: one of json|short")
+	return cmd
+}
+
+// printSimulation prints the names of the resources of a simulation, and the addresses of the endpoints of
+// the clusters.
+func printSimulation(writer io.Writer, result *envoy_v2.SimulationResult) error {
+	w := new(tabwriter.Writer).Init(writer, 0, 8, 5, ' ', 0)
+	fmt.Fprintf(w, "Proxy %s\n\n", result.ProxyID)
+	for _, section := range []struct {
+		title     string
+		resources []json.RawMessage
+	}{
+		{"LISTENERS", result.Listeners},
+		{"ROUTES", result.Routes},
+		{"CLUSTERS", result.Clusters},
+	} {
+		fmt.Fprintf(w, "%s (%d)\n", section.title, len(section.resources))
+		for _, r := range section.resources {
+			named := struct {
+				Name string `json:"name"`
+			}{}
+			if err := json.Unmarshal(r, &named); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "  %s\n", named.Name)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "ENDPOINTS (%d)\n", len(result.Endpoints))
+	for _, r := range result.Endpoints {
+		cla := struct {
+			ClusterName string `json:"clusterName"`
+			Endpoints   []struct {
+				LbEndpoints []struct {
+					Endpoint struct {
+						Address struct {
+							SocketAddress struct {
+								Address   string `json:"address"`
+								PortValue uint32 `json:"portValue"`
+							} `json:"socketAddress"`
+						} `json:"address"`
+					} `json:"endpoint"`
+				} `json:"lbEndpoints"`
+			} `json:"endpoints"`
+		}{}
+		if err := json.Unmarshal(r, &cla); err != nil {
+			return err
+		}
+		var addresses []string
+		for _, locality := range cla.Endpoints {
+			for _, ep := range locality.LbEndpoints {
+				addr := ep.Endpoint.Address.SocketAddress
+				addresses = append(addresses, fmt.Sprintf("%s:%d", addr.Address, addr.PortValue))
+			}
+		}
+		if len(addresses) == 0 {
+			addresses = []string{"<none>"}
+		}
+		fmt.Fprintf(w, "  %s\t%s\n", cla.ClusterName, strings.Join(addresses, ", "))
+	}
+	return w.Flush()
+}
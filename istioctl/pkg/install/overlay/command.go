@@ -0,0 +1,105 @@
+// Copyright 2019 Istio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package overlay
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// NewCommand creates the command applying layered profiles to rendered manifests.
+func NewCommand() *cobra.Command {
+	var (
+		manifest string
+		profiles []string
+		diff     bool
+		diffWith string
+	)
+	cmd := &cobra.Command{
+		Use:   "manifest-overlay",
+		Short: "Applies layered profiles of patches to a rendered installation manifest",
+		Long: `
+		manifest-overlay applies the patches of profiles to the objects of a rendered installation
+		manifest, such as the output of 'istioctl manifest generate' or 'helm template', and writes
+		the patched manifest. The patches of the base of a profile are applied first, then the ones
+		of the profiles in the order of the flags.
+
+		With --diff, it writes the diff of the patched manifest from the rendered one instead, or
+		from the manifest of --diff-with, e.g. the manifest currently installed, to preview the
+		changes before applying them.
+`,
+		Example: `
+		# Apply the canary profile, layered on the production profile, to the rendered manifest
+		istioctl manifest generate | istioctl x manifest-overlay -p canary.yaml | kubectl apply -f -
+
+		# Preview the changes of the canary profile to the installed manifest
+		istioctl x manifest-overlay -f rendered.yaml -p canary.yaml --diff --diff-with installed.yaml
+`,
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			in, err := readManifest(manifest)
+			if err != nil {
+				return err
+			}
+			out, err := Render(in, profiles...)
+			if err != nil {
+				return err
+			}
+			if !diff {
+				_, err = fmt.Fprint(c.OutOrStdout(), out)
+				return err
+			}
+			current := in
+			if diffWith != "" {
+				if current, err = readManifest(diffWith); err != nil {
+					return err
+				}
+			}
+			text, err := Diff(current, out)
+			if err != nil {
+				return err
+			}
+			if text == "" {
+				text = "Manifests match\n"
+			}
+			_, err = fmt.Fprint(c.OutOrStdout(), text)
+			return err
+		},
+	}
+
+	cmd.Flags().StringVarP(&manifest, "filename", "f", "-", "The rendered manifest, - for the standard input")
+	cmd.Flags().StringSliceVarP(&profiles, "profile", "p", nil, "The profiles to apply, in order")
+	cmd.Flags().BoolVar(&diff, "diff", false, "Write the diff of the patched manifest instead of the manifest")
+	cmd.Flags().StringVar(&diffWith, "diff-with", "", "The manifest to diff the patched manifest with, "+
+		"the rendered manifest if empty")
+	return cmd
+}
+
+func readManifest(path string) (string, error) {
+	var by []byte
+	var err error
+	if path == "-" {
+		by, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		by, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read manifest %s: %v", path, err)
+	}
+	return string(by), nil
+}
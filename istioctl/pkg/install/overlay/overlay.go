@@ -0,0 +1,302 @@
+// Copyright 2019 Istio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package overlay customizes rendered installation manifests with layered profiles of patches, applied after
+// the charts are rendered, so that installations can be customized without forking the charts.
+//
+// A profile is a YAML file of patches, optionally layered on a base profile whose patches are applied first:
+//
+//	base: production.yaml
+//	patches:
+//	- target:
+//	    kind: Deployment
+//	    name: istio-pilot
+//	  merge:
+//	    spec:
+//	      replicas: 1
+//	- target:
+//	    kind: Deployment
+//	    name: istio-pilot
+//	  json:
+//	  - op: replace
+//	    path: /spec/template/spec/containers/0/image
+//	    value: docker.io/istio/pilot:canary
+//
+// Merge patches follow RFC 7386 and JSON patches RFC 6902. A patch matching no object is an error, to catch
+// patches left behind by changes of the charts.
+package overlay
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/pmezard/go-difflib/difflib"
+	"sigs.k8s.io/yaml"
+)
+
+// Profile is a layer of patches applied to rendered manifests.
+type Profile struct {
+	// Base is the path of the profile the patches are layered on, relative to the profile.
+	Base string `json:"base,omitempty"`
+	// Patches are applied in order, to every object matching their target.
+	Patches []Patch `json:"patches,omitempty"`
+}
+
+// Patch is a merge or JSON patch of the objects matching its target.
+type Patch struct {
+	Target Target                 `json:"target"`
+	Merge  map[string]interface{} `json:"merge,omitempty"`
+	JSON   []interface{}          `json:"json,omitempty"`
+}
+
+// Target selects the objects a patch applies to. Empty fields match any value.
+type Target struct {
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+func (t Target) String() string {
+	return fmt.Sprintf("%s %s/%s", orAny(t.Kind), orAny(t.Namespace), orAny(t.Name))
+}
+
+func orAny(s string) string {
+	if s == "" {
+		return "*"
+	}
+	return s
+}
+
+func (t Target) matches(o object) bool {
+	return (t.Kind == "" || t.Kind == o.Kind) &&
+		(t.Name == "" || t.Name == o.Metadata.Name) &&
+		(t.Namespace == "" || t.Namespace == o.Metadata.Namespace)
+}
+
+// LoadProfiles loads the profiles of the paths, with their bases, into a single profile applying the patches of
+// the bases first, then the ones of the profiles in order.
+func LoadProfiles(paths ...string) (*Profile, error) {
+	out := &Profile{}
+	for _, path := range paths {
+		if err := loadProfile(path, map[string]bool{}, out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func loadProfile(path string, loading map[string]bool, out *Profile) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if loading[abs] {
+		return fmt.Errorf("profile %s is its own base", path)
+	}
+	loading[abs] = true
+
+	by, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read profile %s: %v", path, err)
+	}
+	p := &Profile{}
+	if err := yaml.UnmarshalStrict(by, p); err != nil {
+		return fmt.Errorf("failed to parse profile %s: %v", path, err)
+	}
+	if p.Base != "" {
+		base := p.Base
+		if !filepath.IsAbs(base) {
+			base = filepath.Join(filepath.Dir(path), base)
+		}
+		if err := loadProfile(base, loading, out); err != nil {
+			return err
+		}
+	}
+	out.Patches = append(out.Patches, p.Patches...)
+	return nil
+}
+
+type object struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+}
+
+func (o object) key() string {
+	return fmt.Sprintf("%s %s/%s", o.Kind, o.Metadata.Namespace, o.Metadata.Name)
+}
+
+// Apply applies the patches of the profile to the objects of the manifest, a stream of YAML documents, and
+// returns the patched manifest.
+func (p *Profile) Apply(manifest string) (string, error) {
+	docs, err := parseManifest(manifest)
+	if err != nil {
+		return "", err
+	}
+
+	for _, patch := range p.Patches {
+		matched := false
+		for _, d := range docs {
+			if !patch.Target.matches(d.object) {
+				continue
+			}
+			matched = true
+			if d.json, err = patch.apply(d.json); err != nil {
+				return "", fmt.Errorf("failed to patch %s: %v", d.key(), err)
+			}
+		}
+		if !matched {
+			return "", fmt.Errorf("patch of %s matches no object", patch.Target)
+		}
+	}
+
+	out := make([]string, 0, len(docs))
+	for _, d := range docs {
+		by, err := yaml.JSONToYAML(d.json)
+		if err != nil {
+			return "", err
+		}
+		out = append(out, string(by))
+	}
+	return strings.Join(out, "---\n"), nil
+}
+
+func (p Patch) apply(doc []byte) ([]byte, error) {
+	if p.Merge != nil {
+		merge, err := json.Marshal(p.Merge)
+		if err != nil {
+			return nil, err
+		}
+		if doc, err = jsonpatch.MergePatch(doc, merge); err != nil {
+			return nil, err
+		}
+	}
+	if len(p.JSON) > 0 {
+		by, err := json.Marshal(p.JSON)
+		if err != nil {
+			return nil, err
+		}
+		patch, err := jsonpatch.DecodePatch(by)
+		if err != nil {
+			return nil, err
+		}
+		if doc, err = patch.Apply(doc); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+type document struct {
+	object
+	json []byte
+}
+
+func parseManifest(manifest string) ([]*document, error) {
+	var docs []*document
+	for _, y := range strings.Split(manifest, "\n---") {
+		y = strings.TrimPrefix(strings.TrimSpace(y), "---")
+		if strings.TrimSpace(y) == "" {
+			continue
+		}
+		by, err := yaml.YAMLToJSON([]byte(y))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse manifest: %v", err)
+		}
+		if string(by) == "null" {
+			// Comments only.
+			continue
+		}
+		d := &document{json: by}
+		if err := json.Unmarshal(by, &d.object); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest: %v", err)
+		}
+		docs = append(docs, d)
+	}
+	return docs, nil
+}
+
+// Diff returns a unified diff of the objects of two manifests, object by object in the order of their kind,
+// namespace and name, or an empty string if they have the same objects.
+func Diff(current, desired string) (string, error) {
+	a, err := objectsByKey(current)
+	if err != nil {
+		return "", err
+	}
+	b, err := objectsByKey(desired)
+	if err != nil {
+		return "", err
+	}
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, f := a[k]; !f {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	out := strings.Builder{}
+	for _, k := range keys {
+		diff := difflib.UnifiedDiff{
+			FromFile: "current " + k,
+			A:        difflib.SplitLines(a[k]),
+			ToFile:   "desired " + k,
+			B:        difflib.SplitLines(b[k]),
+			Context:  3,
+		}
+		text, err := difflib.GetUnifiedDiffString(diff)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(text)
+	}
+	return out.String(), nil
+}
+
+func objectsByKey(manifest string) (map[string]string, error) {
+	docs, err := parseManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]string, len(docs))
+	for _, d := range docs {
+		// Round trip for the keys to be sorted.
+		by, err := yaml.JSONToYAML(d.json)
+		if err != nil {
+			return nil, err
+		}
+		out[d.key()] = string(by)
+	}
+	return out, nil
+}
+
+// Render applies the layered profiles of the paths to a rendered manifest. It is the entry point of the
+// programmatic installs, e.g. in CI, before applying the manifest.
+func Render(manifest string, profiles ...string) (string, error) {
+	p, err := LoadProfiles(profiles...)
+	if err != nil {
+		return "", err
+	}
+	return p.Apply(manifest)
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 Istio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package overlay
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const manifest = `# Rendered
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: istio-pilot
+  namespace: istio-system
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: discovery
+        image: docker.io/istio/pilot:1.4.0
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: istio-pilot
+  namespace: istio-system
+spec:
+  ports:
+  - port: 15010
+`
+
+const production = `
+patches:
+- target:
+    kind: Deployment
+    name: istio-pilot
+  merge:
+    spec:
+      replicas: 3
+`
+
+const canary = `
+base: production.yaml
+patches:
+- target:
+    kind: Deployment
+  json:
+  - op: replace
+    path: /spec/template/spec/containers/0/image
+    value: docker.io/istio/pilot:canary
+`
+
+func writeProfiles(t *testing.T, profiles map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "overlay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range profiles {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRender(t *testing.T) {
+	dir := writeProfiles(t, map[string]string{"production.yaml": production, "canary.yaml": canary})
+	defer os.RemoveAll(dir)
+
+	out, err := Render(manifest, filepath.Join(dir, "canary.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"replicas: 3", "image: docker.io/istio/pilot:canary", "port: 15010"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("patched manifest misses %q:\n%s", want, out)
+		}
+	}
+
+	diff, err := Diff(manifest, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"-  replicas: 2", "+  replicas: 3", "+      - image: docker.io/istio/pilot:canary"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("diff misses %q:\n%s", want, diff)
+		}
+	}
+	if strings.Contains(diff, "Service") {
+		t.Errorf("diff of unchanged object:\n%s", diff)
+	}
+	if diff, err := Diff(out, out); err != nil || diff != "" {
+		t.Errorf("got diff %q, %v of a manifest with itself", diff, err)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	dir := writeProfiles(t, map[string]string{
+		"unmatched.yaml": "patches:\n- target:\n    kind: DaemonSet\n  merge:\n    spec: {}\n",
+		"loop.yaml":      "base: loop.yaml\n",
+		"unknown.yaml":   "patch: []\n",
+	})
+	defer os.RemoveAll(dir)
+
+	for name, want := range map[string]string{
+		"unmatched.yaml": "matches no object",
+		"loop.yaml":      "is its own base",
+		"unknown.yaml":   "failed to parse profile",
+	} {
+		if _, err := Render(manifest, filepath.Join(dir, name)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got error %v, want %q", name, err, want)
+		}
+	}
+}
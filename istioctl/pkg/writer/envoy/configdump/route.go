@@ -19,16 +19,19 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"strings"
 	"text/tabwriter"
 
 	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
 
 	protio "istio.io/istio/istioctl/pkg/util/proto"
 )
 
 // RouteFilter is used to pass filter information into route based config writer print functions
 type RouteFilter struct {
-	Name string
+	Name    string
+	Verbose bool
 }
 
 // Verify returns true if the passed route matches the filter fields
@@ -46,15 +49,40 @@ func (c *ConfigWriter) PrintRouteSummary(filter RouteFilter) error {
 		return err
 	}
 	fmt.Fprintln(c.Stdout, "NOTE: This output only contains routes loaded via RDS.")
-	fmt.Fprintln(w, "NAME\tVIRTUAL HOSTS")
-	for _, route := range routes {
-		if filter.Verify(route) {
-			fmt.Fprintf(w, "%v\t%v\n", route.Name, len(route.GetVirtualHosts()))
+	if filter.Verbose {
+		fmt.Fprintln(w, "NAME\tVIRTUAL HOST\tROUTE\tVIRTUAL SERVICE")
+	} else {
+		fmt.Fprintln(w, "NAME\tVIRTUAL HOSTS")
+	}
+	for _, rc := range routes {
+		if !filter.Verify(rc) {
+			continue
+		}
+		if !filter.Verbose {
+			fmt.Fprintf(w, "%v\t%v\n", rc.Name, len(rc.GetVirtualHosts()))
+			continue
+		}
+		for _, vh := range rc.GetVirtualHosts() {
+			for _, r := range vh.GetRoutes() {
+				fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", rc.Name, vh.Name, r.Name, describeRouteSource(r))
+			}
 		}
 	}
 	return w.Flush()
 }
 
+// describeRouteSource returns the name.namespace of the virtual service that produced the route, from the istio
+// metadata set by Pilot, or "-" if the route was not produced by a virtual service.
+func describeRouteSource(r *route.Route) string {
+	config := r.GetMetadata().GetFilterMetadata()["istio"].GetFields()["config"].GetStringValue()
+	// The config is of the form /apis/<group>/<version>/namespaces/<namespace>/<type>/<name>.
+	parts := strings.Split(config, "/")
+	if len(parts) != 8 || parts[6] != "virtual-service" {
+		return "-"
+	}
+	return parts[7] + "." + parts[5]
+}
+
 // PrintRouteDump prints the relevant routes in the config dump to the ConfigWriter stdout
 func (c *ConfigWriter) PrintRouteDump(filter RouteFilter) error {
 	_, routes, err := c.setupRouteConfigWriter()
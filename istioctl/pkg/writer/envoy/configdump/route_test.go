@@ -19,6 +19,10 @@ import (
 	"io/ioutil"
 	"testing"
 
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	pstruct "github.com/golang/protobuf/ptypes/struct"
+
 	"istio.io/istio/pilot/test/util"
 )
 
@@ -115,3 +119,18 @@ func TestConfigWriter_PrintRouteDump(t *testing.T) {
 		})
 	}
 }
+
+func TestDescribeRouteSource(t *testing.T) {
+	r := &route.Route{Metadata: &core.Metadata{FilterMetadata: map[string]*pstruct.Struct{
+		"istio": {Fields: map[string]*pstruct.Value{
+			"config": {Kind: &pstruct.Value_StringValue{
+				StringValue: "/apis/networking.istio.io/v1alpha3/namespaces/default/virtual-service/reviews"}},
+		}},
+	}}}
+	if got := describeRouteSource(r); got != "reviews.default" {
+		t.Errorf("describeRouteSource() = %q, want %q", got, "reviews.default")
+	}
+	if got := describeRouteSource(&route.Route{}); got != "-" {
+		t.Errorf("describeRouteSource() = %q, want %q", got, "-")
+	}
+}
@@ -33,6 +33,15 @@ func ReadMeshConfig(filename string) (*meshconfig.MeshConfig, error) {
 	return mesh.ApplyMeshConfigDefaults(string(yaml))
 }
 
+// ReadMeshExtensions gets the mesh config extensions from a mesh config file
+func ReadMeshExtensions(filename string) (*mesh.Extensions, error) {
+	yaml, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, multierror.Prefix(err, "cannot read mesh config file")
+	}
+	return mesh.ApplyMeshExtensions(string(yaml))
+}
+
 // ReadMeshNetworksConfig gets mesh networks configuration from a config file
 func ReadMeshNetworksConfig(filename string) (*meshconfig.MeshNetworks, error) {
 	yaml, err := ioutil.ReadFile(filename)
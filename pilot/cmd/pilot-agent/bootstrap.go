@@ -0,0 +1,129 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/bootstrap"
+	"istio.io/istio/pkg/config/mesh"
+)
+
+// bootstrapArgs are the arguments of the bootstrap command.
+type bootstrapArgs struct {
+	ip               string
+	name             string
+	namespace        string
+	proxyType        string
+	domain           string
+	serviceCluster   string
+	discoveryAddress string
+	templateFile     string
+	output           string
+}
+
+var (
+	bootstrapFlags bootstrapArgs
+
+	// bootstrapCmd writes the bootstrap of an Envoy run without the agent, e.g. in the containers of a Docker
+	// Compose development mesh, with Pilot using the Static registry.
+	bootstrapCmd = &cobra.Command{
+		Use:   "bootstrap",
+		Short: "Generates the bootstrap config of a standalone Envoy",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			var out io.Writer = os.Stdout
+			if bootstrapFlags.output != "" {
+				f, err := os.Create(bootstrapFlags.output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out = f
+			}
+			return writeStandaloneBootstrap(bootstrapFlags, out)
+		},
+	}
+)
+
+// writeStandaloneBootstrap writes the bootstrap of a proxy of a workload at the IP, connecting to Pilot without TLS.
+func writeStandaloneBootstrap(args bootstrapArgs, w io.Writer) error {
+	ip := net.ParseIP(args.ip)
+	if ip == nil {
+		return fmt.Errorf("invalid IP %q", args.ip)
+	}
+	if args.name == "" {
+		return fmt.Errorf("the workload name is required")
+	}
+	proxyType := model.NodeType(args.proxyType)
+	if !model.IsApplicationNodeType(proxyType) {
+		return fmt.Errorf("invalid proxy type %q", args.proxyType)
+	}
+
+	node := &model.Proxy{
+		Type:        proxyType,
+		IPAddresses: []string{args.ip},
+		ID:          args.name + "." + args.namespace,
+		DNSDomain:   args.namespace + ".svc." + args.domain,
+	}
+
+	proxyConfig := mesh.DefaultProxyConfig()
+	proxyConfig.DiscoveryAddress = args.discoveryAddress
+	proxyConfig.ControlPlaneAuthPolicy = meshconfig.AuthenticationPolicy_NONE
+	proxyConfig.ServiceCluster = args.serviceCluster
+	if proxyConfig.ServiceCluster == "" {
+		proxyConfig.ServiceCluster = args.name + "." + args.namespace
+	}
+	if args.templateFile != "" {
+		proxyConfig.ProxyBootstrapTemplatePath = args.templateFile
+	}
+
+	return bootstrap.New(bootstrap.Config{
+		Node:           node.ServiceNode(),
+		DNSRefreshRate: "300s",
+		Proxy:          &proxyConfig,
+		LocalEnv:       os.Environ(),
+		NodeIPs:        node.IPAddresses,
+		PodName:        args.name,
+		PodNamespace:   args.namespace,
+		PodIP:          ip,
+	}).WriteTo(w)
+}
+
+func init() {
+	bootstrapCmd.Flags().StringVar(&bootstrapFlags.ip, "ip", "", "IP of the workload, as in the workload catalog")
+	bootstrapCmd.Flags().StringVar(&bootstrapFlags.name, "name", "", "Name of the workload")
+	bootstrapCmd.Flags().StringVar(&bootstrapFlags.namespace, "namespace", "default", "Namespace of the workload")
+	bootstrapCmd.Flags().StringVar(&bootstrapFlags.proxyType, "type", string(model.SidecarProxy),
+		fmt.Sprintf("Type of the proxy (choose from {%s, %s})", model.SidecarProxy, model.Router))
+	bootstrapCmd.Flags().StringVar(&bootstrapFlags.domain, "domain", "cluster.local", "DNS domain suffix")
+	bootstrapCmd.Flags().StringVar(&bootstrapFlags.serviceCluster, "serviceCluster", "",
+		"Service cluster of the proxy, <name>.<namespace> by default")
+	bootstrapCmd.Flags().StringVar(&bootstrapFlags.discoveryAddress, "discoveryAddress", "istio-pilot:15010",
+		"Address of the plaintext discovery service of Pilot")
+	bootstrapCmd.Flags().StringVar(&bootstrapFlags.templateFile, "templateFile", "",
+		"Go template bootstrap config, the template of the proxy image by default")
+	bootstrapCmd.Flags().StringVarP(&bootstrapFlags.output, "output", "o", "", "File of the bootstrap, stdout by default")
+
+	rootCmd.AddCommand(bootstrapCmd)
+}
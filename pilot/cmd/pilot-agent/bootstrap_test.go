@@ -0,0 +1,67 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWriteStandaloneBootstrap(t *testing.T) {
+	gobase := os.Getenv("ISTIO_GO")
+	if gobase == "" {
+		gobase = "../../.."
+	}
+	args := bootstrapArgs{
+		ip:               "172.20.0.10",
+		name:             "productpage",
+		namespace:        "default",
+		proxyType:        "sidecar",
+		domain:           "cluster.local",
+		discoveryAddress: "pilot:15010",
+		templateFile:     gobase + "/tools/packaging/common/envoy_bootstrap_v2.json",
+	}
+
+	var out bytes.Buffer
+	if err := writeStandaloneBootstrap(args, &out); err != nil {
+		t.Fatal(err)
+	}
+	var bootstrap struct {
+		Node struct {
+			ID      string `json:"id"`
+			Cluster string `json:"cluster"`
+		} `json:"node"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &bootstrap); err != nil {
+		t.Fatalf("invalid bootstrap: %v\n%s", err, out.String())
+	}
+	if bootstrap.Node.ID != "sidecar~172.20.0.10~productpage.default~default.svc.cluster.local" {
+		t.Errorf("unexpected node id %q", bootstrap.Node.ID)
+	}
+	if bootstrap.Node.Cluster != "productpage.default" {
+		t.Errorf("unexpected node cluster %q", bootstrap.Node.Cluster)
+	}
+	if !strings.Contains(out.String(), `"pilot"`) {
+		t.Errorf("the bootstrap does not use the discovery address:\n%s", out.String())
+	}
+
+	args.ip = "productpage"
+	if err := writeStandaloneBootstrap(args, &out); err == nil {
+		t.Error("expected an error for an invalid IP")
+	}
+}
@@ -116,6 +116,8 @@ var (
 		"number of attributes for stackdriver")
 	stackdriverTracingMaxNumberOfMessageEvents = env.RegisterIntVar("STACKDRIVER_TRACING_MAX_NUMBER_OF_MESSAGE_EVENTS", 200, "Sets the "+
 		"max number of message events for stackdriver")
+	outlierLogPathVar = env.RegisterStringVar("ISTIO_META_OUTLIER_LOG_PATH", "", "If set, the proxy logs the "+
+		"outlier detection events to this file, and the agent serves the ejections at /stats/outlier")
 
 	sdsUdsWaitTimeout = time.Minute
 
@@ -430,6 +432,7 @@ var (
 					ApplicationPorts:   parsedPorts,
 					KubeAppHTTPProbers: prober,
 					NodeType:           role.Type,
+					OutlierLogPath:     outlierLogPathVar.Get(),
 				})
 				if err != nil {
 					cancel()
@@ -458,7 +461,7 @@ var (
 				DisableReportCalls:  disableInternalTelemetry,
 			})
 
-			agent := envoy.NewAgent(envoyProxy, features.TerminationDrainDuration())
+			agent := envoy.NewAgent(envoyProxy, features.TerminationDrainDuration(), features.TerminationServeDuration())
 
 			watcher := envoy.NewWatcher(tlsCertsToWatch, agent.Restart)
 
@@ -0,0 +1,199 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"istio.io/pkg/log"
+)
+
+const (
+	// outlierStatsPath serves the outlier ejections logged by the proxy, in the Prometheus text format.
+	outlierStatsPath = "/stats/outlier"
+
+	outlierEjectAction = "EJECT"
+
+	outlierLogPollInterval = 5 * time.Second
+
+	// maxOutlierLogSize is the size above which the log is truncated once its events are counted. Envoy
+	// appends to the log, so it keeps writing at the start of the truncated file.
+	maxOutlierLogSize = 10 * 1024 * 1024
+)
+
+// outlierEvent is the subset of the outlier detection event logged by Envoy used by the agent.
+type outlierEvent struct {
+	Type        string `json:"type"`
+	ClusterName string `json:"cluster_name"`
+	UpstreamURL string `json:"upstream_url"`
+	Action      string `json:"action"`
+	Enforced    bool   `json:"enforced"`
+}
+
+type outlierEjectionKey struct {
+	clusterName  string
+	upstreamURL  string
+	ejectionType string
+}
+
+// outlierEjections counts the enforced ejections of the outlier detection event log of the proxy, per
+// cluster, upstream host and ejection type.
+type outlierEjections struct {
+	path    string
+	maxSize int64
+
+	mutex  sync.Mutex
+	counts map[outlierEjectionKey]uint64
+	// offset is the offset of the first event of the log not counted yet.
+	offset int64
+}
+
+func newOutlierEjections(path string) *outlierEjections {
+	return &outlierEjections{
+		path:    path,
+		maxSize: maxOutlierLogSize,
+		counts:  make(map[outlierEjectionKey]uint64),
+	}
+}
+
+// run counts the events appended to the log until the context is done.
+func (o *outlierEjections) run(ctx context.Context) {
+	ticker := time.NewTicker(outlierLogPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := o.poll(); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Failed to read the outlier detection event log %s: %v", o.path, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll counts the complete events appended to the log since the last poll, and truncates the log once it
+// exceeds its maximum size and all its events are counted. The events Envoy appends between the read and the
+// truncation are lost.
+func (o *outlierEjections) poll() error {
+	f, err := os.Open(o.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	// The log was truncated or rotated.
+	if info.Size() < o.offset {
+		o.offset = 0
+	}
+	if _, err := f.Seek(o.offset, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	for {
+		end := bytes.IndexByte(data, '\n')
+		if end < 0 {
+			// The last event is not completely written yet.
+			if len(data) == 0 && o.offset > o.maxSize {
+				if err := os.Truncate(o.path, 0); err != nil {
+					return err
+				}
+				o.offset = 0
+			}
+			return nil
+		}
+		line := data[:end]
+		data = data[end+1:]
+		o.offset += int64(end + 1)
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var event outlierEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			log.Debugf("Skipping invalid outlier detection event %q: %v", line, err)
+			continue
+		}
+		if event.Action != outlierEjectAction || !event.Enforced {
+			continue
+		}
+		o.counts[outlierEjectionKey{
+			clusterName:  event.ClusterName,
+			upstreamURL:  event.UpstreamURL,
+			ejectionType: event.Type,
+		}]++
+	}
+}
+
+// writeMetrics writes the ejection counts in the Prometheus text format.
+func (o *outlierEjections) writeMetrics(w io.Writer) {
+	o.mutex.Lock()
+	keys := make([]outlierEjectionKey, 0, len(o.counts))
+	for k := range o.counts {
+		keys = append(keys, k)
+	}
+	counts := make([]uint64, len(keys))
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].clusterName != keys[j].clusterName {
+			return keys[i].clusterName < keys[j].clusterName
+		}
+		if keys[i].upstreamURL != keys[j].upstreamURL {
+			return keys[i].upstreamURL < keys[j].upstreamURL
+		}
+		return keys[i].ejectionType < keys[j].ejectionType
+	})
+	for i, k := range keys {
+		counts[i] = o.counts[k]
+	}
+	o.mutex.Unlock()
+
+	_, _ = fmt.Fprintln(w, "# HELP istio_outlier_ejections_total Total enforced outlier ejections of the upstream hosts.")
+	_, _ = fmt.Fprintln(w, "# TYPE istio_outlier_ejections_total counter")
+	for i, k := range keys {
+		_, _ = fmt.Fprintf(w, "istio_outlier_ejections_total{cluster_name=%q,upstream_url=%q,type=%q} %d\n",
+			k.clusterName, k.upstreamURL, k.ejectionType, counts[i])
+	}
+}
+
+// handleOutlierStats serves the ejections, or none if the proxy does not log the outlier detection events, so
+// that all the proxies can be scraped for the mesh-wide summary.
+func (s *Server) handleOutlierStats(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if s.outlier == nil {
+		return
+	}
+	s.outlier.writeMetrics(w)
+}
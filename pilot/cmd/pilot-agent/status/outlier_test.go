@@ -0,0 +1,111 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutlierEjections(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outlier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "outlier.log")
+
+	events := `{"type":"CONSECUTIVE_5XX","cluster_name":"outbound|80||reviews","upstream_url":"10.0.0.1:9080","action":"EJECT","enforced":true}
+{"type":"CONSECUTIVE_5XX","cluster_name":"outbound|80||reviews","upstream_url":"10.0.0.1:9080","action":"UNEJECT"}
+{"type":"SUCCESS_RATE","cluster_name":"outbound|80||reviews","upstream_url":"10.0.0.2:9080","action":"EJECT","enforced":false}
+{"type":"CONSECUTIVE_5XX","cluster_name":"outbound|80||reviews","upstream_url":"10.0.0.1:9080","action":"EJECT","enforced":true}
+{"type":"CONSECUTIVE_GATEWAY_FAILURE","cluster_name":"outbound|80||ratings","upstream_url":"10.0.0.3:9080",`
+	if err := ioutil.WriteFile(path, []byte(events), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o := newOutlierEjections(path)
+	if err := o.poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The incomplete last event is counted once written.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`"action":"EJECT","enforced":true}` + "\n"); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if err := o.poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	o.writeMetrics(&out)
+	got := out.String()
+	for _, want := range []string{
+		`istio_outlier_ejections_total{cluster_name="outbound|80||ratings",upstream_url="10.0.0.3:9080",type="CONSECUTIVE_GATEWAY_FAILURE"} 1`,
+		`istio_outlier_ejections_total{cluster_name="outbound|80||reviews",upstream_url="10.0.0.1:9080",type="CONSECUTIVE_5XX"} 2`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("metrics %q do not contain %q", got, want)
+		}
+	}
+	if strings.Contains(got, "SUCCESS_RATE") {
+		t.Errorf("metrics %q contain an ejection which is not enforced", got)
+	}
+}
+
+func TestOutlierLogTruncation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outlier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "outlier.log")
+
+	event := `{"type":"CONSECUTIVE_5XX","cluster_name":"outbound|80||reviews","upstream_url":"10.0.0.1:9080","action":"EJECT","enforced":true}` + "\n"
+	if err := ioutil.WriteFile(path, []byte(strings.Repeat(event, 3)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	o := newOutlierEjections(path)
+	o.maxSize = int64(2 * len(event))
+	if err := o.poll(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+		t.Fatalf("expected the log to be truncated once its events are counted, got %v, %v", info, err)
+	}
+
+	// The events appended after the truncation are counted.
+	if err := ioutil.WriteFile(path, []byte(event), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.poll(); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	o.writeMetrics(&out)
+	want := `istio_outlier_ejections_total{cluster_name="outbound|80||reviews",upstream_url="10.0.0.1:9080",type="CONSECUTIVE_5XX"} 4`
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("metrics %q do not contain %q", out.String(), want)
+	}
+}
@@ -70,6 +70,9 @@ type Config struct {
 	NodeType           model.NodeType
 	StatusPort         uint16
 	AdminPort          uint16
+	// OutlierLogPath is the outlier detection event log of the proxy. If set, the ejections of the log are
+	// served at /stats/outlier, which serves no ejections otherwise.
+	OutlierLogPath string
 }
 
 // Server provides an endpoint for handling status probes.
@@ -79,6 +82,7 @@ type Server struct {
 	appKubeProbers      KubeAppProbers
 	statusPort          uint16
 	lastProbeSuccessful bool
+	outlier             *outlierEjections
 }
 
 // NewServer creates a new status server.
@@ -92,6 +96,9 @@ func NewServer(config Config) (*Server, error) {
 			NodeType:         config.NodeType,
 		},
 	}
+	if config.OutlierLogPath != "" {
+		s.outlier = newOutlierEjections(config.OutlierLogPath)
+	}
 	if config.KubeAppHTTPProbers == "" {
 		return s, nil
 	}
@@ -127,6 +134,10 @@ func (s *Server) Run(ctx context.Context) {
 	mux.HandleFunc(readyPath, s.handleReadyProbe)
 	mux.HandleFunc(quitPath, s.handleQuit)
 	mux.HandleFunc("/app-health/", s.handleAppProbe)
+	mux.HandleFunc(outlierStatsPath, s.handleOutlierStats)
+	if s.outlier != nil {
+		go s.outlier.run(ctx)
+	}
 
 	l, err := net.Listen("tcp", fmt.Sprintf(":%d", s.statusPort))
 	if err != nil {
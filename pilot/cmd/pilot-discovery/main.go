@@ -17,6 +17,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"path"
 	"time"
 
 	"istio.io/istio/pkg/spiffe"
@@ -29,7 +30,9 @@ import (
 	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/serviceregistry"
 	"istio.io/istio/pkg/cmd"
+	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/keepalive"
+	"istio.io/istio/pkg/tracing"
 	"istio.io/pkg/collateral"
 	"istio.io/pkg/ctrlz"
 	"istio.io/pkg/log"
@@ -40,6 +43,7 @@ var (
 	serverArgs = bootstrap.PilotArgs{
 		CtrlZOptions:     ctrlz.DefaultOptions(),
 		KeepaliveOptions: keepalive.DefaultOption(),
+		TracingOptions:   tracing.DefaultOptions(),
 	}
 
 	loggingOptions = log.DefaultOptions()
@@ -79,7 +83,16 @@ var (
 				return fmt.Errorf("failed to start discovery service: %v", err)
 			}
 
-			cmd.WaitSignal(stop)
+			if result := discoveryServer.DryRunResult(); result != nil && !serverArgs.DryRun.ServeDebug {
+				err := <-result
+				close(stop)
+				return err
+			}
+
+			cmd.WaitSignalFunc(func() {
+				discoveryServer.Drain()
+				close(stop)
+			})
 			return nil
 		},
 	}
@@ -98,8 +111,9 @@ func hasKubeRegistry() bool {
 func init() {
 	discoveryCmd.PersistentFlags().StringSliceVar(&serverArgs.Service.Registries, "registries",
 		[]string{string(serviceregistry.KubernetesRegistry)},
-		fmt.Sprintf("Comma separated list of platform service registries to read from (choose one or more from {%s, %s, %s, %s})",
-			serviceregistry.KubernetesRegistry, serviceregistry.ConsulRegistry, serviceregistry.MCPRegistry, serviceregistry.MockRegistry))
+		fmt.Sprintf("Comma separated list of platform service registries to read from (choose one or more from {%s, %s, %s, %s, %s, %s})",
+			serviceregistry.KubernetesRegistry, serviceregistry.ConsulRegistry, serviceregistry.MCPRegistry, serviceregistry.MockRegistry,
+			serviceregistry.CloudRegistry, serviceregistry.StaticRegistry))
 	discoveryCmd.PersistentFlags().StringVar(&serverArgs.Config.ClusterRegistriesNamespace, "clusterRegistriesNamespace", metav1.NamespaceAll,
 		"Namespace for ConfigMap which stores clusters configs")
 	discoveryCmd.PersistentFlags().StringVar(&serverArgs.Config.KubeConfig, "kubeconfig", "",
@@ -108,10 +122,24 @@ func init() {
 		fmt.Sprintf("File name for Istio mesh configuration. If not specified, a default mesh will be used."))
 	discoveryCmd.PersistentFlags().StringVar(&serverArgs.NetworksConfigFile, "networksConfig", "/etc/istio/config/meshNetworks",
 		fmt.Sprintf("File name for Istio mesh networks configuration. If not specified, a default mesh networks will be used."))
+	discoveryCmd.PersistentFlags().StringVar(&serverArgs.TrustBundles.File, "trustBundles", "",
+		"File of the trust bundles, PEM bundles or SPIFFE bundle endpoints whose roots are trusted by the workloads "+
+			"in addition to the mesh root")
+	discoveryCmd.PersistentFlags().StringVar(&serverArgs.TrustBundles.MeshRootFile, "trustBundlesMeshRoot",
+		path.Join(constants.AuthCertsPath, constants.RootCertFilename), "File of the mesh root merged with the trust bundles")
+	discoveryCmd.PersistentFlags().DurationVar(&serverArgs.TrustBundles.RefreshInterval, "trustBundlesRefreshInterval",
+		5*time.Minute, "Interval for refreshing the SPIFFE bundle endpoints and the mesh root of the trust bundles")
 	discoveryCmd.PersistentFlags().StringVarP(&serverArgs.Namespace, "namespace", "n", "",
 		"Select a namespace where the controller resides. If not set, uses ${POD_NAMESPACE} environment variable")
 	discoveryCmd.PersistentFlags().StringSliceVar(&serverArgs.Plugins, "plugins", bootstrap.DefaultPlugins,
 		"comma separated list of networking plugins to enable")
+	discoveryCmd.PersistentFlags().BoolVar(&serverArgs.DryRun.Enabled, "dryRun", false,
+		"Build the configuration of the mesh from the registries and config stores and write a report, "+
+			"without accepting connections from proxies nor writing to the cluster")
+	discoveryCmd.PersistentFlags().StringVar(&serverArgs.DryRun.ReportFile, "dryRunReport", "",
+		"File the dry run report is written to, standard output if not set")
+	discoveryCmd.PersistentFlags().BoolVar(&serverArgs.DryRun.ServeDebug, "dryRunServeDebug", false,
+		"Keep serving the debug API once the dry run report is written, instead of exiting")
 
 	// MCP client flags
 	discoveryCmd.PersistentFlags().IntVar(&serverArgs.MCPMaxMessageSize, "mcpMaxMsgSize", bootstrap.DefaultMCPMaxMsgSize,
@@ -140,6 +168,12 @@ func init() {
 		"URL for the Consul server")
 	discoveryCmd.PersistentFlags().DurationVar(&serverArgs.Service.Consul.Interval, "consulserverInterval", 2*time.Second,
 		"Interval (in seconds) for polling the Consul service registry")
+	discoveryCmd.PersistentFlags().StringVar(&serverArgs.Service.Cloud.InstanceGroupsFile, "cloudInstanceGroups", "",
+		"File of the cloud instance groups synced to ServiceEntries by the Cloud registry")
+	discoveryCmd.PersistentFlags().DurationVar(&serverArgs.Service.Cloud.Interval, "cloudInstanceGroupsInterval", 30*time.Second,
+		"Interval for polling the cloud instance groups")
+	discoveryCmd.PersistentFlags().StringVar(&serverArgs.Service.Static.CatalogFile, "workloadCatalog", "",
+		"File of the services and workloads of the Static registry, e.g. the containers of a Docker Compose mesh")
 
 	// using address, so it can be configured as localhost:.. (possibly UDS in future)
 	discoveryCmd.PersistentFlags().StringVar(&serverArgs.DiscoveryOptions.HTTPAddr, "httpAddr", ":8080",
@@ -148,6 +182,13 @@ func init() {
 		"Discovery service grpc address")
 	discoveryCmd.PersistentFlags().StringVar(&serverArgs.DiscoveryOptions.SecureGrpcAddr, "secureGrpcAddr", ":15012",
 		"Discovery service grpc address, with https")
+	discoveryCmd.PersistentFlags().StringVar(&serverArgs.DiscoveryOptions.HTTPSAddr, "httpsAddr", ":15017",
+		"Address of the https server presenting the self-signed certificate of PILOT_SELF_SIGNED_DNS_NAMES, e.g. to webhooks")
+	discoveryCmd.PersistentFlags().StringVar(&serverArgs.DiscoveryOptions.GrpcUDSPath, "grpcUDS", "",
+		"Path of the Unix domain socket serving the discovery service grpc with mTLS, e.g. to node-local agents")
+	discoveryCmd.PersistentFlags().BoolVar(&serverArgs.DiscoveryOptions.GrpcUDSPlaintext, "grpcUDSPlaintext", false,
+		"Serve the discovery service grpc in plain text on the Unix domain socket. "+
+			"The access is then only controlled by the permissions of the socket directory")
 	discoveryCmd.PersistentFlags().StringVar(&serverArgs.DiscoveryOptions.MonitoringAddr, "monitoringAddr", ":15014",
 		"HTTP address to use for pilot's self-monitoring information")
 	discoveryCmd.PersistentFlags().BoolVar(&serverArgs.DiscoveryOptions.EnableProfiling, "profile", true,
@@ -164,6 +205,9 @@ func init() {
 	// Attach the Istio Keepalive options to the command.
 	serverArgs.KeepaliveOptions.AttachCobraFlags(rootCmd)
 
+	// Attach the Istio tracing options to the command, to trace the push pipeline.
+	serverArgs.TracingOptions.AttachCobraFlags(rootCmd)
+
 	cmd.AddFlags(rootCmd)
 
 	rootCmd.AddCommand(discoveryCmd)
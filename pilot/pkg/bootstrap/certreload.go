@@ -0,0 +1,119 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"istio.io/pkg/log"
+)
+
+// reloadingCerts serves the key pair and the root certificates of files, reloaded when the files change, so
+// that the certificates rotated on disk are used by the new TLS handshakes without restarting the servers.
+// The established connections are kept until the client certificate of their handshake expires, when the ADS
+// streams are closed for the proxies to reconnect with their rotated client certificate.
+type reloadingCerts struct {
+	certFile, keyFile, caFile string
+
+	mu        sync.Mutex
+	certTime  time.Time
+	caTime    time.Time
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+func newReloadingCerts(certFile, keyFile, caFile string) (*reloadingCerts, error) {
+	r := &reloadingCerts{certFile: certFile, keyFile: keyFile, caFile: caFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload loads the files modified since they were last loaded.
+func (r *reloadingCerts) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if certTime, err := modTime(r.certFile); err != nil {
+		return err
+	} else if !certTime.Equal(r.certTime) {
+		cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return err
+		}
+		r.cert, r.certTime = &cert, certTime
+	}
+
+	if caTime, err := modTime(r.caFile); err != nil {
+		return err
+	} else if !caTime.Equal(r.caTime) {
+		ca, err := ioutil.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return fmt.Errorf("no certificate found in %s", r.caFile)
+		}
+		r.clientCAs, r.caTime = pool, caTime
+	}
+	return nil
+}
+
+// current reloads the modified files and returns the key pair and the root certificates. The previous ones
+// are kept if the files cannot be loaded, e.g. while they are being written.
+func (r *reloadingCerts) current() (*tls.Certificate, *x509.CertPool) {
+	if err := r.reload(); err != nil {
+		log.Warnf("cannot reload the certificates, keeping the previous ones: %v", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert, r.clientCAs
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *reloadingCerts) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, _ := r.current()
+	return cert, nil
+}
+
+// GetConfigForClient returns for tls.Config.GetConfigForClient a copy of the config with the current key
+// pair and root certificates.
+func (r *reloadingCerts) GetConfigForClient(config *tls.Config) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cert, clientCAs := r.current()
+		out := config.Clone()
+		out.GetConfigForClient = nil
+		out.GetCertificate = nil
+		out.Certificates = []tls.Certificate{*cert}
+		out.ClientCAs = clientCAs
+		return out, nil
+	}
+}
+
+func modTime(file string) (time.Time, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/mcp/testing/testcerts"
+)
+
+func TestReloadingCerts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certreload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cert, key, ca := filepath.Join(dir, "cert-chain.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "root-cert.pem")
+	write := func(file string, data []byte, modTime time.Time) {
+		if err := ioutil.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	write(cert, testcerts.ServerCert, now)
+	write(key, testcerts.ServerKey, now)
+	write(ca, testcerts.CACert, now)
+
+	certs, err := newReloadingCerts(cert, key, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := certs.GetCertificate(nil)
+	want, _ := tls.X509KeyPair(testcerts.ServerCert, testcerts.ServerKey)
+	if !bytes.Equal(got.Certificate[0], want.Certificate[0]) {
+		t.Fatal("unexpected initial certificate")
+	}
+
+	// The rotated certificate is served once written.
+	write(key, testcerts.RotatedKey, now.Add(time.Minute))
+	write(cert, testcerts.RotatedCert, now.Add(time.Minute))
+	got, _ = certs.GetCertificate(nil)
+	want, _ = tls.X509KeyPair(testcerts.RotatedCert, testcerts.RotatedKey)
+	if !bytes.Equal(got.Certificate[0], want.Certificate[0]) {
+		t.Fatal("rotated certificate not reloaded")
+	}
+
+	// The previous certificate is kept while the files are invalid.
+	write(cert, testcerts.BadCert, now.Add(2*time.Minute))
+	got, _ = certs.GetCertificate(nil)
+	if !bytes.Equal(got.Certificate[0], want.Certificate[0]) {
+		t.Fatal("previous certificate not kept")
+	}
+
+	config, err := certs.GetConfigForClient(&tls.Config{ClientAuth: tls.RequireAndVerifyClientCert})(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ClientCAs == nil || config.ClientAuth != tls.RequireAndVerifyClientCert || len(config.Certificates) != 1 {
+		t.Errorf("unexpected config for client %+v", config)
+	}
+}
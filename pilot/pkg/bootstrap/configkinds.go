@@ -0,0 +1,85 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"strings"
+
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/schema"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+// disabledConfigKinds returns the config types disabled with PILOT_DISABLED_CONFIG_KINDS.
+func disabledConfigKinds() map[string]bool {
+	disabled := make(map[string]bool)
+	for _, typ := range strings.Split(features.DisabledConfigKinds.Get(), ",") {
+		typ = strings.TrimSpace(typ)
+		if typ == "" {
+			continue
+		}
+		if _, exists := schemas.Istio.GetByType(typ); !exists {
+			log.Warnf("ignoring unknown config kind %q in %s", typ, features.DisabledConfigKinds.Name)
+			continue
+		}
+		disabled[typ] = true
+	}
+	return disabled
+}
+
+// configDescriptor returns the Istio config kinds watched by Pilot.
+func configDescriptor() schema.Set {
+	disabled := disabledConfigKinds()
+	if len(disabled) == 0 {
+		return schemas.Istio
+	}
+	out := make(schema.Set, 0, len(schemas.Istio))
+	for _, s := range schemas.Istio {
+		if !disabled[s.Type] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// disabledKindsCache is a config store cache treating the config kinds missing from its descriptor as
+// having no configs, so the config kinds disabled with PILOT_DISABLED_CONFIG_KINDS can still be listed.
+type disabledKindsCache struct {
+	model.ConfigStoreCache
+}
+
+func (c *disabledKindsCache) Get(typ, name, namespace string) *model.Config {
+	if _, exists := c.ConfigDescriptor().GetByType(typ); !exists {
+		return nil
+	}
+	return c.ConfigStoreCache.Get(typ, name, namespace)
+}
+
+func (c *disabledKindsCache) List(typ, namespace string) ([]model.Config, error) {
+	if _, exists := c.ConfigDescriptor().GetByType(typ); !exists {
+		return nil, nil
+	}
+	return c.ConfigStoreCache.List(typ, namespace)
+}
+
+func (c *disabledKindsCache) RegisterEventHandler(typ string, handler func(model.Config, model.Event)) {
+	if _, exists := c.ConfigDescriptor().GetByType(typ); !exists {
+		return
+	}
+	c.ConfigStoreCache.RegisterEventHandler(typ, handler)
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"os"
+	"testing"
+
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+func TestConfigDescriptor(t *testing.T) {
+	defer os.Unsetenv(features.DisabledConfigKinds.Name)
+
+	if got := configDescriptor(); len(got) != len(schemas.Istio) {
+		t.Fatalf("configDescriptor() has %d kinds, want all %d Istio kinds", len(got), len(schemas.Istio))
+	}
+
+	os.Setenv(features.DisabledConfigKinds.Name,
+		schemas.ServiceRole.Type+", "+schemas.EnvoyFilter.Type+",unknown-kind")
+	descriptor := configDescriptor()
+	if len(descriptor) != len(schemas.Istio)-2 {
+		t.Fatalf("configDescriptor() has %d kinds, want %d", len(descriptor), len(schemas.Istio)-2)
+	}
+	for _, typ := range []string{schemas.ServiceRole.Type, schemas.EnvoyFilter.Type} {
+		if _, exists := descriptor.GetByType(typ); exists {
+			t.Errorf("configDescriptor() contains the disabled kind %q", typ)
+		}
+	}
+
+	cache := &disabledKindsCache{memory.NewController(memory.Make(descriptor))}
+	configs, err := cache.List(schemas.EnvoyFilter.Type, "")
+	if err != nil || len(configs) != 0 {
+		t.Errorf("List() of a disabled kind = %v, %v, want no configs and no error", configs, err)
+	}
+	if cfg := cache.Get(schemas.ServiceRole.Type, "name", "ns"); cfg != nil {
+		t.Errorf("Get() of a disabled kind = %v, want nil", cfg)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/model"
+	envoyv2 "istio.io/istio/pilot/pkg/proxy/envoy/v2"
+)
+
+// DryRunArgs provide configuration for the dry run mode, where Pilot builds the configuration of the mesh from
+// its registries and config stores and reports on it, without accepting connections from proxies nor writing
+// to the cluster.
+type DryRunArgs struct {
+	Enabled bool
+	// ReportFile is the path the JSON report is written to, the standard output if empty.
+	ReportFile string
+	// ServeDebug keeps serving the debug API once the report is written, instead of exiting.
+	ServeDebug bool
+}
+
+// DryRunReport is the report of a dry run.
+type DryRunReport struct {
+	// Services is the number of services of the registries.
+	Services int `json:"services"`
+	// Configs is the number of configs by type.
+	Configs map[string]int `json:"configs"`
+	// InvalidConfigs lists the configs failing validation.
+	InvalidConfigs []string `json:"invalidConfigs,omitempty"`
+	// Namespaces holds the resources generated for a sidecar of each namespace.
+	Namespaces map[string]*DryRunResources `json:"namespaces"`
+	// PushStatus holds the errors and conflicts detected while building the push context.
+	PushStatus json.RawMessage `json:"pushStatus,omitempty"`
+	// Duration is the time taken to build the report.
+	Duration string `json:"duration"`
+}
+
+// DryRunResources counts the resources generated for a proxy.
+type DryRunResources struct {
+	Listeners int    `json:"listeners"`
+	Clusters  int    `json:"clusters"`
+	Routes    int    `json:"routes"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DryRunResult returns a channel receiving the result of the dry run once its report is written,
+// or nil when not running in dry run mode.
+func (s *Server) DryRunResult() <-chan error {
+	return s.dryRunResult
+}
+
+// initDryRun replaces the discovery servers by the dry run: the report is written once the caches synced,
+// and only the HTTP debug API is served, when requested.
+func (s *Server) initDryRun(args *PilotArgs, env *model.Environment) error {
+	s.dryRunResult = make(chan error, 1)
+
+	if args.DryRun.ServeDebug {
+		s.httpServer = &http.Server{
+			Addr:    args.DiscoveryOptions.HTTPAddr,
+			Handler: s.mux,
+		}
+		listener, err := net.Listen("tcp", args.DiscoveryOptions.HTTPAddr)
+		if err != nil {
+			return err
+		}
+		s.HTTPListeningAddr = listener.Addr()
+		s.addStartFunc(func(stop <-chan struct{}) error {
+			log.Infof("starting dry run debug service at http=%s", listener.Addr())
+			go func() {
+				if err := s.httpServer.Serve(listener); err != nil {
+					log.Warna(err)
+				}
+			}()
+			go func() {
+				<-stop
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				if err := s.httpServer.Shutdown(ctx); err != nil {
+					log.Warna(err)
+				}
+			}()
+			return nil
+		})
+	}
+
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go func() {
+			if !s.waitForCacheSync(stop) {
+				s.dryRunResult <- fmt.Errorf("failed waiting for cache sync")
+				return
+			}
+			report, err := s.dryRun(env, args.Config.ControllerOptions.DomainSuffix)
+			if err == nil {
+				err = writeDryRunReport(report, args.DryRun.ReportFile)
+			}
+			if err == nil && len(report.InvalidConfigs) > 0 {
+				err = fmt.Errorf("dry run found %d invalid configs", len(report.InvalidConfigs))
+			}
+			s.dryRunResult <- err
+		}()
+		return nil
+	})
+	return nil
+}
+
+// dryRun builds the push context, validates the configs and generates the resources of a sidecar of each namespace.
+func (s *Server) dryRun(env *model.Environment, domainSuffix string) (*DryRunReport, error) {
+	start := time.Now()
+	report := &DryRunReport{
+		Configs:    map[string]int{},
+		Namespaces: map[string]*DryRunResources{},
+	}
+
+	push := model.NewPushContext()
+	if err := push.InitContext(env, nil, nil); err != nil {
+		return nil, err
+	}
+	env.PushContext = push
+
+	namespaces := map[string]bool{}
+	for _, schema := range s.configController.ConfigDescriptor() {
+		configs, err := s.configController.List(schema.Type, model.NamespaceAll)
+		if err != nil {
+			return nil, fmt.Errorf("failed listing %s: %v", schema.Type, err)
+		}
+		report.Configs[schema.Type] = len(configs)
+		for _, cfg := range configs {
+			namespaces[cfg.Namespace] = true
+			if err := schema.Validate(cfg.Name, cfg.Namespace, cfg.Spec); err != nil {
+				report.InvalidConfigs = append(report.InvalidConfigs,
+					fmt.Sprintf("%s %s/%s: %v", schema.Type, cfg.Namespace, cfg.Name, err))
+			}
+		}
+	}
+	sort.Strings(report.InvalidConfigs)
+
+	services, err := env.Services()
+	if err != nil {
+		return nil, err
+	}
+	report.Services = len(services)
+	for _, svc := range services {
+		if svc.Attributes.Namespace != "" {
+			namespaces[svc.Attributes.Namespace] = true
+		}
+	}
+
+	for ns := range namespaces {
+		report.Namespaces[ns] = s.dryRunProxy(env, push, ns, domainSuffix)
+	}
+
+	if status, err := push.JSON(); err == nil {
+		report.PushStatus = status
+	}
+	report.Duration = time.Since(start).String()
+	return report, nil
+}
+
+// dryRunProxy generates the resources of a sidecar of the namespace without service instances.
+func (s *Server) dryRunProxy(env *model.Environment, push *model.PushContext, ns, domainSuffix string) (out *DryRunResources) {
+	out = &DryRunResources{}
+	defer func() {
+		if r := recover(); r != nil {
+			out.Error = fmt.Sprintf("panic: %v", r)
+		}
+	}()
+
+	id := fmt.Sprintf("%s~0.0.0.0~dry-run.%s~%s.svc.%s", model.SidecarProxy, ns, ns, domainSuffix)
+	proxy, err := model.ParseServiceNodeWithMetadata(id, &model.NodeMetadata{ConfigNamespace: ns})
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	if err := envoyv2.InitProxy(env, push, proxy, nil); err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	configgen := s.EnvoyXdsServer.ConfigGenerator
+	listeners := configgen.BuildListeners(env, proxy, push)
+	out.Listeners = len(listeners)
+	out.Clusters = len(configgen.BuildClusters(env, proxy, push))
+	out.Routes = len(configgen.BuildHTTPRoutes(env, proxy, push, envoyv2.RouteNames(listeners)))
+	return out
+}
+
+func writeDryRunReport(report *DryRunReport, file string) error {
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if file == "" {
+		_, err = os.Stdout.Write(append(out, '\n'))
+		return err
+	}
+	return ioutil.WriteFile(file, out, 0644)
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	prom "github.com/prometheus/common/model"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+const (
+	// rampErrorRateWindow is the window of the error rates of the ramps.
+	rampErrorRateWindow = "1m"
+
+	// rampErrorRateTimeout bounds the queries of the error rates of the ramps.
+	rampErrorRateTimeout = 5 * time.Second
+)
+
+// prometheusErrorRate returns the error rate source of the weight ramps querying the Prometheus server for the
+// ratio of the requests to the destination hosts failing with a 5xx, as reported by the destination proxies.
+func prometheusErrorRate(address string) (model.ErrorRateFunc, error) {
+	client, err := api.NewClient(api.Config{Address: address})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the Prometheus client of %s: %v", address, err)
+	}
+	promAPI := promv1.NewAPI(client)
+	return func(hosts []string) (float64, error) {
+		if len(hosts) == 0 {
+			return 0, nil
+		}
+		quoted := make([]string, 0, len(hosts))
+		for _, h := range hosts {
+			quoted = append(quoted, regexp.QuoteMeta(h))
+		}
+		selector := fmt.Sprintf(`reporter="destination",destination_service=~"%s"`, strings.Join(quoted, "|"))
+		query := fmt.Sprintf(`sum(rate(istio_requests_total{%s,response_code=~"5.."}[%s])) / sum(rate(istio_requests_total{%s}[%s]))`,
+			selector, rampErrorRateWindow, selector, rampErrorRateWindow)
+
+		ctx, cancel := context.WithTimeout(context.Background(), rampErrorRateTimeout)
+		defer cancel()
+		value, _, err := promAPI.Query(ctx, query, time.Now())
+		if err != nil {
+			return 0, fmt.Errorf("failed to query the error rate of %v: %v", hosts, err)
+		}
+		vector, ok := value.(prom.Vector)
+		if !ok {
+			return 0, fmt.Errorf("unexpected result type %s of the error rate of %v", value.Type(), hosts)
+		}
+		// No result without requests, or without failed requests.
+		if vector.Len() == 0 {
+			return 0, nil
+		}
+		return float64(vector[0].Value), nil
+	}, nil
+}
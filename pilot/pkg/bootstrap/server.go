@@ -58,22 +58,31 @@ import (
 	"istio.io/istio/pilot/pkg/config/clusterregistry"
 	"istio.io/istio/pilot/pkg/config/coredatamodel"
 	"istio.io/istio/pilot/pkg/config/kube/crd/controller"
+	"istio.io/istio/pilot/pkg/config/kube/gateway"
 	"istio.io/istio/pilot/pkg/config/kube/ingress"
+	"istio.io/istio/pilot/pkg/config/kube/protodescriptor"
+	"istio.io/istio/pilot/pkg/config/kube/smi"
 	"istio.io/istio/pilot/pkg/config/memory"
 	configmonitor "istio.io/istio/pilot/pkg/config/monitor"
 	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/leaderelection"
 	"istio.io/istio/pilot/pkg/model"
 	istio_networking "istio.io/istio/pilot/pkg/networking/core"
 	"istio.io/istio/pilot/pkg/networking/plugin"
 	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pilot/pkg/onboarding"
 	"istio.io/istio/pilot/pkg/proxy/envoy"
 	envoyv2 "istio.io/istio/pilot/pkg/proxy/envoy/v2"
+	"istio.io/istio/pilot/pkg/security/secretgrant"
+	"istio.io/istio/pilot/pkg/security/trustbundle"
 	"istio.io/istio/pilot/pkg/serviceregistry"
 	"istio.io/istio/pilot/pkg/serviceregistry/aggregate"
+	"istio.io/istio/pilot/pkg/serviceregistry/cloud"
 	"istio.io/istio/pilot/pkg/serviceregistry/consul"
 	"istio.io/istio/pilot/pkg/serviceregistry/external"
 	controller2 "istio.io/istio/pilot/pkg/serviceregistry/kube/controller"
 	srmemory "istio.io/istio/pilot/pkg/serviceregistry/memory"
+	"istio.io/istio/pilot/pkg/serviceregistry/static"
 	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/config/host"
 	"istio.io/istio/pkg/config/mesh"
@@ -84,10 +93,13 @@ import (
 	"istio.io/istio/pkg/mcp/creds"
 	"istio.io/istio/pkg/mcp/monitoring"
 	"istio.io/istio/pkg/mcp/sink"
+	"istio.io/istio/pkg/tracing"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	klabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 )
@@ -121,6 +133,18 @@ const (
 	// Default directory to store Pilot key and certificate under $HOME directory
 	DefaultDirectoryForKeyCert = "/pilot/key-cert"
 
+	// Default directory to store the self-signed key and certificate of Pilot under $HOME directory
+	DefaultDirectoryForSelfSignedKeyCert = "/pilot/self-signed-key-cert"
+
+	// certControllerElectionID is the name of the election of the certificate controller
+	certControllerElectionID = "istio-pilot-cert-controller-leader"
+
+	// cloudRegistryElectionID is the name of the election of the cloud registry controller
+	cloudRegistryElectionID = "istio-pilot-cloud-registry-leader"
+
+	// selfSignedCASecretName is the name of the secret holding the self-signed root CA of Pilot
+	selfSignedCASecretName = "istio-pilot-self-signed-ca"
+
 	// Default CA certificate path
 	// Currently, custom CA path is not supported; no API to get custom CA cert yet.
 	DefaultCACertPath = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
@@ -141,6 +165,7 @@ var (
 		plugin.Authz,
 		plugin.Health,
 		plugin.Mixer,
+		plugin.Telemetry,
 	}
 )
 
@@ -204,10 +229,35 @@ type ConsulArgs struct {
 	Interval  time.Duration
 }
 
+// CloudArgs provides configuration for the cloud instance group registry.
+type CloudArgs struct {
+	// InstanceGroupsFile is the file of the instance groups synced to ServiceEntries.
+	InstanceGroupsFile string
+	Interval           time.Duration
+}
+
+// TrustBundleArgs provides configuration for the trust bundles, the roots trusted by the workloads in addition to
+// the mesh root.
+type TrustBundleArgs struct {
+	// File of the trust bundles, watched for changes.
+	File string
+	// MeshRootFile is the mesh root merged with the roots of the trust bundles.
+	MeshRootFile string
+	// RefreshInterval of the SPIFFE bundle endpoints and the mesh root.
+	RefreshInterval time.Duration
+}
+
+// StaticArgs provides configuration for the static workload catalog registry.
+type StaticArgs struct {
+	CatalogFile string
+}
+
 // ServiceArgs provides the composite configuration for all service registries in the system.
 type ServiceArgs struct {
 	Registries []string
 	Consul     ConsulArgs
+	Cloud      CloudArgs
+	Static     StaticArgs
 }
 
 // PilotArgs provides all of the configuration parameters for the Pilot discovery service.
@@ -219,12 +269,15 @@ type PilotArgs struct {
 	Service                  ServiceArgs
 	MeshConfig               *meshconfig.MeshConfig
 	NetworksConfigFile       string
+	TrustBundles             TrustBundleArgs
 	CtrlZOptions             *ctrlz.Options
 	Plugins                  []string
 	MCPMaxMessageSize        int
 	MCPInitialWindowSize     int
 	MCPInitialConnWindowSize int
 	KeepaliveOptions         *istiokeepalive.Options
+	TracingOptions           *tracing.Options
+	DryRun                   DryRunArgs
 	// ForceStop is set as true when used for testing to make the server stop quickly
 	ForceStop bool
 }
@@ -234,6 +287,7 @@ type Server struct {
 	HTTPListeningAddr       net.Addr
 	GRPCListeningAddr       net.Addr
 	SecureGRPCListeningAddr net.Addr
+	HTTPSListeningAddr      net.Addr
 	MonitorListeningAddr    net.Addr
 
 	// TODO(nmittler): Consider alternatives to exposing these directly
@@ -241,8 +295,16 @@ type Server struct {
 	ServiceController *aggregate.Controller
 
 	mesh             *meshconfig.MeshConfig
+	meshExtensions   *mesh.Extensions
 	meshNetworks     *meshconfig.MeshNetworks
+	trustBundle      *trustbundle.Manager
+	secretGrants     *secretgrant.Controller
+	protoDescriptors *protodescriptor.Controller
 	configController model.ConfigStoreCache
+	// kubeConfigStore is the writable store of the Istio CRDs, nil if the configs are not read from them.
+	kubeConfigStore model.ConfigStoreCache
+	// meshNetworksMutex protects meshNetworks, reloaded from its file, and the mesh networks of the environment.
+	meshNetworksMutex sync.Mutex
 
 	kubeClient            kubernetes.Interface
 	startFuncs            []startFunc
@@ -250,16 +312,20 @@ type Server struct {
 	httpServer            *http.Server
 	grpcServer            *grpc.Server
 	secureHTTPServer      *http.Server
+	selfSignedHTTPSServer *http.Server
 	secureGRPCServer      *grpc.Server
 	istioConfigStore      model.IstioConfigStore
 	mux                   *http.ServeMux
 	kubeRegistry          *controller2.Controller
+	serviceEntryStore     *external.ServiceEntryStore
 	fileWatcher           filewatcher.FileWatcher
 	discoveryOptions      *coredatamodel.DiscoveryOptions
 	mcpDiscovery          *coredatamodel.MCPDiscovery
 	incrementalMcpOptions *coredatamodel.Options
 	mcpOptions            *coredatamodel.Options
 	certController        *chiron.WebhookController
+	selfSignedCerts       *chiron.SelfSignedController
+	dryRunResult          chan error
 }
 
 var podNamespaceVar = env.RegisterStringVar("POD_NAMESPACE", "", "")
@@ -280,6 +346,12 @@ func NewServer(args PilotArgs) (*Server, error) {
 			args.Config.ClusterRegistriesNamespace = constants.IstioSystemNamespace
 		}
 	}
+	if args.Config.ControllerOptions.NetworkGatewayNamespace == "" {
+		args.Config.ControllerOptions.NetworkGatewayNamespace = features.NetworkGatewayNamespace
+	}
+	if args.Config.ControllerOptions.NetworkGatewayNamespace == "" {
+		args.Config.ControllerOptions.NetworkGatewayNamespace = args.Namespace
+	}
 
 	s := &Server{
 		fileWatcher: filewatcher.NewWatcher(),
@@ -299,16 +371,41 @@ func NewServer(args PilotArgs) (*Server, error) {
 	if err := s.initMeshNetworks(&args); err != nil {
 		return nil, fmt.Errorf("mesh networks: %v", err)
 	}
-	// Certificate controller is created before MCP
-	// controller in case MCP server pod waits to mount a certificate
-	// to be provisioned by the certificate controller.
-	if err := s.initCertController(&args); err != nil {
-		return nil, fmt.Errorf("certificate controller: %v", err)
+	if err := s.initTrustBundles(&args); err != nil {
+		return nil, fmt.Errorf("trust bundles: %v", err)
+	}
+	if err := s.initSecretGrants(&args); err != nil {
+		return nil, fmt.Errorf("secret grants: %v", err)
+	}
+	if err := s.initProtoDescriptors(&args); err != nil {
+		return nil, fmt.Errorf("proto descriptors: %v", err)
+	}
+	if err := s.initTracing(&args); err != nil {
+		return nil, fmt.Errorf("tracing: %v", err)
+	}
+	if args.DryRun.Enabled {
+		// A dry run does not write to the cluster.
+		args.Config.DisableInstallCRDs = true
+	} else {
+		// Certificate controller is created before MCP
+		// controller in case MCP server pod waits to mount a certificate
+		// to be provisioned by the certificate controller.
+		if err := s.initCertController(&args); err != nil {
+			return nil, fmt.Errorf("certificate controller: %v", err)
+		}
+		if err := s.initSelfSignedCertController(&args); err != nil {
+			return nil, fmt.Errorf("self-signed certificate controller: %v", err)
+		}
 	}
 	// 里面有 MCP 的内容 (调用了 initMCPConfigController ) ，好像和 initServiceControllers 没有直接关系？不过里面调用了 createInformer 方法！
 	if err := s.initConfigController(&args); err != nil {
 		return nil, fmt.Errorf("config controller: %v", err)
 	}
+	if !args.DryRun.Enabled {
+		if err := s.initNamespaceOnboarding(&args); err != nil {
+			return nil, fmt.Errorf("namespace onboarding: %v", err)
+		}
+	}
 	// 为什么这里也有 out.services = xxx 与 Informer 相关的方法
 	if err := s.initServiceControllers(&args); err != nil {
 		return nil, fmt.Errorf("service controllers: %v", err)
@@ -317,6 +414,9 @@ func NewServer(args PilotArgs) (*Server, error) {
 	if err := s.initDiscoveryService(&args); err != nil {
 		return nil, fmt.Errorf("discovery service: %v", err)
 	}
+	if err := s.initLocalityOutages(&args); err != nil {
+		return nil, fmt.Errorf("locality outages: %v", err)
+	}
 	// 初始化 pilot 监控服务
 	if err := s.initMonitor(&args); err != nil {
 		return nil, fmt.Errorf("monitor: %v", err)
@@ -346,6 +446,15 @@ func (s *Server) Start(stop <-chan struct{}) error {
 	return nil
 }
 
+// Drain closes the ADS connections of the proxies over PILOT_DRAIN_DURATION, if set, for them to reconnect
+// to the other instances progressively before the server is stopped.
+func (s *Server) Drain() {
+	if s.EnvoyXdsServer == nil || features.DrainDuration <= 0 {
+		return
+	}
+	s.EnvoyXdsServer.Drain(features.DrainDuration)
+}
+
 // startFunc defines a function that will be used to start one or more components of the Pilot discovery service.
 type startFunc func(stop <-chan struct{}) error
 
@@ -376,6 +485,7 @@ func (s *Server) initClusterRegistries(args *PilotArgs) (err error) {
 		mc, err := clusterregistry.NewMulticluster(s.kubeClient,
 			args.Config.ClusterRegistriesNamespace,
 			args.Config.ControllerOptions.WatchedNamespace,
+			args.Config.ControllerOptions.NetworkGatewayNamespace,
 			args.Config.ControllerOptions.DomainSuffix,
 			args.Config.ControllerOptions.ResyncPeriod,
 			s.ServiceController,
@@ -388,6 +498,7 @@ func (s *Server) initClusterRegistries(args *PilotArgs) (err error) {
 		}
 
 		s.multicluster = mc
+		mc.AppendNetworkHandler(s.updateMeshNetworks)
 	}
 	return nil
 }
@@ -437,6 +548,8 @@ func (s *Server) initMesh(args *PilotArgs) error {
 		meshConfig, err = cmd.ReadMeshConfig(args.Mesh.ConfigFile)
 		if err != nil {
 			log.Warnf("failed to read mesh configuration, using default: %v", err)
+		} else if s.meshExtensions, err = cmd.ReadMeshExtensions(args.Mesh.ConfigFile); err != nil {
+			log.Warnf("failed to read mesh configuration extensions, ignoring them: %v", err)
 		}
 
 		// Watch the config file for changes and reload if it got modified
@@ -447,6 +560,18 @@ func (s *Server) initMesh(args *PilotArgs) error {
 				log.Warnf("failed to read mesh configuration, using default: %v", err)
 				return
 			}
+			meshExtensions, err := cmd.ReadMeshExtensions(args.Mesh.ConfigFile)
+			if err != nil {
+				log.Warnf("failed to read mesh configuration extensions, keeping the previous ones: %v", err)
+				meshExtensions = s.meshExtensions
+			}
+			if !reflect.DeepEqual(meshExtensions, s.meshExtensions) {
+				log.Infof("mesh configuration extensions updated to: %s", spew.Sdump(meshExtensions))
+				s.meshExtensions = meshExtensions
+				if s.EnvoyXdsServer != nil {
+					s.EnvoyXdsServer.MeshExtensionsUpdate(meshExtensions)
+				}
+			}
 			if !reflect.DeepEqual(meshConfig, s.mesh) {
 				log.Infof("mesh configuration updated to: %s", spew.Sdump(meshConfig))
 				if !reflect.DeepEqual(meshConfig.ConfigSources, s.mesh.ConfigSources) {
@@ -455,8 +580,7 @@ func (s *Server) initMesh(args *PilotArgs) error {
 				}
 				s.mesh = meshConfig
 				if s.EnvoyXdsServer != nil {
-					s.EnvoyXdsServer.Env.Mesh = meshConfig
-					s.EnvoyXdsServer.ConfigUpdate(&model.PushRequest{Full: true})
+					s.EnvoyXdsServer.MeshConfigUpdate(meshConfig)
 				}
 			}
 		})
@@ -464,11 +588,17 @@ func (s *Server) initMesh(args *PilotArgs) error {
 
 	if meshConfig == nil {
 		// Config file either wasn't specified or failed to load - use a default mesh.
-		if _, meshConfig, err = GetMeshConfig(s.kubeClient, controller2.IstioNamespace, controller2.IstioConfigMap); err != nil {
+		var cfg *v1.ConfigMap
+		if cfg, meshConfig, err = GetMeshConfig(s.kubeClient, controller2.IstioNamespace, controller2.IstioConfigMap); err != nil {
 			log.Warnf("failed to read the default mesh configuration: %v, from the %s config map in the %s namespace",
 				err, controller2.IstioConfigMap, controller2.IstioNamespace)
 			return err
 		}
+		if cfg != nil {
+			if s.meshExtensions, err = mesh.ApplyMeshExtensions(cfg.Data[ConfigMapKey]); err != nil {
+				log.Warnf("failed to read mesh configuration extensions, ignoring them: %v", err)
+			}
+		}
 
 		// Allow some overrides for testing purposes.
 		if args.Mesh.MixerAddress != "" {
@@ -478,6 +608,9 @@ func (s *Server) initMesh(args *PilotArgs) error {
 	}
 
 	log.Infof("mesh configuration %s", spew.Sdump(meshConfig))
+	if s.meshExtensions != nil {
+		log.Infof("mesh configuration extensions %s", spew.Sdump(s.meshExtensions))
+	}
 	log.Infof("version %s", version.Info.String())
 	log.Infof("flags %s", spew.Sdump(args))
 
@@ -514,24 +647,169 @@ func (s *Server) initMeshNetworks(args *PilotArgs) error { //nolint: unparam
 			log.Warnf("failed to read mesh networks configuration from %q", args.NetworksConfigFile)
 			return
 		}
-		if !reflect.DeepEqual(meshNetworks, s.meshNetworks) {
+		s.meshNetworksMutex.Lock()
+		changed := !reflect.DeepEqual(meshNetworks, s.meshNetworks)
+		if changed {
 			log.Infof("mesh networks configuration file updated to: %s", spew.Sdump(meshNetworks))
 			util.ResolveHostsInNetworksConfig(meshNetworks)
 			log.Infof("mesh networks configuration post-resolution %s", spew.Sdump(meshNetworks))
 			s.meshNetworks = meshNetworks
+		}
+		s.meshNetworksMutex.Unlock()
+		if changed {
 			if s.kubeRegistry != nil {
 				s.kubeRegistry.InitNetworkLookup(meshNetworks)
 			}
 			if s.multicluster != nil {
 				s.multicluster.ReloadNetworkLookup(meshNetworks)
 			}
-			if s.EnvoyXdsServer != nil {
-				s.EnvoyXdsServer.Env.MeshNetworks = meshNetworks
-				s.EnvoyXdsServer.ConfigUpdate(&model.PushRequest{Full: true})
+			s.updateMeshNetworks()
+		}
+	})
+
+	return nil
+}
+
+// updateMeshNetworks sets the mesh networks of the discovery service to the configured networks with the gateways
+// discovered in the clusters, and pushes them. The networks and their gateways are updated without restarting.
+func (s *Server) updateMeshNetworks() {
+	if s.EnvoyXdsServer == nil {
+		return
+	}
+	gateways := make(model.NetworkGateways)
+	if s.kubeRegistry != nil {
+		gateways.Merge(s.kubeRegistry.NetworkGateways())
+	}
+	if s.multicluster != nil {
+		gateways.Merge(s.multicluster.NetworkGateways())
+	}
+
+	s.meshNetworksMutex.Lock()
+	meshNetworks := model.MergeMeshNetworks(s.meshNetworks, gateways)
+	if meshNetworks != s.meshNetworks {
+		util.ResolveHostsInNetworksConfig(meshNetworks)
+	}
+	changed := !reflect.DeepEqual(meshNetworks, s.EnvoyXdsServer.Env.MeshNetworks)
+	if changed {
+		log.Infof("mesh networks updated to: %s", spew.Sdump(meshNetworks))
+		s.EnvoyXdsServer.Env.MeshNetworks = meshNetworks
+	}
+	s.meshNetworksMutex.Unlock()
+
+	if changed {
+		s.EnvoyXdsServer.ConfigUpdate(&model.PushRequest{Full: true})
+	}
+}
+
+// initTrustBundles loads the trust bundles, whose roots are merged with the mesh root in the validation contexts of
+// the workloads. The file and the TrustBundle resources of the Istio namespace are watched, and the SPIFFE bundle
+// endpoints are refreshed periodically.
+func (s *Server) initTrustBundles(args *PilotArgs) error {
+	if args.TrustBundles.File == "" && !features.EnableTrustBundleResources {
+		return nil
+	}
+	s.trustBundle = trustbundle.NewManager(args.TrustBundles.MeshRootFile)
+	onChange := func() {
+		if s.EnvoyXdsServer != nil {
+			s.EnvoyXdsServer.ConfigUpdate(&model.PushRequest{Full: true})
+		}
+	}
+
+	if args.TrustBundles.File != "" {
+		bundles, err := trustbundle.LoadTrustBundles(args.TrustBundles.File)
+		if err != nil {
+			return err
+		}
+		log.Infof("Loaded %d trust bundles from %s", len(bundles), args.TrustBundles.File)
+		s.trustBundle.Update(trustbundle.FileSource, bundles)
+		s.addFileWatcher(args.TrustBundles.File, func() {
+			bundles, err := trustbundle.LoadTrustBundles(args.TrustBundles.File)
+			if err != nil {
+				log.Warnf("failed to read the trust bundles from %q: %v", args.TrustBundles.File, err)
+				return
 			}
+			if s.trustBundle.Update(trustbundle.FileSource, bundles) {
+				log.Infof("trust bundles updated from %s", args.TrustBundles.File)
+				onChange()
+			}
+		})
+	}
+
+	if features.EnableTrustBundleResources {
+		if s.kubeClient == nil {
+			return fmt.Errorf("the TrustBundle resources require a Kubernetes client")
+		}
+		restConfig, err := kubelib.BuildClientConfig(s.getKubeCfgFile(args), "")
+		if err != nil {
+			return err
+		}
+		dynamicClient, err := dynamic.NewForConfig(restConfig)
+		if err != nil {
+			return err
+		}
+		s.addStartFunc(func(stop <-chan struct{}) error {
+			go s.trustBundle.Watch(dynamicClient, args.Namespace, args.Config.ControllerOptions.ResyncPeriod, onChange, stop)
+			return nil
+		})
+	}
+
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go s.trustBundle.Run(args.TrustBundles.RefreshInterval, onChange, stop)
+		return nil
+	})
+	return nil
+}
+
+// initSecretGrants watches the secrets granting the gateways of other namespaces the access.
+func (s *Server) initSecretGrants(args *PilotArgs) error {
+	if !features.EnableCrossNamespaceGatewaySecrets {
+		return nil
+	}
+	if s.kubeClient == nil {
+		return fmt.Errorf("the secrets of other namespaces require a Kubernetes client")
+	}
+	s.secretGrants = secretgrant.NewController(s.kubeClient, args.Config.ControllerOptions.ResyncPeriod, func() {
+		if s.EnvoyXdsServer != nil {
+			s.EnvoyXdsServer.ConfigUpdate(&model.PushRequest{Full: true})
 		}
 	})
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go s.secretGrants.Run(stop)
+		return nil
+	})
+	return nil
+}
 
+// initProtoDescriptors watches the ConfigMaps and Secrets of the proto descriptor sets of the gRPC JSON transcoders.
+func (s *Server) initProtoDescriptors(args *PilotArgs) error {
+	if s.kubeClient == nil {
+		return nil
+	}
+	s.protoDescriptors = protodescriptor.NewController(s.kubeClient, args.Config.ControllerOptions.ResyncPeriod, func() {
+		if s.EnvoyXdsServer != nil {
+			s.EnvoyXdsServer.ConfigUpdate(&model.PushRequest{Full: true})
+		}
+	})
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go s.protoDescriptors.Run(stop)
+		return nil
+	})
+	return nil
+}
+
+// initLocalityOutages shares the simulated locality outages across the Pilot replicas through a config map of the
+// Pilot namespace. Without a Kubernetes client, the outages are only set on the replica serving the request.
+func (s *Server) initLocalityOutages(args *PilotArgs) error {
+	if s.kubeClient == nil || args.DryRun.Enabled {
+		return nil
+	}
+	store := envoyv2.NewConfigMapLocalityOutageStore(s.kubeClient, args.Namespace,
+		args.Config.ControllerOptions.ResyncPeriod, s.EnvoyXdsServer.SetLocalityOutages)
+	s.EnvoyXdsServer.SetLocalityOutageStore(store)
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go store.Run(stop)
+		return nil
+	})
 	return nil
 }
 
@@ -585,7 +863,7 @@ func (s *Server) initMCPConfigController(args *PilotArgs) error {
 					cancel()
 					return fmt.Errorf("invalid fs config URL %s, contains no file path", configSource.Address)
 				}
-				store := memory.MakeWithLedger(schemas.Istio, args.Config.buildLedger())
+				store := memory.MakeWithLedger(configDescriptor(), args.Config.buildLedger())
 				configController := memory.NewController(store)
 
 				err := s.makeFileMonitor(srcAddress.Path, configController)
@@ -768,7 +1046,7 @@ func (s *Server) mcpController(args *PilotArgs,
 	configStores *[]model.ConfigStoreCache) {
 	clientNodeID := ""
 	var collections []sink.CollectionOptions
-	for _, c := range schemas.Istio {
+	for _, c := range configDescriptor() {
 		// do not register SSEs for this controller as there is a dedicated controller
 		if c.Collection == schemas.SyntheticServiceEntry.Collection {
 			continue
@@ -836,7 +1114,7 @@ func (s *Server) initConfigController(args *PilotArgs) error {
 	} else if args.Config.Controller != nil {
 		s.configController = args.Config.Controller
 	} else if args.Config.FileDir != "" {
-		store := memory.Make(schemas.Istio)
+		store := memory.Make(configDescriptor())
 		// configController 本质上是一个 model.ConfigStoreCache 的 implement
 		configController := memory.NewController(store)
 
@@ -853,6 +1131,7 @@ func (s *Server) initConfigController(args *PilotArgs) error {
 		}
 
 		s.configController = cfgController
+		s.kubeConfigStore = cfgController
 	}
 
 	// Defer starting the controller until after the service is created.
@@ -875,7 +1154,9 @@ func (s *Server) initConfigController(args *PilotArgs) error {
 		// Update the config controller
 		s.configController = configController
 
-		if ingressSyncer, errSyncer := ingress.NewStatusSyncer(s.mesh, s.kubeClient,
+		if args.DryRun.Enabled {
+			log.Info("Disabled ingress status syncer in dry run mode")
+		} else if ingressSyncer, errSyncer := ingress.NewStatusSyncer(s.mesh, s.kubeClient,
 			args.Namespace, args.Config.ControllerOptions); errSyncer != nil {
 			log.Warnf("Disabled ingress status syncer due to %v", errSyncer)
 		} else {
@@ -886,15 +1167,84 @@ func (s *Server) initConfigController(args *PilotArgs) error {
 		}
 	}
 
+	// Wrap the config controller with the conversion of the Gateway API and SMI resources.
+	if hasKubeRegistry(args) && (features.EnableGatewayAPI || features.EnableSMITrafficSplit) {
+		restConfig, err := kubelib.BuildClientConfig(s.getKubeCfgFile(args), "")
+		if err != nil {
+			return err
+		}
+		dynamicClient, err := dynamic.NewForConfig(restConfig)
+		if err != nil {
+			return err
+		}
+		caches := []model.ConfigStoreCache{s.configController}
+		if features.EnableGatewayAPI {
+			caches = append(caches, gateway.NewController(dynamicClient, args.Config.ControllerOptions))
+		}
+		if features.EnableSMITrafficSplit {
+			caches = append(caches, smi.NewController(dynamicClient, args.Config.ControllerOptions))
+		}
+		// The version of the config distribution status is the one of the Istio configs.
+		configController, err := configaggregate.MakeCacheWithVersion(s.configController, caches)
+		if err != nil {
+			return err
+		}
+		s.configController = configController
+	}
+
+	// The config kinds disabled with PILOT_DISABLED_CONFIG_KINDS have no configs.
+	if len(disabledConfigKinds()) > 0 {
+		log.Infof("watching config kinds %v", s.configController.ConfigDescriptor().Types())
+		s.configController = &disabledKindsCache{s.configController}
+	}
+
 	// Create the config store.
 	s.istioConfigStore = model.MakeIstioStore(s.configController)
 
 	return nil
 }
 
+// initNamespaceOnboarding stamps the default configs of the namespaces labeled for the mesh.
+func (s *Server) initNamespaceOnboarding(args *PilotArgs) error {
+	if !features.EnableNamespaceOnboarding {
+		return nil
+	}
+	if s.kubeConfigStore == nil || s.kubeClient == nil {
+		log.Warn("Disabled namespace onboarding, the configs are not read from Kubernetes")
+		return nil
+	}
+	selector, err := klabels.Parse(features.OnboardingNamespaceSelector)
+	if err != nil {
+		return fmt.Errorf("invalid namespace selector: %v", err)
+	}
+	template := ""
+	if features.OnboardingTemplate != "" {
+		by, err := ioutil.ReadFile(features.OnboardingTemplate)
+		if err != nil {
+			return err
+		}
+		template = string(by)
+	}
+	onboardingController, err := onboarding.NewController(s.kubeClient, s.kubeConfigStore, args.Namespace, onboarding.Options{
+		Selector:         selector,
+		SharedNamespaces: splitNonEmpty(features.OnboardingSharedNamespaces),
+		DefaultDeny:      features.OnboardingDefaultDeny,
+		Template:         template,
+		ResyncPeriod:     args.Config.ControllerOptions.ResyncPeriod,
+	})
+	if err != nil {
+		return err
+	}
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go onboardingController.Run(stop)
+		return nil
+	})
+	return nil
+}
+
 func (s *Server) makeKubeConfigController(args *PilotArgs) (model.ConfigStoreCache, error) {
 	kubeCfgFile := s.getKubeCfgFile(args)
-	configClient, err := controller.NewClient(kubeCfgFile, "", schemas.Istio,
+	configClient, err := controller.NewClient(kubeCfgFile, "", configDescriptor(),
 		args.Config.ControllerOptions.DomainSuffix, args.Config.buildLedger())
 	if err != nil {
 		return nil, multierror.Prefix(err, "failed to open a config client.")
@@ -910,7 +1260,7 @@ func (s *Server) makeKubeConfigController(args *PilotArgs) (model.ConfigStoreCac
 }
 
 func (s *Server) makeFileMonitor(fileDir string, configController model.ConfigStore) error {
-	fileSnapshot := configmonitor.NewFileSnapshot(fileDir, schemas.Istio)
+	fileSnapshot := configmonitor.NewFileSnapshot(fileDir, configDescriptor())
 	fileMonitor := configmonitor.NewMonitor("file-monitor", configController, FilepathWalkInterval, fileSnapshot.ReadConfigFiles)
 
 	// Defer starting the file monitor until after the service is created.
@@ -977,6 +1327,14 @@ func (s *Server) initServiceControllers(args *PilotArgs) error {
 			if err := s.initConsulRegistry(serviceControllers, args); err != nil {
 				return err
 			}
+		case serviceregistry.CloudRegistry:
+			if err := s.initCloudRegistry(args); err != nil {
+				return err
+			}
+		case serviceregistry.StaticRegistry:
+			if err := s.initStaticRegistry(serviceControllers, args); err != nil {
+				return err
+			}
 		case serviceregistry.MCPRegistry:
 			if s.mcpDiscovery != nil {
 				serviceControllers.AddRegistry(
@@ -991,13 +1349,13 @@ func (s *Server) initServiceControllers(args *PilotArgs) error {
 		}
 	}
 
-	serviceEntryStore := external.NewServiceDiscovery(s.configController, s.istioConfigStore)
+	s.serviceEntryStore = external.NewServiceDiscovery(s.configController, s.istioConfigStore)
 
 	// add service entry registry to aggregator by default
 	serviceEntryRegistry := aggregate.Registry{
 		Name:             "ServiceEntries",
-		Controller:       serviceEntryStore,
-		ServiceDiscovery: serviceEntryStore,
+		Controller:       s.serviceEntryStore,
+		ServiceDiscovery: s.serviceEntryStore,
 	}
 	serviceControllers.AddRegistry(serviceEntryRegistry)
 
@@ -1042,11 +1400,31 @@ func (s *Server) initMemoryRegistry(serviceControllers *aggregate.Controller) {
 func (s *Server) initDiscoveryService(args *PilotArgs) error {
 	environment := &model.Environment{
 		Mesh:             s.mesh,
+		MeshExtensions:   s.meshExtensions,
 		MeshNetworks:     s.meshNetworks,
 		IstioConfigStore: s.istioConfigStore,
 		ServiceDiscovery: s.ServiceController,
 		PushContext:      model.NewPushContext(),
 	}
+	if s.trustBundle != nil {
+		environment.TrustBundle = s.trustBundle
+	}
+	if features.EnableWeightRamp {
+		environment.WeightRamps = model.NewWeightRamps()
+		if features.WeightRampPrometheusAddress != "" {
+			errorRate, err := prometheusErrorRate(features.WeightRampPrometheusAddress)
+			if err != nil {
+				return err
+			}
+			environment.WeightRamps.ErrorRate = errorRate
+		}
+	}
+	if s.secretGrants != nil {
+		environment.SecretGrants = s.secretGrants
+	}
+	if s.protoDescriptors != nil {
+		environment.ProtoDescriptors = s.protoDescriptors
+	}
 
 	// Set up discovery service，这个函数是最重要的, discovery 即创建的发现服务
 	discovery, err := envoy.NewDiscoveryService(
@@ -1062,6 +1440,7 @@ func (s *Server) initDiscoveryService(args *PilotArgs) error {
 		istio_networking.NewConfigGenerator(args.Plugins),
 		s.ServiceController, s.kubeRegistry, s.configController)
 	s.EnvoyXdsServer.InitDebug(s.mux, s.ServiceController)
+	s.serviceEntryStore.XDSUpdater = s.EnvoyXdsServer
 
 	if s.kubeRegistry != nil {
 		// kubeRegistry may use the environment for push status reporting.
@@ -1069,6 +1448,7 @@ func (s *Server) initDiscoveryService(args *PilotArgs) error {
 		s.kubeRegistry.Env = environment
 		s.kubeRegistry.InitNetworkLookup(s.meshNetworks)
 		s.kubeRegistry.XDSUpdater = s.EnvoyXdsServer
+		s.kubeRegistry.AppendNetworkHandler(s.updateMeshNetworks)
 	}
 
 	if s.mcpOptions != nil {
@@ -1090,6 +1470,10 @@ func (s *Server) initDiscoveryService(args *PilotArgs) error {
 		return nil
 	})
 
+	if args.DryRun.Enabled {
+		return s.initDryRun(args, environment)
+	}
+
 	// create grpc/http server
 	s.initGrpcServer(args.KeepaliveOptions)
 	s.httpServer = &http.Server{
@@ -1111,6 +1495,23 @@ func (s *Server) initDiscoveryService(args *PilotArgs) error {
 	}
 	s.GRPCListeningAddr = grpcListener.Addr()
 
+	// create grpc unix domain socket listener, served with mTLS by the secure grpc server unless plain text is
+	// explicitly allowed.
+	var grpcUDSListener net.Listener
+	if args.DiscoveryOptions.GrpcUDSPath != "" {
+		if !args.DiscoveryOptions.GrpcUDSPlaintext && args.DiscoveryOptions.SecureGrpcAddr == "" {
+			return fmt.Errorf("the grpc unix domain socket %s requires the secure grpc server, or plain text to be "+
+				"allowed", args.DiscoveryOptions.GrpcUDSPath)
+		}
+		// Remove the socket left by a previous instance.
+		if err := os.Remove(args.DiscoveryOptions.GrpcUDSPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if grpcUDSListener, err = net.Listen("unix", args.DiscoveryOptions.GrpcUDSPath); err != nil {
+			return err
+		}
+	}
+
 	s.addStartFunc(func(stop <-chan struct{}) error {
 		go func() {
 			if !s.waitForCacheSync(stop) {
@@ -1129,6 +1530,14 @@ func (s *Server) initDiscoveryService(args *PilotArgs) error {
 				log.Warna(err)
 			}
 		}()
+		if grpcUDSListener != nil && args.DiscoveryOptions.GrpcUDSPlaintext {
+			log.Infof("starting discovery service at plain text grpc uds=%s", grpcUDSListener.Addr())
+			go func() {
+				if err := s.grpcServer.Serve(grpcUDSListener); err != nil {
+					log.Warna(err)
+				}
+			}()
+		}
 
 		go func() {
 			<-stop
@@ -1181,6 +1590,14 @@ func (s *Server) initDiscoveryService(args *PilotArgs) error {
 						panic(fmt.Sprintf("%s due to error: %v", msg, err))
 					}
 				}()
+				if grpcUDSListener != nil && !args.DiscoveryOptions.GrpcUDSPlaintext {
+					log.Infof("starting discovery service at secure grpc uds=%s", grpcUDSListener.Addr())
+					go func() {
+						if err := s.secureHTTPServer.ServeTLS(grpcUDSListener, "", ""); err != nil {
+							log.Warna(err)
+						}
+					}()
+				}
 				go func() {
 					<-stop
 					if args.ForceStop {
@@ -1198,6 +1615,37 @@ func (s *Server) initDiscoveryService(args *PilotArgs) error {
 		})
 	}
 
+	// run the https server of the self-signed DNS certificate
+	if s.selfSignedCerts != nil && args.DiscoveryOptions.HTTPSAddr != "" {
+		s.initSelfSignedHTTPSServer()
+		httpsListener, err := net.Listen("tcp", args.DiscoveryOptions.HTTPSAddr)
+		if err != nil {
+			return err
+		}
+		s.HTTPSListeningAddr = httpsListener.Addr()
+
+		s.addStartFunc(func(stop <-chan struct{}) error {
+			go func() {
+				log.Infof("starting self-signed https server at %s", httpsListener.Addr())
+				err := s.selfSignedHTTPSServer.ServeTLS(httpsListener, "", "")
+				msg := fmt.Sprintf("Stoppped listening on %s", httpsListener.Addr().String())
+				select {
+				case <-stop:
+					log.Info(msg)
+				default:
+					panic(fmt.Sprintf("%s due to error: %v", msg, err))
+				}
+			}()
+			go func() {
+				<-stop
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				_ = s.selfSignedHTTPSServer.Shutdown(ctx)
+			}()
+			return nil
+		})
+	}
+
 	return nil
 }
 
@@ -1218,6 +1666,56 @@ func (s *Server) initConsulRegistry(serviceControllers *aggregate.Controller, ar
 	return nil
 }
 
+// initCloudRegistry syncs the instances of the cloud instance groups to ServiceEntries of the config store.
+func (s *Server) initCloudRegistry(args *PilotArgs) error {
+	if s.configController == nil {
+		return fmt.Errorf("the cloud registry requires a config store")
+	}
+	groups, err := cloud.LoadInstanceGroups(args.Service.Cloud.InstanceGroupsFile)
+	if err != nil {
+		return fmt.Errorf("failed to load the cloud instance groups: %v", err)
+	}
+	log.Infof("Syncing %d cloud instance groups from %s", len(groups), args.Service.Cloud.InstanceGroupsFile)
+	controller := cloud.NewController(s.configController, groups, args.Service.Cloud.Interval)
+	if s.kubeClient == nil {
+		// Without Kubernetes, the config store is local to each Pilot, which syncs its own ServiceEntries.
+		s.addStartFunc(func(stop <-chan struct{}) error {
+			go controller.Run(stop)
+			return nil
+		})
+		return nil
+	}
+	// Sync the ServiceEntries on the leader only, to avoid conflicting writes of the replicas.
+	elector := leaderelection.NewLeaderElection(args.Namespace, cloudRegistryElectionID, s.kubeClient).
+		AddRunFunction(controller.Run)
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go elector.Run(stop)
+		return nil
+	})
+	return nil
+}
+
+// initStaticRegistry adds the registry of the services of the static workload catalog, for running Pilot without
+// Kubernetes, e.g. with the file config source for a Docker Compose development mesh.
+func (s *Server) initStaticRegistry(serviceControllers *aggregate.Controller, args *PilotArgs) error {
+	registry, controller, err := static.NewRegistry(args.Service.Static.CatalogFile, args.Config.ControllerOptions.DomainSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to load the workload catalog: %v", err)
+	}
+	log.Infof("Static workload catalog: %s", args.Service.Static.CatalogFile)
+	serviceControllers.AddRegistry(
+		aggregate.Registry{
+			Name:             serviceregistry.StaticRegistry,
+			ServiceDiscovery: registry,
+			Controller:       registry,
+		})
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go controller.Run(stop)
+		return nil
+	})
+	return nil
+}
+
 func (s *Server) initGrpcServer(options *istiokeepalive.Options) {
 	grpcOptions := s.grpcServerOptions(options)
 	s.grpcServer = grpc.NewServer(grpcOptions...)
@@ -1236,41 +1734,33 @@ func (s *Server) initSecureGrpcServer(options *istiokeepalive.Options) error {
 	key := path.Join(certDir, constants.KeyFilename)
 	cert := path.Join(certDir, constants.CertChainFilename)
 
-	tlsCreds, err := credentials.NewServerTLSFromFile(cert, key)
-	// certs not ready yet.
-	if err != nil {
-		return err
-	}
-
-	// TODO: parse the file to determine expiration date. Restart listener before expiration
-	certificate, err := tls.LoadX509KeyPair(cert, key)
-	if err != nil {
-		return err
+	tlsConfig := &tls.Config{
+		VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			// For now accept any certs - pilot is not authenticating the caller, TLS used for
+			// privacy
+			return nil
+		},
+		NextProtos: []string{"h2", "http/1.1"},
+		ClientAuth: tls.RequireAndVerifyClientCert,
 	}
-
-	caCert, err := ioutil.ReadFile(ca)
+	// The certificates rotated on disk are reloaded by the new handshakes, without closing the
+	// established connections.
+	certs, err := newReloadingCerts(cert, key, ca)
+	// certs not ready yet.
 	if err != nil {
 		return err
 	}
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(caCert)
+	getCertificate := certs.GetCertificate
+	tlsConfig.GetConfigForClient = certs.GetConfigForClient(tlsConfig)
+	tlsConfig.GetCertificate = getCertificate
+	tlsCreds := credentials.NewTLS(&tls.Config{GetCertificate: getCertificate})
 
 	opts := s.grpcServerOptions(options)
 	opts = append(opts, grpc.Creds(tlsCreds))
 	s.secureGRPCServer = grpc.NewServer(opts...)
 	s.EnvoyXdsServer.Register(s.secureGRPCServer)
 	s.secureHTTPServer = &http.Server{
-		TLSConfig: &tls.Config{
-			Certificates: []tls.Certificate{certificate},
-			VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
-				// For now accept any certs - pilot is not authenticating the caller, TLS used for
-				// privacy
-				return nil
-			},
-			NextProtos: []string{"h2", "http/1.1"},
-			ClientAuth: tls.RequireAndVerifyClientCert,
-			ClientCAs:  caCertPool,
-		},
+		TLSConfig: tlsConfig,
 		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if r.ProtoMajor == 2 && strings.HasPrefix(
 				r.Header.Get("Content-Type"), "application/grpc") {
@@ -1284,6 +1774,26 @@ func (s *Server) initSecureGrpcServer(options *istiokeepalive.Options) error {
 	return nil
 }
 
+// initSelfSignedHTTPSServer creates the HTTPS server presenting the self-signed certificate of the DNS names of
+// Pilot, for the clients verifying these names rather than the SPIFFE identity, such as the API server calling
+// the webhooks.
+func (s *Server) initSelfSignedHTTPSServer() {
+	s.selfSignedHTTPSServer = &http.Server{
+		TLSConfig: &tls.Config{
+			GetCertificate: s.selfSignedCerts.GetCertificate,
+			NextProtos:     []string{"h2", "http/1.1"},
+		},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ProtoMajor == 2 && strings.HasPrefix(
+				r.Header.Get("Content-Type"), "application/grpc") {
+				s.grpcServer.ServeHTTP(w, r)
+			} else {
+				s.mux.ServeHTTP(w, r)
+			}
+		}),
+	}
+}
+
 func (s *Server) grpcServerOptions(options *istiokeepalive.Options) []grpc.ServerOption {
 	interceptors := []grpc.UnaryServerInterceptor{
 		// setup server prometheus monitoring (as final interceptor in chain)
@@ -1346,6 +1856,9 @@ func (s *Server) waitForCacheSync(stop <-chan struct{}) bool {
 		if !s.configController.HasSynced() {
 			return false
 		}
+		if s.secretGrants != nil && !s.secretGrants.HasSynced() {
+			return false
+		}
 		return true
 	}) {
 		log.Errorf("Failed waiting for cache sync")
@@ -1428,14 +1941,86 @@ func (s *Server) initCertController(args *PilotArgs) error {
 	if err != nil {
 		return fmt.Errorf("failed to create certificate controller: %v", err)
 	}
+	// Run Chiron to manage the lifecycles of certificates, on the leader only to avoid duplicate writes.
+	elector := leaderelection.NewLeaderElection(args.Namespace, certControllerElectionID, k8sClient).
+		AddRunFunction(s.certController.Run)
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go elector.Run(stop)
+		return nil
+	})
+
+	return nil
+}
+
+// initTracing configures the tracer of the push pipeline, when a trace collector is set.
+func (s *Server) initTracing(args *PilotArgs) error {
+	if args.TracingOptions == nil || !args.TracingOptions.TracingEnabled() {
+		return nil
+	}
+	closer, err := tracing.Configure("pilot-discovery", args.TracingOptions)
+	if err != nil {
+		return err
+	}
 	s.addStartFunc(func(stop <-chan struct{}) error {
 		go func() {
-			// Run Chiron to manage the lifecycles of certificates
-			s.certController.Run(stop)
+			<-stop
+			// Flush the buffered spans.
+			if err := closer.Close(); err != nil {
+				log.Warnf("failed to close the tracer: %v", err)
+			}
 		}()
-
 		return nil
 	})
+	return nil
+}
 
+// initSelfSignedCertController provisions and rotates the certificate of the DNS names of Pilot, signed by
+// a self-signed root CA, when PILOT_SELF_SIGNED_DNS_NAMES is set.
+func (s *Server) initSelfSignedCertController(args *PilotArgs) error {
+	if features.SelfSignedDNSNames == "" {
+		return nil
+	}
+	if s.kubeClient == nil {
+		return fmt.Errorf("self-signed certificates require a Kubernetes client")
+	}
+	userHomeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("could not find local user folder: %v", err)
+	}
+
+	s.selfSignedCerts, err = chiron.NewSelfSignedController(chiron.SelfSignedOptions{
+		Namespace:          args.Namespace,
+		SecretName:         selfSignedCASecretName,
+		DNSNames:           splitNonEmpty(features.SelfSignedDNSNames),
+		CertDir:            userHomeDir + DefaultDirectoryForSelfSignedKeyCert,
+		RootTTL:            features.SelfSignedRootTTL,
+		CertTTL:            features.SelfSignedCertTTL,
+		GracePeriodRatio:   DefaultCertGracePeriodRatio,
+		MinGracePeriod:     DefaultMinCertGracePeriod,
+		MutatingWebhooks:   splitNonEmpty(features.SelfSignedMutatingWebhooks),
+		ValidatingWebhooks: splitNonEmpty(features.SelfSignedValidatingWebhooks),
+	}, s.kubeClient.CoreV1(), s.kubeClient.AdmissionregistrationV1beta1())
+	if err != nil {
+		return err
+	}
+	// The certificate is provisioned before the secure servers are created.
+	if err := s.selfSignedCerts.Reconcile(); err != nil {
+		log.Errorf("failed to reconcile self-signed certificates: %v", err)
+	}
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go s.selfSignedCerts.Run(stop)
+		return nil
+	})
 	return nil
 }
+
+// splitNonEmpty splits a comma separated list, ignoring empty entries.
+func splitNonEmpty(list string) []string {
+	var out []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
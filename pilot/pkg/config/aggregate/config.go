@@ -83,6 +83,20 @@ func MakeCache(caches []model.ConfigStoreCache) (model.ConfigStoreCache, error)
 	}, nil
 }
 
+// MakeCacheWithVersion creates an aggregate config store cache like MakeCache, with the version and the
+// resources at version of the versioned cache, one of the caches. The other caches must derive their configs
+// from resources the config distribution status does not track, e.g. the Gateway API resources.
+func MakeCacheWithVersion(versioned model.ConfigStoreCache, caches []model.ConfigStoreCache) (model.ConfigStoreCache, error) {
+	cache, err := MakeCache(caches)
+	if err != nil {
+		return nil, err
+	}
+	s := cache.(*storeCache).ConfigStore.(*store)
+	s.getVersion = versioned.Version
+	s.getResourceAtVersion = versioned.GetResourceAtVersion
+	return cache, nil
+}
+
 type store struct {
 	// descriptor is the unified
 	descriptor schema.Set
@@ -249,3 +249,33 @@ func TestAggregateStoreCache(t *testing.T) {
 		g.Expect(h).ToNot(gomega.BeNil())
 	})
 }
+
+func TestAggregateStoreCacheWithVersion(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	versioned := &fakes.ConfigStoreCache{}
+	derived := &fakes.ConfigStoreCache{}
+
+	versioned.ConfigDescriptorReturns([]schema.Instance{{
+		Type:        "some-config",
+		Plural:      "some-configs",
+		MessageName: "istio.networking.v1alpha3.DestinationRule",
+	}})
+	versioned.VersionReturns("42")
+	versioned.GetResourceAtVersionReturns("7", nil)
+
+	derived.ConfigDescriptorReturns([]schema.Instance{{
+		Type:        "other-config",
+		Plural:      "other-configs",
+		MessageName: "istio.networking.v1alpha3.Gateway",
+	}})
+
+	cacheStore, err := aggregate.MakeCacheWithVersion(versioned, []model.ConfigStoreCache{versioned, derived})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	g.Expect(cacheStore.Version()).To(gomega.Equal("42"))
+	resourceVersion, err := cacheStore.GetResourceAtVersion("42", "some-config/default/name")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(resourceVersion).To(gomega.Equal("7"))
+	g.Expect(derived.VersionCallCount()).To(gomega.Equal(0))
+}
@@ -15,6 +15,7 @@
 package clusterregistry
 
 import (
+	"sort"
 	"sync"
 	"time"
 
@@ -43,15 +44,19 @@ type Multicluster struct {
 	serviceController *aggregate.Controller
 	XDSUpdater        model.XDSUpdater
 
+	// NetworkGatewayNamespace is the namespace of the network gateway services of the remote clusters.
+	NetworkGatewayNamespace string
+
 	m                     sync.Mutex // protects remoteKubeControllers
 	remoteKubeControllers map[string]*kubeController
 	meshNetworks          *meshconfig.MeshNetworks
+	networkHandlers       []func()
 }
 
 // NewMulticluster initializes data structure to store multicluster information
 // It also starts the secret controller
 func NewMulticluster(kc kubernetes.Interface, secretNamespace string,
-	watchedNamespace string, domainSuffix string, resyncPeriod time.Duration,
+	watchedNamespace string, networkGatewayNamespace string, domainSuffix string, resyncPeriod time.Duration,
 	serviceController *aggregate.Controller, xds model.XDSUpdater, meshNetworks *meshconfig.MeshNetworks) (*Multicluster, error) {
 
 	remoteKubeController := make(map[string]*kubeController)
@@ -68,6 +73,8 @@ func NewMulticluster(kc kubernetes.Interface, secretNamespace string,
 		XDSUpdater:            xds,
 		remoteKubeControllers: remoteKubeController,
 		meshNetworks:          meshNetworks,
+
+		NetworkGatewayNamespace: networkGatewayNamespace,
 	}
 
 	err := secretcontroller.StartSecretController(kc,
@@ -92,6 +99,8 @@ func (m *Multicluster) AddMemberCluster(clientset kubernetes.Interface, clusterI
 		DomainSuffix:     m.DomainSuffix,
 		XDSUpdater:       m.XDSUpdater,
 		ClusterID:        clusterID,
+
+		NetworkGatewayNamespace: m.NetworkGatewayNamespace,
 	})
 	kubectl.InitNetworkLookup(m.meshNetworks)
 
@@ -107,6 +116,7 @@ func (m *Multicluster) AddMemberCluster(clientset kubernetes.Interface, clusterI
 	m.remoteKubeControllers[clusterID] = &remoteKubeController
 	m.m.Unlock()
 
+	kubectl.AppendNetworkHandler(m.networksUpdated)
 	_ = kubectl.AppendServiceHandler(func(*model.Service, model.Event) { m.updateHandler() })
 	_ = kubectl.AppendInstanceHandler(func(*model.ServiceInstance, model.Event) { m.updateHandler() })
 	go kubectl.Run(stopCh)
@@ -117,6 +127,8 @@ func (m *Multicluster) AddMemberCluster(clientset kubernetes.Interface, clusterI
 // when a remote cluster is deleted.  Also must clear the cache so remote resources
 // are removed.
 func (m *Multicluster) DeleteMemberCluster(clusterID string) error {
+	// The network gateways of the cluster are removed once unlocked.
+	defer m.networksUpdated()
 
 	m.m.Lock()
 	defer m.m.Unlock()
@@ -147,6 +159,41 @@ func (m *Multicluster) ReloadNetworkLookup(meshNetworks *meshconfig.MeshNetworks
 	}
 }
 
+// NetworkGateways returns the gateways of the networks discovered in the remote clusters.
+func (m *Multicluster) NetworkGateways() model.NetworkGateways {
+	m.m.Lock()
+	defer m.m.Unlock()
+	clusterIDs := make([]string, 0, len(m.remoteKubeControllers))
+	for clusterID := range m.remoteKubeControllers {
+		clusterIDs = append(clusterIDs, clusterID)
+	}
+	sort.Strings(clusterIDs)
+
+	out := make(model.NetworkGateways)
+	for _, clusterID := range clusterIDs {
+		if controller := m.remoteKubeControllers[clusterID]; controller != nil && controller.rc != nil {
+			out.Merge(controller.rc.NetworkGateways())
+		}
+	}
+	return out
+}
+
+// AppendNetworkHandler adds a handler called when the network gateways discovered in the remote clusters change.
+func (m *Multicluster) AppendNetworkHandler(f func()) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	m.networkHandlers = append(m.networkHandlers, f)
+}
+
+func (m *Multicluster) networksUpdated() {
+	m.m.Lock()
+	handlers := m.networkHandlers
+	m.m.Unlock()
+	for _, f := range handlers {
+		f()
+	}
+}
+
 func (m *Multicluster) updateHandler() {
 	if m.XDSUpdater != nil {
 		req := &model.PushRequest{
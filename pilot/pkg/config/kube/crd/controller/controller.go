@@ -207,7 +207,7 @@ func (c *controller) createInformer(
 				}
 				if !reflect.DeepEqual(old, cur) {
 					incrementEvent(otype, "update")
-					c.queue.Push(kube.NewTask(handler.Apply, cur, model.EventUpdate))
+					c.queue.Push(kube.NewUpdateTask(handler.Apply, old, cur))
 				} else {
 					incrementEvent(otype, "updatesame")
 				}
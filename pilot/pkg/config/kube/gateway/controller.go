@@ -0,0 +1,245 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gateway provides a read-only view of the Kubernetes Gateway API resources (networking.x-k8s.io)
+// as Istio gateways and virtual services.
+package gateway
+
+import (
+	"errors"
+	"reflect"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry/kube"
+	kubecontroller "istio.io/istio/pilot/pkg/serviceregistry/kube/controller"
+	"istio.io/istio/pkg/config/schema"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+// The gateways of the GatewayClasses whose controller is ControllerName are converted to Istio gateways, named
+// by appending "-istio-autogenerated-k8s-gateway" to their name, in their namespace. They select the default
+// ingress gateway deployment (istio=ingressgateway).
+//
+// The HTTPRoutes and TLSRoutes bound to the listeners of these gateways are converted to virtual services of
+// the gateways, in the namespace of the routes.
+//
+// The Gateway API CRDs must be installed before enabling the controller, with PILOT_ENABLE_GATEWAY_API.
+
+type controller struct {
+	domainSuffix string
+
+	queue     kube.Queue
+	informers map[string]cache.SharedIndexInformer
+	handler   *kube.ChainHandler
+}
+
+var (
+	errUnsupportedOp = errors.New("unsupported operation: the gateway config store is a read-only view")
+)
+
+// NewController creates a controller of the Gateway API resources of the watched namespace.
+func NewController(client dynamic.Interface, options kubecontroller.Options) model.ConfigStoreCache {
+	handler := &kube.ChainHandler{}
+
+	// queue requires a time duration for a retry delay after a handler error
+	queue := kube.NewQueue(1 * time.Second)
+
+	log.Infof("Gateway API controller watching namespaces %q", options.WatchedNamespace)
+	// Gateway classes are cluster scoped.
+	clusterFactory := dynamicinformer.NewDynamicSharedInformerFactory(client, options.ResyncPeriod)
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, options.ResyncPeriod, options.WatchedNamespace, nil)
+	informers := map[string]cache.SharedIndexInformer{
+		GatewayClassResource.Resource: clusterFactory.ForResource(GatewayClassResource).Informer(),
+		GatewayResource.Resource:      factory.ForResource(GatewayResource).Informer(),
+		HTTPRouteResource.Resource:    factory.ForResource(HTTPRouteResource).Informer(),
+		TLSRouteResource.Resource:     factory.ForResource(TLSRouteResource).Informer(),
+	}
+	for _, informer := range informers {
+		informer.AddEventHandler(
+			cache.ResourceEventHandlerFuncs{
+				AddFunc: func(obj interface{}) {
+					queue.Push(kube.NewTask(handler.Apply, obj, model.EventAdd))
+				},
+				UpdateFunc: func(old, cur interface{}) {
+					if !reflect.DeepEqual(old, cur) {
+						queue.Push(kube.NewUpdateTask(handler.Apply, old, cur))
+					}
+				},
+				DeleteFunc: func(obj interface{}) {
+					queue.Push(kube.NewTask(handler.Apply, obj, model.EventDelete))
+				},
+			})
+	}
+
+	c := &controller{
+		domainSuffix: options.DomainSuffix,
+		queue:        queue,
+		informers:    informers,
+		handler:      handler,
+	}
+
+	// first handler in the chain blocks until the cache is fully synchronized
+	// it does this by returning an error to the chain handler
+	handler.Append(func(obj interface{}, event model.Event) error {
+		if !c.HasSynced() {
+			return errors.New("waiting till full synchronization")
+		}
+		if u, ok := obj.(*unstructured.Unstructured); ok {
+			log.Infof("gateway API event %s for %s %s/%s", event, u.GetKind(), u.GetNamespace(), u.GetName())
+		}
+		return nil
+	})
+
+	return c
+}
+
+func (c *controller) RegisterEventHandler(typ string, f func(model.Config, model.Event)) {
+	c.handler.Append(func(obj interface{}, event model.Event) error {
+		// A change of any resource may change both the gateways and the virtual services, as routes are bound to
+		// gateways, and gateways to classes.
+		switch typ {
+		case schemas.Gateway.Type, schemas.VirtualService.Type:
+			f(model.Config{}, event)
+		}
+		return nil
+	})
+}
+
+func (c *controller) Version() string {
+	panic("implement me")
+}
+
+func (c *controller) GetResourceAtVersion(version string, key string) (resourceVersion string, err error) {
+	panic("implement me")
+}
+
+func (c *controller) HasSynced() bool {
+	for _, informer := range c.informers {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *controller) Run(stop <-chan struct{}) {
+	go func() {
+		cache.WaitForCacheSync(stop, c.HasSynced)
+		c.queue.Run(stop)
+	}()
+	for _, informer := range c.informers {
+		go informer.Run(stop)
+	}
+	<-stop
+}
+
+func (c *controller) ConfigDescriptor() schema.Set {
+	return schema.Set{schemas.Gateway, schemas.VirtualService}
+}
+
+func (c *controller) Get(typ, name, namespace string) *model.Config {
+	configs, err := c.List(typ, namespace)
+	if err != nil {
+		return nil
+	}
+	for i := range configs {
+		if configs[i].Name == name {
+			return &configs[i]
+		}
+	}
+	return nil
+}
+
+func (c *controller) List(typ, namespace string) ([]model.Config, error) {
+	if typ != schemas.Gateway.Type && typ != schemas.VirtualService.Type {
+		return nil, errUnsupportedOp
+	}
+
+	output := Convert(c.resources(), c.domainSuffix)
+	configs := output.VirtualServices
+	if typ == schemas.Gateway.Type {
+		configs = output.Gateways
+	}
+
+	out := make([]model.Config, 0, len(configs))
+	for _, cfg := range configs {
+		if namespace == "" || namespace == cfg.Namespace {
+			out = append(out, cfg)
+		}
+	}
+	return out, nil
+}
+
+// resources decodes the cached Gateway API resources, skipping the ones failing to decode.
+func (c *controller) resources() KubernetesResources {
+	r := KubernetesResources{}
+	for _, obj := range c.informers[GatewayClassResource.Resource].GetStore().List() {
+		class := GatewayClass{}
+		if decode(obj, &class) {
+			r.GatewayClasses = append(r.GatewayClasses, class)
+		}
+	}
+	for _, obj := range c.informers[GatewayResource.Resource].GetStore().List() {
+		gw := Gateway{}
+		if decode(obj, &gw) {
+			r.Gateways = append(r.Gateways, gw)
+		}
+	}
+	for _, obj := range c.informers[HTTPRouteResource.Resource].GetStore().List() {
+		route := HTTPRoute{}
+		if decode(obj, &route) {
+			r.HTTPRoutes = append(r.HTTPRoutes, route)
+		}
+	}
+	for _, obj := range c.informers[TLSRouteResource.Resource].GetStore().List() {
+		route := TLSRoute{}
+		if decode(obj, &route) {
+			r.TLSRoutes = append(r.TLSRoutes, route)
+		}
+	}
+	return r
+}
+
+func decode(obj interface{}, into interface{}) bool {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, into); err != nil {
+		log.Warnf("failed to decode %s %s/%s: %v", u.GetKind(), u.GetNamespace(), u.GetName(), err)
+		return false
+	}
+	return true
+}
+
+func (c *controller) Create(_ model.Config) (string, error) {
+	return "", errUnsupportedOp
+}
+
+func (c *controller) Update(_ model.Config) (string, error) {
+	return "", errUnsupportedOp
+}
+
+func (c *controller) Delete(_, _, _ string) error {
+	return errUnsupportedOp
+}
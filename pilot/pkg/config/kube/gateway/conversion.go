@@ -0,0 +1,350 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	klabels "k8s.io/apimachinery/pkg/labels"
+
+	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+const (
+	// ControllerName is the controller of the gateway classes implemented by Pilot.
+	ControllerName = "istio.io/gateway-controller"
+
+	// nameSuffix is appended to the names of the generated configs.
+	nameSuffix = "istio-autogenerated-k8s-gateway"
+)
+
+// KubernetesResources are the Gateway API resources converted together, as routes are bound to gateways.
+type KubernetesResources struct {
+	GatewayClasses []GatewayClass
+	Gateways       []Gateway
+	HTTPRoutes     []HTTPRoute
+	TLSRoutes      []TLSRoute
+}
+
+// OutputResources are the gateways and virtual services the Gateway API resources are converted to.
+type OutputResources struct {
+	Gateways        []model.Config
+	VirtualServices []model.Config
+}
+
+// Convert converts the gateways of the classes implemented by Pilot to Istio gateways, and the routes bound to
+// them to virtual services of these gateways. Routes bound to no gateway are ignored.
+func Convert(r KubernetesResources, domainSuffix string) OutputResources {
+	classes := map[string]bool{}
+	for _, class := range r.GatewayClasses {
+		if class.Spec.Controller == ControllerName {
+			classes[class.Name] = true
+		}
+	}
+
+	out := OutputResources{}
+	gateways := make([]Gateway, 0, len(r.Gateways))
+	for _, gw := range r.Gateways {
+		if !classes[gw.Spec.GatewayClassName] {
+			continue
+		}
+		gateways = append(gateways, gw)
+		out.Gateways = append(out.Gateways, convertGateway(gw, domainSuffix))
+	}
+
+	for _, route := range r.HTTPRoutes {
+		bound := boundGateways(gateways, HTTPRouteKind, route.ObjectMeta)
+		if len(bound) == 0 {
+			continue
+		}
+		out.VirtualServices = append(out.VirtualServices, convertHTTPRoute(route, bound, domainSuffix))
+	}
+	for _, route := range r.TLSRoutes {
+		bound := boundGateways(gateways, TLSRouteKind, route.ObjectMeta)
+		if len(bound) == 0 {
+			continue
+		}
+		out.VirtualServices = append(out.VirtualServices, convertTLSRoute(route, bound, domainSuffix))
+	}
+	return out
+}
+
+func convertGateway(gw Gateway, domainSuffix string) model.Config {
+	gateway := &networking.Gateway{
+		Selector: labels.Instance{constants.IstioLabel: constants.IstioIngressLabelValue},
+	}
+	for i, l := range gw.Spec.Listeners {
+		server := &networking.Server{
+			Port: &networking.Port{
+				Number:   uint32(l.Port),
+				Protocol: listenerProtocol(l.Protocol),
+				Name:     fmt.Sprintf("%s-%d-gateway-%s-%s-%d", strings.ToLower(l.Protocol), l.Port, gw.Name, gw.Namespace, i),
+			},
+			Hosts: []string{"*"},
+		}
+		if l.Hostname != "" {
+			server.Hosts = []string{l.Hostname}
+		}
+		if l.TLS != nil {
+			if l.TLS.Mode == TLSModePassthrough {
+				server.Tls = &networking.Server_TLSOptions{Mode: networking.Server_TLSOptions_PASSTHROUGH}
+			} else {
+				server.Tls = &networking.Server_TLSOptions{Mode: networking.Server_TLSOptions_SIMPLE}
+				if l.TLS.CertificateRef != nil {
+					server.Tls.CredentialName = l.TLS.CertificateRef.Name
+				}
+			}
+		}
+		gateway.Servers = append(gateway.Servers, server)
+	}
+
+	return model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:      schemas.Gateway.Type,
+			Group:     schemas.Gateway.Group,
+			Version:   schemas.Gateway.Version,
+			Name:      gatewayName(gw.Name),
+			Namespace: gw.Namespace,
+			Domain:    domainSuffix,
+		},
+		Spec: gateway,
+	}
+}
+
+func listenerProtocol(p string) string {
+	switch p {
+	case HTTPProtocolType:
+		return string(protocol.HTTP)
+	case HTTPSProtocolType:
+		return string(protocol.HTTPS)
+	case TLSProtocolType:
+		return string(protocol.TLS)
+	case TCPProtocolType:
+		return string(protocol.TCP)
+	default:
+		return p
+	}
+}
+
+func gatewayName(name string) string {
+	return name + "-" + nameSuffix
+}
+
+// boundGateways returns the namespace/name of the converted gateways with a listener the route is bound to, sorted.
+func boundGateways(gateways []Gateway, kind string, route metav1.ObjectMeta) []string {
+	bound := map[string]struct{}{}
+	for _, gw := range gateways {
+		for _, l := range gw.Spec.Listeners {
+			if l.Routes.Kind != kind {
+				continue
+			}
+			if l.Routes.Namespaces.From != RouteSelectAll && gw.Namespace != route.Namespace {
+				continue
+			}
+			if l.Routes.Selector != nil {
+				selector, err := metav1.LabelSelectorAsSelector(l.Routes.Selector)
+				if err != nil {
+					log.Warnf("invalid route selector of gateway %s/%s: %v", gw.Namespace, gw.Name, err)
+					continue
+				}
+				if !selector.Matches(klabels.Set(route.Labels)) {
+					continue
+				}
+			}
+			bound[gw.Namespace+"/"+gatewayName(gw.Name)] = struct{}{}
+		}
+	}
+	out := make([]string, 0, len(bound))
+	for name := range bound {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func convertHTTPRoute(route HTTPRoute, gateways []string, domainSuffix string) model.Config {
+	vs := &networking.VirtualService{
+		Hosts:    []string{"*"},
+		Gateways: gateways,
+	}
+	if len(route.Spec.Hostnames) > 0 {
+		vs.Hosts = route.Spec.Hostnames
+	}
+	for _, rule := range route.Spec.Rules {
+		httpRoute := &networking.HTTPRoute{
+			Route: convertHTTPDestinations(rule.ForwardTo, route.Namespace, domainSuffix),
+		}
+		for _, match := range rule.Matches {
+			httpRoute.Match = append(httpRoute.Match, convertHTTPMatch(match))
+		}
+		vs.Http = append(vs.Http, httpRoute)
+	}
+	return virtualService(route.ObjectMeta, "httproute", vs, domainSuffix)
+}
+
+func convertHTTPMatch(match HTTPRouteMatch) *networking.HTTPMatchRequest {
+	out := &networking.HTTPMatchRequest{}
+	if match.Path != nil {
+		out.Uri = createStringMatch(match.Path.Type, MatchPrefix, match.Path.Value)
+	}
+	if match.Headers != nil {
+		out.Headers = map[string]*networking.StringMatch{}
+		for name, value := range match.Headers.Values {
+			out.Headers[name] = createStringMatch(match.Headers.Type, MatchExact, value)
+		}
+	}
+	return out
+}
+
+func createStringMatch(matchType, defaultType, value string) *networking.StringMatch {
+	if matchType == "" {
+		matchType = defaultType
+	}
+	switch matchType {
+	case MatchPrefix:
+		return &networking.StringMatch{MatchType: &networking.StringMatch_Prefix{Prefix: value}}
+	case MatchRegularExpression:
+		return &networking.StringMatch{MatchType: &networking.StringMatch_Regex{Regex: value}}
+	default:
+		return &networking.StringMatch{MatchType: &networking.StringMatch_Exact{Exact: value}}
+	}
+}
+
+func convertHTTPDestinations(forwardTo []RouteForwardTo, namespace, domainSuffix string) []*networking.HTTPRouteDestination {
+	weights := destinationWeights(forwardTo)
+	out := make([]*networking.HTTPRouteDestination, 0, len(forwardTo))
+	for i, f := range forwardTo {
+		if weights[i] < 0 {
+			continue
+		}
+		out = append(out, &networking.HTTPRouteDestination{
+			Destination: destination(f, namespace, domainSuffix),
+			Weight:      weights[i],
+		})
+	}
+	return out
+}
+
+func convertTLSRoute(route TLSRoute, gateways []string, domainSuffix string) model.Config {
+	vs := &networking.VirtualService{
+		Hosts:    []string{"*"},
+		Gateways: gateways,
+	}
+	hosts := map[string]struct{}{}
+	for _, rule := range route.Spec.Rules {
+		tlsRoute := &networking.TLSRoute{}
+		for _, match := range rule.Matches {
+			tlsRoute.Match = append(tlsRoute.Match, &networking.TLSMatchAttributes{SniHosts: match.SNIs})
+			for _, sni := range match.SNIs {
+				hosts[sni] = struct{}{}
+			}
+		}
+		weights := destinationWeights(rule.ForwardTo)
+		for i, f := range rule.ForwardTo {
+			if weights[i] < 0 {
+				continue
+			}
+			tlsRoute.Route = append(tlsRoute.Route, &networking.RouteDestination{
+				Destination: destination(f, route.Namespace, domainSuffix),
+				Weight:      weights[i],
+			})
+		}
+		vs.Tls = append(vs.Tls, tlsRoute)
+	}
+	// The SNI hosts must be hosts of the virtual service.
+	if len(hosts) > 0 {
+		vs.Hosts = make([]string, 0, len(hosts))
+		for host := range hosts {
+			vs.Hosts = append(vs.Hosts, host)
+		}
+		sort.Strings(vs.Hosts)
+	}
+	return virtualService(route.ObjectMeta, "tlsroute", vs, domainSuffix)
+}
+
+func destination(f RouteForwardTo, namespace, domainSuffix string) *networking.Destination {
+	d := &networking.Destination{
+		Host: fmt.Sprintf("%s.%s.svc.%s", f.ServiceName, namespace, domainSuffix),
+	}
+	if f.Port != 0 {
+		d.Port = &networking.PortSelector{Number: uint32(f.Port)}
+	}
+	return d
+}
+
+// destinationWeights converts the relative weights of the destinations to the percentages of virtual services,
+// the remainder going to the first destination. A destination of zero weight gets -1, to be skipped.
+// A single destination gets 0, as the weight of a single destination is left unset.
+func destinationWeights(forwardTo []RouteForwardTo) []int32 {
+	weights := make([]int32, len(forwardTo))
+	var total int32
+	for i, f := range forwardTo {
+		weights[i] = 1
+		if f.Weight != nil {
+			weights[i] = *f.Weight
+		}
+		if weights[i] > 0 {
+			total += weights[i]
+		}
+	}
+
+	first, count := -1, 0
+	var assigned int32
+	for i, w := range weights {
+		if w <= 0 {
+			weights[i] = -1
+			continue
+		}
+		weights[i] = w * 100 / total
+		assigned += weights[i]
+		count++
+		if first < 0 {
+			first = i
+		}
+	}
+	if first < 0 {
+		return weights
+	}
+	if count == 1 {
+		weights[first] = 0
+	} else {
+		weights[first] += 100 - assigned
+	}
+	return weights
+}
+
+func virtualService(route metav1.ObjectMeta, kind string, vs *networking.VirtualService, domainSuffix string) model.Config {
+	return model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:      schemas.VirtualService.Type,
+			Group:     schemas.VirtualService.Group,
+			Version:   schemas.VirtualService.Version,
+			Name:      route.Name + "-" + kind + "-" + nameSuffix,
+			Namespace: route.Namespace,
+			Domain:    domainSuffix,
+		},
+		Spec: vs,
+	}
+}
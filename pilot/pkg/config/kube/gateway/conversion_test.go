@@ -0,0 +1,177 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networking "istio.io/api/networking/v1alpha3"
+)
+
+func weight(w int32) *int32 {
+	return &w
+}
+
+func TestConvert(t *testing.T) {
+	resources := KubernetesResources{
+		GatewayClasses: []GatewayClass{
+			{ObjectMeta: metav1.ObjectMeta{Name: "istio"}, Spec: GatewayClassSpec{Controller: ControllerName}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "other"}, Spec: GatewayClassSpec{Controller: "example.com/controller"}},
+		},
+		Gateways: []Gateway{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "apps"},
+				Spec: GatewaySpec{
+					GatewayClassName: "istio",
+					Listeners: []Listener{
+						{
+							Hostname: "*.example.com",
+							Port:     443,
+							Protocol: HTTPSProtocolType,
+							TLS:      &GatewayTLSConfig{CertificateRef: &LocalObjectReference{Name: "example-cert"}},
+							Routes: RouteBindingSelector{
+								Kind:     HTTPRouteKind,
+								Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"expose": "true"}},
+							},
+						},
+						{
+							Port:     8443,
+							Protocol: TLSProtocolType,
+							TLS:      &GatewayTLSConfig{Mode: TLSModePassthrough},
+							Routes:   RouteBindingSelector{Kind: TLSRouteKind, Namespaces: RouteNamespaces{From: RouteSelectAll}},
+						},
+					},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "apps"},
+				Spec: GatewaySpec{
+					GatewayClassName: "other",
+					Listeners:        []Listener{{Port: 80, Protocol: HTTPProtocolType, Routes: RouteBindingSelector{Kind: HTTPRouteKind}}},
+				},
+			},
+		},
+		HTTPRoutes: []HTTPRoute{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "apps", Labels: map[string]string{"expose": "true"}},
+				Spec: HTTPRouteSpec{
+					Hostnames: []string{"web.example.com"},
+					Rules: []HTTPRouteRule{
+						{
+							Matches: []HTTPRouteMatch{{
+								Path:    &HTTPPathMatch{Value: "/api"},
+								Headers: &HTTPHeaderMatch{Values: map[string]string{"version": "v2"}},
+							}},
+							ForwardTo: []RouteForwardTo{
+								{ServiceName: "api-v1", Port: 8080, Weight: weight(2)},
+								{ServiceName: "api-v2", Port: 8080, Weight: weight(1)},
+								{ServiceName: "api-v3", Port: 8080, Weight: weight(0)},
+							},
+						},
+						{
+							ForwardTo: []RouteForwardTo{{ServiceName: "web", Port: 80}},
+						},
+					},
+				},
+			},
+			// Not selected by the listener of the gateway.
+			{ObjectMeta: metav1.ObjectMeta{Name: "hidden", Namespace: "apps"}},
+			// Not in the namespace of the gateway.
+			{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "other", Labels: map[string]string{"expose": "true"}}},
+		},
+		TLSRoutes: []TLSRoute{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "data"},
+				Spec: TLSRouteSpec{
+					Rules: []TLSRouteRule{{
+						Matches:   []TLSRouteMatch{{SNIs: []string{"db.example.com"}}},
+						ForwardTo: []RouteForwardTo{{ServiceName: "db", Port: 5432}},
+					}},
+				},
+			},
+		},
+	}
+
+	out := Convert(resources, "cluster.local")
+
+	if len(out.Gateways) != 1 {
+		t.Fatalf("got %d gateways, want 1", len(out.Gateways))
+	}
+	gw := out.Gateways[0]
+	if gw.Name != "gw-istio-autogenerated-k8s-gateway" || gw.Namespace != "apps" {
+		t.Errorf("got gateway %s/%s", gw.Namespace, gw.Name)
+	}
+	servers := gw.Spec.(*networking.Gateway).Servers
+	if len(servers) != 2 {
+		t.Fatalf("got %d servers, want 2", len(servers))
+	}
+	if servers[0].Port.Number != 443 || servers[0].Port.Protocol != "HTTPS" ||
+		!reflect.DeepEqual(servers[0].Hosts, []string{"*.example.com"}) ||
+		servers[0].Tls.Mode != networking.Server_TLSOptions_SIMPLE || servers[0].Tls.CredentialName != "example-cert" {
+		t.Errorf("got server %v", servers[0])
+	}
+	if servers[1].Port.Protocol != "TLS" || servers[1].Tls.Mode != networking.Server_TLSOptions_PASSTHROUGH ||
+		!reflect.DeepEqual(servers[1].Hosts, []string{"*"}) {
+		t.Errorf("got server %v", servers[1])
+	}
+
+	if len(out.VirtualServices) != 2 {
+		t.Fatalf("got %d virtual services, want 2", len(out.VirtualServices))
+	}
+	gateways := []string{"apps/gw-istio-autogenerated-k8s-gateway"}
+
+	web := out.VirtualServices[0]
+	if web.Name != "web-httproute-istio-autogenerated-k8s-gateway" || web.Namespace != "apps" {
+		t.Errorf("got virtual service %s/%s", web.Namespace, web.Name)
+	}
+	vs := web.Spec.(*networking.VirtualService)
+	if !reflect.DeepEqual(vs.Gateways, gateways) || !reflect.DeepEqual(vs.Hosts, []string{"web.example.com"}) {
+		t.Errorf("got gateways %v and hosts %v", vs.Gateways, vs.Hosts)
+	}
+	if len(vs.Http) != 2 {
+		t.Fatalf("got %d HTTP routes, want 2", len(vs.Http))
+	}
+	match := vs.Http[0].Match[0]
+	if match.Uri.GetPrefix() != "/api" || match.Headers["version"].GetExact() != "v2" {
+		t.Errorf("got match %v", match)
+	}
+	weights := map[string]int32{}
+	for _, d := range vs.Http[0].Route {
+		weights[d.Destination.Host] = d.Weight
+	}
+	if !reflect.DeepEqual(weights, map[string]int32{
+		"api-v1.apps.svc.cluster.local": 67,
+		"api-v2.apps.svc.cluster.local": 33,
+	}) {
+		t.Errorf("got weights %v", weights)
+	}
+	if d := vs.Http[1].Route; len(d) != 1 || d[0].Weight != 0 || d[0].Destination.Port.Number != 80 {
+		t.Errorf("got destinations %v", d)
+	}
+
+	db := out.VirtualServices[1]
+	vs = db.Spec.(*networking.VirtualService)
+	if db.Namespace != "data" || !reflect.DeepEqual(vs.Gateways, gateways) ||
+		!reflect.DeepEqual(vs.Hosts, []string{"db.example.com"}) {
+		t.Errorf("got virtual service %s/%s for gateways %v and hosts %v", db.Namespace, db.Name, vs.Gateways, vs.Hosts)
+	}
+	if len(vs.Tls) != 1 || !reflect.DeepEqual(vs.Tls[0].Match[0].SniHosts, []string{"db.example.com"}) ||
+		vs.Tls[0].Route[0].Destination.Host != "db.data.svc.cluster.local" {
+		t.Errorf("got TLS routes %v", vs.Tls)
+	}
+}
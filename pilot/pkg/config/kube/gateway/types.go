@@ -0,0 +1,216 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// The subset of the networking.x-k8s.io/v1alpha1 Gateway API read by the controller. The upstream types are
+// not vendored, the resources are read with the dynamic client and decoded into these.
+
+const (
+	// Group is the API group of the Gateway API resources.
+	Group = "networking.x-k8s.io"
+	// Version is the version of the Gateway API resources.
+	Version = "v1alpha1"
+)
+
+var (
+	// GatewayClassResource is the cluster scoped resource of the gateway classes.
+	GatewayClassResource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "gatewayclasses"}
+	// GatewayResource is the resource of the gateways.
+	GatewayResource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "gateways"}
+	// HTTPRouteResource is the resource of the HTTP routes.
+	HTTPRouteResource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "httproutes"}
+	// TLSRouteResource is the resource of the TLS routes.
+	TLSRouteResource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "tlsroutes"}
+)
+
+// Kinds of the routes bound to the listeners of gateways.
+const (
+	HTTPRouteKind = "HTTPRoute"
+	TLSRouteKind  = "TLSRoute"
+)
+
+// GatewayClass is a class of gateways, implemented by the controller it names.
+type GatewayClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec GatewayClassSpec `json:"spec"`
+}
+
+// GatewayClassSpec is the spec of a gateway class.
+type GatewayClassSpec struct {
+	Controller string `json:"controller"`
+}
+
+// Gateway is a load balancer of a gateway class, listening on ports routes are bound to.
+type Gateway struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec GatewaySpec `json:"spec"`
+}
+
+// GatewaySpec is the spec of a gateway.
+type GatewaySpec struct {
+	GatewayClassName string     `json:"gatewayClassName"`
+	Listeners        []Listener `json:"listeners"`
+}
+
+// Listener is a port of a gateway, and the selection of the routes bound to it.
+type Listener struct {
+	// Hostname restricts the hosts the listener serves, all of them if empty.
+	Hostname string               `json:"hostname,omitempty"`
+	Port     int32                `json:"port"`
+	Protocol string               `json:"protocol"`
+	TLS      *GatewayTLSConfig    `json:"tls,omitempty"`
+	Routes   RouteBindingSelector `json:"routes"`
+}
+
+// Protocols of the listeners.
+const (
+	HTTPProtocolType  = "HTTP"
+	HTTPSProtocolType = "HTTPS"
+	TLSProtocolType   = "TLS"
+	TCPProtocolType   = "TCP"
+)
+
+// GatewayTLSConfig is the TLS configuration of a listener.
+type GatewayTLSConfig struct {
+	// Mode is either Terminate, the default, or Passthrough.
+	Mode string `json:"mode,omitempty"`
+	// CertificateRef is the secret holding the certificate of the listener, when terminating TLS.
+	CertificateRef *LocalObjectReference `json:"certificateRef,omitempty"`
+}
+
+// TLS modes of the listeners.
+const (
+	TLSModeTerminate   = "Terminate"
+	TLSModePassthrough = "Passthrough"
+)
+
+// LocalObjectReference references an object in the namespace of the referrer.
+type LocalObjectReference struct {
+	Group string `json:"group,omitempty"`
+	Kind  string `json:"kind,omitempty"`
+	Name  string `json:"name"`
+}
+
+// RouteBindingSelector selects the routes bound to a listener.
+type RouteBindingSelector struct {
+	// Namespaces selects the namespaces of the routes.
+	Namespaces RouteNamespaces `json:"namespaces,omitempty"`
+	// Selector selects the routes by their labels, all of them if nil.
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// Kind is the kind of the routes.
+	Kind string `json:"kind"`
+}
+
+// RouteNamespaces selects the namespaces of the routes bound to a listener.
+type RouteNamespaces struct {
+	// From is either Same, the default, for the namespace of the gateway only, or All.
+	From string `json:"from,omitempty"`
+}
+
+// Namespaces the routes are bound from.
+const (
+	RouteSelectAll  = "All"
+	RouteSelectSame = "Same"
+)
+
+// HTTPRoute routes HTTP requests to services.
+type HTTPRoute struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec HTTPRouteSpec `json:"spec"`
+}
+
+// HTTPRouteSpec is the spec of an HTTP route.
+type HTTPRouteSpec struct {
+	// Hostnames are the hosts the route applies to, all of them if empty.
+	Hostnames []string        `json:"hostnames,omitempty"`
+	Rules     []HTTPRouteRule `json:"rules"`
+}
+
+// HTTPRouteRule forwards the requests matching any of its matches.
+type HTTPRouteRule struct {
+	Matches   []HTTPRouteMatch `json:"matches,omitempty"`
+	ForwardTo []RouteForwardTo `json:"forwardTo,omitempty"`
+}
+
+// HTTPRouteMatch matches the requests matching both its path and headers.
+type HTTPRouteMatch struct {
+	Path    *HTTPPathMatch   `json:"path,omitempty"`
+	Headers *HTTPHeaderMatch `json:"headers,omitempty"`
+}
+
+// HTTPPathMatch matches the path of requests.
+type HTTPPathMatch struct {
+	// Type is either Exact, Prefix, the default, or RegularExpression.
+	Type  string `json:"type,omitempty"`
+	Value string `json:"value"`
+}
+
+// HTTPHeaderMatch matches the headers of requests.
+type HTTPHeaderMatch struct {
+	// Type is either Exact, the default, or RegularExpression.
+	Type   string            `json:"type,omitempty"`
+	Values map[string]string `json:"values"`
+}
+
+// Types of the path and header matches.
+const (
+	MatchExact             = "Exact"
+	MatchPrefix            = "Prefix"
+	MatchRegularExpression = "RegularExpression"
+)
+
+// TLSRoute routes TLS connections to services by their SNI.
+type TLSRoute struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec TLSRouteSpec `json:"spec"`
+}
+
+// TLSRouteSpec is the spec of a TLS route.
+type TLSRouteSpec struct {
+	Rules []TLSRouteRule `json:"rules"`
+}
+
+// TLSRouteRule forwards the connections matching any of its matches.
+type TLSRouteRule struct {
+	Matches   []TLSRouteMatch  `json:"matches,omitempty"`
+	ForwardTo []RouteForwardTo `json:"forwardTo,omitempty"`
+}
+
+// TLSRouteMatch matches the SNI of connections.
+type TLSRouteMatch struct {
+	SNIs []string `json:"snis,omitempty"`
+}
+
+// RouteForwardTo is a service traffic is forwarded to.
+type RouteForwardTo struct {
+	// ServiceName is the name of the service, in the namespace of the route.
+	ServiceName string `json:"serviceName"`
+	Port        int32  `json:"port"`
+	// Weight is the weight of the service relative to the other ones of the rule, 1 if unset.
+	Weight *int32 `json:"weight,omitempty"`
+}
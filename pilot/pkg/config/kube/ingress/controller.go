@@ -104,7 +104,7 @@ func NewController(client kubernetes.Interface, mesh *meshconfig.MeshConfig,
 			},
 			UpdateFunc: func(old, cur interface{}) {
 				if !reflect.DeepEqual(old, cur) {
-					queue.Push(kube.NewTask(handler.Apply, cur, model.EventUpdate))
+					queue.Push(kube.NewUpdateTask(handler.Apply, old, cur))
 				}
 			},
 			DeleteFunc: func(obj interface{}) {
@@ -15,10 +15,8 @@
 package ingress
 
 import (
-	"context"
 	"fmt"
 	"net"
-	"os"
 	"sort"
 	"strings"
 	"time"
@@ -31,17 +29,13 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/tools/leaderelection"
-	"k8s.io/client-go/tools/leaderelection/resourcelock"
-	"k8s.io/client-go/tools/record"
 
 	meshconfig "istio.io/api/mesh/v1alpha1"
+	"istio.io/istio/pilot/pkg/leaderelection"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/serviceregistry/kube"
 	controller2 "istio.io/istio/pilot/pkg/serviceregistry/kube/controller"
-	"istio.io/pkg/env"
 	"istio.io/pkg/log"
 )
 
@@ -60,22 +54,19 @@ type StatusSyncer struct {
 	// Name of service (ingressgateway default) to find the IP
 	ingressService string
 
-	queue    kube.Queue
 	informer cache.SharedIndexInformer
-	elector  *leaderelection.LeaderElector
+	elector  *leaderelection.LeaderElection
 	handler  *kube.ChainHandler
 }
 
 // Run the syncer until stopCh is closed
 func (s *StatusSyncer) Run(stopCh <-chan struct{}) {
 	go s.informer.Run(stopCh)
-	go s.elector.Run(context.Background())
+	go s.elector.Run(stopCh)
 	<-stopCh
 	// TODO: should we remove current IPs on shutting down?
 }
 
-var podNameVar = env.RegisterStringVar("POD_NAME", "", "")
-
 // NewStatusSyncer creates a new instance
 func NewStatusSyncer(mesh *meshconfig.MeshConfig,
 	client kubernetes.Interface,
@@ -91,8 +82,6 @@ func NewStatusSyncer(mesh *meshconfig.MeshConfig,
 	}
 
 	handler := &kube.ChainHandler{}
-	// queue requires a time duration for a retry delay after a handler error
-	queue := kube.NewQueue(1 * time.Second)
 
 	informer := cache.NewSharedIndexInformer(
 		&cache.ListWatch{
@@ -109,67 +98,29 @@ func NewStatusSyncer(mesh *meshconfig.MeshConfig,
 	st := StatusSyncer{
 		client:              client,
 		informer:            informer,
-		queue:               queue,
 		ingressClass:        ingressClass,
 		defaultIngressClass: defaultIngressClass,
 		ingressService:      mesh.IngressService,
 		handler:             handler,
 	}
 
-	callbacks := leaderelection.LeaderCallbacks{
-		OnStartedLeading: func(ctx context.Context) {
-			log.Infof("I am the new status update leader")
-			go st.queue.Run(ctx.Done())
-			err := wait.PollUntil(updateInterval, func() (bool, error) {
-				st.queue.Push(kube.NewTask(st.handler.Apply, "Start leading", model.EventUpdate))
-				return false, nil
-			}, ctx.Done())
-
-			if err != nil {
-				log.Errorf("Stop requested")
-			}
-		},
-		OnStoppedLeading: func() {
-			log.Infof("I am not status update leader anymore")
-		},
-		OnNewLeader: func(identity string) {
-			log.Infof("New leader elected: %v", identity)
-		},
-	}
-
-	broadcaster := record.NewBroadcaster()
-	hostname, _ := os.Hostname()
+	// Only the leader updates the status, until it loses the lease.
+	st.elector = leaderelection.NewLeaderElection(pilotNamespace, electionID, client).AddRunFunction(func(stop <-chan struct{}) {
+		log.Infof("I am the new status update leader")
+		// queue requires a time duration for a retry delay after a handler error
+		queue := kube.NewQueue(1 * time.Second)
+		go queue.Run(stop)
+		// Update right away when taking over.
+		err := wait.PollImmediateUntil(updateInterval, func() (bool, error) {
+			queue.Push(kube.NewTask(st.handler.Apply, "Start leading", model.EventUpdate))
+			return false, nil
+		}, stop)
 
-	recorder := broadcaster.NewRecorder(scheme.Scheme, coreV1.EventSource{
-		Component: "ingress-leader-elector",
-		Host:      hostname,
-	})
-	podName := podNameVar.Get()
-
-	lock := resourcelock.ConfigMapLock{
-		ConfigMapMeta: metaV1.ObjectMeta{Namespace: pilotNamespace, Name: electionID},
-		Client:        client.CoreV1(),
-		LockConfig: resourcelock.ResourceLockConfig{
-			Identity:      podName,
-			EventRecorder: recorder,
-		},
-	}
-
-	ttl := 30 * time.Second
-	le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
-		Lock:          &lock,
-		LeaseDuration: ttl,
-		RenewDeadline: ttl / 2,
-		RetryPeriod:   ttl / 4,
-		Callbacks:     callbacks,
+		if err != nil {
+			log.Infof("I am not status update leader anymore")
+		}
 	})
 
-	if err != nil {
-		log.Errorf("unexpected error starting leader election: %v", err)
-	}
-
-	st.elector = le
-
 	// Register handler at the beginning
 	handler.Append(func(obj interface{}, event model.Event) error {
 		addrs, err := st.runningAddresses(ingressNamespace)
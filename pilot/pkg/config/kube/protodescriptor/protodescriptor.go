@@ -0,0 +1,107 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package protodescriptor reads the proto descriptor sets of the gRPC JSON transcoders from the ConfigMaps and
+// Secrets labeled with model.ProtoDescriptorLabel, so that Pilot sends them to the proxies inline.
+package protodescriptor
+
+import (
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// Controller watches the ConfigMaps and Secrets of the proto descriptor sets.
+type Controller struct {
+	configMaps cache.SharedIndexInformer
+	secrets    cache.SharedIndexInformer
+}
+
+var _ model.ProtoDescriptors = &Controller{}
+
+// NewController creates a controller calling onChange when a proto descriptor set changes.
+func NewController(client kubernetes.Interface, resyncPeriod time.Duration, onChange func()) *Controller {
+	factory := informers.NewSharedInformerFactoryWithOptions(client, resyncPeriod,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = model.ProtoDescriptorLabel + "=true"
+		}))
+	c := &Controller{
+		configMaps: factory.Core().V1().ConfigMaps().Informer(),
+		secrets:    factory.Core().V1().Secrets().Informer(),
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { onChange() },
+		UpdateFunc: func(interface{}, interface{}) { onChange() },
+		DeleteFunc: func(interface{}) { onChange() },
+	}
+	c.configMaps.AddEventHandler(handler)
+	c.secrets.AddEventHandler(handler)
+	return c
+}
+
+// Run runs the controller until the stop channel is closed.
+func (c *Controller) Run(stop <-chan struct{}) {
+	go c.configMaps.Run(stop)
+	c.secrets.Run(stop)
+}
+
+// HasSynced returns true once the ConfigMaps and Secrets are listed.
+func (c *Controller) HasSynced() bool {
+	return c.configMaps.HasSynced() && c.secrets.HasSynced()
+}
+
+// ProtoDescriptor implements model.ProtoDescriptors. The proto descriptor set of a ConfigMap is either binary data,
+// as created by kubectl create configmap --from-file, or data.
+func (c *Controller) ProtoDescriptor(kind, namespace, name, key string) ([]byte, error) {
+	switch kind {
+	case model.ProtoDescriptorConfigMap:
+		obj, exists, err := c.configMaps.GetStore().GetByKey(namespace + "/" + name)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("configmap %s/%s labeled %s=true not found", namespace, name, model.ProtoDescriptorLabel)
+		}
+		cm := obj.(*v1.ConfigMap)
+		if bin, ok := cm.BinaryData[key]; ok {
+			return bin, nil
+		}
+		if data, ok := cm.Data[key]; ok {
+			return []byte(data), nil
+		}
+		return nil, fmt.Errorf("configmap %s/%s has no key %s", namespace, name, key)
+	case model.ProtoDescriptorSecret:
+		obj, exists, err := c.secrets.GetStore().GetByKey(namespace + "/" + name)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("secret %s/%s labeled %s=true not found", namespace, name, model.ProtoDescriptorLabel)
+		}
+		bin, ok := obj.(*v1.Secret).Data[key]
+		if !ok {
+			return nil, fmt.Errorf("secret %s/%s has no key %s", namespace, name, key)
+		}
+		return bin, nil
+	default:
+		return nil, fmt.Errorf("invalid proto descriptor kind %q", kind)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protodescriptor
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestProtoDescriptor(t *testing.T) {
+	labeled := map[string]string{model.ProtoDescriptorLabel: "true"}
+	client := fake.NewSimpleClientset(
+		&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "bookstore", Namespace: "default", Labels: labeled},
+			BinaryData: map[string][]byte{"bookstore.pb": []byte("binary")},
+			Data:       map[string]string{"authors.pb": "data"},
+		},
+		&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "unlabeled", Namespace: "default"},
+			BinaryData: map[string][]byte{"bookstore.pb": []byte("binary")},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "bookstore", Namespace: "default", Labels: labeled},
+			Data:       map[string][]byte{"bookstore.pb": []byte("secret")},
+		},
+	)
+	c := NewController(client, 0, func() {})
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.Run(stop)
+	if !cache.WaitForCacheSync(stop, c.HasSynced) {
+		t.Fatal("failed to sync the proto descriptors")
+	}
+
+	cases := []struct {
+		kind      string
+		namespace string
+		name      string
+		key       string
+		expected  string
+	}{
+		{model.ProtoDescriptorConfigMap, "default", "bookstore", "bookstore.pb", "binary"},
+		{model.ProtoDescriptorConfigMap, "default", "bookstore", "authors.pb", "data"},
+		{model.ProtoDescriptorConfigMap, "default", "bookstore", "missing.pb", ""},
+		{model.ProtoDescriptorConfigMap, "default", "unlabeled", "bookstore.pb", ""},
+		{model.ProtoDescriptorConfigMap, "prod", "bookstore", "bookstore.pb", ""},
+		{model.ProtoDescriptorSecret, "default", "bookstore", "bookstore.pb", "secret"},
+		{model.ProtoDescriptorSecret, "default", "bookstore", "authors.pb", ""},
+	}
+	for _, tc := range cases {
+		got, err := c.ProtoDescriptor(tc.kind, tc.namespace, tc.name, tc.key)
+		if tc.expected == "" {
+			if err == nil {
+				t.Errorf("ProtoDescriptor(%s, %s, %s, %s) = %q, want an error", tc.kind, tc.namespace, tc.name,
+					tc.key, got)
+			}
+			continue
+		}
+		if err != nil || string(got) != tc.expected {
+			t.Errorf("ProtoDescriptor(%s, %s, %s, %s) = %q, %v, want %q", tc.kind, tc.namespace, tc.name, tc.key,
+				got, err, tc.expected)
+		}
+	}
+}
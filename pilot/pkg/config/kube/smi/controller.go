@@ -0,0 +1,201 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package smi provides a read-only view of the SMI TrafficSplit resources (split.smi-spec.io) as virtual
+// services, for the tools only speaking SMI to shift traffic between the versions of a service.
+package smi
+
+import (
+	"errors"
+	"reflect"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry/kube"
+	kubecontroller "istio.io/istio/pilot/pkg/serviceregistry/kube/controller"
+	"istio.io/istio/pkg/config/schema"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+// Each traffic split is converted to a virtual service of the mesh gateway, named by appending
+// "-istio-autogenerated-smi-split" to its name, in its namespace. The virtual service is bound to the root
+// service, so a user defined virtual service of the same host conflicts with it.
+//
+// The TrafficSplit CRD must be installed before enabling the controller, with PILOT_ENABLE_SMI_TRAFFIC_SPLIT.
+
+type controller struct {
+	domainSuffix string
+
+	queue    kube.Queue
+	informer cache.SharedIndexInformer
+	handler  *kube.ChainHandler
+}
+
+var (
+	errUnsupportedOp = errors.New("unsupported operation: the traffic split config store is a read-only view")
+)
+
+// NewController creates a controller of the traffic splits of the watched namespace.
+func NewController(client dynamic.Interface, options kubecontroller.Options) model.ConfigStoreCache {
+	handler := &kube.ChainHandler{}
+
+	// queue requires a time duration for a retry delay after a handler error
+	queue := kube.NewQueue(1 * time.Second)
+
+	log.Infof("SMI traffic split controller watching namespaces %q", options.WatchedNamespace)
+	informer := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, options.ResyncPeriod, options.WatchedNamespace, nil).
+		ForResource(TrafficSplitResource).Informer()
+	informer.AddEventHandler(
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				queue.Push(kube.NewTask(handler.Apply, obj, model.EventAdd))
+			},
+			UpdateFunc: func(old, cur interface{}) {
+				if !reflect.DeepEqual(old, cur) {
+					queue.Push(kube.NewUpdateTask(handler.Apply, old, cur))
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				queue.Push(kube.NewTask(handler.Apply, obj, model.EventDelete))
+			},
+		})
+
+	// first handler in the chain blocks until the cache is fully synchronized
+	// it does this by returning an error to the chain handler
+	handler.Append(func(obj interface{}, event model.Event) error {
+		if !informer.HasSynced() {
+			return errors.New("waiting till full synchronization")
+		}
+		if u, ok := obj.(*unstructured.Unstructured); ok {
+			log.Infof("traffic split event %s for %s/%s", event, u.GetNamespace(), u.GetName())
+		}
+		return nil
+	})
+
+	return &controller{
+		domainSuffix: options.DomainSuffix,
+		queue:        queue,
+		informer:     informer,
+		handler:      handler,
+	}
+}
+
+func (c *controller) RegisterEventHandler(typ string, f func(model.Config, model.Event)) {
+	c.handler.Append(func(obj interface{}, event model.Event) error {
+		if typ != schemas.VirtualService.Type {
+			return nil
+		}
+		split, ok := decode(obj)
+		if !ok {
+			f(model.Config{}, event)
+			return nil
+		}
+		cfg := ConvertTrafficSplit(split, c.domainSuffix)
+		if cfg == nil {
+			f(model.Config{}, event)
+			return nil
+		}
+		f(*cfg, event)
+		return nil
+	})
+}
+
+func (c *controller) Version() string {
+	panic("implement me")
+}
+
+func (c *controller) GetResourceAtVersion(version string, key string) (resourceVersion string, err error) {
+	panic("implement me")
+}
+
+func (c *controller) HasSynced() bool {
+	return c.informer.HasSynced()
+}
+
+func (c *controller) Run(stop <-chan struct{}) {
+	go func() {
+		cache.WaitForCacheSync(stop, c.HasSynced)
+		c.queue.Run(stop)
+	}()
+	go c.informer.Run(stop)
+	<-stop
+}
+
+func (c *controller) ConfigDescriptor() schema.Set {
+	return schema.Set{schemas.VirtualService}
+}
+
+func (c *controller) Get(typ, name, namespace string) *model.Config {
+	configs, err := c.List(typ, namespace)
+	if err != nil {
+		return nil
+	}
+	for i := range configs {
+		if configs[i].Name == name {
+			return &configs[i]
+		}
+	}
+	return nil
+}
+
+func (c *controller) List(typ, namespace string) ([]model.Config, error) {
+	if typ != schemas.VirtualService.Type {
+		return nil, errUnsupportedOp
+	}
+
+	out := make([]model.Config, 0)
+	for _, obj := range c.informer.GetStore().List() {
+		split, ok := decode(obj)
+		if !ok || (namespace != "" && namespace != split.Namespace) {
+			continue
+		}
+		if cfg := ConvertTrafficSplit(split, c.domainSuffix); cfg != nil {
+			out = append(out, *cfg)
+		}
+	}
+	return out, nil
+}
+
+func decode(obj interface{}) (TrafficSplit, bool) {
+	split := TrafficSplit{}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return split, false
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &split); err != nil {
+		log.Warnf("failed to decode traffic split %s/%s: %v", u.GetNamespace(), u.GetName(), err)
+		return split, false
+	}
+	return split, true
+}
+
+func (c *controller) Create(_ model.Config) (string, error) {
+	return "", errUnsupportedOp
+}
+
+func (c *controller) Update(_ model.Config) (string, error) {
+	return "", errUnsupportedOp
+}
+
+func (c *controller) Delete(_, _, _ string) error {
+	return errUnsupportedOp
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smi
+
+import (
+	"fmt"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+// nameSuffix is appended to the names of the traffic splits to name their virtual services.
+const nameSuffix = "istio-autogenerated-smi-split"
+
+// ConvertTrafficSplit converts a traffic split to a virtual service of the mesh, splitting the HTTP and TCP
+// traffic to the root service across the backends. It returns nil if no backend has a positive weight.
+func ConvertTrafficSplit(split TrafficSplit, domainSuffix string) *model.Config {
+	weights := percentages(split.Spec.Backends)
+	if weights == nil {
+		return nil
+	}
+
+	httpRoute := &networking.HTTPRoute{}
+	tcpRoute := &networking.TCPRoute{}
+	for i, backend := range split.Spec.Backends {
+		if weights[i] == 0 {
+			continue
+		}
+		host := fmt.Sprintf("%s.%s.svc.%s", backend.Service, split.Namespace, domainSuffix)
+		httpRoute.Route = append(httpRoute.Route, &networking.HTTPRouteDestination{
+			Destination: &networking.Destination{Host: host},
+			Weight:      weights[i],
+		})
+		tcpRoute.Route = append(tcpRoute.Route, &networking.RouteDestination{
+			Destination: &networking.Destination{Host: host},
+			Weight:      weights[i],
+		})
+	}
+
+	return &model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:      schemas.VirtualService.Type,
+			Group:     schemas.VirtualService.Group,
+			Version:   schemas.VirtualService.Version,
+			Name:      split.Name + "-" + nameSuffix,
+			Namespace: split.Namespace,
+			Domain:    domainSuffix,
+		},
+		Spec: &networking.VirtualService{
+			Hosts:    []string{fmt.Sprintf("%s.%s.svc.%s", split.Spec.Service, split.Namespace, domainSuffix)},
+			Gateways: []string{constants.IstioMeshGateway},
+			Http:     []*networking.HTTPRoute{httpRoute},
+			Tcp:      []*networking.TCPRoute{tcpRoute},
+		},
+	}
+}
+
+// percentages converts the relative weights of the backends to percentages summing to 100, the remainder going
+// to the first backend of positive weight. Backends of non positive weight get 0. It returns nil if there is no
+// backend of positive weight.
+func percentages(backends []TrafficSplitBackend) []int32 {
+	total := 0
+	for _, backend := range backends {
+		if backend.Weight > 0 {
+			total += backend.Weight
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+
+	weights := make([]int32, len(backends))
+	first := -1
+	var assigned int32
+	for i, backend := range backends {
+		if backend.Weight <= 0 {
+			continue
+		}
+		weights[i] = int32(backend.Weight * 100 / total)
+		assigned += weights[i]
+		if first < 0 {
+			first = i
+		}
+	}
+	weights[first] += 100 - assigned
+	return weights
+}
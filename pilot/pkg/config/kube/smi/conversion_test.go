@@ -0,0 +1,72 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smi
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networking "istio.io/api/networking/v1alpha3"
+)
+
+func TestConvertTrafficSplit(t *testing.T) {
+	split := TrafficSplit{
+		ObjectMeta: metav1.ObjectMeta{Name: "reviews-rollout", Namespace: "default"},
+		Spec: TrafficSplitSpec{
+			Service: "reviews",
+			Backends: []TrafficSplitBackend{
+				{Service: "reviews-primary", Weight: 2},
+				{Service: "reviews-canary", Weight: 1},
+				{Service: "reviews-old", Weight: 0},
+			},
+		},
+	}
+
+	cfg := ConvertTrafficSplit(split, "cluster.local")
+	if cfg == nil {
+		t.Fatal("no virtual service")
+	}
+	if cfg.Name != "reviews-rollout-istio-autogenerated-smi-split" || cfg.Namespace != "default" {
+		t.Errorf("got virtual service %s/%s", cfg.Namespace, cfg.Name)
+	}
+	vs := cfg.Spec.(*networking.VirtualService)
+	if !reflect.DeepEqual(vs.Hosts, []string{"reviews.default.svc.cluster.local"}) ||
+		!reflect.DeepEqual(vs.Gateways, []string{"mesh"}) {
+		t.Errorf("got hosts %v and gateways %v", vs.Hosts, vs.Gateways)
+	}
+
+	want := map[string]int32{
+		"reviews-primary.default.svc.cluster.local": 67,
+		"reviews-canary.default.svc.cluster.local":  33,
+	}
+	http := map[string]int32{}
+	for _, d := range vs.Http[0].Route {
+		http[d.Destination.Host] = d.Weight
+	}
+	tcp := map[string]int32{}
+	for _, d := range vs.Tcp[0].Route {
+		tcp[d.Destination.Host] = d.Weight
+	}
+	if !reflect.DeepEqual(http, want) || !reflect.DeepEqual(tcp, want) {
+		t.Errorf("got HTTP weights %v and TCP weights %v, want %v", http, tcp, want)
+	}
+
+	split.Spec.Backends = []TrafficSplitBackend{{Service: "reviews-primary"}}
+	if cfg := ConvertTrafficSplit(split, "cluster.local"); cfg != nil {
+		t.Errorf("got virtual service %v for a split without weights", cfg)
+	}
+}
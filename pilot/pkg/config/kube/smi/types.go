@@ -0,0 +1,45 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smi
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// TrafficSplitResource is the resource of the SMI traffic splits, read with the dynamic client.
+var TrafficSplitResource = schema.GroupVersionResource{Group: "split.smi-spec.io", Version: "v1alpha2", Resource: "trafficsplits"}
+
+// TrafficSplit splits the traffic to a root service across backend services.
+type TrafficSplit struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec TrafficSplitSpec `json:"spec"`
+}
+
+// TrafficSplitSpec is the spec of a traffic split.
+type TrafficSplitSpec struct {
+	// Service is the root service the clients address, in the namespace of the split.
+	Service string `json:"service"`
+	// Backends are the services the traffic is split across, in the namespace of the split.
+	Backends []TrafficSplitBackend `json:"backends"`
+}
+
+// TrafficSplitBackend is a service receiving a share of the traffic proportional to its weight.
+type TrafficSplitBackend struct {
+	Service string `json:"service"`
+	Weight  int    `json:"weight"`
+}
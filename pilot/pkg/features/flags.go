@@ -0,0 +1,164 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package features
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"istio.io/pkg/env"
+)
+
+// Flag is a feature flag of Pilot, read from an environment variable, as returned by /debug/flagz.
+type Flag struct {
+	Name string `json:"name"`
+	// Type is one of bool, int, float, duration or string.
+	Type        string `json:"type"`
+	Default     string `json:"default"`
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+	// Mutable flags can be set at runtime, as they are read each time the configuration is generated.
+	Mutable bool `json:"mutable"`
+}
+
+type flag struct {
+	Flag
+	value func() string
+	parse func(string) error
+}
+
+var (
+	flagsMutex sync.Mutex
+	flags      = make(map[string]*flag)
+)
+
+func addFlag(name, typ, defaultValue, description string, mutable bool, value func() string,
+	parse func(string) error) {
+	flagsMutex.Lock()
+	defer flagsMutex.Unlock()
+	flags[name] = &flag{
+		Flag: Flag{
+			Name:        name,
+			Type:        typ,
+			Default:     defaultValue,
+			Description: description,
+			Mutable:     mutable,
+		},
+		value: value,
+		parse: parse,
+	}
+}
+
+func registerBoolVar(name string, defaultValue bool, description string) env.BoolVar {
+	return registerBool(name, defaultValue, description, false)
+}
+
+// registerMutableBoolVar registers a flag read each time the configuration of the proxies is generated, which is
+// safe to change at runtime: it applies to the next push.
+func registerMutableBoolVar(name string, defaultValue bool, description string) env.BoolVar {
+	return registerBool(name, defaultValue, description, true)
+}
+
+func registerBool(name string, defaultValue bool, description string, mutable bool) env.BoolVar {
+	v := env.RegisterBoolVar(name, defaultValue, description)
+	addFlag(name, "bool", strconv.FormatBool(defaultValue), description, mutable,
+		func() string { return strconv.FormatBool(v.Get()) },
+		func(s string) error {
+			_, err := strconv.ParseBool(s)
+			return err
+		})
+	return v
+}
+
+func registerIntVar(name string, defaultValue int, description string) env.IntVar {
+	v := env.RegisterIntVar(name, defaultValue, description)
+	addFlag(name, "int", strconv.Itoa(defaultValue), description, false,
+		func() string { return strconv.Itoa(v.Get()) },
+		func(s string) error {
+			_, err := strconv.Atoi(s)
+			return err
+		})
+	return v
+}
+
+func registerFloatVar(name string, defaultValue float64, description string) env.FloatVar {
+	v := env.RegisterFloatVar(name, defaultValue, description)
+	addFlag(name, "float", strconv.FormatFloat(defaultValue, 'g', -1, 64), description, false,
+		func() string { return strconv.FormatFloat(v.Get(), 'g', -1, 64) },
+		func(s string) error {
+			_, err := strconv.ParseFloat(s, 64)
+			return err
+		})
+	return v
+}
+
+func registerDurationVar(name string, defaultValue time.Duration, description string) env.DurationVar {
+	v := env.RegisterDurationVar(name, defaultValue, description)
+	addFlag(name, "duration", defaultValue.String(), description, false,
+		func() string { return v.Get().String() },
+		func(s string) error {
+			_, err := time.ParseDuration(s)
+			return err
+		})
+	return v
+}
+
+func registerStringVar(name string, defaultValue string, description string) env.StringVar {
+	v := env.RegisterStringVar(name, defaultValue, description)
+	addFlag(name, "string", defaultValue, description, false,
+		v.Get,
+		func(string) error { return nil })
+	return v
+}
+
+// Flags returns the feature flags of Pilot with their current values, sorted by name.
+func Flags() []Flag {
+	flagsMutex.Lock()
+	defer flagsMutex.Unlock()
+	out := make([]Flag, 0, len(flags))
+	for _, f := range flags {
+		current := f.Flag
+		current.Value = f.value()
+		out = append(out, current)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// SetFlag sets the value of a mutable flag at runtime, or resets it to its default value if the value is empty.
+func SetFlag(name, value string) error {
+	flagsMutex.Lock()
+	defer flagsMutex.Unlock()
+	f, ok := flags[name]
+	if !ok {
+		return fmt.Errorf("unknown flag %q", name)
+	}
+	if !f.Mutable {
+		return fmt.Errorf("flag %s cannot be set at runtime, as it is only read at startup", name)
+	}
+	if value == "" {
+		return os.Unsetenv(name)
+	}
+	if err := f.parse(value); err != nil {
+		return fmt.Errorf("invalid %s value %q of flag %s: %v", f.Type, value, name, err)
+	}
+	return os.Setenv(name, value)
+}
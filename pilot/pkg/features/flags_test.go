@@ -0,0 +1,64 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package features
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFlags(t *testing.T) {
+	found := map[string]Flag{}
+	for _, f := range Flags() {
+		found[f.Name] = f
+	}
+	redis, ok := found["PILOT_ENABLE_REDIS_FILTER"]
+	if !ok {
+		t.Fatal("PILOT_ENABLE_REDIS_FILTER not found")
+	}
+	if redis.Type != "bool" || redis.Default != "false" || !redis.Mutable || redis.Description == "" {
+		t.Errorf("got flag %+v", redis)
+	}
+	if ttl := found["PILOT_DISTRIBUTION_HISTORY_RETENTION"]; ttl.Type != "duration" || ttl.Mutable {
+		t.Errorf("got flag %+v", ttl)
+	}
+}
+
+func TestSetFlag(t *testing.T) {
+	defer os.Unsetenv("PILOT_ENABLE_REDIS_FILTER")
+
+	if err := SetFlag("PILOT_ENABLE_REDIS_FILTER", "true"); err != nil {
+		t.Fatal(err)
+	}
+	if !EnableRedisFilter.Get() {
+		t.Error("PILOT_ENABLE_REDIS_FILTER not set")
+	}
+	if err := SetFlag("PILOT_ENABLE_REDIS_FILTER", ""); err != nil {
+		t.Fatal(err)
+	}
+	if EnableRedisFilter.Get() {
+		t.Error("PILOT_ENABLE_REDIS_FILTER not reset")
+	}
+
+	for name, value := range map[string]string{
+		"PILOT_ENABLE_REDIS_FILTER": "maybe",
+		"PILOT_DEBOUNCE_AFTER":      "1s",
+		"PILOT_UNKNOWN":             "true",
+	} {
+		if err := SetFlag(name, value); err == nil {
+			t.Errorf("SetFlag(%s, %s) got no error", name, value)
+		}
+	}
+}
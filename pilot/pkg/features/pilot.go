@@ -19,30 +19,28 @@ import (
 
 	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/duration"
-
-	"istio.io/pkg/env"
 )
 
 var (
 	// CertDir is the default location for mTLS certificates used by pilot.
 	// Defaults to /etc/certs, matching k8s template. Can be used if you run pilot
 	// as a regular user on a VM or test environment.
-	CertDir = env.RegisterStringVar("PILOT_CERT_DIR", "", "").Get()
+	CertDir = registerStringVar("PILOT_CERT_DIR", "", "").Get()
 
-	MaxConcurrentStreams = env.RegisterIntVar(
+	MaxConcurrentStreams = registerIntVar(
 		"ISTIO_GPRC_MAXSTREAMS",
 		100000,
 		"Sets the maximum number of concurrent grpc streams.",
 	).Get()
 
-	TraceSampling = env.RegisterFloatVar(
+	TraceSampling = registerFloatVar(
 		"PILOT_TRACE_SAMPLING",
 		100.0,
 		"Sets the mesh-wide trace sampling percentage. Should be 0.0 - 100.0. Precision to 0.01. "+
 			"Default is 100, not recommended for production use.",
 	).Get()
 
-	PushThrottle = env.RegisterIntVar(
+	PushThrottle = registerIntVar(
 		"PILOT_PUSH_THROTTLE",
 		100,
 		"Limits the number of concurrent pushes allowed. On larger machines this can be increased for faster pushes",
@@ -51,9 +49,9 @@ var (
 	// DebugConfigs controls saving snapshots of configs for /debug/adsz.
 	// Defaults to false, can be enabled with PILOT_DEBUG_ADSZ_CONFIG=1
 	// For larger clusters it can increase memory use and GC - useful for small tests.
-	DebugConfigs = env.RegisterBoolVar("PILOT_DEBUG_ADSZ_CONFIG", false, "").Get()
+	DebugConfigs = registerBoolVar("PILOT_DEBUG_ADSZ_CONFIG", false, "").Get()
 
-	DebounceAfter = env.RegisterDurationVar(
+	DebounceAfter = registerDurationVar(
 		"PILOT_DEBOUNCE_AFTER",
 		100*time.Millisecond,
 		"The delay added to config/registry events for debouncing. This will delay the push by "+
@@ -61,14 +59,32 @@ var (
 			" otherwise we'll keep delaying until things settle, up to a max of PILOT_DEBOUNCE_MAX.",
 	).Get()
 
-	DebounceMax = env.RegisterDurationVar(
+	DebounceMax = registerDurationVar(
 		"PILOT_DEBOUNCE_MAX",
 		10*time.Second,
 		"The maximum amount of time to wait for events while debouncing. If events keep showing up with no breaks "+
 			"for this time, we'll trigger a push.",
 	).Get()
 
-	EnableEDSDebounce = env.RegisterBoolVar(
+	DrainExemptionMaxAge = registerDurationVar(
+		"PILOT_DRAIN_EXEMPTION_MAX_AGE",
+		30*time.Minute,
+		"The maximum time the filter chains of the outbound listeners of the sidecar.istio.io/drainExemptPorts "+
+			"ports are kept as first pushed to the proxy. They are then replaced by the current ones, draining "+
+			"the listener once.",
+	).Get()
+
+	// DebounceAfterByKind overrides PILOT_DEBOUNCE_AFTER for some kinds of events.
+	DebounceAfterByKind = registerStringVar(
+		"PILOT_DEBOUNCE_AFTER_BY_KIND",
+		"",
+		"Comma separated list of <kind>=<duration>, e.g. endpoints=50ms,destination-rule=1s,gateway=2s, overriding "+
+			"PILOT_DEBOUNCE_AFTER for the events of these kinds. The kinds are the config types, and endpoints for "+
+			"the EDS updates. A push waits until the events of each kind it includes are quiet for the delay of the "+
+			"kind, up to a max of PILOT_DEBOUNCE_MAX.",
+	)
+
+	EnableEDSDebounce = registerBoolVar(
 		"PILOT_ENABLE_EDS_DEBOUNCE",
 		true,
 		"If enabled, Pilot will include EDS pushes in the push debouncing, configured by PILOT_DEBOUNCE_AFTER and PILOT_DEBOUNCE_MAX."+
@@ -84,13 +100,13 @@ var (
 	//
 	// Alpha in 1.1, may become the default or be turned into a Sidecar API or mesh setting. Only applies to namespaces
 	// where Sidecar is enabled.
-	HTTP10 = env.RegisterBoolVar(
+	HTTP10 = registerBoolVar(
 		"PILOT_HTTP10",
 		false,
 		"Enables the use of HTTP 1.0 in the outbound HTTP listeners, to support legacy applications.",
 	).Get()
 
-	initialFetchTimeoutVar = env.RegisterDurationVar(
+	initialFetchTimeoutVar = registerDurationVar(
 		"PILOT_INITIAL_FETCH_TIMEOUT",
 		0,
 		"Specifies the initial_fetch_timeout for config. If this time is reached without "+
@@ -105,7 +121,7 @@ var (
 		return ptypes.DurationProto(timeout)
 	}()
 
-	terminationDrainDurationVar = env.RegisterIntVar(
+	terminationDrainDurationVar = registerIntVar(
 		"TERMINATION_DRAIN_DURATION_SECONDS",
 		5,
 		"The amount of time allowed for connections to complete on pilot-agent shutdown. "+
@@ -117,7 +133,21 @@ var (
 		return time.Second * time.Duration(terminationDrainDurationVar.Get())
 	}
 
-	EnableFallthroughRoute = env.RegisterBoolVar(
+	terminationServeDurationVar = registerIntVar(
+		"TERMINATION_SERVE_DURATION_SECONDS",
+		0,
+		"The part of the TerminationDrainDuration during which pilot-agent keeps the active Envoy serving "+
+			"new connections, before telling it to start draining. Pilot removes the terminating pod from "+
+			"the endpoints right away, this gives the other proxies the time to receive the update instead "+
+			"of failing the connections to the draining pod. The injector sets it from the "+
+			"sidecar.istio.io/terminationServeDurationSeconds annotation or the "+
+			"global.proxy.terminationServeDurationSeconds value.",
+	)
+	TerminationServeDuration = func() time.Duration {
+		return time.Second * time.Duration(terminationServeDurationVar.Get())
+	}
+
+	EnableFallthroughRoute = registerMutableBoolVar(
 		"PILOT_ENABLE_FALLTHROUGH_ROUTE",
 		true,
 		"EnableFallthroughRoute provides an option to add a final wildcard match for routes. "+
@@ -126,7 +156,7 @@ var (
 	)
 
 	// DisableXDSMarshalingToAny provides an option to disable the "xDS marshaling to Any" feature ("on" by default).
-	DisableXDSMarshalingToAny = env.RegisterBoolVar(
+	DisableXDSMarshalingToAny = registerBoolVar(
 		"PILOT_DISABLE_XDS_MARSHALING_TO_ANY",
 		false,
 		"",
@@ -134,7 +164,7 @@ var (
 
 	// EnableMysqlFilter enables injection of `envoy.filters.network.mysql_proxy` in the filter chain.
 	// Pilot injects this outbound filter if the service port name is `mysql`.
-	EnableMysqlFilter = env.RegisterBoolVar(
+	EnableMysqlFilter = registerMutableBoolVar(
 		"PILOT_ENABLE_MYSQL_FILTER",
 		false,
 		"EnableMysqlFilter enables injection of `envoy.filters.network.mysql_proxy` in the filter chain.",
@@ -142,7 +172,7 @@ var (
 
 	// EnableRedisFilter enables injection of `envoy.filters.network.redis_proxy` in the filter chain.
 	// Pilot injects this outbound filter if the service port name is `redis`.
-	EnableRedisFilter = env.RegisterBoolVar(
+	EnableRedisFilter = registerMutableBoolVar(
 		"PILOT_ENABLE_REDIS_FILTER",
 		false,
 		"EnableRedisFilter enables injection of `envoy.filters.network.redis_proxy` in the filter chain.",
@@ -150,7 +180,7 @@ var (
 
 	// UseRemoteAddress sets useRemoteAddress to true for side car outbound listeners so that it picks up the localhost
 	// address of the sender, which is an internal address, so that trusted headers are not sanitized.
-	UseRemoteAddress = env.RegisterBoolVar(
+	UseRemoteAddress = registerMutableBoolVar(
 		"PILOT_SIDECAR_USE_REMOTE_ADDRESS",
 		false,
 		"UseRemoteAddress sets useRemoteAddress to true for side car outbound listeners.",
@@ -159,19 +189,79 @@ var (
 	// UseIstioJWTFilter enables to use Istio JWT filter as a fall back. Pilot injects the Istio JWT
 	// filter to the filter chains if this is set to true.
 	// TODO(yangminzhu): Remove after fully migrate to Envoy JWT filter.
-	UseIstioJWTFilter = env.RegisterBoolVar(
+	UseIstioJWTFilter = registerBoolVar(
 		"USE_ISTIO_JWT_FILTER",
 		false,
 		"Use the Istio JWT filter for JWT token verification.")
 
 	// SkipValidateTrustDomain tells the server proxy to not to check the peer's trust domain when
 	// mTLS is enabled in authentication policy.
-	SkipValidateTrustDomain = env.RegisterBoolVar(
+	SkipValidateTrustDomain = registerBoolVar(
 		"PILOT_SKIP_VALIDATE_TRUST_DOMAIN",
 		false,
 		"Skip validating the peer is from the same trust domain when mTLS is enabled in authentication policy")
 
-	RestrictPodIPTrafficLoops = env.RegisterBoolVar(
+	// DenyByDefaultNamespaces lists the namespaces whose workloads deny inbound traffic without authorization policy.
+	DenyByDefaultNamespaces = registerStringVar(
+		"PILOT_DENY_BY_DEFAULT_NAMESPACES",
+		"",
+		"Comma separated list of namespaces, or '*' for all namespaces, where Pilot generates a deny-all RBAC "+
+			"filter on the inbound listeners of the workloads without authorization policy. Requests denied this way "+
+			"are counted in the Envoy rbac.shadow_denied (HTTP) and tcp.default_deny.rbac.denied (TCP) stats.",
+	)
+
+	// EnableWeightRamp enables the ramps of the route weights of the virtual services.
+	EnableWeightRamp = registerBoolVar(
+		"PILOT_ENABLE_WEIGHT_RAMP",
+		false,
+		"If enabled, Pilot ramps the weights of the HTTP routes of the virtual services with the "+
+			"networking.istio.io/rampDuration annotation over the duration when they change, pushing the "+
+			"intermediate weights every PILOT_WEIGHT_RAMP_INTERVAL.",
+	).Get()
+
+	// WeightRampInterval is the interval of the pushes of the ramped route weights.
+	WeightRampInterval = registerDurationVar(
+		"PILOT_WEIGHT_RAMP_INTERVAL",
+		10*time.Second,
+		"The interval of the pushes of the intermediate route weights of the ramps.",
+	).Get()
+
+	// WeightRampPrometheusAddress is the address of the Prometheus server reporting the error rates of the ramps.
+	WeightRampPrometheusAddress = registerStringVar(
+		"PILOT_WEIGHT_RAMP_PROMETHEUS_ADDRESS",
+		"",
+		"The address of the Prometheus server, e.g. http://prometheus.istio-system:9090, queried for the ratio of "+
+			"the requests to the destinations of the ramped virtual services failing with a 5xx, which pauses or "+
+			"aborts the ramps as set by the networking.istio.io/rampPauseErrorRate and rampAbortErrorRate "+
+			"annotations. The error rate annotations are ignored if it is not set.",
+	).Get()
+
+	// DebugProxyIdentities lists the identities allowed to connect the debug proxies.
+	DebugProxyIdentities = registerStringVar(
+		"PILOT_DEBUG_PROXY_IDENTITIES",
+		"",
+		"Comma separated list of the identities, e.g. spiffe://cluster.local/ns/istio-system/sa/mesh-inspector, of the "+
+			"client certificates allowed to connect debug proxies, which set the DEBUG_PROXY metadata and receive the "+
+			"unscoped config of the whole mesh. The debug proxies are rejected if empty.",
+	)
+
+	// JwtClaimToHeaders lists the JWT claims copied into request headers once the JWT is verified.
+	JwtClaimToHeaders = registerStringVar(
+		"PILOT_JWT_CLAIM_TO_HEADERS",
+		"",
+		"Comma separated list of JWT claims the sidecars copy into upstream request headers after the token "+
+			"has been verified. Nested claims are separated with dots, e.g. 'sub,org.team'. Requires the Envoy JWT filter.",
+	)
+
+	// JwtClaimHeaderPrefix is the prefix of the headers the JWT claims listed in JwtClaimToHeaders are copied to.
+	JwtClaimHeaderPrefix = registerStringVar(
+		"PILOT_JWT_CLAIM_HEADER_PREFIX",
+		"x-jwt-claim-",
+		"Prefix of the request headers JWT claims are copied to. The claim 'org.team' is copied to the "+
+			"header '<prefix>org-team'. Headers with these names set by the downstream are removed.",
+	)
+
+	RestrictPodIPTrafficLoops = registerMutableBoolVar(
 		"PILOT_RESTRICT_POD_UP_TRAFFIC_LOOP",
 		true,
 		"If enabled, this will block inbound traffic from matching outbound listeners, which "+
@@ -179,46 +269,46 @@ var (
 			"and will be removed in the near future.",
 	)
 
-	EnableProtocolSniffingForOutbound = env.RegisterBoolVar(
+	EnableProtocolSniffingForOutbound = registerMutableBoolVar(
 		"PILOT_ENABLE_PROTOCOL_SNIFFING_FOR_OUTBOUND",
 		true,
 		"If enabled, protocol sniffing will be used for outbound listeners whose port protocol is not specified or unsupported",
 	)
 
-	EnableProtocolSniffingForInbound = env.RegisterBoolVar(
+	EnableProtocolSniffingForInbound = registerMutableBoolVar(
 		"PILOT_ENABLE_PROTOCOL_SNIFFING_FOR_INBOUND",
 		false,
 		"If enabled, protocol sniffing will be used for inbound listeners whose port protocol is not specified or unsupported",
 	)
 
-	ScopePushes = env.RegisterBoolVar(
+	ScopePushes = registerBoolVar(
 		"PILOT_SCOPE_PUSHES",
 		true,
 		"If enabled, pilot will attempt to limit unnecessary pushes by determining what proxies "+
 			"a config or endpoint update will impact.",
 	)
 
-	ScopeGatewayToNamespace = env.RegisterBoolVar(
+	ScopeGatewayToNamespace = registerBoolVar(
 		"PILOT_SCOPE_GATEWAY_TO_NAMESPACE",
 		false,
 		"If enabled, a gateway workload can only select gateway resources in the same namespace. "+
 			"Gateways with same selectors in different namespaces will not be applicable.",
 	)
 
-	RespectDNSTTL = env.RegisterBoolVar(
+	RespectDNSTTL = registerMutableBoolVar(
 		"PILOT_RESPECT_DNS_TTL",
 		true,
 		"If enabled, DNS based clusters will respect the TTL of the DNS, rather than polling at a fixed rate. "+
 			"This option is only provided for backward compatibility purposes and will be removed in the near future.",
 	)
 
-	InboundProtocolDetectionTimeout = env.RegisterDurationVar(
+	InboundProtocolDetectionTimeout = registerDurationVar(
 		"PILOT_INBOUND_PROTOCOL_DETECTION_TIMEOUT",
 		1*time.Second,
 		"Protocol detection timeout for inbound listener",
 	).Get()
 
-	EnableHeadlessService = env.RegisterBoolVar(
+	EnableHeadlessService = registerMutableBoolVar(
 		"PILOT_ENABLE_HEADLESS_SERVICE_POD_LISTENERS",
 		true,
 		"If enabled, for a headless service/stateful set in Kubernetes, pilot will generate an "+
@@ -226,27 +316,320 @@ var (
 			"if headless services have a large number of pods.",
 	)
 
-	BlockHTTPonHTTPSPort = env.RegisterBoolVar(
+	BlockHTTPonHTTPSPort = registerBoolVar(
 		"PILOT_BLOCK_HTTP_ON_443",
 		true,
 		"If enabled, any HTTP services will be blocked on HTTPS port (443). If this is disabled, any "+
 			"HTTP service on port 443 could block all external traffic",
 	).Get()
 
-	EnableDistributionTracking = env.RegisterBoolVar(
+	EnableDistributionTracking = registerBoolVar(
 		"PILOT_ENABLE_CONFIG_DISTRIBUTION_TRACKING",
 		true,
 		"If enabled, Pilot will assign meaningful nonces to each Envoy configuration message, and allow "+
 			"users to interrogate which envoy has which config from the debug interface.",
 	).Get()
 
-	DistributionHistoryRetention = env.RegisterDurationVar(
+	DistributionHistoryRetention = registerDurationVar(
 		"PILOT_DISTRIBUTION_HISTORY_RETENTION",
 		time.Minute*1,
 		"If enabled, Pilot will keep track of old versions of distributed config for this duration.",
 	).Get()
 
-	EnableUnsafeRegex = env.RegisterBoolVar(
+	MaxResourceNameLength = registerIntVar(
+		"PILOT_MAX_RESOURCE_NAME_LENGTH",
+		0,
+		"If set, the stat names of the generated clusters longer than this number of characters are truncated, "+
+			"with a hash suffix keeping them unique, and their invalid characters are replaced. The cluster names "+
+			"are left unchanged. The cluster names of the truncated stat names can be looked up in "+
+			"/debug/resource_namez. Set to 0 to disable the normalization.",
+	).Get()
+
+	MaxRetriesRatio = registerFloatVar(
+		"PILOT_MAX_RETRIES_RATIO",
+		0,
+		"If set, caps the maximum number of parallel retries of each cluster to this ratio of its maximum number "+
+			"of parallel requests, with a minimum of 3, protecting the backends from retry storms when many "+
+			"VirtualServices configure aggressive retries. Set to 0 to disable the cap.",
+	).Get()
+
+	ConfigSizeWarningThreshold = registerIntVar(
+		"PILOT_CONFIG_SIZE_WARNING_BYTES",
+		10*1024*1024,
+		"If the total serialized size of the xDS configuration sent to a single proxy grows above this number "+
+			"of bytes, Pilot will log a warning. Sizes per proxy can be inspected in /debug/config_sizez. "+
+			"Set to 0 to disable the warning.",
+	).Get()
+
+	EnableMixerlessQuota = registerBoolVar(
+		"PILOT_ENABLE_MIXERLESS_QUOTA",
+		false,
+		"If enabled, and Mixer is not configured in the mesh, Pilot will translate QuotaSpecs annotated with "+
+			"policy.istio.io/localRateLimit into Envoy local rate limit filters on inbound HTTP listeners, for the "+
+			"proxies of Istio 1.8 or later whose Envoy has the filter, and the ones annotated with "+
+			"policy.istio.io/requiredHeaders into RBAC filters denying the requests without the headers, "+
+			"so basic quota enforcement is kept while migrating away from Mixer.",
+	).Get()
+
+	TelemetryTLSModeAttribution = registerBoolVar(
+		"PILOT_TELEMETRY_TLS_MODE_ATTRIBUTION",
+		false,
+		"If enabled, Pilot labels the metrics of the 'opentelemetry' telemetry exporter with the TLS mode "+
+			"of the connection: 'auto' for auto mTLS, 'user' for TLS configured in a DestinationRule, and "+
+			"'plaintext'. This measures the residual plaintext traffic of permissive workloads before moving to STRICT.",
+	).Get()
+
+	EnableDestinationRuleInheritance = registerBoolVar(
+		"PILOT_ENABLE_DESTINATION_RULE_INHERITANCE",
+		false,
+		"If enabled, the DestinationRules of host '*' act as defaults: the one in the config root namespace "+
+			"for the whole mesh, and the one in a namespace for the proxies of that namespace. Their traffic "+
+			"policies are merged under the ones of the host specific DestinationRules, field by field.",
+	).Get()
+
+	SelfSignedDNSNames = registerStringVar(
+		"PILOT_SELF_SIGNED_DNS_NAMES",
+		"",
+		"Comma separated DNS names, such as istio-pilot.istio-system.svc, Pilot provisions and rotates a serving "+
+			"certificate for, signed by a self-signed root CA stored in a secret of its namespace. The certificate "+
+			"is served by the https server of --httpsAddr, while the secure xDS server keeps the SPIFFE certificate, "+
+			"and the root certificates are patched in the caBundle of the "+
+			"PILOT_SELF_SIGNED_MUTATING_WEBHOOKS and PILOT_SELF_SIGNED_VALIDATING_WEBHOOKS webhook configurations.",
+	).Get()
+
+	SelfSignedMutatingWebhooks = registerStringVar(
+		"PILOT_SELF_SIGNED_MUTATING_WEBHOOKS",
+		"",
+		"Comma separated names of the mutating webhook configurations the caBundle of is kept in sync with "+
+			"the self-signed root CA.",
+	).Get()
+
+	SelfSignedValidatingWebhooks = registerStringVar(
+		"PILOT_SELF_SIGNED_VALIDATING_WEBHOOKS",
+		"",
+		"Comma separated names of the validating webhook configurations the caBundle of is kept in sync with "+
+			"the self-signed root CA.",
+	).Get()
+
+	SelfSignedCertTTL = registerDurationVar(
+		"PILOT_SELF_SIGNED_CERT_TTL",
+		30*24*time.Hour,
+		"The lifetime of the self-signed serving certificate, rotated in the second half of its lifetime.",
+	).Get()
+
+	SelfSignedRootTTL = registerDurationVar(
+		"PILOT_SELF_SIGNED_ROOT_TTL",
+		365*24*time.Hour,
+		"The lifetime of the self-signed root CA, rotated in the second half of its lifetime. "+
+			"The previous root stays trusted until it expires.",
+	).Get()
+
+	EnableGatewayAPI = registerBoolVar(
+		"PILOT_ENABLE_GATEWAY_API",
+		false,
+		"If enabled, the Kubernetes Gateway API resources (networking.x-k8s.io) of the gateway classes of the "+
+			"istio.io/gateway-controller controller are converted to gateways and virtual services. "+
+			"The Gateway API CRDs must be installed.",
+	).Get()
+
+	EnableSMITrafficSplit = registerBoolVar(
+		"PILOT_ENABLE_SMI_TRAFFIC_SPLIT",
+		false,
+		"If enabled, the SMI TrafficSplit resources (split.smi-spec.io/v1alpha2) are converted to virtual services "+
+			"splitting the traffic to their root service across their backends. The TrafficSplit CRD must be installed.",
+	).Get()
+
+	EnableTrustBundleResources = registerBoolVar(
+		"PILOT_ENABLE_TRUST_BUNDLE_RESOURCES",
+		false,
+		"If enabled, the roots of the TrustBundle resources (security.istio.io/v1alpha1) of the Istio namespace are "+
+			"trusted by the workloads in addition to the mesh root, with the trust bundles of the --trustBundles file.",
+	).Get()
+
+	EnableCrossNamespaceGatewaySecrets = registerBoolVar(
+		"PILOT_ENABLE_CROSS_NAMESPACE_GATEWAY_SECRETS",
+		false,
+		"If enabled, Pilot watches the secrets granting the gateways of other namespaces the access with the "+
+			"networking.istio.io/gatewayNamespaces annotation, and the gateway servers may reference them with a "+
+			"credentialName of the form <namespace>/<name>. The servers referencing secrets not granting the "+
+			"access are ignored, and reported in the push status.",
+	).Get()
+
+	EnableNamespaceOnboarding = registerBoolVar(
+		"PILOT_ENABLE_NAMESPACE_ONBOARDING",
+		false,
+		"If enabled, the leader Pilot stamps the default configs of the namespaces selected by "+
+			"PILOT_ONBOARDING_NAMESPACE_SELECTOR: a default Sidecar only allowing the services of the namespace, "+
+			"of the control plane and of the shared namespaces, and the optional default deny policy and template.",
+	).Get()
+
+	OnboardingNamespaceSelector = registerStringVar(
+		"PILOT_ONBOARDING_NAMESPACE_SELECTOR",
+		"istio-injection=enabled",
+		"The label selector of the namespaces onboarded in the mesh.",
+	).Get()
+
+	OnboardingSharedNamespaces = registerStringVar(
+		"PILOT_ONBOARDING_SHARED_NAMESPACES",
+		"",
+		"Comma separated namespaces the services of are visible to the onboarded namespaces.",
+	).Get()
+
+	OnboardingDefaultDeny = registerBoolVar(
+		"PILOT_ONBOARDING_DEFAULT_DENY",
+		false,
+		"If enabled, the onboarded namespaces get an authorization policy denying the requests no other policy allows.",
+	).Get()
+
+	OnboardingTemplate = registerStringVar(
+		"PILOT_ONBOARDING_TEMPLATE",
+		"",
+		"The path of a YAML file of configs stamped in the onboarded namespaces, such as the telemetry settings.",
+	).Get()
+
+	EnableStrictEndpointMTLS = registerBoolVar(
+		"PILOT_ENABLE_STRICT_ENDPOINT_MTLS",
+		false,
+		"If enabled, the outbound clusters without TLS settings, e.g. when auto mTLS is disabled, use Istio mTLS "+
+			"to the endpoints advertising the strict TLS mode with the security.istio.io/tlsMode annotation, "+
+			"and plaintext to the other endpoints.",
+	).Get()
+
+	// WeightedRoutingHashHeader is the request header hashed to pick the destinations of weighted routes.
+	WeightedRoutingHashHeader = registerStringVar(
+		"PILOT_WEIGHTED_ROUTING_HASH_HEADER",
+		"",
+		"If set, the requests with this header, e.g. a user ID, are routed to the destinations of weighted "+
+			"routes according to a hash of the header value instead of randomly, so the same user always "+
+			"reaches the same version. The requests without the header are still routed randomly.",
+	)
+
+	// MaxADSConnections limits the ADS connections of a Pilot instance.
+	MaxADSConnections = registerIntVar(
+		"PILOT_MAX_ADS_CONNECTIONS",
+		0,
+		"If positive, the maximum number of ADS connections of a Pilot instance. The new connections are "+
+			"rejected beyond this limit, and the proxies retry with another instance.",
+	)
+
+	// MaxADSConnectionsPerNamespace limits the ADS connections of the proxies of a namespace.
+	MaxADSConnectionsPerNamespace = registerIntVar(
+		"PILOT_MAX_ADS_CONNECTIONS_PER_NAMESPACE",
+		0,
+		"If positive, the maximum number of ADS connections of the proxies of a namespace to a Pilot instance, "+
+			"so a namespace cannot take all the connections.",
+	)
+
+	// MaxADSConnectionsPerServiceAccount limits the ADS connections of the proxies of a service account.
+	MaxADSConnectionsPerServiceAccount = registerIntVar(
+		"PILOT_MAX_ADS_CONNECTIONS_PER_SERVICE_ACCOUNT",
+		0,
+		"If positive, the maximum number of ADS connections of the proxies of a service account to a Pilot "+
+			"instance, so a deployment scaling out of control cannot take all the connections.",
+	)
+
+	// DisabledConfigKinds lists the config kinds Pilot does not watch.
+	DisabledConfigKinds = registerStringVar(
+		"PILOT_DISABLED_CONFIG_KINDS",
+		"",
+		"Comma separated list of the config kinds, e.g. service-role,service-role-binding,envoy-filter, "+
+			"that Pilot does not watch. No informer, index or event handler is created for these kinds, "+
+			"reducing the memory of meshes not using them. The disabled kinds are treated as having no configs.",
+	)
+
+	// InboundFilterChainsPerService generates the inbound filter chains of all the services sharing a port of a
+	// workload, instead of only the first one.
+	InboundFilterChainsPerService = registerMutableBoolVar(
+		"PILOT_INBOUND_FILTER_CHAINS_PER_SERVICE",
+		false,
+		"If enabled, the inbound listener of a port shared by multiple services of a workload has the mTLS filter "+
+			"chains of each service, matched by the SNI of the clients of the service, so that the authentication, "+
+			"authorization and destination rules of the service apply. The other connections use the first service.",
+	)
+
+	// GatewayOnly configures Pilot as a manager of gateways, e.g. ingress gateways without sidecars in the mesh.
+	GatewayOnly = registerBoolVar(
+		"PILOT_GATEWAY_ONLY",
+		false,
+		"If enabled, Pilot serves only gateways and rejects the connections of sidecars. The gateways only get the "+
+			"clusters of the destinations of their virtual services, unless they are in sni-dnat mode.",
+	)
+
+	// TrustDomainCABundles maps the trust domains of the destinations to the root certificates used to
+	// validate them, e.g. for the meshes federated with partner meshes having distinct roots.
+	TrustDomainCABundles = registerStringVar(
+		"PILOT_TRUST_DOMAIN_CA_BUNDLES",
+		"",
+		"Comma separated list of trust domain=root certificate file pairs, e.g. "+
+			"'partner.example.com=/etc/certs/partner/root-cert.pem'. The sidecars validate the certificates of the "+
+			"ISTIO_MUTUAL destinations of these trust domains with the given root instead of the mesh root. "+
+			"The files are read by Pilot, which sends the roots inline to the sidecars.",
+	)
+
+	// EnableXDSConsistencyCheck verifies the generated configs, to find the bugs of the generation before the
+	// proxies reject the configs.
+	EnableXDSConsistencyCheck = registerBoolVar(
+		"PILOT_ENABLE_XDS_CONSISTENCY_CHECK",
+		false,
+		"If enabled, Pilot checks the invariants of the generated clusters and routes, e.g. that the EDS clusters "+
+			"have an EDS config and that the weights of the weighted clusters sum to their total weight, and logs "+
+			"the violations and records them in pilot_xds_consistency_violations.",
+	)
+
+	// DrainDuration is the window over which Pilot closes the ADS connections of the proxies when terminated.
+	DrainDuration = registerDurationVar(
+		"PILOT_DRAIN_DURATION",
+		0,
+		"If set, on SIGTERM Pilot refuses the new ADS connections and closes the existing ones at random times "+
+			"over this duration before shutting down, so that the proxies reconnect to the other replicas "+
+			"progressively instead of all at once. It should be shorter than the termination grace period.",
+	).Get()
+
+	// EnableEnvoyFilterAttribution records the EnvoyFilters that patched the filter chains in their metadata.
+	EnableEnvoyFilterAttribution = registerBoolVar(
+		"PILOT_ENABLE_ENVOY_FILTER_ATTRIBUTION",
+		false,
+		"If enabled, the filter chains patched by EnvoyFilters, or whose filters were patched by EnvoyFilters, list "+
+			"the namespace/name of these EnvoyFilters in the envoyfilters field of their istio metadata, visible in "+
+			"the config dumps of the proxies. /debug/config_usagez attributes the EnvoyFilters regardless of it.",
+	).Get()
+
+	// RegistryFailureThreshold is the number of consecutive failures opening the circuit of a service registry.
+	RegistryFailureThreshold = registerIntVar(
+		"PILOT_REGISTRY_FAILURE_THRESHOLD",
+		3,
+		"The number of consecutive failures of a service registry, e.g. a remote cluster or Consul, after which "+
+			"the aggregate registry stops calling it for PILOT_REGISTRY_CIRCUIT_OPEN_DURATION and serves its last "+
+			"services instead. 0 disables the circuit breaking.",
+	).Get()
+
+	// RegistryCircuitOpenDuration is the time a failing service registry is not called.
+	RegistryCircuitOpenDuration = registerDurationVar(
+		"PILOT_REGISTRY_CIRCUIT_OPEN_DURATION",
+		30*time.Second,
+		"The time the aggregate registry stops calling a service registry after PILOT_REGISTRY_FAILURE_THRESHOLD "+
+			"consecutive failures, before trying it again.",
+	).Get()
+
+	// EnableOutboundClusterCache enables the reuse of the outbound clusters of a service across the proxies
+	// within a push.
+	EnableOutboundClusterCache = registerBoolVar(
+		"PILOT_ENABLE_OUTBOUND_CLUSTER_CACHE",
+		true,
+		"If enabled, the outbound clusters of a service are built once per push for the proxies with the same "+
+			"destination rule, type, version, TLS client certificates and network view, and copied for the others.",
+	).Get()
+
+	// NetworkGatewayNamespace is the namespace of the services that are the gateways of their network.
+	NetworkGatewayNamespace = registerStringVar(
+		"PILOT_NETWORK_GATEWAY_NAMESPACE",
+		"",
+		"The namespace of the services labeled with topology.istio.io/network that are the gateways of their "+
+			"network. The labels of the services of the other namespaces are ignored. Defaults to the namespace "+
+			"of Pilot.",
+	).Get()
+
+	EnableUnsafeRegex = registerMutableBoolVar(
 		"PILOT_ENABLE_UNSAFE_REGEX",
 		false,
 		"If enabled, pilot will generate Envoy configuration that does not use safe_regex "+
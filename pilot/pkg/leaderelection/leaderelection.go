@@ -0,0 +1,187 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package leaderelection runs the controllers that must be singletons across the Pilot replicas, such as
+// status writers, on the replica holding the lease of their election only.
+package leaderelection
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"istio.io/pkg/env"
+	"istio.io/pkg/log"
+	"istio.io/pkg/monitoring"
+)
+
+var (
+	podNameVar = env.RegisterStringVar("POD_NAME", "", "")
+
+	leaseDurationVar = env.RegisterDurationVar(
+		"PILOT_LEADER_ELECTION_LEASE_DURATION",
+		4*time.Second,
+		"The duration of the leases of the elections of the singleton controllers, such as status writers. "+
+			"A replica takes over at most this duration after the leader stopped renewing its lease, "+
+			"and right away when the leader shuts down gracefully.",
+	)
+
+	electionTag = monitoring.MustCreateLabel("election")
+
+	leaderGauge = monitoring.NewGauge(
+		"pilot_leader_election_leader",
+		"Whether this Pilot instance is the leader of the election, 1 if it is, 0 otherwise.",
+		monitoring.WithLabels(electionTag),
+	)
+
+	leaderTransitions = monitoring.NewSum(
+		"pilot_leader_election_transitions",
+		"Total number of times this Pilot instance started leading the election.",
+		monitoring.WithLabels(electionTag),
+	)
+)
+
+func init() {
+	monitoring.MustRegister(leaderGauge, leaderTransitions)
+}
+
+// LeaderElection runs functions while the Pilot replica holds the lease of an election, stopping them
+// when the lease is lost, and runs for the election again until stopped.
+type LeaderElection struct {
+	namespace string
+	name      string
+	identity  string
+	client    kubernetes.Interface
+	runFns    []func(stop <-chan struct{})
+
+	leaseDuration time.Duration
+	renewDeadline time.Duration
+	retryPeriod   time.Duration
+
+	mu      sync.RWMutex
+	leading bool
+}
+
+// NewLeaderElection creates an election, whose lock is the config map of the name in the namespace.
+func NewLeaderElection(namespace, name string, client kubernetes.Interface) *LeaderElection {
+	identity := podNameVar.Get()
+	if identity == "" {
+		identity, _ = os.Hostname()
+	}
+	leaseDuration := leaseDurationVar.Get()
+	return &LeaderElection{
+		namespace:     namespace,
+		name:          name,
+		identity:      identity,
+		client:        client,
+		leaseDuration: leaseDuration,
+		renewDeadline: leaseDuration * 3 / 4,
+		retryPeriod:   leaseDuration / 8,
+	}
+}
+
+// AddRunFunction adds a function run when leading, until the stop channel is closed as the lease is lost.
+func (l *LeaderElection) AddRunFunction(f func(stop <-chan struct{})) *LeaderElection {
+	l.runFns = append(l.runFns, f)
+	return l
+}
+
+// IsLeader returns whether this replica is currently leading the election.
+func (l *LeaderElection) IsLeader() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.leading
+}
+
+// Run runs for the election until the stop channel is closed, releasing the lease if leading.
+func (l *LeaderElection) Run(stop <-chan struct{}) {
+	for {
+		le, err := l.create()
+		if err != nil {
+			log.Errorf("failed to create the leader election %s: %v", l.name, err)
+			return
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		// Returns once the lease is lost or released.
+		le.Run(ctx)
+		cancel()
+
+		select {
+		case <-stop:
+			return
+		default:
+			log.Infof("lost the lease of the leader election %s, running again", l.name)
+		}
+	}
+}
+
+func (l *LeaderElection) create() (*leaderelection.LeaderElector, error) {
+	lock := resourcelock.ConfigMapLock{
+		ConfigMapMeta: metav1.ObjectMeta{Namespace: l.namespace, Name: l.name},
+		Client:        l.client.CoreV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: l.identity,
+		},
+	}
+	return leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          &lock,
+		LeaseDuration: l.leaseDuration,
+		RenewDeadline: l.renewDeadline,
+		RetryPeriod:   l.retryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				log.Infof("leading the election %s as %s", l.name, l.identity)
+				l.setLeading(true)
+				leaderTransitions.With(electionTag.Value(l.name)).Increment()
+				for _, f := range l.runFns {
+					go f(ctx.Done())
+				}
+			},
+			OnStoppedLeading: func() {
+				log.Infof("stopped leading the election %s", l.name)
+				l.setLeading(false)
+			},
+			OnNewLeader: func(leader string) {
+				log.Infof("new leader of the election %s: %s", l.name, leader)
+			},
+		},
+		// Release the lease on shutdown, for another replica to take over right away.
+		ReleaseOnCancel: true,
+		Name:            l.name,
+	})
+}
+
+func (l *LeaderElection) setLeading(leading bool) {
+	l.mu.Lock()
+	l.leading = leading
+	l.mu.Unlock()
+	value := 0.0
+	if leading {
+		value = 1
+	}
+	leaderGauge.With(electionTag.Value(l.name)).Record(value)
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leaderelection
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func createElection(t *testing.T, identity string, client kubernetes.Interface) (*LeaderElection, chan struct{}, chan struct{}) {
+	t.Helper()
+	l := NewLeaderElection("istio-system", "test-election", client)
+	l.identity = identity
+	running := make(chan struct{}, 10)
+	l.AddRunFunction(func(stop <-chan struct{}) {
+		running <- struct{}{}
+		<-stop
+	})
+	stop := make(chan struct{})
+	go l.Run(stop)
+	return l, running, stop
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestLeaderElection(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	first, firstRunning, firstStop := createElection(t, "pilot-1", client)
+	waitFor(t, "pilot-1 to lead", first.IsLeader)
+	<-firstRunning
+
+	second, secondRunning, secondStop := createElection(t, "pilot-2", client)
+	defer close(secondStop)
+	time.Sleep(time.Second)
+	if second.IsLeader() {
+		t.Fatal("two leaders elected")
+	}
+
+	// The lease is released on shutdown, and taken over right away.
+	stopped := time.Now()
+	close(firstStop)
+	waitFor(t, "pilot-2 to lead", second.IsLeader)
+	if failover := time.Since(stopped); failover > 3*time.Second {
+		t.Errorf("took over after %v", failover)
+	}
+	select {
+	case <-secondRunning:
+	case <-time.After(time.Second):
+		t.Error("run function not called on the new leader")
+	}
+	waitFor(t, "pilot-1 to stop leading", func() bool { return !first.IsLeader() })
+}
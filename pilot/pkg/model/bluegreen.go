@@ -0,0 +1,74 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	networking "istio.io/api/networking/v1alpha3"
+)
+
+const (
+	// BlueGreenSubsetsAnnotation on a DestinationRule models a blue/green deployment of its host as two of its
+	// subsets, e.g. "blue,green". The clusters of both subsets are always generated, so the inactive one is
+	// warm, and the HTTP routes to the host without subset go to the subset of the ActiveSubsetAnnotation.
+	BlueGreenSubsetsAnnotation = "networking.istio.io/blueGreenSubsets"
+
+	// ActiveSubsetAnnotation on a DestinationRule with the BlueGreenSubsetsAnnotation is the subset receiving
+	// the traffic. Changing it flips all the routes to the host at once, in a single push.
+	ActiveSubsetAnnotation = "networking.istio.io/activeSubset"
+)
+
+// BlueGreen is the blue/green deployment of the host of a destination rule.
+type BlueGreen struct {
+	Active   string
+	Inactive string
+}
+
+// ParseBlueGreen returns the blue/green deployment set by the annotations of a destination rule, or nil if
+// there is none.
+func ParseBlueGreen(rule *Config) (*BlueGreen, error) {
+	subsets, ok := rule.Annotations[BlueGreenSubsetsAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	pair := strings.Split(subsets, ",")
+	if len(pair) != 2 || strings.TrimSpace(pair[0]) == strings.TrimSpace(pair[1]) {
+		return nil, fmt.Errorf("invalid %s %q: must be two distinct subsets", BlueGreenSubsetsAnnotation, subsets)
+	}
+
+	defined := make(map[string]bool)
+	if spec, ok := rule.Spec.(*networking.DestinationRule); ok {
+		for _, subset := range spec.Subsets {
+			defined[subset.Name] = true
+		}
+	}
+	for i := range pair {
+		pair[i] = strings.TrimSpace(pair[i])
+		if !defined[pair[i]] {
+			return nil, fmt.Errorf("invalid %s %q: subset %s is not defined", BlueGreenSubsetsAnnotation, subsets, pair[i])
+		}
+	}
+
+	switch active := rule.Annotations[ActiveSubsetAnnotation]; active {
+	case pair[0]:
+		return &BlueGreen{Active: pair[0], Inactive: pair[1]}, nil
+	case pair[1]:
+		return &BlueGreen{Active: pair[1], Inactive: pair[0]}, nil
+	default:
+		return nil, fmt.Errorf("invalid %s %q: must be one of %s", ActiveSubsetAnnotation, active, subsets)
+	}
+}
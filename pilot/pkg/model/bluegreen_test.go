@@ -0,0 +1,76 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"reflect"
+	"testing"
+
+	networking "istio.io/api/networking/v1alpha3"
+)
+
+func TestParseBlueGreen(t *testing.T) {
+	rule := func(annotations map[string]string) *Config {
+		return &Config{
+			ConfigMeta: ConfigMeta{Name: "reviews", Namespace: "default", Annotations: annotations},
+			Spec: &networking.DestinationRule{
+				Host:    "reviews",
+				Subsets: []*networking.Subset{{Name: "blue"}, {Name: "green"}},
+			},
+		}
+	}
+
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		expected    *BlueGreen
+		expectErr   bool
+	}{
+		{
+			name: "no blue/green deployment",
+		},
+		{
+			name:        "green active",
+			annotations: map[string]string{BlueGreenSubsetsAnnotation: "blue, green", ActiveSubsetAnnotation: "green"},
+			expected:    &BlueGreen{Active: "green", Inactive: "blue"},
+		},
+		{
+			name:        "single subset",
+			annotations: map[string]string{BlueGreenSubsetsAnnotation: "blue", ActiveSubsetAnnotation: "blue"},
+			expectErr:   true,
+		},
+		{
+			name:        "undefined subset",
+			annotations: map[string]string{BlueGreenSubsetsAnnotation: "blue,red", ActiveSubsetAnnotation: "blue"},
+			expectErr:   true,
+		},
+		{
+			name:        "active subset not in the pair",
+			annotations: map[string]string{BlueGreenSubsetsAnnotation: "blue,green"},
+			expectErr:   true,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBlueGreen(rule(tt.annotations))
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParseBlueGreen() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ParseBlueGreen() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
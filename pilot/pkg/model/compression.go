@@ -0,0 +1,93 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CompressionAnnotation set to "gzip" on a Gateway compresses the responses of its HTTP servers. On a
+	// plaintext port shared by several gateways, the compression of the first server of the port applies.
+	// The sidecar.istio.io/compression* annotations of a workload compress the responses of its inbound HTTP
+	// ports the same way.
+	CompressionAnnotation = "networking.istio.io/compression"
+
+	// CompressionContentTypesAnnotation is the comma separated list of the content types compressed, e.g.
+	// "application/json,text/html". The Envoy defaults, the common text types, apply if unset.
+	CompressionContentTypesAnnotation = "networking.istio.io/compressionContentTypes"
+
+	// CompressionMinLengthAnnotation is the minimum length, in bytes, of the responses compressed, 30 if unset.
+	CompressionMinLengthAnnotation = "networking.istio.io/compressionMinLength"
+
+	// CompressionLevelAnnotation is the compression level: best, speed or default.
+	CompressionLevelAnnotation = "networking.istio.io/compressionLevel"
+)
+
+// The compression levels.
+const (
+	CompressionLevelDefault = "default"
+	CompressionLevelBest    = "best"
+	CompressionLevelSpeed   = "speed"
+)
+
+// Compression is the compression of the HTTP responses.
+type Compression struct {
+	ContentTypes []string
+	MinLength    uint32
+	Level        string
+}
+
+// ParseCompression returns the compression set by the algorithm, content types, minimum length and level
+// settings, or nil if the algorithm is unset. Only gzip is supported by the proxy.
+func ParseCompression(algorithm, contentTypes, minLength, level string) (*Compression, error) {
+	switch strings.ToLower(strings.TrimSpace(algorithm)) {
+	case "":
+		return nil, nil
+	case "gzip":
+	default:
+		return nil, fmt.Errorf("unsupported compression %q: must be gzip", algorithm)
+	}
+
+	compression := &Compression{Level: CompressionLevelDefault}
+	for _, contentType := range strings.Split(contentTypes, ",") {
+		if contentType = strings.TrimSpace(contentType); contentType != "" {
+			compression.ContentTypes = append(compression.ContentTypes, contentType)
+		}
+	}
+	if minLength != "" {
+		length, err := strconv.ParseUint(strings.TrimSpace(minLength), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid compression minimum length %q: %v", minLength, err)
+		}
+		compression.MinLength = uint32(length)
+	}
+	switch l := strings.ToLower(strings.TrimSpace(level)); l {
+	case "", CompressionLevelDefault:
+	case CompressionLevelBest, CompressionLevelSpeed:
+		compression.Level = l
+	default:
+		return nil, fmt.Errorf("invalid compression level %q: must be best, speed or default", level)
+	}
+	return compression, nil
+}
+
+// ParseGatewayCompression returns the compression set by the annotations of a gateway, or nil if there is none.
+func ParseGatewayCompression(annotations map[string]string) (*Compression, error) {
+	return ParseCompression(annotations[CompressionAnnotation], annotations[CompressionContentTypesAnnotation],
+		annotations[CompressionMinLengthAnnotation], annotations[CompressionLevelAnnotation])
+}
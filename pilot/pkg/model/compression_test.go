@@ -0,0 +1,79 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGatewayCompression(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		expected    *Compression
+		expectErr   bool
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:        "defaults",
+			annotations: map[string]string{CompressionAnnotation: "gzip"},
+			expected:    &Compression{Level: CompressionLevelDefault},
+		},
+		{
+			name: "tuned",
+			annotations: map[string]string{
+				CompressionAnnotation:             "GZIP",
+				CompressionContentTypesAnnotation: "application/json, text/html",
+				CompressionMinLengthAnnotation:    "1024",
+				CompressionLevelAnnotation:        "Best",
+			},
+			expected: &Compression{
+				ContentTypes: []string{"application/json", "text/html"},
+				MinLength:    1024,
+				Level:        CompressionLevelBest,
+			},
+		},
+		{
+			name:        "unsupported algorithm",
+			annotations: map[string]string{CompressionAnnotation: "brotli"},
+			expectErr:   true,
+		},
+		{
+			name:        "invalid minimum length",
+			annotations: map[string]string{CompressionAnnotation: "gzip", CompressionMinLengthAnnotation: "-1"},
+			expectErr:   true,
+		},
+		{
+			name:        "invalid level",
+			annotations: map[string]string{CompressionAnnotation: "gzip", CompressionLevelAnnotation: "9"},
+			expectErr:   true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseGatewayCompression(tt.annotations)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParseGatewayCompression() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ParseGatewayCompression() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
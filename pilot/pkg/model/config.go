@@ -368,19 +368,23 @@ func (store *istioConfigStore) ServiceEntries() []Config {
 // sortConfigByCreationTime sorts the list of config objects in ascending order by their creation time (if available).
 func sortConfigByCreationTime(configs []Config) []Config {
 	sort.SliceStable(configs, func(i, j int) bool {
-		// If creation time is the same, then behavior is nondeterministic. In this case, we can
-		// pick an arbitrary but consistent ordering based on name and namespace, which is unique.
-		// CreationTimestamp is stored in seconds, so this is not uncommon.
-		if configs[i].CreationTimestamp == configs[j].CreationTimestamp {
-			in := configs[i].Name + "." + configs[i].Namespace
-			jn := configs[j].Name + "." + configs[j].Namespace
-			return in < jn
-		}
-		return configs[i].CreationTimestamp.Before(configs[j].CreationTimestamp)
+		return CreatedBefore(&configs[i].ConfigMeta, &configs[j].ConfigMeta)
 	})
 	return configs
 }
 
+// CreatedBefore returns whether a config was created before another, the order in which configs applying to the
+// same resource take precedence.
+func CreatedBefore(a, b *ConfigMeta) bool {
+	// If creation time is the same, then behavior is nondeterministic. In this case, we can
+	// pick an arbitrary but consistent ordering based on name and namespace, which is unique.
+	// CreationTimestamp is stored in seconds, so this is not uncommon.
+	if a.CreationTimestamp == b.CreationTimestamp {
+		return a.Name+"."+a.Namespace < b.Name+"."+b.Namespace
+	}
+	return a.CreationTimestamp.Before(b.CreationTimestamp)
+}
+
 func (store *istioConfigStore) Gateways(workloadLabels labels.Collection) []Config {
 	configs, err := store.List(schemas.Gateway.Type, NamespaceAll)
 	if err != nil {
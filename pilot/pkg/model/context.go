@@ -30,6 +30,7 @@ import (
 	meshconfig "istio.io/api/mesh/v1alpha1"
 
 	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/mesh"
 )
 
 // Environment provides an aggregate environmental API for Pilot
@@ -43,6 +44,9 @@ type Environment struct {
 	// Mesh is the mesh config (to be merged into the config store)
 	Mesh *meshconfig.MeshConfig
 
+	// MeshExtensions are the settings of the mesh config which are not MeshConfig fields, nil if there are none.
+	MeshExtensions *mesh.Extensions
+
 	// PushContext holds informations during push generation. It is reset on config change, at the beginning
 	// of the pushAll. It will hold all errors and stats and possibly caches needed during the entire cache computation.
 	// DO NOT USE EXCEPT FOR TESTS AND HANDLING OF NEW CONNECTIONS.
@@ -57,6 +61,18 @@ type Environment struct {
 	// routable L3 network. A single routable L3 network can have one or more
 	// service registries.
 	MeshNetworks *meshconfig.MeshNetworks
+
+	// TrustBundle provides the additional roots trusted by the workloads, nil if there are none.
+	TrustBundle TrustBundle
+
+	// WeightRamps ramps the route weights of the virtual services, nil if the weights are not ramped.
+	WeightRamps *WeightRamps
+
+	// SecretGrants authorizes the gateways to use the secrets of other namespaces, nil if they cannot.
+	SecretGrants SecretGrants
+
+	// ProtoDescriptors reads the proto descriptor sets of the gRPC JSON transcoders, nil if they cannot be read.
+	ProtoDescriptors ProtoDescriptors
 }
 
 // Proxy contains information about an specific instance of a proxy (envoy sidecar, gateway,
@@ -114,6 +130,10 @@ type Proxy struct {
 
 	// Istio version associated with the Proxy
 	IstioVersion *IstioVersion
+
+	// EnvoyFilterUsage records the EnvoyFilters that patched the resources generated for the proxy, nil if
+	// they are not recorded.
+	EnvoyFilterUsage *EnvoyFilterUsage
 }
 
 var (
@@ -259,15 +279,102 @@ type NodeMetadata struct {
 
 	IncludeInboundPorts string `json:"INCLUDE_INBOUND_PORTS,omitempty"`
 
+	// ExcludeOutboundPorts is a comma separated list of outbound ports for which traffic is not
+	// intercepted, as set by the traffic.sidecar.istio.io/excludeOutboundPorts annotation.
+	ExcludeOutboundPorts string `json:"traffic.sidecar.istio.io/excludeOutboundPorts,omitempty"`
+
+	// DrainExemptPorts is a comma separated list of outbound ports whose listeners keep their filter chains,
+	// and are therefore not drained, across the pushes for PILOT_DRAIN_EXEMPTION_MAX_AGE at most, as set by
+	// the sidecar.istio.io/drainExemptPorts annotation.
+	DrainExemptPorts string `json:"sidecar.istio.io/drainExemptPorts,omitempty"`
+
+	// InboundHTTP2MaxConcurrentStreams, InboundHTTP2InitialStreamWindowSize and
+	// InboundHTTP2InitialConnectionWindowSize tune the HTTP/2 settings of the inbound HTTP/2 and gRPC
+	// ports, as set by the sidecar.istio.io/inboundHTTP2* annotations. The Envoy defaults apply if unset.
+	InboundHTTP2MaxConcurrentStreams        string `json:"sidecar.istio.io/inboundHTTP2MaxConcurrentStreams,omitempty"`
+	InboundHTTP2InitialStreamWindowSize     string `json:"sidecar.istio.io/inboundHTTP2InitialStreamWindowSize,omitempty"`
+	InboundHTTP2InitialConnectionWindowSize string `json:"sidecar.istio.io/inboundHTTP2InitialConnectionWindowSize,omitempty"`
+
 	PolicyCheck                  string `json:"policy.istio.io/check,omitempty"`
 	PolicyCheckRetries           string `json:"policy.istio.io/checkRetries,omitempty"`
 	PolicyCheckBaseRetryWaitTime string `json:"policy.istio.io/checkBaseRetryWaitTime,omitempty"`
 	PolicyCheckMaxRetryWaitTime  string `json:"policy.istio.io/checkMaxRetryWaitTime,omitempty"`
 
+	// SecurityExemptPaths is a comma separated list of path prefixes exempted from JWT and RBAC
+	// enforcement on the inbound path, as set by the security.istio.io/exemptPaths annotation.
+	SecurityExemptPaths string `json:"security.istio.io/exemptPaths,omitempty"`
+
+	// ProxyConcurrency is the number of worker threads of the proxy, when bounded.
+	ProxyConcurrency string `json:"PROXY_CONCURRENCY,omitempty"`
+
 	StatsInclusionPrefixes string `json:"sidecar.istio.io/statsInclusionPrefixes,omitempty"`
 	StatsInclusionRegexps  string `json:"sidecar.istio.io/statsInclusionRegexps,omitempty"`
 	StatsInclusionSuffixes string `json:"sidecar.istio.io/statsInclusionSuffixes,omitempty"`
 
+	// InboundIdleTimeout is the idle timeout of the inbound connections of the sidecar, in duration format (5m),
+	// as set by the sidecar.istio.io/inboundIdleTimeout annotation, bounding the connections held open by the
+	// clients. The HTTP connections without active requests and the TCP connections without traffic are closed
+	// after it. It takes precedence over IdleTimeout on the inbound listeners.
+	InboundIdleTimeout string `json:"sidecar.istio.io/inboundIdleTimeout,omitempty"`
+
+	// MaxRequestHeadersKb is the maximum size, in KiB, of the request headers of the HTTP listeners of the proxy,
+	// between 1 and 96, as set by the sidecar.istio.io/maxRequestHeadersKb annotation, e.g. for gRPC services with
+	// large metadata. The requests with larger headers are rejected with a 431. The networking.istio.io/
+	// maxRequestHeadersKb annotation of a gateway takes precedence for its servers.
+	MaxRequestHeadersKb string `json:"sidecar.istio.io/maxRequestHeadersKb,omitempty"`
+
+	// OverloadMaxHeapSize is the heap size, in bytes, of the proxy monitored by the Envoy overload manager, as
+	// set by the sidecar.istio.io/overloadMaxHeapSize annotation. When the heap reaches
+	// OverloadShedHeapPercent of it, 95 by default, the proxy stops accepting requests instead of being killed
+	// for running out of memory.
+	OverloadMaxHeapSize     string `json:"sidecar.istio.io/overloadMaxHeapSize,omitempty"`
+	OverloadShedHeapPercent string `json:"sidecar.istio.io/overloadShedHeapPercent,omitempty"`
+
+	// MaxDownstreamConnections is the maximum number of active downstream connections of the proxy, as set by
+	// the sidecar.istio.io/maxDownstreamConnections annotation.
+	MaxDownstreamConnections string `json:"sidecar.istio.io/maxDownstreamConnections,omitempty"`
+
+	// TapSink enables the capture of the requests and responses of the inbound HTTP ports by the Envoy tap filter,
+	// as set by the sidecar.istio.io/tapSink annotation: file:<path prefix> writes a JSON file per request, under
+	// a writable volume mounted by the sidecar.istio.io/userVolumeMount annotation. TapMatch selects the
+	// requests, as a comma separated list of request header matches name=value or name=prefix*, e.g.
+	// ":path=/api/*". TapPercent is the percentage of the matching requests tapped, 1 by default, and
+	// TapMaxBufferedBytes bounds the body bytes captured per request and per response, up to 64KiB.
+	TapSink             string `json:"sidecar.istio.io/tapSink,omitempty"`
+	TapMatch            string `json:"sidecar.istio.io/tapMatch,omitempty"`
+	TapPercent          string `json:"sidecar.istio.io/tapPercent,omitempty"`
+	TapMaxBufferedBytes string `json:"sidecar.istio.io/tapMaxBufferedBytes,omitempty"`
+
+	// UserVolumeMount is the JSON map of the names of the volumes mounted in the sidecar to their mount settings,
+	// mountPath and readOnly, as set by the sidecar.istio.io/userVolumeMount annotation.
+	UserVolumeMount string `json:"sidecar.istio.io/userVolumeMount,omitempty"`
+
+	// Compression set to "gzip" compresses the responses of the inbound HTTP ports, as set by the
+	// sidecar.istio.io/compression annotation. The sidecar.istio.io/compressionContentTypes,
+	// compressionMinLength and compressionLevel annotations tune it like the networking.istio.io/compression*
+	// annotations of the gateways.
+	Compression             string `json:"sidecar.istio.io/compression,omitempty"`
+	CompressionContentTypes string `json:"sidecar.istio.io/compressionContentTypes,omitempty"`
+	CompressionMinLength    string `json:"sidecar.istio.io/compressionMinLength,omitempty"`
+	CompressionLevel        string `json:"sidecar.istio.io/compressionLevel,omitempty"`
+
+	// GRPCJSONTranscoderDescriptor transcodes the JSON requests of the inbound HTTP/2 and gRPC ports to the gRPC
+	// methods of the proto descriptor set of a ConfigMap or Secret of the namespace of the workload, as set by the
+	// sidecar.istio.io/grpcJsonTranscoderDescriptor annotation. The
+	// sidecar.istio.io/grpcJsonTranscoderServices and grpcJsonTranscoderPrintOptions annotations set the services
+	// and print options like the networking.istio.io/grpcJsonTranscoder* annotations of the gateways.
+	GRPCJSONTranscoderDescriptor   string `json:"sidecar.istio.io/grpcJsonTranscoderDescriptor,omitempty"`
+	GRPCJSONTranscoderServices     string `json:"sidecar.istio.io/grpcJsonTranscoderServices,omitempty"`
+	GRPCJSONTranscoderPrintOptions string `json:"sidecar.istio.io/grpcJsonTranscoderPrintOptions,omitempty"`
+
+	// DebugProxy set to "true" requests the unscoped config of the whole mesh, ignoring the Sidecar resources
+	// and the visibility of the configs, for mesh-wide inspection tools. The connection is rejected unless
+	// the identity of the client certificate is authorized by Pilot.
+	DebugProxy string `json:"DEBUG_PROXY,omitempty"`
+
+	// OutlierLogPath is the absolute path of the file where the proxy logs the outlier detection events.
+	OutlierLogPath string `json:"OUTLIER_LOG_PATH,omitempty"`
+
 	// TLSServerCertChain is the absolute path to server cert-chain file
 	TLSServerCertChain string `json:"TLS_SERVER_CERT_CHAIN,omitempty"`
 	// TLSServerKey is the absolute path to server private key file
@@ -437,6 +544,39 @@ func (node *Proxy) GetRouterMode() RouterMode {
 	return StandardRouter
 }
 
+// IsOutboundPortExcluded returns true if outbound traffic to the given port is excluded from
+// interception, and therefore never reaches the proxy.
+func (node *Proxy) IsOutboundPortExcluded(port int) bool {
+	if node == nil || node.Metadata == nil || node.Metadata.ExcludeOutboundPorts == "" {
+		return false
+	}
+	for _, p := range strings.Split(node.Metadata.ExcludeOutboundPorts, ",") {
+		if excluded, err := strconv.Atoi(strings.TrimSpace(p)); err == nil && excluded == port {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDrainExemptPort returns true if the outbound listener of the given port is exempted from the
+// drains caused by the listener updates.
+func (node *Proxy) IsDrainExemptPort(port int) bool {
+	if node == nil || node.Metadata == nil || node.Metadata.DrainExemptPorts == "" {
+		return false
+	}
+	for _, p := range strings.Split(node.Metadata.DrainExemptPorts, ",") {
+		if exempt, err := strconv.Atoi(strings.TrimSpace(p)); err == nil && exempt == port {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDebugProxy returns true if the proxy requests the unscoped config of the whole mesh.
+func (node *Proxy) IsDebugProxy() bool {
+	return node != nil && node.Metadata != nil && node.Metadata.DebugProxy == "true"
+}
+
 // SetSidecarScope identifies the sidecar scope object associated with this
 // proxy and updates the proxy Node. This is a convenience hack so that
 // callers can simply call push.Services(node) while the implementation of
@@ -448,7 +588,9 @@ func (node *Proxy) GetRouterMode() RouterMode {
 // Listener generation code will still use the SidecarScope object directly
 // as it needs the set of services for each listener port.
 func (node *Proxy) SetSidecarScope(ps *PushContext) {
-	if node.Type == SidecarProxy {
+	if node.IsDebugProxy() {
+		node.SidecarScope = DebugSidecarScope(ps)
+	} else if node.Type == SidecarProxy {
 		node.SidecarScope = ps.getSidecarScope(node, node.WorkloadLabels)
 	} else {
 		// Gateways should just have a default scope with egress: */*
@@ -513,7 +655,7 @@ const UnnamedNetwork = ""
 // When sending EDS/CDS-with-dns-endpoints, Pilot will only send
 // endpoints corresponding to the networks that the proxy wants to see.
 // If not set, we assume that the proxy wants to see endpoints from the default
-// unnamed network.
+// unnamed network, and from its own network if it has one.
 func GetNetworkView(node *Proxy) map[string]bool {
 	if node == nil {
 		return map[string]bool{UnnamedNetwork: true}
@@ -525,8 +667,12 @@ func GetNetworkView(node *Proxy) map[string]bool {
 	}
 
 	if len(nmap) == 0 {
-		// Proxy sees endpoints from the default unnamed network only
+		// Proxy sees endpoints from the default unnamed network and its own network only, as the endpoints of
+		// the other networks are reached through their gateways
 		nmap[UnnamedNetwork] = true
+		if node.Metadata.Network != "" {
+			nmap[node.Metadata.Network] = true
+		}
 	}
 	return nmap
 }
@@ -294,6 +294,29 @@ func mapToStruct(msg map[string]interface{}) (*structpb.Struct, error) {
 	return pbs, nil
 }
 
+func TestIsOutboundPortExcluded(t *testing.T) {
+	cases := []struct {
+		name     string
+		excluded string
+		port     int
+		want     bool
+	}{
+		{"no exclusions", "", 80, false},
+		{"excluded", "3306,9090", 9090, true},
+		{"excluded with spaces", "3306, 9090", 9090, true},
+		{"not excluded", "3306,9090", 80, false},
+		{"invalid entries are ignored", "foo,80", 80, true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &model.Proxy{Metadata: &model.NodeMetadata{ExcludeOutboundPorts: tt.excluded}}
+			if got := node.IsOutboundPortExcluded(tt.port); got != tt.want {
+				t.Errorf("IsOutboundPortExcluded(%d) => %v, want %v", tt.port, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestParsePort(t *testing.T) {
 	if port := model.ParsePort("localhost:3000"); port != 3000 {
 		t.Errorf("ParsePort(localhost:3000) => Got %d, want 3000", port)
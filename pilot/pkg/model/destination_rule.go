@@ -16,12 +16,70 @@ package model
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
 
 	networking "istio.io/api/networking/v1alpha3"
 
 	"istio.io/istio/pkg/config/host"
 )
 
+// OriginalDstHeaderOverrideAnnotation on a DestinationRule of a service with resolution NONE lets the requests
+// pick their upstream host:port with the x-envoy-original-dst-host header, instead of their original
+// destination. It only applies to the gateways, e.g. the internal gateways sending the requests of a router
+// service picking the hosts, since the header is not verified, and the sidecars strip the header at ingress.
+const OriginalDstHeaderOverrideAnnotation = "networking.istio.io/originalDstHeaderOverride"
+
+const (
+	// IstioMutualSNIAnnotation on a DestinationRule is the template of the SNI of the ISTIO_MUTUAL connections to
+	// the destination, instead of the one derived from the cluster name, e.g. "{subset}.{host}.mesh-b.example.com"
+	// for the intermediary gateway of another mesh routing on its own SNI conventions. The template variables are
+	// {host}, {namespace} and {port} of the service, and {subset}, empty for the clusters without subset. The SNI
+	// of the TLS settings of the rule or of a subset takes precedence.
+	IstioMutualSNIAnnotation = "networking.istio.io/istioMutualSni"
+
+	// IstioMutualSubjectAltNamesAnnotation on a DestinationRule is the comma separated list of the subject
+	// alternative names expected of the ISTIO_MUTUAL destination, instead of the identities of the service, e.g.
+	// "spiffe://mesh-b.example.com/ns/{namespace}/sa/gateway". It supports the template variables of
+	// IstioMutualSNIAnnotation except {subset}. The subject alternative names of the TLS settings take precedence.
+	IstioMutualSubjectAltNamesAnnotation = "networking.istio.io/istioMutualSubjectAltNames"
+)
+
+// IstioMutualSNI returns the SNI of the ISTIO_MUTUAL connections to a subset of the service port templated by the
+// destination rule, or an empty string if the rule has no template.
+func IstioMutualSNI(destRule *Config, service *Service, port int, subset string) string {
+	if destRule == nil || destRule.Annotations[IstioMutualSNIAnnotation] == "" {
+		return ""
+	}
+	return expandDestinationTemplate(destRule.Annotations[IstioMutualSNIAnnotation], service, port, subset)
+}
+
+// IstioMutualSubjectAltNames returns the subject alternative names of the ISTIO_MUTUAL destination of the service
+// port templated by the destination rule, or nil if the rule has none.
+func IstioMutualSubjectAltNames(destRule *Config, service *Service, port int) []string {
+	if destRule == nil || destRule.Annotations[IstioMutualSubjectAltNamesAnnotation] == "" {
+		return nil
+	}
+	var out []string
+	for _, san := range strings.Split(destRule.Annotations[IstioMutualSubjectAltNamesAnnotation], ",") {
+		if san = strings.TrimSpace(san); san != "" {
+			out = append(out, expandDestinationTemplate(san, service, port, ""))
+		}
+	}
+	return out
+}
+
+func expandDestinationTemplate(template string, service *Service, port int, subset string) string {
+	return strings.NewReplacer(
+		"{host}", string(service.Hostname),
+		"{namespace}", service.Attributes.Namespace,
+		"{port}", strconv.Itoa(port),
+		"{subset}", subset,
+	).Replace(template)
+}
+
 // This function merges one or more destination rules for a given host string
 // into a single destination rule. Note that it does not perform inheritance style merging.
 // IOW, given three dest rules (*.foo.com, *.foo.com, *.com), calling this function for
@@ -47,14 +105,17 @@ func (ps *PushContext) combineSingleDestinationRule(
 						subset.Name, string(resolvedHost)))
 			}
 		}
-		// If there is no top level policy and the incoming rule has top level
-		// traffic policy, use the one from the incoming rule.
-		if combinedRule.TrafficPolicy == nil && rule.TrafficPolicy != nil {
-			combinedRule.TrafficPolicy = rule.TrafficPolicy
-		}
+		// The settings of the top level traffic policy are merged, the ones of the oldest rule
+		// taking precedence.
+		combinedRule.TrafficPolicy = ps.mergeTrafficPolicy(resolvedHost, combinedRule.TrafficPolicy,
+			rule.TrafficPolicy, destRuleConfig)
 		return combinedDestRuleHosts
 	}
 
+	// Copy the rule, so that merging the next ones does not modify the config of the store.
+	combinedRule := *rule
+	combinedRule.Subsets = append([]*networking.Subset{}, rule.Subsets...)
+	destRuleConfig.Spec = &combinedRule
 	combinedDestRuleMap[resolvedHost] = &combinedDestinationRule{
 		subsets: make(map[string]struct{}),
 		config:  &destRuleConfig,
@@ -66,3 +127,138 @@ func (ps *PushContext) combineSingleDestinationRule(
 
 	return combinedDestRuleHosts
 }
+
+// mergeTrafficPolicy returns the traffic policy with the settings of the incoming policy, of a newer
+// destination rule, added when not already set. The ignored settings are reported as conflicts.
+func (ps *PushContext) mergeTrafficPolicy(resolvedHost host.Name, policy, incoming *networking.TrafficPolicy,
+	incomingConfig Config) *networking.TrafficPolicy {
+	merged, conflicts := mergeTrafficPolicies(policy, incoming)
+	if len(conflicts) > 0 {
+		ps.Add(DestinationRuleConflicts, string(resolvedHost), nil,
+			fmt.Sprintf("Ignored %s of destination rule %s/%s, already set by an older destination rule for %s",
+				strings.Join(conflicts, ", "), incomingConfig.Namespace, incomingConfig.Name, string(resolvedHost)))
+	}
+	return merged
+}
+
+// mergeTrafficPolicies returns the traffic policy with the settings of incoming added when not set
+// in policy, and the names of the settings of incoming that were ignored because they differ.
+// Neither policy is modified.
+func mergeTrafficPolicies(policy, incoming *networking.TrafficPolicy) (*networking.TrafficPolicy, []string) {
+	if incoming == nil {
+		return policy, nil
+	}
+	if policy == nil {
+		return incoming, nil
+	}
+
+	var conflicts []string
+	merged := *policy
+	if merged.LoadBalancer == nil {
+		merged.LoadBalancer = incoming.LoadBalancer
+	} else if incoming.LoadBalancer != nil && !proto.Equal(merged.LoadBalancer, incoming.LoadBalancer) {
+		conflicts = append(conflicts, "loadBalancer")
+	}
+	if merged.ConnectionPool == nil {
+		merged.ConnectionPool = incoming.ConnectionPool
+	} else if incoming.ConnectionPool != nil && !proto.Equal(merged.ConnectionPool, incoming.ConnectionPool) {
+		conflicts = append(conflicts, "connectionPool")
+	}
+	if merged.OutlierDetection == nil {
+		merged.OutlierDetection = incoming.OutlierDetection
+	} else if incoming.OutlierDetection != nil && !proto.Equal(merged.OutlierDetection, incoming.OutlierDetection) {
+		conflicts = append(conflicts, "outlierDetection")
+	}
+	if merged.Tls == nil {
+		merged.Tls = incoming.Tls
+	} else if incoming.Tls != nil && !proto.Equal(merged.Tls, incoming.Tls) {
+		conflicts = append(conflicts, "tls")
+	}
+
+	ports := make(map[uint32]*networking.TrafficPolicy_PortTrafficPolicy, len(merged.PortLevelSettings))
+	for _, setting := range merged.PortLevelSettings {
+		ports[setting.GetPort().GetNumber()] = setting
+	}
+	merged.PortLevelSettings = append([]*networking.TrafficPolicy_PortTrafficPolicy{}, merged.PortLevelSettings...)
+	for _, setting := range incoming.PortLevelSettings {
+		port := setting.GetPort().GetNumber()
+		if existing, exists := ports[port]; !exists {
+			ports[port] = setting
+			merged.PortLevelSettings = append(merged.PortLevelSettings, setting)
+		} else if !proto.Equal(existing, setting) {
+			conflicts = append(conflicts, fmt.Sprintf("portLevelSettings[%d]", port))
+		}
+	}
+	return &merged, conflicts
+}
+
+// inheritedDestRuleKey identifies a destination rule merged with the defaults of a namespace.
+type inheritedDestRuleKey struct {
+	namespace string
+	rule      *Config
+}
+
+// defaultDestinationRule returns the default destination rule, of host "*", of the namespace.
+// Only the rules visible to the namespace itself are considered.
+func defaultDestinationRule(rules map[string]*processedDestRules, namespace string) *Config {
+	if rules[namespace] == nil {
+		return nil
+	}
+	if mdr, exists := rules[namespace].destRule[wildcardService]; exists {
+		return mdr.config
+	}
+	return nil
+}
+
+// inheritDestinationRule returns the destination rule with the traffic policies of the default
+// destination rules, of host "*", merged under its own: first the default rule of the proxy
+// namespace, then the one of the config root namespace. The settings of the most specific rule
+// take precedence. This lets platform teams set mesh-wide and namespace-wide connection pool,
+// outlier detection and TLS defaults once. The rule itself is not modified.
+func (ps *PushContext) inheritDestinationRule(proxyNamespace string, rule *Config) *Config {
+	var parents []*Config
+	if proxyNamespace != "" && proxyNamespace != ps.Env.Mesh.RootNamespace {
+		if ns := defaultDestinationRule(ps.namespaceLocalDestRules, proxyNamespace); ns != nil {
+			parents = append(parents, ns)
+		}
+	}
+	mesh := defaultDestinationRule(ps.namespaceExportedDestRules, ps.Env.Mesh.RootNamespace)
+	if mesh != nil {
+		parents = append(parents, mesh)
+	}
+	if len(parents) == 0 {
+		return rule
+	}
+	if rule == nil || rule == mesh {
+		// Without a host specific rule, the most specific default applies.
+		rule, parents = parents[0], parents[1:]
+		if len(parents) == 0 {
+			return rule
+		}
+	}
+
+	key := inheritedDestRuleKey{namespace: proxyNamespace, rule: rule}
+	ps.inheritedDestRulesMutex.RLock()
+	out, exists := ps.inheritedDestRules[key]
+	ps.inheritedDestRulesMutex.RUnlock()
+	if exists {
+		return out
+	}
+
+	spec := *rule.Spec.(*networking.DestinationRule)
+	for _, parent := range parents {
+		spec.TrafficPolicy, _ = mergeTrafficPolicies(spec.TrafficPolicy,
+			parent.Spec.(*networking.DestinationRule).TrafficPolicy)
+	}
+	inherited := *rule
+	inherited.Spec = &spec
+	out = &inherited
+
+	ps.inheritedDestRulesMutex.Lock()
+	if ps.inheritedDestRules == nil {
+		ps.inheritedDestRules = make(map[inheritedDestRuleKey]*Config)
+	}
+	ps.inheritedDestRules[key] = out
+	ps.inheritedDestRulesMutex.Unlock()
+	return out
+}
@@ -0,0 +1,213 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/features"
+)
+
+func TestMergeDestinationRules(t *testing.T) {
+	now := time.Now()
+	roundRobin := &networking.LoadBalancerSettings{
+		LbPolicy: &networking.LoadBalancerSettings_Simple{Simple: networking.LoadBalancerSettings_ROUND_ROBIN},
+	}
+	leastConn := &networking.LoadBalancerSettings{
+		LbPolicy: &networking.LoadBalancerSettings_Simple{Simple: networking.LoadBalancerSettings_LEAST_CONN},
+	}
+	outlier := &networking.OutlierDetection{ConsecutiveErrors: 5}
+	port80 := &networking.TrafficPolicy_PortTrafficPolicy{
+		Port:         &networking.PortSelector{Number: 80},
+		LoadBalancer: roundRobin,
+	}
+	port8080 := &networking.TrafficPolicy_PortTrafficPolicy{
+		Port:         &networking.PortSelector{Number: 8080},
+		LoadBalancer: leastConn,
+	}
+
+	older := &networking.DestinationRule{
+		Host: "foo.default.svc.cluster.local",
+		TrafficPolicy: &networking.TrafficPolicy{
+			LoadBalancer:      roundRobin,
+			PortLevelSettings: []*networking.TrafficPolicy_PortTrafficPolicy{port80},
+		},
+		Subsets: []*networking.Subset{{Name: "v1"}},
+	}
+	newer := &networking.DestinationRule{
+		Host: "foo.default.svc.cluster.local",
+		TrafficPolicy: &networking.TrafficPolicy{
+			LoadBalancer:     leastConn,
+			OutlierDetection: outlier,
+			PortLevelSettings: []*networking.TrafficPolicy_PortTrafficPolicy{
+				{Port: &networking.PortSelector{Number: 80}, LoadBalancer: leastConn},
+				port8080,
+			},
+		},
+		Subsets: []*networking.Subset{{Name: "v1"}, {Name: "v2"}},
+	}
+	configs := []Config{
+		{ConfigMeta: ConfigMeta{Name: "newer", Namespace: "default", CreationTimestamp: now.Add(time.Second)}, Spec: newer},
+		{ConfigMeta: ConfigMeta{Name: "older", Namespace: "default", CreationTimestamp: now}, Spec: older},
+	}
+
+	ps := NewPushContext()
+	ps.SetDestinationRules(configs)
+
+	merged := ps.namespaceLocalDestRules["default"].destRule["foo.default.svc.cluster.local"].config.Spec.(*networking.DestinationRule)
+	want := &networking.TrafficPolicy{
+		LoadBalancer:      roundRobin,
+		OutlierDetection:  outlier,
+		PortLevelSettings: []*networking.TrafficPolicy_PortTrafficPolicy{port80, port8080},
+	}
+	if !reflect.DeepEqual(merged.TrafficPolicy, want) {
+		t.Errorf("got traffic policy %v but want %v", merged.TrafficPolicy, want)
+	}
+	if len(merged.Subsets) != 2 || merged.Subsets[0].Name != "v1" || merged.Subsets[1].Name != "v2" {
+		t.Errorf("got subsets %v but want v1 and v2", merged.Subsets)
+	}
+
+	// The configs of the store are left untouched, so that the next push merges them the same way.
+	if len(older.Subsets) != 1 || older.TrafficPolicy.OutlierDetection != nil || len(older.TrafficPolicy.PortLevelSettings) != 1 {
+		t.Errorf("the older destination rule was modified: %v", older)
+	}
+
+	if _, f := ps.ProxyStatus[DestinationRuleConflicts.Name()]["foo.default.svc.cluster.local"]; !f {
+		t.Errorf("got proxy status %v but want the conflicting load balancer settings reported", ps.ProxyStatus)
+	}
+	if _, f := ps.ProxyStatus[DuplicatedSubsets.Name()]["foo.default.svc.cluster.local"]; !f {
+		t.Errorf("got proxy status %v but want the duplicate subset reported", ps.ProxyStatus)
+	}
+}
+
+func TestInheritDestinationRules(t *testing.T) {
+	defer func(enabled bool) { features.EnableDestinationRuleInheritance = enabled }(features.EnableDestinationRuleInheritance)
+	features.EnableDestinationRuleInheritance = true
+
+	leastConn := &networking.LoadBalancerSettings{
+		LbPolicy: &networking.LoadBalancerSettings_Simple{Simple: networking.LoadBalancerSettings_LEAST_CONN},
+	}
+	meshPool := &networking.ConnectionPoolSettings{Tcp: &networking.ConnectionPoolSettings_TCPSettings{MaxConnections: 100}}
+	nsPool := &networking.ConnectionPoolSettings{Tcp: &networking.ConnectionPoolSettings_TCPSettings{MaxConnections: 10}}
+	meshTLS := &networking.TLSSettings{Mode: networking.TLSSettings_ISTIO_MUTUAL}
+	outlier := &networking.OutlierDetection{ConsecutiveErrors: 5}
+
+	foo := &networking.DestinationRule{
+		Host:          "foo.default.svc.cluster.local",
+		ExportTo:      []string{"*"},
+		TrafficPolicy: &networking.TrafficPolicy{LoadBalancer: leastConn},
+	}
+	configs := []Config{
+		{ConfigMeta: ConfigMeta{Name: "mesh-default", Namespace: "istio-system"}, Spec: &networking.DestinationRule{
+			Host:          "*",
+			ExportTo:      []string{"*"},
+			TrafficPolicy: &networking.TrafficPolicy{ConnectionPool: meshPool, Tls: meshTLS},
+		}},
+		{ConfigMeta: ConfigMeta{Name: "ns-default", Namespace: "team"}, Spec: &networking.DestinationRule{
+			Host:          "*",
+			ExportTo:      []string{"."},
+			TrafficPolicy: &networking.TrafficPolicy{ConnectionPool: nsPool, OutlierDetection: outlier},
+		}},
+		{ConfigMeta: ConfigMeta{Name: "foo", Namespace: "default"}, Spec: foo},
+	}
+
+	ps := NewPushContext()
+	ps.Env = &Environment{Mesh: &meshconfig.MeshConfig{RootNamespace: "istio-system"}}
+	ps.SetDestinationRules(configs)
+
+	svc := &Service{Hostname: "foo.default.svc.cluster.local", Attributes: ServiceAttributes{Namespace: "default"}}
+	cases := []struct {
+		name  string
+		proxy *Proxy
+		want  *networking.TrafficPolicy
+	}{
+		{
+			name:  "mesh default",
+			proxy: &Proxy{Type: Router, ConfigNamespace: "default"},
+			want:  &networking.TrafficPolicy{LoadBalancer: leastConn, ConnectionPool: meshPool, Tls: meshTLS},
+		},
+		{
+			name:  "namespace default over mesh default",
+			proxy: &Proxy{Type: Router, ConfigNamespace: "team"},
+			want: &networking.TrafficPolicy{LoadBalancer: leastConn, ConnectionPool: nsPool,
+				OutlierDetection: outlier, Tls: meshTLS},
+		},
+		{
+			name:  "without proxy",
+			proxy: nil,
+			want:  &networking.TrafficPolicy{LoadBalancer: leastConn, ConnectionPool: meshPool, Tls: meshTLS},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := ps.DestinationRule(tt.proxy, svc)
+			if cfg == nil || cfg.Name != "foo" {
+				t.Fatalf("got destination rule %v but want foo", cfg)
+			}
+			got := cfg.Spec.(*networking.DestinationRule).TrafficPolicy
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got traffic policy %v but want %v", got, tt.want)
+			}
+		})
+	}
+
+	// A service without a host specific rule gets the namespace default merged with the mesh default.
+	bar := &Service{Hostname: "bar.default.svc.cluster.local", Attributes: ServiceAttributes{Namespace: "default"}}
+	got := ps.DestinationRule(&Proxy{Type: Router, ConfigNamespace: "team"}, bar).Spec.(*networking.DestinationRule).TrafficPolicy
+	want := &networking.TrafficPolicy{ConnectionPool: nsPool, OutlierDetection: outlier, Tls: meshTLS}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got traffic policy %v but want %v", got, want)
+	}
+
+	if foo.TrafficPolicy.ConnectionPool != nil || foo.TrafficPolicy.Tls != nil {
+		t.Errorf("the host specific destination rule was modified: %v", foo)
+	}
+}
+
+func TestIstioMutualTemplates(t *testing.T) {
+	service := &Service{
+		Hostname:   "reviews.default.svc.cluster.local",
+		Attributes: ServiceAttributes{Namespace: "default"},
+	}
+	rule := &Config{ConfigMeta: ConfigMeta{Annotations: map[string]string{
+		IstioMutualSNIAnnotation:             "{subset}.{port}.{host}.mesh-b.example.com",
+		IstioMutualSubjectAltNamesAnnotation: "spiffe://mesh-b.example.com/ns/{namespace}/sa/gateway, spiffe://mesh-b.example.com/sa/{port}",
+	}}}
+
+	if got, want := IstioMutualSNI(rule, service, 9080, "v1"), "v1.9080.reviews.default.svc.cluster.local.mesh-b.example.com"; got != want {
+		t.Errorf("IstioMutualSNI() got %q, want %q", got, want)
+	}
+	if got, want := IstioMutualSNI(rule, service, 9080, ""), ".9080.reviews.default.svc.cluster.local.mesh-b.example.com"; got != want {
+		t.Errorf("IstioMutualSNI() got %q, want %q", got, want)
+	}
+	want := []string{"spiffe://mesh-b.example.com/ns/default/sa/gateway", "spiffe://mesh-b.example.com/sa/9080"}
+	if got := IstioMutualSubjectAltNames(rule, service, 9080); !reflect.DeepEqual(got, want) {
+		t.Errorf("IstioMutualSubjectAltNames() got %v, want %v", got, want)
+	}
+
+	for _, rule := range []*Config{nil, {}} {
+		if got := IstioMutualSNI(rule, service, 9080, "v1"); got != "" {
+			t.Errorf("IstioMutualSNI() got %q without template", got)
+		}
+		if got := IstioMutualSubjectAltNames(rule, service, 9080); got != nil {
+			t.Errorf("IstioMutualSubjectAltNames() got %v without template", got)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DestinationTimeoutsAnnotation on a VirtualService overrides the timeout of its HTTP routes for the weighted
+// destinations of a subset, e.g. "canary=1s" or "reviews-route/canary=1s,v1=5s", so that a canary can get a
+// shorter timeout than the stable version. A subset prefixed with the name of an HTTP route only applies to the
+// destinations of this route. The routes with overridden destinations are split into one route per destination.
+const DestinationTimeoutsAnnotation = "networking.istio.io/destinationTimeouts"
+
+// DestinationTimeouts are the timeouts of the destinations by subset, or by route name and subset.
+type DestinationTimeouts map[string]time.Duration
+
+// ParseDestinationTimeouts parses the value of the DestinationTimeoutsAnnotation.
+func ParseDestinationTimeouts(value string) (DestinationTimeouts, error) {
+	out := make(DestinationTimeouts)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid destination timeout %q: must be [route/]subset=timeout", entry)
+		}
+		key := strings.TrimSpace(parts[0])
+		if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") || strings.Count(key, "/") > 1 {
+			return nil, fmt.Errorf("invalid destination timeout %q: must be [route/]subset=timeout", entry)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("invalid timeout of destination %q: %q", key, parts[1])
+		}
+		if _, exists := out[key]; exists {
+			return nil, fmt.Errorf("duplicate destination timeout %q", key)
+		}
+		out[key] = timeout
+	}
+	return out, nil
+}
+
+// Timeout returns the timeout overridden for the destinations of the subset in the route, if any.
+func (t DestinationTimeouts) Timeout(routeName, subset string) (time.Duration, bool) {
+	if subset == "" {
+		return 0, false
+	}
+	if routeName != "" {
+		if timeout, ok := t[routeName+"/"+subset]; ok {
+			return timeout, true
+		}
+	}
+	timeout, ok := t[subset]
+	return timeout, ok
+}
+
+// VirtualServiceDestinationTimeouts returns the destination timeouts of a virtual service, or nil if it has none.
+func VirtualServiceDestinationTimeouts(virtualService *Config) DestinationTimeouts {
+	value, ok := virtualService.Annotations[DestinationTimeoutsAnnotation]
+	if !ok {
+		return nil
+	}
+	timeouts, err := ParseDestinationTimeouts(value)
+	if err != nil {
+		log.Warnf("ignored the %s annotation of virtual service %s/%s: %v", DestinationTimeoutsAnnotation,
+			virtualService.Namespace, virtualService.Name, err)
+		return nil
+	}
+	if len(timeouts) == 0 {
+		return nil
+	}
+	return timeouts
+}
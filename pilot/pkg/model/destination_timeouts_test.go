@@ -0,0 +1,94 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDestinationTimeouts(t *testing.T) {
+	cases := []struct {
+		name    string
+		value   string
+		want    DestinationTimeouts
+		wantErr bool
+	}{
+		{
+			name:  "empty",
+			value: "",
+			want:  DestinationTimeouts{},
+		},
+		{
+			name:  "subsets and routes",
+			value: "canary=1s, reviews-route/v1 = 500ms,",
+			want:  DestinationTimeouts{"canary": time.Second, "reviews-route/v1": 500 * time.Millisecond},
+		},
+		{name: "missing timeout", value: "canary", wantErr: true},
+		{name: "invalid timeout", value: "canary=soon", wantErr: true},
+		{name: "negative timeout", value: "canary=-1s", wantErr: true},
+		{name: "missing subset", value: "reviews-route/=1s", wantErr: true},
+		{name: "nested routes", value: "a/b/canary=1s", wantErr: true},
+		{name: "duplicate", value: "canary=1s,canary=2s", wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseDestinationTimeouts(tc.value)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("ParseDestinationTimeouts(%q) got %v, want error", tc.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDestinationTimeouts(%q) got error %v", tc.value, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ParseDestinationTimeouts(%q) got %v, want %v", tc.value, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDestinationTimeoutsTimeout(t *testing.T) {
+	timeouts := DestinationTimeouts{"canary": 3 * time.Second, "reviews-route/canary": time.Second}
+	cases := []struct {
+		routeName string
+		subset    string
+		want      time.Duration
+		wantOK    bool
+	}{
+		{routeName: "reviews-route", subset: "canary", want: time.Second, wantOK: true},
+		{routeName: "ratings-route", subset: "canary", want: 3 * time.Second, wantOK: true},
+		{routeName: "", subset: "canary", want: 3 * time.Second, wantOK: true},
+		{routeName: "reviews-route", subset: "v1"},
+		{routeName: "reviews-route", subset: ""},
+	}
+	for _, tc := range cases {
+		got, ok := timeouts.Timeout(tc.routeName, tc.subset)
+		if got != tc.want || ok != tc.wantOK {
+			t.Errorf("Timeout(%q, %q) got %v, %v, want %v, %v", tc.routeName, tc.subset, got, ok, tc.want, tc.wantOK)
+		}
+	}
+
+	invalid := &Config{ConfigMeta: ConfigMeta{
+		Name:        "reviews",
+		Annotations: map[string]string{DestinationTimeoutsAnnotation: "canary"},
+	}}
+	if got := VirtualServiceDestinationTimeouts(invalid); got != nil {
+		t.Errorf("VirtualServiceDestinationTimeouts() got %v for an invalid annotation, want nil", got)
+	}
+}
@@ -39,6 +39,8 @@ type EnvoyFilterConfigPatchWrapper struct {
 	Operation networking.EnvoyFilter_Patch_Operation
 	// Pre-compile the regex from proxy version match in the match
 	ProxyVersionRegex *regexp.Regexp
+	// Source is the namespace/name of the EnvoyFilter of the patch
+	Source string
 }
 
 // convertToEnvoyFilterWrapper converts from EnvoyFilter config to EnvoyFilterWrapper object
@@ -55,6 +57,7 @@ func convertToEnvoyFilterWrapper(local *Config) *EnvoyFilterWrapper {
 			ApplyTo:   cp.ApplyTo,
 			Match:     cp.Match,
 			Operation: cp.Patch.Operation,
+			Source:    local.Namespace + "/" + local.Name,
 		}
 		// there wont be an error here because validation catches mismatched types
 		cpw.Value, _ = xds.BuildXDSObjectFromStruct(cp.ApplyTo, cp.Patch.Value)
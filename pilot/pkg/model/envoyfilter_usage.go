@@ -0,0 +1,63 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "sync"
+
+// EnvoyFilterUsage records the resources generated for a proxy that were patched by each EnvoyFilter, as the
+// patches are applied. The resources are recorded by xDS type, "cds", "rds" or "lds", and by namespace/name of
+// the EnvoyFilter.
+type EnvoyFilterUsage struct {
+	mu        sync.Mutex
+	resources map[string]map[string][]string
+}
+
+// NewEnvoyFilterUsage creates a recorder of the EnvoyFilters patching the resources of a proxy.
+func NewEnvoyFilterUsage() *EnvoyFilterUsage {
+	return &EnvoyFilterUsage{resources: make(map[string]map[string][]string)}
+}
+
+// Record records that the EnvoyFilter patched the resource of the xDS type. It does nothing if the usage is nil
+// or the EnvoyFilter is unknown.
+func (u *EnvoyFilterUsage) Record(typ, source, resource string) {
+	if u == nil || source == "" {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	byFilter := u.resources[typ]
+	if byFilter == nil {
+		byFilter = make(map[string][]string)
+		u.resources[typ] = byFilter
+	}
+	for _, r := range byFilter[source] {
+		if r == resource {
+			return
+		}
+	}
+	byFilter[source] = append(byFilter[source], resource)
+}
+
+// Take returns the resources of the xDS type patched by each EnvoyFilter since the last call, and forgets them.
+func (u *EnvoyFilterUsage) Take(typ string) map[string][]string {
+	if u == nil {
+		return nil
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	out := u.resources[typ]
+	delete(u.resources, typ)
+	return out
+}
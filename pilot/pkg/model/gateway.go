@@ -22,6 +22,7 @@ import (
 	networking "istio.io/api/networking/v1alpha3"
 
 	"istio.io/istio/pkg/config/gateway"
+	"istio.io/istio/pkg/config/host"
 	"istio.io/istio/pkg/config/protocol"
 	"istio.io/pkg/monitoring"
 )
@@ -46,6 +47,97 @@ type MergedGateway struct {
 	// Inverse of ServersByRouteName. Returning this as part of merge result allows to keep route name generation logic
 	// encapsulated within the model and, as a side effect, to avoid generating route names twice.
 	RouteNamesByServer map[*networking.Server]string
+
+	// maps from server to the fallback of the requests matching none of its hosts, set by the annotations
+	// of the owning gateway. Servers without fallback are not in the map.
+	FallbackForServer map[*networking.Server]*GatewayFallback
+
+	// set of the servers whose hosts are redirected to HTTPS by the plaintext HTTP servers, as set by the
+	// HTTPSRedirectAnnotation of the owning gateway.
+	HTTPSRedirectServers map[*networking.Server]bool
+
+	// maps from server to the compression of its responses, set by the CompressionAnnotation of the owning
+	// gateway. Servers without compression are not in the map.
+	CompressionForServer map[*networking.Server]*Compression
+
+	// maps from server to the limits of the size of its requests, set by the MaxRequestBytesAnnotation and
+	// MaxRequestHeadersKbAnnotation of the owning gateway. Servers without limits are not in the map.
+	RequestLimitsForServer map[*networking.Server]*RequestLimits
+
+	// maps from server to the sanitization of the headers of its requests and responses, set by the
+	// Sanitize*HeadersAnnotation of the owning gateway. Servers without sanitization are not in the map.
+	HeaderSanitizationForServer map[*networking.Server]*HeaderSanitization
+
+	// maps from server to the transcoding of its JSON requests to gRPC, set by the
+	// GRPCJSONTranscoder*Annotation of the owning gateway. Servers without transcoding, or whose proto descriptor
+	// set cannot be read, are not in the map.
+	GRPCJSONTranscoderForServer map[*networking.Server]*GRPCJSONTranscoder
+}
+
+const (
+	// GatewayFallbackResponseAnnotation on a Gateway sets the response to the requests of its HTTP servers
+	// matching none of the hosts of the virtual services, as a status optionally followed by a body, e.g.
+	// "503 service unavailable", instead of the empty 404 response.
+	GatewayFallbackResponseAnnotation = "networking.istio.io/fallbackResponse"
+
+	// GatewayFallbackDestinationAnnotation on a Gateway routes the requests of its HTTP servers matching none
+	// of the hosts of the virtual services to a default backend service, as host:port, e.g.
+	// "default-backend.istio-system.svc.cluster.local:80". It takes precedence over the fallback response.
+	GatewayFallbackDestinationAnnotation = "networking.istio.io/fallbackDestination"
+
+	// HTTPSRedirectAnnotation set to "true" on a Gateway generates, in the routes of its plaintext HTTP
+	// servers, a virtual host redirecting to HTTPS each host served with TLS on port 443 by its virtual
+	// services. Set on a VirtualService, it redirects its own hosts served with TLS on port 443 by its
+	// gateways. The hosts with a virtual host on the plaintext server are not redirected.
+	HTTPSRedirectAnnotation = "networking.istio.io/httpsRedirect"
+)
+
+// GatewayFallback is the fallback of the requests of a gateway server matching none of its hosts: either a
+// direct response or a default backend service.
+type GatewayFallback struct {
+	// Status and Body of the direct response.
+	Status uint32
+	Body   string
+
+	// Host and Port of the default backend service, if set.
+	Host host.Name
+	Port int
+}
+
+// ParseGatewayFallback returns the fallback set by the annotations of a gateway, or nil if there is none.
+func ParseGatewayFallback(annotations map[string]string) (*GatewayFallback, error) {
+	response, hasResponse := annotations[GatewayFallbackResponseAnnotation]
+	destination, hasDestination := annotations[GatewayFallbackDestinationAnnotation]
+	if !hasResponse && !hasDestination {
+		return nil, nil
+	}
+
+	fallback := &GatewayFallback{Status: 404}
+	if hasResponse {
+		parts := strings.SplitN(strings.TrimSpace(response), " ", 2)
+		status, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil || status < 200 || status > 599 {
+			return nil, fmt.Errorf("invalid %s %q: status must be between 200 and 599",
+				GatewayFallbackResponseAnnotation, response)
+		}
+		fallback.Status = uint32(status)
+		if len(parts) == 2 {
+			fallback.Body = parts[1]
+		}
+	}
+	if hasDestination {
+		i := strings.LastIndex(destination, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid %s %q: must be host:port", GatewayFallbackDestinationAnnotation, destination)
+		}
+		port, err := strconv.Atoi(destination[i+1:])
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid %s %q: invalid port", GatewayFallbackDestinationAnnotation, destination)
+		}
+		fallback.Host = host.Name(destination[:i])
+		fallback.Port = port
+	}
+	return fallback, nil
 }
 
 var (
@@ -79,6 +171,12 @@ func MergeGateways(gateways ...Config) *MergedGateway {
 	serversByRouteName := make(map[string][]*networking.Server)
 	routeNamesByServer := make(map[*networking.Server]string)
 	gatewayNameForServer := make(map[*networking.Server]string)
+	fallbackForServer := make(map[*networking.Server]*GatewayFallback)
+	httpsRedirectServers := make(map[*networking.Server]bool)
+	compressionForServer := make(map[*networking.Server]*Compression)
+	requestLimitsForServer := make(map[*networking.Server]*RequestLimits)
+	headerSanitizationForServer := make(map[*networking.Server]*HeaderSanitization)
+	grpcJSONTranscoderForServer := make(map[*networking.Server]*GRPCJSONTranscoder)
 	tlsHostsByPort := map[uint32]map[string]struct{}{} // port -> host -> exists
 
 	log.Debugf("MergeGateways: merging %d gateways", len(gateways))
@@ -86,11 +184,57 @@ func MergeGateways(gateways ...Config) *MergedGateway {
 		gatewayName := fmt.Sprintf("%s/%s", gatewayConfig.Namespace, gatewayConfig.Name)
 		names[gatewayName] = true
 
+		fallback, err := ParseGatewayFallback(gatewayConfig.Annotations)
+		if err != nil {
+			log.Warnf("MergeGateways: ignoring the fallback of gateway %q: %v", gatewayName, err)
+			recordRejectedConfig(gatewayName)
+		}
+		compression, err := ParseGatewayCompression(gatewayConfig.Annotations)
+		if err != nil {
+			log.Warnf("MergeGateways: ignoring the compression of gateway %q: %v", gatewayName, err)
+			recordRejectedConfig(gatewayName)
+		}
+		requestLimits, err := ParseRequestLimits(gatewayConfig.Annotations)
+		if err != nil {
+			log.Warnf("MergeGateways: ignoring the request limits of gateway %q: %v", gatewayName, err)
+			recordRejectedConfig(gatewayName)
+		}
+		headerSanitization, err := ParseHeaderSanitization(gatewayConfig.Annotations)
+		if err != nil {
+			log.Warnf("MergeGateways: ignoring the header sanitization of gateway %q: %v", gatewayName, err)
+			recordRejectedConfig(gatewayName)
+		}
+		grpcJSONTranscoder, err := ParseGatewayGRPCJSONTranscoder(gatewayConfig.Annotations)
+		if err != nil {
+			log.Warnf("MergeGateways: ignoring the gRPC JSON transcoder of gateway %q: %v", gatewayName, err)
+			recordRejectedConfig(gatewayName)
+		} else if grpcJSONTranscoder != nil {
+			grpcJSONTranscoder.Namespace = gatewayConfig.Namespace
+		}
+
 		gatewayCfg := gatewayConfig.Spec.(*networking.Gateway)
 		log.Debugf("MergeGateways: merging gateway %q into %v:\n%v", gatewayName, names, gatewayCfg)
 		for _, s := range gatewayCfg.Servers {
 			sanitizeServerHostNamespace(s, gatewayConfig.Namespace)
 			gatewayNameForServer[s] = gatewayName
+			if fallback != nil {
+				fallbackForServer[s] = fallback
+			}
+			if gatewayConfig.Annotations[HTTPSRedirectAnnotation] == "true" {
+				httpsRedirectServers[s] = true
+			}
+			if compression != nil {
+				compressionForServer[s] = compression
+			}
+			if requestLimits != nil {
+				requestLimitsForServer[s] = requestLimits
+			}
+			if headerSanitization != nil {
+				headerSanitizationForServer[s] = headerSanitization
+			}
+			if grpcJSONTranscoder != nil {
+				grpcJSONTranscoderForServer[s] = grpcJSONTranscoder
+			}
 			log.Debugf("MergeGateways: gateway %q processing server %v", gatewayName, s.Hosts)
 			p := protocol.Parse(s.Port.Protocol)
 
@@ -195,10 +339,16 @@ func MergeGateways(gateways ...Config) *MergedGateway {
 	}
 
 	return &MergedGateway{
-		Servers:              servers,
-		GatewayNameForServer: gatewayNameForServer,
-		ServersByRouteName:   serversByRouteName,
-		RouteNamesByServer:   routeNamesByServer,
+		Servers:                     servers,
+		GatewayNameForServer:        gatewayNameForServer,
+		ServersByRouteName:          serversByRouteName,
+		RouteNamesByServer:          routeNamesByServer,
+		FallbackForServer:           fallbackForServer,
+		HTTPSRedirectServers:        httpsRedirectServers,
+		CompressionForServer:        compressionForServer,
+		RequestLimitsForServer:      requestLimitsForServer,
+		HeaderSanitizationForServer: headerSanitizationForServer,
+		GRPCJSONTranscoderForServer: grpcJSONTranscoderForServer,
 	}
 }
 
@@ -16,6 +16,7 @@ package model
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 
 	networking "istio.io/api/networking/v1alpha3"
@@ -113,6 +114,56 @@ func makeConfig(name, namespace, host, portName, portProtocol string, portNumber
 	return c
 }
 
+func TestParseGatewayFallback(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    *GatewayFallback
+		expectErr   bool
+	}{
+		{
+			name:        "no fallback",
+			annotations: map[string]string{"foo": "bar"},
+		},
+		{
+			name:        "status only",
+			annotations: map[string]string{GatewayFallbackResponseAnnotation: "503"},
+			expected:    &GatewayFallback{Status: 503},
+		},
+		{
+			name:        "status and body",
+			annotations: map[string]string{GatewayFallbackResponseAnnotation: "404 no such host"},
+			expected:    &GatewayFallback{Status: 404, Body: "no such host"},
+		},
+		{
+			name:        "destination",
+			annotations: map[string]string{GatewayFallbackDestinationAnnotation: "default-backend.default.svc.cluster.local:8080"},
+			expected:    &GatewayFallback{Status: 404, Host: "default-backend.default.svc.cluster.local", Port: 8080},
+		},
+		{
+			name:        "invalid status",
+			annotations: map[string]string{GatewayFallbackResponseAnnotation: "oops"},
+			expectErr:   true,
+		},
+		{
+			name:        "destination without port",
+			annotations: map[string]string{GatewayFallbackDestinationAnnotation: "default-backend"},
+			expectErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseGatewayFallback(tt.annotations)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParseGatewayFallback() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ParseGatewayFallback() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
 func TestParseGatewayRDSRouteName(t *testing.T) {
 	type args struct {
 		name string
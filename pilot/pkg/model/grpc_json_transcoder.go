@@ -0,0 +1,188 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+const (
+	// GRPCJSONTranscoderDescriptorAnnotation on a Gateway transcodes the JSON requests of its HTTP servers to
+	// the gRPC methods of a proto descriptor set, read by Pilot from the key of a ConfigMap or Secret of the
+	// namespace of the gateway, as configmap/<name>/<key> or secret/<name>/<key>. The ConfigMap or Secret must have
+	// the ProtoDescriptorLabel. The HTTP rules of the methods map the REST requests, and the routes of the virtual
+	// services match the gRPC paths the requests are transcoded to. The sidecar.istio.io/grpcJsonTranscoder*
+	// annotations of a workload transcode the requests of its inbound HTTP/2 and gRPC ports the same way, from a
+	// ConfigMap or Secret of the namespace of the workload.
+	GRPCJSONTranscoderDescriptorAnnotation = "networking.istio.io/grpcJsonTranscoderDescriptor"
+
+	// GRPCJSONTranscoderServicesAnnotation is the comma separated list of the fully qualified names of the gRPC
+	// services transcoded, e.g. "bookstore.Bookstore". It is required with the descriptor.
+	GRPCJSONTranscoderServicesAnnotation = "networking.istio.io/grpcJsonTranscoderServices"
+
+	// GRPCJSONTranscoderPrintOptionsAnnotation is the comma separated list of the options of the JSON responses:
+	// addWhitespace, alwaysPrintPrimitiveFields, alwaysPrintEnumsAsInts and preserveProtoFieldNames.
+	GRPCJSONTranscoderPrintOptionsAnnotation = "networking.istio.io/grpcJsonTranscoderPrintOptions"
+
+	// ProtoDescriptorLabel set to "true" on a ConfigMap or Secret lets Pilot read the proto descriptor sets of its
+	// keys for the gRPC JSON transcoders.
+	ProtoDescriptorLabel = "networking.istio.io/protoDescriptor"
+)
+
+// The kinds of the resources of the proto descriptor sets.
+const (
+	ProtoDescriptorConfigMap = "configmap"
+	ProtoDescriptorSecret    = "secret"
+)
+
+// The print options of the JSON responses of the transcoded gRPC methods.
+const (
+	GRPCJSONPrintAddWhitespace              = "addWhitespace"
+	GRPCJSONPrintAlwaysPrintPrimitiveFields = "alwaysPrintPrimitiveFields"
+	GRPCJSONPrintAlwaysPrintEnumsAsInts     = "alwaysPrintEnumsAsInts"
+	GRPCJSONPrintPreserveProtoFieldNames    = "preserveProtoFieldNames"
+)
+
+// ProtoDescriptors reads the proto descriptor sets of the gRPC JSON transcoders.
+type ProtoDescriptors interface {
+	// ProtoDescriptor returns the proto descriptor set of the key of the ConfigMap or Secret, given by its kind,
+	// of the namespace.
+	ProtoDescriptor(kind, namespace, name, key string) ([]byte, error)
+}
+
+// GRPCJSONTranscoder is the transcoding of the JSON requests to gRPC methods.
+type GRPCJSONTranscoder struct {
+	// DescriptorKind, DescriptorName and DescriptorKey reference the proto descriptor set of the services.
+	DescriptorKind string
+	DescriptorName string
+	DescriptorKey  string
+	// Namespace of the ConfigMap or Secret, the namespace of the gateway, set by MergeGateways.
+	Namespace string
+	Services  []string
+
+	AddWhitespace              bool
+	AlwaysPrintPrimitiveFields bool
+	AlwaysPrintEnumsAsInts     bool
+	PreserveProtoFieldNames    bool
+
+	// ProtoDescriptorBin is the proto descriptor set, read by ResolveGRPCJSONTranscoder.
+	ProtoDescriptorBin []byte
+}
+
+// ParseGRPCJSONTranscoder returns the transcoding set by the descriptor, services and print options settings, or
+// nil if the descriptor is unset.
+func ParseGRPCJSONTranscoder(descriptor, services, printOptions string) (*GRPCJSONTranscoder, error) {
+	descriptor = strings.TrimSpace(descriptor)
+	if descriptor == "" {
+		if strings.TrimSpace(services) != "" {
+			return nil, fmt.Errorf("gRPC JSON transcoder services %q have no proto descriptor", services)
+		}
+		return nil, nil
+	}
+	parts := strings.Split(descriptor, "/")
+	if len(parts) != 3 || (parts[0] != ProtoDescriptorConfigMap && parts[0] != ProtoDescriptorSecret) ||
+		parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("invalid gRPC JSON transcoder proto descriptor %q: must be %s/<name>/<key> or "+
+			"%s/<name>/<key>", descriptor, ProtoDescriptorConfigMap, ProtoDescriptorSecret)
+	}
+
+	transcoder := &GRPCJSONTranscoder{DescriptorKind: parts[0], DescriptorName: parts[1], DescriptorKey: parts[2]}
+	for _, service := range strings.Split(services, ",") {
+		if service = strings.TrimSpace(service); service != "" {
+			transcoder.Services = append(transcoder.Services, service)
+		}
+	}
+	if len(transcoder.Services) == 0 {
+		return nil, fmt.Errorf("gRPC JSON transcoder proto descriptor %q has no services", descriptor)
+	}
+	for _, option := range strings.Split(printOptions, ",") {
+		switch option = strings.TrimSpace(option); option {
+		case "":
+		case GRPCJSONPrintAddWhitespace:
+			transcoder.AddWhitespace = true
+		case GRPCJSONPrintAlwaysPrintPrimitiveFields:
+			transcoder.AlwaysPrintPrimitiveFields = true
+		case GRPCJSONPrintAlwaysPrintEnumsAsInts:
+			transcoder.AlwaysPrintEnumsAsInts = true
+		case GRPCJSONPrintPreserveProtoFieldNames:
+			transcoder.PreserveProtoFieldNames = true
+		default:
+			return nil, fmt.Errorf("invalid gRPC JSON transcoder print option %q: must be %s, %s, %s or %s", option,
+				GRPCJSONPrintAddWhitespace, GRPCJSONPrintAlwaysPrintPrimitiveFields, GRPCJSONPrintAlwaysPrintEnumsAsInts,
+				GRPCJSONPrintPreserveProtoFieldNames)
+		}
+	}
+	return transcoder, nil
+}
+
+// ParseGatewayGRPCJSONTranscoder returns the transcoding set by the annotations of a gateway, or nil if there is
+// none.
+func ParseGatewayGRPCJSONTranscoder(annotations map[string]string) (*GRPCJSONTranscoder, error) {
+	return ParseGRPCJSONTranscoder(annotations[GRPCJSONTranscoderDescriptorAnnotation],
+		annotations[GRPCJSONTranscoderServicesAnnotation], annotations[GRPCJSONTranscoderPrintOptionsAnnotation])
+}
+
+// ResolveGRPCJSONTranscoder reads the proto descriptor set of the transcoding from the ConfigMap or Secret of the
+// namespace, and checks it defines the services. An invalid descriptor would have the proxy reject its listeners.
+func (ps *PushContext) ResolveGRPCJSONTranscoder(t *GRPCJSONTranscoder, namespace string) error {
+	if ps.Env == nil || ps.Env.ProtoDescriptors == nil {
+		return fmt.Errorf("the proto descriptors cannot be read")
+	}
+	bin, err := ps.Env.ProtoDescriptors.ProtoDescriptor(t.DescriptorKind, namespace, t.DescriptorName, t.DescriptorKey)
+	if err != nil {
+		return err
+	}
+	set := &descriptor.FileDescriptorSet{}
+	if err := proto.Unmarshal(bin, set); err != nil {
+		return fmt.Errorf("%s %s/%s key %s is not a proto descriptor set: %v", t.DescriptorKind, namespace,
+			t.DescriptorName, t.DescriptorKey, err)
+	}
+	defined := make(map[string]bool)
+	for _, file := range set.File {
+		for _, service := range file.Service {
+			name := service.GetName()
+			if file.GetPackage() != "" {
+				name = file.GetPackage() + "." + name
+			}
+			defined[name] = true
+		}
+	}
+	for _, service := range t.Services {
+		if !defined[service] {
+			return fmt.Errorf("service %s is not defined by the proto descriptor set of %s %s/%s", service,
+				t.DescriptorKind, namespace, t.DescriptorName)
+		}
+	}
+	t.ProtoDescriptorBin = bin
+	return nil
+}
+
+// resolveGRPCJSONTranscoders reads the proto descriptor sets of the transcoding of the gateway servers. The
+// transcoding of the servers is ignored if its descriptor set is invalid, and reported in the push status.
+func (ps *PushContext) resolveGRPCJSONTranscoders(merged *MergedGateway, proxy *Proxy) {
+	for server, t := range merged.GRPCJSONTranscoderForServer {
+		if t.ProtoDescriptorBin != nil {
+			continue
+		}
+		if err := ps.ResolveGRPCJSONTranscoder(t, t.Namespace); err != nil {
+			ps.Add(GRPCJSONTranscoderRejected, t.Namespace+"/"+t.DescriptorName+"/"+t.DescriptorKey, proxy, err.Error())
+			delete(merged.GRPCJSONTranscoderForServer, server)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+
+	networking "istio.io/api/networking/v1alpha3"
+)
+
+func TestParseGatewayGRPCJSONTranscoder(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		expected    *GRPCJSONTranscoder
+		expectErr   bool
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name: "services",
+			annotations: map[string]string{
+				GRPCJSONTranscoderDescriptorAnnotation: "configmap/bookstore/bookstore.pb",
+				GRPCJSONTranscoderServicesAnnotation:   "bookstore.Bookstore, bookstore.Authors",
+			},
+			expected: &GRPCJSONTranscoder{
+				DescriptorKind: ProtoDescriptorConfigMap,
+				DescriptorName: "bookstore",
+				DescriptorKey:  "bookstore.pb",
+				Services:       []string{"bookstore.Bookstore", "bookstore.Authors"},
+			},
+		},
+		{
+			name: "print options",
+			annotations: map[string]string{
+				GRPCJSONTranscoderDescriptorAnnotation:   "configmap/bookstore/bookstore.pb",
+				GRPCJSONTranscoderServicesAnnotation:     "bookstore.Bookstore",
+				GRPCJSONTranscoderPrintOptionsAnnotation: "addWhitespace, preserveProtoFieldNames",
+			},
+			expected: &GRPCJSONTranscoder{
+				DescriptorKind:          ProtoDescriptorConfigMap,
+				DescriptorName:          "bookstore",
+				DescriptorKey:           "bookstore.pb",
+				Services:                []string{"bookstore.Bookstore"},
+				AddWhitespace:           true,
+				PreserveProtoFieldNames: true,
+			},
+		},
+		{
+			name:        "services without descriptor",
+			annotations: map[string]string{GRPCJSONTranscoderServicesAnnotation: "bookstore.Bookstore"},
+			expectErr:   true,
+		},
+		{
+			name:        "descriptor without services",
+			annotations: map[string]string{GRPCJSONTranscoderDescriptorAnnotation: "configmap/bookstore/bookstore.pb"},
+			expectErr:   true,
+		},
+		{
+			name: "file descriptor",
+			annotations: map[string]string{
+				GRPCJSONTranscoderDescriptorAnnotation: "/etc/istio/descriptors/bookstore.pb",
+				GRPCJSONTranscoderServicesAnnotation:   "bookstore.Bookstore",
+			},
+			expectErr: true,
+		},
+		{
+			name: "invalid print option",
+			annotations: map[string]string{
+				GRPCJSONTranscoderDescriptorAnnotation:   "configmap/bookstore/bookstore.pb",
+				GRPCJSONTranscoderServicesAnnotation:     "bookstore.Bookstore",
+				GRPCJSONTranscoderPrintOptionsAnnotation: "pretty",
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseGatewayGRPCJSONTranscoder(tt.annotations)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParseGatewayGRPCJSONTranscoder() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ParseGatewayGRPCJSONTranscoder() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+type fakeProtoDescriptors map[string][]byte
+
+func (f fakeProtoDescriptors) ProtoDescriptor(kind, namespace, name, key string) ([]byte, error) {
+	bin, ok := f[kind+"/"+namespace+"/"+name+"/"+key]
+	if !ok {
+		return nil, fmt.Errorf("%s %s/%s key %s not found", kind, namespace, name, key)
+	}
+	return bin, nil
+}
+
+func TestResolveGRPCJSONTranscoder(t *testing.T) {
+	bin, err := proto.Marshal(&descriptor.FileDescriptorSet{File: []*descriptor.FileDescriptorProto{{
+		Name:    proto.String("bookstore.proto"),
+		Package: proto.String("bookstore"),
+		Service: []*descriptor.ServiceDescriptorProto{{Name: proto.String("Bookstore")}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := NewPushContext()
+	ps.Env = &Environment{ProtoDescriptors: fakeProtoDescriptors{
+		"configmap/default/bookstore/bookstore.pb": bin,
+		"configmap/default/bookstore/invalid.pb":   []byte("invalid"),
+	}}
+
+	cases := []struct {
+		name      string
+		key       string
+		services  []string
+		expectErr bool
+	}{
+		{name: "valid", key: "bookstore.pb", services: []string{"bookstore.Bookstore"}},
+		{name: "missing key", key: "authors.pb", services: []string{"bookstore.Bookstore"}, expectErr: true},
+		{name: "invalid descriptor", key: "invalid.pb", services: []string{"bookstore.Bookstore"}, expectErr: true},
+		{name: "undefined service", key: "bookstore.pb", services: []string{"bookstore.Authors"}, expectErr: true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			transcoder := &GRPCJSONTranscoder{DescriptorKind: ProtoDescriptorConfigMap, DescriptorName: "bookstore",
+				DescriptorKey: tt.key, Services: tt.services}
+			err := ps.ResolveGRPCJSONTranscoder(transcoder, "default")
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ResolveGRPCJSONTranscoder() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if !tt.expectErr && string(transcoder.ProtoDescriptorBin) != string(bin) {
+				t.Errorf("ResolveGRPCJSONTranscoder() did not set the proto descriptor set")
+			}
+		})
+	}
+
+	server := &networking.Server{Hosts: []string{"example.com"}}
+	merged := &MergedGateway{GRPCJSONTranscoderForServer: map[*networking.Server]*GRPCJSONTranscoder{
+		server: {DescriptorKind: ProtoDescriptorConfigMap, DescriptorName: "bookstore", DescriptorKey: "invalid.pb",
+			Namespace: "default", Services: []string{"bookstore.Bookstore"}},
+	}}
+	ps.resolveGRPCJSONTranscoders(merged, &Proxy{ID: "gateway"})
+	if len(merged.GRPCJSONTranscoderForServer) != 0 {
+		t.Errorf("expected the invalid transcoder to be ignored, got %v", merged.GRPCJSONTranscoderForServer)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// SanitizeHeadersAnnotation set to "true" on a Gateway strips the internal headers of the mesh, the
+	// InternalRequestHeaders from the requests of the clients of its HTTP servers and the
+	// InternalResponseHeaders from the responses to them.
+	SanitizeHeadersAnnotation = "networking.istio.io/sanitizeHeaders"
+
+	// SanitizeRequestHeadersAnnotation on a Gateway is a comma separated list of the headers stripped from the
+	// requests of the clients of its HTTP servers, as name, or overwritten, as name=value.
+	SanitizeRequestHeadersAnnotation = "networking.istio.io/sanitizeRequestHeaders"
+
+	// SanitizeResponseHeadersAnnotation on a Gateway is a comma separated list of the headers stripped from the
+	// responses to the clients of its HTTP servers, as name, or overwritten, as name=value.
+	SanitizeResponseHeadersAnnotation = "networking.istio.io/sanitizeResponseHeaders"
+)
+
+var (
+	// InternalRequestHeaders are the headers set by the proxies of the mesh for each other, which the clients
+	// outside of the mesh must not be able to forge.
+	InternalRequestHeaders = []string{
+		"x-envoy-decorator-operation",
+		"x-envoy-peer-metadata",
+		"x-envoy-peer-metadata-id",
+		"x-istio-attributes",
+	}
+
+	// InternalResponseHeaders are the headers set by the proxies of the mesh revealing its internals to the
+	// clients outside of it.
+	InternalResponseHeaders = []string{
+		"x-envoy-decorator-operation",
+		"x-envoy-degraded",
+		"x-envoy-overloaded",
+		"x-envoy-peer-metadata",
+		"x-envoy-peer-metadata-id",
+		"x-envoy-upstream-healthchecked-cluster",
+		"x-envoy-upstream-service-time",
+	}
+)
+
+// HeaderSanitization is the sanitization of the headers of the requests and responses of a gateway server.
+type HeaderSanitization struct {
+	RemoveRequestHeaders  []string
+	SetRequestHeaders     map[string]string
+	RemoveResponseHeaders []string
+	SetResponseHeaders    map[string]string
+}
+
+// ParseHeaderSanitization returns the sanitization set by the annotations of a gateway, or nil if there is none.
+func ParseHeaderSanitization(annotations map[string]string) (*HeaderSanitization, error) {
+	sanitizeInternal := annotations[SanitizeHeadersAnnotation] == "true"
+	requestHeaders, hasRequestHeaders := annotations[SanitizeRequestHeadersAnnotation]
+	responseHeaders, hasResponseHeaders := annotations[SanitizeResponseHeadersAnnotation]
+	if !sanitizeInternal && !hasRequestHeaders && !hasResponseHeaders {
+		return nil, nil
+	}
+
+	out := &HeaderSanitization{
+		SetRequestHeaders:  make(map[string]string),
+		SetResponseHeaders: make(map[string]string),
+	}
+	if sanitizeInternal {
+		out.RemoveRequestHeaders = append(out.RemoveRequestHeaders, InternalRequestHeaders...)
+		out.RemoveResponseHeaders = append(out.RemoveResponseHeaders, InternalResponseHeaders...)
+	}
+	var err error
+	if out.RemoveRequestHeaders, err = parseSanitizedHeaders(SanitizeRequestHeadersAnnotation, requestHeaders,
+		out.RemoveRequestHeaders, out.SetRequestHeaders); err != nil {
+		return nil, err
+	}
+	if out.RemoveResponseHeaders, err = parseSanitizedHeaders(SanitizeResponseHeadersAnnotation, responseHeaders,
+		out.RemoveResponseHeaders, out.SetResponseHeaders); err != nil {
+		return nil, err
+	}
+	out.RemoveRequestHeaders = mergeHeaderNames(out.RemoveRequestHeaders, nil)
+	out.RemoveResponseHeaders = mergeHeaderNames(out.RemoveResponseHeaders, nil)
+	return out, nil
+}
+
+func parseSanitizedHeaders(annotation, value string, remove []string, set map[string]string) ([]string, error) {
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if name == "" || strings.HasPrefix(name, ":") {
+			return nil, fmt.Errorf("invalid %s %q: invalid header %q", annotation, value, item)
+		}
+		if len(parts) == 2 {
+			set[name] = strings.TrimSpace(parts[1])
+		} else {
+			remove = append(remove, name)
+		}
+	}
+	return remove, nil
+}
+
+// Merge adds the sanitization of another gateway server sharing the routes of this one, so the headers are
+// sanitized if any of the servers sanitizes them.
+func (h *HeaderSanitization) Merge(other *HeaderSanitization) {
+	h.RemoveRequestHeaders = mergeHeaderNames(h.RemoveRequestHeaders, other.RemoveRequestHeaders)
+	h.RemoveResponseHeaders = mergeHeaderNames(h.RemoveResponseHeaders, other.RemoveResponseHeaders)
+	if h.SetRequestHeaders == nil {
+		h.SetRequestHeaders = make(map[string]string)
+	}
+	if h.SetResponseHeaders == nil {
+		h.SetResponseHeaders = make(map[string]string)
+	}
+	for name, value := range other.SetRequestHeaders {
+		if _, exists := h.SetRequestHeaders[name]; !exists {
+			h.SetRequestHeaders[name] = value
+		}
+	}
+	for name, value := range other.SetResponseHeaders {
+		if _, exists := h.SetResponseHeaders[name]; !exists {
+			h.SetResponseHeaders[name] = value
+		}
+	}
+}
+
+// mergeHeaderNames returns the sorted union of the header names.
+func mergeHeaderNames(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	out := make([]string, 0, len(a)+len(b))
+	for _, names := range [][]string{a, b} {
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				out = append(out, name)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
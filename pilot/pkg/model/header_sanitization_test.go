@@ -0,0 +1,95 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHeaderSanitization(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		expected    *HeaderSanitization
+		expectErr   bool
+	}{
+		{
+			name:        "unset",
+			annotations: map[string]string{SanitizeHeadersAnnotation: "false"},
+		},
+		{
+			name:        "internal headers",
+			annotations: map[string]string{SanitizeHeadersAnnotation: "true"},
+			expected: &HeaderSanitization{
+				RemoveRequestHeaders:  InternalRequestHeaders,
+				SetRequestHeaders:     map[string]string{},
+				RemoveResponseHeaders: InternalResponseHeaders,
+				SetResponseHeaders:    map[string]string{},
+			},
+		},
+		{
+			name: "custom headers",
+			annotations: map[string]string{
+				SanitizeRequestHeadersAnnotation:  "X-Internal-User, x-tenant=public",
+				SanitizeResponseHeadersAnnotation: "x-backend,x-powered-by=",
+			},
+			expected: &HeaderSanitization{
+				RemoveRequestHeaders:  []string{"x-internal-user"},
+				SetRequestHeaders:     map[string]string{"x-tenant": "public"},
+				RemoveResponseHeaders: []string{"x-backend"},
+				SetResponseHeaders:    map[string]string{"x-powered-by": ""},
+			},
+		},
+		{
+			name:        "pseudo header",
+			annotations: map[string]string{SanitizeRequestHeadersAnnotation: ":authority"},
+			expectErr:   true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseHeaderSanitization(tt.annotations)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParseHeaderSanitization() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ParseHeaderSanitization() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHeaderSanitizationMerge(t *testing.T) {
+	h := &HeaderSanitization{
+		RemoveRequestHeaders: []string{"x-b"},
+		SetResponseHeaders:   map[string]string{"x-served-by": "gateway-a"},
+	}
+	h.Merge(&HeaderSanitization{
+		RemoveRequestHeaders:  []string{"x-a", "x-b"},
+		RemoveResponseHeaders: []string{"x-backend"},
+		SetResponseHeaders:    map[string]string{"x-served-by": "gateway-b", "x-frame-options": "DENY"},
+	})
+	expected := &HeaderSanitization{
+		RemoveRequestHeaders:  []string{"x-a", "x-b"},
+		SetRequestHeaders:     map[string]string{},
+		RemoveResponseHeaders: []string{"x-backend"},
+		SetResponseHeaders:    map[string]string{"x-served-by": "gateway-a", "x-frame-options": "DENY"},
+	}
+	if !reflect.DeepEqual(h, expected) {
+		t.Errorf("Merge() = %+v, want %+v", h, expected)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"strconv"
+)
+
+const (
+	// ConnectionBufferLimitAnnotation on a DestinationRule sets the soft limit in bytes of the read and write
+	// buffers of the connections to the upstream hosts, 1MiB by default.
+	ConnectionBufferLimitAnnotation = "networking.istio.io/connectionBufferLimitBytes"
+)
+
+// UInt32Annotation returns the value of an annotation of a config holding a positive 32 bits integer, or nil if
+// the annotation is not set or invalid.
+func UInt32Annotation(meta *ConfigMeta, annotation string) *uint32 {
+	value, f := meta.Annotations[annotation]
+	if !f {
+		return nil
+	}
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || n == 0 {
+		log.Warnf("ignored invalid %s annotation %q of %s %s/%s", annotation, value, meta.Type, meta.Namespace, meta.Name)
+		return nil
+	}
+	out := uint32(n)
+	return &out
+}
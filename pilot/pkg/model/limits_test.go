@@ -0,0 +1,45 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"testing"
+)
+
+func TestUInt32Annotation(t *testing.T) {
+	cases := []struct {
+		value string
+		want  uint32
+	}{
+		{"", 0},
+		{"1048576", 1048576},
+		{"0", 0},
+		{"-1", 0},
+		{"4294967296", 0},
+		{"1Mi", 0},
+	}
+	for _, c := range cases {
+		meta := &ConfigMeta{Name: "reviews", Namespace: "default"}
+		if c.value != "" {
+			meta.Annotations = map[string]string{ConnectionBufferLimitAnnotation: c.value}
+		}
+		got := UInt32Annotation(meta, ConnectionBufferLimitAnnotation)
+		if c.want == 0 && got != nil {
+			t.Errorf("UInt32Annotation(%q) => %d, want nil", c.value, *got)
+		} else if c.want != 0 && (got == nil || *got != c.want) {
+			t.Errorf("UInt32Annotation(%q) => %v, want %d", c.value, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MetadataHeadersAnnotation on a VirtualService bound to gateways sets request headers from the dynamic
+// metadata produced by the filters of the gateways, e.g. the JWT claims of the Istio authentication filter,
+// so its routes can match on them with header matches. It is a comma separated list of
+// header=filter:key/subkey, e.g. "x-tenant=istio_authn:request.auth.claims/tenant". The headers are removed
+// from the requests first, so they cannot be forged by the clients. The first value of a list is used.
+const MetadataHeadersAnnotation = "networking.istio.io/metadataHeaders"
+
+var (
+	metadataHeaderNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+	metadataKeyRegexp        = regexp.MustCompile(`^[A-Za-z0-9_.\-]+$`)
+)
+
+// MetadataHeader is a request header set from the dynamic metadata of a filter.
+type MetadataHeader struct {
+	Header string
+	// Filter is the namespace of the dynamic metadata, usually the name of the filter producing it.
+	Filter string
+	// Path of the value in the metadata of the filter.
+	Path []string
+}
+
+// ParseMetadataHeaders parses the value of the MetadataHeadersAnnotation.
+func ParseMetadataHeaders(value string) ([]MetadataHeader, error) {
+	var out []MetadataHeader
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid %s %q: %q is not header=filter:key", MetadataHeadersAnnotation, value, item)
+		}
+		header := strings.ToLower(strings.TrimSpace(parts[0]))
+		if !metadataHeaderNameRegexp.MatchString(header) {
+			return nil, fmt.Errorf("invalid %s %q: invalid header %q", MetadataHeadersAnnotation, value, header)
+		}
+		source := strings.SplitN(strings.TrimSpace(parts[1]), ":", 2)
+		if len(source) != 2 || !metadataKeyRegexp.MatchString(source[0]) {
+			return nil, fmt.Errorf("invalid %s %q: %q is not filter:key", MetadataHeadersAnnotation, value, parts[1])
+		}
+		path := strings.Split(source[1], "/")
+		for _, key := range path {
+			if !metadataKeyRegexp.MatchString(key) {
+				return nil, fmt.Errorf("invalid %s %q: invalid key %q", MetadataHeadersAnnotation, value, source[1])
+			}
+		}
+		out = append(out, MetadataHeader{Header: header, Filter: source[0], Path: path})
+	}
+	return out, nil
+}
+
+// GatewayMetadataHeaders returns the metadata headers set by the virtual services bound to the gateways, sorted
+// by header. The virtual services with invalid annotations are ignored, and the first virtual service setting a
+// header wins.
+func (ps *PushContext) GatewayMetadataHeaders(proxy *Proxy, gateways map[string]bool) []MetadataHeader {
+	byHeader := make(map[string]MetadataHeader)
+	for _, virtualService := range ps.VirtualServices(proxy, gateways) {
+		value, ok := virtualService.Annotations[MetadataHeadersAnnotation]
+		if !ok {
+			continue
+		}
+		headers, err := ParseMetadataHeaders(value)
+		if err != nil {
+			log.Warnf("ignoring the metadata headers of virtual service %s/%s: %v",
+				virtualService.Namespace, virtualService.Name, err)
+			continue
+		}
+		for _, h := range headers {
+			if _, exists := byHeader[h.Header]; !exists {
+				byHeader[h.Header] = h
+			}
+		}
+	}
+
+	out := make([]MetadataHeader, 0, len(byHeader))
+	for _, h := range byHeader {
+		out = append(out, h)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Header < out[j].Header })
+	return out
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMetadataHeaders(t *testing.T) {
+	cases := []struct {
+		name      string
+		value     string
+		expected  []MetadataHeader
+		expectErr bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:  "claims",
+			value: "X-Tenant=istio_authn:request.auth.claims/tenant, x-user=istio_authn:request.auth.principal",
+			expected: []MetadataHeader{
+				{Header: "x-tenant", Filter: "istio_authn", Path: []string{"request.auth.claims", "tenant"}},
+				{Header: "x-user", Filter: "istio_authn", Path: []string{"request.auth.principal"}},
+			},
+		},
+		{
+			name:      "missing filter",
+			value:     "x-tenant=tenant",
+			expectErr: true,
+		},
+		{
+			name:      "invalid header",
+			value:     ":authority=istio_authn:request.auth.audiences",
+			expectErr: true,
+		},
+		{
+			name:      "invalid key",
+			value:     `x-tenant=istio_authn:claims/"tenant"`,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMetadataHeaders(tt.value)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParseMetadataHeaders() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ParseMetadataHeaders() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	meshconfig "istio.io/api/mesh/v1alpha1"
+)
+
+const (
+	// NetworkLabel on a pod is the network of its endpoints, and on a service of the Istio system namespace, or
+	// of PILOT_NETWORK_GATEWAY_NAMESPACE, the network whose gateway it is. The networks and their gateways are
+	// discovered from the labels, in addition to the mesh networks configuration, so that they are updated without
+	// changing the configuration.
+	NetworkLabel = "topology.istio.io/network"
+
+	// NetworkGatewayPortAnnotation on a network gateway service is the port of the gateway receiving the traffic
+	// of the other networks, DefaultNetworkGatewayPort if not set.
+	NetworkGatewayPortAnnotation = "topology.istio.io/gatewayPort"
+
+	// DefaultNetworkGatewayPort is the port of the network gateways receiving the traffic of the other networks.
+	DefaultNetworkGatewayPort = 15443
+)
+
+// NetworkGateways are the gateways of the networks, by network name.
+type NetworkGateways map[string][]*meshconfig.Network_IstioNetworkGateway
+
+// Merge appends the gateways of other to the gateways of the networks.
+func (g NetworkGateways) Merge(other NetworkGateways) {
+	for network, gateways := range other {
+		g[network] = append(g[network], gateways...)
+	}
+}
+
+// MergeMeshNetworks returns the mesh networks with the discovered gateways. The discovered gateways are appended
+// to the gateways of the configured networks, unless they are configured already, and the networks that are not
+// configured are added with their gateways. The mesh networks are not modified.
+func MergeMeshNetworks(meshNetworks *meshconfig.MeshNetworks, gateways NetworkGateways) *meshconfig.MeshNetworks {
+	if len(gateways) == 0 {
+		return meshNetworks
+	}
+	out := &meshconfig.MeshNetworks{Networks: make(map[string]*meshconfig.Network)}
+	if meshNetworks != nil {
+		for name, network := range meshNetworks.Networks {
+			out.Networks[name] = network
+		}
+	}
+	for name, discovered := range gateways {
+		network := &meshconfig.Network{}
+		if configured, f := out.Networks[name]; f {
+			network.Endpoints = configured.Endpoints
+			network.Gateways = append(network.Gateways, configured.Gateways...)
+		}
+		for _, gw := range discovered {
+			if !hasNetworkGateway(network.Gateways, gw) {
+				// The gateways are copied, as the addresses of the merged networks may be resolved in place.
+				network.Gateways = append(network.Gateways, &meshconfig.Network_IstioNetworkGateway{
+					Gw:       gw.Gw,
+					Port:     gw.Port,
+					Locality: gw.Locality,
+				})
+			}
+		}
+		out.Networks[name] = network
+	}
+	return out
+}
+
+func hasNetworkGateway(gateways []*meshconfig.Network_IstioNetworkGateway, gw *meshconfig.Network_IstioNetworkGateway) bool {
+	for _, existing := range gateways {
+		if existing.GetAddress() == gw.GetAddress() && existing.GetRegistryServiceName() == gw.GetRegistryServiceName() &&
+			existing.Port == gw.Port {
+			return true
+		}
+	}
+	return false
+}
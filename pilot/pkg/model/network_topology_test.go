@@ -0,0 +1,120 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"reflect"
+	"testing"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+)
+
+func networkGateway(address string, port uint32) *meshconfig.Network_IstioNetworkGateway {
+	return &meshconfig.Network_IstioNetworkGateway{
+		Gw:   &meshconfig.Network_IstioNetworkGateway_Address{Address: address},
+		Port: port,
+	}
+}
+
+func TestMergeMeshNetworks(t *testing.T) {
+	fromRegistry := []*meshconfig.NetworkEndpoints{
+		{Ne: &meshconfig.NetworkEndpoints_FromRegistry{FromRegistry: "cluster1"}},
+	}
+	meshNetworks := &meshconfig.MeshNetworks{
+		Networks: map[string]*meshconfig.Network{
+			"network1": {
+				Endpoints: fromRegistry,
+				Gateways:  []*meshconfig.Network_IstioNetworkGateway{networkGateway("1.1.1.1", 15443)},
+			},
+			"network2": {
+				Endpoints: fromRegistry,
+			},
+		},
+	}
+
+	if got := MergeMeshNetworks(meshNetworks, nil); got != meshNetworks {
+		t.Errorf("MergeMeshNetworks() got %v without discovered gateways, want the mesh networks", got)
+	}
+
+	got := MergeMeshNetworks(meshNetworks, NetworkGateways{
+		"network1": {networkGateway("1.1.1.1", 15443), networkGateway("2.2.2.2", 15443)},
+		"network3": {networkGateway("3.3.3.3", 443)},
+	})
+	want := &meshconfig.MeshNetworks{
+		Networks: map[string]*meshconfig.Network{
+			"network1": {
+				Endpoints: fromRegistry,
+				Gateways: []*meshconfig.Network_IstioNetworkGateway{
+					networkGateway("1.1.1.1", 15443),
+					networkGateway("2.2.2.2", 15443),
+				},
+			},
+			"network2": {
+				Endpoints: fromRegistry,
+			},
+			"network3": {
+				Gateways: []*meshconfig.Network_IstioNetworkGateway{networkGateway("3.3.3.3", 443)},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeMeshNetworks() got %v, want %v", got, want)
+	}
+	if len(meshNetworks.Networks) != 2 || len(meshNetworks.Networks["network1"].Gateways) != 1 {
+		t.Errorf("MergeMeshNetworks() modified the mesh networks: %v", meshNetworks)
+	}
+
+	if got := MergeMeshNetworks(nil, NetworkGateways{"network1": {networkGateway("1.1.1.1", 15443)}}); !reflect.DeepEqual(got,
+		&meshconfig.MeshNetworks{Networks: map[string]*meshconfig.Network{
+			"network1": {Gateways: []*meshconfig.Network_IstioNetworkGateway{networkGateway("1.1.1.1", 15443)}},
+		}}) {
+		t.Errorf("MergeMeshNetworks() got %v without mesh networks", got)
+	}
+}
+
+func TestGetNetworkView(t *testing.T) {
+	cases := []struct {
+		name string
+		node *Proxy
+		want map[string]bool
+	}{
+		{
+			name: "no proxy",
+			want: map[string]bool{UnnamedNetwork: true},
+		},
+		{
+			name: "no network",
+			node: &Proxy{Metadata: &NodeMetadata{}},
+			want: map[string]bool{UnnamedNetwork: true},
+		},
+		{
+			name: "own network",
+			node: &Proxy{Metadata: &NodeMetadata{Network: "network1"}},
+			want: map[string]bool{UnnamedNetwork: true, "network1": true},
+		},
+		{
+			name: "requested networks",
+			node: &Proxy{Metadata: &NodeMetadata{Network: "network1", RequestedNetworkView: []string{"network2"}}},
+			want: map[string]bool{"network2": true},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := GetNetworkView(tc.node); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("GetNetworkView() got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
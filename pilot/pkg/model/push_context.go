@@ -16,10 +16,13 @@ package model
 
 import (
 	"encoding/json"
+	"fmt"
 	"sort"
 	"sync"
 	"time"
 
+	ot "github.com/opentracing/opentracing-go"
+
 	authn "istio.io/api/authentication/v1alpha1"
 	networking "istio.io/api/networking/v1alpha3"
 
@@ -65,6 +68,8 @@ type PushContext struct {
 	ServiceByHostnameAndNamespace map[host.Name]map[string]*Service `json:"-"`
 	// ServiceAccounts contains a map of hostname and port to service accounts.
 	ServiceAccounts map[host.Name]map[int][]string `json:"-"`
+	// scaledToZero has the services with an activator and without endpoints.
+	scaledToZero map[host.Name]bool
 
 	// VirtualService related
 	privateVirtualServicesByNamespace map[string][]Config
@@ -80,6 +85,10 @@ type PushContext struct {
 	namespaceExportedDestRules map[string]*processedDestRules
 	allExportedDestRules       *processedDestRules
 
+	// inheritedDestRules caches the destination rules merged with the default rules of a namespace.
+	inheritedDestRulesMutex sync.RWMutex
+	inheritedDestRules      map[inheritedDestRuleKey]*Config
+
 	// sidecars for each namespace
 	sidecarsByNamespace map[string][]*SidecarScope
 	// envoy filters for each namespace including global config namespace
@@ -161,6 +170,7 @@ type XDSUpdater interface {
 	ConfigUpdate(req *PushRequest)
 
 	// ProxyUpdate is called to notify the XDS server to send a push to the specified proxy.
+	// An empty clusterID matches the proxies of all the clusters.
 	// The requests may be collapsed and throttled.
 	ProxyUpdate(clusterID, ip string)
 }
@@ -195,6 +205,9 @@ type PushRequest struct {
 	// Start represents the time a push was started. This represents the time of adding to the PushQueue.
 	// Note that this does not include time spent debouncing.
 	Start time.Time
+
+	// Span traces the push, from its first debounced event. May be nil for pushes not going through debouncing.
+	Span ot.Span
 }
 
 // Merge two update requests together
@@ -215,6 +228,7 @@ func (first *PushRequest) Merge(other *PushRequest) *PushRequest {
 
 		// The other push context is presumed to be later and more up to date
 		Push: other.Push,
+		Span: other.Span,
 	}
 
 	// Only merge EdsUpdates when incremental eds push needed.
@@ -376,12 +390,61 @@ var (
 		"Virtual services with dup domains.",
 	)
 
+	// VirtualServiceRouteConflicts tracks the routes of virtual services shadowed by the routes with the same
+	// match of other virtual services merged before them on the same gateway host.
+	VirtualServiceRouteConflicts = monitoring.NewGauge(
+		"pilot_vservice_route_conflicts",
+		"Routes shadowed by the routes of other virtual services for same host.",
+	)
+
 	// DuplicatedSubsets tracks duplicate subsets that we rejected while merging multiple destination rules for same host
 	DuplicatedSubsets = monitoring.NewGauge(
 		"pilot_destrule_subsets",
 		"Duplicate subsets across destination rules for same host",
 	)
 
+	// DestinationRuleConflicts tracks the traffic policy settings ignored while merging multiple
+	// destination rules for same host, because an older destination rule already set them.
+	DestinationRuleConflicts = monitoring.NewGauge(
+		"pilot_destrule_conflicts",
+		"Traffic policy settings ignored while merging destination rules for same host.",
+	)
+
+	// GRPCJSONTranscoderRejected tracks the gRPC JSON transcoders ignored because their proto descriptor set cannot
+	// be read, or does not define their services.
+	GRPCJSONTranscoderRejected = monitoring.NewGauge(
+		"pilot_grpc_json_transcoder_rejected",
+		"gRPC JSON transcoders with a missing or invalid proto descriptor set.",
+	)
+
+	// GatewayCredentialDenied tracks the gateway servers ignored because their credentialName references a
+	// secret of another namespace not granting the access to the gateway.
+	GatewayCredentialDenied = monitoring.NewGauge(
+		"pilot_gateway_credential_denied",
+		"Gateway servers referencing secrets of other namespaces not granting them the access.",
+	)
+
+	// VirtualServicePortConflicts tracks the rules of virtual services that cannot apply to the ports of the
+	// services of their hosts because of their protocols, and are ignored for these ports.
+	VirtualServicePortConflicts = monitoring.NewGauge(
+		"pilot_vservice_port_conflicts",
+		"Virtual service rules ignored for the ports of their hosts because of the port protocols.",
+	)
+
+	// PassthroughHTTPPorts tracks the HTTP ports of the passthrough services, e.g. the ServiceEntries of resolution
+	// NONE, whose requests get HTTP routing and telemetry and are sent to their original destination.
+	PassthroughHTTPPorts = monitoring.NewGauge(
+		"pilot_passthrough_http_ports",
+		"HTTP ports of passthrough services, with HTTP routing and telemetry on the original destination.",
+	)
+
+	// PassthroughSniffedPorts tracks the ports of the passthrough services without a protocol, whose protocol is
+	// detected by the proxies: only the connections detected as HTTP get HTTP telemetry.
+	PassthroughSniffedPorts = monitoring.NewGauge(
+		"pilot_passthrough_sniffed_ports",
+		"Ports of passthrough services without a protocol, detected by the proxies.",
+	)
+
 	// totalVirtualServices tracks the total number of virtual service
 	totalVirtualServices = monitoring.NewGauge(
 		"pilot_virt_services",
@@ -408,7 +471,14 @@ var (
 		DuplicatedClusters,
 		ProxyStatusClusterNoInstances,
 		DuplicatedDomains,
+		VirtualServiceRouteConflicts,
+		VirtualServicePortConflicts,
+		PassthroughHTTPPorts,
+		PassthroughSniffedPorts,
 		DuplicatedSubsets,
+		DestinationRuleConflicts,
+		GatewayCredentialDenied,
+		GRPCJSONTranscoderRejected,
 	}
 )
 
@@ -440,6 +510,7 @@ func NewPushContext() *PushContext {
 		ServiceByHostnameAndNamespace: map[host.Name]map[string]*Service{},
 		ProxyStatus:                   map[string]map[string]ProxyPushStatus{},
 		ServiceAccounts:               map[host.Name]map[int][]string{},
+		scaledToZero:                  map[host.Name]bool{},
 		AuthnPolicies: processedAuthnPolicies{
 			policies: map[host.Name][]*authnPolicyByPort{},
 		},
@@ -605,7 +676,30 @@ func (ps *PushContext) GetAllSidecarScopes() map[string][]*SidecarScope {
 }
 
 // DestinationRule returns a destination rule for a service name in a given domain.
+// With PILOT_ENABLE_DESTINATION_RULE_INHERITANCE, the traffic policies of the namespace
+// and mesh default rules are merged under the one of the returned rule.
 func (ps *PushContext) DestinationRule(proxy *Proxy, service *Service) *Config {
+	// If proxy has a sidecar scope that is user supplied, then get the destination rules from the sidecar scope
+	// sidecarScope.config is nil if there is no sidecar scope for the namespace
+	if proxy != nil && proxy.SidecarScope != nil && proxy.Type == SidecarProxy {
+		// If there is a sidecar scope for this proxy, return the destination rule
+		// from the sidecar scope. The inherited settings are already merged in it.
+		return proxy.SidecarScope.DestinationRule(service.Hostname)
+	}
+
+	rule := ps.destinationRule(proxy, service)
+	if !features.EnableDestinationRuleInheritance {
+		return rule
+	}
+	proxyNamespace := ""
+	if proxy != nil {
+		proxyNamespace = proxy.ConfigNamespace
+	}
+	return ps.inheritDestinationRule(proxyNamespace, rule)
+}
+
+// destinationRule returns the most specific destination rule for a service visible to the proxy.
+func (ps *PushContext) destinationRule(proxy *Proxy, service *Service) *Config {
 	// FIXME: this code should be removed once the EDS issue is fixed
 	if proxy == nil {
 		if hostname, ok := MostSpecificHostMatch(service.Hostname, ps.allExportedDestRules.hosts); ok {
@@ -614,14 +708,6 @@ func (ps *PushContext) DestinationRule(proxy *Proxy, service *Service) *Config {
 		return nil
 	}
 
-	// If proxy has a sidecar scope that is user supplied, then get the destination rules from the sidecar scope
-	// sidecarScope.config is nil if there is no sidecar scope for the namespace
-	if proxy.SidecarScope != nil && proxy.Type == SidecarProxy {
-		// If there is a sidecar scope for this proxy, return the destination rule
-		// from the sidecar scope.
-		return proxy.SidecarScope.DestinationRule(service.Hostname)
-	}
-
 	// If the proxy config namespace is same as the root config namespace
 	// look for dest rules in the service's namespace first. This hack is needed
 	// because sometimes, istio-system tends to become the root config namespace.
@@ -633,8 +719,11 @@ func (ps *PushContext) DestinationRule(proxy *Proxy, service *Service) *Config {
 	if proxy.ConfigNamespace != ps.Env.Mesh.RootNamespace {
 		// search through the DestinationRules in proxy's namespace first
 		if ps.namespaceLocalDestRules[proxy.ConfigNamespace] != nil {
+			// With inheritance, the namespace default rule does not shadow the host specific
+			// rules of the other namespaces, it is merged under them.
 			if hostname, ok := MostSpecificHostMatch(service.Hostname,
-				ps.namespaceLocalDestRules[proxy.ConfigNamespace].hosts); ok {
+				ps.namespaceLocalDestRules[proxy.ConfigNamespace].hosts); ok &&
+				!(features.EnableDestinationRuleInheritance && hostname == wildcardService) {
 				return ps.namespaceLocalDestRules[proxy.ConfigNamespace].destRule[hostname].config
 			}
 		}
@@ -740,6 +829,8 @@ func (ps *PushContext) createNewContext(env *Environment) error {
 		return err
 	}
 
+	ps.initVirtualServicePortErrors()
+
 	if err := ps.initDestinationRules(env); err != nil {
 		return err
 	}
@@ -809,6 +900,7 @@ func (ps *PushContext) updateContext(
 		ps.publicServices = oldPushContext.publicServices
 		ps.ServiceByHostnameAndNamespace = oldPushContext.ServiceByHostnameAndNamespace
 		ps.ServiceAccounts = oldPushContext.ServiceAccounts
+		ps.scaledToZero = oldPushContext.scaledToZero
 	}
 
 	if virtualServicesChanged {
@@ -819,6 +911,7 @@ func (ps *PushContext) updateContext(
 		ps.privateVirtualServicesByNamespace = oldPushContext.privateVirtualServicesByNamespace
 		ps.publicVirtualServices = oldPushContext.publicVirtualServices
 	}
+	ps.initVirtualServicePortErrors()
 
 	if destinationRulesChanged {
 		if err := ps.initDestinationRules(env); err != nil {
@@ -908,10 +1001,58 @@ func (ps *PushContext) initServiceRegistry(env *Environment) error {
 	}
 
 	ps.initServiceAccounts(env, allServices)
+	ps.initScaledToZero(env, allServices)
+	ps.initPassthroughPorts(allServices)
 
 	return nil
 }
 
+// initPassthroughPorts reports the protocols of the ports of the passthrough services. Their HTTP ports, and their
+// ports without a protocol when the proxies detect HTTP, get an HTTP connection manager on the original destination
+// cluster, with the HTTP telemetry.
+func (ps *PushContext) initPassthroughPorts(services []*Service) {
+	for _, svc := range services {
+		if svc.Resolution != Passthrough {
+			continue
+		}
+		for _, port := range svc.Ports {
+			key := fmt.Sprintf("%s/%s:%d", svc.Attributes.Namespace, svc.Hostname, port.Port)
+			switch {
+			case port.Protocol.IsHTTP():
+				ps.Add(PassthroughHTTPPorts, key, nil, string(port.Protocol))
+			case port.Protocol.IsUnsupported():
+				ps.Add(PassthroughSniffedPorts, key, nil, "protocol detected by the proxies")
+			}
+		}
+	}
+}
+
+// initScaledToZero caches the services with an activator and without endpoints. The registries push a full update
+// when the endpoints of a service with an activator are removed or return, so that the routes are updated.
+func (ps *PushContext) initScaledToZero(env *Environment, services []*Service) {
+	for _, svc := range services {
+		if svc.Attributes.Activator == "" {
+			continue
+		}
+		scaledToZero := true
+		for _, port := range svc.Ports {
+			instances, err := env.InstancesByPort(svc, port.Port, nil)
+			if err != nil || len(instances) > 0 {
+				scaledToZero = false
+				break
+			}
+		}
+		if scaledToZero {
+			ps.scaledToZero[svc.Hostname] = true
+		}
+	}
+}
+
+// IsScaledToZero returns true if the requests to a service are sent to its activator, as it has no endpoints.
+func (ps *PushContext) IsScaledToZero(hostname host.Name) bool {
+	return ps.scaledToZero[hostname]
+}
+
 // sortServicesByCreationTime sorts the list of services in ascending order by their creation time (if available).
 func sortServicesByCreationTime(services []*Service) []*Service {
 	sort.SliceStable(services, func(i, j int) bool {
@@ -1013,6 +1154,10 @@ func (ps *PushContext) initVirtualServices(env *Environment) error {
 		vservices[i] = virtualServices[i].DeepCopy()
 	}
 
+	if env.WeightRamps != nil {
+		env.WeightRamps.Apply(vservices, time.Now())
+	}
+
 	totalVirtualServices.Record(float64(len(virtualServices)))
 
 	// TODO(rshriram): parse each virtual service and maintain a map of the
@@ -1269,8 +1414,8 @@ func authenticationPolicyForWorkload(policiesByPort []*authnPolicyByPort, port *
 // This also allows tests to inject a config without having the mock.
 // This will not work properly for Sidecars, which will precompute their destination rules on init
 func (ps *PushContext) SetDestinationRules(configs []Config) {
-	// Sort by time first. So if two destination rule have top level traffic policies
-	// we take the first one.
+	// Sort by time first. So if two destination rules set the same traffic policy settings
+	// we take the ones of the first one.
 	sortConfigByCreationTime(configs)
 	namespaceLocalDestRules := make(map[string]*processedDestRules)
 	namespaceExportedDestRules := make(map[string]*processedDestRules)
@@ -1451,11 +1596,11 @@ func (ps *PushContext) mergeGateways(proxy *Proxy) *MergedGateway {
 		gw := cfg.Spec.(*networking.Gateway)
 		if gw.GetSelector() == nil {
 			// no selector. Applies to all workloads asking for the gateway
-			out = append(out, cfg)
+			out = append(out, ps.authorizeGatewayCredentials(cfg, proxy))
 		} else {
 			gatewaySelector := labels.Instance(gw.GetSelector())
 			if proxy.WorkloadLabels.IsSupersetOf(gatewaySelector) {
-				out = append(out, cfg)
+				out = append(out, ps.authorizeGatewayCredentials(cfg, proxy))
 			}
 		}
 	}
@@ -1463,5 +1608,7 @@ func (ps *PushContext) mergeGateways(proxy *Proxy) *MergedGateway {
 	if len(out) == 0 {
 		return nil
 	}
-	return MergeGateways(out...)
+	merged := MergeGateways(out...)
+	ps.resolveGRPCJSONTranscoders(merged, proxy)
+	return merged
 }
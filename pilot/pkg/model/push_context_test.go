@@ -27,6 +27,7 @@ import (
 	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/config/host"
 	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/protocol"
 	"istio.io/istio/pkg/config/schema"
 	"istio.io/istio/pkg/config/schemas"
 )
@@ -129,6 +130,41 @@ func TestMergeUpdateRequest(t *testing.T) {
 	}
 }
 
+func TestInitPassthroughPorts(t *testing.T) {
+	ps := NewPushContext()
+	ps.initPassthroughPorts([]*Service{
+		{
+			Hostname:   "*.example.com",
+			Resolution: Passthrough,
+			Ports: PortList{
+				{Name: "http", Port: 80, Protocol: protocol.HTTP},
+				{Name: "tls", Port: 443, Protocol: protocol.TLS},
+				{Name: "auto", Port: 8080, Protocol: protocol.Unsupported},
+			},
+			Attributes: ServiceAttributes{Namespace: "egress"},
+		},
+		{
+			Hostname:   "api.example.com",
+			Resolution: DNSLB,
+			Ports:      PortList{{Name: "http", Port: 80, Protocol: protocol.HTTP}},
+			Attributes: ServiceAttributes{Namespace: "egress"},
+		},
+	})
+
+	for metric, want := range map[string][]string{
+		PassthroughHTTPPorts.Name():    {"egress/*.example.com:80"},
+		PassthroughSniffedPorts.Name(): {"egress/*.example.com:8080"},
+	} {
+		got := make([]string, 0)
+		for key := range ps.ProxyStatus[metric] {
+			got = append(got, key)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s got ports %v, want %v", metric, got, want)
+		}
+	}
+}
+
 func TestAuthNPolicies(t *testing.T) {
 	const testNamespace string = "test-namespace"
 	ps := NewPushContext()
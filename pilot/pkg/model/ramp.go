@@ -0,0 +1,401 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	networking "istio.io/api/networking/v1alpha3"
+)
+
+const (
+	// RampDurationAnnotation on a VirtualService, e.g. 30m, ramps the weights of its HTTP route destinations
+	// over the duration when they change, from the weights in effect to the new ones, instead of switching at
+	// once. The VirtualService is not modified, only the weights pushed to the proxies.
+	RampDurationAnnotation = "networking.istio.io/rampDuration"
+
+	// RampPausedAnnotation set to "true" on a VirtualService pauses the ramp of its weights.
+	RampPausedAnnotation = "networking.istio.io/rampPaused"
+
+	// RampPauseErrorRateAnnotation on a VirtualService holds the ramp of its weights while the error rate of
+	// the virtual service, as reported by the ErrorRate of the WeightRamps, is above the value, e.g. 0.01.
+	RampPauseErrorRateAnnotation = "networking.istio.io/rampPauseErrorRate"
+
+	// RampAbortErrorRateAnnotation on a VirtualService aborts the ramp of its weights, reverting to the weights
+	// in effect before it, when the error rate of the virtual service is above the value, e.g. 0.05. The ramp
+	// restarts when the weights of the VirtualService change.
+	RampAbortErrorRateAnnotation = "networking.istio.io/rampAbortErrorRate"
+
+	// RampStatusAnnotation on a VirtualService is the progress of the ramp of its weights, written by Pilot so
+	// that the ramp resumes where it was after a restart of Pilot, and is shared by its replicas.
+	RampStatusAnnotation = "networking.istio.io/rampStatus"
+)
+
+// ErrorRateFunc returns the ratio of the requests to the destination hosts of a virtual service failing.
+type ErrorRateFunc func(hosts []string) (float64, error)
+
+// WeightRamps tracks the ramps of the route weights of the virtual services. The ramps are advanced by the
+// pushes, each one generating the weights in effect at its time.
+type WeightRamps struct {
+	// ErrorRate, if set, is used to pause or abort the ramps on errors.
+	ErrorRate ErrorRateFunc
+
+	mu sync.Mutex
+	// ramps by namespace/name of the virtual service
+	ramps map[string]*weightRamp
+	// statusUpdates are the RampStatusAnnotation values to write, by namespace/name of the virtual service
+	statusUpdates map[string]string
+}
+
+// rampStatus is the progress of a ramp, as persisted in the RampStatusAnnotation.
+type rampStatus struct {
+	From    [][]int32     `json:"from"`
+	To      [][]int32     `json:"to"`
+	Start   time.Time     `json:"start"`
+	Elapsed time.Duration `json:"elapsed,omitempty"`
+	Paused  bool          `json:"paused,omitempty"`
+	Held    bool          `json:"held,omitempty"`
+	Aborted bool          `json:"aborted,omitempty"`
+}
+
+// weightRamp is the ramp of the weights of the HTTP route destinations of a virtual service.
+type weightRamp struct {
+	from     [][]int32
+	to       [][]int32
+	duration time.Duration
+
+	// start of the ramp, or of its last resumption
+	start time.Time
+	// elapsed is the ramp time before the last pause
+	elapsed time.Duration
+	// paused by the annotation, or held while the error rate is too high
+	paused bool
+	held   bool
+
+	aborted bool
+	done    bool
+
+	pauseErrorRate float64
+	abortErrorRate float64
+
+	// hosts are the destination hosts of the HTTP routes, whose error rate pauses or aborts the ramp
+	hosts []string
+	// status is the last RampStatusAnnotation value of the ramp, read or written
+	status string
+}
+
+// NewWeightRamps creates the tracker of the weight ramps.
+func NewWeightRamps() *WeightRamps {
+	return &WeightRamps{ramps: make(map[string]*weightRamp), statusUpdates: make(map[string]string)}
+}
+
+// Apply sets the weights in effect at the time in the virtual services with the RampDurationAnnotation,
+// starting a ramp when their weights change. The virtual services must be copies.
+func (w *WeightRamps) Apply(virtualServices []Config, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	seen := make(map[string]bool, len(w.ramps))
+	for _, vs := range virtualServices {
+		duration, err := time.ParseDuration(vs.Annotations[RampDurationAnnotation])
+		if err != nil || duration <= 0 {
+			continue
+		}
+		key := vs.Namespace + "/" + vs.Name
+		seen[key] = true
+		spec := vs.Spec.(*networking.VirtualService)
+		target := routeWeights(spec)
+
+		// The persisted ramp is the one of a previous Pilot, or of another replica.
+		statusValue := vs.Annotations[RampStatusAnnotation]
+		persisted := parseRampStatus(statusValue, duration, now)
+
+		r, exists := w.ramps[key]
+		switch {
+		case !exists && persisted != nil && equalWeights(persisted.to, target):
+			r = persisted
+			w.ramps[key] = r
+		case !exists && persisted != nil && sameShape(persisted.to, target):
+			// The weights changed while Pilot was down.
+			r = &weightRamp{from: persisted.weights(now), to: target, start: now}
+			w.ramps[key] = r
+		case !exists:
+			// The initial weights are not ramped.
+			r = &weightRamp{from: target, to: target, start: now, done: true}
+			w.ramps[key] = r
+		case !equalWeights(r.to, target):
+			if persisted != nil && equalWeights(persisted.to, target) {
+				*r = *persisted
+				break
+			}
+			current := r.weights(now)
+			if !sameShape(current, target) {
+				current = target
+			}
+			*r = weightRamp{from: current, to: target, start: now}
+		}
+		r.duration = duration
+		r.pauseErrorRate = parseErrorRate(vs.Annotations[RampPauseErrorRateAnnotation])
+		r.abortErrorRate = parseErrorRate(vs.Annotations[RampAbortErrorRateAnnotation])
+		r.hosts = destinationHosts(spec, vs.ConfigMeta)
+		r.freeze(now, vs.Annotations[RampPausedAnnotation] == "true", r.held)
+		if r.status == "" {
+			r.status = statusValue
+		}
+		w.updateStatus(key, r)
+
+		setRouteWeights(spec, r.weights(now))
+	}
+	for key := range w.ramps {
+		if !seen[key] {
+			delete(w.ramps, key)
+			delete(w.statusUpdates, key)
+		}
+	}
+}
+
+// TakeStatusUpdates returns the RampStatusAnnotation values to write on the virtual services, by
+// namespace/name, and forgets them.
+func (w *WeightRamps) TakeStatusUpdates() map[string]string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := w.statusUpdates
+	w.statusUpdates = make(map[string]string)
+	return out
+}
+
+// updateStatus records the status of the ramp to write if it changed. The initial weights are not persisted.
+func (w *WeightRamps) updateStatus(key string, r *weightRamp) {
+	if r.done && r.status == "" {
+		return
+	}
+	value, err := json.Marshal(rampStatus{
+		From:    r.from,
+		To:      r.to,
+		Start:   r.start,
+		Elapsed: r.elapsed,
+		Paused:  r.paused,
+		Held:    r.held,
+		Aborted: r.aborted,
+	})
+	if err != nil {
+		log.Warnf("failed to encode the weight ramp status of %s: %v", key, err)
+		return
+	}
+	if string(value) != r.status {
+		r.status = string(value)
+		w.statusUpdates[key] = r.status
+	}
+}
+
+// parseRampStatus returns the ramp of the RampStatusAnnotation value, or nil if it is not set or invalid.
+func parseRampStatus(value string, duration time.Duration, now time.Time) *weightRamp {
+	if value == "" {
+		return nil
+	}
+	status := rampStatus{}
+	if err := json.Unmarshal([]byte(value), &status); err != nil || !sameShape(status.From, status.To) {
+		log.Warnf("ignoring the invalid weight ramp status %q", value)
+		return nil
+	}
+	r := &weightRamp{
+		from:     status.From,
+		to:       status.To,
+		duration: duration,
+		start:    status.Start,
+		elapsed:  status.Elapsed,
+		paused:   status.Paused,
+		held:     status.Held,
+		aborted:  status.Aborted,
+		status:   value,
+	}
+	r.done = r.progress(now) >= 1
+	return r
+}
+
+// destinationHosts returns the sorted fully qualified destination hosts of the HTTP routes.
+func destinationHosts(spec *networking.VirtualService, meta ConfigMeta) []string {
+	seen := make(map[string]bool)
+	out := make([]string, 0)
+	for _, route := range spec.Http {
+		for _, dst := range route.Route {
+			if dst.Destination == nil {
+				continue
+			}
+			h := string(ResolveShortnameToFQDN(dst.Destination.Host, meta))
+			if !seen[h] {
+				seen[h] = true
+				out = append(out, h)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Step checks the error rates of the ramps in progress, pausing or aborting them, and returns true if the
+// weights in effect may have changed since the last step, i.e. if the virtual services need to be pushed.
+func (w *WeightRamps) Step(now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	changed := false
+	for key, r := range w.ramps {
+		if r.done || r.aborted || r.paused {
+			continue
+		}
+		if w.ErrorRate != nil && (r.pauseErrorRate > 0 || r.abortErrorRate > 0) {
+			rate, err := w.ErrorRate(r.hosts)
+			if err != nil {
+				log.Warnf("holding the weight ramp of %s: %v", key, err)
+				r.freeze(now, r.paused, true)
+				w.updateStatus(key, r)
+				continue
+			}
+			if r.abortErrorRate > 0 && rate > r.abortErrorRate {
+				log.Warnf("aborting the weight ramp of %s: error rate %v above %v", key, rate, r.abortErrorRate)
+				r.aborted = true
+				w.updateStatus(key, r)
+				changed = true
+				continue
+			}
+			r.freeze(now, r.paused, r.pauseErrorRate > 0 && rate > r.pauseErrorRate)
+			w.updateStatus(key, r)
+			if r.held {
+				continue
+			}
+		}
+		changed = true
+		if r.progress(now) >= 1 {
+			r.done = true
+		}
+	}
+	return changed
+}
+
+// freeze pauses or resumes the ramp, keeping the ramp time elapsed.
+func (r *weightRamp) freeze(now time.Time, paused, held bool) {
+	wasFrozen := r.paused || r.held
+	r.paused, r.held = paused, held
+	isFrozen := r.paused || r.held
+	if !wasFrozen && isFrozen {
+		r.elapsed += now.Sub(r.start)
+	} else if wasFrozen && !isFrozen {
+		r.start = now
+	}
+}
+
+func (r *weightRamp) progress(now time.Time) float64 {
+	elapsed := r.elapsed
+	if !r.paused && !r.held {
+		elapsed += now.Sub(r.start)
+	}
+	if r.duration <= 0 || elapsed >= r.duration {
+		return 1
+	}
+	return float64(elapsed) / float64(r.duration)
+}
+
+// weights returns the weights in effect at the time. The weights of each route keep the sum of the target.
+func (r *weightRamp) weights(now time.Time) [][]int32 {
+	if r.aborted {
+		return r.from
+	}
+	p := r.progress(now)
+	if p >= 1 {
+		return r.to
+	}
+	out := make([][]int32, len(r.to))
+	for i := range r.to {
+		out[i] = make([]int32, len(r.to[i]))
+		var sum, targetSum int32
+		for j := range r.to[i] {
+			targetSum += r.to[i][j]
+			if j == len(r.to[i])-1 {
+				break
+			}
+			out[i][j] = r.from[i][j] + int32(math.Round(float64(r.to[i][j]-r.from[i][j])*p))
+			sum += out[i][j]
+		}
+		if last := len(r.to[i]) - 1; last >= 0 {
+			out[i][last] = targetSum - sum
+			if out[i][last] < 0 {
+				out[i][last] = 0
+			}
+		}
+	}
+	return out
+}
+
+func routeWeights(spec *networking.VirtualService) [][]int32 {
+	out := make([][]int32, len(spec.Http))
+	for i, route := range spec.Http {
+		out[i] = make([]int32, len(route.Route))
+		for j, dst := range route.Route {
+			out[i][j] = dst.Weight
+		}
+	}
+	return out
+}
+
+func setRouteWeights(spec *networking.VirtualService, weights [][]int32) {
+	for i, route := range spec.Http {
+		for j, dst := range route.Route {
+			dst.Weight = weights[i][j]
+		}
+	}
+}
+
+func sameShape(a, b [][]int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalWeights(a, b [][]int32) bool {
+	if !sameShape(a, b) {
+		return false
+	}
+	for i := range a {
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func parseErrorRate(value string) float64 {
+	if value == "" {
+		return 0
+	}
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 {
+		return 0
+	}
+	return rate
+}
@@ -0,0 +1,149 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	networking "istio.io/api/networking/v1alpha3"
+)
+
+func TestWeightRamps(t *testing.T) {
+	virtualService := func(annotations map[string]string, v1, v2 int32) []Config {
+		return []Config{{
+			ConfigMeta: ConfigMeta{Name: "reviews", Namespace: "default", Annotations: annotations},
+			Spec: &networking.VirtualService{
+				Hosts: []string{"reviews"},
+				Http: []*networking.HTTPRoute{{
+					Route: []*networking.HTTPRouteDestination{
+						{Destination: &networking.Destination{Host: "reviews", Subset: "v1"}, Weight: v1},
+						{Destination: &networking.Destination{Host: "reviews", Subset: "v2"}, Weight: v2},
+					},
+				}},
+			},
+		}}
+	}
+	weights := func(vs []Config) []int32 {
+		return []int32{
+			vs[0].Spec.(*networking.VirtualService).Http[0].Route[0].Weight,
+			vs[0].Spec.(*networking.VirtualService).Http[0].Route[1].Weight,
+		}
+	}
+	apply := func(ramps *WeightRamps, annotations map[string]string, v1, v2 int32, now time.Time) []int32 {
+		vs := virtualService(annotations, v1, v2)
+		ramps.Apply(vs, now)
+		return weights(vs)
+	}
+	expect := func(t *testing.T, got []int32, want ...int32) {
+		t.Helper()
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got weights %v, want %v", got, want)
+		}
+	}
+
+	start := time.Now()
+	ramp := map[string]string{RampDurationAnnotation: "10m"}
+
+	t.Run("ramp", func(t *testing.T) {
+		ramps := NewWeightRamps()
+		expect(t, apply(ramps, ramp, 100, 0, start), 100, 0)
+		expect(t, apply(ramps, ramp, 0, 100, start), 100, 0)
+		if !ramps.Step(start.Add(time.Minute)) {
+			t.Error("Step() = false for a ramp in progress")
+		}
+		expect(t, apply(ramps, ramp, 0, 100, start.Add(5*time.Minute)), 50, 50)
+		expect(t, apply(ramps, ramp, 0, 100, start.Add(10*time.Minute)), 0, 100)
+		if !ramps.Step(start.Add(10 * time.Minute)) {
+			t.Error("Step() = false for the last step of a ramp")
+		}
+		if ramps.Step(start.Add(11 * time.Minute)) {
+			t.Error("Step() = true for a finished ramp")
+		}
+	})
+
+	t.Run("no ramp without annotation", func(t *testing.T) {
+		ramps := NewWeightRamps()
+		expect(t, apply(ramps, nil, 100, 0, start), 100, 0)
+		expect(t, apply(ramps, nil, 0, 100, start), 0, 100)
+	})
+
+	t.Run("paused", func(t *testing.T) {
+		ramps := NewWeightRamps()
+		paused := map[string]string{RampDurationAnnotation: "10m", RampPausedAnnotation: "true"}
+		apply(ramps, ramp, 100, 0, start)
+		apply(ramps, ramp, 0, 100, start)
+		expect(t, apply(ramps, paused, 0, 100, start.Add(2*time.Minute)), 80, 20)
+		expect(t, apply(ramps, paused, 0, 100, start.Add(8*time.Minute)), 80, 20)
+		expect(t, apply(ramps, ramp, 0, 100, start.Add(11*time.Minute)), 80, 20)
+		expect(t, apply(ramps, ramp, 0, 100, start.Add(14*time.Minute)), 50, 50)
+	})
+
+	t.Run("aborted on errors", func(t *testing.T) {
+		ramps := NewWeightRamps()
+		ramps.ErrorRate = func(hosts []string) (float64, error) {
+			if !reflect.DeepEqual(hosts, []string{"reviews.default.svc.cluster.local"}) {
+				t.Errorf("got error rate hosts %v", hosts)
+			}
+			return 0.1, nil
+		}
+		abort := map[string]string{RampDurationAnnotation: "10m", RampAbortErrorRateAnnotation: "0.05"}
+		apply(ramps, abort, 100, 0, start)
+		apply(ramps, abort, 0, 100, start)
+		if !ramps.Step(start.Add(time.Minute)) {
+			t.Error("Step() = false for an aborted ramp")
+		}
+		expect(t, apply(ramps, abort, 0, 100, start.Add(5*time.Minute)), 100, 0)
+	})
+
+	t.Run("held on errors", func(t *testing.T) {
+		ramps := NewWeightRamps()
+		ramps.ErrorRate = func(hosts []string) (float64, error) { return 0.02, nil }
+		hold := map[string]string{RampDurationAnnotation: "10m", RampPauseErrorRateAnnotation: "0.01"}
+		apply(ramps, hold, 100, 0, start)
+		apply(ramps, hold, 0, 100, start)
+		if ramps.Step(start.Add(time.Minute)) {
+			t.Error("Step() = true for a held ramp")
+		}
+		expect(t, apply(ramps, hold, 0, 100, start.Add(5*time.Minute)), 90, 10)
+	})
+	t.Run("persisted", func(t *testing.T) {
+		ramps := NewWeightRamps()
+		apply(ramps, ramp, 100, 0, start)
+		if updates := ramps.TakeStatusUpdates(); len(updates) != 0 {
+			t.Errorf("got status updates %v for the initial weights", updates)
+		}
+		apply(ramps, ramp, 0, 100, start)
+		updates := ramps.TakeStatusUpdates()
+		status, f := updates["default/reviews"]
+		if !f {
+			t.Fatalf("got status updates %v, want the status of the ramp", updates)
+		}
+
+		// A restarted Pilot resumes the ramp.
+		restarted := NewWeightRamps()
+		persisted := map[string]string{RampDurationAnnotation: "10m", RampStatusAnnotation: status}
+		expect(t, apply(restarted, persisted, 0, 100, start.Add(5*time.Minute)), 50, 50)
+		if updates := restarted.TakeStatusUpdates(); len(updates) != 0 {
+			t.Errorf("got status updates %v for an unchanged ramp", updates)
+		}
+
+		// The ramp restarts from the weights in effect if they changed while Pilot was down.
+		restarted = NewWeightRamps()
+		expect(t, apply(restarted, persisted, 100, 0, start.Add(5*time.Minute)), 50, 50)
+		expect(t, apply(restarted, persisted, 100, 0, start.Add(15*time.Minute)), 100, 0)
+	})
+}
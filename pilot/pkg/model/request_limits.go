@@ -0,0 +1,87 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxRequestBytesAnnotation on a Gateway buffers the requests of its HTTP servers up to the size, in bytes,
+	// rejecting the larger requests with a 413. Set on a VirtualService, it overrides the size for its routes on
+	// the gateways with a size, and "0" disables the buffering of its routes, e.g. for streaming uploads.
+	MaxRequestBytesAnnotation = "networking.istio.io/maxRequestBytes"
+
+	// MaxRequestHeadersKbAnnotation on a Gateway is the maximum size, in KiB, of the request headers of its HTTP
+	// servers, between 1 and 96, rejecting the larger requests with a 431.
+	MaxRequestHeadersKbAnnotation = "networking.istio.io/maxRequestHeadersKb"
+)
+
+// maxRequestHeadersKb is the upper bound of the size of the request headers accepted by Envoy.
+const maxRequestHeadersKb = 96
+
+// RequestLimits are the limits of the size of the requests of a gateway server.
+type RequestLimits struct {
+	// MaxRequestBytes, if set, is the size up to which the requests are buffered.
+	MaxRequestBytes uint32
+	// MaxRequestHeadersKb, if set, is the maximum size of the request headers.
+	MaxRequestHeadersKb uint32
+}
+
+// ParseRequestLimits returns the request limits set by the annotations of a gateway, or nil if there is none.
+func ParseRequestLimits(annotations map[string]string) (*RequestLimits, error) {
+	maxBytes, hasMaxBytes := annotations[MaxRequestBytesAnnotation]
+	maxHeaders, hasMaxHeaders := annotations[MaxRequestHeadersKbAnnotation]
+	if !hasMaxBytes && !hasMaxHeaders {
+		return nil, nil
+	}
+
+	limits := &RequestLimits{}
+	if hasMaxBytes {
+		v, err := ParseMaxRequestBytes(maxBytes)
+		if err != nil {
+			return nil, err
+		}
+		limits.MaxRequestBytes = v
+	}
+	if hasMaxHeaders {
+		v, err := ParseMaxRequestHeadersKb(maxHeaders)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", MaxRequestHeadersKbAnnotation, err)
+		}
+		limits.MaxRequestHeadersKb = v
+	}
+	return limits, nil
+}
+
+// ParseMaxRequestHeadersKb parses a maximum size of the request headers, in KiB.
+func ParseMaxRequestHeadersKb(value string) (uint32, error) {
+	v, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+	if err != nil || v == 0 || v > maxRequestHeadersKb {
+		return 0, fmt.Errorf("%q must be an integer between 1 and %d", value, maxRequestHeadersKb)
+	}
+	return uint32(v), nil
+}
+
+// ParseMaxRequestBytes parses the value of the MaxRequestBytesAnnotation.
+func ParseMaxRequestBytes(value string) (uint32, error) {
+	v, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %v", MaxRequestBytesAnnotation, value, err)
+	}
+	return uint32(v), nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRequestLimits(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		expected    *RequestLimits
+		expectErr   bool
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:        "body size",
+			annotations: map[string]string{MaxRequestBytesAnnotation: "1048576"},
+			expected:    &RequestLimits{MaxRequestBytes: 1048576},
+		},
+		{
+			name:        "body and headers sizes",
+			annotations: map[string]string{MaxRequestBytesAnnotation: "1024", MaxRequestHeadersKbAnnotation: "32"},
+			expected:    &RequestLimits{MaxRequestBytes: 1024, MaxRequestHeadersKb: 32},
+		},
+		{
+			name:        "invalid body size",
+			annotations: map[string]string{MaxRequestBytesAnnotation: "1Mi"},
+			expectErr:   true,
+		},
+		{
+			name:        "headers size too large",
+			annotations: map[string]string{MaxRequestHeadersKbAnnotation: "97"},
+			expectErr:   true,
+		},
+		{
+			name:        "zero headers size",
+			annotations: map[string]string{MaxRequestHeadersKbAnnotation: "0"},
+			expectErr:   true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRequestLimits(tt.annotations)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParseRequestLimits() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ParseRequestLimits() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
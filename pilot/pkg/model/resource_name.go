@@ -0,0 +1,79 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"istio.io/istio/pilot/pkg/features"
+)
+
+const (
+	// resourceNameHashSeparator separates the truncated name from its hash suffix.
+	resourceNameHashSeparator = "~"
+
+	// resourceNameHashLength is the length of the hash suffix, including the separator.
+	resourceNameHashLength = 9
+)
+
+// isValidResourceNameChar returns true for the characters allowed in resource names. The other
+// characters would be rewritten in the stats names or break their parsing.
+func isValidResourceNameChar(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.|:*", r)
+}
+
+// NormalizeResourceName returns the name with the invalid characters replaced, truncated to
+// features.MaxResourceNameLength characters. Normalized names end with a hash of the full name, so
+// that different names stay different and the same name is always normalized the same way. The
+// name is returned unchanged when features.MaxResourceNameLength is 0.
+func NormalizeResourceName(name string) string {
+	return normalizeResourceName(name, features.MaxResourceNameLength)
+}
+
+func normalizeResourceName(name string, maxLength int) string {
+	if maxLength <= 0 {
+		return name
+	}
+	out := strings.Map(func(r rune) rune {
+		if isValidResourceNameChar(r) {
+			return r
+		}
+		return '_'
+	}, name)
+	if out != name || (maxLength > resourceNameHashLength && len(out) > maxLength) {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(name))
+		suffix := fmt.Sprintf("%s%08x", resourceNameHashSeparator, h.Sum32())
+		if maxLength > resourceNameHashLength && len(out) > maxLength-len(suffix) {
+			out = out[:maxLength-len(suffix)]
+		}
+		out += suffix
+	}
+	return out
+}
+
+// NormalizedResourceNames returns the mapping of the normalized names to the names they were
+// built from, for the names changed by NormalizeResourceName.
+func NormalizedResourceNames(names []string) map[string]string {
+	out := make(map[string]string)
+	for _, name := range names {
+		if normalized := NormalizeResourceName(name); normalized != name {
+			out[normalized] = name
+		}
+	}
+	return out
+}
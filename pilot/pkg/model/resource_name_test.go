@@ -0,0 +1,62 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeResourceName(t *testing.T) {
+	short := "outbound|80|v1|foo.default.svc.cluster.local"
+	if got := normalizeResourceName(short, 60); got != short {
+		t.Errorf("got %s but want %s unchanged", got, short)
+	}
+
+	long := "outbound|8080|canary-version-with-a-long-name|a-very-long-service-name.some-namespace.svc.cluster.local"
+	if got := normalizeResourceName(long, 0); got != long {
+		t.Errorf("got %s but want %s unchanged without limit", got, long)
+	}
+	other := strings.Replace(long, "canary", "stable", 1)
+	got := normalizeResourceName(long, 60)
+	if len(got) != 60 {
+		t.Errorf("got %s of length %d but want 60", got, len(got))
+	}
+	if again := normalizeResourceName(long, 60); again != got {
+		t.Errorf("got %s then %s but want a deterministic truncation", got, again)
+	}
+	if gotOther := normalizeResourceName(other, 60); gotOther == got {
+		t.Errorf("got %s for both %s and %s", got, long, other)
+	}
+
+	invalid := "outbound|80|v1|foo bar"
+	if got := normalizeResourceName(invalid, 0); got != invalid {
+		t.Errorf("got %s but want %s unchanged without limit", got, invalid)
+	}
+	if got := normalizeResourceName(invalid, 60); strings.Contains(got, " ") {
+		t.Errorf("got %s but want the space replaced", got)
+	}
+}
+
+func TestNormalizedResourceNames(t *testing.T) {
+	// Without limit, no name is normalized.
+	names := []string{
+		"outbound|80|v1|foo.default.svc.cluster.local",
+		"outbound|80|v1|foo bar",
+	}
+	if got := NormalizedResourceNames(names); len(got) != 0 {
+		t.Errorf("got %v but want no normalized names", got)
+	}
+}
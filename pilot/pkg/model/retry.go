@@ -0,0 +1,38 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+const (
+	// RetryHostPredicatesAnnotation on a VirtualService, or on the DestinationRule of the destination of a route,
+	// sets the hosts avoided by the retries of the routes, as a comma separated list of previousHosts, the hosts
+	// already attempted by the request, and canaryHosts, the endpoints labeled with CanaryLabel. It is
+	// previousHosts by default, and none retries on any host. The annotation of the VirtualService has precedence.
+	RetryHostPredicatesAnnotation = "networking.istio.io/retryHostPredicates"
+
+	// RetryHostSelectionMaxAttemptsAnnotation on a VirtualService, or on the DestinationRule of the destination of
+	// a route, sets the maximum number of attempts to select a host not avoided by the retries, 5 by default.
+	RetryHostSelectionMaxAttemptsAnnotation = "networking.istio.io/retryHostSelectionMaxAttempts"
+
+	// HedgeDelayAnnotation on a VirtualService hedges the requests of its HTTP routes matching the GET or HEAD
+	// method: after the delay, e.g. 50ms, or the per try timeout of the retries of the route if set, a second
+	// request is sent, to the next locality by priority when locality failover is enabled, without canceling the
+	// first one, and the first response is used. It is meant for the idempotent reads of global services with
+	// strict tail latency objectives.
+	HedgeDelayAnnotation = "networking.istio.io/hedgeDelay"
+
+	// CanaryLabel set to "true" on a workload marks its endpoints as canaries, which are avoided by the retries of
+	// the routes with the canaryHosts retry host predicate.
+	CanaryLabel = "networking.istio.io/canary"
+)
@@ -0,0 +1,95 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	networking "istio.io/api/networking/v1alpha3"
+)
+
+// GatewayNamespacesAnnotation on a secret grants the gateways of other namespaces the access to the secret, with a
+// credentialName of the form <namespace>/<name>. Its value is a comma separated list of the namespaces of the
+// gateways, or "*" for all of them.
+const GatewayNamespacesAnnotation = "networking.istio.io/gatewayNamespaces"
+
+// SecretGrants tells whether the secrets of other namespaces grant the access to the gateways of a namespace.
+type SecretGrants interface {
+	// AuthorizeCredential returns an error if the secret referenced by a credentialName of the form
+	// <namespace>/<name> does not grant the access to the gateways of gatewayNamespace.
+	AuthorizeCredential(credentialName, gatewayNamespace string) error
+}
+
+// SplitCredentialName returns the namespace and the name of the secret of a credentialName, the namespace being
+// empty for the secrets of the namespace of the gateway.
+func SplitCredentialName(credentialName string) (string, string) {
+	if i := strings.Index(credentialName, "/"); i >= 0 {
+		return credentialName[:i], credentialName[i+1:]
+	}
+	return "", credentialName
+}
+
+// AuthorizeGatewayNamespace returns an error if the GatewayNamespacesAnnotation of the annotations of a secret does
+// not grant the access to the gateways of the namespace.
+func AuthorizeGatewayNamespace(annotations map[string]string, gatewayNamespace string) error {
+	granted, ok := annotations[GatewayNamespacesAnnotation]
+	if !ok {
+		return fmt.Errorf("no %s annotation", GatewayNamespacesAnnotation)
+	}
+	for _, ns := range strings.Split(granted, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "*" || (ns != "" && ns == gatewayNamespace) {
+			return nil
+		}
+	}
+	return fmt.Errorf("namespace %q is not listed in the %s annotation %q",
+		gatewayNamespace, GatewayNamespacesAnnotation, granted)
+}
+
+// authorizeGatewayCredentials returns the gateway without the servers whose credentialName references a secret of
+// another namespace not granting the access to the gateways of the namespace of the proxy. The ignored servers are
+// reported in the push status.
+func (ps *PushContext) authorizeGatewayCredentials(cfg Config, proxy *Proxy) Config {
+	gw := cfg.Spec.(*networking.Gateway)
+	var servers []*networking.Server
+	for _, server := range gw.Servers {
+		credentialName := server.GetTls().GetCredentialName()
+		namespace, _ := SplitCredentialName(credentialName)
+		if namespace == "" || namespace == proxy.ConfigNamespace {
+			servers = append(servers, server)
+			continue
+		}
+		var err error
+		if ps.Env == nil || ps.Env.SecretGrants == nil {
+			err = fmt.Errorf("the secrets of other namespaces are not enabled")
+		} else {
+			err = ps.Env.SecretGrants.AuthorizeCredential(credentialName, proxy.ConfigNamespace)
+		}
+		if err != nil {
+			ps.Add(GatewayCredentialDenied, cfg.Namespace+"/"+cfg.Name+"/"+credentialName, proxy, err.Error())
+			continue
+		}
+		servers = append(servers, server)
+	}
+	if len(servers) == len(gw.Servers) {
+		return cfg
+	}
+	filtered := *gw
+	filtered.Servers = servers
+	out := cfg
+	out.Spec = &filtered
+	return out
+}
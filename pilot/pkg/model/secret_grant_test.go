@@ -0,0 +1,84 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	networking "istio.io/api/networking/v1alpha3"
+)
+
+type fakeSecretGrants map[string]string
+
+func (f fakeSecretGrants) AuthorizeCredential(credentialName, gatewayNamespace string) error {
+	return AuthorizeGatewayNamespace(map[string]string{GatewayNamespacesAnnotation: f[credentialName]}, gatewayNamespace)
+}
+
+func TestAuthorizeGatewayCredentials(t *testing.T) {
+	server := func(credentialName string) *networking.Server {
+		return &networking.Server{
+			Hosts: []string{"*"},
+			Tls:   &networking.Server_TLSOptions{Mode: networking.Server_TLSOptions_SIMPLE, CredentialName: credentialName},
+		}
+	}
+	cfg := Config{
+		ConfigMeta: ConfigMeta{Name: "gw", Namespace: "istio-system"},
+		Spec: &networking.Gateway{
+			Servers: []*networking.Server{
+				server("local"),
+				server("istio-system/local"),
+				server("shared-certs/granted"),
+				server("shared-certs/all"),
+				server("private-certs/denied"),
+			},
+		},
+	}
+	grants := fakeSecretGrants{
+		"shared-certs/granted": "other-gateways, istio-system",
+		"shared-certs/all":     "*",
+		"private-certs/denied": "other-gateways",
+	}
+	proxy := &Proxy{ID: "gateway", ConfigNamespace: "istio-system"}
+
+	cases := []struct {
+		name   string
+		grants SecretGrants
+		want   []string
+	}{
+		{"granted", grants, []string{"local", "istio-system/local", "shared-certs/granted", "shared-certs/all"}},
+		{"disabled", nil, []string{"local", "istio-system/local"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ps := NewPushContext()
+			ps.Env = &Environment{SecretGrants: tc.grants}
+			out := ps.authorizeGatewayCredentials(cfg, proxy)
+			var got []string
+			for _, s := range out.Spec.(*networking.Gateway).Servers {
+				got = append(got, s.Tls.CredentialName)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("got servers %v, want %v", got, tc.want)
+			}
+			if len(cfg.Spec.(*networking.Gateway).Servers) != 5 {
+				t.Errorf("the servers of the gateway config were modified")
+			}
+			if _, f := ps.ProxyStatus[GatewayCredentialDenied.Name()]["istio-system/gw/private-certs/denied"]; !f {
+				t.Errorf("the denied server is not reported: %v", ps.ProxyStatus)
+			}
+		})
+	}
+}
@@ -124,8 +124,56 @@ const (
 
 	// MTLSReadyLabelName name for the mtlsReady label given to service instances to toggle mTLS autopilot
 	MTLSReadyLabelName = "security.istio.io/" + MTLSReadyLabelShortname
+
+	// TLSModeLabelShortname name used for the endpoint level tls mode metadata, matched by the transport sockets
+	TLSModeLabelShortname = "tlsMode"
+
+	// TLSModeLabelName name of the pod annotation, or service entry endpoint label, advertising the inbound
+	// TLS mode of a workload
+	TLSModeLabelName = "security.istio.io/" + TLSModeLabelShortname
+
+	// TrustDomainLabelShortname name used for the endpoint level trust domain metadata, matched by the
+	// transport sockets validating the endpoints with the root of their trust domain
+	TrustDomainLabelShortname = "trustDomain"
 )
 
+// EndpointTLSMode is the inbound TLS mode advertised by a workload, for its clients to use mTLS or plaintext
+// during the migrations from plaintext to strict mTLS.
+type EndpointTLSMode string
+
+const (
+	// EndpointTLSModeUnset falls back to the mtlsReady label of the workload.
+	EndpointTLSModeUnset EndpointTLSMode = ""
+	// EndpointTLSModePlaintext workloads only accept plaintext.
+	EndpointTLSModePlaintext EndpointTLSMode = "plaintext"
+	// EndpointTLSModePermissive workloads accept both mTLS and plaintext.
+	EndpointTLSModePermissive EndpointTLSMode = "permissive"
+	// EndpointTLSModeStrict workloads only accept mTLS.
+	EndpointTLSModeStrict EndpointTLSMode = "strict"
+)
+
+// ParseEndpointTLSMode parses the TLS mode advertised by a workload. Unknown modes are unset.
+func ParseEndpointTLSMode(mode string) EndpointTLSMode {
+	switch m := EndpointTLSMode(strings.ToLower(mode)); m {
+	case EndpointTLSModePlaintext, EndpointTLSModePermissive, EndpointTLSModeStrict:
+		return m
+	default:
+		return EndpointTLSModeUnset
+	}
+}
+
+// AcceptsMTLS returns whether the workload accepts mTLS, given its mtlsReady label when the mode is unset.
+func (m EndpointTLSMode) AcceptsMTLS(mtlsReady bool) bool {
+	switch m {
+	case EndpointTLSModePermissive, EndpointTLSModeStrict:
+		return true
+	case EndpointTLSModePlaintext:
+		return false
+	default:
+		return mtlsReady
+	}
+}
+
 // Port represents a network port where a service is listening for
 // connections. The port should be annotated with the type of protocol
 // used by the port.
@@ -267,6 +315,7 @@ type ServiceInstance struct {
 	Labels         labels.Instance `json:"labels,omitempty"`
 	ServiceAccount string          `json:"serviceaccount,omitempty"`
 	MTLSReady      bool            `json:"mtlsReady,omitempty"`
+	TLSMode        EndpointTLSMode `json:"tlsMode,omitempty"`
 }
 
 // GetLocality returns the availability zone from an instance. If service instance label for locality
@@ -354,6 +403,9 @@ type IstioEndpoint struct {
 
 	// MTLSReady endpoint is injected with istio sidecar and ready to configure Istio mTLS
 	MTLSReady bool
+
+	// TLSMode is the inbound TLS mode advertised by the workload, overriding MTLSReady when set
+	TLSMode EndpointTLSMode
 }
 
 // ServiceAttributes represents a group of custom attributes of the service.
@@ -379,6 +431,18 @@ type ServiceAttributes struct {
 	// Used by the aggregator to aggregate the Attributes.ClusterExternalAddresses
 	// for clusters where the service resides
 	ClusterExternalAddresses map[string][]string
+
+	// ExternalName is the DNS name a Kubernetes ExternalName service is an alias for.
+	ExternalName string
+
+	// RewriteHostToExternalName indicates that the Host header of requests to an ExternalName
+	// service should be rewritten to ExternalName.
+	RewriteHostToExternalName bool
+
+	// Activator is the <hostname>:<port> of the activator of a service which can be scaled to zero. While the
+	// service has no endpoints, its requests are sent to the activator, which scales it up and buffers the
+	// requests until it is ready.
+	Activator string
 }
 
 // ServiceDiscovery enumerates Istio service instances.
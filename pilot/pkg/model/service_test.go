@@ -263,3 +263,28 @@ func TestGetLocality(t *testing.T) {
 		})
 	}
 }
+
+func TestEndpointTLSMode(t *testing.T) {
+	cases := []struct {
+		annotation string
+		mode       EndpointTLSMode
+		mtlsReady  bool
+		accepts    bool
+	}{
+		{"", EndpointTLSModeUnset, false, false},
+		{"", EndpointTLSModeUnset, true, true},
+		{"Strict", EndpointTLSModeStrict, false, true},
+		{"permissive", EndpointTLSModePermissive, false, true},
+		{"plaintext", EndpointTLSModePlaintext, true, false},
+		{"unknown", EndpointTLSModeUnset, true, true},
+	}
+	for _, c := range cases {
+		mode := ParseEndpointTLSMode(c.annotation)
+		if mode != c.mode {
+			t.Errorf("ParseEndpointTLSMode(%q) => %q, want %q", c.annotation, mode, c.mode)
+		}
+		if got := mode.AcceptsMTLS(c.mtlsReady); got != c.accepts {
+			t.Errorf("%q.AcceptsMTLS(%v) => %v, want %v", mode, c.mtlsReady, got, c.accepts)
+		}
+	}
+}
@@ -155,17 +155,28 @@ func createNamespaceForHostname(egress []*IstioEgressListenerWrapper) map[host.N
 // that matches the default Istio behavior: a sidecar has listeners for all services in the mesh
 // We use this scope when the user has not set any sidecar Config for a given config namespace.
 func DefaultSidecarScopeForNamespace(ps *PushContext, configNamespace string) *SidecarScope {
-	dummyNode := Proxy{
+	dummyNode := &Proxy{
 		ConfigNamespace: configNamespace,
 	}
+	return newDefaultSidecarScope(ps, dummyNode)
+}
 
+// DebugSidecarScope returns the scope of the debug proxies, with all the services, virtual services and
+// destination rules of the mesh regardless of their visibility.
+func DebugSidecarScope(ps *PushContext) *SidecarScope {
+	return newDefaultSidecarScope(ps, nil)
+}
+
+// newDefaultSidecarScope returns the scope with egress */* of the configs visible to the dummy node, or of all
+// the configs if the dummy node is nil.
+func newDefaultSidecarScope(ps *PushContext, dummyNode *Proxy) *SidecarScope {
 	defaultEgressListener := &IstioEgressListenerWrapper{
 		listenerHosts: map[string][]host.Name{wildcardNamespace: {wildcardService}},
 	}
-	defaultEgressListener.services = ps.Services(&dummyNode)
+	defaultEgressListener.services = ps.Services(dummyNode)
 
 	meshGateway := map[string]bool{constants.IstioMeshGateway: true}
-	defaultEgressListener.virtualServices = ps.VirtualServices(&dummyNode, meshGateway)
+	defaultEgressListener.virtualServices = ps.VirtualServices(dummyNode, meshGateway)
 
 	out := &SidecarScope{
 		EgressListeners:       []*IstioEgressListenerWrapper{defaultEgressListener},
@@ -179,7 +190,7 @@ func DefaultSidecarScopeForNamespace(ps *PushContext, configNamespace string) *S
 	// this config namespace) will see, identify all the destinationRules
 	// that these services need
 	for _, s := range out.services {
-		out.destinationRules[s.Hostname] = ps.DestinationRule(&dummyNode, s)
+		out.destinationRules[s.Hostname] = ps.DestinationRule(dummyNode, s)
 		out.namespaceDependencies[s.Attributes.Namespace] = struct{}{}
 	}
 
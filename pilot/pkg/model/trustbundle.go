@@ -0,0 +1,23 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+// TrustBundle provides the root certificates trusted by the workloads in addition to the mesh root, e.g. the roots
+// of external CAs.
+type TrustBundle interface {
+	// MergedRoots returns the PEM of the mesh root followed by the additional roots, or nil if there are no
+	// additional roots.
+	MergedRoots() []byte
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/protocol"
+)
+
+// The HTTP routes apply to the HTTP ports and the TCP and TLS routes to the other ports. Both apply to the ports
+// with an unknown protocol, which is sniffed.
+func acceptsHTTPRoutes(p protocol.Instance) bool {
+	return p.IsHTTP() || p.IsUnsupported()
+}
+
+func acceptsTCPRoutes(p protocol.Instance) bool {
+	return !p.IsHTTP()
+}
+
+// appliesToMesh returns true if the gateways of a virtual service, or of a match, include the sidecars. The rules
+// of the other gateways apply to the ports of the gateways rather than to the ports of the services.
+func appliesToMesh(gateways []string) bool {
+	if len(gateways) == 0 {
+		return true
+	}
+	for _, g := range gateways {
+		if g == constants.IstioMeshGateway {
+			return true
+		}
+	}
+	return false
+}
+
+// VirtualServicePortErrors returns the rules of the virtual service that cannot apply to the ports of the service
+// of one of its hosts because of their protocols, e.g. an HTTP route matching a TCP port, or TCP routes for a
+// service with only HTTP ports. These rules are ignored for the ports. Only the rules applying to the sidecars are
+// checked.
+func VirtualServicePortErrors(rule *networking.VirtualService, svc *Service) []string {
+	if !appliesToMesh(rule.Gateways) {
+		return nil
+	}
+	var errs []string
+	checkPort := func(kind string, name string, port uint32, accepts func(protocol.Instance) bool) bool {
+		servicePort, exists := svc.Ports.GetByPort(int(port))
+		if !exists {
+			errs = append(errs, fmt.Sprintf("%s route %q matches port %d undefined by service %s", kind, name, port, svc.Hostname))
+			return false
+		}
+		if !accepts(servicePort.Protocol) {
+			errs = append(errs, fmt.Sprintf("%s route %q matches port %d of service %s with protocol %s",
+				kind, name, port, svc.Hostname, servicePort.Protocol))
+			return false
+		}
+		return true
+	}
+	anyPort := func(accepts func(protocol.Instance) bool) bool {
+		for _, port := range svc.Ports {
+			if accepts(port.Protocol) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i, route := range rule.Http {
+		name := route.Name
+		if name == "" {
+			name = fmt.Sprint(i)
+		}
+		portMatched, meshMatched := false, len(route.Match) == 0
+		for _, match := range route.Match {
+			if !appliesToMesh(match.Gateways) {
+				continue
+			}
+			meshMatched = true
+			if match.GetPort() != 0 {
+				portMatched = true
+				checkPort("HTTP", name, match.GetPort(), acceptsHTTPRoutes)
+			}
+		}
+		if meshMatched && !portMatched && !anyPort(acceptsHTTPRoutes) {
+			errs = append(errs, fmt.Sprintf("HTTP route %q applies to no port of service %s, which has no HTTP port",
+				name, svc.Hostname))
+		}
+	}
+	// checkL4 checks the ports of the matches applying to the sidecars, all the ports if the route has no match.
+	checkL4 := func(kind string, i int, matches int, matchPorts []uint32) {
+		if matches > 0 && len(matchPorts) == 0 {
+			return
+		}
+		name := fmt.Sprint(i)
+		portMatched := false
+		for _, port := range matchPorts {
+			if port != 0 {
+				portMatched = true
+				checkPort(kind, name, port, acceptsTCPRoutes)
+			}
+		}
+		if !portMatched && !anyPort(acceptsTCPRoutes) {
+			errs = append(errs, fmt.Sprintf("%s route %q applies to no port of service %s, which has only HTTP ports",
+				kind, name, svc.Hostname))
+		}
+	}
+	for i, route := range rule.Tcp {
+		ports := make([]uint32, 0, len(route.Match))
+		for _, match := range route.Match {
+			if appliesToMesh(match.Gateways) {
+				ports = append(ports, match.GetPort())
+			}
+		}
+		checkL4("TCP", i, len(route.Match), ports)
+	}
+	for i, route := range rule.Tls {
+		ports := make([]uint32, 0, len(route.Match))
+		for _, match := range route.Match {
+			if appliesToMesh(match.Gateways) {
+				ports = append(ports, match.GetPort())
+			}
+		}
+		checkL4("TLS", i, len(route.Match), ports)
+	}
+	return errs
+}
+
+// initVirtualServicePortErrors reports the rules of the virtual services that cannot apply to the ports of the
+// services of their hosts, as the services and the virtual services may change independently.
+func (ps *PushContext) initVirtualServicePortErrors() {
+	virtualServices := append([]Config{}, ps.publicVirtualServices...)
+	for _, configs := range ps.privateVirtualServicesByNamespace {
+		virtualServices = append(virtualServices, configs...)
+	}
+	for _, virtualService := range virtualServices {
+		rule := virtualService.Spec.(*networking.VirtualService)
+		for _, h := range rule.Hosts {
+			var errs []string
+			seen := make(map[string]bool)
+			for _, svc := range ps.ServiceByHostnameAndNamespace[host.Name(h)] {
+				for _, err := range VirtualServicePortErrors(rule, svc) {
+					if !seen[err] {
+						seen[err] = true
+						errs = append(errs, err)
+					}
+				}
+			}
+			if len(errs) > 0 {
+				sort.Strings(errs)
+				ps.Add(VirtualServicePortConflicts, virtualService.Namespace+"/"+virtualService.Name+"/"+h, nil,
+					strings.Join(errs, "; "))
+			}
+		}
+	}
+}
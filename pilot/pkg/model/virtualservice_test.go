@@ -0,0 +1,142 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"reflect"
+	"testing"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pkg/config/protocol"
+)
+
+func TestVirtualServicePortErrors(t *testing.T) {
+	mixed := &Service{
+		Hostname: "db.default.svc.cluster.local",
+		Ports: PortList{
+			{Name: "http", Port: 8080, Protocol: protocol.HTTP},
+			{Name: "tcp", Port: 5432, Protocol: protocol.TCP},
+			{Name: "sniffed", Port: 9000, Protocol: protocol.Unsupported},
+		},
+	}
+	httpOnly := &Service{
+		Hostname: "web.default.svc.cluster.local",
+		Ports:    PortList{{Name: "http", Port: 80, Protocol: protocol.HTTP}},
+	}
+	httpRoute := func(name string, port uint32) *networking.HTTPRoute {
+		route := &networking.HTTPRoute{Name: name}
+		if port != 0 {
+			route.Match = []*networking.HTTPMatchRequest{{Port: port}}
+		}
+		return route
+	}
+	tcpRoute := func(port uint32) *networking.TCPRoute {
+		route := &networking.TCPRoute{}
+		if port != 0 {
+			route.Match = []*networking.L4MatchAttributes{{Port: port}}
+		}
+		return route
+	}
+
+	cases := []struct {
+		name     string
+		rule     *networking.VirtualService
+		svc      *Service
+		expected []string
+	}{
+		{
+			name: "routes by port protocol",
+			rule: &networking.VirtualService{
+				Http: []*networking.HTTPRoute{httpRoute("api", 8080), httpRoute("", 9000), httpRoute("default", 0)},
+				Tcp:  []*networking.TCPRoute{tcpRoute(5432), tcpRoute(9000), tcpRoute(0)},
+			},
+			svc: mixed,
+		},
+		{
+			name: "HTTP route matching a TCP port",
+			rule: &networking.VirtualService{Http: []*networking.HTTPRoute{httpRoute("api", 5432)}},
+			svc:  mixed,
+			expected: []string{
+				`HTTP route "api" matches port 5432 of service db.default.svc.cluster.local with protocol TCP`,
+			},
+		},
+		{
+			name: "TCP route matching an HTTP port",
+			rule: &networking.VirtualService{Tcp: []*networking.TCPRoute{tcpRoute(8080)}},
+			svc:  mixed,
+			expected: []string{
+				`TCP route "0" matches port 8080 of service db.default.svc.cluster.local with protocol HTTP`,
+			},
+		},
+		{
+			name: "undefined port",
+			rule: &networking.VirtualService{Http: []*networking.HTTPRoute{httpRoute("", 1234)}},
+			svc:  mixed,
+			expected: []string{
+				`HTTP route "0" matches port 1234 undefined by service db.default.svc.cluster.local`,
+			},
+		},
+		{
+			name: "TCP route without port for HTTP only service",
+			rule: &networking.VirtualService{
+				Http: []*networking.HTTPRoute{httpRoute("default", 0)},
+				Tcp:  []*networking.TCPRoute{tcpRoute(0)},
+			},
+			svc: httpOnly,
+			expected: []string{
+				`TCP route "0" applies to no port of service web.default.svc.cluster.local, which has only HTTP ports`,
+			},
+		},
+		{
+			name: "gateway bound virtual service",
+			rule: &networking.VirtualService{
+				Gateways: []string{"istio-system/ingressgateway"},
+				Http:     []*networking.HTTPRoute{httpRoute("api", 443)},
+				Tcp:      []*networking.TCPRoute{tcpRoute(0)},
+			},
+			svc: httpOnly,
+		},
+		{
+			name: "gateway bound matches",
+			rule: &networking.VirtualService{
+				Gateways: []string{"istio-system/ingressgateway", "mesh"},
+				Http: []*networking.HTTPRoute{{
+					Name: "api",
+					Match: []*networking.HTTPMatchRequest{
+						{Port: 443, Gateways: []string{"istio-system/ingressgateway"}},
+						{Port: 5432, Gateways: []string{"mesh"}},
+					},
+				}},
+				Tcp: []*networking.TCPRoute{{
+					Match: []*networking.L4MatchAttributes{{Port: 15443, Gateways: []string{"istio-system/ingressgateway"}}},
+				}},
+			},
+			svc: mixed,
+			expected: []string{
+				`HTTP route "api" matches port 5432 of service db.default.svc.cluster.local with protocol TCP`,
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got := VirtualServicePortErrors(tt.rule, tt.svc)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
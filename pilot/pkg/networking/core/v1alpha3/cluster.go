@@ -16,6 +16,8 @@ package v1alpha3
 
 import (
 	"fmt"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -26,6 +28,7 @@ import (
 	endpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
 	envoy_type "github.com/envoyproxy/go-control-plane/envoy/type"
 	"github.com/gogo/protobuf/types"
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 	structpb "github.com/golang/protobuf/ptypes/struct"
 	"github.com/golang/protobuf/ptypes/wrappers"
@@ -65,6 +68,13 @@ const (
 	subsetNameStatPattern      = "%SUBSET_NAME%"
 )
 
+const (
+	// envoyDefaultMaxRequests and envoyDefaultMaxRetries are the values Envoy uses for the circuit
+	// breaker parameters max_requests and max_retries when they are not set.
+	envoyDefaultMaxRequests = 1024
+	envoyDefaultMaxRetries  = 3
+)
+
 var (
 	defaultInboundCircuitBreakerThresholds  = v2Cluster.CircuitBreakers_Thresholds{}
 	defaultOutboundCircuitBreakerThresholds = v2Cluster.CircuitBreakers_Thresholds{
@@ -97,8 +107,6 @@ func getDefaultCircuitBreakerThresholds(direction model.TrafficDirection) *v2Clu
 	return &thresholds
 }
 
-// TODO: Need to do inheritance of DestRules based on domain suffix match
-
 // BuildClusters returns the list of clusters for the given proxy. This is the CDS output
 // For outbound: Cluster for each service/subset hostname or cidr with SNI set to service hostname
 // Cluster type based on resolution
@@ -148,13 +156,59 @@ func (configgen *ConfigGeneratorImpl) BuildClusters(env *model.Environment, prox
 	return clusters
 }
 
+// gatewayDestinations returns the destination hosts of the virtual services of a gateway in the gateway only mode,
+// or nil if the gateway needs the clusters of all the services, e.g. in sni-dnat mode.
+func gatewayDestinations(push *model.PushContext, proxy *model.Proxy) map[host.Name]bool {
+	if !features.GatewayOnly.Get() || proxy.Type != model.Router || proxy.GetRouterMode() == model.SniDnatRouter {
+		return nil
+	}
+	out := make(map[host.Name]bool)
+	if proxy.MergedGateway == nil {
+		return out
+	}
+	gateways := make(map[string]bool)
+	for _, name := range proxy.MergedGateway.GatewayNameForServer {
+		gateways[name] = true
+	}
+	for _, cfg := range push.VirtualServices(proxy, gateways) {
+		vs := cfg.Spec.(*networking.VirtualService)
+		for _, route := range vs.Http {
+			for _, dst := range route.Route {
+				out[host.Name(dst.GetDestination().GetHost())] = true
+			}
+			if route.Mirror != nil {
+				out[host.Name(route.Mirror.Host)] = true
+			}
+		}
+		for _, route := range vs.Tcp {
+			for _, dst := range route.Route {
+				out[host.Name(dst.GetDestination().GetHost())] = true
+			}
+		}
+		for _, route := range vs.Tls {
+			for _, dst := range route.Route {
+				out[host.Name(dst.GetDestination().GetHost())] = true
+			}
+		}
+	}
+	return out
+}
+
 // resolves cluster name conflicts. there can be duplicate cluster names if there are conflicting service definitions.
 // for any clusters that share the same name the first cluster is kept and the others are discarded.
+// The stat names of the clusters are normalized to the maximum resource name length.
 func normalizeClusters(push *model.PushContext, proxy *model.Proxy, clusters []*apiv2.Cluster) []*apiv2.Cluster {
 	have := make(map[string]bool)
 	out := make([]*apiv2.Cluster, 0, len(clusters))
 	for _, cluster := range clusters {
 		if !have[cluster.Name] {
+			statName := cluster.AltStatName
+			if statName == "" {
+				statName = cluster.Name
+			}
+			if normalized := model.NormalizeResourceName(statName); normalized != statName {
+				cluster.AltStatName = normalized
+			}
 			out = append(out, cluster)
 		} else {
 			push.Add(model.DuplicatedClusters, cluster.Name, proxy,
@@ -178,47 +232,108 @@ func castDestinationRuleOrDefault(config *model.Config) *networking.DestinationR
 func (configgen *ConfigGeneratorImpl) buildOutboundClusters(env *model.Environment, proxy *model.Proxy, push *model.PushContext) []*apiv2.Cluster {
 	clusters := make([]*apiv2.Cluster, 0)
 
+	networkView := model.GetNetworkView(proxy)
+	destinations := gatewayDestinations(push, proxy)
+
+	for _, service := range push.Services(proxy) {
+		if destinations != nil && !destinations[service.Hostname] {
+			continue
+		}
+		destRule := push.DestinationRule(proxy, service)
+		if !features.EnableOutboundClusterCache {
+			clusters = append(clusters, configgen.buildOutboundServiceClusters(env, proxy, push, service, destRule, networkView)...)
+			continue
+		}
+		key := outboundClusterCacheKey{service: service, destinationRule: destRule, proxy: proxyClusterKey(proxy, networkView)}
+		serviceClusters, found := configgen.clusterCache.get(push, key)
+		if !found {
+			serviceClusters = configgen.buildOutboundServiceClusters(env, proxy, push, service, destRule, networkView)
+			configgen.clusterCache.add(push, key, serviceClusters)
+		}
+		clusters = append(clusters, serviceClusters...)
+	}
+
+	return clusters
+}
+
+// buildOutboundServiceClusters builds the outbound clusters of the ports and subsets of a service.
+func (configgen *ConfigGeneratorImpl) buildOutboundServiceClusters(env *model.Environment, proxy *model.Proxy,
+	push *model.PushContext, service *model.Service, destRule *model.Config, networkView map[string]bool) []*apiv2.Cluster {
+	clusters := make([]*apiv2.Cluster, 0)
+
 	inputParams := &plugin.InputParams{
 		Env:  env,
 		Push: push,
 		Node: proxy,
 	}
-	networkView := model.GetNetworkView(proxy)
+	for _, port := range service.Ports {
+		if port.Protocol == protocol.UDP {
+			continue
+		}
+		inputParams.Service = service
+		inputParams.Port = port
 
-	for _, service := range push.Services(proxy) {
-		destRule := push.DestinationRule(proxy, service)
-		for _, port := range service.Ports {
-			if port.Protocol == protocol.UDP {
-				continue
-			}
-			inputParams.Service = service
-			inputParams.Port = port
+		lbEndpoints := buildLocalityLbEndpoints(env, networkView, service, port.Port, nil)
 
-			lbEndpoints := buildLocalityLbEndpoints(env, networkView, service, port.Port, nil)
+		// create default cluster
+		discoveryType := convertResolution(proxy, service.Resolution)
+		clusterName := model.BuildSubsetKey(model.TrafficDirectionOutbound, "", service.Hostname, port.Port)
+		serviceAccounts := push.ServiceAccounts[service.Hostname][port.Port]
+		if subjectAltNames := model.IstioMutualSubjectAltNames(destRule, service, port.Port); subjectAltNames != nil {
+			serviceAccounts = subjectAltNames
+		}
+		defaultCluster := buildDefaultCluster(env, clusterName, discoveryType, lbEndpoints, model.TrafficDirectionOutbound, proxy, port, service.MeshExternal)
+		// If stat name is configured, build the alternate stats name.
+		if len(env.Mesh.OutboundClusterStatName) != 0 {
+			defaultCluster.AltStatName = altStatName(env.Mesh.OutboundClusterStatName, string(service.Hostname), "", port, service.Attributes)
+		}
 
-			// create default cluster
-			discoveryType := convertResolution(proxy, service.Resolution)
-			clusterName := model.BuildSubsetKey(model.TrafficDirectionOutbound, "", service.Hostname, port.Port)
-			serviceAccounts := push.ServiceAccounts[service.Hostname][port.Port]
-			defaultCluster := buildDefaultCluster(env, clusterName, discoveryType, lbEndpoints, model.TrafficDirectionOutbound, proxy, port, service.MeshExternal)
-			// If stat name is configured, build the alternate stats name.
-			if len(env.Mesh.OutboundClusterStatName) != 0 {
-				defaultCluster.AltStatName = altStatName(env.Mesh.OutboundClusterStatName, string(service.Hostname), "", port, service.Attributes)
-			}
+		setUpstreamProtocol(proxy, defaultCluster, port, model.TrafficDirectionOutbound)
+		clusters = append(clusters, defaultCluster)
+		destinationRule := castDestinationRuleOrDefault(destRule)
 
-			setUpstreamProtocol(proxy, defaultCluster, port, model.TrafficDirectionOutbound)
-			clusters = append(clusters, defaultCluster)
-			destinationRule := castDestinationRuleOrDefault(destRule)
+		var clusterMetadata *core.Metadata
+		if destRule != nil {
+			clusterMetadata = util.BuildConfigInfoMetadata(destRule.ConfigMeta)
+		}
 
-			var clusterMetadata *core.Metadata
-			if destRule != nil {
-				clusterMetadata = util.BuildConfigInfoMetadata(destRule.ConfigMeta)
+		defaultSni := istioMutualSNI(destRule, service, port, "")
+		opts := buildClusterOpts{
+			env:             env,
+			cluster:         defaultCluster,
+			policy:          destinationRule.TrafficPolicy,
+			port:            port,
+			serviceAccounts: serviceAccounts,
+			sni:             defaultSni,
+			clusterMode:     DefaultClusterMode,
+			direction:       model.TrafficDirectionOutbound,
+			proxy:           proxy,
+			meshExternal:    service.MeshExternal,
+		}
+
+		applyTrafficPolicy(opts, proxy)
+		applyExternalNameSni(defaultCluster, service)
+		applyUpstreamLimits(defaultCluster, destRule)
+		applyOriginalDstHeaderOverride(defaultCluster, proxy, destRule)
+		defaultCluster.Metadata = clusterMetadata
+		for _, subset := range destinationRule.Subsets {
+			subsetClusterName := model.BuildSubsetKey(model.TrafficDirectionOutbound, subset.Name, service.Hostname, port.Port)
+			defaultSni := istioMutualSNI(destRule, service, port, subset.Name)
+
+			// clusters with discovery type STATIC, STRICT_DNS rely on cluster.hosts field
+			// ServiceEntry's need to filter hosts based on subset.labels in order to perform weighted routing
+			if discoveryType != apiv2.Cluster_EDS && len(subset.Labels) != 0 {
+				lbEndpoints = buildLocalityLbEndpoints(env, networkView, service, port.Port, []labels.Instance{subset.Labels})
+			}
+			subsetCluster := buildDefaultCluster(env, subsetClusterName, discoveryType, lbEndpoints, model.TrafficDirectionOutbound, proxy, nil, service.MeshExternal)
+			if len(env.Mesh.OutboundClusterStatName) != 0 {
+				subsetCluster.AltStatName = altStatName(env.Mesh.OutboundClusterStatName, string(service.Hostname), subset.Name, port, service.Attributes)
 			}
+			setUpstreamProtocol(proxy, subsetCluster, port, model.TrafficDirectionOutbound)
 
-			defaultSni := model.BuildDNSSrvSubsetKey(model.TrafficDirectionOutbound, "", service.Hostname, port.Port)
 			opts := buildClusterOpts{
 				env:             env,
-				cluster:         defaultCluster,
+				cluster:         subsetCluster,
 				policy:          destinationRule.TrafficPolicy,
 				port:            port,
 				serviceAccounts: serviceAccounts,
@@ -228,68 +343,40 @@ func (configgen *ConfigGeneratorImpl) buildOutboundClusters(env *model.Environme
 				proxy:           proxy,
 				meshExternal:    service.MeshExternal,
 			}
-
 			applyTrafficPolicy(opts, proxy)
-			defaultCluster.Metadata = clusterMetadata
-			for _, subset := range destinationRule.Subsets {
-				subsetClusterName := model.BuildSubsetKey(model.TrafficDirectionOutbound, subset.Name, service.Hostname, port.Port)
-				defaultSni := model.BuildDNSSrvSubsetKey(model.TrafficDirectionOutbound, subset.Name, service.Hostname, port.Port)
-
-				// clusters with discovery type STATIC, STRICT_DNS rely on cluster.hosts field
-				// ServiceEntry's need to filter hosts based on subset.labels in order to perform weighted routing
-				if discoveryType != apiv2.Cluster_EDS && len(subset.Labels) != 0 {
-					lbEndpoints = buildLocalityLbEndpoints(env, networkView, service, port.Port, []labels.Instance{subset.Labels})
-				}
-				subsetCluster := buildDefaultCluster(env, subsetClusterName, discoveryType, lbEndpoints, model.TrafficDirectionOutbound, proxy, nil, service.MeshExternal)
-				if len(env.Mesh.OutboundClusterStatName) != 0 {
-					subsetCluster.AltStatName = altStatName(env.Mesh.OutboundClusterStatName, string(service.Hostname), subset.Name, port, service.Attributes)
-				}
-				setUpstreamProtocol(proxy, subsetCluster, port, model.TrafficDirectionOutbound)
-
-				opts := buildClusterOpts{
-					env:             env,
-					cluster:         subsetCluster,
-					policy:          destinationRule.TrafficPolicy,
-					port:            port,
-					serviceAccounts: serviceAccounts,
-					sni:             defaultSni,
-					clusterMode:     DefaultClusterMode,
-					direction:       model.TrafficDirectionOutbound,
-					proxy:           proxy,
-					meshExternal:    service.MeshExternal,
-				}
-				applyTrafficPolicy(opts, proxy)
 
-				opts = buildClusterOpts{
-					env:             env,
-					cluster:         subsetCluster,
-					policy:          subset.TrafficPolicy,
-					port:            port,
-					serviceAccounts: serviceAccounts,
-					sni:             defaultSni,
-					clusterMode:     DefaultClusterMode,
-					direction:       model.TrafficDirectionOutbound,
-					proxy:           proxy,
-					meshExternal:    service.MeshExternal,
-				}
-				applyTrafficPolicy(opts, proxy)
-
-				updateEds(subsetCluster)
-
-				subsetCluster.Metadata = clusterMetadata
-				// call plugins
-				for _, p := range configgen.Plugins {
-					p.OnOutboundCluster(inputParams, subsetCluster)
-				}
-				clusters = append(clusters, subsetCluster)
+			opts = buildClusterOpts{
+				env:             env,
+				cluster:         subsetCluster,
+				policy:          subset.TrafficPolicy,
+				port:            port,
+				serviceAccounts: serviceAccounts,
+				sni:             defaultSni,
+				clusterMode:     DefaultClusterMode,
+				direction:       model.TrafficDirectionOutbound,
+				proxy:           proxy,
+				meshExternal:    service.MeshExternal,
 			}
+			applyTrafficPolicy(opts, proxy)
+			applyExternalNameSni(subsetCluster, service)
+			applyUpstreamLimits(subsetCluster, destRule)
+			applyOriginalDstHeaderOverride(subsetCluster, proxy, destRule)
 
-			updateEds(defaultCluster)
+			updateEds(subsetCluster)
 
-			// call plugins for the default cluster
+			subsetCluster.Metadata = clusterMetadata
+			// call plugins
 			for _, p := range configgen.Plugins {
-				p.OnOutboundCluster(inputParams, defaultCluster)
+				p.OnOutboundCluster(inputParams, subsetCluster)
 			}
+			clusters = append(clusters, subsetCluster)
+		}
+
+		updateEds(defaultCluster)
+
+		// call plugins for the default cluster
+		for _, p := range configgen.Plugins {
+			p.OnOutboundCluster(inputParams, defaultCluster)
 		}
 	}
 
@@ -381,6 +468,16 @@ func (configgen *ConfigGeneratorImpl) buildOutboundSniDnatClusters(env *model.En
 	return clusters
 }
 
+// applyExternalNameSni sets the SNI of TLS originated to a Kubernetes ExternalName service to the
+// external name, unless the destination rule already specified one. The cluster name is meaningless
+// to the external server.
+func applyExternalNameSni(cluster *apiv2.Cluster, service *model.Service) {
+	if service.Attributes.ExternalName == "" || cluster.TlsContext == nil || cluster.TlsContext.Sni != "" {
+		return
+	}
+	cluster.TlsContext.Sni = service.Attributes.ExternalName
+}
+
 func updateEds(cluster *apiv2.Cluster) {
 	switch v := cluster.ClusterDiscoveryType.(type) {
 	case *apiv2.Cluster_Type:
@@ -435,7 +532,9 @@ func buildLocalityLbEndpoints(env *model.Environment, proxyNetworkView map[strin
 		if instance.Endpoint.LbWeight > 0 {
 			ep.LoadBalancingWeight.Value = instance.Endpoint.LbWeight
 		}
-		ep.Metadata = util.BuildLbEndpointMetadata(instance.Endpoint.UID, instance.Endpoint.Network, instance.MTLSReady)
+		ep.Metadata = util.BuildLbEndpointMetadata(instance.Endpoint.UID, instance.Endpoint.Network, instance.MTLSReady, instance.TLSMode)
+		ep.Metadata = util.AddTrustDomainMetadata(ep.Metadata, instance.ServiceAccount)
+		ep.Metadata = util.AddCanaryMetadata(ep.Metadata, instance.Labels)
 		locality := instance.GetLocality()
 		lbEndpoints[locality] = append(lbEndpoints[locality], ep)
 	}
@@ -833,8 +932,113 @@ func applyTrafficPolicy(opts buildClusterOpts, proxy *model.Proxy) {
 		autoMTLSEnabled := opts.env.Mesh.GetEnableAutoMtls().Value
 		var mtlsCtxType mtlsContextType
 		tls, mtlsCtxType = conditionallyConvertToIstioMtls(tls, opts.serviceAccounts, opts.sni, opts.proxy, autoMTLSEnabled, opts.meshExternal)
+		if tls == nil && features.EnableStrictEndpointMTLS && !opts.meshExternal && opts.direction == model.TrafficDirectionOutbound {
+			applyStrictEndpointTLSSettings(opts)
+			return
+		}
 		applyUpstreamTLSSettings(opts.env, opts.cluster, tls, mtlsCtxType, opts.proxy)
+		applyTrustDomainTransportSocketMatches(opts.cluster, tls)
+	}
+}
+
+// applyStrictEndpointTLSSettings sets up the transport sockets of a cluster without TLS settings to use Istio mTLS
+// to the endpoints advertising the strict TLS mode, which do not accept plaintext, and plaintext to the others.
+func applyStrictEndpointTLSSettings(opts buildClusterOpts) {
+	tls := buildIstioMutualTLS(opts.serviceAccounts, opts.sni, opts.proxy)
+	applyUpstreamTLSSettings(opts.env, opts.cluster, tls, autoDetected, opts.proxy)
+	if len(opts.cluster.TransportSocketMatches) == 0 {
+		return
+	}
+	// Matches the strict endpoints instead of the mtlsReady ones.
+	opts.cluster.TransportSocketMatches[0].Name = "tlsMode-strict"
+	opts.cluster.TransportSocketMatches[0].Match = &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			model.TLSModeLabelShortname: {Kind: &structpb.Value_StringValue{StringValue: string(model.EndpointTLSModeStrict)}},
+		},
+	}
+	applyTrustDomainTransportSocketMatches(opts.cluster, tls)
+}
+
+// applyTrustDomainTransportSocketMatches adds transport socket matches validating the endpoints of the trust domains
+// with a CA bundle, as advertised by their metadata, with the root of their trust domain instead of the mesh root.
+// The matches are added before the existing ones, and also require the fields of the match of the Istio mTLS
+// transport socket if the TLS mode is auto detected.
+func applyTrustDomainTransportSocketMatches(cluster *apiv2.Cluster, tls *networking.TLSSettings) {
+	if tls == nil || tls.Mode != networking.TLSSettings_ISTIO_MUTUAL {
+		return
+	}
+	bundles := util.TrustDomainCABundles()
+	if len(bundles) == 0 {
+		return
+	}
+	subjectAltNames := make(map[string][]string)
+	for _, san := range tls.SubjectAltNames {
+		td := util.SpiffeTrustDomain(san)
+		if _, f := bundles[td]; f {
+			subjectAltNames[td] = append(subjectAltNames[td], san)
+		}
+	}
+	if len(subjectAltNames) == 0 {
+		return
+	}
+
+	var tlsContext *auth.UpstreamTlsContext
+	var mtlsMatch *structpb.Struct
+	if cluster.TlsContext != nil {
+		tlsContext = cluster.TlsContext
+	} else if len(cluster.TransportSocketMatches) > 0 {
+		mtls := cluster.TransportSocketMatches[0]
+		tlsContext = &auth.UpstreamTlsContext{}
+		if err := ptypes.UnmarshalAny(mtls.TransportSocket.GetTypedConfig(), tlsContext); err != nil {
+			log.Errorf("error unmarshaling tls context of the transport socket %s of cluster %s, err=%v",
+				mtls.Name, cluster.Name, err)
+			return
+		}
+		mtlsMatch = mtls.Match
+	} else {
+		return
+	}
+
+	trustDomains := make([]string, 0, len(subjectAltNames))
+	for td := range subjectAltNames {
+		trustDomains = append(trustDomains, td)
 	}
+	sort.Strings(trustDomains)
+	matches := make([]*apiv2.Cluster_TransportSocketMatch, 0, len(trustDomains)+len(cluster.TransportSocketMatches))
+	for _, td := range trustDomains {
+		tdContext := proto.Clone(tlsContext).(*auth.UpstreamTlsContext)
+		tdContext.CommonTlsContext.ValidationContextType = &auth.CommonTlsContext_ValidationContext{
+			ValidationContext: &auth.CertificateValidationContext{
+				TrustedCa: &core.DataSource{
+					Specifier: &core.DataSource_InlineBytes{InlineBytes: bundles[td]},
+				},
+				VerifySubjectAltName: subjectAltNames[td],
+			},
+		}
+		typedConfig, err := ptypes.MarshalAny(tdContext)
+		if err != nil {
+			log.Errorf("error marshaling tls context of trust domain %s to transport_socket config for cluster %s, err=%v",
+				td, cluster.Name, err)
+			return
+		}
+
+		fields := map[string]*structpb.Value{}
+		for k, v := range mtlsMatch.GetFields() {
+			fields[k] = v
+		}
+		fields[model.TrustDomainLabelShortname] = &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: td}}
+		matches = append(matches, &apiv2.Cluster_TransportSocketMatch{
+			Name:  "trustDomain-" + td,
+			Match: &structpb.Struct{Fields: fields},
+			TransportSocket: &core.TransportSocket{
+				Name: util.EnvoyTLSSocketName,
+				ConfigType: &core.TransportSocket_TypedConfig{
+					TypedConfig: typedConfig,
+				},
+			},
+		})
+	}
+	cluster.TransportSocketMatches = append(matches, cluster.TransportSocketMatches...)
 }
 
 // FIXME: there isn't a way to distinguish between unset values and zero values
@@ -880,6 +1084,8 @@ func applyConnectionPool(env *model.Environment, cluster *apiv2.Cluster, setting
 		applyTCPKeepalive(env, cluster, settings)
 	}
 
+	capMaxRetries(threshold)
+
 	cluster.CircuitBreakers = &v2Cluster.CircuitBreakers{
 		Thresholds: []*v2Cluster.CircuitBreakers_Thresholds{threshold},
 	}
@@ -890,6 +1096,63 @@ func applyConnectionPool(env *model.Environment, cluster *apiv2.Cluster, setting
 	}
 }
 
+// istioMutualSNI returns the SNI of the ISTIO_MUTUAL connections to a subset of the service port: the one
+// templated by the destination rule, or the name of the cluster in the DNS SRV format by default.
+func istioMutualSNI(destRule *model.Config, service *model.Service, port *model.Port, subset string) string {
+	if sni := model.IstioMutualSNI(destRule, service, port.Port, subset); sni != "" {
+		return sni
+	}
+	return model.BuildDNSSrvSubsetKey(model.TrafficDirectionOutbound, subset, service.Hostname, port.Port)
+}
+
+// applyUpstreamLimits applies the limits of the annotations of the destination rule of the cluster, i.e. the
+// size of the buffers of the connections to the upstream hosts.
+func applyUpstreamLimits(cluster *apiv2.Cluster, destRule *model.Config) {
+	if destRule == nil {
+		return
+	}
+	if limit := model.UInt32Annotation(&destRule.ConfigMeta, model.ConnectionBufferLimitAnnotation); limit != nil {
+		cluster.PerConnectionBufferLimitBytes = &wrappers.UInt32Value{Value: *limit}
+	}
+}
+
+// originalDstHostHeader is the header picking the upstream host of the original destination clusters using it.
+const originalDstHostHeader = "x-envoy-original-dst-host"
+
+// applyOriginalDstHeaderOverride lets the requests of an original destination cluster pick their upstream host
+// with the x-envoy-original-dst-host header, if the destination rule of the cluster opts in. Only the gateways
+// get the override: the header is set by the applications, which must not pick the hosts of the sidecars.
+func applyOriginalDstHeaderOverride(cluster *apiv2.Cluster, proxy *model.Proxy, destRule *model.Config) {
+	if destRule == nil || proxy.Type != model.Router || cluster.GetType() != apiv2.Cluster_ORIGINAL_DST {
+		return
+	}
+	if enabled, _ := strconv.ParseBool(destRule.Annotations[model.OriginalDstHeaderOverrideAnnotation]); enabled {
+		cluster.LbConfig = &apiv2.Cluster_OriginalDstLbConfig_{
+			OriginalDstLbConfig: &apiv2.Cluster_OriginalDstLbConfig{UseHttpHeader: true},
+		}
+	}
+}
+
+// capMaxRetries lowers the maximum number of parallel retries of the thresholds to the mesh wide ratio
+// of their maximum number of parallel requests, so that retries can't amplify an overload of the backends.
+func capMaxRetries(threshold *v2Cluster.CircuitBreakers_Thresholds) {
+	if features.MaxRetriesRatio <= 0 || threshold.MaxRetries == nil {
+		// Without max_retries, Envoy allows envoyDefaultMaxRetries retries, below any ceiling.
+		return
+	}
+	maxRequests := uint32(envoyDefaultMaxRequests)
+	if threshold.MaxRequests != nil {
+		maxRequests = threshold.MaxRequests.Value
+	}
+	ceiling := uint32(math.Min(math.Ceil(float64(maxRequests)*features.MaxRetriesRatio), math.MaxUint32))
+	if ceiling < envoyDefaultMaxRetries {
+		ceiling = envoyDefaultMaxRetries
+	}
+	if threshold.MaxRetries.Value > ceiling {
+		threshold.MaxRetries = &wrappers.UInt32Value{Value: ceiling}
+	}
+}
+
 func applyTCPKeepalive(env *model.Environment, cluster *apiv2.Cluster, settings *networking.ConnectionPoolSettings) {
 	var keepaliveProbes uint32
 	var keepaliveTime *types.Duration
@@ -1139,6 +1402,12 @@ func applyUpstreamTLSSettings(env *model.Environment, cluster *apiv2.Cluster, tl
 			}
 		}
 
+		// The mesh root, mounted or fetched with SDS, is replaced by the mesh root merged with the roots of the
+		// trust bundles.
+		if tls.Mode == networking.TLSSettings_ISTIO_MUTUAL && (env.Mesh.SdsUdsPath != "" || proxy.Metadata.TLSClientRootCert == "") {
+			util.ApplyTrustBundleCA(env, cluster.TlsContext.CommonTlsContext)
+		}
+
 		// Set default SNI of cluster name for istio_mutual if sni is not set.
 		if len(tls.Sni) == 0 && tls.Mode == networking.TLSSettings_ISTIO_MUTUAL {
 			cluster.TlsContext.Sni = cluster.Name
@@ -0,0 +1,114 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	apiv2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/golang/protobuf/proto"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+)
+
+// outboundClusterCacheKey identifies the outbound clusters of a service built for a proxy. Within a push, the
+// clusters of a service only depend on its destination rule and on the attributes of the proxy in proxyClusterKey.
+type outboundClusterCacheKey struct {
+	service         *model.Service
+	destinationRule *model.Config
+	proxy           string
+}
+
+// outboundClusterCache reuses the outbound clusters of the services across the proxies of a push. The clusters
+// are copied in and out of the cache, as they are modified after they are built, e.g. by the locality load
+// balancing settings of the proxy and the envoy filters.
+type outboundClusterCache struct {
+	mutex sync.Mutex
+	// push is the push of the clusters. The cache is reset for a new push, as the services, the destination
+	// rules and the endpoints of the static clusters change.
+	push     *model.PushContext
+	clusters map[outboundClusterCacheKey][]*apiv2.Cluster
+}
+
+// get returns a copy of the clusters of the key built for the push, if any.
+func (c *outboundClusterCache) get(push *model.PushContext, key outboundClusterCacheKey) ([]*apiv2.Cluster, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.push != push {
+		return nil, false
+	}
+	clusters, found := c.clusters[key]
+	if !found {
+		return nil, false
+	}
+	return cloneClusters(clusters), true
+}
+
+// add adds a copy of the clusters of the key built for the push. The clusters of the previous push are dropped.
+func (c *outboundClusterCache) add(push *model.PushContext, key outboundClusterCacheKey, clusters []*apiv2.Cluster) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.push != push {
+		c.push = push
+		c.clusters = make(map[outboundClusterCacheKey][]*apiv2.Cluster)
+	}
+	c.clusters[key] = cloneClusters(clusters)
+}
+
+func cloneClusters(clusters []*apiv2.Cluster) []*apiv2.Cluster {
+	out := make([]*apiv2.Cluster, 0, len(clusters))
+	for _, c := range clusters {
+		out = append(out, proto.Clone(c).(*apiv2.Cluster))
+	}
+	return out
+}
+
+// proxyClusterKey returns the attributes of the proxy used by the outbound clusters of the services: the type
+// for the discovery types, the version for the load balancing and protocol sniffing, the TLS client certificates
+// and SDS token of the proxy, and the network view for the endpoints of the static clusters. The locality of the
+// proxy is applied to the clusters after they are built.
+func proxyClusterKey(proxy *model.Proxy, networkView map[string]bool) string {
+	networks := make([]string, 0, len(networkView))
+	for network, visible := range networkView {
+		if visible {
+			networks = append(networks, network)
+		}
+	}
+	sort.Strings(networks)
+
+	ge13 := "1.2"
+	if util.IsIstioVersionGE13(proxy) {
+		ge13 = "1.3"
+	}
+	var tlsClientRootCert, tlsClientCertChain, tlsClientKey, sdsTokenPath string
+	if proxy.Metadata != nil {
+		tlsClientRootCert = proxy.Metadata.TLSClientRootCert
+		tlsClientCertChain = proxy.Metadata.TLSClientCertChain
+		tlsClientKey = proxy.Metadata.TLSClientKey
+		sdsTokenPath = proxy.Metadata.SdsTokenPath
+	}
+	return strings.Join([]string{
+		string(proxy.Type),
+		ge13,
+		tlsClientRootCert,
+		tlsClientCertChain,
+		tlsClientKey,
+		sdsTokenPath,
+		strings.Join(networks, ","),
+	}, "~")
+}
@@ -0,0 +1,161 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"fmt"
+	"testing"
+
+	apiv2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/golang/protobuf/proto"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/fakes"
+	"istio.io/istio/pilot/pkg/networking/plugin"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/protocol"
+)
+
+func buildClusterCacheTestEnv(services int) *model.Environment {
+	svcs := make([]*model.Service, 0, services)
+	for i := 0; i < services; i++ {
+		svcs = append(svcs, &model.Service{
+			Hostname:    host.Name(fmt.Sprintf("svc%d.default.svc.cluster.local", i)),
+			Address:     fmt.Sprintf("10.0.%d.%d", i/256, i%256),
+			ClusterVIPs: make(map[string]string),
+			Ports: model.PortList{
+				{Name: "http", Port: 80, Protocol: protocol.HTTP},
+				{Name: "grpc", Port: 7070, Protocol: protocol.GRPC},
+			},
+			Resolution: model.ClientSideLB,
+			Attributes: model.ServiceAttributes{Namespace: "default"},
+		})
+	}
+	serviceDiscovery := &fakes.ServiceDiscovery{}
+	serviceDiscovery.ServicesReturns(svcs, nil)
+	return newTestEnvironment(serviceDiscovery, testMesh, &fakes.IstioConfigStore{})
+}
+
+func newClusterCacheTestProxy(env *model.Environment, ip string, meta *model.NodeMetadata) *model.Proxy {
+	proxy := &model.Proxy{
+		Type:         model.SidecarProxy,
+		IPAddresses:  []string{ip},
+		ID:           "pod-" + ip + ".default",
+		DNSDomain:    "default.svc.cluster.local",
+		Metadata:     meta,
+		IstioVersion: model.MaxIstioVersion,
+	}
+	proxy.SetSidecarScope(env.PushContext)
+	return proxy
+}
+
+func TestOutboundClusterCache(t *testing.T) {
+	env := buildClusterCacheTestEnv(2)
+	configgen := NewConfigGenerator([]plugin.Plugin{})
+
+	first := configgen.buildOutboundClusters(env, newClusterCacheTestProxy(env, "1.1.1.1", &model.NodeMetadata{}), env.PushContext)
+	if got := len(configgen.clusterCache.clusters); got != 2 {
+		t.Fatalf("got %d cached services, want 2", got)
+	}
+	// The clusters of the first proxy can be modified without changing those of the next proxies.
+	first[0].Name = "modified"
+
+	second := configgen.buildOutboundClusters(env, newClusterCacheTestProxy(env, "1.1.1.2", &model.NodeMetadata{}), env.PushContext)
+	if len(second) != len(first) {
+		t.Fatalf("got %d clusters, want %d", len(second), len(first))
+	}
+	if second[0].Name == "modified" {
+		t.Fatal("got the clusters of the first proxy, want copies")
+	}
+	if got := len(configgen.clusterCache.clusters); got != 2 {
+		t.Fatalf("got %d cached services, want the clusters of the first proxy reused", got)
+	}
+
+	// The clusters of the proxies with their own client certificates are not shared.
+	configgen.buildOutboundClusters(env, newClusterCacheTestProxy(env, "1.1.1.3", &model.NodeMetadata{
+		TLSClientCertChain: "/etc/certs/custom-chain.pem",
+	}), env.PushContext)
+	if got := len(configgen.clusterCache.clusters); got != 4 {
+		t.Fatalf("got %d cached services, want 4", got)
+	}
+
+	// The cache is reset for a new push.
+	push := model.NewPushContext()
+	if err := push.InitContext(env, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	configgen.buildOutboundClusters(env, newClusterCacheTestProxy(env, "1.1.1.1", &model.NodeMetadata{}), push)
+	if got := len(configgen.clusterCache.clusters); got != 2 {
+		t.Fatalf("got %d cached services after a new push, want 2", got)
+	}
+}
+
+func TestOutboundClusterCacheMatchesUncachedClusters(t *testing.T) {
+	env := buildClusterCacheTestEnv(3)
+	proxy := newClusterCacheTestProxy(env, "1.1.1.1", &model.NodeMetadata{})
+
+	defaultValue := features.EnableOutboundClusterCache
+	defer func() { features.EnableOutboundClusterCache = defaultValue }()
+
+	features.EnableOutboundClusterCache = false
+	want := NewConfigGenerator([]plugin.Plugin{}).buildOutboundClusters(env, proxy, env.PushContext)
+
+	features.EnableOutboundClusterCache = true
+	configgen := NewConfigGenerator([]plugin.Plugin{})
+	configgen.buildOutboundClusters(env, proxy, env.PushContext)
+	got := configgen.buildOutboundClusters(env, newClusterCacheTestProxy(env, "1.1.1.2", &model.NodeMetadata{}), env.PushContext)
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d clusters, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !proto.Equal(got[i], want[i]) {
+			t.Errorf("got cluster %v, want %v", got[i], want[i])
+		}
+	}
+}
+
+func benchmarkOutboundClusters(b *testing.B, cache bool) {
+	defaultValue := features.EnableOutboundClusterCache
+	defer func() { features.EnableOutboundClusterCache = defaultValue }()
+	features.EnableOutboundClusterCache = cache
+
+	env := buildClusterCacheTestEnv(500)
+	proxies := make([]*model.Proxy, 0, 20)
+	for i := 0; i < 20; i++ {
+		proxies = append(proxies, newClusterCacheTestProxy(env, fmt.Sprintf("1.1.1.%d", i), &model.NodeMetadata{}))
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		// A full push builds the clusters of all the proxies for a new push context.
+		configgen := NewConfigGenerator([]plugin.Plugin{})
+		var clusters []*apiv2.Cluster
+		for _, proxy := range proxies {
+			clusters = configgen.buildOutboundClusters(env, proxy, env.PushContext)
+		}
+		if len(clusters) == 0 {
+			b.Fatal("no clusters")
+		}
+	}
+}
+
+func BenchmarkOutboundClusters(b *testing.B) {
+	benchmarkOutboundClusters(b, false)
+}
+
+func BenchmarkOutboundClustersCached(b *testing.B) {
+	benchmarkOutboundClusters(b, true)
+}
@@ -16,7 +16,9 @@ package v1alpha3
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -27,6 +29,7 @@ import (
 	"istio.io/istio/pilot/pkg/networking/util"
 
 	apiv2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	auth "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
 	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	"github.com/gogo/protobuf/proto"
 	"github.com/gogo/protobuf/types"
@@ -138,6 +141,85 @@ func TestHTTPCircuitBreakerThresholds(t *testing.T) {
 	}
 }
 
+func TestMaxRetriesRatio(t *testing.T) {
+	defer func(ratio float64) { features.MaxRetriesRatio = ratio }(features.MaxRetriesRatio)
+	features.MaxRetriesRatio = 0.2
+
+	cases := []struct {
+		name     string
+		settings *networking.ConnectionPoolSettings
+		want     uint32
+	}{
+		{
+			name:     "default retries capped relative to envoy default requests",
+			settings: &networking.ConnectionPoolSettings{Tcp: &networking.ConnectionPoolSettings_TCPSettings{MaxConnections: 10}},
+			want:     205,
+		},
+		{
+			name: "configured retries capped relative to configured requests",
+			settings: &networking.ConnectionPoolSettings{Http: &networking.ConnectionPoolSettings_HTTPSettings{
+				Http2MaxRequests: 100,
+				MaxRetries:       50,
+			}},
+			want: 20,
+		},
+		{
+			name: "retries below the ceiling kept",
+			settings: &networking.ConnectionPoolSettings{Http: &networking.ConnectionPoolSettings_HTTPSettings{
+				Http2MaxRequests: 100,
+				MaxRetries:       10,
+			}},
+			want: 10,
+		},
+		{
+			name: "ceiling never below the envoy default",
+			settings: &networking.ConnectionPoolSettings{Http: &networking.ConnectionPoolSettings_HTTPSettings{
+				Http2MaxRequests: 5,
+				MaxRetries:       50,
+			}},
+			want: 3,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGomegaWithT(t)
+			clusters, err := buildTestClusters("*.example.org", 0, model.SidecarProxy, nil, testMesh,
+				&networking.DestinationRule{
+					Host:          "*.example.org",
+					TrafficPolicy: &networking.TrafficPolicy{ConnectionPool: tt.settings},
+				})
+			g.Expect(err).NotTo(HaveOccurred())
+			thresholds := clusters[0].CircuitBreakers.Thresholds[0]
+			g.Expect(thresholds.MaxRetries).To(Not(BeNil()))
+			g.Expect(thresholds.MaxRetries.Value).To(Equal(tt.want))
+		})
+	}
+	// The shared default thresholds are left untouched.
+	g := NewGomegaWithT(t)
+	g.Expect(defaultOutboundCircuitBreakerThresholds.MaxRetries.Value).To(Equal(uint32(1024)))
+}
+
+func TestNormalizeClusterStatNames(t *testing.T) {
+	defer func(length int) { features.MaxResourceNameLength = length }(features.MaxResourceNameLength)
+	features.MaxResourceNameLength = 40
+
+	g := NewGomegaWithT(t)
+	long := "outbound|8080|canary|a-very-long-service-name.some-namespace.svc.cluster.local"
+	short := "outbound|80||foo.default.svc.cluster.local"
+	clusters := normalizeClusters(model.NewPushContext(), nil, []*apiv2.Cluster{
+		{Name: long},
+		{Name: short},
+		{Name: short, AltStatName: "foo.default.svc.cluster.local_80"},
+	})
+	g.Expect(clusters).To(HaveLen(2))
+	// The cluster names are kept, so that they can still be parsed.
+	g.Expect(clusters[0].Name).To(Equal(long))
+	g.Expect(clusters[0].AltStatName).To(HaveLen(40))
+	g.Expect(clusters[0].AltStatName).To(Equal(model.NormalizeResourceName(long)))
+	g.Expect(clusters[1].Name).To(Equal(short))
+	g.Expect(clusters[1].AltStatName).To(BeEmpty())
+}
+
 func TestCommonHttpProtocolOptions(t *testing.T) {
 	g := NewGomegaWithT(t)
 
@@ -1850,3 +1932,167 @@ func TestAutoMTLSClusterPerPortStrictMode(t *testing.T) {
 		g.Expect(cluster.TlsContext).To(BeNil())
 	}
 }
+
+func TestApplyExternalNameSni(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	service := &model.Service{
+		Hostname: "external.default.svc.cluster.local",
+		Attributes: model.ServiceAttributes{
+			ExternalName: "api.example.com",
+		},
+	}
+
+	cluster := &apiv2.Cluster{Name: "outbound|443||external.default.svc.cluster.local", TlsContext: &auth.UpstreamTlsContext{}}
+	applyExternalNameSni(cluster, service)
+	g.Expect(cluster.TlsContext.Sni).To(Equal("api.example.com"))
+
+	// SNI explicitly set by a destination rule must be kept.
+	cluster.TlsContext.Sni = "custom.example.com"
+	applyExternalNameSni(cluster, service)
+	g.Expect(cluster.TlsContext.Sni).To(Equal("custom.example.com"))
+
+	// Plaintext clusters are left untouched.
+	cluster = &apiv2.Cluster{Name: "outbound|80||external.default.svc.cluster.local"}
+	applyExternalNameSni(cluster, service)
+	g.Expect(cluster.TlsContext).To(BeNil())
+}
+
+func TestApplyOriginalDstHeaderOverride(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	destRule := &model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Annotations: map[string]string{model.OriginalDstHeaderOverrideAnnotation: "true"},
+		},
+	}
+
+	gateway := &model.Proxy{Type: model.Router}
+	cluster := &apiv2.Cluster{
+		Name:                 "outbound|8080||router-targets.internal",
+		ClusterDiscoveryType: &apiv2.Cluster_Type{Type: apiv2.Cluster_ORIGINAL_DST},
+	}
+	applyOriginalDstHeaderOverride(cluster, gateway, destRule)
+	g.Expect(cluster.GetOriginalDstLbConfig().GetUseHttpHeader()).To(BeTrue())
+
+	// Only original destination clusters can be overridden.
+	cluster = &apiv2.Cluster{
+		Name:                 "outbound|8080||reviews.default.svc.cluster.local",
+		ClusterDiscoveryType: &apiv2.Cluster_Type{Type: apiv2.Cluster_EDS},
+	}
+	applyOriginalDstHeaderOverride(cluster, gateway, destRule)
+	g.Expect(cluster.LbConfig).To(BeNil())
+
+	// The override is opt-in.
+	cluster = &apiv2.Cluster{
+		Name:                 "outbound|8080||router-targets.internal",
+		ClusterDiscoveryType: &apiv2.Cluster_Type{Type: apiv2.Cluster_ORIGINAL_DST},
+	}
+	applyOriginalDstHeaderOverride(cluster, gateway, &model.Config{})
+	g.Expect(cluster.LbConfig).To(BeNil())
+
+	// The sidecars can't pick the hosts with the header.
+	cluster = &apiv2.Cluster{
+		Name:                 "outbound|8080||router-targets.internal",
+		ClusterDiscoveryType: &apiv2.Cluster_Type{Type: apiv2.Cluster_ORIGINAL_DST},
+	}
+	applyOriginalDstHeaderOverride(cluster, &model.Proxy{Type: model.SidecarProxy}, destRule)
+	g.Expect(cluster.LbConfig).To(BeNil())
+}
+
+func TestApplyTrustDomainTransportSocketMatches(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir, err := ioutil.TempDir("", "trust-domain-ca-bundles")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer func() { _ = os.RemoveAll(dir) }()
+	root := filepath.Join(dir, "root-cert.pem")
+	g.Expect(ioutil.WriteFile(root, []byte("partner-root"), 0644)).To(Succeed())
+
+	_ = os.Setenv(features.TrustDomainCABundles.Name, "partner.example.com="+root)
+	defer func() { _ = os.Unsetenv(features.TrustDomainCABundles.Name) }()
+
+	env := &model.Environment{Mesh: &meshconfig.MeshConfig{}}
+	proxy := &model.Proxy{Metadata: &model.NodeMetadata{}}
+	tls := buildIstioMutualTLS([]string{
+		"spiffe://cluster.local/ns/default/sa/reviews",
+		"spiffe://partner.example.com/ns/default/sa/reviews",
+	}, "", proxy)
+	cluster := &apiv2.Cluster{Name: "outbound|9080||reviews.default.svc.cluster.local"}
+	applyUpstreamTLSSettings(env, cluster, tls, autoDetected, proxy)
+	applyTrustDomainTransportSocketMatches(cluster, tls)
+
+	g.Expect(cluster.TransportSocketMatches).To(HaveLen(3))
+	match := cluster.TransportSocketMatches[0]
+	g.Expect(match.Name).To(Equal("trustDomain-partner.example.com"))
+	g.Expect(match.Match.Fields[model.MTLSReadyLabelShortname].GetStringValue()).To(Equal("true"))
+	g.Expect(match.Match.Fields[model.TrustDomainLabelShortname].GetStringValue()).To(Equal("partner.example.com"))
+	g.Expect(cluster.TransportSocketMatches[1].Name).To(Equal("mtls"))
+
+	tlsContext := &auth.UpstreamTlsContext{}
+	g.Expect(ptypes.UnmarshalAny(match.TransportSocket.GetTypedConfig(), tlsContext)).To(Succeed())
+	validationContext := tlsContext.CommonTlsContext.GetValidationContext()
+	g.Expect(validationContext.TrustedCa.GetInlineBytes()).To(Equal([]byte("partner-root")))
+	g.Expect(validationContext.VerifySubjectAltName).To(Equal([]string{"spiffe://partner.example.com/ns/default/sa/reviews"}))
+
+	// The destinations without service accounts of the trust domains with a CA bundle are unchanged.
+	tls = buildIstioMutualTLS([]string{"spiffe://cluster.local/ns/default/sa/ratings"}, "", proxy)
+	cluster = &apiv2.Cluster{Name: "outbound|9080||ratings.default.svc.cluster.local"}
+	applyUpstreamTLSSettings(env, cluster, tls, autoDetected, proxy)
+	applyTrustDomainTransportSocketMatches(cluster, tls)
+	g.Expect(cluster.TransportSocketMatches).To(HaveLen(2))
+}
+
+func TestIstioMutualSNITemplate(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	env := buildClusterCacheTestEnv(1)
+	proxy := newClusterCacheTestProxy(env, "1.1.1.1", &model.NodeMetadata{})
+	service := env.PushContext.Services(proxy)[0]
+	destRule := &model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Annotations: map[string]string{
+				model.IstioMutualSNIAnnotation:             "{subset}.{port}.{host}.mesh-b.example.com",
+				model.IstioMutualSubjectAltNamesAnnotation: "spiffe://mesh-b.example.com/ns/{namespace}/sa/gateway",
+			},
+		},
+		Spec: &networking.DestinationRule{
+			Host: string(service.Hostname),
+			TrafficPolicy: &networking.TrafficPolicy{
+				Tls: &networking.TLSSettings{Mode: networking.TLSSettings_ISTIO_MUTUAL},
+			},
+			Subsets: []*networking.Subset{
+				{Name: "v1", Labels: map[string]string{"version": "v1"}},
+				{
+					Name:   "v2",
+					Labels: map[string]string{"version": "v2"},
+					TrafficPolicy: &networking.TrafficPolicy{
+						Tls: &networking.TLSSettings{Mode: networking.TLSSettings_ISTIO_MUTUAL, Sni: "v2.example.com"},
+					},
+				},
+			},
+		},
+	}
+
+	configgen := NewConfigGenerator([]plugin.Plugin{})
+	clusters := configgen.buildOutboundServiceClusters(env, proxy, env.PushContext, service, destRule, model.GetNetworkView(proxy))
+	sni := map[string]string{}
+	for _, c := range clusters {
+		sni[c.Name] = c.TlsContext.GetSni()
+		g.Expect(c.TlsContext.CommonTlsContext.GetValidationContext().VerifySubjectAltName).To(
+			Equal([]string{"spiffe://mesh-b.example.com/ns/default/sa/gateway"}))
+	}
+	g.Expect(sni).To(Equal(map[string]string{
+		"outbound|80||svc0.default.svc.cluster.local":     ".80.svc0.default.svc.cluster.local.mesh-b.example.com",
+		"outbound|80|v1|svc0.default.svc.cluster.local":   "v1.80.svc0.default.svc.cluster.local.mesh-b.example.com",
+		"outbound|80|v2|svc0.default.svc.cluster.local":   "v2.example.com",
+		"outbound|7070||svc0.default.svc.cluster.local":   ".7070.svc0.default.svc.cluster.local.mesh-b.example.com",
+		"outbound|7070|v1|svc0.default.svc.cluster.local": "v1.7070.svc0.default.svc.cluster.local.mesh-b.example.com",
+		"outbound|7070|v2|svc0.default.svc.cluster.local": "v2.example.com",
+	}))
+
+	// Without template, the SNI is the name of the cluster.
+	destRule.Annotations = nil
+	clusters = configgen.buildOutboundServiceClusters(env, proxy, env.PushContext, service, destRule, model.GetNetworkView(proxy))
+	g.Expect(clusters[0].TlsContext.GetSni()).To(Equal("outbound_.80_._.svc0.default.svc.cluster.local"))
+}
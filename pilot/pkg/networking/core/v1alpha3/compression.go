@@ -0,0 +1,80 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	gzip "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/gzip/v2"
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"istio.io/pkg/log"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+)
+
+var compressionLevels = map[string]gzip.Gzip_CompressionLevel_Enum{
+	model.CompressionLevelDefault: gzip.Gzip_CompressionLevel_DEFAULT,
+	model.CompressionLevelBest:    gzip.Gzip_CompressionLevel_BEST,
+	model.CompressionLevelSpeed:   gzip.Gzip_CompressionLevel_SPEED,
+}
+
+// buildCompressionFilter returns the gzip filter compressing the responses, or nil if there is no compression.
+func buildCompressionFilter(node *model.Proxy, compression *model.Compression) *http_conn.HttpFilter {
+	if compression == nil {
+		return nil
+	}
+	filterConfigProto := &gzip.Gzip{
+		ContentType:      compression.ContentTypes,
+		CompressionLevel: compressionLevels[compression.Level],
+	}
+	if compression.MinLength > 0 {
+		filterConfigProto.ContentLength = &wrappers.UInt32Value{Value: compression.MinLength}
+	}
+	out := &http_conn.HttpFilter{Name: wellknown.Gzip}
+	if util.IsXDSMarshalingToAnyEnabled(node) {
+		out.ConfigType = &http_conn.HttpFilter_TypedConfig{TypedConfig: util.MessageToAny(filterConfigProto)}
+	} else {
+		out.ConfigType = &http_conn.HttpFilter_Config{Config: util.MessageToStruct(filterConfigProto)}
+	}
+	return out
+}
+
+// inboundCompressionFilter returns the filter compressing the responses of the inbound HTTP ports, as set by the
+// sidecar.istio.io/compression* annotations of the workload, or nil if they are unset or invalid.
+func inboundCompressionFilter(node *model.Proxy) *http_conn.HttpFilter {
+	if node == nil || node.Metadata == nil || node.Metadata.Compression == "" {
+		return nil
+	}
+	compression, err := model.ParseCompression(node.Metadata.Compression, node.Metadata.CompressionContentTypes,
+		node.Metadata.CompressionMinLength, node.Metadata.CompressionLevel)
+	if err != nil {
+		log.Warnf("ignoring the compression of %s: %v", node.ID, err)
+		return nil
+	}
+	return buildCompressionFilter(node, compression)
+}
+
+// gatewayCompressionFilter returns the filter compressing the responses of the gateway server, as set by the
+// annotations of its gateway, or nil if there is none.
+func gatewayCompressionFilter(node *model.Proxy, server *networking.Server) *http_conn.HttpFilter {
+	if node.MergedGateway == nil {
+		return nil
+	}
+	return buildCompressionFilter(node, node.MergedGateway.CompressionForServer[server])
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"testing"
+
+	gzip "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/gzip/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/ptypes"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestInboundCompressionFilter(t *testing.T) {
+	if f := inboundCompressionFilter(&model.Proxy{Metadata: &model.NodeMetadata{}}); f != nil {
+		t.Errorf("expected no compression filter, got %v", f)
+	}
+	if f := inboundCompressionFilter(&model.Proxy{Metadata: &model.NodeMetadata{Compression: "brotli"}}); f != nil {
+		t.Errorf("expected no compression filter for an unsupported algorithm, got %v", f)
+	}
+
+	f := inboundCompressionFilter(&model.Proxy{Metadata: &model.NodeMetadata{
+		Compression:             "gzip",
+		CompressionContentTypes: "application/json",
+		CompressionMinLength:    "256",
+		CompressionLevel:        "speed",
+	}})
+	if f == nil || f.Name != wellknown.Gzip {
+		t.Fatalf("expected the gzip filter, got %v", f)
+	}
+	got := &gzip.Gzip{}
+	if err := ptypes.UnmarshalAny(f.GetTypedConfig(), got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.ContentType) != 1 || got.ContentType[0] != "application/json" ||
+		got.ContentLength.GetValue() != 256 || got.CompressionLevel != gzip.Gzip_CompressionLevel_SPEED {
+		t.Errorf("unexpected gzip config %v", got)
+	}
+}
+
+func TestGatewayCompressionFilter(t *testing.T) {
+	compressed := &networking.Server{Hosts: []string{"example.com"}}
+	plain := &networking.Server{Hosts: []string{"other.com"}}
+	node := &model.Proxy{
+		Metadata: &model.NodeMetadata{},
+		MergedGateway: &model.MergedGateway{
+			CompressionForServer: map[*networking.Server]*model.Compression{
+				compressed: {Level: model.CompressionLevelDefault},
+			},
+		},
+	}
+	if f := gatewayCompressionFilter(node, compressed); f == nil || f.Name != wellknown.Gzip {
+		t.Errorf("expected the gzip filter, got %v", f)
+	}
+	if f := gatewayCompressionFilter(node, plain); f != nil {
+		t.Errorf("expected no compression filter, got %v", f)
+	}
+}
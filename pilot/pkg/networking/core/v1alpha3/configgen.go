@@ -21,6 +21,9 @@ import (
 type ConfigGeneratorImpl struct {
 	// List of plugins that modify code generated by this config generator
 	Plugins []plugin.Plugin
+
+	// clusterCache has the outbound clusters of the services built for the current push.
+	clusterCache outboundClusterCache
 }
 
 func NewConfigGenerator(plugins []plugin.Plugin) *ConfigGeneratorImpl {
@@ -53,6 +53,7 @@ func ApplyClusterPatches(
 				}
 
 				if commonConditionMatch(proxy, patchContext, cp) && clusterMatch(clusters[i], cp) {
+					recordUsage(proxy, envoyFilterUsageClusters, cp, clusters[i].Name)
 					if cp.Operation == networking.EnvoyFilter_Patch_REMOVE {
 						clusters[i] = nil
 						clustersRemoved = true
@@ -67,7 +68,9 @@ func ApplyClusterPatches(
 		for _, cp := range efw.Patches[networking.EnvoyFilter_CLUSTER] {
 			if cp.Operation == networking.EnvoyFilter_Patch_ADD {
 				if commonConditionMatch(proxy, patchContext, cp) {
-					clusters = append(clusters, proto.Clone(cp.Value).(*xdsapi.Cluster))
+					cluster := proto.Clone(cp.Value).(*xdsapi.Cluster)
+					recordUsage(proxy, envoyFilterUsageClusters, cp, cluster.Name)
+					clusters = append(clusters, cluster)
 				}
 			}
 		}
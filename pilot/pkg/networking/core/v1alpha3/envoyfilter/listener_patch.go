@@ -16,6 +16,7 @@ package envoyfilter
 
 import (
 	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	xdslistener "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
 	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
 	"github.com/envoyproxy/go-control-plane/pkg/conversion"
@@ -23,14 +24,30 @@ import (
 	"github.com/gogo/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/any"
+	structpb "github.com/golang/protobuf/ptypes/struct"
 
 	"istio.io/pkg/log"
 
 	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
 )
 
+// The xDS types of the resources of the EnvoyFilter usage of the proxies.
+const (
+	envoyFilterUsageClusters  = "cds"
+	envoyFilterUsageRoutes    = "rds"
+	envoyFilterUsageListeners = "lds"
+)
+
+// recordUsage records that the EnvoyFilter of the patch patched the resource of the xDS type generated for the proxy.
+func recordUsage(proxy *model.Proxy, typ string, cp *model.EnvoyFilterConfigPatchWrapper, resource string) {
+	if proxy != nil {
+		proxy.EnvoyFilterUsage.Record(typ, cp.Source, resource)
+	}
+}
+
 // ApplyListenerPatches applies patches to LDS output
 func ApplyListenerPatches(
 	patchContext networking.EnvoyFilter_PatchContext,
@@ -76,7 +93,9 @@ func doListenerListOperation(proxy *model.Proxy, patchContext networking.EnvoyFi
 
 				// clone before append. Otherwise, subsequent operations on this listener will corrupt
 				// the master value stored in CP..
-				listeners = append(listeners, proto.Clone(cp.Value).(*xdsapi.Listener))
+				listener := proto.Clone(cp.Value).(*xdsapi.Listener)
+				recordUsage(proxy, envoyFilterUsageListeners, cp, listener.Name)
+				listeners = append(listeners, listener)
 			}
 		}
 	}
@@ -102,12 +121,14 @@ func doListenerOperation(proxy *model.Proxy, patchContext networking.EnvoyFilter
 		}
 
 		if cp.Operation == networking.EnvoyFilter_Patch_REMOVE {
+			recordUsage(proxy, envoyFilterUsageListeners, cp, listener.Name)
 			listener.Name = ""
 			*listenersRemoved = true
 			// terminate the function here as we have nothing more do to for this listener
 			return
 		} else if cp.Operation == networking.EnvoyFilter_Patch_MERGE {
 			proto.Merge(listener, cp.Value)
+			recordUsage(proxy, envoyFilterUsageListeners, cp, listener.Name)
 		}
 	}
 
@@ -130,7 +151,9 @@ func doFilterChainListOperation(proxy *model.Proxy, patchContext networking.Envo
 				!listenerMatch(listener, cp) {
 				continue
 			}
-			listener.FilterChains = append(listener.FilterChains, proto.Clone(cp.Value).(*xdslistener.FilterChain))
+			fc := proto.Clone(cp.Value).(*xdslistener.FilterChain)
+			recordPatch(proxy, listener, fc, cp)
+			listener.FilterChains = append(listener.FilterChains, fc)
 		}
 	}
 	if filterChainsRemoved {
@@ -155,12 +178,14 @@ func doFilterChainOperation(proxy *model.Proxy, patchContext networking.EnvoyFil
 			continue
 		}
 		if cp.Operation == networking.EnvoyFilter_Patch_REMOVE {
+			recordUsage(proxy, envoyFilterUsageListeners, cp, listener.Name)
 			fc.Filters = nil
 			*filterChainRemoved = true
 			// nothing more to do in other patches as we removed this filter chain
 			return
 		} else if cp.Operation == networking.EnvoyFilter_Patch_MERGE {
 			proto.Merge(fc, cp.Value)
+			recordPatch(proxy, listener, fc, cp)
 		}
 	}
 	doNetworkFilterListOperation(proxy, patchContext, patches, listener, fc)
@@ -185,10 +210,12 @@ func doNetworkFilterListOperation(proxy *model.Proxy, patchContext networking.En
 
 		if cp.Operation == networking.EnvoyFilter_Patch_ADD {
 			fc.Filters = append(fc.Filters, proto.Clone(cp.Value).(*xdslistener.Filter))
+			recordPatch(proxy, listener, fc, cp)
 		} else if cp.Operation == networking.EnvoyFilter_Patch_INSERT_AFTER {
 			// Insert after without a filter match is same as ADD in the end
 			if !hasNetworkFilterMatch(cp) {
 				fc.Filters = append(fc.Filters, proto.Clone(cp.Value).(*xdslistener.Filter))
+				recordPatch(proxy, listener, fc, cp)
 				continue
 			}
 			// find the matching filter first
@@ -209,10 +236,12 @@ func doNetworkFilterListOperation(proxy *model.Proxy, patchContext networking.En
 				copy(fc.Filters[insertPosition+1:], fc.Filters[insertPosition:])
 				fc.Filters[insertPosition] = proto.Clone(cp.Value).(*xdslistener.Filter)
 			}
+			recordPatch(proxy, listener, fc, cp)
 		} else if cp.Operation == networking.EnvoyFilter_Patch_INSERT_BEFORE {
 			// insert before without a filter match is same as insert in the beginning
 			if !hasNetworkFilterMatch(cp) {
 				fc.Filters = append([]*xdslistener.Filter{proto.Clone(cp.Value).(*xdslistener.Filter)}, fc.Filters...)
+				recordPatch(proxy, listener, fc, cp)
 				continue
 			}
 			// find the matching filter first
@@ -230,6 +259,7 @@ func doNetworkFilterListOperation(proxy *model.Proxy, patchContext networking.En
 			fc.Filters = append(fc.Filters, proto.Clone(cp.Value).(*xdslistener.Filter))
 			copy(fc.Filters[insertPosition+1:], fc.Filters[insertPosition:])
 			fc.Filters[insertPosition] = proto.Clone(cp.Value).(*xdslistener.Filter)
+			recordPatch(proxy, listener, fc, cp)
 		}
 	}
 	if networkFiltersRemoved {
@@ -257,6 +287,7 @@ func doNetworkFilterOperation(proxy *model.Proxy, patchContext networking.EnvoyF
 		if cp.Operation == networking.EnvoyFilter_Patch_REMOVE {
 			filter.Name = ""
 			*networkFilterRemoved = true
+			recordPatch(proxy, listener, fc, cp)
 			// nothing more to do in other patches as we removed this filter
 			return
 		} else if cp.Operation == networking.EnvoyFilter_Patch_MERGE {
@@ -293,6 +324,7 @@ func doNetworkFilterOperation(proxy *model.Proxy, patchContext networking.EnvoyF
 			if retVal != nil {
 				filter.ConfigType = &xdslistener.Filter_TypedConfig{TypedConfig: retVal}
 			}
+			recordPatch(proxy, listener, fc, cp)
 		}
 	}
 	if filter.Name == xdsutil.HTTPConnectionManager {
@@ -332,10 +364,12 @@ func doHTTPFilterListOperation(proxy *model.Proxy, patchContext networking.Envoy
 
 		if cp.Operation == networking.EnvoyFilter_Patch_ADD {
 			hcm.HttpFilters = append(hcm.HttpFilters, proto.Clone(cp.Value).(*http_conn.HttpFilter))
+			recordPatch(proxy, listener, fc, cp)
 		} else if cp.Operation == networking.EnvoyFilter_Patch_INSERT_AFTER {
 			// Insert after without a filter match is same as ADD in the end
 			if !hasHTTPFilterMatch(cp) {
 				hcm.HttpFilters = append(hcm.HttpFilters, proto.Clone(cp.Value).(*http_conn.HttpFilter))
+				recordPatch(proxy, listener, fc, cp)
 				continue
 			}
 
@@ -357,10 +391,12 @@ func doHTTPFilterListOperation(proxy *model.Proxy, patchContext networking.Envoy
 				copy(hcm.HttpFilters[insertPosition+1:], hcm.HttpFilters[insertPosition:])
 				hcm.HttpFilters[insertPosition] = proto.Clone(cp.Value).(*http_conn.HttpFilter)
 			}
+			recordPatch(proxy, listener, fc, cp)
 		} else if cp.Operation == networking.EnvoyFilter_Patch_INSERT_BEFORE {
 			// insert before without a filter match is same as insert in the beginning
 			if !hasHTTPFilterMatch(cp) {
 				hcm.HttpFilters = append([]*http_conn.HttpFilter{proto.Clone(cp.Value).(*http_conn.HttpFilter)}, hcm.HttpFilters...)
+				recordPatch(proxy, listener, fc, cp)
 				continue
 			}
 
@@ -379,6 +415,7 @@ func doHTTPFilterListOperation(proxy *model.Proxy, patchContext networking.Envoy
 			hcm.HttpFilters = append(hcm.HttpFilters, proto.Clone(cp.Value).(*http_conn.HttpFilter))
 			copy(hcm.HttpFilters[insertPosition+1:], hcm.HttpFilters[insertPosition:])
 			hcm.HttpFilters[insertPosition] = proto.Clone(cp.Value).(*http_conn.HttpFilter)
+			recordPatch(proxy, listener, fc, cp)
 		}
 	}
 	if httpFiltersRemoved {
@@ -413,6 +450,7 @@ func doHTTPFilterOperation(proxy *model.Proxy, patchContext networking.EnvoyFilt
 		if cp.Operation == networking.EnvoyFilter_Patch_REMOVE {
 			httpFilter.Name = ""
 			*httpFilterRemoved = true
+			recordPatch(proxy, listener, fc, cp)
 			// nothing more to do in other patches as we removed this filter
 			return
 		} else if cp.Operation == networking.EnvoyFilter_Patch_MERGE {
@@ -449,8 +487,44 @@ func doHTTPFilterOperation(proxy *model.Proxy, patchContext networking.EnvoyFilt
 			if retVal != nil {
 				httpFilter.ConfigType = &http_conn.HttpFilter_TypedConfig{TypedConfig: retVal}
 			}
+			recordPatch(proxy, listener, fc, cp)
+		}
+	}
+}
+
+// recordPatch records the EnvoyFilter of the patch in the EnvoyFilter usage of the proxy and, if enabled, in the
+// istio metadata of the filter chain it patched, or whose filters it patched, so that the config dumps trace the
+// filter chains back to the EnvoyFilters.
+func recordPatch(proxy *model.Proxy, listener *xdsapi.Listener, fc *xdslistener.FilterChain, cp *model.EnvoyFilterConfigPatchWrapper) {
+	recordUsage(proxy, envoyFilterUsageListeners, cp, listener.Name)
+	if !features.EnableEnvoyFilterAttribution || cp.Source == "" {
+		return
+	}
+	if fc.Metadata == nil {
+		fc.Metadata = &core.Metadata{}
+	}
+	if fc.Metadata.FilterMetadata == nil {
+		fc.Metadata.FilterMetadata = map[string]*structpb.Struct{}
+	}
+	istio := fc.Metadata.FilterMetadata[util.IstioMetadataKey]
+	if istio == nil {
+		istio = &structpb.Struct{}
+		fc.Metadata.FilterMetadata[util.IstioMetadataKey] = istio
+	}
+	if istio.Fields == nil {
+		istio.Fields = map[string]*structpb.Value{}
+	}
+	sources := istio.Fields[util.EnvoyFiltersMetadataKey].GetListValue()
+	if sources == nil {
+		sources = &structpb.ListValue{}
+		istio.Fields[util.EnvoyFiltersMetadataKey] = &structpb.Value{Kind: &structpb.Value_ListValue{ListValue: sources}}
+	}
+	for _, source := range sources.Values {
+		if source.GetStringValue() == cp.Source {
+			return
 		}
 	}
+	sources.Values = append(sources.Values, &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: cp.Source}})
 }
 
 func listenerMatch(listener *xdsapi.Listener, cp *model.EnvoyFilterConfigPatchWrapper) bool {
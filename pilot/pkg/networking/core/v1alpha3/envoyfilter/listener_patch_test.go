@@ -16,6 +16,7 @@ package envoyfilter
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -34,6 +35,7 @@ import (
 
 	meshconfig "istio.io/api/mesh/v1alpha1"
 	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/fakes"
 	"istio.io/istio/pilot/pkg/networking/util"
@@ -714,3 +716,36 @@ func TestApplyListenerPatches(t *testing.T) {
 		})
 	}
 }
+
+func TestRecordPatch(t *testing.T) {
+	defer func(enabled bool) { features.EnableEnvoyFilterAttribution = enabled }(features.EnableEnvoyFilterAttribution)
+	features.EnableEnvoyFilterAttribution = true
+
+	proxy := &model.Proxy{EnvoyFilterUsage: model.NewEnvoyFilterUsage()}
+	l := &xdsapi.Listener{Name: "virtualInbound"}
+	fc := &listener.FilterChain{}
+	recordPatch(proxy, l, fc, &model.EnvoyFilterConfigPatchWrapper{Source: "istio-system/lua"})
+	recordPatch(proxy, l, fc, &model.EnvoyFilterConfigPatchWrapper{Source: "default/fault"})
+	recordPatch(proxy, l, fc, &model.EnvoyFilterConfigPatchWrapper{Source: "istio-system/lua"})
+
+	sources := fc.Metadata.FilterMetadata[util.IstioMetadataKey].Fields[util.EnvoyFiltersMetadataKey].GetListValue().GetValues()
+	if len(sources) != 2 || sources[0].GetStringValue() != "istio-system/lua" || sources[1].GetStringValue() != "default/fault" {
+		t.Errorf("recordPatch() recorded %v, want [istio-system/lua default/fault]", sources)
+	}
+
+	// The usage is recorded even with the attribution in the metadata disabled.
+	features.EnableEnvoyFilterAttribution = false
+	fc = &listener.FilterChain{}
+	recordPatch(proxy, l, fc, &model.EnvoyFilterConfigPatchWrapper{Source: "default/gzip"})
+	if fc.Metadata != nil {
+		t.Errorf("recordPatch() recorded %v with the attribution disabled", fc.Metadata)
+	}
+	want := map[string][]string{
+		"istio-system/lua": {"virtualInbound"},
+		"default/fault":    {"virtualInbound"},
+		"default/gzip":     {"virtualInbound"},
+	}
+	if got := proxy.EnvoyFilterUsage.Take(envoyFilterUsageListeners); !reflect.DeepEqual(got, want) {
+		t.Errorf("recorded usage %v, want %v", got, want)
+	}
+}
@@ -50,6 +50,7 @@ func ApplyRouteConfigurationPatches(
 			if commonConditionMatch(proxy, patchContext, cp) &&
 				routeConfigurationMatch(patchContext, routeConfiguration, cp) {
 				proto.Merge(routeConfiguration, cp.Value)
+				recordUsage(proxy, envoyFilterUsageRoutes, cp, routeConfiguration.Name)
 			}
 		}
 
@@ -76,6 +77,7 @@ func doVirtualHostListOperation(proxy *model.Proxy, patchContext networking.Envo
 		if commonConditionMatch(proxy, patchContext, cp) &&
 			routeConfigurationMatch(patchContext, routeConfiguration, cp) {
 			routeConfiguration.VirtualHosts = append(routeConfiguration.VirtualHosts, proto.Clone(cp.Value).(*route.VirtualHost))
+			recordUsage(proxy, envoyFilterUsageRoutes, cp, routeConfiguration.Name)
 		}
 	}
 
@@ -100,6 +102,7 @@ func doVirtualHostOperation(proxy *model.Proxy, patchContext networking.EnvoyFil
 			routeConfigurationMatch(patchContext, routeConfiguration, cp) &&
 			virtualHostMatch(virtualHost, cp) {
 
+			recordUsage(proxy, envoyFilterUsageRoutes, cp, routeConfiguration.Name)
 			if cp.Operation == networking.EnvoyFilter_Patch_REMOVE {
 				virtualHost.Name = ""
 				*virtualHostRemoved = true
@@ -132,6 +135,7 @@ func doHTTPRouteListOperation(proxy *model.Proxy, patchContext networking.EnvoyF
 			routeConfigurationMatch(patchContext, routeConfiguration, cp) &&
 			virtualHostMatch(virtualHost, cp) {
 			virtualHost.Routes = append(virtualHost.Routes, proto.Clone(cp.Value).(*route.Route))
+			recordUsage(proxy, envoyFilterUsageRoutes, cp, routeConfiguration.Name)
 		}
 	}
 
@@ -156,6 +160,7 @@ func doHTTPRouteOperation(proxy *model.Proxy, patchContext networking.EnvoyFilte
 			virtualHostMatch(virtualHost, cp) &&
 			routeMatch(virtualHost.Routes[routeIndex], cp) {
 
+			recordUsage(proxy, envoyFilterUsageRoutes, cp, routeConfiguration.Name)
 			if cp.Operation == networking.EnvoyFilter_Patch_REMOVE {
 				virtualHost.Routes[routeIndex] = nil
 				*routesRemoved = true
@@ -0,0 +1,592 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	xdsutil "github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/fakes"
+	"istio.io/istio/pilot/pkg/networking/plugin"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/mesh"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/schema"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+var (
+	fuzzIterations = flag.Int("fuzz.iterations", 100, "Number of random config sets fed to the generators by TestFuzzConfigGeneration")
+	fuzzSeed       = flag.Int64("fuzz.seed", 1, "Seed of TestFuzzConfigGeneration, random if 0")
+)
+
+const fuzzNamespace = "fuzz"
+
+// TestFuzzConfigGeneration feeds random, but valid, DestinationRules, VirtualServices and Sidecars
+// to the CDS, LDS and RDS generators, checking they neither panic nor produce configs Envoy rejects.
+// The seed is fixed so that the failures are reproducible, -fuzz.seed=0 explores random config sets.
+func TestFuzzConfigGeneration(t *testing.T) {
+	seed := *fuzzSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	t.Logf("fuzzing with seed %d, reproduce with -fuzz.seed=%d", seed, seed)
+	f := &configFuzzer{rand: rand.New(rand.NewSource(seed))}
+
+	for i := 0; i < *fuzzIterations; i++ {
+		store := model.MakeIstioStore(memory.Make(schemas.Istio))
+		var accepted []model.Config
+		for _, c := range f.configs() {
+			// Invalid configs are rejected by validation before reaching pilot.
+			if _, err := store.Create(c); err == nil {
+				accepted = append(accepted, c)
+			}
+		}
+		for _, nodeType := range []model.NodeType{model.SidecarProxy, model.Router} {
+			if err := fuzzGenerate(store, nodeType); err != nil {
+				t.Fatalf("iteration %d, %s: %v\nconfigs:\n%s", i, nodeType, err, fuzzDump(accepted))
+			}
+		}
+	}
+}
+
+// fuzzGenerate builds the clusters, listeners and routes of a proxy and validates them.
+func fuzzGenerate(store model.IstioConfigStore, nodeType model.NodeType) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+
+	services := []*model.Service{fuzzService("a", "1.1.1.1"), fuzzService("b", "1.1.1.2")}
+	instances := []*model.ServiceInstance{
+		{
+			Service: services[0],
+			Endpoint: model.NetworkEndpoint{
+				Address:     "10.0.0.1",
+				Port:        8080,
+				ServicePort: services[0].Ports[0],
+			},
+			Labels: labels.Instance{"app": "a"},
+		},
+	}
+	serviceDiscovery := &fakes.ServiceDiscovery{}
+	serviceDiscovery.ServicesReturns(services, nil)
+	serviceDiscovery.InstancesByPortReturns(instances, nil)
+	if nodeType == model.SidecarProxy {
+		serviceDiscovery.GetProxyServiceInstancesReturns(instances, nil)
+	}
+
+	m := mesh.DefaultMeshConfig()
+	env := &model.Environment{
+		ServiceDiscovery: serviceDiscovery,
+		IstioConfigStore: store,
+		Mesh:             &m,
+		PushContext:      model.NewPushContext(),
+	}
+	if err := env.PushContext.InitContext(env, nil, nil); err != nil {
+		return err
+	}
+
+	node := &model.Proxy{
+		Type:            nodeType,
+		IPAddresses:     []string{"10.0.0.1"},
+		ID:              "fuzz-1." + fuzzNamespace,
+		DNSDomain:       fuzzNamespace + ".svc.cluster.local",
+		ConfigNamespace: fuzzNamespace,
+		Metadata: &model.NodeMetadata{
+			IstioVersion:    "1.4.0",
+			ConfigNamespace: fuzzNamespace,
+		},
+		IstioVersion:   model.ParseIstioVersion("1.4.0"),
+		WorkloadLabels: labels.Collection{{"app": "a"}},
+	}
+	if nodeType == model.Router {
+		node.WorkloadLabels = labels.Collection{{"istio": "ingressgateway"}}
+	}
+	node.SetSidecarScope(env.PushContext)
+	node.ServiceInstances, _ = serviceDiscovery.GetProxyServiceInstances(node)
+
+	configgen := NewConfigGenerator([]plugin.Plugin{})
+	for _, c := range configgen.BuildClusters(env, node, env.PushContext) {
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("invalid cluster %s: %v", c.Name, err)
+		}
+	}
+
+	var routeNames []string
+	for _, l := range configgen.BuildListeners(env, node, env.PushContext) {
+		if err := l.Validate(); err != nil {
+			return fmt.Errorf("invalid listener %s: %v", l.Name, err)
+		}
+		for _, fc := range l.FilterChains {
+			for _, filter := range fc.Filters {
+				if filter.Name != xdsutil.HTTPConnectionManager {
+					continue
+				}
+				hcm := &http_conn.HttpConnectionManager{}
+				if err := getFilterConfig(filter, hcm); err != nil {
+					return fmt.Errorf("invalid http connection manager of listener %s: %v", l.Name, err)
+				}
+				if err := hcm.Validate(); err != nil {
+					return fmt.Errorf("invalid http connection manager of listener %s: %v", l.Name, err)
+				}
+				if rds := hcm.GetRds(); rds != nil {
+					routeNames = append(routeNames, rds.RouteConfigName)
+				}
+			}
+		}
+	}
+
+	for _, r := range configgen.BuildHTTPRoutes(env, node, env.PushContext, routeNames) {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("invalid route configuration %s: %v", r.Name, err)
+		}
+	}
+	return nil
+}
+
+func fuzzService(name, address string) *model.Service {
+	return &model.Service{
+		Hostname: host.Name(name + "." + fuzzNamespace + ".svc.cluster.local"),
+		Address:  address,
+		Ports: model.PortList{
+			{Name: "http", Port: 80, Protocol: protocol.HTTP},
+			{Name: "grpc", Port: 9090, Protocol: protocol.GRPC},
+			{Name: "tcp", Port: 3306, Protocol: protocol.TCP},
+			{Name: "auto", Port: 8080, Protocol: protocol.Unsupported},
+		},
+		Resolution: model.ClientSideLB,
+		Attributes: model.ServiceAttributes{
+			Name:      name,
+			Namespace: fuzzNamespace,
+		},
+	}
+}
+
+func fuzzDump(configs []model.Config) string {
+	var out []string
+	for _, c := range configs {
+		out = append(out, fmt.Sprintf("%s/%s: %v", c.Type, c.Name, c.Spec))
+	}
+	return strings.Join(out, "\n")
+}
+
+// configFuzzer generates weird configs: empty or duplicated fields, extreme values, unknown hosts,
+// ports and subsets.
+type configFuzzer struct {
+	rand *rand.Rand
+}
+
+func (f *configFuzzer) configs() []model.Config {
+	out := []model.Config{f.gateway()}
+	for i, n := 0, f.rand.Intn(4); i < n; i++ {
+		out = append(out, f.config(schemas.DestinationRule, i, f.destinationRule()))
+	}
+	for i, n := 0, f.rand.Intn(4); i < n; i++ {
+		out = append(out, f.config(schemas.VirtualService, i, f.virtualService()))
+	}
+	for i, n := 0, f.rand.Intn(2); i < n; i++ {
+		out = append(out, f.config(schemas.Sidecar, i, f.sidecar()))
+	}
+	return out
+}
+
+func (f *configFuzzer) config(s schema.Instance, i int, spec proto.Message) model.Config {
+	return model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:      s.Type,
+			Group:     s.Group,
+			Version:   s.Version,
+			Name:      fmt.Sprintf("fuzz-%d", i),
+			Namespace: fuzzNamespace,
+		},
+		Spec: spec,
+	}
+}
+
+func (f *configFuzzer) gateway() model.Config {
+	gw := f.config(schemas.Gateway, 0, &networking.Gateway{
+		Selector: map[string]string{"istio": "ingressgateway"},
+		Servers: []*networking.Server{
+			{
+				Port:  &networking.Port{Number: 80, Protocol: "HTTP", Name: "http"},
+				Hosts: []string{"*"},
+			},
+			{
+				Port:  &networking.Port{Number: 3306, Protocol: "TCP", Name: "tcp"},
+				Hosts: []string{"*"},
+			},
+		},
+	})
+	gw.Name = "fuzz-gateway"
+	return gw
+}
+
+func (f *configFuzzer) chance() bool {
+	return f.rand.Intn(2) == 0
+}
+
+func (f *configFuzzer) pick(values ...string) string {
+	return values[f.rand.Intn(len(values))]
+}
+
+func (f *configFuzzer) int32() int32 {
+	return []int32{0, 1, 2, 100, 1 << 30}[f.rand.Intn(5)]
+}
+
+func (f *configFuzzer) duration() *types.Duration {
+	if f.chance() {
+		return nil
+	}
+	return types.DurationProto([]time.Duration{time.Millisecond, time.Second, time.Hour, 1000 * time.Hour}[f.rand.Intn(4)])
+}
+
+func (f *configFuzzer) host() string {
+	return f.pick("a", "b", "a."+fuzzNamespace+".svc.cluster.local", "b."+fuzzNamespace+".svc.cluster.local",
+		"*."+fuzzNamespace+".svc.cluster.local", "*", "unknown.example.com", "*.com")
+}
+
+func (f *configFuzzer) port() uint32 {
+	return []uint32{80, 9090, 3306, 8080, 1, 65535}[f.rand.Intn(6)]
+}
+
+func (f *configFuzzer) subset() string {
+	return f.pick("", "v1", "v2", "missing")
+}
+
+func (f *configFuzzer) labels() map[string]string {
+	if f.chance() {
+		return nil
+	}
+	return map[string]string{f.pick("app", "version"): f.pick("a", "b", "v1")}
+}
+
+func (f *configFuzzer) destinationRule() *networking.DestinationRule {
+	dr := &networking.DestinationRule{
+		Host:          f.host(),
+		TrafficPolicy: f.trafficPolicy(true),
+	}
+	for i, n := 0, f.rand.Intn(3); i < n; i++ {
+		dr.Subsets = append(dr.Subsets, &networking.Subset{
+			Name:          f.pick("v1", "v2"),
+			Labels:        f.labels(),
+			TrafficPolicy: f.trafficPolicy(true),
+		})
+	}
+	return dr
+}
+
+func (f *configFuzzer) trafficPolicy(withPorts bool) *networking.TrafficPolicy {
+	if f.chance() {
+		return nil
+	}
+	policy := &networking.TrafficPolicy{
+		LoadBalancer:     f.loadBalancer(),
+		ConnectionPool:   f.connectionPool(),
+		OutlierDetection: f.outlierDetection(),
+		Tls:              f.tls(),
+	}
+	if withPorts {
+		for i, n := 0, f.rand.Intn(3); i < n; i++ {
+			policy.PortLevelSettings = append(policy.PortLevelSettings, &networking.TrafficPolicy_PortTrafficPolicy{
+				Port:             &networking.PortSelector{Number: f.port()},
+				LoadBalancer:     f.loadBalancer(),
+				ConnectionPool:   f.connectionPool(),
+				OutlierDetection: f.outlierDetection(),
+				Tls:              f.tls(),
+			})
+		}
+	}
+	return policy
+}
+
+func (f *configFuzzer) loadBalancer() *networking.LoadBalancerSettings {
+	switch f.rand.Intn(6) {
+	case 0:
+		return nil
+	case 1:
+		return &networking.LoadBalancerSettings{LbPolicy: &networking.LoadBalancerSettings_Simple{
+			Simple: networking.LoadBalancerSettings_SimpleLB(f.rand.Intn(4)),
+		}}
+	case 2:
+		return &networking.LoadBalancerSettings{LbPolicy: &networking.LoadBalancerSettings_ConsistentHash{
+			ConsistentHash: &networking.LoadBalancerSettings_ConsistentHashLB{
+				HashKey:         &networking.LoadBalancerSettings_ConsistentHashLB_HttpHeaderName{HttpHeaderName: "x-user"},
+				MinimumRingSize: uint64(f.int32()),
+			},
+		}}
+	case 3:
+		return &networking.LoadBalancerSettings{LbPolicy: &networking.LoadBalancerSettings_ConsistentHash{
+			ConsistentHash: &networking.LoadBalancerSettings_ConsistentHashLB{
+				HashKey: &networking.LoadBalancerSettings_ConsistentHashLB_HttpCookie{
+					HttpCookie: &networking.LoadBalancerSettings_ConsistentHashLB_HTTPCookie{
+						Name: "session",
+						Path: f.pick("", "/"),
+						Ttl:  f.duration(),
+					},
+				},
+			},
+		}}
+	case 4:
+		return &networking.LoadBalancerSettings{LbPolicy: &networking.LoadBalancerSettings_ConsistentHash{
+			ConsistentHash: &networking.LoadBalancerSettings_ConsistentHashLB{
+				HashKey: &networking.LoadBalancerSettings_ConsistentHashLB_UseSourceIp{UseSourceIp: true},
+			},
+		}}
+	default:
+		return &networking.LoadBalancerSettings{}
+	}
+}
+
+func (f *configFuzzer) connectionPool() *networking.ConnectionPoolSettings {
+	if f.chance() {
+		return nil
+	}
+	pool := &networking.ConnectionPoolSettings{}
+	if f.chance() {
+		pool.Tcp = &networking.ConnectionPoolSettings_TCPSettings{
+			MaxConnections: f.int32(),
+			ConnectTimeout: f.duration(),
+		}
+		if f.chance() {
+			pool.Tcp.TcpKeepalive = &networking.ConnectionPoolSettings_TCPSettings_TcpKeepalive{
+				Probes:   uint32(f.int32()),
+				Time:     f.duration(),
+				Interval: f.duration(),
+			}
+		}
+	}
+	if f.chance() {
+		pool.Http = &networking.ConnectionPoolSettings_HTTPSettings{
+			Http1MaxPendingRequests:  f.int32(),
+			Http2MaxRequests:         f.int32(),
+			MaxRequestsPerConnection: f.int32(),
+			MaxRetries:               f.int32(),
+			IdleTimeout:              f.duration(),
+			H2UpgradePolicy:          networking.ConnectionPoolSettings_HTTPSettings_H2UpgradePolicy(f.rand.Intn(3)),
+		}
+	}
+	return pool
+}
+
+func (f *configFuzzer) outlierDetection() *networking.OutlierDetection {
+	if f.chance() {
+		return nil
+	}
+	return &networking.OutlierDetection{
+		ConsecutiveErrors:  f.int32(),
+		Interval:           f.duration(),
+		BaseEjectionTime:   f.duration(),
+		MaxEjectionPercent: int32(f.rand.Intn(101)),
+		MinHealthPercent:   int32(f.rand.Intn(101)),
+	}
+}
+
+func (f *configFuzzer) tls() *networking.TLSSettings {
+	if f.chance() {
+		return nil
+	}
+	tls := &networking.TLSSettings{
+		Mode: networking.TLSSettings_TLSmode(f.rand.Intn(4)),
+		Sni:  f.pick("", "a.example.com"),
+	}
+	if f.chance() {
+		tls.SubjectAltNames = []string{f.pick("spiffe://cluster.local/ns/fuzz/sa/a", "a.example.com")}
+	}
+	if tls.Mode == networking.TLSSettings_MUTUAL || f.chance() {
+		tls.ClientCertificate = "/etc/certs/cert-chain.pem"
+		tls.PrivateKey = "/etc/certs/key.pem"
+		tls.CaCertificates = f.pick("", "/etc/certs/root-cert.pem")
+	}
+	return tls
+}
+
+func (f *configFuzzer) destination() *networking.Destination {
+	d := &networking.Destination{
+		Host:   f.host(),
+		Subset: f.subset(),
+	}
+	if f.chance() {
+		d.Port = &networking.PortSelector{Number: f.port()}
+	}
+	return d
+}
+
+func (f *configFuzzer) stringMatch() *networking.StringMatch {
+	switch f.rand.Intn(4) {
+	case 0:
+		return &networking.StringMatch{MatchType: &networking.StringMatch_Exact{Exact: f.pick("/", "/a", "")}}
+	case 1:
+		return &networking.StringMatch{MatchType: &networking.StringMatch_Prefix{Prefix: f.pick("/", "/a", "a")}}
+	case 2:
+		return &networking.StringMatch{MatchType: &networking.StringMatch_Regex{Regex: f.pick(".*", "/a/[0-9]+", "^$")}}
+	default:
+		return nil
+	}
+}
+
+func (f *configFuzzer) virtualService() *networking.VirtualService {
+	vs := &networking.VirtualService{}
+	for i, n := 0, 1+f.rand.Intn(3); i < n; i++ {
+		vs.Hosts = append(vs.Hosts, f.host())
+	}
+	switch f.rand.Intn(3) {
+	case 1:
+		vs.Gateways = []string{"fuzz-gateway"}
+	case 2:
+		vs.Gateways = []string{"mesh", "fuzz-gateway"}
+	}
+
+	for i, n := 0, f.rand.Intn(4); i < n; i++ {
+		vs.Http = append(vs.Http, f.httpRoute())
+	}
+	for i, n := 0, f.rand.Intn(3); i < n; i++ {
+		tcp := &networking.TCPRoute{}
+		if f.chance() {
+			tcp.Match = []*networking.L4MatchAttributes{{
+				Port:               f.port(),
+				DestinationSubnets: []string{f.pick("10.0.0.0/8", "1.1.1.1")},
+			}}
+		}
+		for j, m := 0, 1+f.rand.Intn(3); j < m; j++ {
+			tcp.Route = append(tcp.Route, &networking.RouteDestination{
+				Destination: f.destination(),
+				Weight:      int32(f.rand.Intn(101)),
+			})
+		}
+		vs.Tcp = append(vs.Tcp, tcp)
+	}
+	return vs
+}
+
+func (f *configFuzzer) httpRoute() *networking.HTTPRoute {
+	r := &networking.HTTPRoute{
+		Name:    f.pick("", "route", "route.with.dots"),
+		Timeout: f.duration(),
+	}
+	for i, n := 0, f.rand.Intn(3); i < n; i++ {
+		match := &networking.HTTPMatchRequest{
+			Uri:           f.stringMatch(),
+			Method:        f.stringMatch(),
+			IgnoreUriCase: f.chance(),
+		}
+		if f.chance() {
+			match.Port = f.port()
+		}
+		if f.chance() {
+			match.Headers = map[string]*networking.StringMatch{"x-user": f.stringMatch()}
+		}
+		r.Match = append(r.Match, match)
+	}
+
+	if f.rand.Intn(5) == 0 {
+		r.Redirect = &networking.HTTPRedirect{Uri: f.pick("", "/b"), Authority: f.pick("", "b.example.com")}
+		return r
+	}
+	for i, n := 0, 1+f.rand.Intn(3); i < n; i++ {
+		r.Route = append(r.Route, &networking.HTTPRouteDestination{
+			Destination: f.destination(),
+			Weight:      int32(f.rand.Intn(101)),
+		})
+	}
+	if f.chance() {
+		r.Rewrite = &networking.HTTPRewrite{Uri: f.pick("", "/"), Authority: f.pick("", "b")}
+	}
+	if f.chance() {
+		r.Retries = &networking.HTTPRetry{
+			Attempts:      int32(f.rand.Intn(5)),
+			PerTryTimeout: f.duration(),
+			RetryOn:       f.pick("", "5xx", "gateway-error,connect-failure"),
+		}
+	}
+	if f.chance() {
+		r.Fault = &networking.HTTPFaultInjection{
+			Delay: &networking.HTTPFaultInjection_Delay{
+				HttpDelayType: &networking.HTTPFaultInjection_Delay_FixedDelay{FixedDelay: types.DurationProto(time.Second)},
+				Percentage:    &networking.Percent{Value: float64(f.rand.Intn(101))},
+			},
+			Abort: &networking.HTTPFaultInjection_Abort{
+				ErrorType:  &networking.HTTPFaultInjection_Abort_HttpStatus{HttpStatus: int32(200 + f.rand.Intn(400))},
+				Percentage: &networking.Percent{Value: float64(f.rand.Intn(101))},
+			},
+		}
+	}
+	if f.chance() {
+		r.Mirror = f.destination()
+	}
+	if f.chance() {
+		r.Headers = &networking.Headers{
+			Request:  &networking.Headers_HeaderOperations{Set: map[string]string{"x-fuzz": ""}, Remove: []string{"x-user"}},
+			Response: &networking.Headers_HeaderOperations{Add: map[string]string{"x-fuzz": "a"}},
+		}
+	}
+	return r
+}
+
+func (f *configFuzzer) sidecar() *networking.Sidecar {
+	sc := &networking.Sidecar{}
+	if f.chance() {
+		sc.WorkloadSelector = &networking.WorkloadSelector{Labels: map[string]string{"app": f.pick("a", "b")}}
+	}
+	for i, n := 0, f.rand.Intn(3); i < n; i++ {
+		egress := &networking.IstioEgressListener{}
+		if f.chance() {
+			port := f.port()
+			egress.Port = &networking.Port{
+				Number:   port,
+				Protocol: f.pick("HTTP", "TCP", "GRPC", "HTTP2"),
+				Name:     fmt.Sprintf("egress-%d", port),
+			}
+		}
+		for j, m := 0, 1+f.rand.Intn(3); j < m; j++ {
+			egress.Hosts = append(egress.Hosts, f.pick("*/*", "./*", fuzzNamespace+"/a."+fuzzNamespace+".svc.cluster.local",
+				"istio-system/*", "~/*", "*/unknown.example.com"))
+		}
+		sc.Egress = append(sc.Egress, egress)
+	}
+	if f.chance() {
+		port := f.port()
+		sc.Ingress = []*networking.IstioIngressListener{{
+			Port: &networking.Port{
+				Number:   port,
+				Protocol: f.pick("HTTP", "TCP", "GRPC"),
+				Name:     fmt.Sprintf("ingress-%d", port),
+			},
+			DefaultEndpoint: f.pick("127.0.0.1:8080", "unix:///var/run/app.sock"),
+		}}
+	}
+	if f.chance() {
+		sc.OutboundTrafficPolicy = &networking.OutboundTrafficPolicy{
+			Mode: networking.OutboundTrafficPolicy_Mode(f.rand.Intn(2)),
+		}
+	}
+	return sc
+}
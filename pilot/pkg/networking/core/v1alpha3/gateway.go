@@ -16,6 +16,7 @@ package v1alpha3
 
 import (
 	"fmt"
+	"math"
 	"sort"
 	"strconv"
 	"strings"
@@ -101,6 +102,7 @@ func (configgen *ConfigGeneratorImpl) buildGatewayListeners(
 			}
 			opts.filterChainOpts = filterChainOpts
 		}
+		setGatewayMetadataHeadersFilter(node, push, mergedGateway, servers, opts.filterChainOpts)
 
 		l := buildListener(opts)
 		l.TrafficDirection = core.TrafficDirection_OUTBOUND
@@ -159,11 +161,11 @@ func (configgen *ConfigGeneratorImpl) buildGatewayListeners(
 				Protocol: p,
 			},
 		}
-		for _, p := range configgen.Plugins {
+		plugin.CallListenerPlugins(configgen.Plugins, mutable, func(p plugin.Plugin) {
 			if err := p.OnOutboundListener(pluginParams, mutable); err != nil {
 				log.Warna("buildGatewayListeners: failed to build listener for gateway: ", err.Error())
 			}
-		}
+		})
 
 		// Filters are serialized one time into an opaque struct once we have the complete list.
 		if err := buildCompleteFilterChain(pluginParams, mutable, opts); err != nil {
@@ -237,7 +239,10 @@ func (configgen *ConfigGeneratorImpl) buildGatewayHTTPRouteConfig(env *model.Env
 		nameToServiceMap[svc.Hostname] = svc
 	}
 
+	// The routes of all the virtual services for a host are merged in a single virtual host, in the order of
+	// mergeVirtualServiceRoutes.
 	vHostDedupMap := make(map[host.Name]*route.VirtualHost)
+	contributions := make(map[host.Name][]virtualServiceRoutes)
 	for _, server := range servers {
 		gatewayName := merged.GatewayNameForServer[server]
 		virtualServices := push.VirtualServices(node, map[string]bool{gatewayName: true})
@@ -258,27 +263,56 @@ func (configgen *ConfigGeneratorImpl) buildGatewayHTTPRouteConfig(env *model.Env
 				log.Debugf("%s omitting routes for service %v due to error: %v", node.ID, virtualService, err)
 				continue
 			}
+			applyVirtualServiceRequestLimit(node, virtualService, routes)
 
 			for _, hostname := range intersectingHosts {
-				if vHost, exists := vHostDedupMap[hostname]; exists {
-					vHost.Routes = istio_route.CombineVHostRoutes(vHost.Routes, routes)
-				} else {
+				if _, exists := vHostDedupMap[hostname]; !exists {
 					newVHost := &route.VirtualHost{
 						Name:    fmt.Sprintf("%s:%d", hostname, port),
 						Domains: []string{string(hostname), fmt.Sprintf("%s:%d", hostname, port)},
-						Routes:  routes,
 					}
 					if server.Tls != nil && server.Tls.HttpsRedirect {
 						newVHost.RequireTls = route.VirtualHost_ALL
 					}
 					vHostDedupMap[hostname] = newVHost
 				}
+				contributions[hostname] = append(contributions[hostname], virtualServiceRoutes{
+					config:      virtualService.ConfigMeta,
+					specificity: hostSpecificity(virtualServiceHosts, hostname),
+					routes:      routes,
+				})
+			}
+		}
+	}
+	for hostname, vHost := range vHostDedupMap {
+		vHost.Routes = mergeVirtualServiceRoutes(node, push, vHost.Name, contributions[hostname])
+	}
+	if servers[0].Tls == nil {
+		for hostname := range httpsRedirectHosts(node, push, merged) {
+			if _, exists := vHostDedupMap[hostname]; !exists {
+				vHostDedupMap[hostname] = buildHTTPSRedirectVirtualHost(node, hostname, port)
 			}
 		}
 	}
 
+	var fallback *model.GatewayFallback
+	for _, server := range servers {
+		if fallback = merged.FallbackForServer[server]; fallback != nil {
+			break
+		}
+	}
+
 	var virtualHosts []*route.VirtualHost
-	if len(vHostDedupMap) == 0 {
+	if fallback != nil {
+		virtualHosts = make([]*route.VirtualHost, 0, len(vHostDedupMap)+1)
+		for _, v := range vHostDedupMap {
+			virtualHosts = append(virtualHosts, v)
+		}
+		// Envoy rejects two virtual hosts with the * domain, so a virtual service of the * host wins.
+		if _, exists := vHostDedupMap[host.Name("*")]; !exists {
+			virtualHosts = append(virtualHosts, buildGatewayFallbackVirtualHost(node, fallback, nameToServiceMap, port))
+		}
+	} else if len(vHostDedupMap) == 0 {
 		log.Warnf("constructed http route config for port %d with no vhosts; Setting up a default 404 vhost", port)
 		virtualHosts = []*route.VirtualHost{{
 			Name:    fmt.Sprintf("blackhole:%d", port),
@@ -315,6 +349,7 @@ func (configgen *ConfigGeneratorImpl) buildGatewayHTTPRouteConfig(env *model.Env
 		VirtualHosts:     virtualHosts,
 		ValidateClusters: proto.BoolFalse,
 	}
+	applyHeaderSanitization(routeCfg, merged, servers)
 
 	in := &plugin.InputParams{
 		ListenerProtocol: plugin.ListenerProtocolHTTP,
@@ -332,6 +367,215 @@ func (configgen *ConfigGeneratorImpl) buildGatewayHTTPRouteConfig(env *model.Env
 	return routeCfg
 }
 
+// setGatewayMetadataHeadersFilter adds to the HTTP filter chains of the servers of a port the filter setting the
+// request headers from the dynamic metadata, as requested by the virtual services bound to their gateways.
+func setGatewayMetadataHeadersFilter(node *model.Proxy, push *model.PushContext, merged *model.MergedGateway,
+	servers []*networking.Server, chains []*filterChainOpts) {
+	gateways := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		gateways[merged.GatewayNameForServer[server]] = true
+	}
+	filter := istio_route.MetadataHeadersFilter(push.GatewayMetadataHeaders(node, gateways), util.IsXDSMarshalingToAnyEnabled(node))
+	if filter == nil {
+		return
+	}
+	for _, chain := range chains {
+		if chain.httpOpts != nil {
+			chain.httpOpts.metadataHeadersFilter = filter
+		}
+	}
+}
+
+// applyHeaderSanitization strips or overwrites, in the route config of the gateway servers, the headers sanitized
+// by any of the servers. The headers are sanitized for all the virtual hosts, regardless of the virtual services.
+func applyHeaderSanitization(routeCfg *xdsapi.RouteConfiguration, merged *model.MergedGateway, servers []*networking.Server) {
+	sanitization := &model.HeaderSanitization{}
+	sanitized := false
+	for _, server := range servers {
+		if s := merged.HeaderSanitizationForServer[server]; s != nil {
+			sanitization.Merge(s)
+			sanitized = true
+		}
+	}
+	if !sanitized {
+		return
+	}
+	routeCfg.RequestHeadersToRemove = sanitization.RemoveRequestHeaders
+	routeCfg.RequestHeadersToAdd = overwrittenHeaders(sanitization.SetRequestHeaders)
+	routeCfg.ResponseHeadersToRemove = sanitization.RemoveResponseHeaders
+	routeCfg.ResponseHeadersToAdd = overwrittenHeaders(sanitization.SetResponseHeaders)
+}
+
+func overwrittenHeaders(headers map[string]string) []*core.HeaderValueOption {
+	if len(headers) == 0 {
+		return nil
+	}
+	out := make([]*core.HeaderValueOption, 0, len(headers))
+	for name, value := range headers {
+		out = append(out, &core.HeaderValueOption{
+			Header: &core.HeaderValue{Key: name, Value: value},
+			Append: proto.BoolFalse,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Header.Key < out[j].Header.Key })
+	return out
+}
+
+// httpsRedirectHosts returns the hosts served with TLS on port 443 by the virtual services of the gateways
+// of the proxy which are redirected to HTTPS, either by the HTTPSRedirectAnnotation of the gateway or by the
+// one of the virtual service.
+func httpsRedirectHosts(node *model.Proxy, push *model.PushContext, merged *model.MergedGateway) map[host.Name]bool {
+	hosts := make(map[host.Name]bool)
+	for _, server := range merged.Servers[443] {
+		if server.Tls == nil || !gateway.IsHTTPServer(server) {
+			continue
+		}
+		gatewayName := merged.GatewayNameForServer[server]
+		for _, virtualService := range push.VirtualServices(node, map[string]bool{gatewayName: true}) {
+			if !merged.HTTPSRedirectServers[server] && virtualService.Annotations[model.HTTPSRedirectAnnotation] != "true" {
+				continue
+			}
+			virtualServiceHosts := host.NewNames(virtualService.Spec.(*networking.VirtualService).Hosts)
+			serverHosts := host.NamesForNamespace(server.Hosts, virtualService.Namespace)
+			for _, hostname := range serverHosts.Intersection(virtualServiceHosts) {
+				hosts[hostname] = true
+			}
+		}
+	}
+	return hosts
+}
+
+// buildHTTPSRedirectVirtualHost builds the virtual host of a plaintext HTTP server redirecting a host to HTTPS.
+func buildHTTPSRedirectVirtualHost(node *model.Proxy, hostname host.Name, port int) *route.VirtualHost {
+	r := &route.Route{
+		Match: &route.RouteMatch{
+			PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"},
+		},
+		Action: &route.Route_Redirect{
+			Redirect: &route.RedirectAction{
+				SchemeRewriteSpecifier: &route.RedirectAction_HttpsRedirect{HttpsRedirect: true},
+			},
+		},
+	}
+	if util.IsIstioVersionGE13(node) {
+		r.Name = istio_route.DefaultRouteName
+	}
+	return &route.VirtualHost{
+		Name:    fmt.Sprintf("%s:%d", hostname, port),
+		Domains: []string{string(hostname), fmt.Sprintf("%s:%d", hostname, port)},
+		Routes:  []*route.Route{r},
+	}
+}
+
+// buildGatewayFallbackVirtualHost builds the catch-all virtual host of the requests matching no host of the
+// gateway, routed to the default backend service of the fallback, or answered with its direct response if
+// there is none or it is unknown.
+func buildGatewayFallbackVirtualHost(node *model.Proxy, fallback *model.GatewayFallback,
+	nameToServiceMap map[host.Name]*model.Service, port int) *route.VirtualHost {
+	r := &route.Route{
+		Match: &route.RouteMatch{
+			PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"},
+		},
+	}
+	if util.IsIstioVersionGE13(node) {
+		r.Name = istio_route.DefaultRouteName
+	}
+
+	if fallback.Host != "" {
+		if svc, exists := nameToServiceMap[fallback.Host]; exists {
+			if _, exists := svc.Ports.GetByPort(fallback.Port); exists {
+				r.Action = &route.Route_Route{
+					Route: &route.RouteAction{
+						ClusterSpecifier: &route.RouteAction_Cluster{
+							Cluster: model.BuildSubsetKey(model.TrafficDirectionOutbound, "", fallback.Host, fallback.Port),
+						},
+					},
+				}
+			}
+		}
+		if r.Action == nil {
+			log.Warnf("gateway fallback destination %s:%d not found for %s, using the fallback response",
+				fallback.Host, fallback.Port, node.ID)
+		}
+	}
+	if r.Action == nil {
+		response := &route.DirectResponseAction{Status: fallback.Status}
+		if fallback.Body != "" {
+			response.Body = &core.DataSource{
+				Specifier: &core.DataSource_InlineString{InlineString: fallback.Body},
+			}
+		}
+		r.Action = &route.Route_DirectResponse{DirectResponse: response}
+	}
+
+	return &route.VirtualHost{
+		Name:    fmt.Sprintf("fallback:%d", port),
+		Domains: []string{"*"},
+		Routes:  []*route.Route{r},
+	}
+}
+
+// virtualServiceRoutes are the routes of a virtual service for a gateway host.
+type virtualServiceRoutes struct {
+	config      model.ConfigMeta
+	specificity int
+	routes      []*route.Route
+}
+
+// hostSpecificity returns how specifically the hosts of a virtual service select a host: exact hosts are the
+// most specific, then the longest wildcard hosts matching the host.
+func hostSpecificity(virtualServiceHosts host.Names, hostname host.Name) int {
+	specificity := -1
+	for _, h := range virtualServiceHosts {
+		if h == hostname {
+			return math.MaxInt32
+		}
+		if hostname.SubsetOf(h) && len(h) > specificity {
+			specificity = len(h)
+		}
+	}
+	return specificity
+}
+
+// mergeVirtualServiceRoutes merges the routes of the virtual services for a host, so that the resulting routes do
+// not depend on the order of the config store. The routes of the virtual services selecting the host most
+// specifically come first, e.g. the ones of foo.example.com before the ones of *.example.com, then the ones
+// of the oldest virtual services, then by name and namespace. The catch-all routes are moved last. Routes shadowed
+// by a route with the same match of a previous virtual service are reported as conflicts.
+func mergeVirtualServiceRoutes(node *model.Proxy, push *model.PushContext, vHostName string,
+	contributions []virtualServiceRoutes) []*route.Route {
+	sort.SliceStable(contributions, func(i, j int) bool {
+		if contributions[i].specificity != contributions[j].specificity {
+			return contributions[i].specificity > contributions[j].specificity
+		}
+		return model.CreatedBefore(&contributions[i].config, &contributions[j].config)
+	})
+
+	var out []*route.Route
+	merged := make(map[string]bool, len(contributions))
+	matches := make(map[string]string)
+	for _, c := range contributions {
+		key := c.config.Namespace + "/" + c.config.Name
+		if merged[key] {
+			// Bound to several servers of the port.
+			continue
+		}
+		merged[key] = true
+		for _, r := range c.routes {
+			match := r.GetMatch().String()
+			owner, f := matches[match]
+			if !f {
+				matches[match] = key
+			} else if owner != key {
+				push.Add(model.VirtualServiceRouteConflicts, vHostName+"/"+key, node,
+					fmt.Sprintf("route %q of virtual service %s shadowed by virtual service %s", r.Name, key, owner))
+			}
+		}
+		out = istio_route.CombineVHostRoutes(out, c.routes)
+	}
+	return out
+}
+
 // builds a HTTP connection manager for servers of type HTTP or HTTPS (mode: simple/mutual)
 func (configgen *ConfigGeneratorImpl) createGatewayHTTPFilterChainOpts(
 	node *model.Proxy, server *networking.Server, routeName string, sdsPath string) *filterChainOpts {
@@ -354,9 +598,12 @@ func (configgen *ConfigGeneratorImpl) createGatewayHTTPFilterChainOpts(
 			sniHosts:   nil,
 			tlsContext: nil,
 			httpOpts: &httpListenerOpts{
-				rds:              routeName,
-				useRemoteAddress: true,
-				direction:        http_conn.HttpConnectionManager_Tracing_EGRESS, // viewed as from gateway to internal
+				rds:                      routeName,
+				useRemoteAddress:         true,
+				direction:                http_conn.HttpConnectionManager_Tracing_EGRESS, // viewed as from gateway to internal
+				compressionFilter:        gatewayCompressionFilter(node, server),
+				grpcJSONTranscoderFilter: gatewayGRPCJSONTranscoderFilter(node, server),
+				bufferFilter:             gatewayBufferFilter(node, server),
 				connectionManager: &http_conn.HttpConnectionManager{
 					// Forward client cert if connection is mTLS
 					ForwardClientCertDetails: http_conn.HttpConnectionManager_SANITIZE_SET,
@@ -368,6 +615,7 @@ func (configgen *ConfigGeneratorImpl) createGatewayHTTPFilterChainOpts(
 					},
 					ServerName:          EnvoyServerName,
 					HttpProtocolOptions: httpProtoOpts,
+					MaxRequestHeadersKb: gatewayMaxRequestHeadersKb(node, server),
 				},
 			},
 		}
@@ -389,9 +637,12 @@ func (configgen *ConfigGeneratorImpl) createGatewayHTTPFilterChainOpts(
 		sniHosts:   getSNIHostsForServer(server),
 		tlsContext: buildGatewayListenerTLSContext(server, enableIngressSdsAgent, sdsPath, node.Metadata),
 		httpOpts: &httpListenerOpts{
-			rds:              routeName,
-			useRemoteAddress: true,
-			direction:        http_conn.HttpConnectionManager_Tracing_EGRESS, // viewed as from gateway to internal
+			rds:                      routeName,
+			useRemoteAddress:         true,
+			direction:                http_conn.HttpConnectionManager_Tracing_EGRESS, // viewed as from gateway to internal
+			compressionFilter:        gatewayCompressionFilter(node, server),
+			grpcJSONTranscoderFilter: gatewayGRPCJSONTranscoderFilter(node, server),
+			bufferFilter:             gatewayBufferFilter(node, server),
 			connectionManager: &http_conn.HttpConnectionManager{
 				// Forward client cert if connection is mTLS
 				ForwardClientCertDetails: http_conn.HttpConnectionManager_SANITIZE_SET,
@@ -403,6 +654,7 @@ func (configgen *ConfigGeneratorImpl) createGatewayHTTPFilterChainOpts(
 				},
 				ServerName:          EnvoyServerName,
 				HttpProtocolOptions: httpProtoOpts,
+				MaxRequestHeadersKb: gatewayMaxRequestHeadersKb(node, server),
 			},
 		},
 	}
@@ -584,12 +836,13 @@ func (configgen *ConfigGeneratorImpl) createGatewayTCPFilterChainOpts(
 
 	// This is opaque TCP server. Find matching virtual services with TCP blocks and forward
 	if server.Tls == nil {
-		if filters := buildGatewayNetworkFiltersFromTCPRoutes(node, env,
+		if filters, metadata := buildGatewayNetworkFiltersFromTCPRoutes(node, env,
 			push, server, gatewaysForWorkload); len(filters) > 0 {
 			return []*filterChainOpts{
 				{
 					sniHosts:       nil,
 					tlsContext:     nil,
+					metadata:       metadata,
 					networkFilters: filters,
 				},
 			}
@@ -598,7 +851,7 @@ func (configgen *ConfigGeneratorImpl) createGatewayTCPFilterChainOpts(
 		// TCP with TLS termination and forwarding. Setup TLS context to terminate, find matching services with TCP blocks
 		// and forward to backend
 		// Validation ensures that non-passthrough servers will have certs
-		if filters := buildGatewayNetworkFiltersFromTCPRoutes(node, env,
+		if filters, metadata := buildGatewayNetworkFiltersFromTCPRoutes(node, env,
 			push, server, gatewaysForWorkload); len(filters) > 0 {
 			enableIngressSdsAgent := false
 			// If proxy version is over 1.1, and proxy sends metadata USER_SDS, then create SDS config for
@@ -610,6 +863,7 @@ func (configgen *ConfigGeneratorImpl) createGatewayTCPFilterChainOpts(
 				{
 					sniHosts:       getSNIHostsForServer(server),
 					tlsContext:     buildGatewayListenerTLSContext(server, enableIngressSdsAgent, env.Mesh.SdsUdsPath, node.Metadata),
+					metadata:       metadata,
 					networkFilters: filters,
 				},
 			}
@@ -625,8 +879,9 @@ func (configgen *ConfigGeneratorImpl) createGatewayTCPFilterChainOpts(
 // buildGatewayNetworkFiltersFromTCPRoutes builds tcp proxy routes for all VirtualServices with TCP blocks.
 // It first obtains all virtual services bound to the set of Gateways for this workload, filters them by this
 // server's port and hostnames, and produces network filters for each destination from the filtered services.
+// It also returns the metadata of the virtual service of the filters.
 func buildGatewayNetworkFiltersFromTCPRoutes(node *model.Proxy, env *model.Environment, push *model.PushContext, server *networking.Server,
-	gatewaysForWorkload map[string]bool) []*listener.Filter {
+	gatewaysForWorkload map[string]bool) ([]*listener.Filter, *core.Metadata) {
 	port := &model.Port{
 		Name:     server.Port.Name,
 		Port:     int(server.Port.Number),
@@ -656,12 +911,12 @@ func buildGatewayNetworkFiltersFromTCPRoutes(node *model.Proxy, env *model.Envir
 		// based on the match port/server port and the gateway name
 		for _, tcp := range vsvc.Tcp {
 			if l4MultiMatch(tcp.Match, server, gatewaysForWorkload) {
-				return buildOutboundNetworkFilters(env, node, tcp.Route, push, port, v.ConfigMeta)
+				return buildOutboundNetworkFilters(env, node, tcp.Route, push, port, v.ConfigMeta), util.BuildConfigInfoMetadata(v.ConfigMeta)
 			}
 		}
 	}
 
-	return nil
+	return nil, nil
 }
 
 // buildGatewayNetworkFiltersFromTLSRoutes builds tcp proxy routes for all VirtualServices with TLS blocks.
@@ -715,6 +970,7 @@ func buildGatewayNetworkFiltersFromTLSRoutes(node *model.Proxy, env *model.Envir
 						filterChains = append(filterChains, &filterChainOpts{
 							sniHosts:       match.SniHosts,
 							tlsContext:     nil, // NO TLS context because this is passthrough
+							metadata:       util.BuildConfigInfoMetadata(v.ConfigMeta),
 							networkFilters: buildOutboundNetworkFilters(env, node, tls.Route, push, port, v.ConfigMeta),
 						})
 					}
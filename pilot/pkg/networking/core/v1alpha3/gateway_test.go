@@ -15,11 +15,15 @@
 package v1alpha3
 
 import (
+	"os"
 	"reflect"
 	"testing"
+	"time"
 
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	auth "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
 	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
 	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
 
 	networking "istio.io/api/networking/v1alpha3"
@@ -31,6 +35,7 @@ import (
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pilot/pkg/security/model"
 	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/config/host"
 	"istio.io/istio/pkg/config/mesh"
 	"istio.io/istio/pkg/config/schemas"
 	"istio.io/istio/pkg/proto"
@@ -850,6 +855,64 @@ func TestGatewayHTTPRouteConfig(t *testing.T) {
 			},
 		},
 	}
+	fallbackGateway := pilot_model.Config{
+		ConfigMeta: pilot_model.ConfigMeta{
+			Name:        "gateway",
+			Namespace:   "default",
+			Annotations: map[string]string{pilot_model.GatewayFallbackResponseAnnotation: "503 no such host"},
+		},
+		Spec: httpGateway.Spec,
+	}
+	redirectGateway := pilot_model.Config{
+		ConfigMeta: pilot_model.ConfigMeta{
+			Name:        "gateway",
+			Namespace:   "default",
+			Annotations: map[string]string{pilot_model.HTTPSRedirectAnnotation: "true"},
+		},
+		Spec: &networking.Gateway{
+			Selector: map[string]string{"istio": "ingressgateway"},
+			Servers: []*networking.Server{
+				{
+					Hosts: []string{"example.org"},
+					Port:  &networking.Port{Name: "http", Number: 80, Protocol: "HTTP"},
+				},
+				{
+					Hosts: []string{"secure.org"},
+					Port:  &networking.Port{Name: "https", Number: 443, Protocol: "HTTPS"},
+					Tls: &networking.Server_TLSOptions{
+						Mode:              networking.Server_TLSOptions_SIMPLE,
+						ServerCertificate: "/etc/cert/cert.pem",
+						PrivateKey:        "/etc/cert/key.pem",
+					},
+				},
+			},
+		},
+	}
+	secureVirtualService := pilot_model.Config{
+		ConfigMeta: pilot_model.ConfigMeta{
+			Type:      schemas.VirtualService.Type,
+			Name:      "virtual-service-secure",
+			Namespace: "default",
+		},
+		Spec: &networking.VirtualService{
+			Hosts:    []string{"secure.org"},
+			Gateways: []string{"gateway"},
+			Http: []*networking.HTTPRoute{
+				{
+					Route: []*networking.HTTPRouteDestination{
+						{
+							Destination: &networking.Destination{
+								Host: "secure.org",
+								Port: &networking.PortSelector{
+									Number: 443,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
 	virtualService := pilot_model.Config{
 		ConfigMeta: pilot_model.ConfigMeta{
 			Type:      schemas.VirtualService.Type,
@@ -926,6 +989,34 @@ func TestGatewayHTTPRouteConfig(t *testing.T) {
 			"http.80",
 			[]string{"example.org:80"},
 		},
+		{
+			"fallback when no services",
+			[]pilot_model.Config{},
+			[]pilot_model.Config{fallbackGateway},
+			"http.80",
+			[]string{"fallback:80"},
+		},
+		{
+			"fallback for the other hosts",
+			[]pilot_model.Config{virtualService},
+			[]pilot_model.Config{fallbackGateway},
+			"http.80",
+			[]string{"example.org:80", "fallback:80"},
+		},
+		{
+			"https redirect for the hosts served with tls",
+			[]pilot_model.Config{virtualService, secureVirtualService},
+			[]pilot_model.Config{redirectGateway},
+			"http.80",
+			[]string{"example.org:80", "secure.org:80"},
+		},
+		{
+			"no https redirect without annotation",
+			[]pilot_model.Config{virtualService, secureVirtualService},
+			[]pilot_model.Config{{ConfigMeta: pilot_model.ConfigMeta{Name: "gateway", Namespace: "default"}, Spec: redirectGateway.Spec}},
+			"http.80",
+			[]string{"example.org:80"},
+		},
 	}
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
@@ -949,6 +1040,50 @@ func TestGatewayHTTPRouteConfig(t *testing.T) {
 
 }
 
+func TestMergeVirtualServiceRoutes(t *testing.T) {
+	now := time.Now()
+	prefix := func(name, p string) *route.Route {
+		return &route.Route{Name: name, Match: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: p}}}
+	}
+	contribution := func(name string, created time.Time, vsHosts []string, routes ...*route.Route) virtualServiceRoutes {
+		return virtualServiceRoutes{
+			config:      pilot_model.ConfigMeta{Name: name, Namespace: "default", CreationTimestamp: created},
+			specificity: hostSpecificity(host.NewNames(vsHosts), "foo.example.org"),
+			routes:      routes,
+		}
+	}
+	contributions := []virtualServiceRoutes{
+		contribution("wildcard", now.Add(-time.Hour), []string{"*.org"}, prefix("wildcard-api", "/api")),
+		contribution("newer", now, []string{"foo.example.org"}, prefix("newer-api", "/api"), prefix("newer-all", "/")),
+		contribution("narrow-wildcard", now.Add(-time.Hour), []string{"*.example.org"}, prefix("narrow", "/narrow")),
+		contribution("older", now.Add(-time.Minute), []string{"foo.example.org"}, prefix("older-all", "/"),
+			prefix("older-api", "/api")),
+	}
+
+	var names []string
+	for i := 0; i < 2; i++ {
+		push := pilot_model.NewPushContext()
+		// The order of the virtual services doesn't change the routes.
+		contributions[0], contributions[3] = contributions[3], contributions[0]
+		var got []string
+		for _, r := range mergeVirtualServiceRoutes(&proxy13Gateway, push, "foo.example.org:80", contributions) {
+			got = append(got, r.Name)
+		}
+		if names == nil {
+			names = got
+		} else if !reflect.DeepEqual(names, got) {
+			t.Errorf("got routes %v, then %v", names, got)
+		}
+		if conflicts := len(push.ProxyStatus[pilot_model.VirtualServiceRouteConflicts.Name()]); conflicts != 2 {
+			t.Errorf("got %d conflicts, want 2: %v", conflicts, push.ProxyStatus[pilot_model.VirtualServiceRouteConflicts.Name()])
+		}
+	}
+	want := []string{"older-api", "newer-api", "narrow", "wildcard-api", "older-all", "newer-all"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got routes %v, want %v", names, want)
+	}
+}
+
 func buildEnv(t *testing.T, gateways []pilot_model.Config, virtualServices []pilot_model.Config) pilot_model.Environment {
 	serviceDiscovery := new(fakes.ServiceDiscovery)
 
@@ -976,3 +1111,105 @@ func buildEnv(t *testing.T, gateways []pilot_model.Config, virtualServices []pil
 	}
 	return env
 }
+
+func TestGatewayDestinations(t *testing.T) {
+	gateway := pilot_model.Config{
+		ConfigMeta: pilot_model.ConfigMeta{
+			Name:      "gateway",
+			Namespace: "default",
+		},
+		Spec: &networking.Gateway{
+			Selector: map[string]string{"istio": "ingressgateway"},
+			Servers: []*networking.Server{
+				{
+					Hosts: []string{"example.org"},
+					Port:  &networking.Port{Name: "http", Number: 80, Protocol: "HTTP"},
+				},
+			},
+		},
+	}
+	destination := func(h string) *networking.Destination {
+		return &networking.Destination{Host: h, Port: &networking.PortSelector{Number: 9080}}
+	}
+	virtualService := func(name, gateway string, dst, mirror string) pilot_model.Config {
+		route := &networking.HTTPRoute{
+			Route: []*networking.HTTPRouteDestination{{Destination: destination(dst)}},
+		}
+		if mirror != "" {
+			route.Mirror = destination(mirror)
+		}
+		return pilot_model.Config{
+			ConfigMeta: pilot_model.ConfigMeta{
+				Type:      schemas.VirtualService.Type,
+				Name:      name,
+				Namespace: "default",
+			},
+			Spec: &networking.VirtualService{
+				Hosts:    []string{"example.org"},
+				Gateways: []string{gateway},
+				Http:     []*networking.HTTPRoute{route},
+			},
+		}
+	}
+	env := buildEnv(t, []pilot_model.Config{gateway}, []pilot_model.Config{
+		virtualService("productpage", "gateway", "productpage.default.svc.cluster.local", "reviews.default.svc.cluster.local"),
+		virtualService("details", "other-gateway", "details.default.svc.cluster.local", ""),
+	})
+	proxy := proxy13Gateway
+	proxy.SetGatewaysForProxy(env.PushContext)
+
+	if got := gatewayDestinations(env.PushContext, &proxy); got != nil {
+		t.Fatalf("gatewayDestinations() = %v without the gateway only mode, want nil", got)
+	}
+
+	_ = os.Setenv(features.GatewayOnly.Name, "true")
+	defer func() { _ = os.Unsetenv(features.GatewayOnly.Name) }()
+
+	want := map[host.Name]bool{
+		"productpage.default.svc.cluster.local": true,
+		"reviews.default.svc.cluster.local":     true,
+	}
+	if got := gatewayDestinations(env.PushContext, &proxy); !reflect.DeepEqual(got, want) {
+		t.Errorf("gatewayDestinations() = %v, want %v", got, want)
+	}
+	if got := gatewayDestinations(env.PushContext, &proxy13); got != nil {
+		t.Errorf("gatewayDestinations() = %v for a sidecar, want nil", got)
+	}
+}
+
+func TestApplyHeaderSanitization(t *testing.T) {
+	serverA := &networking.Server{Hosts: []string{"a.example.com"}}
+	serverB := &networking.Server{Hosts: []string{"b.example.com"}}
+	plain := &networking.Server{Hosts: []string{"c.example.com"}}
+	merged := &pilot_model.MergedGateway{
+		HeaderSanitizationForServer: map[*networking.Server]*pilot_model.HeaderSanitization{
+			serverA: {
+				RemoveRequestHeaders: []string{"x-istio-attributes"},
+				SetResponseHeaders:   map[string]string{"x-served-by": "gateway"},
+			},
+			serverB: {
+				RemoveRequestHeaders:  []string{"x-internal-user"},
+				RemoveResponseHeaders: []string{"x-envoy-upstream-service-time"},
+			},
+		},
+	}
+
+	routeCfg := &xdsapi.RouteConfiguration{}
+	applyHeaderSanitization(routeCfg, merged, []*networking.Server{plain})
+	if !reflect.DeepEqual(routeCfg, &xdsapi.RouteConfiguration{}) {
+		t.Errorf("expected no sanitization, got %v", routeCfg)
+	}
+
+	applyHeaderSanitization(routeCfg, merged, []*networking.Server{serverA, serverB, plain})
+	expected := &xdsapi.RouteConfiguration{
+		RequestHeadersToRemove:  []string{"x-internal-user", "x-istio-attributes"},
+		ResponseHeadersToRemove: []string{"x-envoy-upstream-service-time"},
+		ResponseHeadersToAdd: []*core.HeaderValueOption{{
+			Header: &core.HeaderValue{Key: "x-served-by", Value: "gateway"},
+			Append: proto.BoolFalse,
+		}},
+	}
+	if !reflect.DeepEqual(routeCfg, expected) {
+		t.Errorf("applyHeaderSanitization() = %v, want %v", routeCfg, expected)
+	}
+}
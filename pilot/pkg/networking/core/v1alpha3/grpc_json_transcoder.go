@@ -0,0 +1,89 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	transcoder "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/transcoder/v2"
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+
+	"istio.io/pkg/log"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+)
+
+// buildGRPCJSONTranscoderFilter returns the filter transcoding the JSON requests to gRPC, or nil if there is no
+// transcoding.
+func buildGRPCJSONTranscoderFilter(node *model.Proxy, t *model.GRPCJSONTranscoder) *http_conn.HttpFilter {
+	if t == nil {
+		return nil
+	}
+	filterConfigProto := &transcoder.GrpcJsonTranscoder{
+		DescriptorSet: &transcoder.GrpcJsonTranscoder_ProtoDescriptorBin{ProtoDescriptorBin: t.ProtoDescriptorBin},
+		Services:      t.Services,
+		PrintOptions: &transcoder.GrpcJsonTranscoder_PrintOptions{
+			AddWhitespace:              t.AddWhitespace,
+			AlwaysPrintPrimitiveFields: t.AlwaysPrintPrimitiveFields,
+			AlwaysPrintEnumsAsInts:     t.AlwaysPrintEnumsAsInts,
+			PreserveProtoFieldNames:    t.PreserveProtoFieldNames,
+		},
+	}
+	out := &http_conn.HttpFilter{Name: wellknown.GRPCJSONTranscoder}
+	if util.IsXDSMarshalingToAnyEnabled(node) {
+		out.ConfigType = &http_conn.HttpFilter_TypedConfig{TypedConfig: util.MessageToAny(filterConfigProto)}
+	} else {
+		out.ConfigType = &http_conn.HttpFilter_Config{Config: util.MessageToStruct(filterConfigProto)}
+	}
+	return out
+}
+
+// inboundGRPCJSONTranscoderFilter returns the filter transcoding the JSON requests of the inbound port, as set by
+// the sidecar.istio.io/grpcJsonTranscoder* annotations of the workload, or nil if they are unset or invalid. The
+// transcoded requests are sent to the application as gRPC, so only the HTTP/2 and gRPC ports are transcoded.
+func inboundGRPCJSONTranscoderFilter(node *model.Proxy, push *model.PushContext,
+	instance *model.ServiceInstance) *http_conn.HttpFilter {
+	if node == nil || node.Metadata == nil || node.Metadata.GRPCJSONTranscoderDescriptor == "" {
+		return nil
+	}
+	t, err := model.ParseGRPCJSONTranscoder(node.Metadata.GRPCJSONTranscoderDescriptor,
+		node.Metadata.GRPCJSONTranscoderServices, node.Metadata.GRPCJSONTranscoderPrintOptions)
+	if err != nil {
+		log.Warnf("ignoring the gRPC JSON transcoder of %s: %v", node.ID, err)
+		return nil
+	}
+	if instance == nil || instance.Endpoint.ServicePort == nil || !instance.Endpoint.ServicePort.Protocol.IsHTTP2() {
+		log.Debugf("not transcoding the inbound port of %s to gRPC: not an HTTP/2 or gRPC port", node.ID)
+		return nil
+	}
+	if err := push.ResolveGRPCJSONTranscoder(t, node.ConfigNamespace); err != nil {
+		log.Warnf("ignoring the gRPC JSON transcoder of %s: %v", node.ID, err)
+		push.Add(model.GRPCJSONTranscoderRejected, node.ConfigNamespace+"/"+t.DescriptorName+"/"+t.DescriptorKey,
+			node, err.Error())
+		return nil
+	}
+	return buildGRPCJSONTranscoderFilter(node, t)
+}
+
+// gatewayGRPCJSONTranscoderFilter returns the filter transcoding the JSON requests of the gateway server, as set
+// by the annotations of its gateway, or nil if there is none.
+func gatewayGRPCJSONTranscoderFilter(node *model.Proxy, server *networking.Server) *http_conn.HttpFilter {
+	if node.MergedGateway == nil {
+		return nil
+	}
+	return buildGRPCJSONTranscoderFilter(node, node.MergedGateway.GRPCJSONTranscoderForServer[server])
+}
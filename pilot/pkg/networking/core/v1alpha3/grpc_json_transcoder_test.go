@@ -0,0 +1,115 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"fmt"
+	"testing"
+
+	transcoder "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/transcoder/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/golang/protobuf/ptypes"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/protocol"
+)
+
+type fakeProtoDescriptors map[string][]byte
+
+func (f fakeProtoDescriptors) ProtoDescriptor(kind, namespace, name, key string) ([]byte, error) {
+	bin, ok := f[kind+"/"+namespace+"/"+name+"/"+key]
+	if !ok {
+		return nil, fmt.Errorf("%s %s/%s key %s not found", kind, namespace, name, key)
+	}
+	return bin, nil
+}
+
+func TestInboundGRPCJSONTranscoderFilter(t *testing.T) {
+	bin, err := proto.Marshal(&descriptor.FileDescriptorSet{File: []*descriptor.FileDescriptorProto{{
+		Name:    proto.String("bookstore.proto"),
+		Package: proto.String("bookstore"),
+		Service: []*descriptor.ServiceDescriptorProto{{Name: proto.String("Bookstore")}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	push := model.NewPushContext()
+	push.Env = &model.Environment{ProtoDescriptors: fakeProtoDescriptors{"configmap/default/bookstore/bookstore.pb": bin}}
+	instance := func(p protocol.Instance) *model.ServiceInstance {
+		return &model.ServiceInstance{Endpoint: model.NetworkEndpoint{
+			ServicePort: &model.Port{Name: "grpc", Port: 8080, Protocol: p},
+		}}
+	}
+
+	if f := inboundGRPCJSONTranscoderFilter(&model.Proxy{Metadata: &model.NodeMetadata{}}, push,
+		instance(protocol.GRPC)); f != nil {
+		t.Errorf("expected no transcoder filter, got %v", f)
+	}
+	if f := inboundGRPCJSONTranscoderFilter(&model.Proxy{Metadata: &model.NodeMetadata{
+		GRPCJSONTranscoderDescriptor: "configmap/bookstore/bookstore.pb",
+	}, ConfigNamespace: "default"}, push, instance(protocol.GRPC)); f != nil {
+		t.Errorf("expected no transcoder filter without services, got %v", f)
+	}
+
+	node := &model.Proxy{Metadata: &model.NodeMetadata{
+		GRPCJSONTranscoderDescriptor:   "configmap/bookstore/bookstore.pb",
+		GRPCJSONTranscoderServices:     "bookstore.Bookstore",
+		GRPCJSONTranscoderPrintOptions: "alwaysPrintPrimitiveFields",
+	}, ConfigNamespace: "default"}
+	if f := inboundGRPCJSONTranscoderFilter(node, push, instance(protocol.HTTP)); f != nil {
+		t.Errorf("expected no transcoder filter on an HTTP/1.1 port, got %v", f)
+	}
+	if f := inboundGRPCJSONTranscoderFilter(&model.Proxy{Metadata: node.Metadata, ConfigNamespace: "prod"}, push,
+		instance(protocol.GRPC)); f != nil {
+		t.Errorf("expected no transcoder filter without the proto descriptor set, got %v", f)
+	}
+
+	f := inboundGRPCJSONTranscoderFilter(node, push, instance(protocol.GRPC))
+	if f == nil || f.Name != wellknown.GRPCJSONTranscoder {
+		t.Fatalf("expected the transcoder filter, got %v", f)
+	}
+	got := &transcoder.GrpcJsonTranscoder{}
+	if err := ptypes.UnmarshalAny(f.GetTypedConfig(), got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got.GetProtoDescriptorBin()) != string(bin) ||
+		len(got.Services) != 1 || got.Services[0] != "bookstore.Bookstore" ||
+		!got.PrintOptions.GetAlwaysPrintPrimitiveFields() || got.PrintOptions.GetAddWhitespace() {
+		t.Errorf("unexpected transcoder config %v", got)
+	}
+}
+
+func TestGatewayGRPCJSONTranscoderFilter(t *testing.T) {
+	transcoded := &networking.Server{Hosts: []string{"example.com"}}
+	plain := &networking.Server{Hosts: []string{"other.com"}}
+	node := &model.Proxy{
+		Metadata: &model.NodeMetadata{},
+		MergedGateway: &model.MergedGateway{
+			GRPCJSONTranscoderForServer: map[*networking.Server]*model.GRPCJSONTranscoder{
+				transcoded: {ProtoDescriptorBin: []byte("bookstore"), Services: []string{"bookstore.Bookstore"}},
+			},
+		},
+	}
+	if f := gatewayGRPCJSONTranscoderFilter(node, transcoded); f == nil || f.Name != wellknown.GRPCJSONTranscoder {
+		t.Errorf("expected the transcoder filter, got %v", f)
+	}
+	if f := gatewayGRPCJSONTranscoderFilter(node, plain); f != nil {
+		t.Errorf("expected no transcoder filter, got %v", f)
+	}
+}
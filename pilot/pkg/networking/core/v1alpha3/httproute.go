@@ -95,6 +95,9 @@ func (configgen *ConfigGeneratorImpl) buildSidecarInboundHTTPRouteConfig(env *mo
 		Name:             clusterName,
 		VirtualHosts:     []*route.VirtualHost{inboundVHost},
 		ValidateClusters: proto.BoolFalse,
+		// The header picking the upstream host of the gateways doesn't reach the applications, which could
+		// forward it.
+		RequestHeadersToRemove: []string{originalDstHostHeader},
 	}
 
 	in := &plugin.InputParams{
@@ -20,6 +20,7 @@ import (
 	"net"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -35,6 +36,7 @@ import (
 	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
 	"github.com/golang/protobuf/ptypes"
 	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/golang/protobuf/ptypes/wrappers"
 
 	"istio.io/istio/pkg/util/gogo"
 
@@ -45,6 +47,7 @@ import (
 	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/envoyfilter"
+	istio_route "istio.io/istio/pilot/pkg/networking/core/v1alpha3/route"
 	"istio.io/istio/pilot/pkg/networking/plugin"
 	"istio.io/istio/pilot/pkg/networking/util"
 	authn_model "istio.io/istio/pilot/pkg/security/model"
@@ -497,9 +500,13 @@ func (configgen *ConfigGeneratorImpl) buildSidecarInboundHTTPListenerOptsForPort
 	httpOpts := &httpListenerOpts{
 		routeConfig: configgen.buildSidecarInboundHTTPRouteConfig(pluginParams.Env, pluginParams.Node,
 			pluginParams.Push, pluginParams.ServiceInstance, clusterName),
-		rds:              "", // no RDS for inbound traffic
-		useRemoteAddress: false,
-		direction:        http_conn.HttpConnectionManager_Tracing_INGRESS,
+		rds:                      "", // no RDS for inbound traffic
+		useRemoteAddress:         false,
+		direction:                http_conn.HttpConnectionManager_Tracing_INGRESS,
+		idleTimeout:              inboundIdleTimeout(node),
+		tapFilter:                inboundTapFilter(node),
+		compressionFilter:        inboundCompressionFilter(node),
+		grpcJSONTranscoderFilter: inboundGRPCJSONTranscoderFilter(node, pluginParams.Push, pluginParams.ServiceInstance),
 		connectionManager: &http_conn.HttpConnectionManager{
 			// Append and forward client cert to backend.
 			ForwardClientCertDetails: http_conn.HttpConnectionManager_APPEND_FORWARD,
@@ -513,7 +520,7 @@ func (configgen *ConfigGeneratorImpl) buildSidecarInboundHTTPListenerOptsForPort
 	}
 	// See https://github.com/grpc/grpc-web/tree/master/net/grpc/gateway/examples/helloworld#configure-the-proxy
 	if pluginParams.ServiceInstance.Endpoint.ServicePort.Protocol.IsHTTP2() {
-		httpOpts.connectionManager.Http2ProtocolOptions = &core.Http2ProtocolOptions{}
+		httpOpts.connectionManager.Http2ProtocolOptions = inboundHTTP2ProtocolOptions(node)
 		if pluginParams.ServiceInstance.Endpoint.ServicePort.Protocol == protocol.GRPCWeb {
 			httpOpts.addGRPCWebFilter = true
 		}
@@ -528,6 +535,58 @@ func (configgen *ConfigGeneratorImpl) buildSidecarInboundHTTPListenerOptsForPort
 	return httpOpts
 }
 
+// inboundIdleTimeout returns the idle timeout of the inbound connections of the sidecar, or 0 if it is unset or
+// invalid.
+func inboundIdleTimeout(node *model.Proxy) time.Duration {
+	if node == nil || node.Metadata == nil || node.Metadata.InboundIdleTimeout == "" {
+		return 0
+	}
+	idleTimeout, err := time.ParseDuration(node.Metadata.InboundIdleTimeout)
+	if err != nil || idleTimeout <= 0 {
+		log.Warnf("ignoring invalid sidecar.istio.io/inboundIdleTimeout value %q", node.Metadata.InboundIdleTimeout)
+		return 0
+	}
+	return idleTimeout
+}
+
+// The bounds of the HTTP/2 settings accepted by Envoy.
+const (
+	http2MaxSettingValue     = 2147483647
+	http2MinWindowSize       = 65535
+	http2MinConcurrentStream = 1
+)
+
+// inboundHTTP2ProtocolOptions returns the HTTP/2 options of the inbound HTTP/2 ports, tuned by the
+// sidecar.istio.io/inboundHTTP2* annotations of the workload. The invalid settings are ignored.
+func inboundHTTP2ProtocolOptions(node *model.Proxy) *core.Http2ProtocolOptions {
+	opts := &core.Http2ProtocolOptions{}
+	if node == nil || node.Metadata == nil {
+		return opts
+	}
+	opts.MaxConcurrentStreams = http2Setting("sidecar.istio.io/inboundHTTP2MaxConcurrentStreams",
+		node.Metadata.InboundHTTP2MaxConcurrentStreams, http2MinConcurrentStream)
+	opts.InitialStreamWindowSize = http2Setting("sidecar.istio.io/inboundHTTP2InitialStreamWindowSize",
+		node.Metadata.InboundHTTP2InitialStreamWindowSize, http2MinWindowSize)
+	opts.InitialConnectionWindowSize = http2Setting("sidecar.istio.io/inboundHTTP2InitialConnectionWindowSize",
+		node.Metadata.InboundHTTP2InitialConnectionWindowSize, http2MinWindowSize)
+	return opts
+}
+
+// http2Setting parses the value of an HTTP/2 setting annotation, returning nil if it is unset or out of
+// the [min, 2^31-1] range.
+func http2Setting(name, value string, min uint64) *wrappers.UInt32Value {
+	if value == "" {
+		return nil
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+	if err != nil || v < min || v > http2MaxSettingValue {
+		log.Warnf("ignoring invalid %s value %q: must be an integer between %d and %d",
+			name, value, min, http2MaxSettingValue)
+		return nil
+	}
+	return &wrappers.UInt32Value{Value: uint32(v)}
+}
+
 // buildSidecarInboundListenerForPortOrUDS creates a single listener on the server-side (inbound)
 // for a given port or unix domain socket
 func (configgen *ConfigGeneratorImpl) buildSidecarInboundListenerForPortOrUDS(node *model.Proxy, listenerOpts buildListenerOpts,
@@ -541,6 +600,9 @@ func (configgen *ConfigGeneratorImpl) buildSidecarInboundListenerForPortOrUDS(no
 	listenerMapKey := fmt.Sprintf("%s:%d", listenerOpts.bind, listenerOpts.port)
 
 	if old, exists := listenerMap[listenerMapKey]; exists {
+		if configgen.addInboundServiceFilterChains(node, listenerOpts, pluginParams, old) {
+			return nil
+		}
 		// For sidecar specified listeners, the caller is expected to supply a dummy service instance
 		// with the right port and a hostname constructed from the sidecar config's name+namespace
 		pluginParams.Push.Add(model.ProxyStatusConflictInboundListener, pluginParams.Node.ID, pluginParams.Node,
@@ -642,11 +704,11 @@ func (configgen *ConfigGeneratorImpl) buildSidecarInboundListenerForPortOrUDS(no
 		Listener:     l,
 		FilterChains: getPluginFilterChain(listenerOpts),
 	}
-	for _, p := range configgen.Plugins {
+	plugin.CallListenerPlugins(configgen.Plugins, mutable, func(p plugin.Plugin) {
 		if err := p.OnInboundListener(pluginParams, mutable); err != nil {
 			log.Warn(err.Error())
 		}
-	}
+	})
 	// Filters are serialized one time into an opaque struct once we have the complete list.
 	if err := buildCompleteFilterChain(pluginParams, mutable, listenerOpts); err != nil {
 		log.Warna("buildSidecarInboundListeners ", err.Error())
@@ -656,13 +718,65 @@ func (configgen *ConfigGeneratorImpl) buildSidecarInboundListenerForPortOrUDS(no
 	listenerMap[listenerMapKey] = &inboundListenerEntry{
 		bind:             listenerOpts.bind,
 		instanceHostname: pluginParams.ServiceInstance.Service.Hostname,
+		listener:         mutable.Listener,
 	}
 	return mutable.Listener
 }
 
+// addInboundServiceFilterChains adds the mTLS filter chains of a service to the inbound listener of a port shared with
+// other services, matching the SNI set by the clients of the service. It returns false if the listener is unchanged,
+// e.g. if the service does not use mTLS.
+func (configgen *ConfigGeneratorImpl) addInboundServiceFilterChains(node *model.Proxy, listenerOpts buildListenerOpts,
+	pluginParams *plugin.InputParams, entry *inboundListenerEntry) bool {
+	if !features.InboundFilterChainsPerService.Get() || node.SidecarScope.HasCustomIngressListeners ||
+		entry.listener == nil || pluginParams.ServiceInstance.Service.Hostname == entry.instanceHostname {
+		return false
+	}
+
+	l := configgen.buildSidecarInboundListenerForPortOrUDS(node, listenerOpts, pluginParams, map[string]*inboundListenerEntry{})
+	if l == nil {
+		return false
+	}
+	// The clients set the SNI to the name of their outbound cluster, e.g. outbound_.8080_.v1_.<hostname>.
+	serverName := "*." + string(pluginParams.ServiceInstance.Service.Hostname)
+	added := false
+	for _, chain := range l.FilterChains {
+		if chain.TlsContext == nil {
+			continue
+		}
+		match := listener.FilterChainMatch{}
+		if chain.FilterChainMatch != nil {
+			match = *chain.FilterChainMatch
+		}
+		match.ServerNames = []string{serverName}
+		chain.FilterChainMatch = &match
+		entry.listener.FilterChains = append(entry.listener.FilterChains, chain)
+		added = true
+	}
+	if !added {
+		return false
+	}
+
+	// The SNI is only available with the TLS inspector.
+	for _, lf := range l.ListenerFilters {
+		found := false
+		for _, existing := range entry.listener.ListenerFilters {
+			if existing.Name == lf.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			entry.listener.ListenerFilters = append(entry.listener.ListenerFilters, lf)
+		}
+	}
+	return true
+}
+
 type inboundListenerEntry struct {
 	bind             string
 	instanceHostname host.Name // could be empty if generated via Sidecar CRD
+	listener         *xdsapi.Listener
 }
 
 type outboundListenerEntry struct {
@@ -859,6 +973,11 @@ func (configgen *ConfigGeneratorImpl) buildSidecarOutboundListeners(env *model.E
 			}
 			for _, service := range services {
 				for _, servicePort := range service.Ports {
+					// Traffic to ports excluded from interception never reaches the proxy. A listener
+					// on such a port is useless and would only conflict with the user's intent.
+					if !bindToPort && node.IsOutboundPortExcluded(servicePort.Port) {
+						continue
+					}
 					listenerOpts := buildListenerOpts{
 						env:            env,
 						proxy:          node,
@@ -1349,11 +1468,11 @@ func (configgen *ConfigGeneratorImpl) buildSidecarOutboundListenerForPortOrUDS(n
 		FilterChains: getPluginFilterChain(listenerOpts),
 	}
 
-	for _, p := range configgen.Plugins {
+	plugin.CallListenerPlugins(configgen.Plugins, mutable, func(p plugin.Plugin) {
 		if err := p.OnOutboundListener(pluginParams, mutable); err != nil {
 			log.Warn(err.Error())
 		}
-	}
+	})
 
 	// Filters are serialized one time into an opaque struct once we have the complete list.
 	if err := buildCompleteFilterChain(pluginParams, mutable, listenerOpts); err != nil {
@@ -1513,11 +1632,11 @@ func (configgen *ConfigGeneratorImpl) onVirtualOutboundListener(env *model.Envir
 		FilterChains: make([]plugin.FilterChain, len(ipTablesListener.FilterChains)),
 	}
 
-	for _, p := range configgen.Plugins {
+	plugin.CallListenerPlugins(configgen.Plugins, mutable, func(p plugin.Plugin) {
 		if err := p.OnVirtualListener(pluginParams, mutable); err != nil {
 			log.Warn(err.Error())
 		}
-	}
+	})
 	if len(mutable.FilterChains) > 0 && len(mutable.FilterChains[0].TCP) > 0 {
 		filters := append([]*listener.Filter{}, mutable.FilterChains[0].TCP...)
 		filters = append(filters, fallbackFilter)
@@ -1628,6 +1747,18 @@ type httpListenerOpts struct {
 	// should be added.
 	addGRPCWebFilter bool
 	useRemoteAddress bool
+	// idleTimeout of the connections, overriding the idle timeout of the proxy if set.
+	idleTimeout time.Duration
+	// tapFilter, if set, captures the requests and responses.
+	tapFilter *http_conn.HttpFilter
+	// compressionFilter, if set, compresses the responses.
+	compressionFilter *http_conn.HttpFilter
+	// grpcJSONTranscoderFilter, if set, transcodes the JSON requests to gRPC.
+	grpcJSONTranscoderFilter *http_conn.HttpFilter
+	// bufferFilter, if set, buffers the requests and rejects the larger ones.
+	bufferFilter *http_conn.HttpFilter
+	// metadataHeadersFilter, if set, sets request headers from the dynamic metadata of the filters.
+	metadataHeadersFilter *http_conn.HttpFilter
 }
 
 // filterChainOpts describes a filter chain: a set of filters with the same TLS context
@@ -1662,8 +1793,34 @@ type buildListenerOpts struct {
 func buildHTTPConnectionManager(node *model.Proxy, env *model.Environment, httpOpts *httpListenerOpts,
 	httpFilters []*http_conn.HttpFilter) *http_conn.HttpConnectionManager {
 
-	filters := make([]*http_conn.HttpFilter, len(httpFilters))
-	copy(filters, httpFilters)
+	filters := make([]*http_conn.HttpFilter, 0, len(httpFilters)+10)
+	// The weight bucket header must be set before any filter selects the route.
+	if f := istio_route.WeightBucketFilter(util.IsXDSMarshalingToAnyEnabled(node)); f != nil {
+		filters = append(filters, f)
+	}
+	// The tap filter precedes the filters of the plugins, so the requests they reject are captured too.
+	if httpOpts.tapFilter != nil {
+		filters = append(filters, httpOpts.tapFilter)
+	}
+	// The oversized requests are rejected before they reach the filters of the plugins.
+	if httpOpts.bufferFilter != nil {
+		filters = append(filters, httpOpts.bufferFilter)
+	}
+	filters = append(filters, httpFilters...)
+
+	// The metadata headers are set from the metadata produced by the filters of the plugins.
+	if httpOpts.metadataHeadersFilter != nil {
+		filters = append(filters, httpOpts.metadataHeadersFilter)
+	}
+
+	if httpOpts.compressionFilter != nil {
+		filters = append(filters, httpOpts.compressionFilter)
+	}
+
+	// The transcoder follows the compression filter, so that the JSON responses it produces are compressed.
+	if httpOpts.grpcJSONTranscoderFilter != nil {
+		filters = append(filters, httpOpts.grpcJSONTranscoderFilter)
+	}
 
 	if httpOpts.addGRPCWebFilter {
 		filters = append(filters, &http_conn.HttpFilter{Name: wellknown.GRPCWeb})
@@ -1699,6 +1856,12 @@ func buildHTTPConnectionManager(node *model.Proxy, env *model.Environment, httpO
 	if idleTimeout > 0 && err == nil {
 		connectionManager.IdleTimeout = ptypes.DurationProto(idleTimeout)
 	}
+	if httpOpts.idleTimeout > 0 {
+		connectionManager.IdleTimeout = ptypes.DurationProto(httpOpts.idleTimeout)
+	}
+	if connectionManager.MaxRequestHeadersKb == nil {
+		connectionManager.MaxRequestHeadersKb = proxyMaxRequestHeadersKb(node)
+	}
 
 	notimeout := ptypes.DurationProto(0 * time.Second)
 	connectionManager.StreamIdleTimeout = notimeout
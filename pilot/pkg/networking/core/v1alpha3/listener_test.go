@@ -23,6 +23,8 @@ import (
 	"time"
 
 	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	auth "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	listener "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
 	tcp_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/tcp_proxy/v2"
 	"github.com/envoyproxy/go-control-plane/pkg/conversion"
@@ -30,6 +32,7 @@ import (
 	"github.com/gogo/protobuf/types"
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/wrappers"
 
 	networking "istio.io/api/networking/v1alpha3"
 
@@ -410,6 +413,29 @@ func TestOutboundListenerTCPWithVS(t *testing.T) {
 	}
 }
 
+func TestOutboundListenerExcludedPorts(t *testing.T) {
+	services := []*model.Service{
+		buildServiceWithPort("test1.com", 3306, protocol.TCP, tnow),
+		buildServiceWithPort("test2.com", 8080, protocol.HTTP, tnow),
+	}
+	p := &fakePlugin{}
+	excludingProxy := proxy
+	excludingProxy.Metadata = &model.NodeMetadata{
+		ConfigNamespace:      "not-default",
+		IstioVersion:         "1.1",
+		ExcludeOutboundPorts: "3306",
+	}
+	listeners := buildOutboundListeners(p, &excludingProxy, nil, nil, services...)
+	for _, l := range listeners {
+		if l.Address.GetSocketAddress().GetPortValue() == 3306 {
+			t.Fatalf("expected no listener for excluded port 3306, found %s", l.Name)
+		}
+	}
+	if len(listeners) != 1 {
+		t.Fatalf("expected %d listeners, found %d", 1, len(listeners))
+	}
+}
+
 func TestOutboundListenerForHeadlessServices(t *testing.T) {
 	_ = os.Setenv("PILOT_ENABLE_FALLTHROUGH_ROUTE", "false")
 
@@ -481,6 +507,50 @@ func TestInboundListenerConfig_HTTP(t *testing.T) {
 	}
 }
 
+func TestInboundListenerFilterChainsPerService(t *testing.T) {
+	services := []*model.Service{
+		buildService("test1.com", wildcardIP, protocol.TCP, tnow),
+		buildService("test2.com", wildcardIP, protocol.TCP, tnow.Add(1*time.Second)),
+	}
+	p := &mtlsFakePlugin{}
+
+	listeners := buildInboundListeners(p, &proxy, nil, services...)
+	if len(listeners) != 1 {
+		t.Fatalf("expected 1 listener, got %d", len(listeners))
+	}
+	if hasServerName(listeners[0], "*.test2.com") {
+		t.Fatalf("unexpected filter chain of the second service without %s", features.InboundFilterChainsPerService.Name)
+	}
+
+	_ = os.Setenv(features.InboundFilterChainsPerService.Name, "true")
+	defer func() { _ = os.Unsetenv(features.InboundFilterChainsPerService.Name) }()
+
+	listeners = buildInboundListeners(p, &proxy, nil, services...)
+	if len(listeners) != 1 {
+		t.Fatalf("expected 1 listener, got %d", len(listeners))
+	}
+	if !hasServerName(listeners[0], "*.test2.com") {
+		t.Fatalf("expected a filter chain of the second service, got %v", listeners[0].FilterChains)
+	}
+	if hasServerName(listeners[0], "*.test1.com") {
+		t.Fatalf("unexpected SNI filter chain of the first service")
+	}
+}
+
+func hasServerName(l *xdsapi.Listener, serverName string) bool {
+	for _, fc := range l.FilterChains {
+		if fc.FilterChainMatch == nil {
+			continue
+		}
+		for _, name := range fc.FilterChainMatch.ServerNames {
+			if name == serverName {
+				return fc.TlsContext != nil
+			}
+		}
+	}
+	return false
+}
+
 func TestOutboundListenerConfig_WithSidecar(t *testing.T) {
 	// Add a service and verify it's config
 	services := []*model.Service{
@@ -528,6 +598,70 @@ func TestGetActualWildcardAndLocalHost(t *testing.T) {
 	}
 }
 
+func TestInboundHTTP2ProtocolOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata *model.NodeMetadata
+		expected *core.Http2ProtocolOptions
+	}{
+		{
+			name:     "defaults",
+			metadata: &model.NodeMetadata{},
+			expected: &core.Http2ProtocolOptions{},
+		},
+		{
+			name: "tuned",
+			metadata: &model.NodeMetadata{
+				InboundHTTP2MaxConcurrentStreams:        "1000",
+				InboundHTTP2InitialStreamWindowSize:     "1048576",
+				InboundHTTP2InitialConnectionWindowSize: "16777216",
+			},
+			expected: &core.Http2ProtocolOptions{
+				MaxConcurrentStreams:        &wrappers.UInt32Value{Value: 1000},
+				InitialStreamWindowSize:     &wrappers.UInt32Value{Value: 1048576},
+				InitialConnectionWindowSize: &wrappers.UInt32Value{Value: 16777216},
+			},
+		},
+		{
+			name: "invalid values ignored",
+			metadata: &model.NodeMetadata{
+				InboundHTTP2MaxConcurrentStreams:        "0",
+				InboundHTTP2InitialStreamWindowSize:     "1024",
+				InboundHTTP2InitialConnectionWindowSize: "large",
+			},
+			expected: &core.Http2ProtocolOptions{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := inboundHTTP2ProtocolOptions(&model.Proxy{Metadata: tt.metadata})
+			if !proto.Equal(got, tt.expected) {
+				t.Errorf("inboundHTTP2ProtocolOptions() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestInboundIdleTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata *model.NodeMetadata
+		expected time.Duration
+	}{
+		{"unset", &model.NodeMetadata{IdleTimeout: "10s"}, 0},
+		{"set", &model.NodeMetadata{InboundIdleTimeout: "5m"}, 5 * time.Minute},
+		{"invalid", &model.NodeMetadata{InboundIdleTimeout: "forever"}, 0},
+		{"negative", &model.NodeMetadata{InboundIdleTimeout: "-1s"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inboundIdleTimeout(&model.Proxy{Metadata: tt.metadata}); got != tt.expected {
+				t.Errorf("inboundIdleTimeout() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
 func testOutboundListenerConflict(t *testing.T, services ...*model.Service) {
 	t.Helper()
 
@@ -1507,6 +1641,21 @@ func (p *fakePlugin) OnInboundFilterChains(in *plugin.InputParams) []plugin.Filt
 	return []plugin.FilterChain{{}, {}}
 }
 
+// mtlsFakePlugin returns a mTLS and a plaintext inbound filter chain, as the authn plugin in permissive mode.
+type mtlsFakePlugin struct {
+	fakePlugin
+}
+
+func (p *mtlsFakePlugin) OnInboundFilterChains(in *plugin.InputParams) []plugin.FilterChain {
+	return []plugin.FilterChain{
+		{
+			FilterChainMatch: &listener.FilterChainMatch{ApplicationProtocols: []string{"istio"}},
+			TLSContext:       &auth.DownstreamTlsContext{},
+		},
+		{},
+	}
+}
+
 func isHTTPListener(listener *xdsapi.Listener) bool {
 	if listener == nil {
 		return false
@@ -50,6 +50,9 @@ func buildInboundNetworkFilters(env *model.Environment, node *model.Proxy, insta
 		StatPrefix:       clusterName,
 		ClusterSpecifier: &tcp_proxy.TcpProxy_Cluster{Cluster: clusterName},
 	}
+	if idleTimeout := inboundIdleTimeout(node); idleTimeout > 0 {
+		tcpProxy.IdleTimeout = ptypes.DurationProto(idleTimeout)
+	}
 	tcpFilter := setAccessLogAndBuildTCPFilter(env, node, tcpProxy)
 	return buildNetworkFiltersStack(node, instance.Endpoint.ServicePort, tcpFilter, clusterName, clusterName)
 }
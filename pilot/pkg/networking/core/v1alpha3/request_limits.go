@@ -0,0 +1,124 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	buffer "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/buffer/v2"
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"istio.io/pkg/log"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+)
+
+// gatewayRequestLimits returns the limits of the size of the requests of the gateway server, as set by the
+// annotations of its gateway, or nil if there are none.
+func gatewayRequestLimits(node *model.Proxy, server *networking.Server) *model.RequestLimits {
+	if node.MergedGateway == nil {
+		return nil
+	}
+	return node.MergedGateway.RequestLimitsForServer[server]
+}
+
+// gatewayBufferFilter returns the buffer filter rejecting the requests of the gateway server larger than its
+// MaxRequestBytesAnnotation with a 413, or nil if it is unset.
+func gatewayBufferFilter(node *model.Proxy, server *networking.Server) *http_conn.HttpFilter {
+	limits := gatewayRequestLimits(node, server)
+	if limits == nil || limits.MaxRequestBytes == 0 {
+		return nil
+	}
+	filterConfigProto := &buffer.Buffer{MaxRequestBytes: &wrappers.UInt32Value{Value: limits.MaxRequestBytes}}
+	out := &http_conn.HttpFilter{Name: wellknown.Buffer}
+	if util.IsXDSMarshalingToAnyEnabled(node) {
+		out.ConfigType = &http_conn.HttpFilter_TypedConfig{TypedConfig: util.MessageToAny(filterConfigProto)}
+	} else {
+		out.ConfigType = &http_conn.HttpFilter_Config{Config: util.MessageToStruct(filterConfigProto)}
+	}
+	return out
+}
+
+// gatewayMaxRequestHeadersKb returns the maximum size of the request headers of the gateway server, or nil to
+// keep the Envoy default.
+func gatewayMaxRequestHeadersKb(node *model.Proxy, server *networking.Server) *wrappers.UInt32Value {
+	limits := gatewayRequestLimits(node, server)
+	if limits == nil || limits.MaxRequestHeadersKb == 0 {
+		return nil
+	}
+	return &wrappers.UInt32Value{Value: limits.MaxRequestHeadersKb}
+}
+
+// proxyMaxRequestHeadersKb returns the maximum size of the request headers of the HTTP listeners of the proxy, as
+// set by its sidecar.istio.io/maxRequestHeadersKb annotation, or nil to keep the Envoy default.
+func proxyMaxRequestHeadersKb(node *model.Proxy) *wrappers.UInt32Value {
+	if node == nil || node.Metadata == nil || node.Metadata.MaxRequestHeadersKb == "" {
+		return nil
+	}
+	v, err := model.ParseMaxRequestHeadersKb(node.Metadata.MaxRequestHeadersKb)
+	if err != nil {
+		log.Warnf("ignoring invalid sidecar.istio.io/maxRequestHeadersKb of %s: %v", node.ID, err)
+		return nil
+	}
+	return &wrappers.UInt32Value{Value: v}
+}
+
+// applyVirtualServiceRequestLimit overrides the buffering of the gateway for the routes of the virtual service,
+// as set by its MaxRequestBytesAnnotation. A size of 0 disables the buffering of the routes.
+func applyVirtualServiceRequestLimit(node *model.Proxy, virtualService model.Config, routes []*route.Route) {
+	value, ok := virtualService.Annotations[model.MaxRequestBytesAnnotation]
+	if !ok {
+		return
+	}
+	maxBytes, err := model.ParseMaxRequestBytes(value)
+	if err != nil {
+		log.Warnf("ignoring the request limit of virtual service %s/%s: %v", virtualService.Namespace, virtualService.Name, err)
+		return
+	}
+
+	perRoute := &buffer.BufferPerRoute{}
+	if maxBytes == 0 {
+		perRoute.Override = &buffer.BufferPerRoute_Disabled{Disabled: true}
+	} else {
+		perRoute.Override = &buffer.BufferPerRoute_Buffer{
+			Buffer: &buffer.Buffer{MaxRequestBytes: &wrappers.UInt32Value{Value: maxBytes}},
+		}
+	}
+	setPerFilterConfig(node, routes, wellknown.Buffer, perRoute)
+}
+
+// setPerFilterConfig sets the per route config of the filter in the routes.
+func setPerFilterConfig(node *model.Proxy, routes []*route.Route, filterName string, config proto.Message) {
+	for _, r := range routes {
+		if util.IsXDSMarshalingToAnyEnabled(node) {
+			if r.TypedPerFilterConfig == nil {
+				r.TypedPerFilterConfig = make(map[string]*any.Any)
+			}
+			r.TypedPerFilterConfig[filterName] = util.MessageToAny(config)
+		} else {
+			if r.PerFilterConfig == nil {
+				r.PerFilterConfig = make(map[string]*structpb.Struct)
+			}
+			r.PerFilterConfig[filterName] = util.MessageToStruct(config)
+		}
+	}
+}
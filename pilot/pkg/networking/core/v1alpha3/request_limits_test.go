@@ -0,0 +1,142 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"testing"
+
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	buffer "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/buffer/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestGatewayRequestLimits(t *testing.T) {
+	limited := &networking.Server{Hosts: []string{"api.example.com"}}
+	headersOnly := &networking.Server{Hosts: []string{"www.example.com"}}
+	node := &model.Proxy{
+		Metadata: &model.NodeMetadata{},
+		MergedGateway: &model.MergedGateway{
+			RequestLimitsForServer: map[*networking.Server]*model.RequestLimits{
+				limited:     {MaxRequestBytes: 1024, MaxRequestHeadersKb: 16},
+				headersOnly: {MaxRequestHeadersKb: 8},
+			},
+		},
+	}
+
+	f := gatewayBufferFilter(node, limited)
+	if f == nil || f.Name != wellknown.Buffer {
+		t.Fatalf("expected the buffer filter, got %v", f)
+	}
+	got := &buffer.Buffer{}
+	if err := ptypes.UnmarshalAny(f.GetTypedConfig(), got); err != nil {
+		t.Fatal(err)
+	}
+	if got.MaxRequestBytes.GetValue() != 1024 {
+		t.Errorf("expected a limit of 1024 bytes, got %v", got)
+	}
+	if kb := gatewayMaxRequestHeadersKb(node, limited); kb.GetValue() != 16 {
+		t.Errorf("expected a headers limit of 16KiB, got %v", kb)
+	}
+
+	if f := gatewayBufferFilter(node, headersOnly); f != nil {
+		t.Errorf("expected no buffer filter, got %v", f)
+	}
+	if kb := gatewayMaxRequestHeadersKb(node, headersOnly); kb.GetValue() != 8 {
+		t.Errorf("expected a headers limit of 8KiB, got %v", kb)
+	}
+	if kb := gatewayMaxRequestHeadersKb(node, &networking.Server{}); kb != nil {
+		t.Errorf("expected no headers limit, got %v", kb)
+	}
+}
+
+func TestProxyMaxRequestHeadersKb(t *testing.T) {
+	cases := []struct {
+		value string
+		want  *wrappers.UInt32Value
+	}{
+		{"", nil},
+		{"64", &wrappers.UInt32Value{Value: 64}},
+		{"0", nil},
+		{"97", nil},
+		{"64Ki", nil},
+	}
+	for _, tt := range cases {
+		node := &model.Proxy{Metadata: &model.NodeMetadata{MaxRequestHeadersKb: tt.value}}
+		if got := proxyMaxRequestHeadersKb(node); !proto.Equal(got, tt.want) {
+			t.Errorf("proxyMaxRequestHeadersKb(%q) got %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestApplyVirtualServiceRequestLimit(t *testing.T) {
+	node := &model.Proxy{Metadata: &model.NodeMetadata{}}
+	virtualService := func(annotations map[string]string) model.Config {
+		return model.Config{ConfigMeta: model.ConfigMeta{Name: "api", Namespace: "default", Annotations: annotations}}
+	}
+
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		expected    *buffer.BufferPerRoute
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:        "invalid",
+			annotations: map[string]string{model.MaxRequestBytesAnnotation: "large"},
+		},
+		{
+			name:        "override",
+			annotations: map[string]string{model.MaxRequestBytesAnnotation: "2048"},
+			expected: &buffer.BufferPerRoute{
+				Override: &buffer.BufferPerRoute_Buffer{Buffer: &buffer.Buffer{MaxRequestBytes: &wrappers.UInt32Value{Value: 2048}}},
+			},
+		},
+		{
+			name:        "disabled",
+			annotations: map[string]string{model.MaxRequestBytesAnnotation: "0"},
+			expected:    &buffer.BufferPerRoute{Override: &buffer.BufferPerRoute_Disabled{Disabled: true}},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			routes := []*route.Route{{Name: "upload"}}
+			applyVirtualServiceRequestLimit(node, virtualService(tt.annotations), routes)
+			config, exists := routes[0].TypedPerFilterConfig[wellknown.Buffer]
+			if tt.expected == nil {
+				if exists {
+					t.Fatalf("expected no buffer config, got %v", config)
+				}
+				return
+			}
+			got := &buffer.BufferPerRoute{}
+			if err := ptypes.UnmarshalAny(config, got); err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(got, tt.expected) {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	xdstype "github.com/envoyproxy/go-control-plane/envoy/type"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// destinationTimeoutDenominator is the precision of the split of the routes with destination timeouts.
+const destinationTimeoutDenominator = 10000
+
+// applyDestinationTimeouts overrides the timeout of the routes to the clusters of the subsets with a destination
+// timeout. A route splitting the traffic across weighted clusters, one of which has a destination timeout, is
+// split into one route per cluster, as the weighted clusters cannot have their own timeouts. The routes match a
+// cumulative fraction of the requests, which Envoy compares to the same random value for all the routes of a
+// request, so that each cluster receives the requests in proportion to its weight.
+func applyDestinationTimeouts(routes []*route.Route, routeName string, timeouts model.DestinationTimeouts) []*route.Route {
+	if len(timeouts) == 0 {
+		return routes
+	}
+	out := make([]*route.Route, 0, len(routes))
+	for _, r := range routes {
+		action := r.GetRoute()
+		if action == nil {
+			out = append(out, r)
+			continue
+		}
+		if cluster := action.GetCluster(); cluster != "" {
+			setDestinationTimeout(action, cluster, routeName, timeouts)
+			out = append(out, r)
+			continue
+		}
+		out = append(out, splitDestinationTimeouts(r, routeName, timeouts)...)
+	}
+	return out
+}
+
+// splitDestinationTimeouts returns one route per weighted cluster of the route if one of them has a destination
+// timeout, or the route otherwise.
+func splitDestinationTimeouts(in *route.Route, routeName string, timeouts model.DestinationTimeouts) []*route.Route {
+	weighted := in.GetRoute().GetWeightedClusters()
+	var total uint32
+	overridden := false
+	last := -1
+	for i, cluster := range weighted.GetClusters() {
+		if _, ok := destinationTimeout(cluster.Name, routeName, timeouts); ok {
+			overridden = true
+		}
+		if cluster.Weight.GetValue() > 0 {
+			total += cluster.Weight.GetValue()
+			last = i
+		}
+	}
+	if !overridden || total == 0 {
+		return []*route.Route{in}
+	}
+
+	out := make([]*route.Route, 0, len(weighted.Clusters))
+	var cumulative uint32
+	for i, cluster := range weighted.Clusters {
+		if cluster.Weight.GetValue() == 0 {
+			continue
+		}
+		cumulative += cluster.Weight.GetValue()
+
+		r := proto.Clone(in).(*route.Route)
+		if r.Match == nil {
+			r.Match = &route.RouteMatch{}
+		}
+		if i != last {
+			r.Match.RuntimeFraction = &core.RuntimeFractionalPercent{
+				DefaultValue: &xdstype.FractionalPercent{
+					Numerator:   uint32(uint64(cumulative) * destinationTimeoutDenominator / uint64(total)),
+					Denominator: xdstype.FractionalPercent_TEN_THOUSAND,
+				},
+			}
+		}
+		action := r.GetRoute()
+		action.ClusterSpecifier = &route.RouteAction_Cluster{Cluster: cluster.Name}
+		setDestinationTimeout(action, cluster.Name, routeName, timeouts)
+		r.RequestHeadersToAdd = append(r.RequestHeadersToAdd, cluster.RequestHeadersToAdd...)
+		r.RequestHeadersToRemove = append(r.RequestHeadersToRemove, cluster.RequestHeadersToRemove...)
+		r.ResponseHeadersToAdd = append(r.ResponseHeadersToAdd, cluster.ResponseHeadersToAdd...)
+		r.ResponseHeadersToRemove = append(r.ResponseHeadersToRemove, cluster.ResponseHeadersToRemove...)
+		out = append(out, r)
+	}
+	return out
+}
+
+func setDestinationTimeout(action *route.RouteAction, cluster, routeName string, timeouts model.DestinationTimeouts) {
+	if timeout, ok := destinationTimeout(cluster, routeName, timeouts); ok {
+		d := ptypes.DurationProto(timeout)
+		action.Timeout = d
+		action.MaxGrpcTimeout = d
+	}
+}
+
+func destinationTimeout(cluster, routeName string, timeouts model.DestinationTimeouts) (time.Duration, bool) {
+	_, subset, _, _ := model.ParseSubsetKey(cluster)
+	return timeouts.Timeout(routeName, subset)
+}
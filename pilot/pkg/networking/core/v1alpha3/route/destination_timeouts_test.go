@@ -0,0 +1,139 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"testing"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/duration"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestApplyDestinationTimeouts(t *testing.T) {
+	stable := model.BuildSubsetKey(model.TrafficDirectionOutbound, "v1", "reviews.default.svc.cluster.local", 80)
+	canary := model.BuildSubsetKey(model.TrafficDirectionOutbound, "canary", "reviews.default.svc.cluster.local", 80)
+	weighted := func() *route.Route {
+		return &route.Route{
+			Match: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"}},
+			Action: &route.Route_Route{Route: &route.RouteAction{
+				Timeout:        ptypes.DurationProto(5 * time.Second),
+				MaxGrpcTimeout: ptypes.DurationProto(5 * time.Second),
+				ClusterSpecifier: &route.RouteAction_WeightedClusters{WeightedClusters: &route.WeightedCluster{
+					Clusters: []*route.WeightedCluster_ClusterWeight{
+						{Name: stable, Weight: &wrappers.UInt32Value{Value: 90}},
+						{
+							Name:                stable + "-unused",
+							Weight:              &wrappers.UInt32Value{Value: 0},
+							RequestHeadersToAdd: []*core.HeaderValueOption{{Header: &core.HeaderValue{Key: "x-unused"}}},
+						},
+						{
+							Name:                canary,
+							Weight:              &wrappers.UInt32Value{Value: 10},
+							RequestHeadersToAdd: []*core.HeaderValueOption{{Header: &core.HeaderValue{Key: "x-canary"}}},
+						},
+					},
+				}},
+			}},
+		}
+	}
+	single := func() *route.Route {
+		return &route.Route{
+			Match: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"}},
+			Action: &route.Route_Route{Route: &route.RouteAction{
+				Timeout:          ptypes.DurationProto(5 * time.Second),
+				MaxGrpcTimeout:   ptypes.DurationProto(5 * time.Second),
+				ClusterSpecifier: &route.RouteAction_Cluster{Cluster: canary},
+			}},
+		}
+	}
+
+	t.Run("no timeouts", func(t *testing.T) {
+		in := weighted()
+		out := applyDestinationTimeouts([]*route.Route{in}, "reviews", nil)
+		if len(out) != 1 || out[0] != in {
+			t.Fatalf("got %v, want the route unchanged", out)
+		}
+	})
+
+	t.Run("timeout of another route", func(t *testing.T) {
+		out := applyDestinationTimeouts([]*route.Route{weighted()}, "reviews",
+			model.DestinationTimeouts{"ratings/canary": time.Second})
+		if len(out) != 1 || out[0].GetRoute().GetWeightedClusters() == nil {
+			t.Fatalf("got %v, want the weighted route unchanged", out)
+		}
+	})
+
+	t.Run("single cluster", func(t *testing.T) {
+		out := applyDestinationTimeouts([]*route.Route{single()}, "reviews",
+			model.DestinationTimeouts{"canary": time.Second})
+		if len(out) != 1 {
+			t.Fatalf("got %d routes, want 1", len(out))
+		}
+		assertTimeout(t, out[0], time.Second)
+		if out[0].Match.RuntimeFraction != nil {
+			t.Errorf("got runtime fraction %v, want none", out[0].Match.RuntimeFraction)
+		}
+	})
+
+	t.Run("weighted clusters", func(t *testing.T) {
+		out := applyDestinationTimeouts([]*route.Route{weighted()}, "reviews",
+			model.DestinationTimeouts{"canary": 3 * time.Second, "reviews/canary": time.Second})
+		if len(out) != 2 {
+			t.Fatalf("got %d routes, want one per weighted cluster", len(out))
+		}
+
+		if got := out[0].GetRoute().GetCluster(); got != stable {
+			t.Errorf("got cluster %q, want %q", got, stable)
+		}
+		assertTimeout(t, out[0], 5*time.Second)
+		if got := out[0].Match.RuntimeFraction.GetDefaultValue().GetNumerator(); got != 9000 {
+			t.Errorf("got numerator %d, want 9000", got)
+		}
+		if len(out[0].RequestHeadersToAdd) != 0 {
+			t.Errorf("got headers %v, want none", out[0].RequestHeadersToAdd)
+		}
+
+		if got := out[1].GetRoute().GetCluster(); got != canary {
+			t.Errorf("got cluster %q, want %q", got, canary)
+		}
+		assertTimeout(t, out[1], time.Second)
+		if out[1].Match.RuntimeFraction != nil {
+			t.Errorf("got runtime fraction %v, want none for the last cluster", out[1].Match.RuntimeFraction)
+		}
+		if len(out[1].RequestHeadersToAdd) != 1 || out[1].RequestHeadersToAdd[0].Header.Key != "x-canary" {
+			t.Errorf("got headers %v, want the headers of the cluster", out[1].RequestHeadersToAdd)
+		}
+		if out[1].Match.GetPrefix() != "/" {
+			t.Errorf("got match %v, want the match of the route", out[1].Match)
+		}
+	})
+}
+
+func assertTimeout(t *testing.T, r *route.Route, want time.Duration) {
+	t.Helper()
+	action := r.GetRoute()
+	for _, d := range []*duration.Duration{action.Timeout, action.MaxGrpcTimeout} {
+		got, err := ptypes.Duration(d)
+		if err != nil || got != want {
+			t.Errorf("got timeout %v, want %v", d, want)
+		}
+	}
+}
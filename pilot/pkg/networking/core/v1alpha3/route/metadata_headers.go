@@ -0,0 +1,88 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"fmt"
+	"strings"
+
+	lua "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/lua/v2"
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	xdsutil "github.com/envoyproxy/go-control-plane/pkg/wellknown"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+)
+
+// metadataHeadersLuaPrelude looks up a value in the dynamic metadata, using the first value of the lists.
+// Modifying the headers clears the route cache, so the routes are selected with the headers set.
+const metadataHeadersLuaPrelude = `local function lookup(value, path)
+  for _, key in ipairs(path) do
+    if type(value) ~= "table" then
+      return nil
+    end
+    value = value[key]
+    if type(value) == "table" and value[1] ~= nil then
+      value = value[1]
+    end
+  end
+  if type(value) == "table" then
+    return nil
+  end
+  return value
+end
+
+function envoy_on_request(handle)
+  local headers = handle:headers()
+  local metadata = handle:streamInfo():dynamicMetadata()
+`
+
+// metadataHeaderLuaTemplate removes the header, so it cannot be forged by the downstream, and sets it from
+// the dynamic metadata of the filter.
+const metadataHeaderLuaTemplate = `  headers:remove(%[1]q)
+  local value = lookup(metadata:get(%[2]q), {%[3]s})
+  if value ~= nil then
+    headers:add(%[1]q, tostring(value))
+  end
+`
+
+// MetadataHeadersFilter returns the HTTP filter setting the request headers from the dynamic metadata, or nil if
+// there are none. It must follow the filters producing the metadata.
+func MetadataHeadersFilter(headers []model.MetadataHeader, isXDSMarshalingToAnyEnabled bool) *http_conn.HttpFilter {
+	if len(headers) == 0 {
+		return nil
+	}
+	var code strings.Builder
+	code.WriteString(metadataHeadersLuaPrelude)
+	for _, h := range headers {
+		path := make([]string, 0, len(h.Path))
+		for _, key := range h.Path {
+			path = append(path, fmt.Sprintf("%q", key))
+		}
+		code.WriteString(fmt.Sprintf(metadataHeaderLuaTemplate, h.Header, h.Filter, strings.Join(path, ", ")))
+	}
+	code.WriteString("end\n")
+
+	filterConfigProto := &lua.Lua{InlineCode: code.String()}
+	out := &http_conn.HttpFilter{
+		Name: xdsutil.Lua,
+	}
+	if isXDSMarshalingToAnyEnabled {
+		out.ConfigType = &http_conn.HttpFilter_TypedConfig{TypedConfig: util.MessageToAny(filterConfigProto)}
+	} else {
+		out.ConfigType = &http_conn.HttpFilter_Config{Config: util.MessageToStruct(filterConfigProto)}
+	}
+	return out
+}
@@ -15,17 +15,39 @@
 package retry
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	"github.com/golang/protobuf/ptypes"
+	structpb "github.com/golang/protobuf/ptypes/struct"
 	"github.com/golang/protobuf/ptypes/wrappers"
 
 	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
 )
 
+// The retry host predicates of RetryHostPredicatesAnnotation.
+const (
+	// PreviousHostsPredicate avoids the hosts already attempted by the request.
+	PreviousHostsPredicate = "previousHosts"
+	// CanaryHostsPredicate avoids the canary endpoints.
+	CanaryHostsPredicate = "canaryHosts"
+	// NoHostPredicates retries on any host.
+	NoHostPredicates = "none"
+)
+
+var hostPredicateNames = map[string]string{
+	PreviousHostsPredicate: "envoy.retry_host_predicates.previous_hosts",
+	CanaryHostsPredicate:   "envoy.retry_host_predicates.omit_canary_hosts",
+}
+
 // DefaultPolicy gets a copy of the default retry policy.
 func DefaultPolicy() *route.RetryPolicy {
 	policy := route.RetryPolicy{
@@ -45,6 +67,124 @@ func DefaultPolicy() *route.RetryPolicy {
 	return &policy
 }
 
+// ActivatorPolicy gets a copy of the retry policy of the requests sent to the activator of a service scaled to zero.
+// The requests are retried with a backoff while the activator or the service scales up.
+func ActivatorPolicy() *route.RetryPolicy {
+	policy := DefaultPolicy()
+	policy.NumRetries = &wrappers.UInt32Value{Value: 5}
+	policy.RetryBackOff = &route.RetryPolicy_RetryBackOff{
+		BaseInterval: ptypes.DurationProto(100 * time.Millisecond),
+		MaxInterval:  ptypes.DurationProto(time.Second),
+	}
+	return policy
+}
+
+// ApplyHostPredicateAnnotations overrides the host predicates of a retry policy with the retry host annotations of
+// a config, if set.
+func ApplyHostPredicateAnnotations(policy *route.RetryPolicy, meta *model.ConfigMeta) {
+	if policy == nil || meta == nil {
+		return
+	}
+	if value, f := meta.Annotations[model.RetryHostPredicatesAnnotation]; f {
+		predicates, err := parseHostPredicates(value)
+		if err != nil {
+			log.Warnf("ignored invalid %s annotation %q of %s %s/%s: %v",
+				model.RetryHostPredicatesAnnotation, value, meta.Type, meta.Namespace, meta.Name, err)
+		} else {
+			policy.RetryHostPredicate = predicates
+		}
+	}
+	if attempts := model.UInt32Annotation(meta, model.RetryHostSelectionMaxAttemptsAnnotation); attempts != nil {
+		policy.HostSelectionRetryMaxAttempts = int64(*attempts)
+	}
+}
+
+// ApplyHedgeAnnotation hedges the requests of a route with the hedge delay annotation of its virtual service, if
+// set: the retry policy sends a second request to the next priority, i.e. the next locality, when the delay expires
+// as the per try timeout, without canceling the first request. Only the routes matching the GET or HEAD method are
+// hedged, as the other requests may not be idempotent. The per try timeout of the retries of the route, if set,
+// is kept as the delay.
+func ApplyHedgeAnnotation(action *route.RouteAction, match *networking.HTTPMatchRequest, meta *model.ConfigMeta) {
+	value, f := meta.Annotations[model.HedgeDelayAnnotation]
+	if !f || action.RetryPolicy == nil {
+		return
+	}
+	delay, err := time.ParseDuration(value)
+	if err != nil || delay <= 0 {
+		log.Warnf("ignored invalid %s annotation %q of %s %s/%s",
+			model.HedgeDelayAnnotation, value, meta.Type, meta.Namespace, meta.Name)
+		return
+	}
+	if !isIdempotentMatch(match) {
+		log.Debugf("%s annotation of %s %s/%s not applied to a route not matching the GET or HEAD method",
+			model.HedgeDelayAnnotation, meta.Type, meta.Namespace, meta.Name)
+		return
+	}
+
+	action.HedgePolicy = &route.HedgePolicy{HedgeOnPerTryTimeout: true}
+	policy := action.RetryPolicy
+	if policy.PerTryTimeout == nil {
+		policy.PerTryTimeout = ptypes.DurationProto(delay)
+	}
+	// The per try timeouts are retried as gateway errors.
+	policy.RetryOn = appendRetryOn(policy.RetryOn, "gateway-error", "5xx")
+	policy.RetryPriority = &route.RetryPolicy_RetryPriority{
+		Name: "envoy.retry_priorities.previous_priorities",
+		ConfigType: &route.RetryPolicy_RetryPriority_Config{
+			Config: &structpb.Struct{
+				Fields: map[string]*structpb.Value{
+					"update_frequency": {Kind: &structpb.Value_NumberValue{NumberValue: 1}},
+				},
+			},
+		},
+	}
+}
+
+// isIdempotentMatch returns true if the match only matches the GET or HEAD method.
+func isIdempotentMatch(match *networking.HTTPMatchRequest) bool {
+	switch match.GetMethod().GetExact() {
+	case http.MethodGet, http.MethodHead:
+		return true
+	}
+	return false
+}
+
+// appendRetryOn appends the retry condition to the comma separated conditions, unless it or one of the conditions
+// including it is set.
+func appendRetryOn(retryOn, condition string, including ...string) string {
+	for _, existing := range strings.Split(retryOn, ",") {
+		existing = strings.TrimSpace(existing)
+		if existing == condition {
+			return retryOn
+		}
+		for _, c := range including {
+			if existing == c {
+				return retryOn
+			}
+		}
+	}
+	if retryOn == "" {
+		return condition
+	}
+	return retryOn + "," + condition
+}
+
+func parseHostPredicates(value string) ([]*route.RetryPolicy_RetryHostPredicate, error) {
+	predicates := make([]*route.RetryPolicy_RetryHostPredicate, 0)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == NoHostPredicates {
+			continue
+		}
+		envoyName, f := hostPredicateNames[name]
+		if !f {
+			return nil, fmt.Errorf("unknown retry host predicate %q", name)
+		}
+		predicates = append(predicates, &route.RetryPolicy_RetryHostPredicate{Name: envoyName})
+	}
+	return predicates, nil
+}
+
 // ConvertPolicy converts the given Istio retry policy to an Envoy policy.
 //
 // If in is nil, DefaultPolicy is returned.
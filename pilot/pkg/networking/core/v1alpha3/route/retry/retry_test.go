@@ -18,11 +18,13 @@ import (
 	"testing"
 	"time"
 
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
 	gogoTypes "github.com/gogo/protobuf/types"
 	"github.com/golang/protobuf/ptypes"
 	. "github.com/onsi/gomega"
 
 	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/route/retry"
 )
 
@@ -101,7 +103,7 @@ func TestRetryOnWithWhitespace(t *testing.T) {
 		Retries: &networking.HTTPRetry{
 			// Explicitly not retrying.
 			Attempts: 2,
-			RetryOn: " some,	,fake ,	conditions, ,",
+			RetryOn:  " some,	,fake ,	conditions, ,",
 		},
 	}
 
@@ -175,3 +177,78 @@ func TestMissingPerTryTimeoutShouldReturnNil(t *testing.T) {
 	g.Expect(policy).To(Not(BeNil()))
 	g.Expect(policy.PerTryTimeout).To(BeNil())
 }
+
+func TestHostPredicateAnnotations(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	policy := retry.DefaultPolicy()
+	retry.ApplyHostPredicateAnnotations(policy, &model.ConfigMeta{Annotations: map[string]string{
+		model.RetryHostPredicatesAnnotation:           "previousHosts, canaryHosts",
+		model.RetryHostSelectionMaxAttemptsAnnotation: "3",
+	}})
+	g.Expect(policy.RetryHostPredicate).To(HaveLen(2))
+	g.Expect(policy.RetryHostPredicate[0].Name).To(Equal("envoy.retry_host_predicates.previous_hosts"))
+	g.Expect(policy.RetryHostPredicate[1].Name).To(Equal("envoy.retry_host_predicates.omit_canary_hosts"))
+	g.Expect(policy.HostSelectionRetryMaxAttempts).To(Equal(int64(3)))
+
+	policy = retry.DefaultPolicy()
+	retry.ApplyHostPredicateAnnotations(policy, &model.ConfigMeta{Annotations: map[string]string{
+		model.RetryHostPredicatesAnnotation: "none",
+	}})
+	g.Expect(policy.RetryHostPredicate).To(BeEmpty())
+
+	// Invalid annotations are ignored.
+	policy = retry.DefaultPolicy()
+	retry.ApplyHostPredicateAnnotations(policy, &model.ConfigMeta{Annotations: map[string]string{
+		model.RetryHostPredicatesAnnotation:           "previousHosts,unknown",
+		model.RetryHostSelectionMaxAttemptsAnnotation: "-1",
+	}})
+	g.Expect(*policy).To(Equal(*retry.DefaultPolicy()))
+}
+
+func TestHedgeAnnotation(t *testing.T) {
+	g := NewGomegaWithT(t)
+	hedged := &model.ConfigMeta{Annotations: map[string]string{
+		model.HedgeDelayAnnotation: "50ms",
+	}}
+	methodMatch := func(method string) *networking.HTTPMatchRequest {
+		return &networking.HTTPMatchRequest{
+			Method: &networking.StringMatch{MatchType: &networking.StringMatch_Exact{Exact: method}},
+		}
+	}
+
+	action := &route.RouteAction{RetryPolicy: retry.DefaultPolicy()}
+	retry.ApplyHedgeAnnotation(action, methodMatch("GET"), hedged)
+	g.Expect(action.HedgePolicy).To(Not(BeNil()))
+	g.Expect(action.HedgePolicy.HedgeOnPerTryTimeout).To(BeTrue())
+	g.Expect(action.RetryPolicy.PerTryTimeout).To(Equal(ptypes.DurationProto(50 * time.Millisecond)))
+	g.Expect(action.RetryPolicy.RetryOn).To(Equal(retry.DefaultPolicy().RetryOn + ",gateway-error"))
+	g.Expect(action.RetryPolicy.RetryPriority.Name).To(Equal("envoy.retry_priorities.previous_priorities"))
+
+	// The per try timeout and the retry conditions including the gateway errors are kept.
+	action = &route.RouteAction{RetryPolicy: &route.RetryPolicy{PerTryTimeout: ptypes.DurationProto(time.Second), RetryOn: "5xx"}}
+	retry.ApplyHedgeAnnotation(action, methodMatch("HEAD"), hedged)
+	g.Expect(action.HedgePolicy).To(Not(BeNil()))
+	g.Expect(action.RetryPolicy.PerTryTimeout).To(Equal(ptypes.DurationProto(time.Second)))
+	g.Expect(action.RetryPolicy.RetryOn).To(Equal("5xx"))
+
+	action = &route.RouteAction{RetryPolicy: &route.RetryPolicy{}}
+	retry.ApplyHedgeAnnotation(action, methodMatch("GET"), hedged)
+	g.Expect(action.RetryPolicy.RetryOn).To(Equal("gateway-error"))
+
+	// The routes not matching the GET or HEAD method are not hedged.
+	for _, match := range []*networking.HTTPMatchRequest{nil, methodMatch("POST")} {
+		action = &route.RouteAction{RetryPolicy: retry.DefaultPolicy()}
+		retry.ApplyHedgeAnnotation(action, match, hedged)
+		g.Expect(action.HedgePolicy).To(BeNil())
+		g.Expect(*action.RetryPolicy).To(Equal(*retry.DefaultPolicy()))
+	}
+
+	// Invalid annotations are ignored.
+	action = &route.RouteAction{RetryPolicy: retry.DefaultPolicy()}
+	retry.ApplyHedgeAnnotation(action, methodMatch("GET"), &model.ConfigMeta{Annotations: map[string]string{
+		model.HedgeDelayAnnotation: "soon",
+	}})
+	g.Expect(action.HedgePolicy).To(BeNil())
+	g.Expect(*action.RetryPolicy).To(Equal(*retry.DefaultPolicy()))
+}
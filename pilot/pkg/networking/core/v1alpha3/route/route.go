@@ -16,6 +16,8 @@ package route
 
 import (
 	"fmt"
+	"net"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -104,25 +106,41 @@ func BuildSidecarVirtualHostsFromConfigAndRegistry(
 		out = append(out, wrappers...)
 	}
 
-	// compute services missing virtual service configs
-	missing := make(map[host.Name]bool)
-	for fqdn := range serviceRegistry {
-		missing[fqdn] = true
-	}
+	// compute the service ports missing virtual service configs, a virtual service may have no route applying to
+	// some ports of its services
+	covered := make(map[host.Name]map[int]bool)
 	for _, wrapper := range out {
 		for _, service := range wrapper.Services {
-			delete(missing, service.Hostname)
+			if covered[service.Hostname] == nil {
+				covered[service.Hostname] = make(map[int]bool)
+			}
+			covered[service.Hostname][wrapper.Port] = true
 		}
 	}
 
-	// append default hosts for the service missing virtual services
-	for fqdn := range missing {
-		svc := serviceRegistry[fqdn]
+	// append default hosts for the service ports missing virtual services
+	for fqdn, svc := range serviceRegistry {
 		for _, port := range svc.Ports {
+			if covered[fqdn][port.Port] {
+				continue
+			}
 			if port.Protocol.IsHTTP() || util.IsProtocolSniffingEnabledForPort(node, port) {
-				cluster := model.BuildSubsetKey(model.TrafficDirectionOutbound, "", svc.Hostname, port.Port)
+				cluster := model.BuildSubsetKey(model.TrafficDirectionOutbound, blueGreenSubset(push, node, svc.Hostname, svc),
+					svc.Hostname, port.Port)
 				traceOperation := fmt.Sprintf("%s:%d/*", svc.Hostname, port.Port)
 				httpRoute := BuildDefaultHTTPOutboundRoute(node, cluster, traceOperation)
+				if activator := activatorCluster(push, svc); activator != "" {
+					httpRoute.GetRoute().ClusterSpecifier = &route.RouteAction_Cluster{Cluster: activator}
+					httpRoute.GetRoute().RetryPolicy = retry.ActivatorPolicy()
+				}
+				if destinationRule := destinationRuleOf(push, node, svc.Hostname, svc); destinationRule != nil {
+					retry.ApplyHostPredicateAnnotations(httpRoute.GetRoute().RetryPolicy, &destinationRule.ConfigMeta)
+				}
+				if svc.Attributes.RewriteHostToExternalName {
+					httpRoute.GetRoute().HostRewriteSpecifier = &route.RouteAction_HostRewrite{
+						HostRewrite: svc.Attributes.ExternalName,
+					}
+				}
 
 				// if this host has no virtualservice, the consistentHash on its destinationRule will be useless
 				if hashPolicy := getHashPolicyByService(node, push, svc, port); hashPolicy != nil {
@@ -204,7 +222,12 @@ func buildSidecarVirtualHostsForVirtualService(
 	meshGateway := map[string]bool{constants.IstioMeshGateway: true}
 	out := make([]VirtualHostWrapper, 0, len(serviceByPort))
 	for port, portServices := range serviceByPort {
-		routes, err := BuildHTTPRoutesForVirtualService(node, push, virtualService, serviceRegistry, listenPort, meshGateway)
+		// When listening on all the ports, the routes of each service port are built from the rules matching it.
+		routePort := listenPort
+		if listenPort == 0 && portServices != nil {
+			routePort = port
+		}
+		routes, err := BuildHTTPRoutesForVirtualService(node, push, virtualService, serviceRegistry, routePort, meshGateway)
 		if err != nil || len(routes) == 0 {
 			continue
 		}
@@ -238,6 +261,25 @@ func GetDestinationCluster(destination *networking.Destination, service *model.S
 	return model.BuildSubsetKey(model.TrafficDirectionOutbound, destination.Subset, host.Name(destination.Host), port)
 }
 
+// activatorCluster returns the outbound cluster of the activator of a service scaled to zero, or "" if the service
+// is not scaled to zero.
+func activatorCluster(push *model.PushContext, service *model.Service) string {
+	if push == nil || service == nil || service.Attributes.Activator == "" || !push.IsScaledToZero(service.Hostname) {
+		return ""
+	}
+	hostname, port, err := net.SplitHostPort(service.Attributes.Activator)
+	if err != nil {
+		log.Warnf("invalid activator %q of service %s: %v", service.Attributes.Activator, service.Hostname, err)
+		return ""
+	}
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		log.Warnf("invalid activator %q of service %s: %v", service.Attributes.Activator, service.Hostname, err)
+		return ""
+	}
+	return model.BuildSubsetKey(model.TrafficDirectionOutbound, "", host.Name(hostname), portNumber)
+}
+
 // BuildHTTPRoutesForVirtualService creates data plane HTTP routes from the virtual service spec.
 // The rule should be adapted to destination names (outbound clusters).
 // Each rule is guarded by source labels.
@@ -259,18 +301,21 @@ func BuildHTTPRoutesForVirtualService(
 		return nil, fmt.Errorf("in not a virtual service: %#v", virtualService)
 	}
 
+	timeouts := model.VirtualServiceDestinationTimeouts(&virtualService)
 	out := make([]*route.Route, 0, len(vs.Http))
 allroutes:
-	for _, http := range vs.Http {
+	for i, http := range vs.Http {
 		if len(http.Match) == 0 {
-			if r := translateRoute(push, node, http, nil, listenPort, virtualService, serviceRegistry, gatewayNames); r != nil {
-				out = append(out, r)
+			if r := translateRoute(push, node, http, i, nil, listenPort, virtualService, serviceRegistry, gatewayNames); r != nil {
+				out = append(out, applyDestinationTimeouts(weightBucketRoutes(r), http.Name, timeouts)...)
+				out = append(out, applyDestinationTimeouts([]*route.Route{r}, http.Name, timeouts)...)
 			}
 			break allroutes // we have a rule with catch all match prefix: /. Other rules are of no use
 		} else {
 			for _, match := range http.Match {
-				if r := translateRoute(push, node, http, match, listenPort, virtualService, serviceRegistry, gatewayNames); r != nil {
-					out = append(out, r)
+				if r := translateRoute(push, node, http, i, match, listenPort, virtualService, serviceRegistry, gatewayNames); r != nil {
+					out = append(out, applyDestinationTimeouts(weightBucketRoutes(r), http.Name, timeouts)...)
+					out = append(out, applyDestinationTimeouts([]*route.Route{r}, http.Name, timeouts)...)
 					rType, _ := getEnvoyRouteTypeAndVal(r)
 					if rType == envoyCatchAll {
 						// We have a catch all route. No point building other routes, with match conditions
@@ -308,8 +353,8 @@ func sourceMatchHTTP(match *networking.HTTPMatchRequest, proxyLabels labels.Coll
 	return false
 }
 
-// translateRoute translates HTTP routes
-func translateRoute(push *model.PushContext, node *model.Proxy, in *networking.HTTPRoute,
+// translateRoute translates HTTP routes, ruleIndex being the index of the rule in the virtual service.
+func translateRoute(push *model.PushContext, node *model.Proxy, in *networking.HTTPRoute, ruleIndex int,
 	match *networking.HTTPMatchRequest, port int,
 	virtualService model.Config,
 	serviceRegistry map[host.Name]*model.Service,
@@ -329,12 +374,16 @@ func translateRoute(push *model.PushContext, node *model.Proxy, in *networking.H
 	}
 
 	out := &route.Route{
-		Match:    translateRouteMatch(match),
-		Metadata: util.BuildConfigInfoMetadata(virtualService.ConfigMeta),
+		Match:    translateRouteMatch(match, node),
+		Metadata: util.BuildRouteConfigInfoMetadata(virtualService.ConfigMeta, ruleIndex),
 	}
 
 	if util.IsIstioVersionGE13(node) {
 		routeName := in.Name
+		if routeName == "" {
+			// Unnamed rules are named after their virtual service, so that the routes can be traced back to it.
+			routeName = fmt.Sprintf("%s.%s.%d", virtualService.Name, virtualService.Namespace, ruleIndex)
+		}
 		if match != nil && match.Name != "" {
 			routeName = routeName + "." + match.Name
 		}
@@ -441,6 +490,7 @@ func translateRoute(push *model.PushContext, node *model.Proxy, in *networking.H
 
 		// TODO: eliminate this logic and use the total_weight option in envoy route
 		weighted := make([]*route.WeightedCluster_ClusterWeight, 0)
+		activated := false
 		for _, dst := range in.Route {
 			weight := &wrappers.UInt32Value{Value: uint32(dst.Weight)}
 			if dst.Weight == 0 {
@@ -467,7 +517,17 @@ func translateRoute(push *model.PushContext, node *model.Proxy, in *networking.H
 			responseHeadersToRemove = append(responseHeadersToRemove, dst.RemoveResponseHeaders...)
 
 			hostname := host.Name(dst.GetDestination().GetHost())
-			n := GetDestinationCluster(dst.Destination, serviceRegistry[hostname], port)
+			destination := dst.Destination
+			if destination.GetSubset() == "" {
+				if subset := blueGreenSubset(push, node, hostname, serviceRegistry[hostname]); subset != "" {
+					destination = &networking.Destination{Host: destination.Host, Subset: subset, Port: destination.Port}
+				}
+			}
+			n := GetDestinationCluster(destination, serviceRegistry[hostname], port)
+			if activator := activatorCluster(push, serviceRegistry[hostname]); activator != "" {
+				n = activator
+				activated = true
+			}
 
 			clusterWeight := &route.WeightedCluster_ClusterWeight{
 				Name:                    n,
@@ -490,6 +550,21 @@ func translateRoute(push *model.PushContext, node *model.Proxy, in *networking.H
 			}
 		}
 
+		// The requests to a service scaled to zero are retried longer, unless the virtual service sets the retries.
+		if activated && in.Retries == nil {
+			action.RetryPolicy = retry.ActivatorPolicy()
+		}
+		if action.RetryPolicy != nil {
+			if len(in.Route) > 0 {
+				hostname := host.Name(in.Route[0].GetDestination().GetHost())
+				if destinationRule := destinationRuleOf(push, node, hostname, serviceRegistry[hostname]); destinationRule != nil {
+					retry.ApplyHostPredicateAnnotations(action.RetryPolicy, &destinationRule.ConfigMeta)
+				}
+			}
+			retry.ApplyHostPredicateAnnotations(action.RetryPolicy, &virtualService.ConfigMeta)
+			retry.ApplyHedgeAnnotation(action, match, &virtualService.ConfigMeta)
+		}
+
 		// rewrite to a single cluster if there is only weighted cluster
 		if len(weighted) == 1 {
 			action.ClusterSpecifier = &route.RouteAction_Cluster{Cluster: weighted[0].Name}
@@ -559,15 +634,17 @@ func translateAppendHeaders(headers map[string]string, appendFlag bool) []*core.
 	return headerValueOptionList
 }
 
-// translateRouteMatch translates match condition
-func translateRouteMatch(in *networking.HTTPMatchRequest) *route.RouteMatch {
+// translateRouteMatch translates match condition. The URI, headers and query parameters support the exact, prefix
+// and regex matches, and the headers and query parameters the presence matches, with empty string matches.
+func translateRouteMatch(in *networking.HTTPMatchRequest, node *model.Proxy) *route.RouteMatch {
 	out := &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"}}
 	if in == nil {
 		return out
 	}
 
+	safeRegex := useSafeRegex(node)
 	for name, stringMatch := range in.Headers {
-		matcher := translateHeaderMatch(name, stringMatch)
+		matcher := translateHeaderMatch(name, stringMatch, safeRegex)
 		out.Headers = append(out.Headers, &matcher)
 	}
 
@@ -583,15 +660,10 @@ func translateRouteMatch(in *networking.HTTPMatchRequest) *route.RouteMatch {
 		case *networking.StringMatch_Prefix:
 			out.PathSpecifier = &route.RouteMatch_Prefix{Prefix: m.Prefix}
 		case *networking.StringMatch_Regex:
-			if features.EnableUnsafeRegex.Get() {
-				out.PathSpecifier = &route.RouteMatch_Regex{Regex: m.Regex}
+			if safeRegex {
+				out.PathSpecifier = &route.RouteMatch_SafeRegex{SafeRegex: regexMatcher(m.Regex)}
 			} else {
-				out.PathSpecifier = &route.RouteMatch_SafeRegex{
-					SafeRegex: &matcher.RegexMatcher{
-						EngineType: &matcher.RegexMatcher_GoogleRe2{GoogleRe2: &matcher.RegexMatcher_GoogleRE2{}},
-						Regex:      m.Regex,
-					},
-				}
+				out.PathSpecifier = &route.RouteMatch_Regex{Regex: m.Regex}
 			}
 		}
 	}
@@ -599,47 +671,98 @@ func translateRouteMatch(in *networking.HTTPMatchRequest) *route.RouteMatch {
 	out.CaseSensitive = &wrappers.BoolValue{Value: !in.IgnoreUriCase}
 
 	if in.Method != nil {
-		matcher := translateHeaderMatch(HeaderMethod, in.Method)
+		matcher := translateHeaderMatch(HeaderMethod, in.Method, safeRegex)
 		out.Headers = append(out.Headers, &matcher)
 	}
 
 	if in.Authority != nil {
-		matcher := translateHeaderMatch(HeaderAuthority, in.Authority)
+		matcher := translateHeaderMatch(HeaderAuthority, in.Authority, safeRegex)
 		out.Headers = append(out.Headers, &matcher)
 	}
 
 	if in.Scheme != nil {
-		matcher := translateHeaderMatch(HeaderScheme, in.Scheme)
+		matcher := translateHeaderMatch(HeaderScheme, in.Scheme, safeRegex)
 		out.Headers = append(out.Headers, &matcher)
 	}
 
 	for name, stringMatch := range in.QueryParams {
-		matcher := translateQueryParamMatch(name, stringMatch)
+		matcher := translateQueryParamMatch(name, stringMatch, node, safeRegex)
 		out.QueryParameters = append(out.QueryParameters, &matcher)
 	}
 
+	// guarantee ordering of query parameters
+	sort.Slice(out.QueryParameters, func(i, j int) bool {
+		return out.QueryParameters[i].Name < out.QueryParameters[j].Name
+	})
+
 	return out
 }
 
-// translateQueryParamMatch translates a StringMatch to a QueryParameterMatcher.
-func translateQueryParamMatch(name string, in *networking.StringMatch) route.QueryParameterMatcher {
+// useSafeRegex returns whether the regex matches of the proxy use the safe regex engine. The proxies older
+// than 1.3 only support the deprecated regex fields.
+func useSafeRegex(node *model.Proxy) bool {
+	return !features.EnableUnsafeRegex.Get() && util.IsIstioVersionGE13(node)
+}
+
+func regexMatcher(regex string) *matcher.RegexMatcher {
+	return &matcher.RegexMatcher{
+		EngineType: &matcher.RegexMatcher_GoogleRe2{GoogleRe2: &matcher.RegexMatcher_GoogleRE2{}},
+		Regex:      regex,
+	}
+}
+
+// translateQueryParamMatch translates a StringMatch to a QueryParameterMatcher. An empty StringMatch matches
+// the presence of the query parameter.
+func translateQueryParamMatch(name string, in *networking.StringMatch, node *model.Proxy,
+	safeRegex bool) route.QueryParameterMatcher {
 	out := route.QueryParameterMatcher{
 		Name: name,
 	}
 
+	if !util.IsIstioVersionGE13(node) {
+		// The proxies older than 1.3 only support the deprecated value and regex fields. A parameter without
+		// value matches its presence.
+		switch m := in.MatchType.(type) {
+		case *networking.StringMatch_Exact:
+			out.Value = m.Exact
+		case *networking.StringMatch_Prefix:
+			out.Value = regexp.QuoteMeta(m.Prefix) + ".*"
+			out.Regex = proto.BoolTrue
+		case *networking.StringMatch_Regex:
+			out.Value = m.Regex
+			out.Regex = proto.BoolTrue
+		}
+		return out
+	}
+
 	switch m := in.MatchType.(type) {
 	case *networking.StringMatch_Exact:
-		out.Value = m.Exact
+		out.QueryParameterMatchSpecifier = &route.QueryParameterMatcher_StringMatch{
+			StringMatch: &matcher.StringMatcher{MatchPattern: &matcher.StringMatcher_Exact{Exact: m.Exact}},
+		}
+	case *networking.StringMatch_Prefix:
+		out.QueryParameterMatchSpecifier = &route.QueryParameterMatcher_StringMatch{
+			StringMatch: &matcher.StringMatcher{MatchPattern: &matcher.StringMatcher_Prefix{Prefix: m.Prefix}},
+		}
 	case *networking.StringMatch_Regex:
-		out.Value = m.Regex
-		out.Regex = proto.BoolTrue
+		if safeRegex {
+			out.QueryParameterMatchSpecifier = &route.QueryParameterMatcher_StringMatch{
+				StringMatch: &matcher.StringMatcher{MatchPattern: &matcher.StringMatcher_SafeRegex{SafeRegex: regexMatcher(m.Regex)}},
+			}
+		} else {
+			out.QueryParameterMatchSpecifier = &route.QueryParameterMatcher_StringMatch{
+				StringMatch: &matcher.StringMatcher{MatchPattern: &matcher.StringMatcher_Regex{Regex: m.Regex}},
+			}
+		}
+	default:
+		out.QueryParameterMatchSpecifier = &route.QueryParameterMatcher_PresentMatch{PresentMatch: true}
 	}
 
 	return out
 }
 
-// translateHeaderMatch translates to HeaderMatcher
-func translateHeaderMatch(name string, in *networking.StringMatch) route.HeaderMatcher {
+// translateHeaderMatch translates to HeaderMatcher. An empty StringMatch matches the presence of the header.
+func translateHeaderMatch(name string, in *networking.StringMatch, safeRegex bool) route.HeaderMatcher {
 	out := route.HeaderMatcher{
 		Name: name,
 	}
@@ -652,16 +775,13 @@ func translateHeaderMatch(name string, in *networking.StringMatch) route.HeaderM
 		// Golang has a slightly different regex grammar
 		out.HeaderMatchSpecifier = &route.HeaderMatcher_PrefixMatch{PrefixMatch: m.Prefix}
 	case *networking.StringMatch_Regex:
-		if features.EnableUnsafeRegex.Get() {
-			out.HeaderMatchSpecifier = &route.HeaderMatcher_RegexMatch{RegexMatch: m.Regex}
+		if safeRegex {
+			out.HeaderMatchSpecifier = &route.HeaderMatcher_SafeRegexMatch{SafeRegexMatch: regexMatcher(m.Regex)}
 		} else {
-			out.HeaderMatchSpecifier = &route.HeaderMatcher_SafeRegexMatch{
-				SafeRegexMatch: &matcher.RegexMatcher{
-					EngineType: &matcher.RegexMatcher_GoogleRe2{GoogleRe2: &matcher.RegexMatcher_GoogleRE2{}},
-					Regex:      m.Regex,
-				},
-			}
+			out.HeaderMatchSpecifier = &route.HeaderMatcher_RegexMatch{RegexMatch: m.Regex}
 		}
+	default:
+		out.HeaderMatchSpecifier = &route.HeaderMatcher_PresentMatch{PresentMatch: true}
 	}
 
 	return out
@@ -732,7 +852,7 @@ func BuildDefaultHTTPInboundRoute(node *model.Proxy, clusterName string, operati
 	notimeout := ptypes.DurationProto(0 * time.Second)
 
 	val := &route.Route{
-		Match: translateRouteMatch(nil),
+		Match: translateRouteMatch(nil, node),
 		Decorator: &route.Decorator{
 			Operation: operation,
 		},
@@ -881,6 +1001,34 @@ func consistentHashToHashPolicy(consistentHash *networking.LoadBalancerSettings_
 	return nil
 }
 
+// destinationRuleOf returns the destination rule of the destination of a route, or nil if it has none.
+func destinationRuleOf(push *model.PushContext, node *model.Proxy, hostname host.Name, svc *model.Service) *model.Config {
+	if push == nil {
+		return nil
+	}
+	if svc == nil {
+		svc = &model.Service{Hostname: hostname}
+	}
+	return push.DestinationRule(node, svc)
+}
+
+// blueGreenSubset returns the active subset of the blue/green deployment of a host, or "" if there is none.
+func blueGreenSubset(push *model.PushContext, node *model.Proxy, hostname host.Name, svc *model.Service) string {
+	destinationRule := destinationRuleOf(push, node, hostname, svc)
+	if destinationRule == nil {
+		return ""
+	}
+	blueGreen, err := model.ParseBlueGreen(destinationRule)
+	if err != nil {
+		log.Debugf("ignoring the blue/green deployment of %s: %v", hostname, err)
+		return ""
+	}
+	if blueGreen == nil {
+		return ""
+	}
+	return blueGreen.Active
+}
+
 func getHashPolicyByService(node *model.Proxy, push *model.PushContext, svc *model.Service, port *model.Port) *route.RouteAction_HashPolicy {
 	if push == nil {
 		return nil
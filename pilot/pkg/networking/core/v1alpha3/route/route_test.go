@@ -28,6 +28,7 @@ import (
 
 	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/fakes"
 	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/route"
 	"istio.io/istio/pkg/config/host"
 	"istio.io/istio/pkg/config/mesh"
@@ -111,6 +112,87 @@ func TestBuildHTTPRoutes(t *testing.T) {
 		g.Expect(routes[0].GetMatch().GetHeaders()[0].GetRegexMatch()).To(gomega.Equal("Bearer .+?\\..+?\\..+?"))
 	})
 
+	t.Run("for virtual service with presence and query param matches", func(t *testing.T) {
+		g := gomega.NewGomegaWithT(t)
+
+		routes, err := route.BuildHTTPRoutesForVirtualService(node, nil, virtualServiceWithPresenceAndQueryParamMatching, serviceRegistry, 8080, gatewayNames)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(len(routes)).To(gomega.Equal(1))
+		match := routes[0].GetMatch()
+		g.Expect(match.GetHeaders()[0].GetName()).To(gomega.Equal("x-canary"))
+		g.Expect(match.GetHeaders()[0].GetPresentMatch()).To(gomega.BeTrue())
+		params := match.GetQueryParameters()
+		g.Expect(len(params)).To(gomega.Equal(3))
+		g.Expect(params[0].GetName()).To(gomega.Equal("debug"))
+		g.Expect(params[0].GetPresentMatch()).To(gomega.BeTrue())
+		g.Expect(params[1].GetName()).To(gomega.Equal("user"))
+		g.Expect(params[1].GetStringMatch().GetSafeRegex().GetRegex()).To(gomega.Equal("[a-z]+"))
+		g.Expect(params[2].GetName()).To(gomega.Equal("version"))
+		g.Expect(params[2].GetStringMatch().GetPrefix()).To(gomega.Equal("v2"))
+	})
+
+	t.Run("for virtual service with regex matches on legacy proxies", func(t *testing.T) {
+		g := gomega.NewGomegaWithT(t)
+
+		legacy := *node
+		legacy.IstioVersion = &model.IstioVersion{Major: 1, Minor: 2}
+		routes, err := route.BuildHTTPRoutesForVirtualService(&legacy, nil, virtualServiceWithPresenceAndQueryParamMatching, serviceRegistry, 8080, gatewayNames)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(len(routes)).To(gomega.Equal(1))
+		params := routes[0].GetMatch().GetQueryParameters()
+		g.Expect(params[0].GetValue()).To(gomega.Equal(""))
+		g.Expect(params[1].GetValue()).To(gomega.Equal("[a-z]+"))
+		g.Expect(params[1].GetRegex().GetValue()).To(gomega.BeTrue())
+		g.Expect(params[2].GetValue()).To(gomega.Equal("v2.*"))
+
+		routes, err = route.BuildHTTPRoutesForVirtualService(&legacy, nil, virtualServiceWithRegexMatchingOnHeader, serviceRegistry, 8080, gatewayNames)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(routes[0].GetMatch().GetHeaders()[0].GetRegexMatch()).To(gomega.Equal("Bearer .+?\\..+?\\..+?"))
+	})
+
+	t.Run("for weighted virtual service with hashed header", func(t *testing.T) {
+		os.Setenv(features.WeightedRoutingHashHeader.Name, "x-user")
+		defer os.Unsetenv(features.WeightedRoutingHashHeader.Name)
+		g := gomega.NewGomegaWithT(t)
+
+		vs := model.Config{
+			ConfigMeta: model.ConfigMeta{
+				Type:    schemas.VirtualService.Type,
+				Version: schemas.VirtualService.Version,
+				Name:    "acme",
+			},
+			Spec: &networking.VirtualService{
+				Hosts: []string{"*.example.org"},
+				Http: []*networking.HTTPRoute{{
+					Route: []*networking.HTTPRouteDestination{
+						{Destination: &networking.Destination{Host: "*.example.org", Subset: "v1"}, Weight: 75},
+						{Destination: &networking.Destination{Host: "*.example.org", Subset: "v2"}, Weight: 25},
+					},
+				}},
+			},
+		}
+		routes, err := route.BuildHTTPRoutesForVirtualService(node, nil, vs, serviceRegistry, 8080, gatewayNames)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(len(routes)).To(gomega.Equal(3))
+
+		for i, want := range []struct {
+			cluster    string
+			start, end int64
+		}{
+			{"outbound|8080|v1|*.example.org", 0, 75},
+			{"outbound|8080|v2|*.example.org", 75, 100},
+		} {
+			g.Expect(routes[i].GetRoute().GetCluster()).To(gomega.Equal(want.cluster))
+			headers := routes[i].GetMatch().GetHeaders()
+			g.Expect(headers[len(headers)-1].GetName()).To(gomega.Equal(route.WeightBucketHeader))
+			g.Expect(headers[len(headers)-1].GetRangeMatch().GetStart()).To(gomega.Equal(want.start))
+			g.Expect(headers[len(headers)-1].GetRangeMatch().GetEnd()).To(gomega.Equal(want.end))
+		}
+		g.Expect(len(routes[2].GetRoute().GetWeightedClusters().GetClusters())).To(gomega.Equal(2))
+		g.Expect(routes[2].GetRequestHeadersToRemove()).To(gomega.ContainElement(route.WeightBucketHeader))
+		g.Expect(route.WeightBucketFilter(false)).NotTo(gomega.BeNil())
+	})
+
 	t.Run("for virtual service with ring hash", func(t *testing.T) {
 		g := gomega.NewGomegaWithT(t)
 
@@ -566,6 +648,39 @@ var virtualServiceWithRegexMatchingOnHeader = model.Config{
 	},
 }
 
+var virtualServiceWithPresenceAndQueryParamMatching = model.Config{
+	ConfigMeta: model.ConfigMeta{
+		Type:    schemas.VirtualService.Type,
+		Version: schemas.VirtualService.Version,
+		Name:    "acme",
+	},
+	Spec: &networking.VirtualService{
+		Hosts:    []string{},
+		Gateways: []string{"some-gateway"},
+		Http: []*networking.HTTPRoute{
+			{
+				Match: []*networking.HTTPMatchRequest{
+					{
+						Headers: map[string]*networking.StringMatch{
+							"x-canary": {},
+						},
+						QueryParams: map[string]*networking.StringMatch{
+							"version": {MatchType: &networking.StringMatch_Prefix{Prefix: "v2"}},
+							"user":    {MatchType: &networking.StringMatch_Regex{Regex: "[a-z]+"}},
+							"debug":   {},
+						},
+					},
+				},
+				Redirect: &networking.HTTPRedirect{
+					Uri:          "example.org",
+					Authority:    "some-authority.default.svc.cluster.local",
+					RedirectCode: 308,
+				},
+			},
+		},
+	},
+}
+
 var portLevelDestinationRule = &networking.DestinationRule{
 	Host:    "*.example.org",
 	Subsets: []*networking.Subset{},
@@ -662,6 +777,120 @@ var networkingSubsetWithPortLevelSettings = &networking.Subset{
 	},
 }
 
+func TestBuildSidecarVirtualHostsScaledToZero(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	svc := &model.Service{
+		Hostname:    "scaled.default.svc.cluster.local",
+		Address:     "10.0.0.1",
+		ClusterVIPs: make(map[string]string),
+		Ports: model.PortList{
+			&model.Port{Name: "http", Port: 8080, Protocol: protocol.HTTP},
+		},
+		Attributes: model.ServiceAttributes{
+			Namespace: "default",
+			Activator: "activator.knative-serving.svc.cluster.local:80",
+		},
+	}
+	serviceRegistry := map[host.Name]*model.Service{svc.Hostname: svc}
+	node := &model.Proxy{
+		Type:         model.SidecarProxy,
+		IPAddresses:  []string{"1.1.1.1"},
+		ID:           "someID",
+		DNSDomain:    "default.svc.cluster.local",
+		Metadata:     &model.NodeMetadata{IstioVersion: "1.3.0"},
+		IstioVersion: &model.IstioVersion{Major: 1, Minor: 3},
+	}
+
+	serviceDiscovery := &fakes.ServiceDiscovery{}
+	serviceDiscovery.ServicesReturns([]*model.Service{svc}, nil)
+	meshConfig := mesh.DefaultMeshConfig()
+	env := &model.Environment{
+		ServiceDiscovery: serviceDiscovery,
+		IstioConfigStore: &fakes.IstioConfigStore{},
+		Mesh:             &meshConfig,
+	}
+
+	// Without endpoints, the requests are sent to the activator.
+	push := model.NewPushContext()
+	g.Expect(push.InitContext(env, nil, nil)).To(gomega.Succeed())
+	vhosts := route.BuildSidecarVirtualHostsFromConfigAndRegistry(node, push, serviceRegistry, nil, 8080)
+	g.Expect(vhosts).To(gomega.HaveLen(1))
+	action := vhosts[0].Routes[0].GetRoute()
+	g.Expect(action.GetCluster()).To(gomega.Equal("outbound|80||activator.knative-serving.svc.cluster.local"))
+	g.Expect(action.GetRetryPolicy().GetRetryBackOff()).NotTo(gomega.BeNil())
+
+	// The requests are sent to the service once its endpoints return.
+	serviceDiscovery.InstancesByPortReturns([]*model.ServiceInstance{{Service: svc}}, nil)
+	push = model.NewPushContext()
+	g.Expect(push.InitContext(env, nil, nil)).To(gomega.Succeed())
+	vhosts = route.BuildSidecarVirtualHostsFromConfigAndRegistry(node, push, serviceRegistry, nil, 8080)
+	g.Expect(vhosts).To(gomega.HaveLen(1))
+	action = vhosts[0].Routes[0].GetRoute()
+	g.Expect(action.GetCluster()).To(gomega.Equal("outbound|8080||scaled.default.svc.cluster.local"))
+	g.Expect(action.GetRetryPolicy().GetRetryBackOff()).To(gomega.BeNil())
+}
+
+func TestBuildSidecarVirtualHostsPerPort(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	svc := &model.Service{
+		Hostname:    "multi.default.svc.cluster.local",
+		Address:     "10.0.0.2",
+		ClusterVIPs: make(map[string]string),
+		Ports: model.PortList{
+			&model.Port{Name: "http-api", Port: 8080, Protocol: protocol.HTTP},
+			&model.Port{Name: "http-admin", Port: 9090, Protocol: protocol.HTTP},
+		},
+		Attributes: model.ServiceAttributes{Namespace: "default"},
+	}
+	serviceRegistry := map[host.Name]*model.Service{svc.Hostname: svc}
+	node := &model.Proxy{
+		Type:         model.SidecarProxy,
+		IPAddresses:  []string{"1.1.1.1"},
+		ID:           "someID",
+		DNSDomain:    "default.svc.cluster.local",
+		Metadata:     &model.NodeMetadata{IstioVersion: "1.3.0"},
+		IstioVersion: &model.IstioVersion{Major: 1, Minor: 3},
+	}
+	virtualService := model.Config{
+		ConfigMeta: model.ConfigMeta{Type: schemas.VirtualService.Type, Version: schemas.VirtualService.Version,
+			Name: "multi", Namespace: "default"},
+		Spec: &networking.VirtualService{
+			Hosts: []string{"multi.default.svc.cluster.local"},
+			Http: []*networking.HTTPRoute{{
+				Match: []*networking.HTTPMatchRequest{{Port: 8080}},
+				Route: []*networking.HTTPRouteDestination{{
+					Destination: &networking.Destination{Host: "multi.default.svc.cluster.local", Subset: "v2",
+						Port: &networking.PortSelector{Number: 8080}},
+				}},
+			}},
+		},
+	}
+
+	meshConfig := mesh.DefaultMeshConfig()
+	env := &model.Environment{
+		ServiceDiscovery: &fakes.ServiceDiscovery{},
+		IstioConfigStore: &fakes.IstioConfigStore{},
+		Mesh:             &meshConfig,
+	}
+	push := model.NewPushContext()
+	g.Expect(push.InitContext(env, nil, nil)).To(gomega.Succeed())
+
+	// Listening on all the ports, the rule matching 8080 applies to 8080 only, and 9090 gets the default route.
+	vhosts := route.BuildSidecarVirtualHostsFromConfigAndRegistry(node, push, serviceRegistry,
+		[]model.Config{virtualService}, 0)
+	clusters := make(map[int]string)
+	for _, vhost := range vhosts {
+		g.Expect(vhost.Routes).To(gomega.HaveLen(1))
+		clusters[vhost.Port] = vhost.Routes[0].GetRoute().GetCluster()
+	}
+	g.Expect(clusters).To(gomega.Equal(map[int]string{
+		8080: "outbound|8080|v2|multi.default.svc.cluster.local",
+		9090: "outbound|9090||multi.default.svc.cluster.local",
+	}))
+}
+
 func TestCombineVHostRoutes(t *testing.T) {
 	first := []*envoyroute.Route{
 		{Match: &envoyroute.RouteMatch{PathSpecifier: &envoyroute.RouteMatch_Path{Path: "/path1"}}},
@@ -718,3 +947,17 @@ func TestCombineVHostRoutes(t *testing.T) {
 		}
 	}
 }
+
+func TestMetadataHeadersFilter(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	g.Expect(route.MetadataHeadersFilter(nil, false)).To(gomega.BeNil())
+
+	filter := route.MetadataHeadersFilter([]model.MetadataHeader{
+		{Header: "x-tenant", Filter: "istio_authn", Path: []string{"request.auth.claims", "tenant"}},
+	}, false)
+	g.Expect(filter).NotTo(gomega.BeNil())
+	code := filter.GetConfig().GetFields()["inline_code"].GetStringValue()
+	g.Expect(code).To(gomega.ContainSubstring(`headers:remove("x-tenant")`))
+	g.Expect(code).To(gomega.ContainSubstring(`lookup(metadata:get("istio_authn"), {"request.auth.claims", "tenant"})`))
+}
@@ -0,0 +1,133 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"fmt"
+	"strings"
+
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	lua "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/lua/v2"
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	xdstype "github.com/envoyproxy/go-control-plane/envoy/type"
+	xdsutil "github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/proto"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/networking/util"
+)
+
+const (
+	// WeightBucketHeader is the request header holding the bucket, in [0, 100), of the hash of the header
+	// configured with PILOT_WEIGHTED_ROUTING_HASH_HEADER. The weighted routes send the requests of each
+	// bucket to the same destination.
+	WeightBucketHeader = "x-istio-weight-bucket"
+
+	weightBuckets = 100
+)
+
+// weightBucketLuaTemplate sets the bucket header from a hash of the configured header. The bucket header is
+// removed first, so it cannot be spoofed by the downstream.
+const weightBucketLuaTemplate = `function envoy_on_request(handle)
+  local headers = handle:headers()
+  headers:remove(%[1]q)
+  local value = headers:get(%[2]q)
+  if value == nil then
+    return
+  end
+  local hash = 0
+  for i = 1, #value do
+    hash = (hash * 31 + value:byte(i)) %% 1000000007
+  end
+  headers:add(%[1]q, tostring(hash %% %[3]d))
+end
+`
+
+// weightBucketHashHeader returns the header hashed into the weight buckets, or an empty string if the
+// weighted routes are random.
+func weightBucketHashHeader() string {
+	return strings.ToLower(strings.TrimSpace(features.WeightedRoutingHashHeader.Get()))
+}
+
+// WeightBucketFilter returns the HTTP filter setting the weight bucket header of the requests, or nil if
+// PILOT_WEIGHTED_ROUTING_HASH_HEADER is not set. The filter must run before any filter selecting the route.
+func WeightBucketFilter(isXDSMarshalingToAnyEnabled bool) *http_conn.HttpFilter {
+	header := weightBucketHashHeader()
+	if header == "" {
+		return nil
+	}
+	filterConfigProto := &lua.Lua{
+		InlineCode: fmt.Sprintf(weightBucketLuaTemplate, WeightBucketHeader, header, weightBuckets),
+	}
+	out := &http_conn.HttpFilter{
+		Name: xdsutil.Lua,
+	}
+	if isXDSMarshalingToAnyEnabled {
+		out.ConfigType = &http_conn.HttpFilter_TypedConfig{TypedConfig: util.MessageToAny(filterConfigProto)}
+	} else {
+		out.ConfigType = &http_conn.HttpFilter_Config{Config: util.MessageToStruct(filterConfigProto)}
+	}
+	return out
+}
+
+// weightBucketRoutes returns, for a route splitting the traffic across weighted clusters, one route per
+// cluster matching the buckets of the cluster, in proportion to its weight. The requests without the bucket
+// header still match the weighted route, which must follow these routes. Returns nil if the weighted routes
+// are random.
+func weightBucketRoutes(in *route.Route) []*route.Route {
+	if weightBucketHashHeader() == "" {
+		return nil
+	}
+	weighted := in.GetRoute().GetWeightedClusters()
+	if weighted == nil {
+		return nil
+	}
+	var total uint32
+	for _, cluster := range weighted.Clusters {
+		total += cluster.Weight.GetValue()
+	}
+	if total == 0 {
+		return nil
+	}
+
+	// The bucket header is not forwarded upstream, where it could match the routes of other proxies.
+	in.RequestHeadersToRemove = append(in.RequestHeadersToRemove, WeightBucketHeader)
+
+	out := make([]*route.Route, 0, len(weighted.Clusters))
+	var cumulative uint32
+	for _, cluster := range weighted.Clusters {
+		start := int64(cumulative * weightBuckets / total)
+		cumulative += cluster.Weight.GetValue()
+		end := int64(cumulative * weightBuckets / total)
+		if start == end {
+			continue
+		}
+
+		r := proto.Clone(in).(*route.Route)
+		r.Match.Headers = append(r.Match.Headers, &route.HeaderMatcher{
+			Name: WeightBucketHeader,
+			HeaderMatchSpecifier: &route.HeaderMatcher_RangeMatch{
+				RangeMatch: &xdstype.Int64Range{Start: start, End: end},
+			},
+		})
+		r.GetRoute().ClusterSpecifier = &route.RouteAction_Cluster{Cluster: cluster.Name}
+		r.RequestHeadersToAdd = append(r.RequestHeadersToAdd, cluster.RequestHeadersToAdd...)
+		r.RequestHeadersToRemove = append(r.RequestHeadersToRemove, cluster.RequestHeadersToRemove...)
+		r.ResponseHeadersToAdd = append(r.ResponseHeadersToAdd, cluster.ResponseHeadersToAdd...)
+		r.ResponseHeadersToRemove = append(r.ResponseHeadersToRemove, cluster.ResponseHeadersToRemove...)
+		out = append(out, r)
+	}
+	return out
+}
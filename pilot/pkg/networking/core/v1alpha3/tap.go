@@ -0,0 +1,190 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	tap_common "github.com/envoyproxy/go-control-plane/envoy/config/common/tap/v2alpha"
+	tap "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/tap/v2alpha"
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	tap_service "github.com/envoyproxy/go-control-plane/envoy/service/tap/v2alpha"
+	envoy_type "github.com/envoyproxy/go-control-plane/envoy/type"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+)
+
+const (
+	// envoyHTTPTap is the name of the Envoy tap HTTP filter.
+	envoyHTTPTap = "envoy.filters.http.tap"
+
+	// tapEnabledRuntimeKey overrides the percentage of the matching requests tapped, e.g. to stop the capture
+	// through the admin interface of the proxy.
+	tapEnabledRuntimeKey = "istio.tap_enabled"
+
+	tapFileSinkPrefix = "file:"
+
+	// defaultTapPercent is the percentage of the matching requests tapped when it is not set, bounding the
+	// number of files written by the proxy.
+	defaultTapPercent = 1
+
+	// maxTapBufferedBytes bounds the body bytes captured per request and per response.
+	maxTapBufferedBytes = 64 * 1024
+)
+
+// userVolumeMount is the mount setting of a volume of the sidecar.istio.io/userVolumeMount annotation.
+type userVolumeMount struct {
+	MountPath string `json:"mountPath"`
+	ReadOnly  bool   `json:"readOnly"`
+}
+
+// inboundTapFilter returns the tap filter capturing the requests and responses of the inbound HTTP ports, as set
+// by the sidecar.istio.io/tap* annotations of the workload, or nil if the capture is disabled or its settings are
+// invalid.
+func inboundTapFilter(node *model.Proxy) *http_conn.HttpFilter {
+	if node == nil || node.Metadata == nil || node.Metadata.TapSink == "" {
+		return nil
+	}
+	config, err := buildTapConfig(node.Metadata)
+	if err != nil {
+		log.Warnf("ignoring the tap of %s: %v", node.ID, err)
+		return nil
+	}
+
+	filterConfigProto := &tap.Tap{
+		CommonConfig: &tap_common.CommonExtensionConfig{
+			ConfigType: &tap_common.CommonExtensionConfig_StaticConfig{StaticConfig: config},
+		},
+	}
+	out := &http_conn.HttpFilter{Name: envoyHTTPTap}
+	if util.IsXDSMarshalingToAnyEnabled(node) {
+		out.ConfigType = &http_conn.HttpFilter_TypedConfig{TypedConfig: util.MessageToAny(filterConfigProto)}
+	} else {
+		out.ConfigType = &http_conn.HttpFilter_Config{Config: util.MessageToStruct(filterConfigProto)}
+	}
+	return out
+}
+
+func buildTapConfig(meta *model.NodeMetadata) (*tap_service.TapConfig, error) {
+	if !strings.HasPrefix(meta.TapSink, tapFileSinkPrefix) || len(meta.TapSink) == len(tapFileSinkPrefix) {
+		return nil, fmt.Errorf("invalid sidecar.istio.io/tapSink %q: must be file:<path prefix>", meta.TapSink)
+	}
+	pathPrefix := strings.TrimPrefix(meta.TapSink, tapFileSinkPrefix)
+	if err := validateTapPathPrefix(pathPrefix, meta.UserVolumeMount); err != nil {
+		return nil, err
+	}
+	output := &tap_service.OutputConfig{Sinks: []*tap_service.OutputSink{{
+		Format: tap_service.OutputSink_JSON_BODY_AS_STRING,
+		OutputSinkType: &tap_service.OutputSink_FilePerTap{
+			FilePerTap: &tap_service.FilePerTapSink{PathPrefix: pathPrefix},
+		},
+	}}}
+
+	if meta.TapMaxBufferedBytes != "" {
+		maxBytes, err := strconv.ParseUint(meta.TapMaxBufferedBytes, 10, 32)
+		if err != nil || maxBytes > maxTapBufferedBytes {
+			return nil, fmt.Errorf("invalid sidecar.istio.io/tapMaxBufferedBytes %q: must be an integer up to %d",
+				meta.TapMaxBufferedBytes, maxTapBufferedBytes)
+		}
+		output.MaxBufferedRxBytes = &wrappers.UInt32Value{Value: uint32(maxBytes)}
+		output.MaxBufferedTxBytes = &wrappers.UInt32Value{Value: uint32(maxBytes)}
+	}
+
+	match, err := tapMatchPredicate(meta.TapMatch)
+	if err != nil {
+		return nil, err
+	}
+	config := &tap_service.TapConfig{MatchConfig: match, OutputConfig: output}
+
+	percent := uint64(defaultTapPercent)
+	if meta.TapPercent != "" {
+		percent, err = strconv.ParseUint(meta.TapPercent, 10, 32)
+		if err != nil || percent > 100 {
+			return nil, fmt.Errorf("invalid sidecar.istio.io/tapPercent %q: must be an integer between 0 and 100", meta.TapPercent)
+		}
+	}
+	config.TapEnabled = &core.RuntimeFractionalPercent{
+		DefaultValue: &envoy_type.FractionalPercent{
+			Numerator:   uint32(percent),
+			Denominator: envoy_type.FractionalPercent_HUNDRED,
+		},
+		RuntimeKey: tapEnabledRuntimeKey,
+	}
+	return config, nil
+}
+
+// validateTapPathPrefix checks that the tap files are written under a writable volume of the
+// sidecar.istio.io/userVolumeMount annotation, so that they do not fill the container filesystem.
+func validateTapPathPrefix(pathPrefix string, volumeMounts string) error {
+	if !path.IsAbs(pathPrefix) || path.Clean(pathPrefix) != pathPrefix {
+		return fmt.Errorf("invalid sidecar.istio.io/tapSink path prefix %q: must be a clean absolute path", pathPrefix)
+	}
+	mounts := map[string]userVolumeMount{}
+	if volumeMounts != "" {
+		if err := json.Unmarshal([]byte(volumeMounts), &mounts); err != nil {
+			return fmt.Errorf("invalid sidecar.istio.io/userVolumeMount: %v", err)
+		}
+	}
+	for _, mount := range mounts {
+		mountPath := path.Clean(mount.MountPath)
+		if !mount.ReadOnly && mountPath != "/" && strings.HasPrefix(pathPrefix, mountPath+"/") {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid sidecar.istio.io/tapSink path prefix %q: must be under a writable volume of "+
+		"sidecar.istio.io/userVolumeMount", pathPrefix)
+}
+
+// tapMatchPredicate returns the predicate of the tapped requests, matching all the headers of a comma separated
+// list of name=value, or name=prefix* for a prefix match, e.g. ":path=/api/*,x-debug=true" to tap the requests
+// of the /api routes with the x-debug header. It matches any request if the list is empty.
+func tapMatchPredicate(value string) (*tap_service.MatchPredicate, error) {
+	var headers []*route.HeaderMatcher
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid sidecar.istio.io/tapMatch %q: %q is not name=value", value, item)
+		}
+		matcher := &route.HeaderMatcher{Name: strings.ToLower(parts[0])}
+		if strings.HasSuffix(parts[1], "*") {
+			matcher.HeaderMatchSpecifier = &route.HeaderMatcher_PrefixMatch{PrefixMatch: strings.TrimSuffix(parts[1], "*")}
+		} else {
+			matcher.HeaderMatchSpecifier = &route.HeaderMatcher_ExactMatch{ExactMatch: parts[1]}
+		}
+		headers = append(headers, matcher)
+	}
+	if len(headers) == 0 {
+		return &tap_service.MatchPredicate{Rule: &tap_service.MatchPredicate_AnyMatch{AnyMatch: true}}, nil
+	}
+	return &tap_service.MatchPredicate{
+		Rule: &tap_service.MatchPredicate_HttpRequestHeadersMatch{
+			HttpRequestHeadersMatch: &tap_service.HttpHeadersMatch{Headers: headers},
+		},
+	}, nil
+}
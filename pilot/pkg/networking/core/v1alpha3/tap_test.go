@@ -0,0 +1,162 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"reflect"
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	tap_service "github.com/envoyproxy/go-control-plane/envoy/service/tap/v2alpha"
+	envoy_type "github.com/envoyproxy/go-control-plane/envoy/type"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestBuildTapConfig(t *testing.T) {
+	fileSink := &tap_service.OutputSink{
+		Format: tap_service.OutputSink_JSON_BODY_AS_STRING,
+		OutputSinkType: &tap_service.OutputSink_FilePerTap{
+			FilePerTap: &tap_service.FilePerTapSink{PathPrefix: "/var/log/tap/req"},
+		},
+	}
+	anyMatch := &tap_service.MatchPredicate{Rule: &tap_service.MatchPredicate_AnyMatch{AnyMatch: true}}
+	defaultPercent := &core.RuntimeFractionalPercent{
+		DefaultValue: &envoy_type.FractionalPercent{Numerator: defaultTapPercent, Denominator: envoy_type.FractionalPercent_HUNDRED},
+		RuntimeKey:   tapEnabledRuntimeKey,
+	}
+	volumes := `{"tap":{"mountPath":"/var/log/tap"},"config":{"mountPath":"/etc/config","readOnly":true}}`
+
+	tests := []struct {
+		name      string
+		metadata  *model.NodeMetadata
+		expected  *tap_service.TapConfig
+		expectErr bool
+	}{
+		{
+			name:     "file sink",
+			metadata: &model.NodeMetadata{TapSink: "file:/var/log/tap/req", UserVolumeMount: volumes},
+			expected: &tap_service.TapConfig{
+				MatchConfig:  anyMatch,
+				OutputConfig: &tap_service.OutputConfig{Sinks: []*tap_service.OutputSink{fileSink}},
+				TapEnabled:   defaultPercent,
+			},
+		},
+		{
+			name: "bounded and matched",
+			metadata: &model.NodeMetadata{
+				TapSink:             "file:/var/log/tap/req",
+				UserVolumeMount:     volumes,
+				TapMatch:            ":path=/api/*, X-Debug=true",
+				TapPercent:          "10",
+				TapMaxBufferedBytes: "4096",
+			},
+			expected: &tap_service.TapConfig{
+				MatchConfig: &tap_service.MatchPredicate{
+					Rule: &tap_service.MatchPredicate_HttpRequestHeadersMatch{
+						HttpRequestHeadersMatch: &tap_service.HttpHeadersMatch{
+							Headers: []*route.HeaderMatcher{
+								{Name: ":path", HeaderMatchSpecifier: &route.HeaderMatcher_PrefixMatch{PrefixMatch: "/api/"}},
+								{Name: "x-debug", HeaderMatchSpecifier: &route.HeaderMatcher_ExactMatch{ExactMatch: "true"}},
+							},
+						},
+					},
+				},
+				OutputConfig: &tap_service.OutputConfig{
+					Sinks:              []*tap_service.OutputSink{fileSink},
+					MaxBufferedRxBytes: &wrappers.UInt32Value{Value: 4096},
+					MaxBufferedTxBytes: &wrappers.UInt32Value{Value: 4096},
+				},
+				TapEnabled: &core.RuntimeFractionalPercent{
+					DefaultValue: &envoy_type.FractionalPercent{Numerator: 10, Denominator: envoy_type.FractionalPercent_HUNDRED},
+					RuntimeKey:   tapEnabledRuntimeKey,
+				},
+			},
+		},
+		{
+			name:      "invalid sink",
+			metadata:  &model.NodeMetadata{TapSink: "tcp:collector:9000"},
+			expectErr: true,
+		},
+		{
+			name:      "grpc sink",
+			metadata:  &model.NodeMetadata{TapSink: "grpc:tap-collector"},
+			expectErr: true,
+		},
+		{
+			name:      "path without volume",
+			metadata:  &model.NodeMetadata{TapSink: "file:/tmp/tap"},
+			expectErr: true,
+		},
+		{
+			name:      "path on a read only volume",
+			metadata:  &model.NodeMetadata{TapSink: "file:/etc/config/tap", UserVolumeMount: volumes},
+			expectErr: true,
+		},
+		{
+			name:      "path escaping the volume",
+			metadata:  &model.NodeMetadata{TapSink: "file:/var/log/tap/../../../tmp/tap", UserVolumeMount: volumes},
+			expectErr: true,
+		},
+		{
+			name:      "invalid match",
+			metadata:  &model.NodeMetadata{TapSink: "file:/var/log/tap/req", UserVolumeMount: volumes, TapMatch: "x-debug"},
+			expectErr: true,
+		},
+		{
+			name:      "invalid percent",
+			metadata:  &model.NodeMetadata{TapSink: "file:/var/log/tap/req", UserVolumeMount: volumes, TapPercent: "150"},
+			expectErr: true,
+		},
+		{
+			name: "too many buffered bytes",
+			metadata: &model.NodeMetadata{
+				TapSink:             "file:/var/log/tap/req",
+				UserVolumeMount:     volumes,
+				TapMaxBufferedBytes: "1048576",
+			},
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildTapConfig(tt.metadata)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("buildTapConfig() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("buildTapConfig() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestInboundTapFilter(t *testing.T) {
+	if f := inboundTapFilter(&model.Proxy{Metadata: &model.NodeMetadata{}}); f != nil {
+		t.Errorf("expected no tap filter without sink, got %v", f)
+	}
+	if f := inboundTapFilter(&model.Proxy{Metadata: &model.NodeMetadata{TapSink: "invalid"}}); f != nil {
+		t.Errorf("expected no tap filter for an invalid sink, got %v", f)
+	}
+	f := inboundTapFilter(&model.Proxy{Metadata: &model.NodeMetadata{
+		TapSink:         "file:/var/log/tap/req",
+		UserVolumeMount: `{"tap":{"mountPath":"/var/log/tap"}}`,
+	}})
+	if f == nil || f.Name != envoyHTTPTap || f.ConfigType == nil {
+		t.Errorf("expected the tap filter, got %v", f)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package generator generates the xDS configuration of a proxy from a static set of services, service
+// instances and Istio configs, the way Pilot does when the proxy connects. It is meant for tools such as
+// config linters, simulators or custom control planes, and does not need a running discovery server.
+package generator
+
+import (
+	"fmt"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	istio_networking "istio.io/istio/pilot/pkg/networking/core"
+	v2 "istio.io/istio/pilot/pkg/proxy/envoy/v2"
+	"istio.io/istio/pilot/pkg/serviceregistry/aggregate"
+	"istio.io/istio/pilot/pkg/serviceregistry/external"
+	"istio.io/istio/pkg/config/mesh"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+// Input is the state of the mesh the configuration is generated from.
+type Input struct {
+	// Mesh is the mesh config. Defaults to the default mesh config.
+	Mesh *meshconfig.MeshConfig
+	// MeshNetworks is the mesh networks config, optional.
+	MeshNetworks *meshconfig.MeshNetworks
+	// Services are the services of the registry, in addition to the ones of the ServiceEntries of the Configs.
+	Services []*model.Service
+	// Instances are the instances of the Services.
+	Instances []*model.ServiceInstance
+	// Configs are the Istio configs, such as VirtualServices, DestinationRules, Gateways or ServiceEntries.
+	Configs []model.Config
+	// Plugins are the names of the networking plugins to apply, as for the pilot-discovery --plugins flag.
+	Plugins []string
+}
+
+// Proxy describes the proxy to generate the configuration for, as it connects to Pilot.
+type Proxy struct {
+	// ID is the xDS node ID, for example sidecar~10.1.1.1~productpage-v1-8d69b.default~default.svc.cluster.local.
+	ID string
+	// Metadata is the node metadata, optional.
+	Metadata *model.NodeMetadata
+	// Locality is the locality of the node, used when the registry doesn't define the one of the proxy.
+	Locality *core.Locality
+}
+
+// Resources are the xDS resources generated for a proxy.
+type Resources struct {
+	Listeners []*xdsapi.Listener
+	Clusters  []*xdsapi.Cluster
+	Routes    []*xdsapi.RouteConfiguration
+	Endpoints []*xdsapi.ClusterLoadAssignment
+}
+
+// Generator generates the xDS configuration of proxies for a given Input.
+type Generator struct {
+	env       *model.Environment
+	configgen istio_networking.ConfigGenerator
+	endpoints *v2.EndpointGenerator
+}
+
+// New creates a generator for the input, validating its configs.
+func New(in Input) (*Generator, error) {
+	store := memory.Make(schemas.Istio)
+	for _, cfg := range in.Configs {
+		if _, err := store.Create(cfg); err != nil {
+			return nil, fmt.Errorf("invalid %s %s/%s: %v", cfg.Type, cfg.Namespace, cfg.Name, err)
+		}
+	}
+	configStore := model.MakeIstioStore(store)
+
+	serviceEntries := external.NewServiceDiscovery(nil, configStore)
+	registry := newStaticRegistry(in.Services, in.Instances)
+	services := aggregate.NewController()
+	services.AddRegistry(aggregate.Registry{Name: "Static", ServiceDiscovery: registry, Controller: registry})
+	services.AddRegistry(aggregate.Registry{Name: "ServiceEntries", ServiceDiscovery: serviceEntries, Controller: serviceEntries})
+
+	meshConfig := in.Mesh
+	if meshConfig == nil {
+		defaultMesh := mesh.DefaultMeshConfig()
+		meshConfig = &defaultMesh
+	}
+	env := &model.Environment{
+		ServiceDiscovery: services,
+		IstioConfigStore: configStore,
+		Mesh:             meshConfig,
+		MeshNetworks:     in.MeshNetworks,
+		PushContext:      model.NewPushContext(),
+	}
+	if err := env.PushContext.InitContext(env, nil, nil); err != nil {
+		return nil, err
+	}
+	endpoints, err := v2.NewEndpointGenerator(env)
+	if err != nil {
+		return nil, err
+	}
+	return &Generator{env: env, configgen: istio_networking.NewConfigGenerator(in.Plugins), endpoints: endpoints}, nil
+}
+
+// PushContext returns the push context computed from the input, holding the errors detected in the configs.
+func (g *Generator) PushContext() *model.PushContext {
+	return g.env.PushContext
+}
+
+// Generate returns the listeners, clusters, routes and endpoints of the proxy.
+func (g *Generator) Generate(p Proxy) (*Resources, error) {
+	meta := p.Metadata
+	if meta == nil {
+		meta = &model.NodeMetadata{}
+	}
+	proxy, err := model.ParseServiceNodeWithMetadata(p.ID, meta)
+	if err != nil {
+		return nil, err
+	}
+	push := g.env.PushContext
+	if err := v2.InitProxy(g.env, push, proxy, p.Locality); err != nil {
+		return nil, err
+	}
+
+	out := &Resources{
+		Listeners: g.configgen.BuildListeners(g.env, proxy, push),
+		Clusters:  g.configgen.BuildClusters(g.env, proxy, push),
+	}
+	out.Routes = g.configgen.BuildHTTPRoutes(g.env, proxy, push, v2.RouteNames(out.Listeners))
+	for _, c := range out.Clusters {
+		if c.GetType() == xdsapi.Cluster_EDS {
+			out.Endpoints = append(out.Endpoints, g.endpoints.LoadAssignment(proxy, c.Name))
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"testing"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+func TestGenerate(t *testing.T) {
+	port := &model.Port{Name: "http", Port: 9080, Protocol: protocol.HTTP}
+	reviews := &model.Service{
+		Hostname:   host.Name("reviews.default.svc.cluster.local"),
+		Address:    "10.0.0.10",
+		Ports:      model.PortList{port},
+		Resolution: model.ClientSideLB,
+		Attributes: model.ServiceAttributes{Name: "reviews", Namespace: "default"},
+	}
+	instance := func(ip, version string) *model.ServiceInstance {
+		return &model.ServiceInstance{
+			Service:  reviews,
+			Endpoint: model.NetworkEndpoint{Address: ip, Port: 9080, ServicePort: port},
+			Labels:   map[string]string{"app": "reviews", "version": version},
+		}
+	}
+	g, err := New(Input{
+		Services:  []*model.Service{reviews},
+		Instances: []*model.ServiceInstance{instance("10.1.0.1", "v1"), instance("10.1.0.2", "v2")},
+		Configs: []model.Config{{
+			ConfigMeta: model.ConfigMeta{
+				Type:      schemas.DestinationRule.Type,
+				Group:     schemas.DestinationRule.Group,
+				Version:   schemas.DestinationRule.Version,
+				Name:      "reviews",
+				Namespace: "default",
+			},
+			Spec: &networking.DestinationRule{
+				Host:    "reviews.default.svc.cluster.local",
+				Subsets: []*networking.Subset{{Name: "v1", Labels: map[string]string{"version": "v1"}}},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resources, err := g.Generate(Proxy{ID: "sidecar~10.1.0.3~productpage.default~default.svc.cluster.local"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources.Listeners) == 0 || len(resources.Routes) == 0 {
+		t.Errorf("got %d listeners and %d routes, want some", len(resources.Listeners), len(resources.Routes))
+	}
+	endpoints := map[string]int{}
+	for _, cla := range resources.Endpoints {
+		for _, locality := range cla.Endpoints {
+			endpoints[cla.ClusterName] += len(locality.LbEndpoints)
+		}
+	}
+	want := map[string]int{
+		"outbound|9080||reviews.default.svc.cluster.local":   2,
+		"outbound|9080|v1|reviews.default.svc.cluster.local": 1,
+	}
+	for name, count := range want {
+		if endpoints[name] != count {
+			t.Errorf("got %d endpoints for %s, want %d", endpoints[name], name, count)
+		}
+	}
+
+	// The proxy of an instance gets its inbound cluster.
+	resources, err = g.Generate(Proxy{ID: "sidecar~10.1.0.1~reviews-v1.default~default.svc.cluster.local"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, c := range resources.Clusters {
+		if c.Name == "inbound|9080|http|reviews.default.svc.cluster.local" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("inbound cluster not generated for the reviews proxy")
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	_, err := New(Input{Configs: []model.Config{{
+		ConfigMeta: model.ConfigMeta{Type: schemas.DestinationRule.Type, Name: "invalid", Namespace: "default"},
+		Spec:       &networking.DestinationRule{},
+	}}})
+	if err == nil {
+		t.Error("got no error for a destination rule without host")
+	}
+}
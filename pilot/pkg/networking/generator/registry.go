@@ -0,0 +1,138 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/labels"
+)
+
+// staticRegistry is a service registry serving a fixed set of services and instances.
+type staticRegistry struct {
+	services  []*model.Service
+	byHost    map[host.Name]*model.Service
+	instances []*model.ServiceInstance
+}
+
+var _ model.ServiceDiscovery = &staticRegistry{}
+var _ model.Controller = &staticRegistry{}
+
+func newStaticRegistry(services []*model.Service, instances []*model.ServiceInstance) *staticRegistry {
+	r := &staticRegistry{
+		services:  services,
+		byHost:    make(map[host.Name]*model.Service, len(services)),
+		instances: instances,
+	}
+	for _, svc := range services {
+		r.byHost[svc.Hostname] = svc
+	}
+	return r
+}
+
+// AppendServiceHandler implements model.Controller, the registry never changes.
+func (r *staticRegistry) AppendServiceHandler(func(*model.Service, model.Event)) error {
+	return nil
+}
+
+// AppendInstanceHandler implements model.Controller, the registry never changes.
+func (r *staticRegistry) AppendInstanceHandler(func(*model.ServiceInstance, model.Event)) error {
+	return nil
+}
+
+// Run implements model.Controller.
+func (r *staticRegistry) Run(<-chan struct{}) {}
+
+// Services implements model.ServiceDiscovery.
+func (r *staticRegistry) Services() ([]*model.Service, error) {
+	return r.services, nil
+}
+
+// GetService implements model.ServiceDiscovery.
+func (r *staticRegistry) GetService(hostname host.Name) (*model.Service, error) {
+	return r.byHost[hostname], nil
+}
+
+// InstancesByPort implements model.ServiceDiscovery.
+func (r *staticRegistry) InstancesByPort(svc *model.Service, servicePort int, labels labels.Collection) ([]*model.ServiceInstance, error) {
+	out := make([]*model.ServiceInstance, 0)
+	for _, instance := range r.instances {
+		if instance.Service.Hostname == svc.Hostname && instance.Endpoint.ServicePort.Port == servicePort &&
+			labels.HasSubsetOf(instance.Labels) {
+			out = append(out, instance)
+		}
+	}
+	return out, nil
+}
+
+// GetProxyServiceInstances implements model.ServiceDiscovery.
+func (r *staticRegistry) GetProxyServiceInstances(proxy *model.Proxy) ([]*model.ServiceInstance, error) {
+	out := make([]*model.ServiceInstance, 0)
+	for _, instance := range r.instances {
+		for _, ip := range proxy.IPAddresses {
+			if instance.Endpoint.Address == ip {
+				out = append(out, instance)
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// GetProxyWorkloadLabels implements model.ServiceDiscovery.
+func (r *staticRegistry) GetProxyWorkloadLabels(proxy *model.Proxy) (labels.Collection, error) {
+	instances, _ := r.GetProxyServiceInstances(proxy)
+	out := make(labels.Collection, 0, len(instances))
+	for _, instance := range instances {
+		out = append(out, instance.Labels)
+	}
+	return out, nil
+}
+
+// ManagementPorts implements model.ServiceDiscovery.
+func (r *staticRegistry) ManagementPorts(string) model.PortList {
+	return nil
+}
+
+// WorkloadHealthCheckInfo implements model.ServiceDiscovery.
+func (r *staticRegistry) WorkloadHealthCheckInfo(string) model.ProbeList {
+	return nil
+}
+
+// GetIstioServiceAccounts implements model.ServiceDiscovery.
+func (r *staticRegistry) GetIstioServiceAccounts(svc *model.Service, ports []int) []string {
+	seen := map[string]bool{}
+	out := make([]string, 0)
+	add := func(sa string) {
+		if sa != "" && !seen[sa] {
+			seen[sa] = true
+			out = append(out, sa)
+		}
+	}
+	for _, sa := range svc.ServiceAccounts {
+		add(sa)
+	}
+	for _, instance := range r.instances {
+		if instance.Service.Hostname != svc.Hostname {
+			continue
+		}
+		for _, port := range ports {
+			if instance.Endpoint.ServicePort.Port == port {
+				add(instance.ServiceAccount)
+			}
+		}
+	}
+	return out
+}
@@ -23,6 +23,7 @@ import (
 	"istio.io/istio/pilot/pkg/networking/plugin"
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pilot/pkg/security/authn/factory"
+	authn_model "istio.io/istio/pilot/pkg/security/model"
 )
 
 // Plugin implements Istio mTLS auth
@@ -35,8 +36,16 @@ func NewPlugin() plugin.Plugin {
 
 // OnInboundFilterChains setups filter chains based on the authentication policy.
 func (Plugin) OnInboundFilterChains(in *plugin.InputParams) []plugin.FilterChain {
-	return factory.NewPolicyApplier(in.Push,
+	chains := factory.NewPolicyApplier(in.Push,
 		in.ServiceInstance).InboundFilterChain(in.Env.Mesh.SdsUdsPath, in.Node.Metadata)
+	// The mesh root, mounted or fetched with SDS, is replaced by the mesh root merged with the roots of the trust
+	// bundles.
+	if in.Env.Mesh.SdsUdsPath != "" || in.Node.Metadata.TLSServerRootCert == "" {
+		for _, chain := range chains {
+			util.ApplyTrustBundleCA(in.Env, chain.TLSContext.GetCommonTlsContext())
+		}
+	}
+	return chains
 }
 
 // OnOutboundListener is called whenever a new outbound listener is added to the LDS output for a given service
@@ -50,6 +59,11 @@ func (Plugin) OnOutboundListener(in *plugin.InputParams, mutable *plugin.Mutable
 	return buildFilter(in, mutable)
 }
 
+// HTTPFilterPhase implements the plugin.PhasedPlugin interface method.
+func (Plugin) HTTPFilterPhase() plugin.FilterPhase {
+	return plugin.PhaseAuthn
+}
+
 // OnInboundListener is called whenever a new listener is added to the LDS output for a given service
 // Can be used to add additional filters (e.g., mixer filter) or add more stuff to the HTTP connection manager
 // on the inbound path
@@ -67,13 +81,20 @@ func buildFilter(in *plugin.InputParams, mutable *plugin.MutableObjects) error {
 	if mutable.Listener == nil || (len(mutable.Listener.FilterChains) != len(mutable.FilterChains)) {
 		return fmt.Errorf("expected same number of filter chains in listener (%d) and mutable (%d)", len(mutable.Listener.FilterChains), len(mutable.FilterChains))
 	}
+	var exemptPaths []string
+	if in.Node.Type == model.SidecarProxy {
+		exemptPaths = authn_model.ExemptPathPrefixes(in.Node.Metadata)
+	}
 	for i := range mutable.Listener.FilterChains {
 		if in.ListenerProtocol == plugin.ListenerProtocolHTTP || mutable.FilterChains[i].ListenerProtocol == plugin.ListenerProtocolHTTP {
 			// Adding Jwt filter and authn filter, if needed.
 			if filter := applier.JwtFilter(util.IsXDSMarshalingToAnyEnabled(in.Node)); filter != nil {
 				mutable.FilterChains[i].HTTP = append(mutable.FilterChains[i].HTTP, filter)
 			}
-			if filter := applier.AuthNFilter(in.Node.Type, util.IsXDSMarshalingToAnyEnabled(in.Node)); filter != nil {
+			if filter := applier.ClaimToHeaderFilter(util.IsXDSMarshalingToAnyEnabled(in.Node)); filter != nil {
+				mutable.FilterChains[i].HTTP = append(mutable.FilterChains[i].HTTP, filter)
+			}
+			if filter := applier.AuthNFilter(in.Node.Type, exemptPaths, util.IsXDSMarshalingToAnyEnabled(in.Node)); filter != nil {
 				mutable.FilterChains[i].HTTP = append(mutable.FilterChains[i].HTTP, filter)
 			}
 		}
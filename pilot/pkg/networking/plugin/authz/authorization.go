@@ -22,14 +22,24 @@
 package authz
 
 import (
+	"strings"
+
 	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	envoy_route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	http_config "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rbac/v2"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	structpb "github.com/golang/protobuf/ptypes/struct"
 
 	istiolog "istio.io/pkg/log"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/plugin"
 	"istio.io/istio/pilot/pkg/networking/util"
 	authz_builder "istio.io/istio/pilot/pkg/security/authz/builder"
+	authz_model "istio.io/istio/pilot/pkg/security/authz/model"
+	authn_model "istio.io/istio/pilot/pkg/security/model"
 	"istio.io/istio/pkg/spiffe"
 )
 
@@ -62,6 +72,11 @@ func (Plugin) OnInboundFilterChains(in *plugin.InputParams) []plugin.FilterChain
 	return nil
 }
 
+// HTTPFilterPhase implements the plugin.PhasedPlugin interface method.
+func (Plugin) HTTPFilterPhase() plugin.FilterPhase {
+	return plugin.PhaseAuthz
+}
+
 // OnInboundListener is called whenever a new listener is added to the LDS output for a given service
 // Can be used to add additional filters (e.g., mixer filter) or add more stuff to the HTTP connection manager
 // on the inbound path
@@ -85,6 +100,10 @@ func buildFilter(in *plugin.InputParams, mutable *plugin.MutableObjects) {
 	// https://github.com/istio/istio/issues/17873
 	builder := authz_builder.NewBuilder(spiffe.GetTrustDomain(), in.Env.Mesh.TrustDomainAliases, in.ServiceInstance,
 		in.Node.WorkloadLabels, in.Node.ConfigNamespace, in.Push.AuthzPolicies, util.IsXDSMarshalingToAnyEnabled(in.Node))
+	if builder == nil && in.Node.Type == model.SidecarProxy && isDenyByDefaultNamespace(in.Node.ConfigNamespace) {
+		rbacLog.Debugf("deny by default for workload %v in %s", in.Node.WorkloadLabels, in.Node.ConfigNamespace)
+		builder = authz_builder.NewDenyAllBuilder(util.IsXDSMarshalingToAnyEnabled(in.Node))
+	}
 	if builder == nil {
 		return
 	}
@@ -148,6 +167,18 @@ func buildFilter(in *plugin.InputParams, mutable *plugin.MutableObjects) {
 	}
 }
 
+// isDenyByDefaultNamespace returns true if the workloads of the namespace deny inbound traffic
+// when no authorization policy applies to them.
+func isDenyByDefaultNamespace(namespace string) bool {
+	for _, ns := range strings.Split(features.DenyByDefaultNamespaces.Get(), ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "*" || (ns != "" && ns == namespace) {
+			return true
+		}
+	}
+	return false
+}
+
 // OnVirtualListener implements the Plugin interface method.
 func (Plugin) OnVirtualListener(in *plugin.InputParams, mutable *plugin.MutableObjects) error {
 	return nil
@@ -161,8 +192,58 @@ func (Plugin) OnInboundCluster(in *plugin.InputParams, cluster *xdsapi.Cluster)
 func (Plugin) OnOutboundRouteConfiguration(in *plugin.InputParams, route *xdsapi.RouteConfiguration) {
 }
 
-// OnInboundRouteConfiguration implements the Plugin interface method.
+// OnInboundRouteConfiguration implements the Plugin interface method. The RBAC filter is disabled on
+// the path prefixes the workload exempts from authorization.
 func (Plugin) OnInboundRouteConfiguration(in *plugin.InputParams, route *xdsapi.RouteConfiguration) {
+	if in.Node == nil || in.Node.Type != model.SidecarProxy {
+		return
+	}
+	prefixes := authn_model.ExemptPathPrefixes(in.Node.Metadata)
+	if len(prefixes) == 0 {
+		return
+	}
+	for _, vhost := range route.VirtualHosts {
+		vhost.Routes = addExemptRoutes(vhost.Routes, prefixes, util.IsXDSMarshalingToAnyEnabled(in.Node))
+	}
+}
+
+// addExemptRoutes adds a route per exempted prefix in front of the catch-all route, forwarding the
+// requests like it with the RBAC filter disabled.
+func addExemptRoutes(routes []*envoy_route.Route, prefixes []string, isXDSMarshalingToAnyEnabled bool) []*envoy_route.Route {
+	var catchAll *envoy_route.Route
+	for _, r := range routes {
+		if r.GetMatch().GetPrefix() == "/" && len(r.GetMatch().GetHeaders()) == 0 && len(r.GetMatch().GetQueryParameters()) == 0 {
+			catchAll = r
+			break
+		}
+	}
+	if catchAll == nil {
+		return routes
+	}
+
+	// An RBACPerRoute without rules disables the filter for the route.
+	perRoute := &http_config.RBACPerRoute{}
+	exempt := make([]*envoy_route.Route, 0, len(prefixes)+len(routes))
+	for _, prefix := range prefixes {
+		r := proto.Clone(catchAll).(*envoy_route.Route)
+		r.Match = &envoy_route.RouteMatch{PathSpecifier: &envoy_route.RouteMatch_Prefix{Prefix: prefix}}
+		if r.Name != "" {
+			r.Name = "exempt" + prefix
+		}
+		if isXDSMarshalingToAnyEnabled {
+			if r.TypedPerFilterConfig == nil {
+				r.TypedPerFilterConfig = make(map[string]*any.Any)
+			}
+			r.TypedPerFilterConfig[authz_model.RBACHTTPFilterName] = util.MessageToAny(perRoute)
+		} else {
+			if r.PerFilterConfig == nil {
+				r.PerFilterConfig = make(map[string]*structpb.Struct)
+			}
+			r.PerFilterConfig[authz_model.RBACHTTPFilterName] = util.MessageToStruct(perRoute)
+		}
+		exempt = append(exempt, r)
+	}
+	return append(exempt, routes...)
 }
 
 // OnOutboundCluster implements the Plugin interface method.
@@ -95,6 +95,12 @@ func (Plugin) OnOutboundListener(in *plugin.InputParams, mutable *plugin.Mutable
 	return nil
 }
 
+// HTTPFilterPhase implements the plugin.PhasedPlugin interface method. Health checks bypass the
+// stats filters, after authorization.
+func (Plugin) HTTPFilterPhase() plugin.FilterPhase {
+	return plugin.PhaseAuthz
+}
+
 // OnInboundListener is called whenever a new listener is added to the LDS output for a given service
 // Can be used to add additional filters (e.g., mixer filter) or add more stuff to the HTTP connection manager
 // on the inbound path
@@ -0,0 +1,272 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mixer
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	http_rbac "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rbac/v2"
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	envoy_rbac "github.com/envoyproxy/go-control-plane/envoy/config/rbac/v2"
+	pstruct "github.com/golang/protobuf/ptypes/struct"
+
+	mccpb "istio.io/api/mixer/v1/config/client"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/plugin"
+	"istio.io/istio/pilot/pkg/networking/util"
+	authz_model "istio.io/istio/pilot/pkg/security/authz/model"
+)
+
+const (
+	// LocalRateLimitAnnotation is set on a QuotaSpec to give the limits used when the quotas it
+	// charges are enforced locally by Envoy rather than by Mixer. The value is a comma separated
+	// list of <quota>=<maxAmount>/<validDuration>, for example "requestcount=100/1s".
+	LocalRateLimitAnnotation = "policy.istio.io/localRateLimit"
+
+	// RequiredHeadersAnnotation is set on a QuotaSpec to give the comma separated names of the headers the requests
+	// must carry, such as the API key header the quota is charged to. The requests without them are denied by
+	// Envoy rather than by a Mixer check.
+	RequiredHeadersAnnotation = "policy.istio.io/requiredHeaders"
+
+	// localRateLimitFilter is the name of the Envoy local rate limit HTTP filter.
+	localRateLimitFilter = "envoy.filters.http.local_ratelimit"
+)
+
+// localRateLimit is the limit of a single quota, equivalent to a memquota handler without overrides.
+type localRateLimit struct {
+	maxAmount     int64
+	validDuration time.Duration
+}
+
+// parseLocalRateLimits parses the value of LocalRateLimitAnnotation.
+func parseLocalRateLimits(value string) (map[string]localRateLimit, error) {
+	out := make(map[string]localRateLimit)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid local rate limit %q: expected <quota>=<maxAmount>/<validDuration>", entry)
+		}
+		limit := strings.SplitN(parts[1], "/", 2)
+		if len(limit) != 2 {
+			return nil, fmt.Errorf("invalid local rate limit %q: expected <quota>=<maxAmount>/<validDuration>", entry)
+		}
+		maxAmount, err := strconv.ParseInt(limit[0], 10, 64)
+		if err != nil || maxAmount <= 0 {
+			return nil, fmt.Errorf("invalid max amount in local rate limit %q", entry)
+		}
+		validDuration, err := time.ParseDuration(limit[1])
+		if err != nil || validDuration <= 0 {
+			return nil, fmt.Errorf("invalid duration in local rate limit %q", entry)
+		}
+		out[parts[0]] = localRateLimit{maxAmount: maxAmount, validDuration: validDuration}
+	}
+	return out, nil
+}
+
+// addLocalQuotaFilters appends the header validation and local quota filters of the service instance to the HTTP
+// filter chains.
+func addLocalQuotaFilters(in *plugin.InputParams, mutable *plugin.MutableObjects) {
+	var filters []*http_conn.HttpFilter
+	if filter := buildRequiredHeadersFilter(in); filter != nil {
+		filters = append(filters, filter)
+	}
+	// The local rate limit filter is only known to the Envoy of the recent proxies.
+	if util.IsIstioVersionGE18(in.Node) {
+		filters = append(filters, buildLocalQuotaFilters(in)...)
+	}
+	if len(filters) == 0 {
+		return
+	}
+	for cnum := range mutable.FilterChains {
+		switch in.ListenerProtocol {
+		case plugin.ListenerProtocolHTTP:
+			mutable.FilterChains[cnum].HTTP = append(mutable.FilterChains[cnum].HTTP, filters...)
+		case plugin.ListenerProtocolAuto:
+			if mutable.FilterChains[cnum].ListenerProtocol == plugin.ListenerProtocolHTTP {
+				mutable.FilterChains[cnum].HTTP = append(mutable.FilterChains[cnum].HTTP, filters...)
+			}
+		}
+	}
+}
+
+// buildRequiredHeadersFilter returns an Envoy RBAC filter denying the requests without the headers required by the
+// quota specs bound to the service instance, or nil if they require none.
+func buildRequiredHeadersFilter(in *plugin.InputParams) *http_conn.HttpFilter {
+	if in.Env.IstioConfigStore == nil || in.ServiceInstance == nil {
+		return nil
+	}
+
+	required := make(map[string]bool)
+	for _, quotaSpec := range in.Env.IstioConfigStore.QuotaSpecByDestination(in.ServiceInstance) {
+		for _, header := range strings.Split(quotaSpec.Annotations[RequiredHeadersAnnotation], ",") {
+			if header = strings.ToLower(strings.TrimSpace(header)); header != "" {
+				required[header] = true
+			}
+		}
+	}
+	if len(required) == 0 {
+		return nil
+	}
+	headers := make([]string, 0, len(required))
+	for header := range required {
+		headers = append(headers, header)
+	}
+	sort.Strings(headers)
+
+	permissions := make([]*envoy_rbac.Permission, 0, len(headers))
+	for _, header := range headers {
+		permissions = append(permissions, &envoy_rbac.Permission{
+			Rule: &envoy_rbac.Permission_Header{Header: &route.HeaderMatcher{
+				Name:                 header,
+				HeaderMatchSpecifier: &route.HeaderMatcher_PresentMatch{PresentMatch: true},
+			}},
+		})
+	}
+	rbac := &http_rbac.RBAC{Rules: &envoy_rbac.RBAC{
+		Action: envoy_rbac.RBAC_ALLOW,
+		Policies: map[string]*envoy_rbac.Policy{
+			"required-headers": {
+				Permissions: []*envoy_rbac.Permission{{
+					Rule: &envoy_rbac.Permission_AndRules{AndRules: &envoy_rbac.Permission_Set{Rules: permissions}},
+				}},
+				Principals: []*envoy_rbac.Principal{{Identifier: &envoy_rbac.Principal_Any{Any: true}}},
+			},
+		},
+	}}
+
+	filter := &http_conn.HttpFilter{Name: authz_model.RBACHTTPFilterName}
+	if util.IsXDSMarshalingToAnyEnabled(in.Node) {
+		filter.ConfigType = &http_conn.HttpFilter_TypedConfig{TypedConfig: util.MessageToAny(rbac)}
+	} else {
+		filter.ConfigType = &http_conn.HttpFilter_Config{Config: util.MessageToStruct(rbac)}
+	}
+	return filter
+}
+
+// buildLocalQuotaFilters translates the quota specs bound to the service instance into Envoy local
+// rate limit filters. This is a best effort replacement for Mixer quota checks: only rules that apply
+// to every request are translated, since the local rate limit filter cannot select requests by
+// attributes. Quotas are enforced per proxy, not across all the replicas of the service.
+func buildLocalQuotaFilters(in *plugin.InputParams) []*http_conn.HttpFilter {
+	if in.Env.IstioConfigStore == nil || in.ServiceInstance == nil {
+		return nil
+	}
+
+	quotaSpecs := in.Env.IstioConfigStore.QuotaSpecByDestination(in.ServiceInstance)
+	model.SortQuotaSpec(quotaSpecs)
+
+	// The effective limit of a quota is the number of requests allowed per interval, given the
+	// charge of each request. When several rules charge the same quota, the most restrictive wins.
+	limits := make(map[string]localRateLimit)
+	for _, quotaSpec := range quotaSpecs {
+		spec, ok := quotaSpec.Spec.(*mccpb.QuotaSpec)
+		if !ok {
+			continue
+		}
+		value, f := quotaSpec.Annotations[LocalRateLimitAnnotation]
+		if !f {
+			continue
+		}
+		specLimits, err := parseLocalRateLimits(value)
+		if err != nil {
+			log.Warnf("Ignoring local rate limits of quota spec %s/%s: %v", quotaSpec.Namespace, quotaSpec.Name, err)
+			continue
+		}
+		for _, rule := range spec.Rules {
+			if len(rule.Match) > 0 {
+				log.Warnf("Ignoring conditional rule of quota spec %s/%s: local rate limits apply to all requests",
+					quotaSpec.Namespace, quotaSpec.Name)
+				continue
+			}
+			for _, quota := range rule.Quotas {
+				limit, f := specLimits[quota.Quota]
+				if !f {
+					continue
+				}
+				charge := quota.Charge
+				if charge <= 0 {
+					charge = 1
+				}
+				requests := limit.maxAmount / charge
+				if requests < 1 {
+					requests = 1
+				}
+				if existing, f := limits[quota.Quota]; f && existing.maxAmount <= requests {
+					continue
+				}
+				limits[quota.Quota] = localRateLimit{maxAmount: requests, validDuration: limit.validDuration}
+			}
+		}
+	}
+
+	quotas := make([]string, 0, len(limits))
+	for quota := range limits {
+		quotas = append(quotas, quota)
+	}
+	sort.Strings(quotas)
+
+	out := make([]*http_conn.HttpFilter, 0, len(quotas))
+	for _, quota := range quotas {
+		out = append(out, buildLocalRateLimitFilter(quota, limits[quota]))
+	}
+	return out
+}
+
+// buildLocalRateLimitFilter returns an Envoy local rate limit filter enforcing the limit of a quota.
+func buildLocalRateLimitFilter(quota string, limit localRateLimit) *http_conn.HttpFilter {
+	// Durations are encoded in their JSON form, as Envoy converts the struct to the typed config.
+	fillInterval := strconv.FormatFloat(limit.validDuration.Seconds(), 'f', -1, 64) + "s"
+	percent := &pstruct.Value{Kind: &pstruct.Value_StructValue{StructValue: &pstruct.Struct{
+		Fields: map[string]*pstruct.Value{
+			"default_value": {Kind: &pstruct.Value_StructValue{StructValue: &pstruct.Struct{
+				Fields: map[string]*pstruct.Value{
+					"numerator":   {Kind: &pstruct.Value_NumberValue{NumberValue: 100}},
+					"denominator": {Kind: &pstruct.Value_StringValue{StringValue: "HUNDRED"}},
+				},
+			}}},
+			"runtime_key": {Kind: &pstruct.Value_StringValue{StringValue: "local_quota." + quota}},
+		},
+	}}}
+
+	cfg := &pstruct.Struct{
+		Fields: map[string]*pstruct.Value{
+			"stat_prefix": {Kind: &pstruct.Value_StringValue{StringValue: "local_quota_" + quota}},
+			"token_bucket": {Kind: &pstruct.Value_StructValue{StructValue: &pstruct.Struct{
+				Fields: map[string]*pstruct.Value{
+					"max_tokens":      {Kind: &pstruct.Value_NumberValue{NumberValue: float64(limit.maxAmount)}},
+					"tokens_per_fill": {Kind: &pstruct.Value_NumberValue{NumberValue: float64(limit.maxAmount)}},
+					"fill_interval":   {Kind: &pstruct.Value_StringValue{StringValue: fillInterval}},
+				},
+			}}},
+			"filter_enabled":  percent,
+			"filter_enforced": percent,
+		},
+	}
+
+	return &http_conn.HttpFilter{
+		Name:       localRateLimitFilter,
+		ConfigType: &http_conn.HttpFilter_Config{Config: cfg},
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mixer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	http_rbac "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rbac/v2"
+	"github.com/golang/protobuf/ptypes"
+
+	mccpb "istio.io/api/mixer/v1/config/client"
+
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/plugin"
+	authz_model "istio.io/istio/pilot/pkg/security/authz/model"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+func TestParseLocalRateLimits(t *testing.T) {
+	limits, err := parseLocalRateLimits("requestcount=100/1s, other=10/1m")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := limits["requestcount"]; got.maxAmount != 100 || got.validDuration != time.Second {
+		t.Errorf("unexpected requestcount limit: %+v", got)
+	}
+	if got := limits["other"]; got.maxAmount != 10 || got.validDuration != time.Minute {
+		t.Errorf("unexpected other limit: %+v", got)
+	}
+
+	for _, invalid := range []string{"requestcount", "requestcount=100", "requestcount=0/1s", "requestcount=1/0s", "=1/1s"} {
+		if _, err := parseLocalRateLimits(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestBuildLocalQuotaFilters(t *testing.T) {
+	store := model.MakeIstioStore(memory.Make(schemas.Istio))
+	configs := []model.Config{
+		{
+			ConfigMeta: model.ConfigMeta{
+				Type:      schemas.QuotaSpecBinding.Type,
+				Version:   schemas.QuotaSpecBinding.Version,
+				Group:     schemas.QuotaSpecBinding.Group,
+				Name:      "binding",
+				Domain:    "cluster.local",
+				Namespace: "ns1",
+			},
+			Spec: &mccpb.QuotaSpecBinding{
+				Services:   []*mccpb.IstioService{{Name: "a", Namespace: "ns1"}},
+				QuotaSpecs: []*mccpb.QuotaSpecBinding_QuotaSpecReference{{Name: "request-count", Namespace: "ns1"}},
+			},
+		},
+		{
+			ConfigMeta: model.ConfigMeta{
+				Type:      schemas.QuotaSpec.Type,
+				Version:   schemas.QuotaSpec.Version,
+				Group:     schemas.QuotaSpec.Group,
+				Name:      "request-count",
+				Namespace: "ns1",
+				Annotations: map[string]string{
+					LocalRateLimitAnnotation:  "requestcount=100/1s",
+					RequiredHeadersAnnotation: "X-Api-Key, x-user",
+				},
+			},
+			Spec: &mccpb.QuotaSpec{
+				Rules: []*mccpb.QuotaRule{
+					{
+						Quotas: []*mccpb.Quota{{Quota: "requestcount", Charge: 10}},
+					},
+					{
+						Match: []*mccpb.AttributeMatch{{Clause: map[string]*mccpb.StringMatch{
+							"request.headers[x-user]": {MatchType: &mccpb.StringMatch_Exact{Exact: "guest"}},
+						}}},
+						Quotas: []*mccpb.Quota{{Quota: "requestcount", Charge: 100}},
+					},
+				},
+			},
+		},
+	}
+	for _, c := range configs {
+		if _, err := store.Create(c); err != nil {
+			t.Fatalf("failed to create %s: %v", c.Name, err)
+		}
+	}
+
+	in := &plugin.InputParams{
+		ListenerProtocol: plugin.ListenerProtocolHTTP,
+		Env:              &model.Environment{IstioConfigStore: store},
+		Node:             &model.Proxy{IstioVersion: &model.IstioVersion{Major: 1, Minor: 8}},
+		ServiceInstance: &model.ServiceInstance{
+			Service: &model.Service{Hostname: host.Name("a.ns1.svc.cluster.local")},
+		},
+	}
+	filters := buildLocalQuotaFilters(in)
+	if len(filters) != 1 {
+		t.Fatalf("expected 1 filter, got %d", len(filters))
+	}
+	if filters[0].Name != localRateLimitFilter {
+		t.Errorf("unexpected filter name %s", filters[0].Name)
+	}
+	bucket := filters[0].GetConfig().Fields["token_bucket"].GetStructValue()
+	// The conditional rule is ignored, leaving 100 tokens charged 10 per request.
+	if got := bucket.Fields["max_tokens"].GetNumberValue(); got != 10 {
+		t.Errorf("max_tokens => %v, want 10", got)
+	}
+	if got := bucket.Fields["fill_interval"].GetStringValue(); got != "1s" {
+		t.Errorf("fill_interval => %v, want 1s", got)
+	}
+
+	headers := buildRequiredHeadersFilter(in)
+	if headers == nil || headers.Name != authz_model.RBACHTTPFilterName {
+		t.Fatalf("expected an RBAC filter of the required headers, got %v", headers)
+	}
+	rbac := &http_rbac.RBAC{}
+	if err := ptypes.UnmarshalAny(headers.GetTypedConfig(), rbac); err != nil {
+		t.Fatalf("failed to unmarshal the RBAC filter: %v", err)
+	}
+	var got []string
+	for _, permission := range rbac.Rules.Policies["required-headers"].Permissions[0].GetAndRules().Rules {
+		got = append(got, permission.GetHeader().Name)
+	}
+	if want := []string{"x-api-key", "x-user"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("required headers => %v, want %v", got, want)
+	}
+
+	mutable := &plugin.MutableObjects{FilterChains: []plugin.FilterChain{{}}}
+	addLocalQuotaFilters(in, mutable)
+	if len(mutable.FilterChains[0].HTTP) != 2 {
+		t.Errorf("expected header validation and local quota filters on the HTTP filter chain")
+	}
+
+	// The Envoy of the older proxies doesn't have the local rate limit filter.
+	in.Node = &model.Proxy{IstioVersion: &model.IstioVersion{Major: 1, Minor: 4}}
+	mutable = &plugin.MutableObjects{FilterChains: []plugin.FilterChain{{}}}
+	addLocalQuotaFilters(in, mutable)
+	if len(mutable.FilterChains[0].HTTP) != 1 || mutable.FilterChains[0].HTTP[0].Name != authz_model.RBACHTTPFilterName {
+		t.Errorf("expected only the header validation filter for the older proxies, got %v", mutable.FilterChains[0].HTTP)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"sort"
+
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+)
+
+// FilterPhase is the insertion point of the HTTP filters added by a plugin. The HTTP filter chain
+// of a listener is a pipeline running the phases in order: authn, authz, stats, extensions, routing.
+// The routing phase holds the filters added by Pilot itself after all plugins, gRPC-Web, CORS,
+// fault injection and the router, which is always last. Within a phase, filters keep the order of
+// the plugins, then the order they were added in by each plugin. EnvoyFilters are applied to the
+// resulting chain.
+type FilterPhase int
+
+const (
+	// PhaseAuthn filters authenticate the request, e.g. JWT and peer authentication.
+	PhaseAuthn FilterPhase = iota
+	// PhaseAuthz filters decide whether the authenticated request is allowed, e.g. RBAC.
+	PhaseAuthz
+	// PhaseStats filters observe the allowed requests, e.g. Mixer and telemetry exporters.
+	PhaseStats
+	// PhaseExtension filters are the custom extensions, run just before routing.
+	PhaseExtension
+)
+
+// String returns the name of the phase.
+func (p FilterPhase) String() string {
+	switch p {
+	case PhaseAuthn:
+		return "authn"
+	case PhaseAuthz:
+		return "authz"
+	case PhaseStats:
+		return "stats"
+	case PhaseExtension:
+		return "extension"
+	default:
+		return "unknown"
+	}
+}
+
+// PhasedPlugin is implemented by the plugins declaring the phase of the HTTP filters they add.
+// The filters of the plugins that do not implement it are in PhaseExtension.
+type PhasedPlugin interface {
+	HTTPFilterPhase() FilterPhase
+}
+
+// PhaseOf returns the phase of the HTTP filters added by the plugin.
+func PhaseOf(p Plugin) FilterPhase {
+	if pp, ok := p.(PhasedPlugin); ok {
+		return pp.HTTPFilterPhase()
+	}
+	return PhaseExtension
+}
+
+// CallListenerPlugins calls the listener callback of each plugin through call, then orders the HTTP
+// filters the plugins appended to the filter chains of mutable by phase, regardless of the order of
+// the plugins.
+func CallListenerPlugins(plugins []Plugin, mutable *MutableObjects, call func(p Plugin)) {
+	phases := make([][]FilterPhase, len(mutable.FilterChains))
+	for _, p := range plugins {
+		call(p)
+		phase := PhaseOf(p)
+		for i := range phases {
+			if i >= len(mutable.FilterChains) {
+				break
+			}
+			for len(phases[i]) < len(mutable.FilterChains[i].HTTP) {
+				phases[i] = append(phases[i], phase)
+			}
+		}
+	}
+
+	for i := range phases {
+		if i >= len(mutable.FilterChains) || len(phases[i]) != len(mutable.FilterChains[i].HTTP) {
+			// Filters were removed or replaced, their phases are unknown.
+			continue
+		}
+		sortHTTPFilters(mutable.FilterChains[i].HTTP, phases[i])
+	}
+}
+
+type phasedFilters struct {
+	filters []*http_conn.HttpFilter
+	phases  []FilterPhase
+}
+
+func (f phasedFilters) Len() int           { return len(f.filters) }
+func (f phasedFilters) Less(i, j int) bool { return f.phases[i] < f.phases[j] }
+func (f phasedFilters) Swap(i, j int) {
+	f.filters[i], f.filters[j] = f.filters[j], f.filters[i]
+	f.phases[i], f.phases[j] = f.phases[j], f.phases[i]
+}
+
+// sortHTTPFilters orders the filters by phase, keeping the order of the filters of the same phase.
+func sortHTTPFilters(filters []*http_conn.HttpFilter, phases []FilterPhase) {
+	sort.Stable(phasedFilters{filters: filters, phases: phases})
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+)
+
+// fakePlugin appends one HTTP filter per name to every filter chain of the inbound listener.
+type fakePlugin struct {
+	Plugin
+	names []string
+}
+
+func (f fakePlugin) OnInboundListener(in *InputParams, mutable *MutableObjects) error {
+	for i := range mutable.FilterChains {
+		for _, name := range f.names {
+			mutable.FilterChains[i].HTTP = append(mutable.FilterChains[i].HTTP, &http_conn.HttpFilter{Name: name})
+		}
+	}
+	return nil
+}
+
+type fakePhasedPlugin struct {
+	fakePlugin
+	phase FilterPhase
+}
+
+func (f fakePhasedPlugin) HTTPFilterPhase() FilterPhase {
+	return f.phase
+}
+
+func (f fakePlugin) String() string {
+	return fmt.Sprintf("%s(%s)", PhaseExtension, strings.Join(f.names, "+"))
+}
+
+func (f fakePhasedPlugin) String() string {
+	return fmt.Sprintf("%s(%s)", f.phase, strings.Join(f.names, "+"))
+}
+
+func newFakePlugin(phase FilterPhase, names ...string) Plugin {
+	if phase == PhaseExtension {
+		return fakePlugin{names: names}
+	}
+	return fakePhasedPlugin{fakePlugin: fakePlugin{names: names}, phase: phase}
+}
+
+func permutations(plugins []Plugin) [][]Plugin {
+	if len(plugins) <= 1 {
+		return [][]Plugin{plugins}
+	}
+	var out [][]Plugin
+	for i := range plugins {
+		rest := append(append([]Plugin{}, plugins[:i]...), plugins[i+1:]...)
+		for _, p := range permutations(rest) {
+			out = append(out, append([]Plugin{plugins[i]}, p...))
+		}
+	}
+	return out
+}
+
+func filterNames(filters []*http_conn.HttpFilter) []string {
+	names := make([]string, 0, len(filters))
+	for _, f := range filters {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func TestCallListenerPluginsOrdersByPhase(t *testing.T) {
+	plugins := []Plugin{
+		newFakePlugin(PhaseAuthn, "jwt", "authn"),
+		newFakePlugin(PhaseAuthz, "rbac"),
+		newFakePlugin(PhaseStats, "stats"),
+		newFakePlugin(PhaseExtension, "lua"),
+	}
+	want := []string{"jwt", "authn", "rbac", "stats", "lua"}
+
+	for _, perm := range permutations(plugins) {
+		var order []string
+		for _, p := range perm {
+			order = append(order, fmt.Sprint(p))
+		}
+		t.Run(strings.Join(order, ","), func(t *testing.T) {
+			mutable := &MutableObjects{FilterChains: make([]FilterChain, 2)}
+			CallListenerPlugins(perm, mutable, func(p Plugin) {
+				if err := p.OnInboundListener(nil, mutable); err != nil {
+					t.Fatal(err)
+				}
+			})
+			for i, chain := range mutable.FilterChains {
+				if got := filterNames(chain.HTTP); !reflect.DeepEqual(got, want) {
+					t.Errorf("filter chain %d: got %v but want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCallListenerPluginsKeepsOrderWithinPhase(t *testing.T) {
+	mutable := &MutableObjects{FilterChains: make([]FilterChain, 1)}
+	plugins := []Plugin{
+		newFakePlugin(PhaseExtension, "ext1"),
+		newFakePlugin(PhaseStats, "stats1"),
+		newFakePlugin(PhaseExtension, "ext2"),
+		newFakePlugin(PhaseStats, "stats2"),
+	}
+	CallListenerPlugins(plugins, mutable, func(p Plugin) {
+		_ = p.OnInboundListener(nil, mutable)
+	})
+	want := []string{"stats1", "stats2", "ext1", "ext2"}
+	if got := filterNames(mutable.FilterChains[0].HTTP); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v but want %v", got, want)
+	}
+}
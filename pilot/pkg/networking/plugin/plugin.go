@@ -49,6 +49,8 @@ const (
 	Health = "health"
 	// Mixer is the name of the mixer plugin passed through the command line
 	Mixer = "mixer"
+	// Telemetry is the name of the telemetry exporter plugin passed through the command line
+	Telemetry = "telemetry"
 )
 
 // ModelProtocolToListenerProtocol converts from a config.Protocol to its corresponding plugin.ListenerProtocol
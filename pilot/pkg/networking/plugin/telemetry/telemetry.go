@@ -0,0 +1,283 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package telemetry generates the in-proxy telemetry filters exporting metrics and access logs
+// directly to a cloud-managed backend, without Mixer.
+package telemetry
+
+import (
+	"encoding/json"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	pstruct "github.com/golang/protobuf/ptypes/struct"
+
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/plugin"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/bootstrap/platform"
+	"istio.io/istio/pkg/config/mesh"
+)
+
+const (
+	// wasmFilter is the name of the Envoy filter hosting the telemetry extensions.
+	wasmFilter = "envoy.wasm"
+	// nullVMRuntime runs the extensions compiled into the proxy.
+	nullVMRuntime = "envoy.wasm.runtime.null"
+
+	stackdriverExtension = "envoy.wasm.null.stackdriver"
+	statsExtension       = "envoy.wasm.stats"
+
+	// TLSModeAuto is the TLS mode of connections using auto mTLS.
+	TLSModeAuto = "auto"
+	// TLSModeUser is the TLS mode of connections using the TLS settings of a DestinationRule.
+	TLSModeUser = "user"
+	// TLSModePlaintext is the TLS mode of plaintext connections.
+	TLSModePlaintext = "plaintext"
+
+	// tlsModeMetadataKey is the key of the TLS mode in the istio metadata of outbound clusters.
+	tlsModeMetadataKey = "tls_mode"
+	// tlsModeDimension is the metric label holding the TLS mode of the connection.
+	tlsModeDimension = "tls_mode"
+)
+
+// Plugin generates the telemetry filters of the exporter configured in the telemetryExport mesh config.
+type Plugin struct {
+	tlsModeAttribution bool
+}
+
+// NewPlugin returns an instance of the telemetry plugin.
+func NewPlugin() plugin.Plugin {
+	return Plugin{
+		tlsModeAttribution: features.TelemetryTLSModeAttribution,
+	}
+}
+
+// telemetryExport returns the telemetry export settings of the mesh config, which may change at runtime.
+func telemetryExport(in *plugin.InputParams) mesh.TelemetryExport {
+	if in.Env == nil || in.Env.MeshExtensions == nil {
+		return mesh.TelemetryExport{}
+	}
+	return in.Env.MeshExtensions.TelemetryExport
+}
+
+// resourceLabels returns the labels identifying the workload of the proxy in the telemetry backend.
+func resourceLabels(node *model.Proxy, export mesh.TelemetryExport) map[string]string {
+	labels := map[string]string{
+		"namespace_name": node.ConfigNamespace,
+	}
+	if node.Metadata == nil {
+		if export.ProjectID != "" {
+			labels["project_id"] = export.ProjectID
+		}
+		return labels
+	}
+
+	projectID := node.Metadata.PlatformMetadata[platform.GCPProject]
+	if projectID == "" {
+		projectID = export.ProjectID
+	}
+	cluster := node.Metadata.PlatformMetadata[platform.GCPCluster]
+	if cluster == "" {
+		cluster = node.Metadata.ClusterID
+	}
+	for k, v := range map[string]string{
+		"project_id":    projectID,
+		"cluster_name":  cluster,
+		"location":      node.Metadata.PlatformMetadata[platform.GCPLocation],
+		"mesh_uid":      node.Metadata.MeshID,
+		"workload_name": node.Metadata.WorkloadName,
+	} {
+		if v != "" {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// buildFilter returns the telemetry filter of the exporter for the given traffic direction,
+// or nil if no exporter is configured.
+func (p Plugin) buildFilter(node *model.Proxy, export mesh.TelemetryExport, inbound bool) *http_conn.HttpFilter {
+	var extension, rootID string
+	configuration := map[string]interface{}{}
+	switch export.Exporter {
+	case mesh.TelemetryExporterStackdriver:
+		extension, rootID = stackdriverExtension, "stackdriver_outbound"
+		if inbound {
+			rootID = "stackdriver_inbound"
+		}
+		configuration["enable_mesh_edges_reporting"] = false
+		configuration["disable_server_access_logging"] = !export.AccessLogging
+		configuration["resource_labels"] = resourceLabels(node, export)
+	case mesh.TelemetryExporterOpenTelemetry:
+		extension, rootID = statsExtension, "stats_outbound"
+		if inbound {
+			rootID = "stats_inbound"
+		}
+		configuration["debug"] = false
+		configuration["stat_prefix"] = "istio"
+		if p.tlsModeAttribution {
+			configuration["metrics"] = []map[string]interface{}{{
+				"dimensions": map[string]string{tlsModeDimension: tlsModeExpression(inbound)},
+			}}
+		}
+	default:
+		return nil
+	}
+
+	b, err := json.Marshal(configuration)
+	if err != nil {
+		log.Warnf("Failed to marshal %s telemetry configuration: %v", export.Exporter, err)
+		return nil
+	}
+
+	cfg := &pstruct.Struct{Fields: map[string]*pstruct.Value{
+		"config": structValue(map[string]*pstruct.Value{
+			"root_id": stringValue(rootID),
+			"vm_config": structValue(map[string]*pstruct.Value{
+				"vm_id":   stringValue(rootID),
+				"runtime": stringValue(nullVMRuntime),
+				"code": structValue(map[string]*pstruct.Value{
+					"inline_string": stringValue(extension),
+				}),
+			}),
+			"configuration": stringValue(string(b)),
+		}),
+	}}
+
+	return &http_conn.HttpFilter{
+		Name:       wasmFilter,
+		ConfigType: &http_conn.HttpFilter_Config{Config: cfg},
+	}
+}
+
+// tlsModeExpression returns the expression evaluated by the stats extension to label requests with
+// the TLS mode of their connection. On the server side, only mTLS and plaintext can be told apart.
+// On the client side, the mode is read from the metadata of the upstream cluster, set by OnOutboundCluster,
+// unless the connection did not negotiate TLS, e.g. auto mTLS to an endpoint without sidecar.
+func tlsModeExpression(inbound bool) string {
+	if inbound {
+		return `connection.mtls ? "mutual_tls" : "` + TLSModePlaintext + `"`
+	}
+	return `has(upstream.tls_version) ? xds.cluster_metadata.filter_metadata["` + util.IstioMetadataKey +
+		`"]["` + tlsModeMetadataKey + `"] : "` + TLSModePlaintext + `"`
+}
+
+// clusterTLSMode returns the TLS mode of the connections of an outbound cluster.
+func clusterTLSMode(cluster *xdsapi.Cluster) string {
+	switch {
+	case len(cluster.TransportSocketMatches) > 0:
+		return TLSModeAuto
+	case cluster.TlsContext != nil:
+		return TLSModeUser
+	default:
+		return TLSModePlaintext
+	}
+}
+
+func structValue(fields map[string]*pstruct.Value) *pstruct.Value {
+	return &pstruct.Value{Kind: &pstruct.Value_StructValue{StructValue: &pstruct.Struct{Fields: fields}}}
+}
+
+func stringValue(s string) *pstruct.Value {
+	return &pstruct.Value{Kind: &pstruct.Value_StringValue{StringValue: s}}
+}
+
+// addFilter appends the telemetry filter to the HTTP filter chains of the listener.
+func (p Plugin) addFilter(in *plugin.InputParams, mutable *plugin.MutableObjects, inbound bool) {
+	if in.Node == nil {
+		return
+	}
+	filter := p.buildFilter(in.Node, telemetryExport(in), inbound)
+	if filter == nil {
+		return
+	}
+	for cnum := range mutable.FilterChains {
+		switch in.ListenerProtocol {
+		case plugin.ListenerProtocolHTTP:
+			mutable.FilterChains[cnum].HTTP = append(mutable.FilterChains[cnum].HTTP, filter)
+		case plugin.ListenerProtocolAuto, plugin.ListenerProtocolTCP:
+			// Gateways terminating TLS and protocol sniffing listeners may have HTTP filter chains.
+			if mutable.FilterChains[cnum].ListenerProtocol == plugin.ListenerProtocolHTTP {
+				mutable.FilterChains[cnum].HTTP = append(mutable.FilterChains[cnum].HTTP, filter)
+			}
+		}
+	}
+}
+
+// OnOutboundListener implements the Plugin interface method.
+func (p Plugin) OnOutboundListener(in *plugin.InputParams, mutable *plugin.MutableObjects) error {
+	// Gateways report as the server side of the request.
+	p.addFilter(in, mutable, in.Node != nil && in.Node.Type == model.Router)
+	return nil
+}
+
+// HTTPFilterPhase implements the plugin.PhasedPlugin interface method.
+func (Plugin) HTTPFilterPhase() plugin.FilterPhase {
+	return plugin.PhaseStats
+}
+
+// OnInboundListener implements the Plugin interface method.
+func (p Plugin) OnInboundListener(in *plugin.InputParams, mutable *plugin.MutableObjects) error {
+	p.addFilter(in, mutable, true)
+	return nil
+}
+
+// OnVirtualListener implements the Plugin interface method.
+func (Plugin) OnVirtualListener(in *plugin.InputParams, mutable *plugin.MutableObjects) error {
+	return nil
+}
+
+// OnOutboundCluster implements the Plugin interface method.
+func (p Plugin) OnOutboundCluster(in *plugin.InputParams, cluster *xdsapi.Cluster) {
+	if !p.tlsModeAttribution || telemetryExport(in).Exporter != mesh.TelemetryExporterOpenTelemetry {
+		return
+	}
+	if cluster.Metadata == nil {
+		cluster.Metadata = &core.Metadata{}
+	}
+	if cluster.Metadata.FilterMetadata == nil {
+		cluster.Metadata.FilterMetadata = map[string]*pstruct.Struct{}
+	}
+	istio := cluster.Metadata.FilterMetadata[util.IstioMetadataKey]
+	if istio == nil {
+		istio = &pstruct.Struct{}
+		cluster.Metadata.FilterMetadata[util.IstioMetadataKey] = istio
+	}
+	if istio.Fields == nil {
+		istio.Fields = map[string]*pstruct.Value{}
+	}
+	istio.Fields[tlsModeMetadataKey] = stringValue(clusterTLSMode(cluster))
+}
+
+// OnInboundCluster implements the Plugin interface method.
+func (Plugin) OnInboundCluster(in *plugin.InputParams, cluster *xdsapi.Cluster) {
+}
+
+// OnOutboundRouteConfiguration implements the Plugin interface method.
+func (Plugin) OnOutboundRouteConfiguration(in *plugin.InputParams, route *xdsapi.RouteConfiguration) {
+}
+
+// OnInboundRouteConfiguration implements the Plugin interface method.
+func (Plugin) OnInboundRouteConfiguration(in *plugin.InputParams, route *xdsapi.RouteConfiguration) {
+}
+
+// OnInboundFilterChains implements the Plugin interface method.
+func (Plugin) OnInboundFilterChains(in *plugin.InputParams) []plugin.FilterChain {
+	return nil
+}
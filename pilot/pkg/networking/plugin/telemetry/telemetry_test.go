@@ -0,0 +1,203 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	auth "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/plugin"
+	"istio.io/istio/pkg/bootstrap/platform"
+	"istio.io/istio/pkg/config/mesh"
+)
+
+// withTelemetryExport returns the environment of the telemetry export mesh config.
+func withTelemetryExport(export mesh.TelemetryExport) *model.Environment {
+	return &model.Environment{MeshExtensions: &mesh.Extensions{TelemetryExport: export}}
+}
+
+func TestResourceLabels(t *testing.T) {
+	export := mesh.TelemetryExport{Exporter: mesh.TelemetryExporterStackdriver, ProjectID: "default-project"}
+	cases := []struct {
+		name string
+		node *model.Proxy
+		want map[string]string
+	}{
+		{
+			name: "platform metadata",
+			node: &model.Proxy{
+				ConfigNamespace: "ns1",
+				Metadata: &model.NodeMetadata{
+					ClusterID:    "Kubernetes",
+					WorkloadName: "reviews-v1",
+					PlatformMetadata: map[string]string{
+						platform.GCPProject:  "my-project",
+						platform.GCPCluster:  "my-cluster",
+						platform.GCPLocation: "us-east1-b",
+					},
+				},
+			},
+			want: map[string]string{
+				"namespace_name": "ns1",
+				"project_id":     "my-project",
+				"cluster_name":   "my-cluster",
+				"location":       "us-east1-b",
+				"workload_name":  "reviews-v1",
+			},
+		},
+		{
+			name: "defaults",
+			node: &model.Proxy{
+				ConfigNamespace: "ns1",
+				Metadata:        &model.NodeMetadata{ClusterID: "Kubernetes", MeshID: "mesh1"},
+			},
+			want: map[string]string{
+				"namespace_name": "ns1",
+				"project_id":     "default-project",
+				"cluster_name":   "Kubernetes",
+				"mesh_uid":       "mesh1",
+			},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resourceLabels(tt.node, export); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resourceLabels() => %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnInboundListener(t *testing.T) {
+	node := &model.Proxy{
+		Type:            model.SidecarProxy,
+		ConfigNamespace: "ns1",
+		Metadata:        &model.NodeMetadata{},
+	}
+	in := &plugin.InputParams{ListenerProtocol: plugin.ListenerProtocolHTTP, Node: node}
+
+	// No exporter configured.
+	mutable := &plugin.MutableObjects{FilterChains: []plugin.FilterChain{{}}}
+	if err := (Plugin{}).OnInboundListener(in, mutable); err != nil {
+		t.Fatal(err)
+	}
+	if len(mutable.FilterChains[0].HTTP) != 0 {
+		t.Fatalf("expected no filters without exporter, got %v", mutable.FilterChains[0].HTTP)
+	}
+
+	in.Env = withTelemetryExport(mesh.TelemetryExport{
+		Exporter:      mesh.TelemetryExporterStackdriver,
+		ProjectID:     "my-project",
+		AccessLogging: true,
+	})
+	if err := (Plugin{}).OnInboundListener(in, mutable); err != nil {
+		t.Fatal(err)
+	}
+	if len(mutable.FilterChains[0].HTTP) != 1 {
+		t.Fatalf("expected one telemetry filter, got %d", len(mutable.FilterChains[0].HTTP))
+	}
+	filter := mutable.FilterChains[0].HTTP[0]
+	if filter.Name != wasmFilter {
+		t.Errorf("unexpected filter name %s", filter.Name)
+	}
+	cfg := filter.GetConfig().Fields["config"].GetStructValue()
+	if got := cfg.Fields["root_id"].GetStringValue(); got != "stackdriver_inbound" {
+		t.Errorf("root_id => %s, want stackdriver_inbound", got)
+	}
+	code := cfg.Fields["vm_config"].GetStructValue().Fields["code"].GetStructValue()
+	if got := code.Fields["inline_string"].GetStringValue(); got != stackdriverExtension {
+		t.Errorf("extension => %s, want %s", got, stackdriverExtension)
+	}
+
+	var configuration struct {
+		DisableServerAccessLogging bool              `json:"disable_server_access_logging"`
+		ResourceLabels             map[string]string `json:"resource_labels"`
+	}
+	if err := json.Unmarshal([]byte(cfg.Fields["configuration"].GetStringValue()), &configuration); err != nil {
+		t.Fatalf("invalid configuration: %v", err)
+	}
+	if configuration.DisableServerAccessLogging {
+		t.Errorf("expected access logging to be enabled")
+	}
+	if configuration.ResourceLabels["project_id"] != "my-project" {
+		t.Errorf("unexpected resource labels %v", configuration.ResourceLabels)
+	}
+}
+
+func TestTLSModeAttribution(t *testing.T) {
+	p := Plugin{tlsModeAttribution: true}
+	export := mesh.TelemetryExport{Exporter: mesh.TelemetryExporterOpenTelemetry}
+	in := &plugin.InputParams{Env: withTelemetryExport(export)}
+
+	cases := []struct {
+		name    string
+		cluster *xdsapi.Cluster
+		want    string
+	}{
+		{
+			name:    "auto mtls",
+			cluster: &xdsapi.Cluster{TransportSocketMatches: []*xdsapi.Cluster_TransportSocketMatch{{Name: "mtls"}}},
+			want:    TLSModeAuto,
+		},
+		{
+			name:    "destination rule tls",
+			cluster: &xdsapi.Cluster{TlsContext: &auth.UpstreamTlsContext{}},
+			want:    TLSModeUser,
+		},
+		{
+			name:    "plaintext",
+			cluster: &xdsapi.Cluster{},
+			want:    TLSModePlaintext,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			p.OnOutboundCluster(in, tt.cluster)
+			got := tt.cluster.Metadata.FilterMetadata["istio"].Fields[tlsModeMetadataKey].GetStringValue()
+			if got != tt.want {
+				t.Errorf("tls mode => %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Clusters are left untouched when attribution is disabled or the exporter is not configured.
+	cluster := &xdsapi.Cluster{}
+	Plugin{}.OnOutboundCluster(in, cluster)
+	p.OnOutboundCluster(&plugin.InputParams{Env: &model.Environment{}}, cluster)
+	if cluster.Metadata != nil {
+		t.Errorf("unexpected cluster metadata %v", cluster.Metadata)
+	}
+
+	node := &model.Proxy{Type: model.SidecarProxy, Metadata: &model.NodeMetadata{}}
+	for _, inbound := range []bool{true, false} {
+		cfg := p.buildFilter(node, export, inbound).GetConfig().Fields["config"].GetStructValue()
+		var configuration struct {
+			Metrics []struct {
+				Dimensions map[string]string `json:"dimensions"`
+			} `json:"metrics"`
+		}
+		if err := json.Unmarshal([]byte(cfg.Fields["configuration"].GetStringValue()), &configuration); err != nil {
+			t.Fatalf("invalid configuration: %v", err)
+		}
+		if len(configuration.Metrics) != 1 || configuration.Metrics[0].Dimensions[tlsModeDimension] != tlsModeExpression(inbound) {
+			t.Errorf("inbound=%v: unexpected metrics configuration %+v", inbound, configuration.Metrics)
+		}
+	}
+}
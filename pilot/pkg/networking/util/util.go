@@ -16,14 +16,18 @@ package util
 
 import (
 	"fmt"
+	"io/ioutil"
 	"math"
 	"net"
 	"runtime"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	auth "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
 	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	endpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
 	listener "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
@@ -43,6 +47,7 @@ import (
 
 	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/spiffe"
 )
 
 const (
@@ -69,6 +74,9 @@ const (
 	// IstioMetadataKey is the key under which metadata is added to a route or cluster
 	// regarding the virtual service or destination rule used for each
 	IstioMetadataKey = "istio"
+	// EnvoyFiltersMetadataKey is the field of the istio metadata of a filter chain listing the EnvoyFilters
+	// that patched it
+	EnvoyFiltersMetadataKey = "envoyfilters"
 	// The range of LoadBalancingWeight is [1, 128]
 	maxLoadBalancingWeight = 128
 
@@ -76,6 +84,9 @@ const (
 	// which determines the endpoint level transport socket configuration.
 	EnvoyTransportSocketMetadataKey = "envoy.transport_socket_match"
 
+	// EnvoyLbMetadataKey is the key of the load balancer metadata of an endpoint, e.g. its canary status.
+	EnvoyLbMetadataKey = "envoy.lb"
+
 	// EnvoyRawBufferSocketName matched with hardcoded built-in Envoy transport name which determines
 	// endpoint level plantext transport socket configuration
 	EnvoyRawBufferSocketName = "raw_buffer"
@@ -309,6 +320,13 @@ func IsIstioVersionGE13(node *model.Proxy) bool {
 		node.IstioVersion.Compare(&model.IstioVersion{Major: 1, Minor: 3, Patch: -1}) >= 0
 }
 
+// IsIstioVersionGE18 checks whether the given Istio version is greater than or equals 1.8, the first one whose
+// Envoy has the local rate limit HTTP filter. Unlike the other checks, an unknown version is assumed to be older.
+func IsIstioVersionGE18(node *model.Proxy) bool {
+	return node.IstioVersion != nil &&
+		node.IstioVersion.Compare(&model.IstioVersion{Major: 1, Minor: 8, Patch: -1}) >= 0
+}
+
 // IsXDSMarshalingToAnyEnabled controls whether "marshaling to Any" feature is enabled.
 func IsXDSMarshalingToAnyEnabled(node *model.Proxy) bool {
 	return !features.DisableXDSMarshalingToAny
@@ -497,6 +515,16 @@ func BuildConfigInfoMetadata(config model.ConfigMeta) *core.Metadata {
 	}
 }
 
+// BuildRouteConfigInfoMetadata builds core.Metadata struct containing the name.namespace of the config
+// and the index of the rule that produced the route.
+func BuildRouteConfigInfoMetadata(config model.ConfigMeta, ruleIndex int) *core.Metadata {
+	metadata := BuildConfigInfoMetadata(config)
+	metadata.FilterMetadata[IstioMetadataKey].Fields["rule"] = &pstruct.Value{
+		Kind: &pstruct.Value_NumberValue{NumberValue: float64(ruleIndex)},
+	}
+	return metadata
+}
+
 // IsHTTPFilterChain returns true if the filter chain contains a HTTP connection manager filter
 func IsHTTPFilterChain(filterChain *listener.FilterChain) bool {
 	for _, f := range filterChain.Filters {
@@ -587,8 +615,9 @@ func HandleCrash(handlers ...func()) {
 }
 
 // BuildLbEndpointMetadata adds metadata values to a lb endpoint
-func BuildLbEndpointMetadata(uid string, network string, mtlsReady bool) *core.Metadata {
-	if uid == "" && network == "" && !mtlsReady {
+func BuildLbEndpointMetadata(uid string, network string, mtlsReady bool, tlsMode model.EndpointTLSMode) *core.Metadata {
+	mtlsReady = tlsMode.AcceptsMTLS(mtlsReady)
+	if uid == "" && network == "" && !mtlsReady && tlsMode == model.EndpointTLSModeUnset {
 		return nil
 	}
 
@@ -610,9 +639,168 @@ func BuildLbEndpointMetadata(uid string, network string, mtlsReady bool) *core.M
 		}
 	}
 
-	if mtlsReady {
+	if tlsMode != model.EndpointTLSModeUnset {
+		fields := map[string]*pstruct.Value{
+			model.TLSModeLabelShortname: {Kind: &pstruct.Value_StringValue{StringValue: string(tlsMode)}},
+		}
+		if mtlsReady {
+			fields[model.MTLSReadyLabelShortname] = EndpointMetadataMtlsReady.Fields[model.MTLSReadyLabelShortname]
+		}
+		metadata.FilterMetadata[EnvoyTransportSocketMetadataKey] = &pstruct.Struct{Fields: fields}
+	} else if mtlsReady {
 		metadata.FilterMetadata[EnvoyTransportSocketMetadataKey] = EndpointMetadataMtlsReady
 	}
 
 	return metadata
 }
+
+// trustDomainCABundlesRefreshInterval is the interval the root certificate files of the trust domains are
+// read again after, to pick up rotated roots.
+const trustDomainCABundlesRefreshInterval = time.Minute
+
+var (
+	trustDomainCABundlesMutex    sync.Mutex
+	trustDomainCABundlesValue    string
+	trustDomainCABundlesLoadedAt time.Time
+	trustDomainCABundles         map[string][]byte
+)
+
+// TrustDomainCABundles returns the root certificates of the trust domains configured by
+// PILOT_TRUST_DOMAIN_CA_BUNDLES, by trust domain. The certificate files are read by Pilot, so that the roots
+// can be sent inline to the proxies, and read again every trustDomainCABundlesRefreshInterval. The trust
+// domains whose file cannot be read are skipped.
+func TrustDomainCABundles() map[string][]byte {
+	value := features.TrustDomainCABundles.Get()
+	trustDomainCABundlesMutex.Lock()
+	defer trustDomainCABundlesMutex.Unlock()
+	if value == trustDomainCABundlesValue && trustDomainCABundles != nil &&
+		time.Since(trustDomainCABundlesLoadedAt) < trustDomainCABundlesRefreshInterval {
+		return trustDomainCABundles
+	}
+
+	bundles := make(map[string][]byte)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			log.Warnf("ignoring invalid trust domain CA bundle %q of %s", pair, features.TrustDomainCABundles.Name)
+			continue
+		}
+		root, err := ioutil.ReadFile(parts[1])
+		if err != nil {
+			log.Warnf("ignoring the CA bundle of trust domain %s: %v", parts[0], err)
+			continue
+		}
+		bundles[parts[0]] = root
+	}
+	trustDomainCABundlesValue = value
+	trustDomainCABundlesLoadedAt = time.Now()
+	trustDomainCABundles = bundles
+	return bundles
+}
+
+// SpiffeTrustDomain returns the trust domain of a SPIFFE identity, or "" if the identity is not a SPIFFE URI.
+func SpiffeTrustDomain(identity string) string {
+	if !strings.HasPrefix(identity, spiffe.URIPrefix) {
+		return ""
+	}
+	td := strings.TrimPrefix(identity, spiffe.URIPrefix)
+	if i := strings.Index(td, "/"); i >= 0 {
+		td = td[:i]
+	}
+	return td
+}
+
+// AddTrustDomainMetadata adds the trust domain of the service account of an endpoint to its transport socket
+// metadata, if the trust domain has a CA bundle, so that the endpoint is validated with the root of its trust
+// domain.
+func AddTrustDomainMetadata(metadata *core.Metadata, serviceAccount string) *core.Metadata {
+	td := SpiffeTrustDomain(serviceAccount)
+	if td == "" {
+		return metadata
+	}
+	if _, f := TrustDomainCABundles()[td]; !f {
+		return metadata
+	}
+
+	if metadata == nil {
+		metadata = &core.Metadata{}
+	}
+	if metadata.FilterMetadata == nil {
+		metadata.FilterMetadata = map[string]*pstruct.Struct{}
+	}
+	// The transport socket metadata may be shared, e.g. EndpointMetadataMtlsReady.
+	fields := map[string]*pstruct.Value{}
+	if existing := metadata.FilterMetadata[EnvoyTransportSocketMetadataKey]; existing != nil {
+		for k, v := range existing.Fields {
+			fields[k] = v
+		}
+	}
+	fields[model.TrustDomainLabelShortname] = &pstruct.Value{Kind: &pstruct.Value_StringValue{StringValue: td}}
+	metadata.FilterMetadata[EnvoyTransportSocketMetadataKey] = &pstruct.Struct{Fields: fields}
+	return metadata
+}
+
+// AddCanaryMetadata marks an endpoint labeled with model.CanaryLabel as a canary in its load balancer metadata, so
+// that it is avoided by the retries with the canary host predicate.
+func AddCanaryMetadata(metadata *core.Metadata, labels map[string]string) *core.Metadata {
+	if labels[model.CanaryLabel] != "true" {
+		return metadata
+	}
+	if metadata == nil {
+		metadata = &core.Metadata{}
+	}
+	if metadata.FilterMetadata == nil {
+		metadata.FilterMetadata = map[string]*pstruct.Struct{}
+	}
+	metadata.FilterMetadata[EnvoyLbMetadataKey] = &pstruct.Struct{
+		Fields: map[string]*pstruct.Value{
+			"canary": {Kind: &pstruct.Value_BoolValue{BoolValue: true}},
+		},
+	}
+	return metadata
+}
+
+// TrustBundleCA returns the trusted CA of the validation contexts of the mesh root, inlining the mesh root merged
+// with the roots of the trust bundles, or nil if there are no trust bundles.
+func TrustBundleCA(env *model.Environment) *core.DataSource {
+	if env == nil || env.TrustBundle == nil {
+		return nil
+	}
+	roots := env.TrustBundle.MergedRoots()
+	if len(roots) == 0 {
+		return nil
+	}
+	return &core.DataSource{
+		Specifier: &core.DataSource_InlineBytes{
+			InlineBytes: roots,
+		},
+	}
+}
+
+// ApplyTrustBundleCA replaces the mesh root of the validation context of a TLS context, mounted or fetched with SDS,
+// by the mesh root merged with the roots of the trust bundles. As Envoy does not merge the trusted CAs of a combined
+// validation context, the SDS validation context is replaced by the inline roots, keeping the subject alt names of
+// its default validation context. It does nothing without trust bundles.
+func ApplyTrustBundleCA(env *model.Environment, tlsContext *auth.CommonTlsContext) {
+	ca := TrustBundleCA(env)
+	if ca == nil || tlsContext == nil {
+		return
+	}
+	switch vc := tlsContext.ValidationContextType.(type) {
+	case *auth.CommonTlsContext_ValidationContext:
+		if vc.ValidationContext != nil {
+			vc.ValidationContext.TrustedCa = ca
+		}
+	case *auth.CommonTlsContext_CombinedValidationContext:
+		validationContext := &auth.CertificateValidationContext{}
+		if def := vc.CombinedValidationContext.GetDefaultValidationContext(); def != nil {
+			validationContext = proto.Clone(def).(*auth.CertificateValidationContext)
+		}
+		validationContext.TrustedCa = ca
+		tlsContext.ValidationContextType = &auth.CommonTlsContext_ValidationContext{ValidationContext: validationContext}
+	}
+}
@@ -15,11 +15,15 @@
 package util
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
 
 	v2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	auth "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
 	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	endpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
 	listener "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
@@ -36,6 +40,7 @@ import (
 	"gopkg.in/d4l3k/messagediff.v1"
 
 	meshconfig "istio.io/api/mesh/v1alpha1"
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 )
 
@@ -649,3 +654,121 @@ func TestCustomHandleCrash(t *testing.T) {
 
 	panic("test")
 }
+
+func TestAddTrustDomainMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trust-domain-ca-bundles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	root := filepath.Join(dir, "root-cert.pem")
+	if err := ioutil.WriteFile(root, []byte("partner-root"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = os.Setenv(features.TrustDomainCABundles.Name,
+		"partner.example.com="+root+",invalid,missing.example.com="+filepath.Join(dir, "missing.pem"))
+	defer func() { _ = os.Unsetenv(features.TrustDomainCABundles.Name) }()
+
+	if got := TrustDomainCABundles(); !reflect.DeepEqual(got, map[string][]byte{
+		"partner.example.com": []byte("partner-root"),
+	}) {
+		t.Errorf("TrustDomainCABundles() = %v", got)
+	}
+
+	// The trust domain is added to a copy of the shared mtlsReady metadata.
+	metadata := BuildLbEndpointMetadata("", "", true, model.EndpointTLSModeUnset)
+	got := AddTrustDomainMetadata(metadata, "spiffe://partner.example.com/ns/default/sa/reviews")
+	fields := got.FilterMetadata[EnvoyTransportSocketMetadataKey].Fields
+	if fields[model.TrustDomainLabelShortname].GetStringValue() != "partner.example.com" ||
+		fields[model.MTLSReadyLabelShortname].GetStringValue() != "true" {
+		t.Errorf("unexpected transport socket metadata %v", fields)
+	}
+	if _, f := EndpointMetadataMtlsReady.Fields[model.TrustDomainLabelShortname]; f {
+		t.Errorf("the shared mtlsReady metadata was modified")
+	}
+
+	for _, serviceAccount := range []string{"", "reviews", "spiffe://cluster.local/ns/default/sa/reviews"} {
+		if got := AddTrustDomainMetadata(nil, serviceAccount); got != nil {
+			t.Errorf("AddTrustDomainMetadata(%q) = %v, want nil", serviceAccount, got)
+		}
+	}
+}
+
+func TestAddCanaryMetadata(t *testing.T) {
+	metadata := BuildLbEndpointMetadata("uid", "", false, model.EndpointTLSModeUnset)
+	got := AddCanaryMetadata(metadata, map[string]string{model.CanaryLabel: "true"})
+	if !got.FilterMetadata[EnvoyLbMetadataKey].Fields["canary"].GetBoolValue() {
+		t.Errorf("expected the canary load balancer metadata, got %v", got)
+	}
+	if got.FilterMetadata[IstioMetadataKey] == nil {
+		t.Errorf("the istio metadata was removed: %v", got)
+	}
+
+	if got := AddCanaryMetadata(nil, map[string]string{model.CanaryLabel: "false"}); got != nil {
+		t.Errorf("AddCanaryMetadata() = %v, want nil", got)
+	}
+}
+
+func TestBuildRouteConfigInfoMetadata(t *testing.T) {
+	got := BuildRouteConfigInfoMetadata(model.ConfigMeta{
+		Group:     "networking.istio.io",
+		Version:   "v1alpha3",
+		Name:      "reviews",
+		Namespace: "default",
+		Type:      "virtual-service",
+	}, 2)
+	fields := got.FilterMetadata[IstioMetadataKey].Fields
+	if config := fields["config"].GetStringValue(); config != "/apis/networking.istio.io/v1alpha3/namespaces/default/virtual-service/reviews" {
+		t.Errorf("unexpected config %q", config)
+	}
+	if rule := fields["rule"].GetNumberValue(); rule != 2 {
+		t.Errorf("unexpected rule %v", rule)
+	}
+}
+
+type fakeTrustBundle []byte
+
+func (f fakeTrustBundle) MergedRoots() []byte {
+	return f
+}
+
+func TestApplyTrustBundleCA(t *testing.T) {
+	roots := []byte("merged roots")
+	env := &model.Environment{TrustBundle: fakeTrustBundle(roots)}
+	want := &auth.CertificateValidationContext{
+		TrustedCa:            &core.DataSource{Specifier: &core.DataSource_InlineBytes{InlineBytes: roots}},
+		VerifySubjectAltName: []string{"spiffe://cluster.local/ns/default/sa/reviews"},
+	}
+
+	mounted := &auth.CommonTlsContext{
+		ValidationContextType: &auth.CommonTlsContext_ValidationContext{
+			ValidationContext: &auth.CertificateValidationContext{
+				TrustedCa:            &core.DataSource{Specifier: &core.DataSource_Filename{Filename: "/etc/certs/root-cert.pem"}},
+				VerifySubjectAltName: []string{"spiffe://cluster.local/ns/default/sa/reviews"},
+			},
+		},
+	}
+	sds := &auth.CommonTlsContext{
+		ValidationContextType: &auth.CommonTlsContext_CombinedValidationContext{
+			CombinedValidationContext: &auth.CommonTlsContext_CombinedCertificateValidationContext{
+				DefaultValidationContext: &auth.CertificateValidationContext{
+					VerifySubjectAltName: []string{"spiffe://cluster.local/ns/default/sa/reviews"},
+				},
+				ValidationContextSdsSecretConfig: &auth.SdsSecretConfig{Name: "ROOTCA"},
+			},
+		},
+	}
+	unchanged := proto.Clone(sds).(*auth.CommonTlsContext)
+	for name, tlsContext := range map[string]*auth.CommonTlsContext{"mounted": mounted, "sds": sds} {
+		ApplyTrustBundleCA(env, tlsContext)
+		if got := tlsContext.GetValidationContext(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got validation context %v, want %v", name, got, want)
+		}
+	}
+
+	ApplyTrustBundleCA(&model.Environment{}, unchanged)
+	if unchanged.GetCombinedValidationContext() == nil {
+		t.Error("got the SDS validation context replaced without trust bundles")
+	}
+}
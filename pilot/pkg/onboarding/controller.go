@@ -0,0 +1,306 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package onboarding stamps the default configs of the namespaces labeled for the mesh, so that onboarding
+// is consistent across namespaces: a default Sidecar, an optional default deny authorization policy, and the
+// configs of a template, such as the telemetry settings.
+package onboarding
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/hashicorp/go-multierror"
+	v1 "k8s.io/api/core/v1"
+	klabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	networking "istio.io/api/networking/v1alpha3"
+	authz "istio.io/api/security/v1beta1"
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/config/kube/crd"
+	"istio.io/istio/pilot/pkg/leaderelection"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry/kube"
+	"istio.io/istio/pkg/config/schema"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+const (
+	// ManagedByLabel is the label of the configs stamped by the controller. Configs without it are owned by the
+	// users, and left untouched even if they have the name of a default config.
+	ManagedByLabel = "istio.io/managed-by"
+	managedBy      = "pilot-onboarding"
+
+	// DefaultSidecarName is the name of the default Sidecar of the onboarded namespaces.
+	DefaultSidecarName = "default"
+	// DefaultDenyName is the name of the default deny authorization policy of the onboarded namespaces.
+	DefaultDenyName = "default-deny"
+
+	electionID     = "istio-namespace-onboarding-leader"
+	resyncInterval = 60 * time.Second
+)
+
+// Options configures the onboarding of namespaces.
+type Options struct {
+	// Selector selects the namespaces onboarded by their labels.
+	Selector klabels.Selector
+	// SharedNamespaces are the namespaces the services of are visible to the onboarded namespaces, besides
+	// their own namespace.
+	SharedNamespaces []string
+	// DefaultDeny stamps an authorization policy denying all the requests the other policies do not allow.
+	DefaultDeny bool
+	// Template is a YAML of configs stamped in the onboarded namespaces, e.g. the telemetry settings.
+	Template string
+	// ResyncPeriod is the resync period of the namespace informer.
+	ResyncPeriod time.Duration
+}
+
+// Controller reconciles the default configs of the namespaces, on the leader of its election only.
+type Controller struct {
+	opts           Options
+	pilotNamespace string
+	store          model.ConfigStoreCache
+	template       []model.Config
+	types          []string
+	informer       cache.SharedIndexInformer
+	elector        *leaderelection.LeaderElection
+	handler        *kube.ChainHandler
+
+	mu    sync.Mutex
+	queue kube.Queue
+}
+
+// NewController creates a controller writing the default configs to the store, running under the election
+// of the namespace.
+func NewController(client kubernetes.Interface, store model.ConfigStoreCache, pilotNamespace string,
+	opts Options) (*Controller, error) {
+	template, _, err := crd.ParseInputs(opts.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid onboarding template: %v", err)
+	}
+	types := []string{schemas.Sidecar.Type, schemas.AuthorizationPolicy.Type}
+	for _, cfg := range template {
+		if _, f := store.ConfigDescriptor().GetByType(cfg.Type); !f {
+			return nil, fmt.Errorf("unsupported type %s of the onboarding template", cfg.Type)
+		}
+		if !contains(types, cfg.Type) {
+			types = append(types, cfg.Type)
+		}
+	}
+
+	c := &Controller{
+		opts:           opts,
+		pilotNamespace: pilotNamespace,
+		store:          store,
+		template:       template,
+		types:          types,
+		informer:       informers.NewSharedInformerFactory(client, opts.ResyncPeriod).Core().V1().Namespaces().Informer(),
+		handler:        &kube.ChainHandler{},
+	}
+	c.handler.Append(func(obj interface{}, event model.Event) error {
+		ns, ok := obj.(*v1.Namespace)
+		if !ok || event == model.EventDelete {
+			// The configs are deleted with the namespace.
+			return nil
+		}
+		return c.reconcile(ns)
+	})
+	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.push(obj, model.EventAdd)
+		},
+		UpdateFunc: func(old, cur interface{}) {
+			if !reflect.DeepEqual(old.(*v1.Namespace).Labels, cur.(*v1.Namespace).Labels) {
+				c.push(cur, model.EventUpdate)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			c.push(obj, model.EventDelete)
+		},
+	})
+	c.elector = leaderelection.NewLeaderElection(pilotNamespace, electionID, client).AddRunFunction(c.lead)
+	return c, nil
+}
+
+// Run runs the controller until the stop channel is closed.
+func (c *Controller) Run(stop <-chan struct{}) {
+	go c.informer.Run(stop)
+	go c.elector.Run(stop)
+	<-stop
+}
+
+// lead reconciles the namespaces on their changes and periodically, until the lease is lost.
+func (c *Controller) lead(stop <-chan struct{}) {
+	if !cache.WaitForCacheSync(stop, c.informer.HasSynced, c.store.HasSynced) {
+		return
+	}
+	log.Infof("leading the onboarding of the namespaces selected by %q", c.opts.Selector)
+	// queue requires a time duration for a retry delay after a handler error
+	queue := kube.NewQueue(1 * time.Second)
+	c.mu.Lock()
+	c.queue = queue
+	c.mu.Unlock()
+	go queue.Run(stop)
+
+	ticker := time.NewTicker(resyncInterval)
+	defer ticker.Stop()
+	for {
+		for _, obj := range c.informer.GetStore().List() {
+			c.push(obj, model.EventUpdate)
+		}
+		select {
+		case <-stop:
+			c.mu.Lock()
+			c.queue = nil
+			c.mu.Unlock()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// push queues the reconciliation of a namespace, when leading.
+func (c *Controller) push(obj interface{}, event model.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.queue != nil {
+		c.queue.Push(kube.NewTask(c.handler.Apply, obj, event))
+	}
+}
+
+// reconcile creates or updates the default configs of the namespace if it is onboarded, and deletes the
+// stamped configs that are not desired anymore.
+func (c *Controller) reconcile(ns *v1.Namespace) error {
+	desired := map[string]model.Config{}
+	if c.opts.Selector.Matches(klabels.Set(ns.Labels)) {
+		for _, cfg := range c.DefaultConfigs(ns.Name) {
+			desired[cfg.Type+"/"+cfg.Name] = cfg
+		}
+	}
+
+	var errs error
+	for _, cfg := range desired {
+		existing := c.store.Get(cfg.Type, cfg.Name, cfg.Namespace)
+		switch {
+		case existing == nil:
+			if _, err := c.store.Create(cfg); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("failed to create %s %s/%s: %v", cfg.Type, cfg.Namespace, cfg.Name, err))
+				continue
+			}
+			log.Infof("onboarded namespace %s with %s %s", cfg.Namespace, cfg.Type, cfg.Name)
+		case existing.Labels[ManagedByLabel] != managedBy:
+			log.Debugf("skipping %s %s/%s owned by the user", cfg.Type, cfg.Namespace, cfg.Name)
+		case !proto.Equal(existing.Spec, cfg.Spec) || !reflect.DeepEqual(existing.Labels, cfg.Labels):
+			cfg.ResourceVersion = existing.ResourceVersion
+			if _, err := c.store.Update(cfg); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("failed to update %s %s/%s: %v", cfg.Type, cfg.Namespace, cfg.Name, err))
+			}
+		}
+	}
+
+	for _, typ := range c.types {
+		configs, err := c.store.List(typ, ns.Name)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		for _, cfg := range configs {
+			if _, f := desired[cfg.Type+"/"+cfg.Name]; f || cfg.Labels[ManagedByLabel] != managedBy {
+				continue
+			}
+			if err := c.store.Delete(cfg.Type, cfg.Name, cfg.Namespace); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("failed to delete %s %s/%s: %v", cfg.Type, cfg.Namespace, cfg.Name, err))
+				continue
+			}
+			log.Infof("deleted %s %s/%s no longer stamped", cfg.Type, cfg.Namespace, cfg.Name)
+		}
+	}
+	return errs
+}
+
+// DefaultConfigs returns the default configs of an onboarded namespace. The default Sidecar only allows the
+// services of the namespace, of the control plane and of the shared namespaces.
+func (c *Controller) DefaultConfigs(namespace string) []model.Config {
+	hosts := []string{"./*", c.pilotNamespace + "/*"}
+	for _, shared := range c.opts.SharedNamespaces {
+		if shared != namespace && !contains(hosts, shared+"/*") {
+			hosts = append(hosts, shared+"/*")
+		}
+	}
+	out := []model.Config{
+		stamp(defaultConfig(schemas.Sidecar, DefaultSidecarName, &networking.Sidecar{
+			Egress: []*networking.IstioEgressListener{{Hosts: hosts}},
+			OutboundTrafficPolicy: &networking.OutboundTrafficPolicy{
+				Mode: networking.OutboundTrafficPolicy_REGISTRY_ONLY,
+			},
+		}), namespace),
+	}
+	if c.opts.DefaultDeny {
+		// A policy without rules matches all the workloads of the namespace, and allows no request.
+		out = append(out, stamp(defaultConfig(schemas.AuthorizationPolicy, DefaultDenyName, &authz.AuthorizationPolicy{}), namespace))
+	}
+	for _, cfg := range c.template {
+		out = append(out, stamp(cfg, namespace))
+	}
+	return out
+}
+
+// stamp returns a copy of the config in the namespace, labeled as managed by the controller.
+func stamp(cfg model.Config, namespace string) model.Config {
+	labels := map[string]string{}
+	for k, v := range cfg.Labels {
+		labels[k] = v
+	}
+	labels[ManagedByLabel] = managedBy
+	return model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:        cfg.Type,
+			Group:       cfg.Group,
+			Version:     cfg.Version,
+			Name:        cfg.Name,
+			Namespace:   namespace,
+			Labels:      labels,
+			Annotations: cfg.Annotations,
+		},
+		Spec: cfg.Spec,
+	}
+}
+
+func defaultConfig(s schema.Instance, name string, spec proto.Message) model.Config {
+	return model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:    s.Type,
+			Group:   s.Group,
+			Version: s.Version,
+			Name:    name,
+		},
+		Spec: spec,
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onboarding
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	klabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+const template = `
+apiVersion: networking.istio.io/v1alpha3
+kind: DestinationRule
+metadata:
+  name: default-mtls
+spec:
+  host: "*.local"
+  trafficPolicy:
+    tls:
+      mode: ISTIO_MUTUAL
+`
+
+func TestReconcile(t *testing.T) {
+	store := memory.NewController(memory.Make(schemas.Istio))
+	c, err := NewController(fake.NewSimpleClientset(), store, "istio-system", Options{
+		Selector:         klabels.SelectorFromSet(klabels.Set{"istio-injection": "enabled"}),
+		SharedNamespaces: []string{"shared", "apps"},
+		DefaultDeny:      true,
+		Template:         template,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A Sidecar of the user is left untouched.
+	userSidecar := model.Config{
+		ConfigMeta: model.ConfigMeta{Type: schemas.Sidecar.Type, Name: DefaultSidecarName, Namespace: "legacy"},
+		Spec:       &networking.Sidecar{Egress: []*networking.IstioEgressListener{{Hosts: []string{"*/*"}}}},
+	}
+	if _, err := store.Create(userSidecar); err != nil {
+		t.Fatal(err)
+	}
+
+	ns := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps", Labels: map[string]string{"istio-injection": "enabled"}}}
+	legacy := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "legacy", Labels: map[string]string{"istio-injection": "enabled"}}}
+	for _, n := range []*v1.Namespace{ns, legacy} {
+		if err := c.reconcile(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sidecar := store.Get(schemas.Sidecar.Type, DefaultSidecarName, "apps")
+	if sidecar == nil || sidecar.Labels[ManagedByLabel] != managedBy {
+		t.Fatalf("got sidecar %v", sidecar)
+	}
+	spec := sidecar.Spec.(*networking.Sidecar)
+	if hosts := spec.Egress[0].Hosts; !reflect.DeepEqual(hosts, []string{"./*", "istio-system/*", "shared/*"}) {
+		t.Errorf("got egress hosts %v", hosts)
+	}
+	if spec.OutboundTrafficPolicy.Mode != networking.OutboundTrafficPolicy_REGISTRY_ONLY {
+		t.Errorf("got outbound traffic policy %v", spec.OutboundTrafficPolicy)
+	}
+	if store.Get(schemas.AuthorizationPolicy.Type, DefaultDenyName, "apps") == nil {
+		t.Error("default deny policy not stamped")
+	}
+	if store.Get(schemas.DestinationRule.Type, "default-mtls", "apps") == nil {
+		t.Error("template not stamped")
+	}
+	if got := store.Get(schemas.Sidecar.Type, DefaultSidecarName, "legacy"); got == nil || got.Labels[ManagedByLabel] != "" {
+		t.Errorf("sidecar of the user overwritten: %v", got)
+	}
+
+	// Reconciling again is a no-op.
+	version := sidecar.ResourceVersion
+	if err := c.reconcile(ns); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Get(schemas.Sidecar.Type, DefaultSidecarName, "apps"); got.ResourceVersion != version {
+		t.Error("sidecar updated without changes")
+	}
+
+	// The stamped configs are deleted when the namespace leaves the mesh.
+	ns.Labels = nil
+	legacy.Labels = nil
+	for _, n := range []*v1.Namespace{ns, legacy} {
+		if err := c.reconcile(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, typ := range []string{schemas.Sidecar.Type, schemas.AuthorizationPolicy.Type, schemas.DestinationRule.Type} {
+		if configs, _ := store.List(typ, "apps"); len(configs) != 0 {
+			t.Errorf("%s not deleted: %v", typ, configs)
+		}
+	}
+	if store.Get(schemas.Sidecar.Type, DefaultSidecarName, "legacy") == nil {
+		t.Error("sidecar of the user deleted")
+	}
+}
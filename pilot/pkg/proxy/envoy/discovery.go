@@ -99,6 +99,16 @@ type DiscoveryServiceOptions struct {
 	// "" means disabling secure GRPC, used in test.
 	SecureGrpcAddr string
 
+	// The listening address for the HTTPS server presenting the self-signed certificate of the DNS names of Pilot.
+	// "" means disabling it. It is only started when the self-signed certificates are provisioned.
+	HTTPSAddr string
+
+	// The path of the Unix domain socket serving GRPC, e.g. to the node-local agents. "" means disabling it.
+	GrpcUDSPath string
+
+	// GrpcUDSPlaintext serves GRPC in plain text on the Unix domain socket, rather than with mTLS.
+	GrpcUDSPlaintext bool
+
 	// The listening address for the monitoring port. If the port in the address is empty or "0" (as in "127.0.0.1:" or "[::1]:0")
 	// a port number is automatically chosen.
 	MonitoringAddr string
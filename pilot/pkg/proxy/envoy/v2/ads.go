@@ -23,6 +23,7 @@ import (
 	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	ads "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	ot "github.com/opentracing/opentracing-go"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/peer"
@@ -86,6 +87,10 @@ type XdsConnection struct {
 	RouteConfigs map[string]*xdsapi.RouteConfiguration `json:"-"`
 	CDSClusters  []*xdsapi.Cluster
 
+	// pinnedListeners are the filter chains of the outbound listeners of the drain exempted ports, by
+	// listener name, as first pushed to the proxy. Only accessed by the goroutine of the connection.
+	pinnedListeners map[string]*pinnedListener
+
 	// Last nonce sent and ack'd (timestamps) used for debugging
 	ClusterNonceSent, ClusterNonceAcked   string
 	ListenerNonceSent, ListenerNonceAcked string
@@ -111,6 +116,19 @@ type XdsConnection struct {
 	// added will be true if at least one discovery request was received, and the connection
 	// is added to the map of active.
 	added bool
+
+	// sizes tracks the size of the configuration last sent to the proxy, for debugging.
+	sizes configSizes
+
+	// usage tracks the generated resources influenced by each config in the last push, by xDS type.
+	usage map[string]configUsage
+
+	// pushSpan traces the push being sent to the proxy, nil when answering requests.
+	pushSpan ot.Span
+
+	// drain is closed to close the connection when the server drains, for the proxy to reconnect to
+	// another instance.
+	drain chan struct{}
 }
 
 // XdsEvent represents a config or registry event that results in a push.
@@ -133,6 +151,9 @@ type XdsEvent struct {
 	done func()
 
 	noncePrefix string
+
+	// span traces the push, nil if not traced.
+	span ot.Span
 }
 
 func newXdsConnection(peerAddr string, stream DiscoveryStream) *XdsConnection {
@@ -144,6 +165,7 @@ func newXdsConnection(peerAddr string, stream DiscoveryStream) *XdsConnection {
 		stream:       stream,
 		LDSListeners: []*xdsapi.Listener{},
 		RouteConfigs: map[string]*xdsapi.RouteConfiguration{},
+		drain:        make(chan struct{}),
 	}
 }
 
@@ -182,6 +204,11 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscove
 
 	t0 := time.Now()
 
+	if err := s.admitDuringDrain(); err != nil {
+		adsLog.Infof("ADS: rejecting connection of %s: %v", peerAddr, err)
+		return err
+	}
+
 	// first call - lazy loading, in tests. This should not happen if readiness
 	// check works, since it assumes ClearCache is called (and as such PushContext
 	// is initialized)
@@ -209,6 +236,12 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscove
 	reqChannel := make(chan *xdsapi.DiscoveryRequest, 1)
 	go receiveThread(con, reqChannel, &receiveError)
 
+	var certExpired <-chan time.Time
+	if timer := clientCertTimer(stream.Context()); timer != nil {
+		defer timer.Stop()
+		certExpired = timer.C
+	}
+
 	for {
 		// Block until either a request is received or a push is triggered.
 		select {
@@ -400,6 +433,12 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscove
 			if err != nil {
 				return nil
 			}
+		case <-con.drain:
+			adsLog.Infof("ADS: closing connection %s of %s, pilot is draining", con.ConID, peerAddr)
+			return status.Error(codes.Unavailable, "pilot is draining, reconnect to another instance")
+		case <-certExpired:
+			adsLog.Infof("ADS: closing connection %s of %s, its client certificate expired", con.ConID, peerAddr)
+			return status.Error(codes.Unavailable, "the client certificate expired, reconnect with the rotated certificate")
 		}
 	}
 }
@@ -442,42 +481,68 @@ func (s *DiscoveryServer) initConnectionNode(node *core.Node, con *XdsConnection
 	if err != nil {
 		return err
 	}
+	if err := InitProxy(s.Env, s.globalPushContext(), nt, node.Locality); err != nil {
+		return err
+	}
+	if features.GatewayOnly.Get() && nt.Type == model.SidecarProxy {
+		adsLog.Warnf("ADS: rejecting connection of sidecar %s, pilot serves only gateways", node.Id)
+		return status.Errorf(codes.FailedPrecondition, "pilot serves only gateways, %s is enabled", features.GatewayOnly.Name)
+	}
+	if nt.IsDebugProxy() {
+		if err := authorizeDebugProxy(con.stream.Context()); err != nil {
+			adsLog.Warnf("ADS: rejecting debug proxy %s: %v", node.Id, err)
+			return err
+		}
+	}
+	if err := admitConnection(nt); err != nil {
+		adsLog.Warnf("ADS: rejecting connection of %s: %v", node.Id, err)
+		return err
+	}
+
+	// The EnvoyFilters patching the generated resources are recorded for /debug/config_usagez.
+	nt.EnvoyFilterUsage = model.NewEnvoyFilterUsage()
+
+	con.mu.Lock()
+	con.node = nt
+	if con.ConID == "" {
+		// first request
+		con.ConID = connectionID(node.Id)
+	}
+	con.mu.Unlock()
+
+	return nil
+}
+
+// InitProxy sets the config namespace, service instances, locality, workload labels, sidecar scope and gateways
+// of a proxy parsed from its node ID and metadata. The locality is used if the registry doesn't define one.
+func InitProxy(env *model.Environment, push *model.PushContext, proxy *model.Proxy, locality *core.Locality) error {
 	// Update the config namespace associated with this proxy
-	nt.ConfigNamespace = model.GetProxyConfigNamespace(nt)
+	proxy.ConfigNamespace = model.GetProxyConfigNamespace(proxy)
 
-	if err := nt.SetServiceInstances(s.Env); err != nil {
+	if err := proxy.SetServiceInstances(env); err != nil {
 		return err
 	}
 
 	// Get the locality from the proxy's service instances.
 	// We expect all instances to have the same IP and therefore the same locality. So its enough to look at the first instance
-	if len(nt.ServiceInstances) > 0 {
-		nt.Locality = util.ConvertLocality(nt.ServiceInstances[0].GetLocality())
+	if len(proxy.ServiceInstances) > 0 {
+		proxy.Locality = util.ConvertLocality(proxy.ServiceInstances[0].GetLocality())
 	}
 
 	// If there is no locality in the registry then use the one sent as part of the discovery request.
 	// This is not preferable as only the connected Pilot is aware of this proxies location, but it
 	// can still help provide some client-side Envoy context when load balancing based on location.
-	if util.IsLocalityEmpty(nt.Locality) {
-		nt.Locality = node.Locality
+	if util.IsLocalityEmpty(proxy.Locality) {
+		proxy.Locality = locality
 	}
 
-	if err := nt.SetWorkloadLabels(s.Env); err != nil {
+	if err := proxy.SetWorkloadLabels(env); err != nil {
 		return err
 	}
 
 	// Set the sidecarScope and merged gateways associated with this proxy
-	nt.SetSidecarScope(s.globalPushContext())
-	nt.SetGatewaysForProxy(s.globalPushContext())
-
-	con.mu.Lock()
-	con.node = nt
-	if con.ConID == "" {
-		// first request
-		con.ConID = connectionID(node.Id)
-	}
-	con.mu.Unlock()
-
+	proxy.SetSidecarScope(push)
+	proxy.SetGatewaysForProxy(push)
 	return nil
 }
 
@@ -488,7 +553,14 @@ func (s *DiscoveryServer) DeltaAggregatedResources(stream ads.AggregatedDiscover
 
 // Compute and send the new configuration for a connection. This is blocking and may be slow
 // for large configs. The method will hold a lock on con.pushMutex.
-func (s *DiscoveryServer) pushConnection(con *XdsConnection, pushEv *XdsEvent) error {
+func (s *DiscoveryServer) pushConnection(con *XdsConnection, pushEv *XdsEvent) (err error) {
+	span := startProxyPushSpan(con, pushEv)
+	con.pushSpan = span
+	defer func() {
+		con.pushSpan = nil
+		finishSpan(span, err)
+	}()
+
 	// TODO: update the service deps based on NetworkScope
 
 	if pushEv.edsUpdatedServices != nil {
@@ -582,7 +654,7 @@ func (s *DiscoveryServer) ProxyUpdate(clusterID, ip string) {
 
 	adsClientsMutex.RLock()
 	for _, v := range adsClients {
-		if v.node.ClusterID == clusterID && v.node.IPAddresses[0] == ip {
+		if (clusterID == "" || v.node.ClusterID == clusterID) && v.node.IPAddresses[0] == ip {
 			connection = v
 			break
 		}
@@ -785,6 +857,9 @@ func (conn *XdsConnection) send(res *xdsapi.DiscoveryResponse) error {
 		if res.TypeUrl == RouteType {
 			conn.RouteVersionInfoSent = res.VersionInfo
 		}
+		if err == nil {
+			conn.recordConfigSize(res)
+		}
 		conn.mu.Unlock()
 	}()
 	select {
@@ -0,0 +1,119 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+// BlueGreenStatus is the status of the blue/green deployment of the host of a destination rule.
+type BlueGreenStatus struct {
+	DestinationRule   string `json:"destinationRule"`
+	Host              string `json:"host"`
+	Active            string `json:"active,omitempty"`
+	Inactive          string `json:"inactive,omitempty"`
+	ActiveEndpoints   int    `json:"activeEndpoints"`
+	InactiveEndpoints int    `json:"inactiveEndpoints"`
+	// InactiveReady is true if the inactive subset has ready endpoints, so it can be promoted.
+	InactiveReady bool `json:"inactiveReady"`
+	// Error is set if the blue/green annotations of the destination rule are invalid.
+	Error string `json:"error,omitempty"`
+}
+
+// blueGreenStatus returns the status of the blue/green deployment of the destination rule, or nil if there is none.
+func (s *DiscoveryServer) blueGreenStatus(rule *model.Config) *BlueGreenStatus {
+	blueGreen, err := model.ParseBlueGreen(rule)
+	if blueGreen == nil && err == nil {
+		return nil
+	}
+	spec := rule.Spec.(*networking.DestinationRule)
+	hostname := model.ResolveShortnameToFQDN(spec.Host, rule.ConfigMeta)
+	out := &BlueGreenStatus{
+		DestinationRule: rule.Namespace + "/" + rule.Name,
+		Host:            string(hostname),
+	}
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	out.Active = blueGreen.Active
+	out.Inactive = blueGreen.Inactive
+
+	subsetLabels := make(map[string]labels.Instance, len(spec.Subsets))
+	for _, subset := range spec.Subsets {
+		subsetLabels[subset.Name] = subset.Labels
+	}
+	out.ActiveEndpoints = s.countSubsetEndpoints(string(hostname), subsetLabels[blueGreen.Active])
+	out.InactiveEndpoints = s.countSubsetEndpoints(string(hostname), subsetLabels[blueGreen.Inactive])
+	out.InactiveReady = out.InactiveEndpoints > 0
+	return out
+}
+
+// countSubsetEndpoints counts the ready endpoints of the service with the subset labels, across the namespaces
+// and the registries.
+func (s *DiscoveryServer) countSubsetEndpoints(hostname string, subset labels.Instance) int {
+	count := 0
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, shards := range s.EndpointShardsByService[hostname] {
+		shards.mutex.RLock()
+		for _, endpoints := range shards.Shards {
+			for _, ep := range endpoints {
+				if subset.SubsetOf(ep.Labels) {
+					count++
+				}
+			}
+		}
+		shards.mutex.RUnlock()
+	}
+	return count
+}
+
+// blueGreenz reports the active and inactive subsets of the blue/green deployments and whether the inactive
+// subsets have ready endpoints, before they are promoted by flipping the ActiveSubsetAnnotation. It is mapped
+// to /debug/bluegreenz.
+func (s *DiscoveryServer) blueGreenz(w http.ResponseWriter, _ *http.Request) {
+	rules, err := s.Env.IstioConfigStore.List(schemas.DestinationRule.Type, model.NamespaceAll)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	statuses := make([]*BlueGreenStatus, 0)
+	for i := range rules {
+		if status := s.blueGreenStatus(&rules[i]); status != nil {
+			statuses = append(statuses, status)
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].DestinationRule < statuses[j].DestinationRule })
+
+	out, err := json.MarshalIndent(statuses, "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(out)
+}
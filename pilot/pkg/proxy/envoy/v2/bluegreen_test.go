@@ -0,0 +1,84 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"reflect"
+	"testing"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestBlueGreenStatus(t *testing.T) {
+	s := &DiscoveryServer{
+		EndpointShardsByService: map[string]map[string]*EndpointShards{
+			"reviews.default.svc.cluster.local": {
+				"default": {
+					Shards: map[string][]*model.IstioEndpoint{
+						"Kubernetes": {
+							{Address: "10.0.0.1", Labels: map[string]string{"app": "reviews", "version": "blue"}},
+							{Address: "10.0.0.2", Labels: map[string]string{"app": "reviews", "version": "blue"}},
+							{Address: "10.0.0.3", Labels: map[string]string{"app": "reviews", "version": "green"}},
+						},
+					},
+				},
+			},
+		},
+	}
+	rule := func(annotations map[string]string) *model.Config {
+		return &model.Config{
+			ConfigMeta: model.ConfigMeta{Name: "reviews", Namespace: "default", Domain: "cluster.local", Annotations: annotations},
+			Spec: &networking.DestinationRule{
+				Host: "reviews",
+				Subsets: []*networking.Subset{
+					{Name: "blue", Labels: map[string]string{"version": "blue"}},
+					{Name: "green", Labels: map[string]string{"version": "green"}},
+					{Name: "red", Labels: map[string]string{"version": "red"}},
+				},
+			},
+		}
+	}
+
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		expected    *BlueGreenStatus
+	}{
+		{
+			name: "no blue/green deployment",
+		},
+		{
+			name:        "inactive subset ready",
+			annotations: map[string]string{model.BlueGreenSubsetsAnnotation: "blue,green", model.ActiveSubsetAnnotation: "blue"},
+			expected: &BlueGreenStatus{DestinationRule: "default/reviews", Host: "reviews.default.svc.cluster.local",
+				Active: "blue", Inactive: "green", ActiveEndpoints: 2, InactiveEndpoints: 1, InactiveReady: true},
+		},
+		{
+			name:        "inactive subset not ready",
+			annotations: map[string]string{model.BlueGreenSubsetsAnnotation: "blue,red", model.ActiveSubsetAnnotation: "blue"},
+			expected: &BlueGreenStatus{DestinationRule: "default/reviews", Host: "reviews.default.svc.cluster.local",
+				Active: "blue", Inactive: "red", ActiveEndpoints: 2},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.blueGreenStatus(rule(tt.annotations)); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("blueGreenStatus() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/cluster"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// maxCircuitBreakerOverrideTTL bounds the lifetime of an override, which is meant to relieve an
+// overload during an incident, not to replace the DestinationRules.
+const maxCircuitBreakerOverrideTTL = 24 * time.Hour
+
+// CircuitBreakerOverride temporarily overrides the default circuit breaker thresholds of a cluster of
+// a proxy. The thresholds not set keep the value generated from the DestinationRules.
+type CircuitBreakerOverride struct {
+	ProxyID            string  `json:"proxyID"`
+	Cluster            string  `json:"cluster"`
+	MaxConnections     *uint32 `json:"maxConnections,omitempty"`
+	MaxPendingRequests *uint32 `json:"maxPendingRequests,omitempty"`
+	MaxRequests        *uint32 `json:"maxRequests,omitempty"`
+	MaxRetries         *uint32 `json:"maxRetries,omitempty"`
+	// TTL is the lifetime of the override, as a duration string such as "10m".
+	TTL string `json:"ttl,omitempty"`
+	// Expires is the time the override is removed, set by Pilot.
+	Expires time.Time `json:"expires"`
+
+	timer *time.Timer
+}
+
+// circuitBreakerOverrides holds the active overrides, by proxy ID then cluster name.
+type circuitBreakerOverrides struct {
+	mu      sync.RWMutex
+	byProxy map[string]map[string]*CircuitBreakerOverride
+}
+
+func newCircuitBreakerOverrides() *circuitBreakerOverrides {
+	return &circuitBreakerOverrides{byProxy: map[string]map[string]*CircuitBreakerOverride{}}
+}
+
+// set adds or replaces an override, calling expire once its TTL elapsed.
+func (o *circuitBreakerOverrides) set(override *CircuitBreakerOverride, ttl time.Duration, expire func()) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.byProxy[override.ProxyID] == nil {
+		o.byProxy[override.ProxyID] = map[string]*CircuitBreakerOverride{}
+	}
+	if previous := o.byProxy[override.ProxyID][override.Cluster]; previous != nil {
+		previous.timer.Stop()
+	}
+	override.Expires = time.Now().Add(ttl)
+	override.timer = time.AfterFunc(ttl, func() {
+		if o.remove(override.ProxyID, override.Cluster, override) {
+			expire()
+		}
+	})
+	o.byProxy[override.ProxyID][override.Cluster] = override
+}
+
+// remove removes the override of the cluster of the proxy, only if it is the given one when not nil.
+func (o *circuitBreakerOverrides) remove(proxyID, clusterName string, override *CircuitBreakerOverride) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	current := o.byProxy[proxyID][clusterName]
+	if current == nil || (override != nil && current != override) {
+		return false
+	}
+	current.timer.Stop()
+	delete(o.byProxy[proxyID], clusterName)
+	if len(o.byProxy[proxyID]) == 0 {
+		delete(o.byProxy, proxyID)
+	}
+	return true
+}
+
+// list returns the active overrides, sorted by proxy and cluster.
+func (o *circuitBreakerOverrides) list() []*CircuitBreakerOverride {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	out := make([]*CircuitBreakerOverride, 0)
+	for _, clusters := range o.byProxy {
+		for _, override := range clusters {
+			out = append(out, override)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ProxyID != out[j].ProxyID {
+			return out[i].ProxyID < out[j].ProxyID
+		}
+		return out[i].Cluster < out[j].Cluster
+	})
+	return out
+}
+
+// apply returns the clusters with the overrides of the proxy applied. The overridden clusters are
+// copied, the generated clusters may be shared with other proxies.
+func (o *circuitBreakerOverrides) apply(proxyID string, clusters []*xdsapi.Cluster) []*xdsapi.Cluster {
+	if o == nil {
+		return clusters
+	}
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	overrides := o.byProxy[proxyID]
+	if len(overrides) == 0 {
+		return clusters
+	}
+
+	out := make([]*xdsapi.Cluster, 0, len(clusters))
+	for _, c := range clusters {
+		if override, f := overrides[c.Name]; f {
+			c = proto.Clone(c).(*xdsapi.Cluster)
+			applyCircuitBreakerOverride(c, override)
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func applyCircuitBreakerOverride(c *xdsapi.Cluster, override *CircuitBreakerOverride) {
+	if c.CircuitBreakers == nil {
+		c.CircuitBreakers = &cluster.CircuitBreakers{}
+	}
+	var thresholds *cluster.CircuitBreakers_Thresholds
+	for _, t := range c.CircuitBreakers.Thresholds {
+		if t.Priority == 0 {
+			thresholds = t
+		}
+	}
+	if thresholds == nil {
+		thresholds = &cluster.CircuitBreakers_Thresholds{}
+		c.CircuitBreakers.Thresholds = append(c.CircuitBreakers.Thresholds, thresholds)
+	}
+	if override.MaxConnections != nil {
+		thresholds.MaxConnections = &wrappers.UInt32Value{Value: *override.MaxConnections}
+	}
+	if override.MaxPendingRequests != nil {
+		thresholds.MaxPendingRequests = &wrappers.UInt32Value{Value: *override.MaxPendingRequests}
+	}
+	if override.MaxRequests != nil {
+		thresholds.MaxRequests = &wrappers.UInt32Value{Value: *override.MaxRequests}
+	}
+	if override.MaxRetries != nil {
+		thresholds.MaxRetries = &wrappers.UInt32Value{Value: *override.MaxRetries}
+	}
+}
+
+// pushProxy triggers a full push to the connections of the proxy to this Pilot.
+func (s *DiscoveryServer) pushProxy(proxyID string) bool {
+	adsClientsMutex.RLock()
+	connections := make([]*XdsConnection, 0, len(adsSidecarIDConnectionsMap[proxyID]))
+	for _, con := range adsSidecarIDConnectionsMap[proxyID] {
+		connections = append(connections, con)
+	}
+	adsClientsMutex.RUnlock()
+
+	for _, con := range connections {
+		s.pushQueue.Enqueue(con, &model.PushRequest{
+			Full:  true,
+			Push:  s.globalPushContext(),
+			Start: time.Now(),
+		})
+	}
+	return len(connections) > 0
+}
+
+// cbOverridez lists the circuit breaker overrides with GET, sets one with POST and removes one with
+// DELETE, given the proxyID and cluster query parameters. The overrides are pushed to the proxies
+// right away, and removed once their TTL elapsed. Setting and removing an override requires a verified client
+// certificate with one of the identities of PILOT_DEBUG_PROXY_IDENTITIES, so the overrides are read-only on the
+// plain text debug port.
+func (s *DiscoveryServer) cbOverridez(w http.ResponseWriter, req *http.Request) {
+	if s.cbOverrides == nil {
+		http.Error(w, "Circuit breaker overrides are not supported", http.StatusNotImplemented)
+		return
+	}
+	if req.Method != http.MethodGet && !debugIdentityAllowed(verifiedIdentities(req.TLS)) {
+		http.Error(w, "the client identity is not allowed to override circuit breakers, see "+
+			features.DebugProxyIdentities.Name, http.StatusForbidden)
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+		writeCircuitBreakerJSON(w, s.cbOverrides.list())
+	case http.MethodPost:
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		override := &CircuitBreakerOverride{}
+		if err := json.Unmarshal(body, override); err != nil {
+			http.Error(w, fmt.Sprintf("invalid override: %v", err), http.StatusBadRequest)
+			return
+		}
+		ttl, err := validateCircuitBreakerOverride(override)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		adsClientsMutex.RLock()
+		_, connected := adsSidecarIDConnectionsMap[override.ProxyID]
+		adsClientsMutex.RUnlock()
+		if !connected {
+			http.Error(w, "Proxy not connected to this Pilot instance", http.StatusNotFound)
+			return
+		}
+		proxyID := override.ProxyID
+		s.cbOverrides.set(override, ttl, func() {
+			adsLog.Infof("Circuit breaker override of %s for %s expired", override.Cluster, proxyID)
+			s.pushProxy(proxyID)
+		})
+		adsLog.Infof("Circuit breaker override of %s for %s set for %v", override.Cluster, proxyID, ttl)
+		s.pushProxy(proxyID)
+		writeCircuitBreakerJSON(w, override)
+	case http.MethodDelete:
+		proxyID, clusterName := req.URL.Query().Get("proxyID"), req.URL.Query().Get("cluster")
+		if !s.cbOverrides.remove(proxyID, clusterName, nil) {
+			http.Error(w, "No override of this cluster for this proxy", http.StatusNotFound)
+			return
+		}
+		s.pushProxy(proxyID)
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "Only GET, POST and DELETE are supported", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeCircuitBreakerJSON(w http.ResponseWriter, v interface{}) {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(out)
+}
+
+func validateCircuitBreakerOverride(override *CircuitBreakerOverride) (time.Duration, error) {
+	if override.ProxyID == "" || override.Cluster == "" {
+		return 0, fmt.Errorf("proxyID and cluster are required")
+	}
+	if override.MaxConnections == nil && override.MaxPendingRequests == nil &&
+		override.MaxRequests == nil && override.MaxRetries == nil {
+		return 0, fmt.Errorf("at least one threshold must be set")
+	}
+	ttl, err := time.ParseDuration(override.TTL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ttl %q: %v", override.TTL, err)
+	}
+	if ttl <= 0 || ttl > maxCircuitBreakerOverrideTTL {
+		return 0, fmt.Errorf("ttl must be positive and at most %v", maxCircuitBreakerOverrideTTL)
+	}
+	return ttl, nil
+}
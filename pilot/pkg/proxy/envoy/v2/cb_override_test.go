@@ -0,0 +1,111 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/cluster"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+func TestCircuitBreakerOverrides(t *testing.T) {
+	maxRequests := uint32(5000)
+	shared := &xdsapi.Cluster{
+		Name: "outbound|9080||reviews.default.svc.cluster.local",
+		CircuitBreakers: &cluster.CircuitBreakers{Thresholds: []*cluster.CircuitBreakers_Thresholds{{
+			MaxConnections: &wrappers.UInt32Value{Value: 10},
+			MaxRequests:    &wrappers.UInt32Value{Value: 100},
+		}}},
+	}
+	other := &xdsapi.Cluster{Name: "outbound|9080||ratings.default.svc.cluster.local"}
+
+	overrides := newCircuitBreakerOverrides()
+	expired := make(chan struct{})
+	overrides.set(&CircuitBreakerOverride{ProxyID: "productpage.default", Cluster: shared.Name, MaxRequests: &maxRequests},
+		50*time.Millisecond, func() { close(expired) })
+
+	got := overrides.apply("productpage.default", []*xdsapi.Cluster{shared, other})
+	thresholds := got[0].CircuitBreakers.Thresholds[0]
+	if thresholds.MaxRequests.Value != maxRequests || thresholds.MaxConnections.Value != 10 {
+		t.Errorf("got thresholds %v, want max requests overridden and max connections kept", thresholds)
+	}
+	if got[1] != other {
+		t.Errorf("got cluster %v copied, want it untouched", got[1])
+	}
+	if shared.CircuitBreakers.Thresholds[0].MaxRequests.Value != 100 {
+		t.Errorf("the generated cluster was modified: %v", shared)
+	}
+	if got := overrides.apply("reviews.default", []*xdsapi.Cluster{shared}); got[0] != shared {
+		t.Errorf("got cluster %v overridden for another proxy", got[0])
+	}
+
+	select {
+	case <-expired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the override did not expire")
+	}
+	if len(overrides.list()) != 0 {
+		t.Errorf("got overrides %v after expiry, want none", overrides.list())
+	}
+}
+
+func TestValidateCircuitBreakerOverride(t *testing.T) {
+	maxRetries := uint32(3)
+	cases := []struct {
+		name     string
+		override *CircuitBreakerOverride
+		valid    bool
+	}{
+		{"valid", &CircuitBreakerOverride{ProxyID: "a.default", Cluster: "c", MaxRetries: &maxRetries, TTL: "10m"}, true},
+		{"no cluster", &CircuitBreakerOverride{ProxyID: "a.default", MaxRetries: &maxRetries, TTL: "10m"}, false},
+		{"no threshold", &CircuitBreakerOverride{ProxyID: "a.default", Cluster: "c", TTL: "10m"}, false},
+		{"no ttl", &CircuitBreakerOverride{ProxyID: "a.default", Cluster: "c", MaxRetries: &maxRetries}, false},
+		{"ttl too long", &CircuitBreakerOverride{ProxyID: "a.default", Cluster: "c", MaxRetries: &maxRetries, TTL: "48h"}, false},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validateCircuitBreakerOverride(tt.override)
+			if (err == nil) != tt.valid {
+				t.Errorf("got error %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerOverridezAuthorization(t *testing.T) {
+	s := &DiscoveryServer{cbOverrides: newCircuitBreakerOverrides()}
+	body := `{"proxyID": "productpage.default", "cluster": "outbound|9080||reviews.default.svc.cluster.local", ` +
+		`"maxRequests": 5000, "ttl": "10m"}`
+	w := httptest.NewRecorder()
+	s.cbOverridez(w, httptest.NewRequest(http.MethodPost, "/debug/cb_overridez", strings.NewReader(body)))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got status %d setting an override without a client certificate, want %d", w.Code, http.StatusForbidden)
+	}
+	if len(s.cbOverrides.list()) != 0 {
+		t.Errorf("got overrides %v set without a client certificate", s.cbOverrides.list())
+	}
+
+	w = httptest.NewRecorder()
+	s.cbOverridez(w, httptest.NewRequest(http.MethodGet, "/debug/cb_overridez", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("got status %d listing the overrides, want %d", w.Code, http.StatusOK)
+	}
+}
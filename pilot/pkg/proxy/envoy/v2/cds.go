@@ -19,6 +19,7 @@ import (
 
 	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
 )
@@ -48,38 +49,48 @@ func (conn *XdsConnection) clusters(response []*xdsapi.Cluster, noncePrefix stri
 func (s *DiscoveryServer) pushCds(con *XdsConnection, push *model.PushContext, version string) error {
 	// TODO: Modify interface to take services, and config instead of making library query registry
 	pushStart := time.Now()
+	span := con.startSpan("cds.generate")
 	rawClusters := s.generateRawClusters(con.node, push)
+	span.SetTag("clusters", len(rawClusters))
+	finishSpan(span, nil)
 
 	if s.DebugConfigs {
 		con.CDSClusters = rawClusters
 	}
+	con.recordClusterSizes(rawClusters, push)
+	con.recordClusterUsage(rawClusters)
 	response := con.clusters(rawClusters, push.Version)
+	span = con.startSpan("cds.send")
 	err := con.send(response)
+	finishSpan(span, err)
 	cdsPushTime.Record(time.Since(pushStart).Seconds())
 	if err != nil {
-		adsLog.Warnf("CDS: Send failure %s: %v", con.ConID, err)
+		cdsLog.Warnf("CDS: Send failure %s: %v", pushLogFields(con, version), err)
 		recordSendError(cdsSendErrPushes, err)
 		return err
 	}
 	cdsPushes.Increment()
 
 	// The response can't be easily read due to 'any' marshaling.
-	adsLog.Infof("CDS: PUSH for node:%s clusters:%d services:%d version:%s",
-		con.node.ID, len(rawClusters), len(push.Services(nil)), version)
+	cdsLog.Infof("CDS: PUSH %s clusters:%d services:%d",
+		pushLogFields(con, version), len(rawClusters), len(push.Services(nil)))
 	return nil
 }
 
 func (s *DiscoveryServer) generateRawClusters(node *model.Proxy, push *model.PushContext) []*xdsapi.Cluster {
-	rawClusters := s.ConfigGenerator.BuildClusters(s.Env, node, push)
+	rawClusters := s.cbOverrides.apply(node.ID, s.ConfigGenerator.BuildClusters(s.Env, node, push))
 
 	for _, c := range rawClusters {
 		if err := c.Validate(); err != nil {
-			adsLog.Errorf("CDS: Generated invalid cluster for node:%s: %v, %v", node.ID, err, c)
+			cdsLog.Errorf("CDS: Generated invalid cluster for node:%s: %v, %v", node.ID, err, c)
 			cdsBuildErrPushes.Increment()
 			totalXDSInternalErrors.Increment()
 			// Generating invalid clusters is a bug.
 			// Instead of panic, which will break down the whole cluster. Just ignore it here, let envoy process it.
 		}
 	}
+	if features.EnableXDSConsistencyCheck.Get() {
+		recordViolations(cdsLog, node, checkClusters(rawClusters))
+	}
 	return rawClusters
 }
@@ -0,0 +1,46 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+func TestClientCertTimer(t *testing.T) {
+	if timer := clientCertTimer(context.Background()); timer != nil {
+		t.Error("got a timer for a connection without peer")
+	}
+
+	cert := &x509.Certificate{NotAfter: time.Now().Add(10 * time.Millisecond)}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}},
+	})
+	timer := clientCertTimer(ctx)
+	if timer == nil {
+		t.Fatal("got no timer for a connection with a client certificate")
+	}
+	select {
+	case <-timer.C:
+	case <-time.After(5 * time.Second):
+		t.Error("timer not fired once the client certificate expired")
+	}
+}
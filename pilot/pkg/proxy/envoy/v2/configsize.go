@@ -0,0 +1,225 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/golang/protobuf/proto"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/host"
+)
+
+const (
+	// defaultConfigSizeTop is the number of proxies reported by /debug/config_sizez by default.
+	defaultConfigSizeTop = 10
+
+	// configSizeTopServices is the number of contributing services reported per proxy.
+	configSizeTopServices = 10
+)
+
+// configSizes tracks the serialized size of the configuration last sent to a proxy.
+type configSizes struct {
+	// byType is the size in bytes of the last response sent, keyed by xDS type.
+	byType map[string]int
+
+	// clustersByService is the size in bytes of the clusters generated for each service in
+	// the last CDS push.
+	clustersByService map[host.Name]*ServiceConfigSize
+
+	// sidecarScope is the name of the Sidecar resource the proxy was configured with, if any.
+	sidecarScope string
+}
+
+// total returns the size in bytes of the configuration of the proxy, across all xDS types.
+func (cs *configSizes) total() int {
+	total := 0
+	for _, size := range cs.byType {
+		total += size
+	}
+	return total
+}
+
+// ProxyConfigSize reports the size of the configuration sent to a proxy.
+type ProxyConfigSize struct {
+	ProxyID      string               `json:"proxy"`
+	SidecarScope string               `json:"sidecar_scope,omitempty"`
+	TotalBytes   int                  `json:"total_bytes"`
+	BytesByType  map[string]int       `json:"bytes_by_type"`
+	TopServices  []*ServiceConfigSize `json:"top_services,omitempty"`
+}
+
+// ServiceConfigSize reports the size of the clusters generated for a service.
+type ServiceConfigSize struct {
+	Hostname     string `json:"hostname"`
+	Namespace    string `json:"namespace,omitempty"`
+	Registry     string `json:"registry,omitempty"`
+	ClusterBytes int    `json:"cluster_bytes"`
+}
+
+// xdsShortType returns the short name of an xDS type URL, as used in metrics.
+func xdsShortType(typeURL string) string {
+	switch typeURL {
+	case ClusterType:
+		return "cds"
+	case ListenerType:
+		return "lds"
+	case RouteType:
+		return "rds"
+	case EndpointType:
+		return "eds"
+	default:
+		return typeURL
+	}
+}
+
+// recordConfigSize records the size of a response successfully sent to the proxy.
+// Must be called with the connection lock held.
+func (conn *XdsConnection) recordConfigSize(res *xdsapi.DiscoveryResponse) {
+	size := proto.Size(res)
+	typ := xdsShortType(res.TypeUrl)
+	configSize.With(typeTag.Value(typ)).Record(float64(size))
+
+	if conn.sizes.byType == nil {
+		conn.sizes.byType = make(map[string]int)
+	}
+	before := conn.sizes.total()
+	conn.sizes.byType[typ] = size
+	after := conn.sizes.total()
+
+	// Only warn when the threshold is crossed, not on every push.
+	threshold := features.ConfigSizeWarningThreshold
+	if threshold > 0 && before <= threshold && after > threshold {
+		configSizeExceeded.Increment()
+		adsLog.Warnf("Configuration for %s is %d bytes, above the %d bytes threshold. "+
+			"Consider a Sidecar resource to trim it; see /debug/config_sizez for the largest contributors",
+			conn.ConID, after, threshold)
+	}
+}
+
+// recordClusterSizes attributes the size of the generated clusters to the services they were
+// built for.
+func (conn *XdsConnection) recordClusterSizes(clusters []*xdsapi.Cluster, push *model.PushContext) {
+	services := make(map[host.Name]*model.Service)
+	for _, svc := range push.Services(conn.node) {
+		services[svc.Hostname] = svc
+	}
+
+	byService := make(map[host.Name]*ServiceConfigSize)
+	for _, c := range clusters {
+		_, _, hostname, _ := model.ParseSubsetKey(c.Name)
+		svc, f := services[hostname]
+		if !f {
+			continue
+		}
+		entry, f := byService[hostname]
+		if !f {
+			entry = &ServiceConfigSize{
+				Hostname:  string(hostname),
+				Namespace: svc.Attributes.Namespace,
+				Registry:  svc.Attributes.ServiceRegistry,
+			}
+			byService[hostname] = entry
+		}
+		entry.ClusterBytes += proto.Size(c)
+	}
+
+	sidecarScope := ""
+	if conn.node.SidecarScope != nil && conn.node.SidecarScope.Config != nil {
+		sidecarScope = conn.node.SidecarScope.Config.Namespace + "/" + conn.node.SidecarScope.Config.Name
+	}
+
+	conn.mu.Lock()
+	conn.sizes.clustersByService = byService
+	conn.sizes.sidecarScope = sidecarScope
+	conn.mu.Unlock()
+}
+
+// configSize returns the size report for the connection, including up to top contributing services.
+func (conn *XdsConnection) configSize(top int) *ProxyConfigSize {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+
+	out := &ProxyConfigSize{
+		ProxyID:      conn.ConID,
+		SidecarScope: conn.sizes.sidecarScope,
+		TotalBytes:   conn.sizes.total(),
+		BytesByType:  make(map[string]int, len(conn.sizes.byType)),
+	}
+	for typ, size := range conn.sizes.byType {
+		out.BytesByType[typ] = size
+	}
+	for _, svc := range conn.sizes.clustersByService {
+		s := *svc
+		out.TopServices = append(out.TopServices, &s)
+	}
+	sort.Slice(out.TopServices, func(i, j int) bool {
+		if out.TopServices[i].ClusterBytes == out.TopServices[j].ClusterBytes {
+			return out.TopServices[i].Hostname < out.TopServices[j].Hostname
+		}
+		return out.TopServices[i].ClusterBytes > out.TopServices[j].ClusterBytes
+	})
+	if len(out.TopServices) > top {
+		out.TopServices = out.TopServices[:top]
+	}
+	return out
+}
+
+// configSizez ranks the connected proxies by the size of their configuration.
+// It is mapped to /debug/config_sizez. The number of proxies reported can be set with ?top=N.
+func configSizez(w http.ResponseWriter, req *http.Request) {
+	top := defaultConfigSizeTop
+	if t := req.URL.Query().Get("top"); t != "" {
+		n, err := strconv.Atoi(t)
+		if err != nil || n <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("invalid top parameter: " + t))
+			return
+		}
+		top = n
+	}
+
+	adsClientsMutex.RLock()
+	sizes := make([]*ProxyConfigSize, 0, len(adsClients))
+	for _, c := range adsClients {
+		sizes = append(sizes, c.configSize(configSizeTopServices))
+	}
+	adsClientsMutex.RUnlock()
+
+	sort.Slice(sizes, func(i, j int) bool {
+		if sizes[i].TotalBytes == sizes[j].TotalBytes {
+			return sizes[i].ProxyID < sizes[j].ProxyID
+		}
+		return sizes[i].TotalBytes > sizes[j].TotalBytes
+	})
+	if len(sizes) > top {
+		sizes = sizes[:top]
+	}
+
+	out, err := json.MarshalIndent(sizes, "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(out)
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/golang/protobuf/proto"
+
+	"istio.io/istio/pkg/config/host"
+)
+
+func TestConfigSize(t *testing.T) {
+	conn := &XdsConnection{ConID: "sidecar~1.1.1.1~a.default~default.svc.cluster.local-1"}
+
+	cds := &xdsapi.DiscoveryResponse{TypeUrl: ClusterType, VersionInfo: "1", Nonce: "cds"}
+	lds := &xdsapi.DiscoveryResponse{TypeUrl: ListenerType, VersionInfo: "1", Nonce: "lds-nonce"}
+	conn.recordConfigSize(cds)
+	conn.recordConfigSize(lds)
+
+	conn.sizes.clustersByService = map[host.Name]*ServiceConfigSize{
+		"a.default.svc.cluster.local": {Hostname: "a.default.svc.cluster.local", ClusterBytes: 10},
+		"b.default.svc.cluster.local": {Hostname: "b.default.svc.cluster.local", ClusterBytes: 30},
+		"c.default.svc.cluster.local": {Hostname: "c.default.svc.cluster.local", ClusterBytes: 20},
+	}
+
+	size := conn.configSize(2)
+	if want := proto.Size(cds) + proto.Size(lds); size.TotalBytes != want {
+		t.Errorf("total bytes => %d, want %d", size.TotalBytes, want)
+	}
+	if size.BytesByType["cds"] != proto.Size(cds) || size.BytesByType["lds"] != proto.Size(lds) {
+		t.Errorf("unexpected bytes by type: %v", size.BytesByType)
+	}
+	if len(size.TopServices) != 2 {
+		t.Fatalf("expected 2 top services, got %d", len(size.TopServices))
+	}
+	if size.TopServices[0].Hostname != "b.default.svc.cluster.local" || size.TopServices[1].Hostname != "c.default.svc.cluster.local" {
+		t.Errorf("services not ranked by size: %s, %s", size.TopServices[0].Hostname, size.TopServices[1].Hostname)
+	}
+
+	// A newer response of the same type replaces the previous size.
+	conn.recordConfigSize(cds)
+	if got := conn.configSize(2).TotalBytes; got != size.TotalBytes {
+		t.Errorf("total bytes after re-push => %d, want %d", got, size.TotalBytes)
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+// configUsage tracks the generated resources influenced by each config in the last push to a proxy, by
+// xDS type. The configs are keyed by type/namespace/name, e.g. virtual-service/default/reviews.
+type configUsage map[string]map[string][]string
+
+// ConfigResources reports the generated resources a config influenced in the last push to the proxies.
+type ConfigResources struct {
+	Config    string `json:"config"`
+	Clusters  int    `json:"clusters"`
+	Routes    int    `json:"routes"`
+	Listeners int    `json:"listeners"`
+	// Unused is true if the config influenced no generated resource, e.g. if it matches no host.
+	Unused bool `json:"unused,omitempty"`
+}
+
+// configKey returns the type/namespace/name key of the config of the istio metadata, of the form
+// /apis/<group>/<version>/namespaces/<namespace>/<type>/<name>, or "" if there is none.
+func configKey(metadata *core.Metadata) string {
+	config := metadata.GetFilterMetadata()[util.IstioMetadataKey].GetFields()["config"].GetStringValue()
+	parts := strings.Split(config, "/")
+	if len(parts) != 8 {
+		return ""
+	}
+	return parts[6] + "/" + parts[5] + "/" + parts[7]
+}
+
+// recordConfigUsage records the configs that influenced the generated resources of the xDS type.
+func (conn *XdsConnection) recordConfigUsage(typ string, resources map[string][]string) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.usage == nil {
+		conn.usage = make(map[string]configUsage)
+	}
+	conn.usage[typ] = resources
+}
+
+// addEnvoyFilterUsage adds the resources of the xDS type patched by the EnvoyFilters, as recorded while they
+// were generated for the proxy of the connection.
+func (conn *XdsConnection) addEnvoyFilterUsage(typ string, resources map[string][]string) {
+	if conn.node == nil {
+		return
+	}
+	for source, patched := range conn.node.EnvoyFilterUsage.Take(typ) {
+		key := schemas.EnvoyFilter.Type + "/" + source
+		resources[key] = append(resources[key], patched...)
+	}
+}
+
+func (conn *XdsConnection) recordClusterUsage(clusters []*xdsapi.Cluster) {
+	resources := make(map[string][]string)
+	for _, c := range clusters {
+		if key := configKey(c.Metadata); key != "" {
+			resources[key] = append(resources[key], c.Name)
+		}
+	}
+	conn.addEnvoyFilterUsage("cds", resources)
+	conn.recordConfigUsage("cds", resources)
+}
+
+func (conn *XdsConnection) recordRouteUsage(routeConfigs []*xdsapi.RouteConfiguration) {
+	resources := make(map[string][]string)
+	for _, rc := range routeConfigs {
+		for _, vh := range rc.VirtualHosts {
+			for _, r := range vh.Routes {
+				if key := configKey(r.Metadata); key != "" {
+					resources[key] = append(resources[key], rc.Name+"/"+vh.Name+"/"+r.Name)
+				}
+			}
+		}
+	}
+	conn.addEnvoyFilterUsage("rds", resources)
+	conn.recordConfigUsage("rds", resources)
+}
+
+// recordListenerUsage records the TCP and TLS virtual services of the filter chains of the listeners, and the
+// EnvoyFilters that patched them.
+func (conn *XdsConnection) recordListenerUsage(listeners []*xdsapi.Listener) {
+	resources := make(map[string][]string)
+	for _, l := range listeners {
+		used := make(map[string]bool)
+		for _, fc := range l.FilterChains {
+			if key := configKey(fc.Metadata); key != "" {
+				used[key] = true
+			}
+		}
+		for key := range used {
+			resources[key] = append(resources[key], l.Name)
+		}
+	}
+	conn.addEnvoyFilterUsage("lds", resources)
+	conn.recordConfigUsage("lds", resources)
+}
+
+// configResources aggregates the generated resources influenced by the configs across the connected proxies.
+// A resource generated for several proxies is counted once per proxy.
+func configResources(configs []model.Config) []*ConfigResources {
+	byKey := make(map[string]*ConfigResources, len(configs))
+	out := make([]*ConfigResources, 0, len(configs))
+	for _, c := range configs {
+		r := &ConfigResources{Config: c.Type + "/" + c.Namespace + "/" + c.Name}
+		byKey[r.Config] = r
+		out = append(out, r)
+	}
+
+	adsClientsMutex.RLock()
+	for _, con := range adsClients {
+		con.mu.RLock()
+		for typ, usage := range con.usage {
+			for key, resources := range usage {
+				r, f := byKey[key]
+				if !f {
+					continue
+				}
+				switch typ {
+				case "cds":
+					r.Clusters += len(resources)
+				case "rds":
+					r.Routes += len(resources)
+				case "lds":
+					r.Listeners += len(resources)
+				}
+			}
+		}
+		con.mu.RUnlock()
+	}
+	adsClientsMutex.RUnlock()
+
+	unused := make(map[string]int)
+	for _, r := range out {
+		r.Unused = r.Clusters == 0 && r.Routes == 0 && r.Listeners == 0
+		if r.Unused {
+			unused[strings.SplitN(r.Config, "/", 2)[0]]++
+		}
+	}
+	for _, typ := range configUsageTypes {
+		unusedConfigs.With(typeTag.Value(typ)).Record(float64(unused[typ]))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Config < out[j].Config })
+	return out
+}
+
+// configUsageTypes are the types of the configs whose influence on the generated resources is tracked.
+var configUsageTypes = []string{schemas.VirtualService.Type, schemas.DestinationRule.Type, schemas.EnvoyFilter.Type}
+
+// usageConfigs lists the configs whose influence on the generated resources is tracked.
+func (s *DiscoveryServer) usageConfigs() ([]model.Config, error) {
+	var configs []model.Config
+	for _, typ := range configUsageTypes {
+		cfgs, err := s.Env.IstioConfigStore.List(typ, model.NamespaceAll)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, cfgs...)
+	}
+	return configs, nil
+}
+
+// recordUnusedConfigs records the number of configs that influenced no generated resource in the last push. It is
+// called once per push.
+func (s *DiscoveryServer) recordUnusedConfigs() {
+	if s.Env == nil || s.Env.IstioConfigStore == nil {
+		return
+	}
+	if configs, err := s.usageConfigs(); err == nil {
+		configResources(configs)
+	}
+}
+
+// configUsagez maps each VirtualService, DestinationRule and EnvoyFilter to the number of clusters, routes
+// and listeners it influenced in the last push to the connected proxies. It is mapped to
+// /debug/config_usagez; ?unused=true lists only the configs that influenced nothing.
+func (s *DiscoveryServer) configUsagez(w http.ResponseWriter, req *http.Request) {
+	configs, err := s.usageConfigs()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	resources := configResources(configs)
+	if req.URL.Query().Get("unused") == "true" {
+		unused := make([]*ConfigResources, 0)
+		for _, r := range resources {
+			if r.Unused {
+				unused = append(unused, r)
+			}
+		}
+		resources = unused
+	}
+
+	out, err := json.MarshalIndent(resources, "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(out)
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"reflect"
+	"testing"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+func TestConfigResources(t *testing.T) {
+	meta := func(typ, name string) model.ConfigMeta {
+		return model.ConfigMeta{
+			Group:     "networking.istio.io",
+			Version:   "v1alpha3",
+			Type:      typ,
+			Name:      name,
+			Namespace: "default",
+		}
+	}
+	reviews := model.Config{ConfigMeta: meta(schemas.DestinationRule.Type, "reviews")}
+	ratings := model.Config{ConfigMeta: meta(schemas.VirtualService.Type, "ratings")}
+	unused := model.Config{ConfigMeta: meta(schemas.VirtualService.Type, "unused")}
+	mongo := model.Config{ConfigMeta: meta(schemas.VirtualService.Type, "mongo")}
+	lua := model.Config{ConfigMeta: meta(schemas.EnvoyFilter.Type, "lua")}
+
+	con := newXdsConnection("", nil)
+	con.node = &model.Proxy{EnvoyFilterUsage: model.NewEnvoyFilterUsage()}
+	con.node.EnvoyFilterUsage.Record("lds", "default/lua", "virtualInbound")
+	con.node.EnvoyFilterUsage.Record("cds", "default/lua", "outbound|9080||details.default.svc.cluster.local")
+	con.recordListenerUsage([]*xdsapi.Listener{{
+		Name: "0.0.0.0_27017",
+		FilterChains: []*listener.FilterChain{
+			{Metadata: util.BuildConfigInfoMetadata(mongo.ConfigMeta)},
+			{Metadata: util.BuildConfigInfoMetadata(mongo.ConfigMeta)},
+		},
+	}})
+	con.recordClusterUsage([]*xdsapi.Cluster{
+		{Name: "outbound|9080|v1|reviews.default.svc.cluster.local", Metadata: util.BuildConfigInfoMetadata(reviews.ConfigMeta)},
+		{Name: "outbound|9080|v2|reviews.default.svc.cluster.local", Metadata: util.BuildConfigInfoMetadata(reviews.ConfigMeta)},
+		{Name: "outbound|9080||details.default.svc.cluster.local"},
+	})
+	con.recordRouteUsage([]*xdsapi.RouteConfiguration{{
+		Name: "9080",
+		VirtualHosts: []*route.VirtualHost{{
+			Name:   "ratings.default.svc.cluster.local:9080",
+			Routes: []*route.Route{{Name: "default", Metadata: util.BuildConfigInfoMetadata(ratings.ConfigMeta)}},
+		}},
+	}})
+
+	adsClientsMutex.Lock()
+	saved := adsClients
+	adsClients = map[string]*XdsConnection{"con": con}
+	adsClientsMutex.Unlock()
+	defer func() {
+		adsClientsMutex.Lock()
+		adsClients = saved
+		adsClientsMutex.Unlock()
+	}()
+
+	got := configResources([]model.Config{unused, reviews, ratings, mongo, lua})
+	want := []*ConfigResources{
+		{Config: "destination-rule/default/reviews", Clusters: 2},
+		{Config: "envoy-filter/default/lua", Clusters: 1, Listeners: 1},
+		{Config: "virtual-service/default/mongo", Listeners: 1},
+		{Config: "virtual-service/default/ratings", Routes: 1},
+		{Config: "virtual-service/default/unused", Unused: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("configResources() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+)
+
+var (
+	totalConnectionsRejected          = xdsRejectedConnections.With(typeTag.Value("total"))
+	namespaceConnectionsRejected      = xdsRejectedConnections.With(typeTag.Value("namespace"))
+	serviceAccountConnectionsRejected = xdsRejectedConnections.With(typeTag.Value("service_account"))
+	drainingConnectionsRejected       = xdsRejectedConnections.With(typeTag.Value("draining"))
+)
+
+// admitConnection returns a ResourceExhausted error if a new connection of the proxy would exceed the
+// ADS connection limits of the instance. The connections being initialized are not counted, so the limits
+// may be exceeded by the proxies connecting at the same time.
+func admitConnection(node *model.Proxy) error {
+	maxTotal := features.MaxADSConnections.Get()
+	maxPerNamespace := features.MaxADSConnectionsPerNamespace.Get()
+	maxPerServiceAccount := features.MaxADSConnectionsPerServiceAccount.Get()
+	if maxTotal <= 0 && maxPerNamespace <= 0 && maxPerServiceAccount <= 0 {
+		return nil
+	}
+
+	namespace := node.ConfigNamespace
+	serviceAccount := proxyServiceAccount(node)
+	total, inNamespace, withServiceAccount := 0, 0, 0
+	adsClientsMutex.RLock()
+	for _, con := range adsClients {
+		total++
+		if con.node == nil {
+			continue
+		}
+		if con.node.ConfigNamespace == namespace {
+			inNamespace++
+		}
+		if serviceAccount != "" && proxyServiceAccount(con.node) == serviceAccount {
+			withServiceAccount++
+		}
+	}
+	adsClientsMutex.RUnlock()
+
+	if maxTotal > 0 && total >= maxTotal {
+		totalConnectionsRejected.Increment()
+		return status.Errorf(codes.ResourceExhausted,
+			"pilot has %d connections, the limit of %s is %d", total, features.MaxADSConnections.Name, maxTotal)
+	}
+	if maxPerNamespace > 0 && inNamespace >= maxPerNamespace {
+		namespaceConnectionsRejected.Increment()
+		return status.Errorf(codes.ResourceExhausted,
+			"namespace %q has %d connections, the limit of %s is %d",
+			namespace, inNamespace, features.MaxADSConnectionsPerNamespace.Name, maxPerNamespace)
+	}
+	if maxPerServiceAccount > 0 && serviceAccount != "" && withServiceAccount >= maxPerServiceAccount {
+		serviceAccountConnectionsRejected.Increment()
+		return status.Errorf(codes.ResourceExhausted,
+			"service account %q has %d connections, the limit of %s is %d",
+			serviceAccount, withServiceAccount, features.MaxADSConnectionsPerServiceAccount.Name, maxPerServiceAccount)
+	}
+	return nil
+}
+
+func proxyServiceAccount(node *model.Proxy) string {
+	if node.Metadata == nil {
+		return ""
+	}
+	return node.Metadata.ServiceAccount
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestAdmitConnection(t *testing.T) {
+	proxy := func(namespace, serviceAccount string) *model.Proxy {
+		return &model.Proxy{
+			ConfigNamespace: namespace,
+			Metadata:        &model.NodeMetadata{ServiceAccount: serviceAccount},
+		}
+	}
+
+	adsClientsMutex.Lock()
+	saved := adsClients
+	adsClients = map[string]*XdsConnection{}
+	for i, node := range []*model.Proxy{
+		proxy("ns1", "sa1"),
+		proxy("ns1", "sa1"),
+		proxy("ns1", "sa2"),
+		proxy("ns2", "sa3"),
+	} {
+		adsClients[fmt.Sprintf("con-%d", i)] = &XdsConnection{node: node}
+	}
+	adsClientsMutex.Unlock()
+	defer func() {
+		adsClientsMutex.Lock()
+		adsClients = saved
+		adsClientsMutex.Unlock()
+	}()
+
+	cases := []struct {
+		name   string
+		limits map[string]string
+		node   *model.Proxy
+		admit  bool
+	}{
+		{"no limits", nil, proxy("ns1", "sa1"), true},
+		{"total limit reached", map[string]string{features.MaxADSConnections.Name: "4"}, proxy("ns3", "sa4"), false},
+		{"total limit not reached", map[string]string{features.MaxADSConnections.Name: "5"}, proxy("ns3", "sa4"), true},
+		{"namespace limit reached", map[string]string{features.MaxADSConnectionsPerNamespace.Name: "3"},
+			proxy("ns1", "sa4"), false},
+		{"namespace limit not reached", map[string]string{features.MaxADSConnectionsPerNamespace.Name: "3"},
+			proxy("ns2", "sa4"), true},
+		{"service account limit reached", map[string]string{features.MaxADSConnectionsPerServiceAccount.Name: "2"},
+			proxy("ns2", "sa1"), false},
+		{"service account limit not reached", map[string]string{features.MaxADSConnectionsPerServiceAccount.Name: "2"},
+			proxy("ns1", "sa2"), true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.limits {
+				os.Setenv(name, value)
+				defer os.Unsetenv(name)
+			}
+			err := admitConnection(tt.node)
+			if tt.admit && err != nil {
+				t.Errorf("admitConnection() = %v, want no error", err)
+			}
+			if !tt.admit && status.Code(err) != codes.ResourceExhausted {
+				t.Errorf("admitConnection() = %v, want a ResourceExhausted error", err)
+			}
+		})
+	}
+}
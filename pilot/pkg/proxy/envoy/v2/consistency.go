@@ -0,0 +1,134 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+	"strings"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	"github.com/golang/protobuf/ptypes"
+
+	"istio.io/istio/pilot/pkg/model"
+	istiolog "istio.io/pkg/log"
+)
+
+// The kinds of violations of the invariants of the generated configs.
+const (
+	violationEDSConfig               = "eds_config"
+	violationSNI                     = "sni"
+	violationWeights                 = "weights"
+	violationTransportSocketFallback = "transport_socket_fallback"
+)
+
+// defaultWeightedClustersTotalWeight is the total weight of the weighted clusters without a total weight.
+const defaultWeightedClustersTotalWeight = 100
+
+// violation is a violation of an invariant of a generated config, which the proxies may reject.
+type violation struct {
+	kind     string
+	resource string
+	message  string
+}
+
+// checkClusters returns the violations of the invariants of the generated clusters.
+func checkClusters(clusters []*xdsapi.Cluster) []violation {
+	var out []violation
+	for _, c := range clusters {
+		if c.GetType() == xdsapi.Cluster_EDS && c.EdsClusterConfig == nil {
+			out = append(out, violation{violationEDSConfig, c.Name, "EDS cluster without an EDS config"})
+		}
+		if c.TlsContext != nil {
+			if err := checkSNI(c.TlsContext.Sni); err != nil {
+				out = append(out, violation{violationSNI, c.Name, err.Error()})
+			}
+		}
+		if len(c.TransportSocketMatches) == 0 {
+			continue
+		}
+		fallback := false
+		for _, m := range c.TransportSocketMatches {
+			if len(m.Match.GetFields()) == 0 {
+				fallback = true
+			}
+			if m.TransportSocket == nil || m.TransportSocket.GetTypedConfig() == nil {
+				continue
+			}
+			tlsContext := &auth.UpstreamTlsContext{}
+			if err := ptypes.UnmarshalAny(m.TransportSocket.GetTypedConfig(), tlsContext); err != nil {
+				continue
+			}
+			if err := checkSNI(tlsContext.Sni); err != nil {
+				out = append(out, violation{violationSNI, c.Name, fmt.Sprintf("transport socket match %s: %v", m.Name, err)})
+			}
+		}
+		// Without a match of all the endpoints, the endpoints not matched by any match have no transport socket.
+		if !fallback {
+			out = append(out, violation{violationTransportSocketFallback, c.Name, "no transport socket match of all the endpoints"})
+		}
+	}
+	return out
+}
+
+// checkSNI returns an error if an SNI generated by Pilot, e.g. outbound_.8080_.v1_.reviews.default.svc.cluster.local,
+// can't be parsed. The other SNIs are set by the users and are not checked.
+func checkSNI(sni string) error {
+	if !strings.HasPrefix(sni, string(model.TrafficDirectionOutbound)+"_.") &&
+		!strings.HasPrefix(sni, string(model.TrafficDirectionInbound)+"_.") {
+		return nil
+	}
+	_, _, hostname, port := model.ParseSubsetKey(sni)
+	if hostname == "" || port <= 0 {
+		return fmt.Errorf("invalid SNI %q", sni)
+	}
+	return nil
+}
+
+// checkRoutes returns the violations of the invariants of the generated routes.
+func checkRoutes(routes []*xdsapi.RouteConfiguration) []violation {
+	var out []violation
+	for _, rc := range routes {
+		for _, vh := range rc.VirtualHosts {
+			for _, r := range vh.Routes {
+				weighted := r.GetRoute().GetWeightedClusters()
+				if weighted == nil {
+					continue
+				}
+				total := uint32(defaultWeightedClustersTotalWeight)
+				if weighted.TotalWeight != nil {
+					total = weighted.TotalWeight.Value
+				}
+				sum := uint32(0)
+				for _, c := range weighted.Clusters {
+					sum += c.Weight.GetValue()
+				}
+				if sum != total {
+					out = append(out, violation{violationWeights, rc.Name,
+						fmt.Sprintf("weights of the route %s of the virtual host %s sum to %d, not %d", r.Name, vh.Name, sum, total)})
+				}
+			}
+		}
+	}
+	return out
+}
+
+// recordViolations logs the violations of the configs generated for a proxy, and records them in the metrics.
+func recordViolations(scope *istiolog.Scope, node *model.Proxy, violations []violation) {
+	for _, v := range violations {
+		scope.Errorf("Generated inconsistent config %s for node:%s: %s", v.resource, node.ID, v.message)
+		xdsConsistencyViolations.With(typeTag.Value(v.kind)).Increment()
+	}
+}
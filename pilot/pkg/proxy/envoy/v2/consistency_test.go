@@ -0,0 +1,143 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"istio.io/istio/pilot/pkg/networking/util"
+)
+
+func violationKinds(violations []violation) []string {
+	out := make([]string, 0, len(violations))
+	for _, v := range violations {
+		out = append(out, v.kind)
+	}
+	return out
+}
+
+func TestCheckClusters(t *testing.T) {
+	tlsSocket := &core.TransportSocket{
+		Name: util.EnvoyTLSSocketName,
+		ConfigType: &core.TransportSocket_TypedConfig{
+			TypedConfig: util.MessageToAny(&auth.UpstreamTlsContext{Sni: "outbound_.8080_._.reviews.default.svc.cluster.local"}),
+		},
+	}
+	mtlsMatch := &structpb.Struct{Fields: map[string]*structpb.Value{
+		"tlsMode": {Kind: &structpb.Value_StringValue{StringValue: "istio"}},
+	}}
+
+	cases := []struct {
+		name    string
+		cluster *xdsapi.Cluster
+		want    []string
+	}{
+		{
+			name: "valid",
+			cluster: &xdsapi.Cluster{
+				Name:                 "outbound|8080||reviews.default.svc.cluster.local",
+				ClusterDiscoveryType: &xdsapi.Cluster_Type{Type: xdsapi.Cluster_EDS},
+				EdsClusterConfig:     &xdsapi.Cluster_EdsClusterConfig{ServiceName: "outbound|8080||reviews.default.svc.cluster.local"},
+				TlsContext:           &auth.UpstreamTlsContext{Sni: "partner.example.com"},
+				TransportSocketMatches: []*xdsapi.Cluster_TransportSocketMatch{
+					{Name: "mtls", Match: mtlsMatch, TransportSocket: tlsSocket},
+					{Name: "plaintext", Match: &structpb.Struct{}},
+				},
+			},
+		},
+		{
+			name: "EDS without EDS config",
+			cluster: &xdsapi.Cluster{
+				Name:                 "outbound|8080||reviews.default.svc.cluster.local",
+				ClusterDiscoveryType: &xdsapi.Cluster_Type{Type: xdsapi.Cluster_EDS},
+			},
+			want: []string{violationEDSConfig},
+		},
+		{
+			name: "invalid SNI",
+			cluster: &xdsapi.Cluster{
+				Name:                 "outbound|8080||reviews.default.svc.cluster.local",
+				ClusterDiscoveryType: &xdsapi.Cluster_Type{Type: xdsapi.Cluster_STRICT_DNS},
+				TlsContext:           &auth.UpstreamTlsContext{Sni: "outbound_.http_.reviews"},
+			},
+			want: []string{violationSNI},
+		},
+		{
+			name: "no transport socket fallback",
+			cluster: &xdsapi.Cluster{
+				Name:                 "outbound|8080||reviews.default.svc.cluster.local",
+				ClusterDiscoveryType: &xdsapi.Cluster_Type{Type: xdsapi.Cluster_STRICT_DNS},
+				TransportSocketMatches: []*xdsapi.Cluster_TransportSocketMatch{
+					{Name: "mtls", Match: mtlsMatch, TransportSocket: tlsSocket},
+				},
+			},
+			want: []string{violationTransportSocketFallback},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got := violationKinds(checkClusters([]*xdsapi.Cluster{tt.cluster}))
+			if len(got) != len(tt.want) {
+				t.Fatalf("checkClusters() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("checkClusters() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckRoutes(t *testing.T) {
+	weighted := func(total *wrappers.UInt32Value, weights ...uint32) *route.Route {
+		clusters := &route.WeightedCluster{TotalWeight: total}
+		for _, w := range weights {
+			clusters.Clusters = append(clusters.Clusters, &route.WeightedCluster_ClusterWeight{
+				Name:   "outbound|8080||reviews.default.svc.cluster.local",
+				Weight: &wrappers.UInt32Value{Value: w},
+			})
+		}
+		return &route.Route{
+			Name: "reviews",
+			Action: &route.Route_Route{Route: &route.RouteAction{
+				ClusterSpecifier: &route.RouteAction_WeightedClusters{WeightedClusters: clusters},
+			}},
+		}
+	}
+	routes := []*xdsapi.RouteConfiguration{{
+		Name: "8080",
+		VirtualHosts: []*route.VirtualHost{{
+			Name: "reviews.default.svc.cluster.local:8080",
+			Routes: []*route.Route{
+				weighted(nil, 90, 10),
+				weighted(&wrappers.UInt32Value{Value: 1000}, 900, 100),
+				weighted(nil, 90, 20),
+			},
+		}},
+	}}
+
+	got := checkRoutes(routes)
+	if len(got) != 1 || got[0].kind != violationWeights {
+		t.Fatalf("checkRoutes() = %v, want a single %s violation", got, violationWeights)
+	}
+}
@@ -53,6 +53,7 @@ func (s *DiscoveryServer) InitDebug(mux *http.ServeMux, sctl *aggregate.Controll
 		}, 2)
 	s.MemRegistry.EDSUpdater = s
 	s.MemRegistry.ClusterID = "v2-debug"
+	s.registries = sctl
 
 	sctl.AddRegistry(aggregate.Registry{
 		ClusterID:        "v2-debug",
@@ -68,15 +69,26 @@ func (s *DiscoveryServer) InitDebug(mux *http.ServeMux, sctl *aggregate.Controll
 	mux.HandleFunc("/debug/cdsz", cdsz)
 	mux.HandleFunc("/debug/syncz", Syncz)
 	mux.HandleFunc("/debug/config_distribution", s.distributedVersions)
+	mux.HandleFunc("/debug/config_sizez", configSizez)
+	mux.HandleFunc("/debug/config_usagez", s.configUsagez)
+	mux.HandleFunc("/debug/bluegreenz", s.blueGreenz)
+	mux.HandleFunc("/debug/resource_namez", s.resourceNamez)
+	mux.HandleFunc("/debug/cb_overridez", s.cbOverridez)
+	mux.HandleFunc("/debug/locality_outagez", s.localityOutagez)
+	mux.HandleFunc("/debug/logging", loggingz)
+	mux.HandleFunc("/debug/flagz", s.flagz)
 
 	mux.HandleFunc("/debug/registryz", s.registryz)
+	mux.HandleFunc("/debug/registry_healthz", s.registryHealthz)
 	mux.HandleFunc("/debug/endpointz", s.endpointz)
 	mux.HandleFunc("/debug/endpointShardz", s.endpointShardz)
 	mux.HandleFunc("/debug/configz", s.configz)
+	mux.HandleFunc("/debug/config_kindz", s.configKindz)
 
 	mux.HandleFunc("/debug/authenticationz", s.Authenticationz)
 	mux.HandleFunc("/debug/config_dump", s.ConfigDump)
 	mux.HandleFunc("/debug/push_status", s.PushStatusHandler)
+	mux.HandleFunc("/debug/simulate", s.Simulate)
 }
 
 // SyncStatus is the synchronization status between Pilot and a given Envoy
@@ -296,6 +308,19 @@ func (s *DiscoveryServer) configz(w http.ResponseWriter, req *http.Request) {
 	_, _ = fmt.Fprint(w, "\n{}]")
 }
 
+// configKindz dumps the config kinds watched by Pilot. The kinds disabled with PILOT_DISABLED_CONFIG_KINDS
+// are not listed.
+func (s *DiscoveryServer) configKindz(w http.ResponseWriter, _ *http.Request) {
+	out, err := json.MarshalIndent(s.Env.IstioConfigStore.ConfigDescriptor().Types(), "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(out)
+}
+
 // collectTLSSettingsForPort returns TLSSettings for the given port, key by subset name (the service-level settings
 // should have key is an empty string). TLSSettings could be nil, indicate it was not set.
 func collectTLSSettingsForPort(rule *networking.DestinationRule, port *model.Port) map[string]*networking.TLSSettings {
@@ -626,6 +651,11 @@ func writeAllADS(w io.Writer) {
 }
 
 func (s *DiscoveryServer) ready(w http.ResponseWriter, req *http.Request) {
+	// Not ready while draining, for the instance to be removed from the endpoints of the service.
+	if s.draining.Load() {
+		w.WriteHeader(503)
+		return
+	}
 	if s.ConfigController != nil {
 		if !s.ConfigController.HasSynced() {
 			w.WriteHeader(503)
@@ -638,7 +668,62 @@ func (s *DiscoveryServer) ready(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 	}
+	// The failing registries do not make Pilot unready, as their last services are still served, but are listed.
 	w.WriteHeader(200)
+	if s.registries != nil {
+		for _, h := range s.registries.RegistryHealth() {
+			if !h.Healthy() {
+				_, _ = fmt.Fprintf(w, "registry %s %s unhealthy: circuit open %t, serving stale data %t: %s\n",
+					h.Registry, h.ClusterID, h.CircuitOpen, h.ServingStaleData, h.LastError)
+			}
+		}
+	}
+}
+
+// registryHealthz reports the health of the service registries: their consecutive failures, whether their
+// circuit is open and whether their last services are served instead of the current ones.
+// It is mapped to /debug/registry_healthz.
+func (s *DiscoveryServer) registryHealthz(w http.ResponseWriter, _ *http.Request) {
+	health := make([]aggregate.RegistryHealth, 0)
+	if s.registries != nil {
+		health = s.registries.RegistryHealth()
+	}
+	out, err := json.MarshalIndent(health, "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(out)
+}
+
+// resourceNamez returns the mapping of the normalized stat names of the outbound clusters of the
+// current push, truncated or with invalid characters replaced, to the cluster names.
+// It is mapped to /debug/resource_namez
+func (s *DiscoveryServer) resourceNamez(w http.ResponseWriter, _ *http.Request) {
+	push := s.globalPushContext()
+	names := make([]string, 0)
+	for _, svc := range push.Services(nil) {
+		var subsets []*networking.Subset
+		if destRule := push.DestinationRule(nil, svc); destRule != nil {
+			subsets = destRule.Spec.(*networking.DestinationRule).Subsets
+		}
+		for _, port := range svc.Ports {
+			names = append(names, model.BuildSubsetKey(model.TrafficDirectionOutbound, "", svc.Hostname, port.Port))
+			for _, subset := range subsets {
+				names = append(names, model.BuildSubsetKey(model.TrafficDirectionOutbound, subset.Name, svc.Hostname, port.Port))
+			}
+		}
+	}
+	out, err := json.MarshalIndent(model.NormalizedResourceNames(names), "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(out)
 }
 
 // edsz implements a status and debug interface for EDS.
@@ -0,0 +1,88 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+	"crypto/tls"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+var debugProxyConnectionsRejected = xdsRejectedConnections.With(typeTag.Value("debug_proxy"))
+
+// authorizeDebugProxy returns a PermissionDenied error unless the verified client certificate of the connection
+// has one of the identities allowed to connect debug proxies, which receive the config of the whole mesh.
+func authorizeDebugProxy(ctx context.Context) error {
+	if debugIdentityAllowed(peerIdentities(ctx)) {
+		return nil
+	}
+	debugProxyConnectionsRejected.Increment()
+	return status.Errorf(codes.PermissionDenied,
+		"the client identity is not allowed to connect debug proxies, see %s", features.DebugProxyIdentities.Name)
+}
+
+// debugIdentityAllowed returns true if one of the identities is listed in PILOT_DEBUG_PROXY_IDENTITIES.
+func debugIdentityAllowed(ids []string) bool {
+	allowed := make(map[string]bool)
+	for _, id := range strings.Split(features.DebugProxyIdentities.Get(), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			allowed[id] = true
+		}
+	}
+
+	for _, id := range ids {
+		if allowed[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// peerIdentities returns the identities of the verified client certificate of the connection.
+func peerIdentities(ctx context.Context) []string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.AuthInfo == nil {
+		return nil
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+	return verifiedIdentities(&tlsInfo.State)
+}
+
+// verifiedIdentities returns the identities of the verified client certificate of a TLS connection.
+func verifiedIdentities(state *tls.ConnectionState) []string {
+	if state == nil {
+		return nil
+	}
+	chains := state.VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return nil
+	}
+	ids, err := util.ExtractIDs(chains[0][0].Extensions)
+	if err != nil {
+		return nil
+	}
+	return ids
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"os"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+func TestAuthorizeDebugProxy(t *testing.T) {
+	peerContext := func(identity string) context.Context {
+		if identity == "" {
+			return context.Background()
+		}
+		san, err := util.BuildSubjectAltNameExtension(identity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert := &x509.Certificate{Extensions: []pkix.Extension{*san}}
+		return peer.NewContext(context.Background(), &peer.Peer{
+			AuthInfo: credentials.TLSInfo{
+				State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}},
+			},
+		})
+	}
+
+	inspector := "spiffe://cluster.local/ns/istio-system/sa/mesh-inspector"
+	cases := []struct {
+		name       string
+		identities string
+		peer       string
+		authorized bool
+	}{
+		{"no identities allowed", "", inspector, false},
+		{"identity allowed", "spiffe://cluster.local/ns/test/sa/harness, " + inspector, inspector, true},
+		{"identity not allowed", inspector, "spiffe://cluster.local/ns/default/sa/reviews", false},
+		{"no client certificate", inspector, "", false},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv(features.DebugProxyIdentities.Name, tt.identities)
+			defer os.Unsetenv(features.DebugProxyIdentities.Name)
+
+			err := authorizeDebugProxy(peerContext(tt.peer))
+			if tt.authorized && err != nil {
+				t.Errorf("authorizeDebugProxy() = %v, want no error", err)
+			}
+			if !tt.authorized && status.Code(err) != codes.PermissionDenied {
+				t.Errorf("authorizeDebugProxy() = %v, want a PermissionDenied error", err)
+			}
+		})
+	}
+}
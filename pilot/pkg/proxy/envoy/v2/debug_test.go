@@ -20,6 +20,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -291,6 +292,69 @@ func getConfigDump(t *testing.T, s *v2.DiscoveryServer, proxyID string, wantCode
 	return got
 }
 
+func TestSimulate(t *testing.T) {
+	s, tearDown := initLocalPilotTestEnv(t)
+	defer tearDown()
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantCode int
+	}{
+		{
+			name:     "simulates proxy by id",
+			method:   "GET",
+			path:     "/simulate?proxyID=" + sidecarID(app3Ip, "simApp"),
+			wantCode: 200,
+		},
+		{
+			name:     "simulates proxy with metadata",
+			method:   "POST",
+			path:     "/simulate",
+			body:     fmt.Sprintf(`{"proxyID": %q, "metadata": {"LABELS": {"version": "v1"}}}`, sidecarID(app3Ip, "simApp")),
+			wantCode: 200,
+		},
+		{
+			name:     "returns 400 if no proxyID",
+			method:   "GET",
+			path:     "/simulate",
+			wantCode: 400,
+		},
+		{
+			name:     "returns 400 if invalid proxyID",
+			method:   "GET",
+			path:     "/simulate?proxyID=invalid",
+			wantCode: 400,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(s.EnvoyXdsServer.Simulate).ServeHTTP(rr, req)
+			if rr.Code != tt.wantCode {
+				t.Fatalf("wanted response code %v, got %v: %s", tt.wantCode, rr.Code, rr.Body.String())
+			}
+			if tt.wantCode != 200 {
+				return
+			}
+			got := &v2.SimulationResult{}
+			if err := json.Unmarshal(rr.Body.Bytes(), got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Listeners) == 0 || len(got.Clusters) == 0 || len(got.Endpoints) == 0 {
+				t.Errorf("got %d listeners, %d clusters, %d endpoints, want some of each",
+					len(got.Listeners), len(got.Clusters), len(got.Endpoints))
+			}
+		})
+	}
+}
+
 // TestAuthenticationZ tests the /debug/authenticationz handle. Due to the limitation of the test setup,
 // this test converts only one simple scenario. See TestAnalyzeMTLSSettings for more
 func TestAuthenticationZ(t *testing.T) {
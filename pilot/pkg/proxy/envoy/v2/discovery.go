@@ -16,6 +16,7 @@ package v2
 
 import (
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -27,6 +28,7 @@ import (
 	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/core"
+	"istio.io/istio/pilot/pkg/serviceregistry/aggregate"
 	"istio.io/istio/pilot/pkg/serviceregistry/kube/controller"
 	"istio.io/istio/pkg/config/schemas"
 )
@@ -52,6 +54,10 @@ var (
 	// while debouncing. Defaults to 10 seconds. If events keep
 	// showing up with no break for this time, we'll trigger a push.
 	DebounceMax time.Duration
+
+	// DebounceAfterByKind overrides DebounceAfter for the events of some kinds, keyed by config type,
+	// or by endpointsDebounceKind for the EDS updates.
+	DebounceAfterByKind map[string]time.Duration
 )
 
 const (
@@ -67,11 +73,60 @@ const (
 	ListenerType = typePrefix + "Listener"
 	// RouteType is sent after listeners.
 	RouteType = typePrefix + "RouteConfiguration"
+
+	// endpointsDebounceKind is the debounce kind of the EDS updates.
+	endpointsDebounceKind = "endpoints"
 )
 
 func init() {
 	DebounceAfter = features.DebounceAfter
 	DebounceMax = features.DebounceMax
+	DebounceAfterByKind = parseDebounceAfterByKind(features.DebounceAfterByKind.Get())
+}
+
+// parseDebounceAfterByKind parses a comma separated list of <kind>=<duration>.
+func parseDebounceAfterByKind(value string) map[string]time.Duration {
+	out := make(map[string]time.Duration)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			adsLog.Warnf("ignoring invalid debounce entry %q", entry)
+			continue
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil {
+			adsLog.Warnf("ignoring invalid debounce entry %q: %v", entry, err)
+			continue
+		}
+		out[strings.TrimSpace(parts[0])] = d
+	}
+	return out
+}
+
+// debounceKinds returns the kinds of the events merged into a push request: endpointsDebounceKind for
+// the EDS updates, or the updated config types. Returns nil if the kinds are unknown.
+func debounceKinds(req *model.PushRequest) []string {
+	if !req.Full {
+		return []string{endpointsDebounceKind}
+	}
+	kinds := make([]string, 0, len(req.ConfigTypesUpdated))
+	for kind := range req.ConfigTypesUpdated {
+		kinds = append(kinds, kind)
+	}
+	return kinds
+}
+
+// debounceAfter returns the quiet time required after the events of a kind, the empty kind standing for
+// the events of unknown kinds.
+func debounceAfter(kind string) time.Duration {
+	if d, ok := DebounceAfterByKind[kind]; ok {
+		return d
+	}
+	return DebounceAfter
 }
 
 // DiscoveryServer is Pilot's gRPC implementation for Envoy's v2 xds APIs
@@ -113,6 +168,18 @@ type DiscoveryServer struct {
 
 	// pushQueue is the buffer that used after debounce and before the real xds push.
 	pushQueue *PushQueue
+
+	// cbOverrides are the temporary circuit breaker overrides set through /debug/cb_overridez.
+	cbOverrides *circuitBreakerOverrides
+
+	// localityOutages are the simulated locality outages set through /debug/locality_outagez.
+	localityOutages *localityOutages
+
+	// registries is the aggregate service registry, whose health is reported by /ready.
+	registries *aggregate.Controller
+
+	// draining is set once the server drains its connections before shutting down, see Drain.
+	draining atomic.Bool
 }
 
 // EndpointShards holds the set of endpoint shards of a service. Registries update
@@ -151,6 +218,8 @@ func NewDiscoveryServer(
 		concurrentPushLimit:     make(chan struct{}, features.PushThrottle),
 		pushChannel:             make(chan *model.PushRequest, 10),
 		pushQueue:               NewPushQueue(),
+		cbOverrides:             newCircuitBreakerOverrides(),
+		localityOutages:         newLocalityOutages(),
 	}
 
 	// Flush cached discovery responses whenever services configuration change.
@@ -198,6 +267,11 @@ func NewDiscoveryServer(
 			out.ConfigUpdate(pushReq)
 		}
 		for _, descriptor := range schemas.Istio {
+			// ServiceEntry changes are pushed by the service and instance handlers of the ServiceEntry
+			// registry, which push through EDS alone the changes of endpoint weights.
+			if descriptor.Type == schemas.ServiceEntry.Type {
+				continue
+			}
 			configCache.RegisterEventHandler(descriptor.Type, configHandler)
 		}
 	}
@@ -220,6 +294,9 @@ func (s *DiscoveryServer) Start(stopCh <-chan struct{}) {
 	go s.handleUpdates(stopCh)
 	go s.periodicRefreshMetrics(stopCh)
 	go s.sendPushes(stopCh)
+	if s.Env != nil && s.Env.WeightRamps != nil {
+		go s.rampWeights(stopCh)
+	}
 }
 
 // Push metrics are updated periodically (10s default)
@@ -232,16 +309,21 @@ func (s *DiscoveryServer) periodicRefreshMetrics(stopCh <-chan struct{}) {
 			push := s.globalPushContext()
 			push.Mutex.Lock()
 
+			pushed := false
 			model.LastPushMutex.Lock()
 			if model.LastPushStatus != push {
 				model.LastPushStatus = push
 				push.UpdateMetrics()
 				out, _ := model.LastPushStatus.JSON()
 				adsLog.Infof("Push Status: %s", string(out))
+				pushed = true
 			}
 			model.LastPushMutex.Unlock()
 
 			push.Mutex.Unlock()
+			if pushed {
+				s.recordUnusedConfigs()
+			}
 		case <-stopCh:
 			return
 		}
@@ -251,6 +333,9 @@ func (s *DiscoveryServer) periodicRefreshMetrics(stopCh <-chan struct{}) {
 // Push is called to push changes on config updates using ADS. This is set in DiscoveryService.Push,
 // to avoid direct dependencies.
 func (s *DiscoveryServer) Push(req *model.PushRequest) {
+	if req.Span != nil {
+		defer req.Span.Finish()
+	}
 	if !req.Full {
 		req.Push = s.globalPushContext()
 		go s.AdsPushAll(versionInfo(), req)
@@ -264,17 +349,21 @@ func (s *DiscoveryServer) Push(req *model.PushRequest) {
 	// PushContext is reset after a config change. Previous status is
 	// saved.
 	t0 := time.Now()
+	span := childSpan(req.Span, "init_push_context")
 	push := model.NewPushContext()
 	if err := push.InitContext(s.Env, oldPushContext, req); err != nil {
 		adsLog.Errorf("XDS: Failed to update services: %v", err)
 		// We can't push if we can't read the data - stick with previous version.
 		pushContextErrors.Increment()
+		finishSpan(span, err)
 		return
 	}
 
 	if err := s.updateServiceShards(push); err != nil {
+		finishSpan(span, err)
 		return
 	}
+	finishSpan(span, nil)
 
 	s.updateMutex.Lock()
 	s.Env.PushContext = push
@@ -337,6 +426,19 @@ func debounce(ch chan *model.PushRequest, stopCh <-chan struct{}, pushFn func(re
 	var timeChan <-chan time.Time
 	var startDebounce time.Time
 	var lastConfigUpdateTime time.Time
+	// lastKindUpdateTime is the time of the last debounced event of each kind.
+	lastKindUpdateTime := make(map[string]time.Time)
+
+	// quietWait returns how long to wait for the events of every kind debounced to be quiet enough.
+	quietWait := func() time.Duration {
+		var wait time.Duration
+		for kind, last := range lastKindUpdateTime {
+			if remaining := debounceAfter(kind) - time.Since(last); remaining > wait {
+				wait = remaining
+			}
+		}
+		return wait
+	}
 
 	pushCounter := 0
 	debouncedEvents := 0
@@ -355,8 +457,9 @@ func debounce(ch chan *model.PushRequest, stopCh <-chan struct{}, pushFn func(re
 	pushWorker := func() {
 		eventDelay := time.Since(startDebounce)
 		quietTime := time.Since(lastConfigUpdateTime)
+		wait := quietWait()
 		// it has been too long or quiet enough
-		if eventDelay >= DebounceMax || quietTime >= DebounceAfter {
+		if eventDelay >= DebounceMax || wait <= 0 {
 			if req != nil {
 				pushCounter++
 				adsLog.Infof("Push debounce stable[%d] %d: %v since last change, %v since last push, full=%v",
@@ -364,12 +467,14 @@ func debounce(ch chan *model.PushRequest, stopCh <-chan struct{}, pushFn func(re
 					quietTime, eventDelay, req.Full)
 
 				free = false
+				req.Span = startPushSpan(req, startDebounce, debouncedEvents)
 				go push(req)
 				req = nil
 				debouncedEvents = 0
+				lastKindUpdateTime = make(map[string]time.Time)
 			}
 		} else {
-			timeChan = time.After(DebounceAfter - quietTime)
+			timeChan = time.After(wait)
 		}
 	}
 
@@ -381,13 +486,21 @@ func debounce(ch chan *model.PushRequest, stopCh <-chan struct{}, pushFn func(re
 		case r := <-ch:
 			if !features.EnableEDSDebounce.Get() && !r.Full {
 				// trigger push now, just for EDS
+				r.Span = startPushSpan(r, time.Now(), 1)
 				go pushFn(r)
 				continue
 			}
 
 			lastConfigUpdateTime = time.Now()
+			kinds := debounceKinds(r)
+			if len(kinds) == 0 {
+				kinds = []string{""}
+			}
+			for _, kind := range kinds {
+				lastKindUpdateTime[kind] = lastConfigUpdateTime
+			}
 			if debouncedEvents == 0 {
-				timeChan = time.After(DebounceAfter)
+				timeChan = time.After(quietWait())
 				startDebounce = lastConfigUpdateTime
 			}
 			debouncedEvents++
@@ -440,6 +553,7 @@ func doSendPushes(stopCh <-chan struct{}, semaphore chan struct{}, queue *PushQu
 					namespacesUpdated:  info.NamespacesUpdated,
 					configTypesUpdated: info.ConfigTypesUpdated,
 					noncePrefix:        info.Push.Version,
+					span:               info.Span,
 				}:
 					return
 				case <-client.stream.Context().Done(): // grpc stream was closed
@@ -31,6 +31,7 @@ import (
 
 	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/schemas"
 )
 
 func createProxies(n int) []*XdsConnection {
@@ -317,3 +318,57 @@ func TestDebounce(t *testing.T) {
 		})
 	}
 }
+
+func TestDebounceByKind(t *testing.T) {
+	defer func(after, max time.Duration, byKind map[string]time.Duration) {
+		DebounceAfter, DebounceMax, DebounceAfterByKind = after, max, byKind
+	}(DebounceAfter, DebounceMax, DebounceAfterByKind)
+	DebounceAfter = 500 * time.Millisecond
+	DebounceMax = 5 * time.Second
+	DebounceAfterByKind = parseDebounceAfterByKind("endpoints=10ms, gateway=1s, invalid")
+
+	pushes := make(chan *model.PushRequest, 10)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	updateCh := make(chan *model.PushRequest)
+	go debounce(updateCh, stopCh, func(req *model.PushRequest) { pushes <- req })
+
+	expectPush := func(within time.Duration) {
+		t.Helper()
+		select {
+		case <-pushes:
+		case <-time.After(within):
+			t.Fatalf("no push within %v", within)
+		}
+	}
+	expectNoPush := func(during time.Duration) {
+		t.Helper()
+		select {
+		case req := <-pushes:
+			t.Fatalf("unexpected push %+v", req)
+		case <-time.After(during):
+		}
+	}
+
+	// The EDS updates are pushed well before the default debounce delay.
+	updateCh <- &model.PushRequest{Full: false}
+	expectPush(250 * time.Millisecond)
+
+	// The gateway updates wait for their own delay, longer than the default one.
+	updateCh <- &model.PushRequest{Full: true, ConfigTypesUpdated: map[string]struct{}{schemas.Gateway.Type: {}}}
+	expectNoPush(700 * time.Millisecond)
+	expectPush(time.Second)
+
+	// The updates of other kinds keep the default delay.
+	updateCh <- &model.PushRequest{Full: true, ConfigTypesUpdated: map[string]struct{}{schemas.VirtualService.Type: {}}}
+	expectNoPush(250 * time.Millisecond)
+	expectPush(time.Second)
+}
+
+func TestParseDebounceAfterByKind(t *testing.T) {
+	got := parseDebounceAfterByKind("endpoints=100ms, destination-rule = 1s,gateway,virtual-service=abc,")
+	want := map[string]time.Duration{"endpoints": 100 * time.Millisecond, "destination-rule": time.Second}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDebounceAfterByKind() = %v, want %v", got, want)
+	}
+}
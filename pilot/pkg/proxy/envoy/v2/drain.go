@@ -0,0 +1,66 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Drain makes the server refuse the new ADS connections and close the existing ones at random times over
+// the window, so that the proxies reconnect to the other instances progressively rather than all at once
+// when the instance shuts down. It returns once all the connections are closed.
+func (s *DiscoveryServer) Drain(window time.Duration) {
+	s.draining.Store(true)
+
+	adsClientsMutex.RLock()
+	cons := make([]*XdsConnection, 0, len(adsClients))
+	for _, con := range adsClients {
+		cons = append(cons, con)
+	}
+	adsClientsMutex.RUnlock()
+
+	adsLog.Infof("ADS: draining %d connections over %v", len(cons), window)
+	delays := drainDelays(len(cons), window)
+	start := time.Now()
+	for i, con := range cons {
+		time.Sleep(time.Until(start.Add(delays[i])))
+		close(con.drain)
+	}
+}
+
+// drainDelays returns the sorted random delays, within the window, of n connections to close.
+func drainDelays(n int, window time.Duration) []time.Duration {
+	delays := make([]time.Duration, n)
+	for i := range delays {
+		delays[i] = time.Duration(rand.Int63n(int64(window) + 1))
+	}
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+	return delays
+}
+
+// admitDuringDrain returns an Unavailable error if the server is draining, for the proxy to connect to
+// another instance.
+func (s *DiscoveryServer) admitDuringDrain() error {
+	if !s.draining.Load() {
+		return nil
+	}
+	drainingConnectionsRejected.Increment()
+	return status.Error(codes.Unavailable, "pilot is draining, connect to another instance")
+}
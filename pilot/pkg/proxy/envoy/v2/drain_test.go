@@ -0,0 +1,74 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDrain(t *testing.T) {
+	adsClientsMutex.Lock()
+	saved := adsClients
+	adsClients = map[string]*XdsConnection{}
+	for i := 0; i < 3; i++ {
+		adsClients[fmt.Sprintf("con-%d", i)] = newXdsConnection("", nil)
+	}
+	cons := adsClients
+	adsClientsMutex.Unlock()
+	defer func() {
+		adsClientsMutex.Lock()
+		adsClients = saved
+		adsClientsMutex.Unlock()
+	}()
+
+	s := &DiscoveryServer{}
+	if err := s.admitDuringDrain(); err != nil {
+		t.Fatalf("connection rejected before draining: %v", err)
+	}
+
+	start := time.Now()
+	s.Drain(50 * time.Millisecond)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("draining took %v, longer than the window", elapsed)
+	}
+	for id, con := range cons {
+		select {
+		case <-con.drain:
+		default:
+			t.Errorf("connection %s not closed", id)
+		}
+	}
+	if err := s.admitDuringDrain(); status.Code(err) != codes.Unavailable {
+		t.Errorf("connection admitted while draining: %v", err)
+	}
+}
+
+func TestDrainDelays(t *testing.T) {
+	window := 10 * time.Second
+	delays := drainDelays(100, window)
+	for i, d := range delays {
+		if d < 0 || d > window {
+			t.Errorf("delay %v out of the window %v", d, window)
+		}
+		if i > 0 && d < delays[i-1] {
+			t.Errorf("delays not sorted: %v before %v", delays[i-1], d)
+		}
+	}
+}
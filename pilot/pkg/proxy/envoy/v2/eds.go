@@ -97,7 +97,7 @@ func loadAssignment(c *EdsCluster) *xdsapi.ClusterLoadAssignment {
 
 // buildEnvoyLbEndpoint packs the endpoint based on istio info.
 func buildEnvoyLbEndpoint(uid string, family model.AddressFamily, address string, port uint32,
-	network string, weight uint32, mtlsReady bool) *endpoint.LbEndpoint {
+	network string, weight uint32, mtlsReady bool, tlsMode model.EndpointTLSMode) *endpoint.LbEndpoint {
 
 	var addr core.Address
 	switch family {
@@ -134,12 +134,12 @@ func buildEnvoyLbEndpoint(uid string, family model.AddressFamily, address string
 	// Istio telemetry depends on the metadata value being set for endpoints in the mesh.
 	// Istio endpoint level tls transport socket configuation depends on this logic
 	// Do not remove
-	ep.Metadata = util.BuildLbEndpointMetadata(uid, network, mtlsReady)
+	ep.Metadata = util.BuildLbEndpointMetadata(uid, network, mtlsReady, tlsMode)
 
 	return ep
 }
 
-func networkEndpointToEnvoyEndpoint(e *model.NetworkEndpoint, mtlsReady bool) (*endpoint.LbEndpoint, error) {
+func networkEndpointToEnvoyEndpoint(e *model.NetworkEndpoint, mtlsReady bool, tlsMode model.EndpointTLSMode) (*endpoint.LbEndpoint, error) {
 	err := model.ValidateNetworkEndpointAddress(e)
 	if err != nil {
 		return nil, err
@@ -165,7 +165,7 @@ func networkEndpointToEnvoyEndpoint(e *model.NetworkEndpoint, mtlsReady bool) (*
 	// Istio telemetry depends on the metadata value being set for endpoints in the mesh.
 	// Istio endpoint level tls transport socket configuation depends on this logic
 	// Do not remove
-	ep.Metadata = util.BuildLbEndpointMetadata(e.UID, e.Network, mtlsReady)
+	ep.Metadata = util.BuildLbEndpointMetadata(e.UID, e.Network, mtlsReady, tlsMode)
 
 	return ep, nil
 }
@@ -300,6 +300,7 @@ func (s *DiscoveryServer) updateServiceShards(push *model.PushContext) error {
 						LbWeight:        ep.Endpoint.LbWeight,
 						Attributes:      ep.Service.Attributes,
 						MTLSReady:       ep.MTLSReady,
+						TLSMode:         ep.TLSMode,
 					})
 				}
 			}
@@ -324,12 +325,12 @@ func (s *DiscoveryServer) updateCluster(push *model.PushContext, clusterName str
 		svc := legacyServiceForHostname(hostname, push.ServiceByHostnameAndNamespace)
 		var instances []*model.ServiceInstance
 		if svc == nil {
-			adsLog.Warnf("service lookup for hostname %v failed", hostname)
+			edsLog.Warnf("service lookup for hostname %v failed", hostname)
 		} else {
 			var err error
 			instances, err = s.Env.ServiceDiscovery.InstancesByPort(svc, port, subsetLabels)
 			if err != nil {
-				adsLog.Errorf("endpoints for service cluster %q returned error %v", clusterName, err)
+				edsLog.Errorf("endpoints for service cluster %q returned error %v", clusterName, err)
 				totalXDSInternalErrors.Increment()
 				return err
 			}
@@ -337,7 +338,7 @@ func (s *DiscoveryServer) updateCluster(push *model.PushContext, clusterName str
 
 		if len(instances) == 0 {
 			push.Add(model.ProxyStatusClusterNoInstances, clusterName, nil, "")
-			adsLog.Debugf("EDS: Cluster %q (host:%s ports:%v labels:%v) has no instances", clusterName, hostname, port, subsetLabels)
+			edsLog.Debugf("EDS: Cluster %q (host:%s ports:%v labels:%v) has no instances", clusterName, hostname, port, subsetLabels)
 		}
 		edsInstances.With(clusterTag.Value(clusterName)).Record(float64(len(instances)))
 		locEps = localityLbEndpointsFromInstances(instances)
@@ -377,7 +378,7 @@ func (s *DiscoveryServer) SvcUpdate(cluster, hostname string, ports map[string]u
 // Update clusters for an incremental EDS push, and initiate the push.
 // Only clusters that changed are updated/pushed.
 func (s *DiscoveryServer) edsIncremental(version string, push *model.PushContext, req *model.PushRequest) {
-	adsLog.Infof("XDS:EDSInc Pushing:%s Services:%v ConnectedEndpoints:%d",
+	edsLog.Infof("XDS:EDSInc Pushing:%s Services:%v ConnectedEndpoints:%d",
 		version, req.EdsUpdates, adsClientCount())
 	t0 := time.Now()
 
@@ -401,10 +402,10 @@ func (s *DiscoveryServer) edsIncremental(version string, push *model.PushContext
 	// In general this code is called from the 'event' callback that is throttled.
 	for clusterName, edsCluster := range cMap {
 		if err := s.updateClusterInc(push, clusterName, edsCluster); err != nil {
-			adsLog.Errorf("updateCluster failed with clusterName:%s", clusterName)
+			edsLog.Errorf("updateCluster failed with clusterName:%s", clusterName)
 		}
 	}
-	adsLog.Infof("Cluster init time %v %s", time.Since(t0), version)
+	edsLog.Infof("Cluster init time %v %s", time.Since(t0), version)
 
 	s.startPush(req)
 }
@@ -443,8 +444,18 @@ func (s *DiscoveryServer) edsUpdate(clusterID, serviceName string, namespace str
 			s.EndpointShardsByService[serviceName][namespace].mutex.Unlock()
 			if svcShards == 0 {
 				delete(s.EndpointShardsByService[serviceName], namespace)
+				if s.hasActivator(serviceName, namespace) {
+					// The routes to the service are switched to its activator.
+					edsLog.Infof("Full push, service %s scaled to zero", serviceName)
+					s.ConfigUpdate(&model.PushRequest{
+						Full:               true,
+						NamespacesUpdated:  map[string]struct{}{namespace: {}},
+						ConfigTypesUpdated: map[string]struct{}{schemas.ServiceEntry.Type: {}},
+					})
+					return
+				}
 			}
-			adsLog.Infof("Incremental push, service %s has no endpoints", serviceName)
+			edsLog.Infof("Incremental push, service %s has no endpoints", serviceName)
 			s.ConfigUpdate(&model.PushRequest{
 				Full:              false,
 				NamespacesUpdated: map[string]struct{}{namespace: {}},
@@ -470,7 +481,7 @@ func (s *DiscoveryServer) edsUpdate(clusterID, serviceName string, namespace str
 		}
 		s.EndpointShardsByService[serviceName][namespace] = ep
 		if !internal {
-			adsLog.Infof("Full push, new service %s", serviceName)
+			edsLog.Infof("Full push, new service %s", serviceName)
 			requireFull = true
 		}
 	}
@@ -489,7 +500,7 @@ func (s *DiscoveryServer) edsUpdate(clusterID, serviceName string, namespace str
 			if !f && !internal {
 				// The entry has a service account that was not previously associated.
 				// Requires a CDS push and full sync.
-				adsLog.Infof("Endpoint updating service account %s %s", e.ServiceAccount, serviceName)
+				edsLog.Infof("Endpoint updating service account %s %s", e.ServiceAccount, serviceName)
 				requireFull = true
 				break
 			}
@@ -517,6 +528,13 @@ func (s *DiscoveryServer) edsUpdate(clusterID, serviceName string, namespace str
 	}
 }
 
+// hasActivator returns true if a service has an activator, to which its requests are sent while it has no endpoints.
+// The endpoints returning to such a service trigger a full push, as for a new service.
+func (s *DiscoveryServer) hasActivator(serviceName, namespace string) bool {
+	svc := s.globalPushContext().ServiceByHostnameAndNamespace[host.Name(serviceName)][namespace]
+	return svc != nil && svc.Attributes.Activator != ""
+}
+
 // LocalityLbEndpointsFromInstances returns a list of Envoy v2 LocalityLbEndpoints.
 // Envoy v2 Endpoints are constructed from Pilot's older data structure involving
 // model.ServiceInstance objects. Envoy expects the endpoints grouped by zone, so
@@ -524,9 +542,9 @@ func (s *DiscoveryServer) edsUpdate(clusterID, serviceName string, namespace str
 func localityLbEndpointsFromInstances(instances []*model.ServiceInstance) []*endpoint.LocalityLbEndpoints {
 	localityEpMap := make(map[string]*endpoint.LocalityLbEndpoints)
 	for _, instance := range instances {
-		lbEp, err := networkEndpointToEnvoyEndpoint(&instance.Endpoint, instance.MTLSReady)
+		lbEp, err := networkEndpointToEnvoyEndpoint(&instance.Endpoint, instance.MTLSReady, instance.TLSMode)
 		if err != nil {
-			adsLog.Errorf("EDS: Unexpected pilot model endpoint v1 to v2 conversion: %v", err)
+			edsLog.Errorf("EDS: Unexpected pilot model endpoint v1 to v2 conversion: %v", err)
 			totalXDSInternalErrors.Increment()
 			continue
 		}
@@ -558,14 +576,14 @@ func (s *DiscoveryServer) loadAssignmentsForClusterLegacy(push *model.PushContex
 	c := s.getEdsCluster(clusterName)
 	if c == nil {
 		totalXDSInternalErrors.Increment()
-		adsLog.Errorf("cluster %s was nil skipping it.", clusterName)
+		edsLog.Errorf("cluster %s was nil skipping it.", clusterName)
 		return nil
 	}
 
 	l := loadAssignment(c)
 	if l == nil { // fresh cluster
 		if err := s.updateCluster(push, clusterName, c); err != nil {
-			adsLog.Errorf("error returned from updateCluster for cluster name %s, skipping it.", clusterName)
+			edsLog.Errorf("error returned from updateCluster for cluster name %s, skipping it.", clusterName)
 			totalXDSInternalErrors.Increment()
 			return nil
 		}
@@ -575,6 +593,106 @@ func (s *DiscoveryServer) loadAssignmentsForClusterLegacy(push *model.PushContex
 	return l
 }
 
+// generateEndpoints returns the endpoints of a cluster as seen by the proxy of the connection, filtered by
+// network and prioritized by locality.
+func (s *DiscoveryServer) generateEndpoints(con *XdsConnection, push *model.PushContext,
+	clusterName string) *xdsapi.ClusterLoadAssignment {
+	l := s.loadAssignmentsForClusterIsolated(con.node, push, clusterName)
+	if l == nil {
+		return nil
+	}
+
+	// If networks are set (by default they aren't) apply the Split Horizon
+	// EDS filter on the endpoints
+	if s.Env.MeshNetworks != nil && len(s.Env.MeshNetworks.Networks) > 0 {
+		endpoints := EndpointsByNetworkFilter(l.Endpoints, con, s.Env)
+		endpoints = LoadBalancingWeightNormalize(endpoints)
+		filteredCLA := &xdsapi.ClusterLoadAssignment{
+			ClusterName: l.ClusterName,
+			Endpoints:   endpoints,
+			Policy:      l.Policy,
+		}
+		l = filteredCLA
+	}
+
+	// If locality aware routing is enabled, prioritize endpoints or set their lb weight.
+	if s.Env.Mesh.LocalityLbSetting != nil {
+		// Make a shallow copy of the cla as we are mutating the endpoints with priorities/weights relative to the calling proxy
+		clonedCLA := util.CloneClusterLoadAssignment(l)
+		l = &clonedCLA
+
+		// Failover should only be enabled when there is an outlier detection, otherwise Envoy
+		// will never detect the hosts are unhealthy and redirect traffic.
+		enableFailover := hasOutlierDetection(push, con.node, clusterName)
+		loadbalancer.ApplyLocalityLBSetting(con.node.Locality, l, s.Env.Mesh.LocalityLbSetting, enableFailover)
+		recordLocalityEndpoints(con.node.Locality, l)
+	}
+	return s.localityOutages.apply(con.node, l)
+}
+
+// EndpointGenerator generates the endpoints of the clusters of proxies from the registries of an environment,
+// the way the discovery server generates them for the connected proxies, without serving them.
+type EndpointGenerator struct {
+	s *DiscoveryServer
+}
+
+// NewEndpointGenerator creates an endpoint generator for the services of the push context of the environment.
+func NewEndpointGenerator(env *model.Environment) (*EndpointGenerator, error) {
+	s := &DiscoveryServer{
+		Env:                     env,
+		EndpointShardsByService: map[string]map[string]*EndpointShards{},
+		pushChannel:             make(chan *model.PushRequest, 10),
+		localityOutages:         newLocalityOutages(),
+	}
+	if err := s.updateServiceShards(env.PushContext); err != nil {
+		return nil, err
+	}
+	return &EndpointGenerator{s: s}, nil
+}
+
+// LoadAssignment returns the endpoints of a cluster as seen by the proxy, filtered by network and prioritized by
+// locality.
+func (g *EndpointGenerator) LoadAssignment(proxy *model.Proxy, clusterName string) *xdsapi.ClusterLoadAssignment {
+	if l := g.s.generateEndpoints(&XdsConnection{node: proxy}, g.s.Env.PushContext, clusterName); l != nil {
+		return l
+	}
+	return &xdsapi.ClusterLoadAssignment{ClusterName: clusterName}
+}
+
+// localityPriority is a locality of the endpoints of a cluster, and the priority it is assigned to.
+type localityPriority struct {
+	locality string
+	priority uint32
+}
+
+// localityEndpointCounts returns the number of endpoints of a cluster load assignment by locality and
+// priority.
+func localityEndpointCounts(cla *xdsapi.ClusterLoadAssignment) map[localityPriority]int {
+	out := make(map[localityPriority]int)
+	for _, localityEndpoints := range cla.Endpoints {
+		key := localityPriority{
+			locality: util.LocalityToString(localityEndpoints.Locality),
+			priority: localityEndpoints.Priority,
+		}
+		out[key] += len(localityEndpoints.LbEndpoints)
+	}
+	return out
+}
+
+// recordLocalityEndpoints records the number of endpoints of a cluster assigned to each locality and priority
+// for the proxies of a locality, to verify the locality failover settings produce the intended topology.
+func recordLocalityEndpoints(proxyLocality *core.Locality, cla *xdsapi.ClusterLoadAssignment) {
+	proxyLocalityValue := util.LocalityToString(proxyLocality)
+	for key, count := range localityEndpointCounts(cla) {
+		edsLocalityEndpoints.With(
+			clusterTag.Value(cla.ClusterName),
+			proxyLocalityTag.Value(proxyLocalityValue),
+			localityTag.Value(key.locality),
+			priorityTag.Value(strconv.Itoa(int(key.priority))),
+		).Record(float64(count))
+	}
+}
+
 // loadAssignmentsForClusterIsolated return the endpoints for a proxy in an isolated namespace
 // Initial implementation is computing the endpoints on the flight - caching will be added as needed, based on
 // perf tests. The logic to compute is based on the current UpdateClusterInc
@@ -631,6 +749,7 @@ func (s *DiscoveryServer) loadAssignmentsForClusterIsolated(proxy *model.Proxy,
 // a client connects, for incremental updates and for full periodic updates.
 func (s *DiscoveryServer) pushEds(push *model.PushContext, con *XdsConnection, version string, edsUpdatedServices map[string]struct{}) error {
 	pushStart := time.Now()
+	span := con.startSpan("eds.generate")
 	loadAssignments := make([]*xdsapi.ClusterLoadAssignment, 0)
 	endpoints := 0
 	empty := make([]string, 0)
@@ -648,37 +767,11 @@ func (s *DiscoveryServer) pushEds(push *model.PushContext, con *XdsConnection, v
 			}
 		}
 
-		l := s.loadAssignmentsForClusterIsolated(con.node, push, clusterName)
-
+		l := s.generateEndpoints(con, push, clusterName)
 		if l == nil {
 			continue
 		}
 
-		// If networks are set (by default they aren't) apply the Split Horizon
-		// EDS filter on the endpoints
-		if s.Env.MeshNetworks != nil && len(s.Env.MeshNetworks.Networks) > 0 {
-			endpoints := EndpointsByNetworkFilter(l.Endpoints, con, s.Env)
-			endpoints = LoadBalancingWeightNormalize(endpoints)
-			filteredCLA := &xdsapi.ClusterLoadAssignment{
-				ClusterName: l.ClusterName,
-				Endpoints:   endpoints,
-				Policy:      l.Policy,
-			}
-			l = filteredCLA
-		}
-
-		// If locality aware routing is enabled, prioritize endpoints or set their lb weight.
-		if s.Env.Mesh.LocalityLbSetting != nil {
-			// Make a shallow copy of the cla as we are mutating the endpoints with priorities/weights relative to the calling proxy
-			clonedCLA := util.CloneClusterLoadAssignment(l)
-			l = &clonedCLA
-
-			// Failover should only be enabled when there is an outlier detection, otherwise Envoy
-			// will never detect the hosts are unhealthy and redirect traffic.
-			enableFailover := hasOutlierDetection(push, con.node, clusterName)
-			loadbalancer.ApplyLocalityLBSetting(con.node.Locality, l, s.Env.Mesh.LocalityLbSetting, enableFailover)
-		}
-
 		for _, e := range l.Endpoints {
 			endpoints += len(e.LbEndpoints)
 		}
@@ -689,22 +782,28 @@ func (s *DiscoveryServer) pushEds(push *model.PushContext, con *XdsConnection, v
 		loadAssignments = append(loadAssignments, l)
 	}
 
+	span.SetTag("clusters", len(loadAssignments))
+	span.SetTag("endpoints", endpoints)
+	finishSpan(span, nil)
+
 	response := endpointDiscoveryResponse(loadAssignments, version, push.Version)
+	span = con.startSpan("eds.send")
 	err := con.send(response)
+	finishSpan(span, err)
 	edsPushTime.Record(time.Since(pushStart).Seconds())
 	if err != nil {
-		adsLog.Warnf("EDS: Send failure %s: %v", con.ConID, err)
+		edsLog.Warnf("EDS: Send failure %s: %v", pushLogFields(con, version), err)
 		recordSendError(edsSendErrPushes, err)
 		return err
 	}
 	edsPushes.Increment()
 
 	if edsUpdatedServices == nil {
-		adsLog.Infof("EDS: PUSH for node:%s clusters:%d endpoints:%d empty:%v",
-			con.node.ID, len(con.Clusters), endpoints, empty)
+		edsLog.Infof("EDS: PUSH %s clusters:%d endpoints:%d empty:%v",
+			pushLogFields(con, version), len(con.Clusters), endpoints, empty)
 	} else {
-		adsLog.Infof("EDS: PUSH INC for node:%s clusters:%d endpoints:%d empty:%v",
-			con.node.ID, len(con.Clusters), endpoints, empty)
+		edsLog.Infof("EDS: PUSH INC %s clusters:%d endpoints:%d empty:%v",
+			pushLogFields(con, version), len(con.Clusters), endpoints, empty)
 	}
 	return nil
 }
@@ -787,7 +886,7 @@ func (s *DiscoveryServer) getOrAddEdsCluster(clusterName, node string, connectio
 func (s *DiscoveryServer) removeEdsCon(clusterName string, node string) {
 	c := s.getEdsCluster(clusterName)
 	if c == nil {
-		adsLog.Warnf("EDS: Missing cluster: %s", clusterName)
+		edsLog.Warnf("EDS: Missing cluster: %s", clusterName)
 		return
 	}
 
@@ -800,7 +899,7 @@ func (s *DiscoveryServer) removeEdsCon(clusterName string, node string) {
 		// This happens when a previously used cluster is no longer watched by any
 		// sidecar. It should not happen very often - normally all clusters are sent
 		// in CDS requests to all sidecars. It may happen if all connections are closed.
-		adsLog.Debugf("EDS: Remove unwatched cluster node:%s cluster:%s", node, clusterName)
+		edsLog.Debugf("EDS: Remove unwatched cluster node:%s cluster:%s", node, clusterName)
 		delete(edsClusters, clusterName)
 	}
 }
@@ -854,7 +953,9 @@ func buildLocalityLbEndpointsFromShards(
 				localityEpMap[ep.Locality] = locLbEps
 			}
 			if ep.EnvoyEndpoint == nil {
-				ep.EnvoyEndpoint = buildEnvoyLbEndpoint(ep.UID, ep.Family, ep.Address, ep.EndpointPort, ep.Network, ep.LbWeight, ep.MTLSReady)
+				ep.EnvoyEndpoint = buildEnvoyLbEndpoint(ep.UID, ep.Family, ep.Address, ep.EndpointPort, ep.Network, ep.LbWeight, ep.MTLSReady, ep.TLSMode)
+				ep.EnvoyEndpoint.Metadata = util.AddTrustDomainMetadata(ep.EnvoyEndpoint.Metadata, ep.ServiceAccount)
+				ep.EnvoyEndpoint.Metadata = util.AddCanaryMetadata(ep.EnvoyEndpoint.Metadata, ep.Labels)
 			}
 			locLbEps.LbEndpoints = append(locLbEps.LbEndpoints, ep.EnvoyEndpoint)
 
@@ -0,0 +1,55 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"reflect"
+	"testing"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+
+	"istio.io/istio/pilot/pkg/networking/util"
+)
+
+func TestLocalityEndpointCounts(t *testing.T) {
+	localityEndpoints := func(locality string, priority uint32, endpoints int) *endpoint.LocalityLbEndpoints {
+		return &endpoint.LocalityLbEndpoints{
+			Locality:    util.ConvertLocality(locality),
+			Priority:    priority,
+			LbEndpoints: make([]*endpoint.LbEndpoint, endpoints),
+		}
+	}
+	cla := &xdsapi.ClusterLoadAssignment{
+		ClusterName: "outbound|80||reviews.default.svc.cluster.local",
+		Endpoints: []*endpoint.LocalityLbEndpoints{
+			localityEndpoints("us-east/zone1", 0, 2),
+			localityEndpoints("us-east/zone2", 1, 3),
+			localityEndpoints("us-west/zone1", 2, 1),
+			localityEndpoints("us-west/zone2", 2, 4),
+		},
+	}
+
+	got := localityEndpointCounts(cla)
+	want := map[localityPriority]int{
+		{"us-east/zone1", 0}: 2,
+		{"us-east/zone2", 1}: 3,
+		{"us-west/zone1", 2}: 1,
+		{"us-west/zone2", 2}: 4,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("localityEndpointCounts() = %v, want %v", got, want)
+	}
+}
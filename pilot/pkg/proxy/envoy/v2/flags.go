@@ -0,0 +1,58 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// flagz lists the feature flags of Pilot with their type, default and current values, and sets the mutable flags
+// at runtime. Set with a PUT or POST of name and value, or an empty value to reset the flag to its default:
+// /debug/flagz?name=PILOT_ENABLE_REDIS_FILTER&value=true. The proxies are pushed with the new value.
+// Setting a flag requires a verified client certificate with one of the identities of PILOT_DEBUG_PROXY_IDENTITIES,
+// so the flags are read-only on the plain text debug port.
+func (s *DiscoveryServer) flagz(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		if !debugIdentityAllowed(verifiedIdentities(req.TLS)) {
+			http.Error(w, "the client identity is not allowed to set flags, see "+features.DebugProxyIdentities.Name,
+				http.StatusForbidden)
+			return
+		}
+		name, value := req.URL.Query().Get("name"), req.URL.Query().Get("value")
+		if err := features.SetFlag(name, value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		adsLog.Infof("Set flag %s to %q", name, value)
+		s.ConfigUpdate(&model.PushRequest{Full: true})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, err := json.MarshalIndent(features.Flags(), "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+func TestFlagz(t *testing.T) {
+	inspector := "spiffe://cluster.local/ns/istio-system/sa/mesh-inspector"
+	os.Setenv(features.DebugProxyIdentities.Name, inspector)
+	defer os.Unsetenv(features.DebugProxyIdentities.Name)
+	defer os.Unsetenv("PILOT_RESPECT_DNS_TTL")
+	s := &DiscoveryServer{pushChannel: make(chan *model.PushRequest, 1)}
+
+	san, err := util.BuildSubjectAltNameExtension(inspector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &x509.Certificate{Extensions: []pkix.Extension{*san}}
+	newRequest := func(method, url string) *http.Request {
+		req := httptest.NewRequest(method, url, nil)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		return req
+	}
+
+	rr := httptest.NewRecorder()
+	s.flagz(rr, httptest.NewRequest(http.MethodPut, "/debug/flagz?name=PILOT_RESPECT_DNS_TTL&value=false", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("got status %d without a client certificate, want %d", rr.Code, http.StatusForbidden)
+	}
+	if !features.RespectDNSTTL.Get() {
+		t.Fatal("PILOT_RESPECT_DNS_TTL set without a client certificate")
+	}
+
+	rr = httptest.NewRecorder()
+	s.flagz(rr, newRequest(http.MethodPut, "/debug/flagz?name=PILOT_RESPECT_DNS_TTL&value=false"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rr.Code, rr.Body.String())
+	}
+	if features.RespectDNSTTL.Get() {
+		t.Error("PILOT_RESPECT_DNS_TTL not set")
+	}
+	select {
+	case req := <-s.pushChannel:
+		if !req.Full {
+			t.Errorf("got push %+v, want a full push", req)
+		}
+	default:
+		t.Error("no push after setting a flag")
+	}
+
+	flags := []features.Flag{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &flags); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range flags {
+		if f.Name == "PILOT_RESPECT_DNS_TTL" && f.Value != "false" {
+			t.Errorf("got flag %+v, want value false", f)
+		}
+	}
+
+	for _, url := range []string{
+		"/debug/flagz?name=PILOT_RESPECT_DNS_TTL&value=no-way",
+		"/debug/flagz?name=PILOT_DEBOUNCE_MAX&value=1s",
+	} {
+		rr = httptest.NewRecorder()
+		s.flagz(rr, newRequest(http.MethodPost, url))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", url, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -18,7 +18,10 @@ import (
 	"time"
 
 	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
 )
@@ -26,22 +29,28 @@ import (
 func (s *DiscoveryServer) pushLds(con *XdsConnection, push *model.PushContext, version string) error {
 	// TODO: Modify interface to take services, and config instead of making library query registry
 	pushStart := time.Now()
-	rawListeners := s.generateRawListeners(con, push)
+	span := con.startSpan("lds.generate")
+	rawListeners := pinListeners(con, s.generateRawListeners(con, push), time.Now())
+	span.SetTag("listeners", len(rawListeners))
+	finishSpan(span, nil)
 
 	if s.DebugConfigs {
 		con.LDSListeners = rawListeners
 	}
+	con.recordListenerUsage(rawListeners)
 	response := ldsDiscoveryResponse(rawListeners, version, push.Version)
+	span = con.startSpan("lds.send")
 	err := con.send(response)
+	finishSpan(span, err)
 	ldsPushTime.Record(time.Since(pushStart).Seconds())
 	if err != nil {
-		adsLog.Warnf("LDS: Send failure %s: %v", con.ConID, err)
+		ldsLog.Warnf("LDS: Send failure %s: %v", pushLogFields(con, version), err)
 		recordSendError(ldsSendErrPushes, err)
 		return err
 	}
 	ldsPushes.Increment()
 
-	adsLog.Infof("LDS: PUSH for node:%s listeners:%d", con.node.ID, len(rawListeners))
+	ldsLog.Infof("LDS: PUSH %s listeners:%d", pushLogFields(con, version), len(rawListeners))
 	return nil
 }
 
@@ -50,7 +59,7 @@ func (s *DiscoveryServer) generateRawListeners(con *XdsConnection, push *model.P
 
 	for _, l := range rawListeners {
 		if err := l.Validate(); err != nil {
-			adsLog.Errorf("LDS: Generated invalid listener for node:%s: %v, %v", con.node.ID, err, l)
+			ldsLog.Errorf("LDS: Generated invalid listener for node:%s: %v, %v", con.node.ID, err, l)
 			ldsBuildErrPushes.Increment()
 			// Generating invalid listeners is a bug.
 			// Instead of panic, which will break down the whole cluster. Just ignore it here, let envoy process it.
@@ -59,6 +68,55 @@ func (s *DiscoveryServer) generateRawListeners(con *XdsConnection, push *model.P
 	return rawListeners
 }
 
+// pinnedListener holds the filter chains of an outbound listener of a drain exempted port, as first pushed
+// to the proxy.
+type pinnedListener struct {
+	// chains are the pinned filter chains, by their match.
+	chains   map[string]*listener.FilterChain
+	pinnedAt time.Time
+}
+
+// pinListeners replaces the filter chains of the outbound listeners of the drain exempted ports of the proxy
+// with the ones first pushed to it. Envoy drains the connections of a listener when it is modified, resetting
+// the long-lived streams, such as gRPC watches, at every push changing anything in the listener. The chains
+// with a new match are added and the ones no longer generated are removed, and the routes of the HTTP
+// listeners are still updated through RDS. The chains are pinned for DrainExemptionMaxAge at most, so that
+// the changes of their config eventually apply, and a listener is dropped when the port is no longer used.
+func pinListeners(con *XdsConnection, listeners []*xdsapi.Listener, now time.Time) []*xdsapi.Listener {
+	if con.node.Metadata == nil || con.node.Metadata.DrainExemptPorts == "" {
+		return listeners
+	}
+
+	pinned := make(map[string]*pinnedListener)
+	out := make([]*xdsapi.Listener, 0, len(listeners))
+	for _, l := range listeners {
+		if l.TrafficDirection == core.TrafficDirection_OUTBOUND &&
+			con.node.IsDrainExemptPort(int(l.GetAddress().GetSocketAddress().GetPortValue())) {
+			previous, exists := con.pinnedListeners[l.Name]
+			if !exists || now.Sub(previous.pinnedAt) >= features.DrainExemptionMaxAge {
+				previous = &pinnedListener{pinnedAt: now}
+			}
+			current := &pinnedListener{chains: make(map[string]*listener.FilterChain), pinnedAt: previous.pinnedAt}
+			chains := make([]*listener.FilterChain, 0, len(l.FilterChains))
+			for _, chain := range l.FilterChains {
+				key := chain.GetFilterChainMatch().String()
+				if pinnedChain, f := previous.chains[key]; f {
+					chain = pinnedChain
+				}
+				current.chains[key] = chain
+				chains = append(chains, chain)
+			}
+			pl := *l
+			pl.FilterChains = chains
+			l = &pl
+			pinned[l.Name] = current
+		}
+		out = append(out, l)
+	}
+	con.pinnedListeners = pinned
+	return out
+}
+
 // LdsDiscoveryResponse returns a list of listeners for the given environment and source node.
 func ldsDiscoveryResponse(ls []*xdsapi.Listener, version string, noncePrefix string) *xdsapi.DiscoveryResponse {
 	resp := &xdsapi.DiscoveryResponse{
@@ -68,7 +126,7 @@ func ldsDiscoveryResponse(ls []*xdsapi.Listener, version string, noncePrefix str
 	}
 	for _, ll := range ls {
 		if ll == nil {
-			adsLog.Errora("Nil listener ", ll)
+			ldsLog.Errora("Nil listener ", ll)
 			totalXDSInternalErrors.Increment()
 			continue
 		}
@@ -0,0 +1,110 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestPinListeners(t *testing.T) {
+	// Each listener has a catch all filter chain, and a chain of each of the server names, named by version.
+	newListener := func(name string, port uint32, direction core.TrafficDirection, version string,
+		serverNames ...string) *xdsapi.Listener {
+		chains := []*listener.FilterChain{{Name: version}}
+		for _, sni := range serverNames {
+			chains = append(chains, &listener.FilterChain{
+				Name:             version,
+				FilterChainMatch: &listener.FilterChainMatch{ServerNames: []string{sni}},
+			})
+		}
+		return &xdsapi.Listener{
+			Name: name,
+			Address: &core.Address{Address: &core.Address_SocketAddress{SocketAddress: &core.SocketAddress{
+				Address:       "0.0.0.0",
+				PortSpecifier: &core.SocketAddress_PortValue{PortValue: port},
+			}}},
+			TrafficDirection: direction,
+			FilterChains:     chains,
+		}
+	}
+	versions := func(l *xdsapi.Listener) []string {
+		var out []string
+		for _, chain := range l.FilterChains {
+			out = append(out, chain.Name)
+		}
+		return out
+	}
+	con := &XdsConnection{node: &model.Proxy{Metadata: &model.NodeMetadata{DrainExemptPorts: "9090, 15010"}}}
+	start := time.Now()
+
+	first := pinListeners(con, []*xdsapi.Listener{
+		newListener("0.0.0.0_9090", 9090, core.TrafficDirection_OUTBOUND, "v1", "a.example.com"),
+		newListener("0.0.0.0_8080", 8080, core.TrafficDirection_OUTBOUND, "v1"),
+		newListener("10.0.0.1_9090", 9090, core.TrafficDirection_INBOUND, "v1"),
+	}, start)
+	if len(first) != 3 || len(con.pinnedListeners) != 1 {
+		t.Fatalf("got listeners %v and pinned %v, want the outbound 9090 listener pinned", first, con.pinnedListeners)
+	}
+
+	// The existing chains are pinned, the new ones are added.
+	second := pinListeners(con, []*xdsapi.Listener{
+		newListener("0.0.0.0_9090", 9090, core.TrafficDirection_OUTBOUND, "v2", "a.example.com", "b.example.com"),
+		newListener("0.0.0.0_8080", 8080, core.TrafficDirection_OUTBOUND, "v2"),
+		newListener("10.0.0.1_9090", 9090, core.TrafficDirection_INBOUND, "v2"),
+		newListener("0.0.0.0_15010", 15010, core.TrafficDirection_OUTBOUND, "v2"),
+	}, start.Add(time.Minute))
+	want := map[string][]string{
+		"0.0.0.0_9090":  {"v1", "v1", "v2"},
+		"0.0.0.0_8080":  {"v2"},
+		"10.0.0.1_9090": {"v2"},
+		"0.0.0.0_15010": {"v2"},
+	}
+	for _, l := range second {
+		if got := versions(l); !reflect.DeepEqual(got, want[l.Name]) {
+			t.Errorf("got listener %s chain versions %v, want %v", l.Name, got, want[l.Name])
+		}
+	}
+
+	// The chains no longer generated are removed.
+	third := pinListeners(con, []*xdsapi.Listener{
+		newListener("0.0.0.0_9090", 9090, core.TrafficDirection_OUTBOUND, "v3", "b.example.com"),
+		newListener("0.0.0.0_15010", 15010, core.TrafficDirection_OUTBOUND, "v3"),
+	}, start.Add(2*time.Minute))
+	if got := versions(third[0]); !reflect.DeepEqual(got, []string{"v1", "v2"}) {
+		t.Errorf("got chain versions %v, want [v1 v2]", got)
+	}
+
+	// The chains are replaced once pinned for the maximum age.
+	fourth := pinListeners(con, []*xdsapi.Listener{
+		newListener("0.0.0.0_9090", 9090, core.TrafficDirection_OUTBOUND, "v4", "b.example.com"),
+	}, start.Add(features.DrainExemptionMaxAge))
+	if got := versions(fourth[0]); !reflect.DeepEqual(got, []string{"v4", "v4"}) {
+		t.Errorf("got chain versions %v, want [v4 v4]", got)
+	}
+
+	// The listeners no longer generated are unpinned.
+	if _, f := con.pinnedListeners["0.0.0.0_15010"]; f || len(con.pinnedListeners) != 1 {
+		t.Errorf("got pinned listeners %v, want only 0.0.0.0_9090", con.pinnedListeners)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"github.com/gogo/protobuf/proto"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/mesh"
+)
+
+// MeshConfigUpdate sets the mesh config of the environment and pushes it. A change of the locality load balancer
+// settings alone is pushed through EDS only, as the settings only set the priorities and weights of the endpoints
+// generated for each proxy, so that tuning the failover or the distribution of the traffic does not rebuild the
+// listeners and clusters of the mesh. The clusters with inline endpoints, e.g. those resolved by DNS, keep their
+// previous priorities and weights until the next full push.
+func (s *DiscoveryServer) MeshConfigUpdate(mesh *meshconfig.MeshConfig) {
+	old := s.Env.Mesh
+	s.Env.Mesh = mesh
+	if old != nil && mesh != nil && onlyLocalityLbSettingChanged(old, mesh) {
+		s.pushLocalityLbSetting()
+		return
+	}
+	s.ConfigUpdate(&model.PushRequest{Full: true})
+}
+
+// MeshExtensionsUpdate updates the settings of the mesh config which are not MeshConfig fields, and pushes them.
+func (s *DiscoveryServer) MeshExtensionsUpdate(extensions *mesh.Extensions) {
+	s.Env.MeshExtensions = extensions
+	s.ConfigUpdate(&model.PushRequest{Full: true})
+}
+
+// onlyLocalityLbSettingChanged returns true if the mesh configs differ in their locality load balancer settings
+// only.
+func onlyLocalityLbSettingChanged(old, cur *meshconfig.MeshConfig) bool {
+	if proto.Equal(old.LocalityLbSetting, cur.LocalityLbSetting) {
+		return false
+	}
+	oldWithout := proto.Clone(old).(*meshconfig.MeshConfig)
+	oldWithout.LocalityLbSetting = nil
+	curWithout := proto.Clone(cur).(*meshconfig.MeshConfig)
+	curWithout.LocalityLbSetting = nil
+	return proto.Equal(oldWithout, curWithout)
+}
+
+// pushLocalityLbSetting pushes the endpoints of all the clusters watched by the proxies, without a full push.
+func (s *DiscoveryServer) pushLocalityLbSetting() {
+	edsUpdates := make(map[string]struct{})
+	edsClusterMutex.RLock()
+	for clusterName := range edsClusters {
+		_, _, hostname, _ := model.ParseSubsetKey(clusterName)
+		edsUpdates[string(hostname)] = struct{}{}
+	}
+	edsClusterMutex.RUnlock()
+	if len(edsUpdates) == 0 {
+		return
+	}
+	adsLog.Infof("Locality load balancer settings updated, pushing the endpoints of %d services", len(edsUpdates))
+	s.ConfigUpdate(&model.PushRequest{
+		Full:       false,
+		EdsUpdates: edsUpdates,
+	})
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestMeshConfigUpdate(t *testing.T) {
+	const clusterName = "outbound|80|v1|locality-lb.default.svc.cluster.local"
+	s := &DiscoveryServer{
+		Env:         &model.Environment{},
+		pushChannel: make(chan *model.PushRequest, 10),
+	}
+	s.getOrAddEdsCluster(clusterName, "proxy", nil)
+	defer func() {
+		edsClusterMutex.Lock()
+		delete(edsClusters, clusterName)
+		edsClusterMutex.Unlock()
+	}()
+
+	distribute := func(weight uint32) *meshconfig.LocalityLoadBalancerSetting {
+		return &meshconfig.LocalityLoadBalancerSetting{
+			Distribute: []*meshconfig.LocalityLoadBalancerSetting_Distribute{
+				{From: "region1/*", To: map[string]uint32{"region1/*": weight, "region2/*": 100 - weight}},
+			},
+		}
+	}
+
+	cases := []struct {
+		name     string
+		mesh     *meshconfig.MeshConfig
+		wantFull bool
+	}{
+		{
+			name:     "first mesh config",
+			mesh:     &meshconfig.MeshConfig{LocalityLbSetting: distribute(80)},
+			wantFull: true,
+		},
+		{
+			name: "locality weights",
+			mesh: &meshconfig.MeshConfig{LocalityLbSetting: distribute(50)},
+		},
+		{
+			name: "locality settings removed",
+			mesh: &meshconfig.MeshConfig{},
+		},
+		{
+			name:     "unchanged locality settings",
+			mesh:     &meshconfig.MeshConfig{EnableTracing: true},
+			wantFull: true,
+		},
+		{
+			name:     "locality and other settings",
+			mesh:     &meshconfig.MeshConfig{LocalityLbSetting: distribute(50)},
+			wantFull: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s.MeshConfigUpdate(tc.mesh)
+			if s.Env.Mesh != tc.mesh {
+				t.Errorf("got mesh config %v, want %v", s.Env.Mesh, tc.mesh)
+			}
+			req := <-s.pushChannel
+			if req.Full != tc.wantFull {
+				t.Fatalf("got full push %v, want %v", req.Full, tc.wantFull)
+			}
+			// The clusters watched by the connections of the other tests may be pushed as well.
+			if _, f := req.EdsUpdates["locality-lb.default.svc.cluster.local"]; !tc.wantFull && !f {
+				t.Errorf("got EDS updates %v, want the service of the watched cluster", req.EdsUpdates)
+			}
+		})
+	}
+}
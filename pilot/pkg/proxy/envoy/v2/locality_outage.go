@@ -0,0 +1,422 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+)
+
+// maxLocalityOutageTTL bounds the lifetime of a simulated outage, which is meant for a failover rehearsal.
+const maxLocalityOutageTTL = 12 * time.Hour
+
+// The modes of a simulated locality outage.
+const (
+	// LocalityOutageDrop removes the endpoints of the locality.
+	LocalityOutageDrop = "drop"
+	// LocalityOutageDeprioritize moves the endpoints of the locality to the lowest priority, so they only
+	// receive traffic once the endpoints of the other localities are unhealthy.
+	LocalityOutageDeprioritize = "deprioritize"
+)
+
+// LocalityOutage temporarily simulates the outage of a locality for a proxy, or for the proxies of a
+// namespace, in their endpoints.
+type LocalityOutage struct {
+	// ProxyID or Namespace of the proxies seeing the outage, exactly one is set.
+	ProxyID   string `json:"proxyID,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// Locality is the region, region/zone or region/zone/subzone of the outage.
+	Locality string `json:"locality"`
+	// Mode is drop, the default, or deprioritize.
+	Mode string `json:"mode,omitempty"`
+	// TTL is the lifetime of the outage, as a duration string such as "10m".
+	TTL string `json:"ttl,omitempty"`
+	// Expires is the time the outage ends, set by Pilot.
+	Expires time.Time `json:"expires"`
+
+	timer *time.Timer
+}
+
+func (o *LocalityOutage) key() string {
+	return o.ProxyID + "|" + o.Namespace + "|" + o.Locality
+}
+
+// appliesTo returns true if the outage is seen by the proxy.
+func (o *LocalityOutage) appliesTo(node *model.Proxy) bool {
+	if o.ProxyID != "" {
+		return node.ID == o.ProxyID
+	}
+	return node.ConfigNamespace == o.Namespace
+}
+
+// matches returns true if the locality is in the locality of the outage.
+func (o *LocalityOutage) matches(locality string) bool {
+	return locality == o.Locality || strings.HasPrefix(locality, o.Locality+"/")
+}
+
+// localityOutages holds the active outages, by key.
+type localityOutages struct {
+	mu      sync.RWMutex
+	outages map[string]*LocalityOutage
+
+	// store shares the outages across the Pilot replicas, the outages are only set on this replica if nil.
+	store LocalityOutageStore
+}
+
+func newLocalityOutages() *localityOutages {
+	return &localityOutages{outages: map[string]*LocalityOutage{}}
+}
+
+// set adds or replaces an outage, calling expire once it expired. It returns false if the outage already expired.
+func (o *localityOutages) set(outage *LocalityOutage, expire func()) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.setLocked(outage, expire)
+}
+
+func (o *localityOutages) setLocked(outage *LocalityOutage, expire func()) bool {
+	ttl := time.Until(outage.Expires)
+	if ttl <= 0 {
+		return false
+	}
+	key := outage.key()
+	if previous := o.outages[key]; previous != nil {
+		previous.timer.Stop()
+	}
+	outage.timer = time.AfterFunc(ttl, func() {
+		if o.remove(key, outage) {
+			expire()
+		}
+	})
+	o.outages[key] = outage
+	return true
+}
+
+// remove removes the outage of the key, only if it is the given one when not nil.
+func (o *localityOutages) remove(key string, outage *LocalityOutage) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	current := o.outages[key]
+	if current == nil || (outage != nil && current != outage) {
+		return false
+	}
+	current.timer.Stop()
+	delete(o.outages, key)
+	return true
+}
+
+// replace replaces the outages with the shared ones, calling expire with the outages once they expired. It returns
+// the outages set, changed or removed, whose proxies are pushed.
+func (o *localityOutages) replace(outages []*LocalityOutage, expire func(*LocalityOutage)) []*LocalityOutage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var changed []*LocalityOutage
+	keys := make(map[string]bool, len(outages))
+	for _, outage := range outages {
+		outage := outage
+		key := outage.key()
+		if current := o.outages[key]; current != nil && current.Mode == outage.Mode &&
+			current.Expires.Equal(outage.Expires) {
+			keys[key] = true
+			continue
+		}
+		if o.setLocked(outage, func() { expire(outage) }) {
+			keys[key] = true
+			changed = append(changed, outage)
+		}
+	}
+	for key, current := range o.outages {
+		if !keys[key] {
+			current.timer.Stop()
+			delete(o.outages, key)
+			changed = append(changed, current)
+		}
+	}
+	return changed
+}
+
+// list returns the active outages, sorted by key.
+func (o *localityOutages) list() []*LocalityOutage {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	out := make([]*LocalityOutage, 0, len(o.outages))
+	for _, outage := range o.outages {
+		out = append(out, outage)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].key() < out[j].key() })
+	return out
+}
+
+// apply returns the cluster load assignment with the outages seen by the proxy applied. The assignment is copied
+// if modified, the generated assignments may be shared with other proxies.
+func (o *localityOutages) apply(node *model.Proxy, cla *xdsapi.ClusterLoadAssignment) *xdsapi.ClusterLoadAssignment {
+	if o == nil || cla == nil {
+		return cla
+	}
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	var outages []*LocalityOutage
+	for _, outage := range o.outages {
+		if outage.appliesTo(node) {
+			outages = append(outages, outage)
+		}
+	}
+	if len(outages) == 0 {
+		return cla
+	}
+
+	var lowestPriority uint32
+	for _, localityEndpoints := range cla.Endpoints {
+		if localityEndpoints.Priority > lowestPriority {
+			lowestPriority = localityEndpoints.Priority
+		}
+	}
+	endpoints := make([]*endpoint.LocalityLbEndpoints, 0, len(cla.Endpoints))
+	modified := false
+	for _, localityEndpoints := range cla.Endpoints {
+		mode := ""
+		locality := util.LocalityToString(localityEndpoints.Locality)
+		for _, outage := range outages {
+			if outage.matches(locality) && mode != LocalityOutageDrop {
+				mode = outage.Mode
+			}
+		}
+		switch mode {
+		case LocalityOutageDrop:
+			modified = true
+			continue
+		case LocalityOutageDeprioritize:
+			modified = true
+			deprioritized := *localityEndpoints
+			deprioritized.Priority = lowestPriority + 1
+			localityEndpoints = &deprioritized
+		}
+		endpoints = append(endpoints, localityEndpoints)
+	}
+	if !modified {
+		return cla
+	}
+	out := util.CloneClusterLoadAssignment(cla)
+	out.Endpoints = renumberPriorities(endpoints)
+	return &out
+}
+
+// renumberPriorities renumbers the priorities of the endpoints contiguously from 0, as Envoy requires, once the
+// endpoints of a priority are dropped or deprioritized. The renumbered endpoints are copied.
+func renumberPriorities(endpoints []*endpoint.LocalityLbEndpoints) []*endpoint.LocalityLbEndpoints {
+	priorities := make(map[uint32]uint32)
+	for _, localityEndpoints := range endpoints {
+		priorities[localityEndpoints.Priority] = 0
+	}
+	sorted := make([]uint32, 0, len(priorities))
+	for priority := range priorities {
+		sorted = append(sorted, priority)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for i, priority := range sorted {
+		priorities[priority] = uint32(i)
+	}
+	for i, localityEndpoints := range endpoints {
+		if priority := priorities[localityEndpoints.Priority]; priority != localityEndpoints.Priority {
+			renumbered := *localityEndpoints
+			renumbered.Priority = priority
+			endpoints[i] = &renumbered
+		}
+	}
+	return endpoints
+}
+
+// pushNamespace triggers a full push to the connections to this Pilot of the proxies of the namespace.
+func (s *DiscoveryServer) pushNamespace(namespace string) {
+	adsClientsMutex.RLock()
+	connections := make([]*XdsConnection, 0)
+	for _, con := range adsClients {
+		if con.node != nil && con.node.ConfigNamespace == namespace {
+			connections = append(connections, con)
+		}
+	}
+	adsClientsMutex.RUnlock()
+
+	for _, con := range connections {
+		s.pushQueue.Enqueue(con, &model.PushRequest{
+			Full:  true,
+			Push:  s.globalPushContext(),
+			Start: time.Now(),
+		})
+	}
+}
+
+func (s *DiscoveryServer) pushLocalityOutage(outage *LocalityOutage) {
+	if outage.ProxyID != "" {
+		s.pushProxy(outage.ProxyID)
+	} else {
+		s.pushNamespace(outage.Namespace)
+	}
+}
+
+func (s *DiscoveryServer) expireLocalityOutage(outage *LocalityOutage) {
+	adsLog.Infof("Simulated outage of locality %s for %s%s ended", outage.Locality, outage.ProxyID, outage.Namespace)
+	s.pushLocalityOutage(outage)
+}
+
+// SetLocalityOutages replaces the simulated locality outages with the ones shared across the Pilot replicas, and
+// pushes the proxies connected to this Pilot seeing a change.
+func (s *DiscoveryServer) SetLocalityOutages(outages []*LocalityOutage) {
+	for _, outage := range s.localityOutages.replace(outages, s.expireLocalityOutage) {
+		s.pushLocalityOutage(outage)
+	}
+}
+
+// localityOutagez lists the simulated locality outages with GET, sets one with POST and ends one with DELETE,
+// given the proxyID or namespace, and locality query parameters. The outages are pushed to the proxies right
+// away, and end once their TTL elapsed. With a LocalityOutageStore, the outages are set through the store and
+// pushed by all the Pilot replicas. Setting and ending an outage requires a verified client certificate with one
+// of the identities of PILOT_DEBUG_PROXY_IDENTITIES.
+func (s *DiscoveryServer) localityOutagez(w http.ResponseWriter, req *http.Request) {
+	if s.localityOutages == nil {
+		http.Error(w, "Locality outages are not supported", http.StatusNotImplemented)
+		return
+	}
+	if req.Method != http.MethodGet && !debugIdentityAllowed(verifiedIdentities(req.TLS)) {
+		http.Error(w, "the client identity is not allowed to simulate outages, see "+features.DebugProxyIdentities.Name,
+			http.StatusForbidden)
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+		writeLocalityOutageJSON(w, s.localityOutages.list())
+	case http.MethodPost:
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		outage := &LocalityOutage{}
+		if err := json.Unmarshal(body, outage); err != nil {
+			http.Error(w, fmt.Sprintf("invalid outage: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := validateLocalityOutage(outage); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if store := s.localityOutages.store; store != nil {
+			err = store.Update(func(outages []*LocalityOutage) []*LocalityOutage {
+				out := []*LocalityOutage{outage}
+				for _, o := range outages {
+					if o.key() != outage.key() && time.Now().Before(o.Expires) {
+						out = append(out, o)
+					}
+				}
+				return out
+			})
+			if err != nil {
+				http.Error(w, fmt.Sprintf("cannot share the outage: %v", err), http.StatusInternalServerError)
+				return
+			}
+		} else {
+			s.localityOutages.set(outage, func() { s.expireLocalityOutage(outage) })
+			s.pushLocalityOutage(outage)
+		}
+		adsLog.Infof("Simulated outage of locality %s for %s%s set until %v", outage.Locality, outage.ProxyID,
+			outage.Namespace, outage.Expires)
+		writeLocalityOutageJSON(w, outage)
+	case http.MethodDelete:
+		query := req.URL.Query()
+		outage := &LocalityOutage{
+			ProxyID:   query.Get("proxyID"),
+			Namespace: query.Get("namespace"),
+			Locality:  strings.Trim(query.Get("locality"), "/"),
+		}
+		found := false
+		if store := s.localityOutages.store; store != nil {
+			err := store.Update(func(outages []*LocalityOutage) []*LocalityOutage {
+				found = false
+				out := make([]*LocalityOutage, 0, len(outages))
+				for _, o := range outages {
+					if o.key() == outage.key() {
+						found = true
+					} else if time.Now().Before(o.Expires) {
+						out = append(out, o)
+					}
+				}
+				return out
+			})
+			if err != nil {
+				http.Error(w, fmt.Sprintf("cannot share the outage: %v", err), http.StatusInternalServerError)
+				return
+			}
+		} else if found = s.localityOutages.remove(outage.key(), nil); found {
+			s.pushLocalityOutage(outage)
+		}
+		if !found {
+			http.Error(w, "No outage of this locality", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "Only GET, POST and DELETE are supported", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeLocalityOutageJSON(w http.ResponseWriter, v interface{}) {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(out)
+}
+
+// validateLocalityOutage validates the outage, defaulting its mode and setting its expiry from its TTL.
+func validateLocalityOutage(outage *LocalityOutage) error {
+	if (outage.ProxyID == "") == (outage.Namespace == "") {
+		return fmt.Errorf("exactly one of proxyID and namespace is required")
+	}
+	outage.Locality = strings.Trim(outage.Locality, "/")
+	if outage.Locality == "" {
+		return fmt.Errorf("locality is required")
+	}
+	switch outage.Mode {
+	case "":
+		outage.Mode = LocalityOutageDrop
+	case LocalityOutageDrop, LocalityOutageDeprioritize:
+	default:
+		return fmt.Errorf("invalid mode %q: must be %s or %s", outage.Mode, LocalityOutageDrop, LocalityOutageDeprioritize)
+	}
+	ttl, err := time.ParseDuration(outage.TTL)
+	if err != nil {
+		return fmt.Errorf("invalid ttl %q: %v", outage.TTL, err)
+	}
+	if ttl <= 0 || ttl > maxLocalityOutageTTL {
+		return fmt.Errorf("ttl must be positive and at most %v", maxLocalityOutageTTL)
+	}
+	outage.Expires = time.Now().Add(ttl)
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// LocalityOutagesConfigMap is the name of the config map sharing the simulated locality outages across the
+	// Pilot replicas.
+	LocalityOutagesConfigMap = "istio-locality-outages"
+
+	// localityOutagesKey is the key of the outages, encoded as a JSON list, in the config map.
+	localityOutagesKey = "outages"
+)
+
+// LocalityOutageStore shares the simulated locality outages across the Pilot replicas, which watch the store and
+// set the outages with SetLocalityOutages.
+type LocalityOutageStore interface {
+	// Update replaces the shared outages with the ones returned by update.
+	Update(update func([]*LocalityOutage) []*LocalityOutage) error
+}
+
+// SetLocalityOutageStore sets the store the outages of /debug/locality_outagez are shared through.
+func (s *DiscoveryServer) SetLocalityOutageStore(store LocalityOutageStore) {
+	s.localityOutages.store = store
+}
+
+// ConfigMapLocalityOutageStore shares the simulated locality outages through the LocalityOutagesConfigMap.
+type ConfigMapLocalityOutageStore struct {
+	client    kubernetes.Interface
+	namespace string
+	informer  cache.SharedIndexInformer
+}
+
+var _ LocalityOutageStore = &ConfigMapLocalityOutageStore{}
+
+// NewConfigMapLocalityOutageStore creates a store of the config map of the namespace, calling onChange with the
+// outages when the config map changes.
+func NewConfigMapLocalityOutageStore(client kubernetes.Interface, namespace string, resyncPeriod time.Duration,
+	onChange func([]*LocalityOutage)) *ConfigMapLocalityOutageStore {
+	s := &ConfigMapLocalityOutageStore{
+		client:    client,
+		namespace: namespace,
+		informer: cache.NewSharedIndexInformer(
+			cache.NewListWatchFromClient(client.CoreV1().RESTClient(), "configmaps", namespace,
+				fields.OneTermEqualSelector("metadata.name", LocalityOutagesConfigMap)),
+			&v1.ConfigMap{}, resyncPeriod, cache.Indexers{}),
+	}
+	update := func(obj interface{}) {
+		outages, err := decodeLocalityOutages(obj.(*v1.ConfigMap))
+		if err != nil {
+			adsLog.Warnf("Invalid locality outages in config map %s/%s: %v", namespace, LocalityOutagesConfigMap, err)
+			return
+		}
+		onChange(outages)
+	}
+	s.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    update,
+		UpdateFunc: func(_, cur interface{}) { update(cur) },
+		DeleteFunc: func(interface{}) { onChange(nil) },
+	})
+	return s
+}
+
+// Run watches the config map until the stop channel is closed.
+func (s *ConfigMapLocalityOutageStore) Run(stop <-chan struct{}) {
+	s.informer.Run(stop)
+}
+
+// Update implements LocalityOutageStore, creating the config map if needed.
+func (s *ConfigMapLocalityOutageStore) Update(update func([]*LocalityOutage) []*LocalityOutage) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+		cm, err := configMaps.Get(LocalityOutagesConfigMap, metav1.GetOptions{})
+		create := errors.IsNotFound(err)
+		if create {
+			cm = &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: LocalityOutagesConfigMap, Namespace: s.namespace}}
+		} else if err != nil {
+			return err
+		}
+		outages, err := decodeLocalityOutages(cm)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(update(outages))
+		if err != nil {
+			return err
+		}
+		cm.Data = map[string]string{localityOutagesKey: string(data)}
+		if create {
+			_, err = configMaps.Create(cm)
+		} else {
+			_, err = configMaps.Update(cm)
+		}
+		return err
+	})
+}
+
+func decodeLocalityOutages(cm *v1.ConfigMap) ([]*LocalityOutage, error) {
+	data, ok := cm.Data[localityOutagesKey]
+	if !ok {
+		return nil, nil
+	}
+	var outages []*LocalityOutage
+	if err := json.Unmarshal([]byte(data), &outages); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", localityOutagesKey, err)
+	}
+	return outages, nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestLocalityOutages(t *testing.T) {
+	shared := &xdsapi.ClusterLoadAssignment{
+		ClusterName: "outbound|9080||reviews.default.svc.cluster.local",
+		Endpoints: []*endpoint.LocalityLbEndpoints{
+			{Locality: &core.Locality{Region: "us-east1", Zone: "us-east1-b"}},
+			{Locality: &core.Locality{Region: "us-east1", Zone: "us-east1-c"}, Priority: 1},
+			{Locality: &core.Locality{Region: "us-west1", Zone: "us-west1-a"}, Priority: 2},
+		},
+	}
+	productpage := &model.Proxy{ID: "productpage.default", ConfigNamespace: "default"}
+	ratings := &model.Proxy{ID: "ratings.default", ConfigNamespace: "default"}
+	ingress := &model.Proxy{ID: "ingress.istio-system", ConfigNamespace: "istio-system"}
+
+	outages := newLocalityOutages()
+	expired := make(chan struct{})
+	outages.set(&LocalityOutage{ProxyID: productpage.ID, Locality: "us-east1/us-east1-b", Mode: LocalityOutageDrop,
+		Expires: time.Now().Add(50 * time.Millisecond)}, func() { close(expired) })
+	outages.set(&LocalityOutage{Namespace: "default", Locality: "us-east1", Mode: LocalityOutageDeprioritize,
+		Expires: time.Now().Add(time.Hour)}, func() {})
+
+	got := outages.apply(productpage, shared)
+	if len(got.Endpoints) != 2 {
+		t.Fatalf("got endpoints %v, want the dropped locality removed", got.Endpoints)
+	}
+	// The priorities are renumbered contiguously once us-east1-b is dropped and us-east1-c deprioritized.
+	if got.Endpoints[0].Locality.Zone != "us-east1-c" || got.Endpoints[0].Priority != 1 {
+		t.Errorf("got endpoints %v, want us-east1-c deprioritized", got.Endpoints[0])
+	}
+	if got.Endpoints[1].Locality.Zone != "us-west1-a" || got.Endpoints[1].Priority != 0 {
+		t.Errorf("got endpoints %v, want us-west1-a at the highest priority", got.Endpoints[1])
+	}
+	if len(shared.Endpoints) != 3 || shared.Endpoints[1].Priority != 1 || shared.Endpoints[2].Priority != 2 {
+		t.Errorf("the generated assignment was modified: %v", shared)
+	}
+
+	got = outages.apply(ratings, shared)
+	if len(got.Endpoints) != 3 || got.Endpoints[0].Priority != 1 || got.Endpoints[1].Priority != 1 ||
+		got.Endpoints[2].Priority != 0 {
+		t.Errorf("got endpoints %v, want us-east1 deprioritized", got.Endpoints)
+	}
+	if got := outages.apply(ingress, shared); got != shared {
+		t.Errorf("got assignment %v modified for a proxy of another namespace", got)
+	}
+
+	select {
+	case <-expired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the outage did not expire")
+	}
+	if len(outages.list()) != 1 {
+		t.Errorf("got outages %v after expiry, want only the namespace one", outages.list())
+	}
+}
+
+func TestValidateLocalityOutage(t *testing.T) {
+	cases := []struct {
+		name    string
+		outage  *LocalityOutage
+		wantErr bool
+	}{
+		{"proxy", &LocalityOutage{ProxyID: "productpage.default", Locality: "us-east1/", TTL: "10m"}, false},
+		{"namespace", &LocalityOutage{Namespace: "default", Locality: "us-east1", Mode: "deprioritize", TTL: "1h"}, false},
+		{"no target", &LocalityOutage{Locality: "us-east1", TTL: "10m"}, true},
+		{"both targets", &LocalityOutage{ProxyID: "productpage.default", Namespace: "default", Locality: "us-east1", TTL: "10m"}, true},
+		{"no locality", &LocalityOutage{Namespace: "default", TTL: "10m"}, true},
+		{"invalid mode", &LocalityOutage{Namespace: "default", Locality: "us-east1", Mode: "fail", TTL: "10m"}, true},
+		{"no ttl", &LocalityOutage{Namespace: "default", Locality: "us-east1"}, true},
+		{"ttl too long", &LocalityOutage{Namespace: "default", Locality: "us-east1", TTL: "48h"}, true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateLocalityOutage(tt.outage)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateLocalityOutage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (tt.outage.Mode == "" || tt.outage.Locality != "us-east1" || tt.outage.Expires.IsZero()) {
+				t.Errorf("got outage %+v, want the mode defaulted, the locality trimmed and the expiry set", tt.outage)
+			}
+		})
+	}
+}
+
+func TestReplaceLocalityOutages(t *testing.T) {
+	expires := time.Now().Add(time.Hour)
+	outages := newLocalityOutages()
+	outages.set(&LocalityOutage{Namespace: "default", Locality: "us-east1", Mode: LocalityOutageDrop, Expires: expires},
+		func() {})
+	outages.set(&LocalityOutage{Namespace: "prod", Locality: "us-east1", Mode: LocalityOutageDrop, Expires: expires},
+		func() {})
+
+	changed := outages.replace([]*LocalityOutage{
+		{Namespace: "default", Locality: "us-east1", Mode: LocalityOutageDrop, Expires: expires},
+		{ProxyID: "productpage.default", Locality: "us-west1", Mode: LocalityOutageDrop, Expires: expires},
+		{ProxyID: "ratings.default", Locality: "us-west1", Mode: LocalityOutageDrop, Expires: time.Now().Add(-time.Minute)},
+	}, func(*LocalityOutage) {})
+
+	got := make([]string, 0, len(changed))
+	for _, outage := range changed {
+		got = append(got, outage.key())
+	}
+	sort.Strings(got)
+	want := []string{"productpage.default||us-west1", "|prod|us-east1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got changed outages %v, want %v", got, want)
+	}
+	if len(outages.list()) != 2 {
+		t.Errorf("got outages %v, want the unchanged and the set ones", outages.list())
+	}
+}
+
+func TestLocalityOutagezAuthorization(t *testing.T) {
+	s := &DiscoveryServer{localityOutages: newLocalityOutages()}
+	body := `{"namespace": "default", "locality": "us-east1", "ttl": "10m"}`
+	w := httptest.NewRecorder()
+	s.localityOutagez(w, httptest.NewRequest(http.MethodPost, "/debug/locality_outagez", strings.NewReader(body)))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got status %d setting an outage without a client certificate, want %d", w.Code, http.StatusForbidden)
+	}
+	if len(s.localityOutages.list()) != 0 {
+		t.Errorf("got outages %v set without a client certificate", s.localityOutages.list())
+	}
+
+	w = httptest.NewRecorder()
+	s.localityOutagez(w, httptest.NewRequest(http.MethodGet, "/debug/locality_outagez", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("got status %d listing the outages, want %d", w.Code, http.StatusOK)
+	}
+}
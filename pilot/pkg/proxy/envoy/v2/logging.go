@@ -0,0 +1,129 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	istiolog "istio.io/pkg/log"
+)
+
+var (
+	cdsLog = istiolog.RegisterScope("cds", "cds debugging", 0)
+	edsLog = istiolog.RegisterScope("eds", "eds debugging", 0)
+	ldsLog = istiolog.RegisterScope("lds", "lds debugging", 0)
+	rdsLog = istiolog.RegisterScope("rds", "rds debugging", 0)
+
+	logLevels = map[string]istiolog.Level{
+		"none":  istiolog.NoneLevel,
+		"error": istiolog.ErrorLevel,
+		"warn":  istiolog.WarnLevel,
+		"info":  istiolog.InfoLevel,
+		"debug": istiolog.DebugLevel,
+	}
+)
+
+// LogScope is the output level of a logging scope, as returned by /debug/logging.
+type LogScope struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Level       string `json:"level"`
+}
+
+// pushLogFields returns the fields correlating the logs of a push to a proxy: the proxy and connection IDs,
+// and the version of the push.
+func pushLogFields(con *XdsConnection, version string) string {
+	return fmt.Sprintf("node:%s conn:%s push:%s", con.node.ID, con.ConID, version)
+}
+
+// loggingz lists the logging scopes with their output level, and sets the output level of scopes at runtime.
+// Set with a PUT or POST of scope, a comma separated list of scopes or '*' for all of them, and level,
+// one of none, error, warn, info or debug: /debug/logging?scope=eds,registry-kube&level=debug
+func loggingz(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		level, ok := logLevels[strings.ToLower(req.URL.Query().Get("level"))]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Invalid level %q", req.URL.Query().Get("level")), http.StatusBadRequest)
+			return
+		}
+		scopes, err := findLogScopes(req.URL.Query().Get("scope"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, scope := range scopes {
+			scope.SetOutputLevel(level)
+			adsLog.Infof("Set output level of logging scope %s to %s", scope.Name(), logLevelName(level))
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	scopes := istiolog.Scopes()
+	out := make([]LogScope, 0, len(scopes))
+	for _, scope := range scopes {
+		out = append(out, LogScope{
+			Name:        scope.Name(),
+			Description: scope.Description(),
+			Level:       logLevelName(scope.GetOutputLevel()),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+// findLogScopes returns the scopes of a comma separated list of names, or all the scopes for '*'.
+func findLogScopes(names string) ([]*istiolog.Scope, error) {
+	if names == "*" {
+		out := make([]*istiolog.Scope, 0)
+		for _, scope := range istiolog.Scopes() {
+			out = append(out, scope)
+		}
+		return out, nil
+	}
+	out := make([]*istiolog.Scope, 0)
+	for _, name := range strings.Split(names, ",") {
+		scope := istiolog.FindScope(strings.TrimSpace(name))
+		if scope == nil {
+			return nil, fmt.Errorf("unknown logging scope %q", name)
+		}
+		out = append(out, scope)
+	}
+	return out, nil
+}
+
+func logLevelName(level istiolog.Level) string {
+	for name, l := range logLevels {
+		if l == level {
+			return name
+		}
+	}
+	return fmt.Sprintf("%d", level)
+}
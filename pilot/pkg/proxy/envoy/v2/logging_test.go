@@ -0,0 +1,69 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	istiolog "istio.io/pkg/log"
+)
+
+func TestLoggingz(t *testing.T) {
+	edsLevel, rdsLevel := edsLog.GetOutputLevel(), rdsLog.GetOutputLevel()
+	defer func() {
+		edsLog.SetOutputLevel(edsLevel)
+		rdsLog.SetOutputLevel(rdsLevel)
+	}()
+
+	rr := httptest.NewRecorder()
+	loggingz(rr, httptest.NewRequest(http.MethodPut, "/debug/logging?scope=eds,rds&level=debug", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rr.Code, rr.Body.String())
+	}
+	if edsLog.GetOutputLevel() != istiolog.DebugLevel || rdsLog.GetOutputLevel() != istiolog.DebugLevel {
+		t.Errorf("output level not set")
+	}
+
+	rr = httptest.NewRecorder()
+	loggingz(rr, httptest.NewRequest(http.MethodGet, "/debug/logging", nil))
+	scopes := []LogScope{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &scopes); err != nil {
+		t.Fatal(err)
+	}
+	levels := map[string]string{}
+	for _, scope := range scopes {
+		levels[scope.Name] = scope.Level
+	}
+	for name, want := range map[string]string{"eds": "debug", "rds": "debug", "cds": logLevelName(cdsLog.GetOutputLevel())} {
+		if levels[name] != want {
+			t.Errorf("got level %q for scope %s, want %q", levels[name], name, want)
+		}
+	}
+
+	for _, url := range []string{
+		"/debug/logging?scope=eds&level=verbose",
+		"/debug/logging?scope=unknown&level=info",
+		"/debug/logging?level=info",
+	} {
+		rr = httptest.NewRecorder()
+		loggingz(rr, httptest.NewRequest(http.MethodPost, url, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", url, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
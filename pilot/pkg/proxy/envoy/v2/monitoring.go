@@ -26,6 +26,10 @@ var (
 	nodeTag    = monitoring.MustCreateLabel("node")
 	typeTag    = monitoring.MustCreateLabel("type")
 
+	localityTag      = monitoring.MustCreateLabel("locality")
+	proxyLocalityTag = monitoring.MustCreateLabel("proxy_locality")
+	priorityTag      = monitoring.MustCreateLabel("priority")
+
 	cdsReject = monitoring.NewGauge(
 		"pilot_xds_cds_reject",
 		"Pilot rejected CSD configs.",
@@ -44,6 +48,13 @@ var (
 		monitoring.WithLabels(clusterTag),
 	)
 
+	edsLocalityEndpoints = monitoring.NewGauge(
+		"pilot_xds_eds_locality_endpoints",
+		"Endpoints of each cluster assigned to each locality and priority, as of last push to the proxies "+
+			"of a locality. Only recorded when locality load balancing is enabled.",
+		monitoring.WithLabels(clusterTag, proxyLocalityTag, localityTag, priorityTag),
+	)
+
 	ldsReject = monitoring.NewGauge(
 		"pilot_xds_lds_reject",
 		"Pilot rejected LDS.",
@@ -78,6 +89,12 @@ var (
 		"Number of endpoints connected to this pilot using XDS.",
 	)
 
+	xdsRejectedConnections = monitoring.NewSum(
+		"pilot_xds_rejected_connections",
+		"Total number of XDS connections rejected by the connection limits, by limit.",
+		monitoring.WithLabels(typeTag),
+	)
+
 	xdsResponseWriteTimeouts = monitoring.NewSum(
 		"pilot_xds_write_timeout",
 		"Pilot XDS response write timeouts.",
@@ -114,6 +131,25 @@ var (
 	ldsPushTime = pushTime.With(typeTag.Value("lds"))
 	rdsPushTime = pushTime.With(typeTag.Value("rds"))
 
+	configSize = monitoring.NewDistribution(
+		"pilot_xds_config_size_bytes",
+		"Distribution of the size in bytes of the lds, rds, cds and eds responses sent to proxies.",
+		[]float64{1, 10000, 1000000, 4000000, 10000000, 40000000},
+		monitoring.WithLabels(typeTag),
+	)
+
+	unusedConfigs = monitoring.NewGauge(
+		"pilot_unused_configs",
+		"Number of VirtualServices, DestinationRules and EnvoyFilters that influenced no cluster, route or "+
+			"listener in the last push to the connected proxies, by type.",
+		monitoring.WithLabels(typeTag),
+	)
+
+	configSizeExceeded = monitoring.NewSum(
+		"pilot_xds_config_size_exceeded",
+		"Number of times the total configuration of a proxy grew above PILOT_CONFIG_SIZE_WARNING_BYTES.",
+	)
+
 	// only supported dimension is millis, unfortunately. default to unitdimensionless.
 	proxiesQueueTime = monitoring.NewDistribution(
 		"pilot_proxy_queue_time",
@@ -138,6 +174,13 @@ var (
 		"Total number of internal XDS errors in pilot.",
 	)
 
+	xdsConsistencyViolations = monitoring.NewSum(
+		"pilot_xds_consistency_violations",
+		"Total number of violations of the invariants of the generated configs, by invariant. "+
+			"Only recorded when PILOT_ENABLE_XDS_CONSISTENCY_CHECK is enabled.",
+		monitoring.WithLabels(typeTag),
+	)
+
 	inboundUpdates = monitoring.NewSum(
 		"pilot_inbound_updates",
 		"Total number of updates received by pilot.",
@@ -170,17 +213,23 @@ func init() {
 		ldsReject,
 		rdsReject,
 		edsInstances,
+		edsLocalityEndpoints,
 		rdsExpiredNonce,
 		totalXDSRejects,
 		monServices,
 		xdsClients,
+		xdsRejectedConnections,
 		xdsResponseWriteTimeouts,
 		pushes,
 		pushTime,
+		configSize,
+		configSizeExceeded,
+		unusedConfigs,
 		proxiesConvergeDelay,
 		proxiesQueueTime,
 		pushContextErrors,
 		totalXDSInternalErrors,
+		xdsConsistencyViolations,
 		inboundUpdates,
 	)
 }
@@ -0,0 +1,66 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"strings"
+	"time"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+// rampWeights pushes the virtual services every WeightRampInterval while their route weights are ramped, and
+// persists the progress of the ramps in the virtual services.
+func (s *DiscoveryServer) rampWeights(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(features.WeightRampInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			if s.Env.WeightRamps.Step(now) {
+				s.ConfigUpdate(&model.PushRequest{
+					Full:               true,
+					ConfigTypesUpdated: map[string]struct{}{schemas.VirtualService.Type: {}},
+				})
+			}
+			s.writeRampStatuses(s.Env.WeightRamps.TakeStatusUpdates())
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// writeRampStatuses sets the RampStatusAnnotation of the virtual services, by namespace/name.
+func (s *DiscoveryServer) writeRampStatuses(statuses map[string]string) {
+	for key, status := range statuses {
+		parts := strings.SplitN(key, "/", 2)
+		vs := s.Env.IstioConfigStore.Get(schemas.VirtualService.Type, parts[1], parts[0])
+		if vs == nil {
+			continue
+		}
+		updated := vs.DeepCopy()
+		annotations := make(map[string]string, len(vs.Annotations)+1)
+		for k, v := range vs.Annotations {
+			annotations[k] = v
+		}
+		annotations[model.RampStatusAnnotation] = status
+		updated.Annotations = annotations
+		if _, err := s.Env.IstioConfigStore.Update(updated); err != nil {
+			adsLog.Warnf("failed to write the weight ramp status of virtual service %s: %v", key, err)
+		}
+	}
+}
@@ -21,34 +21,41 @@ import (
 
 	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
 )
 
 func (s *DiscoveryServer) pushRoute(con *XdsConnection, push *model.PushContext, version string) error {
 	pushStart := time.Now()
+	span := con.startSpan("rds.generate")
 	rawRoutes := s.generateRawRoutes(con, push)
+	span.SetTag("routes", len(rawRoutes))
+	finishSpan(span, nil)
 	if s.DebugConfigs {
 		for _, r := range rawRoutes {
 			con.RouteConfigs[r.Name] = r
-			if adsLog.DebugEnabled() {
+			if rdsLog.DebugEnabled() {
 				resp, _ := protomarshal.ToJSONWithIndent(r, " ")
-				adsLog.Debugf("RDS: Adding route:%s for node:%v", resp, con.node.ID)
+				rdsLog.Debugf("RDS: Adding route:%s for node:%v", resp, con.node.ID)
 			}
 		}
 	}
 
+	con.recordRouteUsage(rawRoutes)
 	response := routeDiscoveryResponse(rawRoutes, version, push.Version)
+	span = con.startSpan("rds.send")
 	err := con.send(response)
+	finishSpan(span, err)
 	rdsPushTime.Record(time.Since(pushStart).Seconds())
 	if err != nil {
-		adsLog.Warnf("RDS: Send failure for node:%v: %v", con.node.ID, err)
+		rdsLog.Warnf("RDS: Send failure %s: %v", pushLogFields(con, version), err)
 		recordSendError(rdsSendErrPushes, err)
 		return err
 	}
 	rdsPushes.Increment()
 
-	adsLog.Infof("RDS: PUSH for node:%s routes:%d", con.node.ID, len(rawRoutes))
+	rdsLog.Infof("RDS: PUSH %s routes:%d", pushLogFields(con, version), len(rawRoutes))
 	return nil
 }
 
@@ -57,12 +64,15 @@ func (s *DiscoveryServer) generateRawRoutes(con *XdsConnection, push *model.Push
 	// Now validate each route
 	for _, r := range rawRoutes {
 		if err := r.Validate(); err != nil {
-			adsLog.Errorf("RDS: Generated invalid routes for route:%s for node:%v: %v, %v", r.Name, con.node.ID, err, r)
+			rdsLog.Errorf("RDS: Generated invalid routes for route:%s for node:%v: %v, %v", r.Name, con.node.ID, err, r)
 			rdsBuildErrPushes.Increment()
 			// Generating invalid routes is a bug.
 			// Instead of panic, which will break down the whole cluster. Just ignore it here, let envoy process it.
 		}
 	}
+	if features.EnableXDSConsistencyCheck.Get() {
+		recordViolations(rdsLog, con.node, checkRoutes(rawRoutes))
+	}
 	return rawRoutes
 }
 
@@ -0,0 +1,172 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/conversion"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// SimulationRequest describes a proxy to generate the configuration for, as it would connect to Pilot.
+type SimulationRequest struct {
+	// ProxyID is the xDS node ID of the proxy, for example
+	// sidecar~10.1.1.1~productpage-v1-8d69b.default~default.svc.cluster.local.
+	ProxyID string `json:"proxyID"`
+	// Metadata is the node metadata of the proxy, optional. The labels of the metadata take precedence over
+	// the ones of the registry, to simulate workloads not deployed yet.
+	Metadata *model.NodeMetadata `json:"metadata,omitempty"`
+}
+
+// SimulationResult holds the xDS resources Pilot would push to a proxy, in the JSON format of Envoy.
+type SimulationResult struct {
+	ProxyID   string            `json:"proxyID"`
+	Listeners []json.RawMessage `json:"listeners"`
+	Clusters  []json.RawMessage `json:"clusters"`
+	Routes    []json.RawMessage `json:"routes"`
+	Endpoints []json.RawMessage `json:"endpoints"`
+}
+
+// Simulate generates the configuration of a proxy that is not connected, from the current push context, to
+// review the configuration of a workload before rolling it out. The proxy is described by the proxyID query
+// parameter, or by a SimulationRequest posted in the body.
+func (s *DiscoveryServer) Simulate(w http.ResponseWriter, req *http.Request) {
+	simulation := &SimulationRequest{ProxyID: req.URL.Query().Get("proxyID")}
+	if req.Method == http.MethodPost {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := json.Unmarshal(body, simulation); err != nil {
+			http.Error(w, fmt.Sprintf("invalid simulation request: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if simulation.ProxyID == "" {
+		http.Error(w, "You must provide a proxyID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.simulate(simulation)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(out)
+}
+
+// simulate generates the listeners, clusters, routes and endpoints of the proxy, the way they are generated
+// when it connects.
+func (s *DiscoveryServer) simulate(req *SimulationRequest) (*SimulationResult, error) {
+	meta := req.Metadata
+	if meta == nil {
+		meta = &model.NodeMetadata{}
+	}
+	proxy, err := model.ParseServiceNodeWithMetadata(req.ProxyID, meta)
+	if err != nil {
+		return nil, err
+	}
+	push := s.globalPushContext()
+	if err := InitProxy(s.Env, push, proxy, nil); err != nil {
+		return nil, err
+	}
+
+	con := &XdsConnection{node: proxy}
+	listeners := s.generateRawListeners(con, push)
+	con.Routes = RouteNames(listeners)
+	routes := s.generateRawRoutes(con, push)
+	clusters := s.generateRawClusters(proxy, push)
+
+	out := &SimulationResult{ProxyID: proxy.ID}
+	for _, l := range listeners {
+		if out.Listeners, err = appendJSON(out.Listeners, l); err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range routes {
+		if out.Routes, err = appendJSON(out.Routes, r); err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range clusters {
+		if out.Clusters, err = appendJSON(out.Clusters, c); err != nil {
+			return nil, err
+		}
+		if c.GetType() != xdsapi.Cluster_EDS {
+			continue
+		}
+		if l := s.generateEndpoints(con, push, c.Name); l != nil {
+			if out.Endpoints, err = appendJSON(out.Endpoints, l); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
+
+func appendJSON(out []json.RawMessage, msg proto.Message) ([]json.RawMessage, error) {
+	buf := &bytes.Buffer{}
+	if err := (&jsonpb.Marshaler{}).Marshal(buf, msg); err != nil {
+		return nil, err
+	}
+	return append(out, buf.Bytes()), nil
+}
+
+// RouteNames returns the names of the RDS route configurations the listeners refer to.
+func RouteNames(listeners []*xdsapi.Listener) []string {
+	seen := map[string]bool{}
+	out := make([]string, 0)
+	for _, l := range listeners {
+		for _, fc := range l.FilterChains {
+			for _, filter := range fc.Filters {
+				if filter.Name != wellknown.HTTPConnectionManager {
+					continue
+				}
+				cm := &hcm.HttpConnectionManager{}
+				if filter.GetTypedConfig() != nil {
+					if err := ptypes.UnmarshalAny(filter.GetTypedConfig(), cm); err != nil {
+						continue
+					}
+				} else if err := conversion.StructToMessage(filter.GetConfig(), cm); err != nil {
+					continue
+				}
+				if name := cm.GetRds().GetRouteConfigName(); name != "" && !seen[name] {
+					seen[name] = true
+					out = append(out, name)
+				}
+			}
+		}
+	}
+	return out
+}
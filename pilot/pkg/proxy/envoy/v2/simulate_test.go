@@ -0,0 +1,64 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"reflect"
+	"testing"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+
+	"istio.io/istio/pilot/pkg/networking/util"
+)
+
+func TestRouteNames(t *testing.T) {
+	rds := func(name string) *hcm.HttpConnectionManager {
+		return &hcm.HttpConnectionManager{
+			RouteSpecifier: &hcm.HttpConnectionManager_Rds{Rds: &hcm.Rds{RouteConfigName: name}},
+		}
+	}
+	listeners := []*xdsapi.Listener{
+		{
+			FilterChains: []*listener.FilterChain{{
+				Filters: []*listener.Filter{{
+					Name:       wellknown.HTTPConnectionManager,
+					ConfigType: &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(rds("80"))},
+				}},
+			}},
+		},
+		{
+			FilterChains: []*listener.FilterChain{
+				{
+					Filters: []*listener.Filter{{
+						Name:       wellknown.HTTPConnectionManager,
+						ConfigType: &listener.Filter_Config{Config: util.MessageToStruct(rds("9080"))},
+					}},
+				},
+				{
+					Filters: []*listener.Filter{{
+						Name:       wellknown.HTTPConnectionManager,
+						ConfigType: &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(rds("80"))},
+					}},
+				},
+			},
+		},
+	}
+	if got, want := RouteNames(listeners), []string{"80", "9080"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RouteNames() got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	ot "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// The push pipeline is traced with the global tracer, configured with the --trace_* flags of pilot-discovery.
+// A push is traced from its first debounced event:
+//
+//   push
+//   ├── debounce
+//   ├── init_push_context
+//   └── proxy_push (one per proxy, following from the push)
+//       ├── cds.generate, cds.send
+//       ├── eds.generate, eds.send
+//       ├── lds.generate, lds.send
+//       └── rds.generate, rds.send
+
+var noopTracer = ot.NoopTracer{}
+
+// startPushSpan starts the span of a push, from the first of its debounced events.
+func startPushSpan(req *model.PushRequest, firstEvent time.Time, events int) ot.Span {
+	span := ot.StartSpan("push", ot.StartTime(firstEvent))
+	span.SetTag("full", req.Full)
+	span.SetTag("events", events)
+	if len(req.ConfigTypesUpdated) > 0 {
+		span.SetTag("config_kinds", joinKeys(req.ConfigTypesUpdated))
+	}
+	if len(req.NamespacesUpdated) > 0 {
+		span.SetTag("namespaces", joinKeys(req.NamespacesUpdated))
+	}
+	if len(req.EdsUpdates) > 0 {
+		span.SetTag("eds_updates", len(req.EdsUpdates))
+	}
+	childSpan(span, "debounce", ot.StartTime(firstEvent)).Finish()
+	return span
+}
+
+// childSpan starts a span for a stage of a push, child of the span of the push if it is traced.
+func childSpan(parent ot.Span, operation string, opts ...ot.StartSpanOption) ot.Span {
+	if parent == nil {
+		return noopTracer.StartSpan(operation)
+	}
+	return parent.Tracer().StartSpan(operation, append(opts, ot.ChildOf(parent.Context()))...)
+}
+
+// startProxyPushSpan starts the span of the push to a proxy, following from the span of the push.
+func startProxyPushSpan(con *XdsConnection, pushEv *XdsEvent) ot.Span {
+	if pushEv.span == nil {
+		return noopTracer.StartSpan("proxy_push")
+	}
+	span := pushEv.span.Tracer().StartSpan("proxy_push", ot.FollowsFrom(pushEv.span.Context()))
+	span.SetTag("proxy", con.node.ID)
+	span.SetTag("conn", con.ConID)
+	span.SetTag("incremental", pushEv.edsUpdatedServices != nil)
+	return span
+}
+
+// startSpan starts a span for a stage of the push to the connection. Pushes answering requests are not traced.
+func (con *XdsConnection) startSpan(operation string) ot.Span {
+	return childSpan(con.pushSpan, operation)
+}
+
+// finishSpan finishes a span, flagging it with the error if any.
+func finishSpan(span ot.Span, err error) {
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.SetTag("error.message", err.Error())
+	}
+	span.Finish()
+}
+
+func joinKeys(m map[string]struct{}) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	ot "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestPushSpans(t *testing.T) {
+	tracer := mocktracer.New()
+	previous := ot.GlobalTracer()
+	ot.SetGlobalTracer(tracer)
+	defer ot.SetGlobalTracer(previous)
+
+	firstEvent := time.Now().Add(-time.Second)
+	req := &model.PushRequest{
+		Full:               true,
+		ConfigTypesUpdated: map[string]struct{}{"virtual-service": {}, "destination-rule": {}},
+	}
+	push := startPushSpan(req, firstEvent, 3)
+	finishSpan(childSpan(push, "init_push_context"), errors.New("invalid"))
+
+	con := &XdsConnection{ConID: "sidecar~1", node: &model.Proxy{ID: "sidecar~10.1.1.1~a.default~default.svc.cluster.local"}}
+	proxy := startProxyPushSpan(con, &XdsEvent{span: push})
+	con.pushSpan = proxy
+	finishSpan(con.startSpan("cds.generate"), nil)
+	con.pushSpan = nil
+	finishSpan(proxy, nil)
+	push.Finish()
+
+	spans := map[string]*mocktracer.MockSpan{}
+	for _, span := range tracer.FinishedSpans() {
+		spans[span.OperationName] = span
+	}
+	root := spans["push"]
+	if root == nil {
+		t.Fatalf("push span not finished, got %v", tracer.FinishedSpans())
+	}
+	if got := root.Tag("config_kinds"); got != "destination-rule,virtual-service" {
+		t.Errorf("got config kinds %v", got)
+	}
+	if !root.StartTime.Equal(firstEvent) {
+		t.Errorf("push span started at %v, want the first event at %v", root.StartTime, firstEvent)
+	}
+	for name, parent := range map[string]*mocktracer.MockSpan{
+		"debounce":          root,
+		"init_push_context": root,
+		"proxy_push":        root,
+		"cds.generate":      spans["proxy_push"],
+	} {
+		span := spans[name]
+		if span == nil {
+			t.Errorf("%s span not finished", name)
+			continue
+		}
+		if span.ParentID != parent.SpanContext.SpanID {
+			t.Errorf("%s span parent is %d, want %s", name, span.ParentID, parent.OperationName)
+		}
+	}
+	if spans["init_push_context"].Tag("error") != true {
+		t.Errorf("init_push_context span not flagged with the error")
+	}
+	if spans["proxy_push"].Tag("proxy") != con.node.ID {
+		t.Errorf("proxy_push span not tagged with the proxy ID")
+	}
+
+	// Pushes answering requests are not traced.
+	tracer.Reset()
+	finishSpan(con.startSpan("cds.generate"), nil)
+	if len(tracer.FinishedSpans()) != 0 {
+		t.Errorf("got spans for an untraced push: %v", tracer.FinishedSpans())
+	}
+}
@@ -31,7 +31,12 @@ type PolicyApplier interface {
 	// It may return nil, if no JWT validation is needed.
 	JwtFilter(isXDSMarshalingToAnyEnabled bool) *http_conn.HttpFilter
 
+	// ClaimToHeaderFilter returns the HTTP filter copying the claims of the verified JWT to the request
+	// headers. It may return nil, if no claim needs to be copied.
+	ClaimToHeaderFilter(isXDSMarshalingToAnyEnabled bool) *http_conn.HttpFilter
+
 	// AuthNFilter returns the (authn) HTTP filter to enforce the underlying authentication policy.
+	// JWT authentication is not required for the paths starting with one of the exemptPaths.
 	// It may return nil, if no authentication is needed.
-	AuthNFilter(proxyType model.NodeType, isXDSMarshalingToAnyEnabled bool) *http_conn.HttpFilter
+	AuthNFilter(proxyType model.NodeType, exemptPaths []string, isXDSMarshalingToAnyEnabled bool) *http_conn.HttpFilter
 }
@@ -0,0 +1,124 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	lua "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/lua/v2"
+
+	"istio.io/pkg/log"
+
+	authn_model "istio.io/istio/pilot/pkg/security/model"
+)
+
+// claimPathRegex matches the claims that can be copied to headers: dot separated claim names made of
+// characters valid in header names.
+var claimPathRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+
+// claimToHeaderLuaTemplate copies the claims of the JWT payloads stored in the dynamic metadata of the
+// Envoy JWT filter to the request headers. The headers are removed first, so they cannot be spoofed by
+// the downstream. Lists are joined with commas.
+const claimToHeaderLuaTemplate = `local claims = {
+%s}
+
+local function claimValue(payload, path)
+  local v = payload
+  for _, name in ipairs(path) do
+    if type(v) ~= "table" then
+      return nil
+    end
+    v = v[name]
+  end
+  if type(v) == "table" then
+    local values = {}
+    for _, item in ipairs(v) do
+      if type(item) ~= "table" then
+        table.insert(values, tostring(item))
+      end
+    end
+    return table.concat(values, ",")
+  end
+  if v == nil then
+    return nil
+  end
+  return tostring(v)
+end
+
+function envoy_on_request(handle)
+  local headers = handle:headers()
+  for header, _ in pairs(claims) do
+    headers:remove(header)
+  end
+  local payloads = handle:streamInfo():dynamicMetadata():get("%s")
+  if payloads == nil then
+    return
+  end
+  for _, payload in pairs(payloads) do
+    for header, path in pairs(claims) do
+      local value = claimValue(payload, path)
+      if value ~= nil then
+        headers:replace(header, value)
+      end
+    end
+  end
+end
+`
+
+// claimHeaders returns the header names of the claims, keyed by the claim path. Invalid claims are ignored.
+func claimHeaders(claims []string, prefix string) map[string]string {
+	out := make(map[string]string)
+	for _, claim := range claims {
+		claim = strings.TrimSpace(claim)
+		if claim == "" {
+			continue
+		}
+		if !claimPathRegex.MatchString(claim) {
+			log.Warnf("Ignored invalid JWT claim %q in claim to header configuration", claim)
+			continue
+		}
+		out[claim] = strings.ToLower(prefix + strings.Replace(claim, ".", "-", -1))
+	}
+	return out
+}
+
+// buildClaimToHeaderConfig returns the Lua filter config copying the claims to the headers, or nil
+// if there is no claim to copy.
+func buildClaimToHeaderConfig(claims []string, prefix string) *lua.Lua {
+	headers := claimHeaders(claims, prefix)
+	if len(headers) == 0 {
+		return nil
+	}
+	paths := make([]string, 0, len(headers))
+	for claim := range headers {
+		paths = append(paths, claim)
+	}
+	sort.Strings(paths)
+
+	var entries strings.Builder
+	for _, claim := range paths {
+		names := strings.Split(claim, ".")
+		for i, name := range names {
+			names[i] = fmt.Sprintf("%q", name)
+		}
+		entries.WriteString(fmt.Sprintf("  [%q] = {%s},\n", headers[claim], strings.Join(names, ", ")))
+	}
+	return &lua.Lua{
+		InlineCode: fmt.Sprintf(claimToHeaderLuaTemplate, entries.String(), authn_model.EnvoyJwtFilterName),
+	}
+}
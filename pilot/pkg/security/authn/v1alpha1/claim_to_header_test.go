@@ -0,0 +1,52 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClaimHeaders(t *testing.T) {
+	got := claimHeaders([]string{"sub", " org.team ", "", "bad claim", "a..b"}, "X-Jwt-Claim-")
+	want := map[string]string{
+		"sub":      "x-jwt-claim-sub",
+		"org.team": "x-jwt-claim-org-team",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("claimHeaders() => %v, want %v", got, want)
+	}
+}
+
+func TestBuildClaimToHeaderConfig(t *testing.T) {
+	if cfg := buildClaimToHeaderConfig([]string{""}, "x-jwt-claim-"); cfg != nil {
+		t.Errorf("expected no config without claims, got %v", cfg)
+	}
+
+	cfg := buildClaimToHeaderConfig([]string{"sub", "org.team"}, "x-jwt-claim-")
+	if cfg == nil {
+		t.Fatal("expected lua config")
+	}
+	for _, want := range []string{
+		`["x-jwt-claim-org-team"] = {"org", "team"},` + "\n" + `  ["x-jwt-claim-sub"] = {"sub"},`,
+		`dynamicMetadata():get("envoy.filters.http.jwt_authn")`,
+		`headers:remove(header)`,
+	} {
+		if !strings.Contains(cfg.InlineCode, want) {
+			t.Errorf("expected lua code to contain %q, got:\n%s", want, cfg.InlineCode)
+		}
+	}
+}
@@ -17,6 +17,7 @@ package v1alpha1
 import (
 	"crypto/sha1"
 	"fmt"
+	"strings"
 
 	auth "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
 	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
@@ -224,7 +225,9 @@ func convertPolicyToJwtConfig(policy *authn_v1alpha1.Policy) (string, proto.Mess
 }
 
 // convertPolicyToAuthNFilterConfig returns an authn filter config corresponding for the input policy.
-func convertPolicyToAuthNFilterConfig(policy *authn_v1alpha1.Policy, proxyType model.NodeType) *authn_filter.FilterConfig {
+// The JWT authentication is not triggered for the paths starting with one of the exemptPaths.
+func convertPolicyToAuthNFilterConfig(policy *authn_v1alpha1.Policy, proxyType model.NodeType,
+	exemptPaths []string) *authn_filter.FilterConfig {
 	if policy == nil || (len(policy.Peers) == 0 && len(policy.Origins) == 0) {
 		return nil
 	}
@@ -255,6 +258,13 @@ func convertPolicyToAuthNFilterConfig(policy *authn_v1alpha1.Policy, proxyType m
 	}
 
 	p.Peers = usedPeers
+	for _, peer := range p.Peers {
+		exemptJwtPaths(peer.GetJwt(), exemptPaths)
+	}
+	for _, origin := range p.Origins {
+		exemptJwtPaths(origin.GetJwt(), exemptPaths)
+	}
+
 	filterConfig := &authn_filter.FilterConfig{
 		Policy: p,
 		// we can always set this field, it's no-op if mTLS is not used.
@@ -278,6 +288,26 @@ func convertPolicyToAuthNFilterConfig(policy *authn_v1alpha1.Policy, proxyType m
 	return filterConfig
 }
 
+// exemptJwtPaths excludes the path prefixes from all the trigger rules of the JWT, so that it is not
+// required for them.
+func exemptJwtPaths(jwt *authn_filter_policy.Jwt, prefixes []string) {
+	if jwt == nil || len(prefixes) == 0 {
+		return
+	}
+	excluded := make([]*authn_filter_policy.StringMatch, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		excluded = append(excluded, &authn_filter_policy.StringMatch{
+			MatchType: &authn_filter_policy.StringMatch_Prefix{Prefix: prefix},
+		})
+	}
+	if len(jwt.TriggerRules) == 0 {
+		jwt.TriggerRules = []*authn_filter_policy.Jwt_TriggerRule{{}}
+	}
+	for _, rule := range jwt.TriggerRules {
+		rule.ExcludedPaths = append(rule.ExcludedPaths, excluded...)
+	}
+}
+
 // Implemenation of authn.PolicyApplier
 type v1alpha1PolicyApplier struct {
 	policy *authn_v1alpha1.Policy
@@ -300,8 +330,30 @@ func (a v1alpha1PolicyApplier) JwtFilter(isXDSMarshalingToAnyEnabled bool) *http
 	return out
 }
 
-func (a v1alpha1PolicyApplier) AuthNFilter(proxyType model.NodeType, isXDSMarshalingToAnyEnabled bool) *http_conn.HttpFilter {
-	filterConfigProto := convertPolicyToAuthNFilterConfig(a.policy, proxyType)
+func (a v1alpha1PolicyApplier) ClaimToHeaderFilter(isXDSMarshalingToAnyEnabled bool) *http_conn.HttpFilter {
+	// The claims are read from the metadata of the Envoy JWT filter.
+	if features.UseIstioJWTFilter.Get() || len(collectJwtSpecs(a.policy)) == 0 {
+		return nil
+	}
+	filterConfigProto := buildClaimToHeaderConfig(strings.Split(features.JwtClaimToHeaders.Get(), ","),
+		features.JwtClaimHeaderPrefix.Get())
+	if filterConfigProto == nil {
+		return nil
+	}
+	out := &http_conn.HttpFilter{
+		Name: xdsutil.Lua,
+	}
+	if isXDSMarshalingToAnyEnabled {
+		out.ConfigType = &http_conn.HttpFilter_TypedConfig{TypedConfig: util.MessageToAny(filterConfigProto)}
+	} else {
+		out.ConfigType = &http_conn.HttpFilter_Config{Config: util.MessageToStruct(filterConfigProto)}
+	}
+	return out
+}
+
+func (a v1alpha1PolicyApplier) AuthNFilter(proxyType model.NodeType, exemptPaths []string,
+	isXDSMarshalingToAnyEnabled bool) *http_conn.HttpFilter {
+	filterConfigProto := convertPolicyToAuthNFilterConfig(a.policy, proxyType, exemptPaths)
 	if filterConfigProto == nil {
 		return nil
 	}
@@ -602,12 +602,56 @@ func TestConvertPolicyToAuthNFilterConfig(t *testing.T) {
 		},
 	}
 	for _, c := range cases {
-		if got := convertPolicyToAuthNFilterConfig(c.in, model.SidecarProxy); !reflect.DeepEqual(c.expected, got) {
+		if got := convertPolicyToAuthNFilterConfig(c.in, model.SidecarProxy, nil); !reflect.DeepEqual(c.expected, got) {
 			t.Errorf("Test case %s: wantConfig\n%#v\n, got\n%#v", c.name, c.expected.String(), got.String())
 		}
 	}
 }
 
+func TestConvertPolicyToAuthNFilterConfigExemptPaths(t *testing.T) {
+	policy := &authn.Policy{
+		Origins: []*authn.OriginAuthenticationMethod{
+			{
+				Jwt: &authn.Jwt{
+					Issuer: "foo",
+				},
+			},
+			{
+				Jwt: &authn.Jwt{
+					Issuer: "bar",
+					TriggerRules: []*authn.Jwt_TriggerRule{
+						{
+							IncludedPaths: []*authn.StringMatch{{MatchType: &authn.StringMatch_Prefix{Prefix: "/api"}}},
+						},
+					},
+				},
+			},
+		},
+	}
+	healthz := &authn_filter_policy.StringMatch{MatchType: &authn_filter_policy.StringMatch_Prefix{Prefix: "/healthz"}}
+	expected := []*authn_filter_policy.Jwt_TriggerRule{
+		{
+			ExcludedPaths: []*authn_filter_policy.StringMatch{healthz},
+		},
+		{
+			ExcludedPaths: []*authn_filter_policy.StringMatch{healthz},
+			IncludedPaths: []*authn_filter_policy.StringMatch{
+				{MatchType: &authn_filter_policy.StringMatch_Prefix{Prefix: "/api"}},
+			},
+		},
+	}
+
+	got := convertPolicyToAuthNFilterConfig(policy, model.SidecarProxy, []string{"/healthz"})
+	for i, origin := range got.GetPolicy().GetOrigins() {
+		if rules := origin.GetJwt().GetTriggerRules(); !reflect.DeepEqual(rules, expected[i:i+1]) {
+			t.Errorf("origin %d: got trigger rules %v but want %v", i, rules, expected[i:i+1])
+		}
+	}
+	if policy.Origins[0].Jwt.TriggerRules != nil {
+		t.Errorf("input policy should not be modified, got %v", policy.Origins[0].Jwt)
+	}
+}
+
 func setSkipValidateTrustDomain(value string, t *testing.T) {
 	err := os.Setenv(features.SkipValidateTrustDomain.Name, value)
 	if err != nil {
@@ -714,7 +758,7 @@ func TestBuildAuthNFilter(t *testing.T) {
 				setSkipValidateTrustDomain("false", t)
 			}()
 		}
-		got := NewPolicyApplier(c.in).AuthNFilter(model.SidecarProxy, true)
+		got := NewPolicyApplier(c.in).AuthNFilter(model.SidecarProxy, nil, true)
 		if got == nil {
 			if c.expectedFilterConfig != nil {
 				t.Errorf("buildAuthNFilter(%#v), got: nil, wanted filter with config %s", c.in, c.expectedFilterConfig.String())
@@ -16,8 +16,10 @@ package builder
 
 import (
 	tcp_filter "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	http_config "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rbac/v2"
 	http_filter "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
 	tcp_config "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/rbac/v2"
+	envoy_rbac "github.com/envoyproxy/go-control-plane/envoy/config/rbac/v2"
 
 	istiolog "istio.io/pkg/log"
 
@@ -38,6 +40,35 @@ var (
 type Builder struct {
 	isXDSMarshalingToAnyEnabled bool
 	generator                   policy.Generator
+	tcpStatPrefix               string
+}
+
+// denyAllGenerator generates the RBAC config denying all requests, used for the workloads of the
+// deny-by-default namespaces without authorization policy.
+type denyAllGenerator struct{}
+
+// Generate implements policy.Generator.
+func (denyAllGenerator) Generate(forTCPFilter bool) *http_config.RBAC {
+	denyAll := &envoy_rbac.RBAC{
+		Action:   envoy_rbac.RBAC_ALLOW,
+		Policies: map[string]*envoy_rbac.Policy{},
+	}
+	config := &http_config.RBAC{Rules: denyAll}
+	if !forTCPFilter {
+		// The HTTP RBAC filter has no stat prefix, the shadow rules count the requests denied by default in
+		// the rbac.shadow_denied stat, as workloads denying by default have no other RBAC policy.
+		config.ShadowRules = denyAll
+	}
+	return config
+}
+
+// NewDenyAllBuilder creates a builder instance building the RBAC filter config denying all requests.
+func NewDenyAllBuilder(isXDSMarshalingToAnyEnabled bool) *Builder {
+	return &Builder{
+		isXDSMarshalingToAnyEnabled: isXDSMarshalingToAnyEnabled,
+		generator:                   denyAllGenerator{},
+		tcpStatPrefix:               authz_model.RBACTCPDefaultDenyStatPrefix,
+	}
 }
 
 // NewBuilder creates a builder instance that can be used to build corresponding RBAC filter config.
@@ -76,6 +107,7 @@ func NewBuilder(trustDomain string, trustDomainAliases []string, serviceInstance
 	return &Builder{
 		isXDSMarshalingToAnyEnabled: isXDSMarshalingToAnyEnabled,
 		generator:                   generator,
+		tcpStatPrefix:               authz_model.RBACTCPFilterStatPrefix,
 	}
 }
 
@@ -117,7 +149,7 @@ func (b *Builder) BuildTCPFilter() *tcp_filter.Filter {
 	rbacConfig := &tcp_config.RBAC{
 		Rules:       config.Rules,
 		ShadowRules: config.ShadowRules,
-		StatPrefix:  authz_model.RBACTCPFilterStatPrefix,
+		StatPrefix:  b.tcpStatPrefix,
 	}
 
 	tcpConfig := tcp_filter.Filter{
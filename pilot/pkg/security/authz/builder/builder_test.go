@@ -251,3 +251,31 @@ func TestBuilder_BuildTCPFilter(t *testing.T) {
 		})
 	}
 }
+
+func TestNewDenyAllBuilder(t *testing.T) {
+	b := NewDenyAllBuilder(false)
+
+	httpFilter := b.BuildHTTPFilter()
+	httpConfig := &http_config.RBAC{}
+	if err := conversion.StructToMessage(httpFilter.GetConfig(), httpConfig); err != nil {
+		t.Fatalf("failed to convert struct to message: %s", err)
+	}
+	if httpConfig.GetRules() == nil || len(httpConfig.GetRules().GetPolicies()) > 0 {
+		t.Errorf("got rules %v but want rules without policies", httpConfig.GetRules())
+	}
+	if httpConfig.GetShadowRules() == nil || len(httpConfig.GetShadowRules().GetPolicies()) > 0 {
+		t.Errorf("got shadow rules %v but want shadow rules without policies", httpConfig.GetShadowRules())
+	}
+
+	tcpFilter := b.BuildTCPFilter()
+	tcpConfig := &tcp_config.RBAC{}
+	if err := conversion.StructToMessage(tcpFilter.GetConfig(), tcpConfig); err != nil {
+		t.Fatalf("failed to convert struct to message: %s", err)
+	}
+	if tcpConfig.StatPrefix != authz_model.RBACTCPDefaultDenyStatPrefix {
+		t.Errorf("got filter stat prefix %q but want %q", tcpConfig.StatPrefix, authz_model.RBACTCPDefaultDenyStatPrefix)
+	}
+	if tcpConfig.GetRules() == nil || tcpConfig.GetShadowRules() != nil {
+		t.Errorf("got rules %v and shadow rules %v but want rules only", tcpConfig.GetRules(), tcpConfig.GetShadowRules())
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	envoy_rbac "github.com/envoyproxy/go-control-plane/envoy/config/rbac/v2"
+	envoy_matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher"
+
+	"istio.io/istio/pilot/pkg/security/authz/model/matcher"
+)
+
+const (
+	// IPAllowListAnnotation is the AuthorizationPolicy annotation listing the comma separated source
+	// CIDRs allowed by the rules of the policy.
+	IPAllowListAnnotation = "security.istio.io/ipAllowList"
+
+	// IPDenyListAnnotation is the AuthorizationPolicy annotation listing the comma separated source
+	// CIDRs denied by the rules of the policy.
+	IPDenyListAnnotation = "security.istio.io/ipDenyList"
+
+	// IPSourceAnnotation is the AuthorizationPolicy annotation selecting the source address the IP lists
+	// are matched against, either IPSourceRemote (default) or IPSourceXFF.
+	IPSourceAnnotation = "security.istio.io/ipSource"
+
+	// IPSourceRemote matches the address of the downstream connection.
+	IPSourceRemote = "remote"
+
+	// IPSourceXFF matches the client address the gateway determined from the X-Forwarded-For header,
+	// according to its number of trusted hops. Only supported for IPv4 on HTTP listeners, TCP listeners
+	// fall back to the address of the downstream connection.
+	IPSourceXFF = "xff"
+
+	// externalAddressHeader is set by Envoy to the trusted client address of requests from outside the mesh.
+	externalAddressHeader = "x-envoy-external-address"
+)
+
+// IPAccessList restricts the source addresses allowed by the rules of an authorization policy.
+type IPAccessList struct {
+	// Allow lists the allowed CIDRs. All addresses are allowed if empty.
+	Allow []string
+	// Deny lists the denied CIDRs, taking precedence over Allow.
+	Deny []string
+	// Source is the address the lists are matched against.
+	Source string
+}
+
+// NewIPAccessList returns the IP access list configured in the annotations of an authorization
+// policy, or nil if there is none.
+func NewIPAccessList(annotations map[string]string) (*IPAccessList, error) {
+	list := &IPAccessList{
+		Allow:  splitCIDRs(annotations[IPAllowListAnnotation]),
+		Deny:   splitCIDRs(annotations[IPDenyListAnnotation]),
+		Source: annotations[IPSourceAnnotation],
+	}
+	if len(list.Allow) == 0 && len(list.Deny) == 0 {
+		return nil, nil
+	}
+
+	switch list.Source {
+	case "":
+		list.Source = IPSourceRemote
+	case IPSourceRemote, IPSourceXFF:
+	default:
+		return nil, fmt.Errorf("invalid %s %q, must be %q or %q", IPSourceAnnotation, list.Source, IPSourceRemote, IPSourceXFF)
+	}
+
+	for _, cidr := range append(append([]string{}, list.Allow...), list.Deny...) {
+		if _, err := matcher.CidrRange(cidr); err != nil {
+			return nil, err
+		}
+		if list.Source == IPSourceXFF {
+			if _, err := cidrRegex(cidr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return list, nil
+}
+
+func splitCIDRs(value string) []string {
+	var out []string
+	for _, cidr := range strings.Split(value, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr != "" {
+			out = append(out, cidr)
+		}
+	}
+	return out
+}
+
+// Apply restricts the principals of the policy to the sources allowed by the IP access list.
+func (l *IPAccessList) Apply(policy *envoy_rbac.Policy, forTCPFilter bool) {
+	if l == nil || policy == nil {
+		return
+	}
+	pg := principalGenerator{}
+	if len(l.Allow) > 0 {
+		pg.append(l.principal(l.Allow, forTCPFilter))
+	}
+	if deny := l.principal(l.Deny, forTCPFilter); deny != nil {
+		pg.append(principalNot(deny))
+	}
+	if pg.isEmpty() {
+		return
+	}
+
+	principals := principalGenerator{principals: policy.Principals}
+	pg.append(principals.orPrincipals())
+	policy.Principals = []*envoy_rbac.Principal{pg.andPrincipals()}
+}
+
+// principal returns the principal matching any of the CIDRs.
+func (l *IPAccessList) principal(cidrs []string, forTCPFilter bool) *envoy_rbac.Principal {
+	pg := principalGenerator{}
+	for _, cidr := range cidrs {
+		if l.Source == IPSourceXFF && !forTCPFilter {
+			regex, err := cidrRegex(cidr)
+			if err != nil {
+				rbacLog.Errorf("ignored invalid source cidr: %v", err)
+				continue
+			}
+			pg.append(principalHeader(&route.HeaderMatcher{
+				Name: externalAddressHeader,
+				HeaderMatchSpecifier: &route.HeaderMatcher_SafeRegexMatch{
+					SafeRegexMatch: &envoy_matcher.RegexMatcher{
+						EngineType: &envoy_matcher.RegexMatcher_GoogleRe2{GoogleRe2: &envoy_matcher.RegexMatcher_GoogleRE2{}},
+						Regex:      regex,
+					},
+				},
+			}))
+			continue
+		}
+		cidrRange, err := matcher.CidrRange(cidr)
+		if err != nil {
+			rbacLog.Errorf("ignored invalid source cidr: %v", err)
+			continue
+		}
+		pg.append(principalSourceIP(cidrRange))
+	}
+	return pg.orPrincipals()
+}
+
+// cidrRegex returns the regular expression matching the textual form of the IPv4 addresses of the CIDR.
+func cidrRegex(cidr string) (string, error) {
+	if !strings.Contains(cidr, "/") {
+		cidr += "/32"
+	}
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", fmt.Errorf("invalid cidr range: %v", err)
+	}
+	ip := ipNet.IP.To4()
+	if ip == nil {
+		return "", fmt.Errorf("only IPv4 cidr ranges can be matched against the X-Forwarded-For client address: %s", cidr)
+	}
+	prefixLen, _ := ipNet.Mask.Size()
+
+	octets := make([]string, 4)
+	for i := range octets {
+		bits := prefixLen - i*8
+		switch {
+		case bits >= 8:
+			octets[i] = strconv.Itoa(int(ip[i]))
+		case bits <= 0:
+			octets[i] = "[0-9]{1,3}"
+		default:
+			low := int(ip[i])
+			high := low | (0xff >> uint(bits))
+			values := make([]string, 0, high-low+1)
+			for v := low; v <= high; v++ {
+				values = append(values, strconv.Itoa(v))
+			}
+			octets[i] = "(" + strings.Join(values, "|") + ")"
+		}
+	}
+	return "^" + strings.Join(octets, `\.`) + "$", nil
+}
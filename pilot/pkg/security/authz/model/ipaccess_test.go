@@ -0,0 +1,154 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	envoy_rbac "github.com/envoyproxy/go-control-plane/envoy/config/rbac/v2"
+)
+
+func TestNewIPAccessList(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		want        *IPAccessList
+		wantErr     bool
+	}{
+		{
+			name: "no annotations",
+		},
+		{
+			name: "allow and deny",
+			annotations: map[string]string{
+				IPAllowListAnnotation: "10.0.0.0/8, 192.168.1.1",
+				IPDenyListAnnotation:  "10.1.0.0/16",
+			},
+			want: &IPAccessList{
+				Allow:  []string{"10.0.0.0/8", "192.168.1.1"},
+				Deny:   []string{"10.1.0.0/16"},
+				Source: IPSourceRemote,
+			},
+		},
+		{
+			name: "invalid cidr",
+			annotations: map[string]string{
+				IPAllowListAnnotation: "10.0.0.0/33",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid source",
+			annotations: map[string]string{
+				IPAllowListAnnotation: "10.0.0.0/8",
+				IPSourceAnnotation:    "header",
+			},
+			wantErr: true,
+		},
+		{
+			name: "ipv6 with xff",
+			annotations: map[string]string{
+				IPDenyListAnnotation: "2001:db8::/32",
+				IPSourceAnnotation:   IPSourceXFF,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NewIPAccessList(tc.annotations)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v but want error %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v but want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCidrRegex(t *testing.T) {
+	cases := []struct {
+		cidr     string
+		match    []string
+		notMatch []string
+	}{
+		{
+			cidr:     "10.1.2.3",
+			match:    []string{"10.1.2.3"},
+			notMatch: []string{"10.1.2.30", "110.1.2.3"},
+		},
+		{
+			cidr:     "10.1.0.0/16",
+			match:    []string{"10.1.0.1", "10.1.255.255"},
+			notMatch: []string{"10.2.0.1", "10.11.0.1"},
+		},
+		{
+			cidr:     "192.168.1.64/26",
+			match:    []string{"192.168.1.64", "192.168.1.127"},
+			notMatch: []string{"192.168.1.63", "192.168.1.128"},
+		},
+	}
+	for _, tc := range cases {
+		regex, err := cidrRegex(tc.cidr)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.cidr, err)
+		}
+		re := regexp.MustCompile(regex)
+		for _, ip := range tc.match {
+			if !re.MatchString(ip) {
+				t.Errorf("%s: want %s to match %s", tc.cidr, regex, ip)
+			}
+		}
+		for _, ip := range tc.notMatch {
+			if re.MatchString(ip) {
+				t.Errorf("%s: want %s not to match %s", tc.cidr, regex, ip)
+			}
+		}
+	}
+}
+
+func TestIPAccessList_Apply(t *testing.T) {
+	list := &IPAccessList{
+		Allow:  []string{"10.0.0.0/8"},
+		Deny:   []string{"10.1.0.0/16"},
+		Source: IPSourceXFF,
+	}
+
+	policy := &envoy_rbac.Policy{Principals: []*envoy_rbac.Principal{principalAny(true)}}
+	list.Apply(policy, false)
+	if len(policy.Principals) != 1 {
+		t.Fatalf("got %d principals but want 1", len(policy.Principals))
+	}
+	ids := policy.Principals[0].GetAndIds().GetIds()
+	if len(ids) != 3 {
+		t.Fatalf("got %v but want the allow list, deny list and original principals", ids)
+	}
+	if ids[0].GetOrIds().GetIds()[0].GetHeader().GetName() != externalAddressHeader {
+		t.Errorf("got %v but want a match on the %s header", ids[0], externalAddressHeader)
+	}
+	if ids[1].GetNotId() == nil {
+		t.Errorf("got %v but want the negated deny list", ids[1])
+	}
+
+	// TCP filters cannot match headers, the address of the connection is used.
+	policy = &envoy_rbac.Policy{Principals: []*envoy_rbac.Principal{principalAny(true)}}
+	list.Apply(policy, true)
+	if policy.Principals[0].GetAndIds().GetIds()[0].GetOrIds().GetIds()[0].GetSourceIp() == nil {
+		t.Errorf("got %v but want a match on the source ip", policy.Principals[0])
+	}
+}
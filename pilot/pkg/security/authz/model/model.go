@@ -34,6 +34,9 @@ const (
 	RBACTCPFilterName       = "envoy.filters.network.rbac"
 	RBACTCPFilterStatPrefix = "tcp."
 
+	// RBACTCPDefaultDenyStatPrefix is the stat prefix of the RBAC network filter denying traffic by default.
+	RBACTCPDefaultDenyStatPrefix = "tcp.default_deny."
+
 	// attributes that could be used in both ServiceRoleBinding and ServiceRole.
 	attrRequestHeader = "request.headers" // header name is surrounded by brackets, e.g. "request.headers[User-Agent]".
 
@@ -46,7 +49,7 @@ const (
 	attrRequestPrincipal   = "request.auth.principal"      // authenticated principal of the request.
 	attrRequestAudiences   = "request.auth.audiences"      // intended audience(s) for this authentication information.
 	attrRequestPresenter   = "request.auth.presenter"      // authorized presenter of the credential.
-	attrRequestClaims      = "request.auth.claims"         // claim name is surrounded by brackets, e.g. "request.auth.claims[iss]".
+	attrRequestClaims      = "request.auth.claims"         // claim name is surrounded by brackets, e.g. "request.auth.claims[iss]" or "request.auth.claims[org][team]" for nested claims.
 	attrRequestClaimGroups = "request.auth.claims[groups]" // groups claim.
 
 	// reserved string values in names and not_names in ServiceRoleBinding.
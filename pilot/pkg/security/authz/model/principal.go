@@ -252,13 +252,14 @@ func principalForKeyValue(key, value string, forTCPFilter bool) *envoy_rbac.Prin
 		m := matcher.HeaderMatcher(header, value)
 		return principalHeader(m)
 	case strings.HasPrefix(key, attrRequestClaims):
-		claim, err := extractNameInBrackets(strings.TrimPrefix(key, attrRequestClaims))
+		// Nested claims are referred to with multiple brackets, e.g. "request.auth.claims[a][b]".
+		claims, err := extractNamesInBrackets(strings.TrimPrefix(key, attrRequestClaims))
 		if err != nil {
 			return nil
 		}
 		// Generate a metadata list matcher for the given path keys and value.
 		// On proxy side, the value should be of list type.
-		m := matcher.MetadataListMatcher(authn_model.AuthnFilterName, []string{attrRequestClaims, claim}, value)
+		m := matcher.MetadataListMatcher(authn_model.AuthnFilterName, append([]string{attrRequestClaims}, claims...), value)
 		return principalMetadata(m)
 	default:
 		rbacLog.Debugf("generated dynamic metadata matcher for custom property: %s", key)
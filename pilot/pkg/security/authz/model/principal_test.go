@@ -642,6 +642,32 @@ func TestPrincipal_Generate(t *testing.T) {
                         stringMatch:
                           exact: v-4`,
 		},
+		{
+			name: "principal with property attrRequestClaims for nested claim",
+			principal: &Principal{
+				Properties: []KeyValues{
+					{
+						fmt.Sprintf("%s[%s][%s]", attrRequestClaims, "org", "team"): []string{"v-1"},
+					},
+				},
+			},
+			wantYAML: `
+        andIds:
+          ids:
+          - orIds:
+              ids:
+              - metadata:
+                  filter: istio_authn
+                  path:
+                  - key: request.auth.claims
+                  - key: org
+                  - key: team
+                  value:
+                    listMatch:
+                      oneOf:
+                        stringMatch:
+                          exact: v-1`,
+		},
 		{
 			name: "principal with custom property",
 			principal: &Principal{
@@ -82,6 +82,16 @@ func extractNameInBrackets(s string) (string, error) {
 	return strings.TrimPrefix(strings.TrimSuffix(s, "]"), "["), nil
 }
 
+// extractNamesInBrackets extracts the names of a path of the format [<NAME>][<NAME>]..., used to
+// refer to nested fields, e.g. "[a][b]" returns ["a", "b"].
+func extractNamesInBrackets(s string) ([]string, error) {
+	name, err := extractNameInBrackets(s)
+	if err != nil {
+		return nil, fmt.Errorf("expecting format [<NAME>][<NAME>]..., but found %s", s)
+	}
+	return strings.Split(name, "]["), nil
+}
+
 // extractActualServiceAccount extracts the actual service account from the Istio service account if
 // found any, otherwise it returns the Istio service account itself without any change.
 // Istio service account has the format: "spiffe://<domain>/ns/<namespace>/sa/<service-account>"
@@ -15,6 +15,7 @@
 package model
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -177,6 +178,30 @@ func TestExtractNameInBrackets(t *testing.T) {
 	}
 }
 
+func TestExtractNamesInBrackets(t *testing.T) {
+	cases := []struct {
+		s      string
+		expect []string
+		err    bool
+	}{
+		{s: "[good]", expect: []string{"good"}},
+		{s: "[a][b][c]", expect: []string{"a", "b", "c"}},
+		{s: "[a.b][c]", expect: []string{"a.b", "c"}},
+		{s: "[a][b", err: true},
+		{s: "a][b]", err: true},
+	}
+
+	for _, c := range cases {
+		names, err := extractNamesInBrackets(c.s)
+		if c.err != (err != nil) {
+			t.Errorf("%s: unexpected error: %v", c.s, err)
+		}
+		if !reflect.DeepEqual(names, c.expect) {
+			t.Errorf("%s: expecting %v but found %v", c.s, c.expect, names)
+		}
+	}
+}
+
 func TestExtractActualServiceAccount(t *testing.T) {
 	cases := []struct {
 		in     string
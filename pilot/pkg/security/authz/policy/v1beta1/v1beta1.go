@@ -55,8 +55,15 @@ func (g *v1beta1Generator) Generate(forTCPFilter bool) *http_config.RBAC {
 
 	for _, config := range g.policies {
 		spec := config.Spec.(*istio_rbac.AuthorizationPolicy)
+		ipAccessList, err := authz_model.NewIPAccessList(config.Annotations)
+		if err != nil {
+			// Ignoring the policy denies the requests it would allow.
+			rbacLog.Errorf("ignored policy %s/%s with invalid IP access list: %v", config.Namespace, config.Name, err)
+			continue
+		}
 		for i, rule := range spec.Rules {
 			if p := g.generatePolicy(g.trustDomain, g.trustDomainAliases, rule, forTCPFilter); p != nil {
+				ipAccessList.Apply(p, forTCPFilter)
 				name := fmt.Sprintf("ns[%s]-policy[%s]-rule[%d]", config.Namespace, config.Name, i)
 				rbac.Policies[name] = p
 				rbacLog.Debugf("generated policy %s: %+v", name, p)
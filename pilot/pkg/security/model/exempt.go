@@ -0,0 +1,45 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"strings"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// ExemptPathPrefixes returns the path prefixes the workload exempts from JWT and RBAC enforcement on
+// the inbound path, e.g. its health and metrics endpoints. Prefixes not starting with "/" are ignored.
+func ExemptPathPrefixes(meta *model.NodeMetadata) []string {
+	if meta == nil || meta.SecurityExemptPaths == "" {
+		return nil
+	}
+	var prefixes []string
+	seen := map[string]bool{}
+	for _, prefix := range strings.Split(meta.SecurityExemptPaths, ",") {
+		prefix = strings.TrimSpace(prefix)
+		if !strings.HasPrefix(prefix, "/") {
+			if prefix != "" {
+				log.Warnf("ignored exempt path %q, it must start with /", prefix)
+			}
+			continue
+		}
+		if !seen[prefix] {
+			seen[prefix] = true
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
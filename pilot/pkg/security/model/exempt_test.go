@@ -0,0 +1,48 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"reflect"
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestExemptPathPrefixes(t *testing.T) {
+	cases := []struct {
+		name string
+		meta *model.NodeMetadata
+		want []string
+	}{
+		{
+			name: "nil metadata",
+		},
+		{
+			name: "no annotation",
+			meta: &model.NodeMetadata{},
+		},
+		{
+			name: "prefixes",
+			meta: &model.NodeMetadata{SecurityExemptPaths: "/healthz, /metrics,,healthz,/healthz"},
+			want: []string{"/healthz", "/metrics"},
+		},
+	}
+	for _, c := range cases {
+		if got := ExemptPathPrefixes(c.meta); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v but want %v", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secretgrant authorizes the gateways to use the secrets of other namespaces, granting them the access with
+// the model.GatewayNamespacesAnnotation. The grants are enforced by Pilot rather than by the node agents of the
+// gateways, which are run by the owners of the gateways.
+package secretgrant
+
+import (
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"istio.io/istio/pilot/pkg/model"
+	authn_model "istio.io/istio/pilot/pkg/security/model"
+)
+
+// Controller watches the grants of the secrets.
+type Controller struct {
+	informer cache.SharedIndexInformer
+}
+
+var _ model.SecretGrants = &Controller{}
+
+// NewController creates a controller calling onChange when the grant of a secret changes.
+func NewController(client kubernetes.Interface, resyncPeriod time.Duration, onChange func()) *Controller {
+	c := &Controller{
+		informer: informers.NewSharedInformerFactory(client, resyncPeriod).Core().V1().Secrets().Informer(),
+	}
+	granted := func(obj interface{}) bool {
+		scrt, ok := obj.(*v1.Secret)
+		if !ok {
+			return false
+		}
+		_, f := scrt.Annotations[model.GatewayNamespacesAnnotation]
+		return f
+	}
+	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if granted(obj) {
+				onChange()
+			}
+		},
+		UpdateFunc: func(old, cur interface{}) {
+			if old.(*v1.Secret).Annotations[model.GatewayNamespacesAnnotation] !=
+				cur.(*v1.Secret).Annotations[model.GatewayNamespacesAnnotation] {
+				onChange()
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if granted(obj) {
+				onChange()
+			}
+		},
+	})
+	return c
+}
+
+// Run runs the controller until the stop channel is closed.
+func (c *Controller) Run(stop <-chan struct{}) {
+	c.informer.Run(stop)
+}
+
+// HasSynced returns true once the secrets are listed.
+func (c *Controller) HasSynced() bool {
+	return c.informer.HasSynced()
+}
+
+// AuthorizeCredential implements model.SecretGrants. The client CA certificate of a credentialName is either in its
+// own secret, or in the secret of the key and certificate, which grants the access to both.
+func (c *Controller) AuthorizeCredential(credentialName, gatewayNamespace string) error {
+	namespace, name := model.SplitCredentialName(credentialName)
+	if namespace == "" || namespace == gatewayNamespace {
+		return nil
+	}
+	obj, exists, err := c.informer.GetStore().GetByKey(namespace + "/" + name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("secret %s not found", credentialName)
+	}
+	scrt := obj.(*v1.Secret)
+	if err := model.AuthorizeGatewayNamespace(scrt.Annotations, gatewayNamespace); err != nil {
+		return fmt.Errorf("secret %s: %v", credentialName, err)
+	}
+	// A separate client CA secret must grant the access as well.
+	caName := name + authn_model.IngressGatewaySdsCaSuffix
+	if obj, exists, _ := c.informer.GetStore().GetByKey(namespace + "/" + caName); exists {
+		if err := model.AuthorizeGatewayNamespace(obj.(*v1.Secret).Annotations, gatewayNamespace); err != nil {
+			return fmt.Errorf("secret %s/%s: %v", namespace, caName, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secretgrant
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestAuthorizeCredential(t *testing.T) {
+	secret := func(namespace, name, granted string) *v1.Secret {
+		s := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+		if granted != "" {
+			s.Annotations = map[string]string{model.GatewayNamespacesAnnotation: granted}
+		}
+		return s
+	}
+	client := fake.NewSimpleClientset(
+		secret("shared-certs", "granted", "istio-system"),
+		secret("shared-certs", "ca-denied", "istio-system"),
+		secret("shared-certs", "ca-denied-cacert", "other-gateways"),
+		secret("private-certs", "private", ""),
+	)
+	c := NewController(client, 0, func() {})
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.Run(stop)
+	if !cache.WaitForCacheSync(stop, c.HasSynced) {
+		t.Fatal("failed to sync the secrets")
+	}
+
+	cases := []struct {
+		credentialName string
+		namespace      string
+		allowed        bool
+	}{
+		{"local", "istio-system", true},
+		{"istio-system/local", "istio-system", true},
+		{"shared-certs/granted", "istio-system", true},
+		{"shared-certs/granted", "other-gateways", false},
+		{"shared-certs/ca-denied", "istio-system", false},
+		{"shared-certs/missing", "istio-system", false},
+		{"private-certs/private", "istio-system", false},
+	}
+	for _, tc := range cases {
+		err := c.AuthorizeCredential(tc.credentialName, tc.namespace)
+		if (err == nil) != tc.allowed {
+			t.Errorf("AuthorizeCredential(%q, %q) got error %v, want allowed %v", tc.credentialName, tc.namespace,
+				err, tc.allowed)
+		}
+	}
+}
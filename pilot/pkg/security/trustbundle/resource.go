@@ -0,0 +1,89 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trustbundle
+
+import (
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+
+	"istio.io/pkg/log"
+)
+
+// TrustBundleResource is the resource of the TrustBundle config kind, read with the dynamic client. Only the
+// resources of the Istio namespace are trusted, as their roots are trusted by all the workloads of the mesh.
+var TrustBundleResource = schema.GroupVersionResource{Group: "security.istio.io", Version: "v1alpha1", Resource: "trustbundles"}
+
+// trustBundleResource is a TrustBundle resource, whose spec is a trust bundle named by the resource.
+type trustBundleResource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec TrustBundle `json:"spec"`
+}
+
+// Watch watches the TrustBundle resources of the namespace until the stop channel is closed, updating the trust
+// bundles of the ResourceSource and calling onChange when the merged roots change.
+func (m *Manager) Watch(client dynamic.Interface, namespace string, resyncPeriod time.Duration, onChange func(),
+	stop <-chan struct{}) {
+	informer := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, resyncPeriod, namespace, nil).
+		ForResource(TrustBundleResource).Informer()
+	update := func() {
+		if m.Update(ResourceSource, decodeTrustBundles(informer.GetStore().List())) {
+			log.Infof("trust bundles updated from the %s resources", TrustBundleResource.Resource)
+			onChange()
+		}
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { update() },
+		UpdateFunc: func(interface{}, interface{}) { update() },
+		DeleteFunc: func(interface{}) { update() },
+	})
+	informer.Run(stop)
+}
+
+// decodeTrustBundles returns the valid trust bundles of the resources, sorted by name.
+func decodeTrustBundles(objs []interface{}) []*TrustBundle {
+	var out []*TrustBundle
+	for _, obj := range objs {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		res := &trustBundleResource{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, res); err != nil {
+			log.Warnf("failed to decode the trust bundle %s/%s: %v", u.GetNamespace(), u.GetName(), err)
+			continue
+		}
+		b := res.Spec
+		b.Name = res.Name
+		if err := b.validate(); err != nil {
+			log.Warnf("invalid trust bundle %s/%s, ignored: %v", res.Namespace, res.Name, err)
+			continue
+		}
+		out = append(out, &b)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
@@ -0,0 +1,48 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trustbundle
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDecodeTrustBundles(t *testing.T) {
+	root := string(toPEM(newRoot(t, "partner")))
+	resource := func(name string, spec map[string]interface{}) interface{} {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "security.istio.io/v1alpha1",
+			"kind":       "TrustBundle",
+			"metadata":   map[string]interface{}{"name": name, "namespace": "istio-system"},
+			"spec":       spec,
+		}}
+	}
+
+	got := decodeTrustBundles([]interface{}{
+		resource("partner", map[string]interface{}{"pem": root}),
+		resource("federated", map[string]interface{}{"spiffeBundleEndpoint": "https://federated.example.com/bundle"}),
+		resource("plaintext", map[string]interface{}{"spiffeBundleEndpoint": "http://federated.example.com/bundle"}),
+		resource("empty", map[string]interface{}{}),
+	})
+	want := []*TrustBundle{
+		{Name: "federated", SpiffeBundleEndpoint: "https://federated.example.com/bundle"},
+		{Name: "partner", PEM: root},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeTrustBundles() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package trustbundle distributes root certificates trusted by the workloads in addition to the mesh root, so that
+// the workloads can trust external CAs without rebuilding their images or mounting secrets.
+package trustbundle
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// TrustBundle is a set of trust anchors, either a PEM bundle or the X.509 roots of a SPIFFE federation endpoint.
+type TrustBundle struct {
+	// Name of the bundle.
+	Name string `json:"name"`
+	// PEM encoded root certificates.
+	PEM string `json:"pem,omitempty"`
+	// SpiffeBundleEndpoint is the https URL of a SPIFFE bundle endpoint serving the roots of a trust domain.
+	SpiffeBundleEndpoint string `json:"spiffeBundleEndpoint,omitempty"`
+	// EndpointCA is the PEM of the roots verifying the certificate of the SPIFFE bundle endpoint, pinned instead
+	// of the system roots.
+	EndpointCA string `json:"endpointCA,omitempty"`
+}
+
+const (
+	// FileSource is the source of the trust bundles of the --trustBundles file in Manager.Update.
+	FileSource = "file"
+	// ResourceSource is the source of the trust bundles of the TrustBundle resources in Manager.Update.
+	ResourceSource = "resource"
+
+	fetchTimeout = 10 * time.Second
+)
+
+// LoadTrustBundles reads the trust bundles of a YAML or JSON file.
+func LoadTrustBundles(path string) ([]*TrustBundle, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var bundles []*TrustBundle
+	if err := yaml.Unmarshal(data, &bundles); err != nil {
+		return nil, fmt.Errorf("failed to parse the trust bundles of %s: %v", path, err)
+	}
+	for _, b := range bundles {
+		if err := b.validate(); err != nil {
+			return nil, fmt.Errorf("invalid trust bundle %s of %s: %v", b.Name, path, err)
+		}
+	}
+	return bundles, nil
+}
+
+func (b *TrustBundle) validate() error {
+	if b.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if (b.PEM == "") == (b.SpiffeBundleEndpoint == "") {
+		return fmt.Errorf("exactly one of pem and spiffeBundleEndpoint is required")
+	}
+	if b.PEM != "" {
+		if _, err := parseRoots([]byte(b.PEM)); err != nil {
+			return err
+		}
+		if b.EndpointCA != "" {
+			return fmt.Errorf("endpointCA requires spiffeBundleEndpoint")
+		}
+		return nil
+	}
+	// The roots fetched from the endpoint are trusted by all the workloads, so the endpoint is authenticated.
+	u, err := url.Parse(b.SpiffeBundleEndpoint)
+	if err != nil {
+		return fmt.Errorf("invalid spiffeBundleEndpoint: %v", err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("spiffeBundleEndpoint %s must be an https URL", b.SpiffeBundleEndpoint)
+	}
+	if b.EndpointCA != "" {
+		if _, err := parseRoots([]byte(b.EndpointCA)); err != nil {
+			return fmt.Errorf("invalid endpointCA: %v", err)
+		}
+	}
+	return nil
+}
+
+// parseRoots returns the PEM blocks of the certificates of a bundle, and an error if it has none.
+func parseRoots(data []byte) ([][]byte, error) {
+	var out [][]byte
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			out = append(out, pem.EncodeToMemory(block))
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no certificate found")
+	}
+	return out, nil
+}
+
+// spiffeBundle is the JWK set served by a SPIFFE bundle endpoint.
+type spiffeBundle struct {
+	Keys []struct {
+		Use string   `json:"use"`
+		X5c []string `json:"x5c"`
+	} `json:"keys"`
+}
+
+// endpointClient returns the client of the SPIFFE bundle endpoint of a bundle, verifying the endpoint with its
+// pinned roots or else the system roots. Redirects to other schemes than https are refused.
+func endpointClient(b *TrustBundle) *http.Client {
+	client := &http.Client{
+		Timeout: fetchTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to %s refused, the SPIFFE bundle endpoint must be https", req.URL)
+			}
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		},
+	}
+	if b.EndpointCA != "" {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM([]byte(b.EndpointCA))
+		client.Transport = &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: pool},
+			DisableKeepAlives: true,
+		}
+	}
+	return client
+}
+
+// fetchSpiffeBundle returns the PEM of the X.509 roots of a SPIFFE bundle endpoint.
+func fetchSpiffeBundle(client *http.Client, url string) ([][]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+	bundle := &spiffeBundle{}
+	if err := json.NewDecoder(resp.Body).Decode(bundle); err != nil {
+		return nil, fmt.Errorf("invalid SPIFFE bundle from %s: %v", url, err)
+	}
+	var out [][]byte
+	for _, key := range bundle.Keys {
+		if key.Use != "x509-svid" || len(key.X5c) == 0 {
+			continue
+		}
+		der, err := base64.StdEncoding.DecodeString(key.X5c[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid x5c of the SPIFFE bundle from %s: %v", url, err)
+		}
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no X.509 root in the SPIFFE bundle from %s", url)
+	}
+	return out, nil
+}
+
+// Manager merges the trust bundles with the mesh root. The roots of the SPIFFE bundle endpoints are refreshed
+// periodically, keeping the last fetched roots of an endpoint if it fails.
+type Manager struct {
+	meshRootFile string
+
+	mu sync.RWMutex
+	// bundles are the trust bundles by source, e.g. FileSource.
+	bundles map[string][]*TrustBundle
+	// fetched are the roots of the SPIFFE bundle endpoints by bundle key.
+	fetched map[string][][]byte
+	merged  []byte
+}
+
+var _ model.TrustBundle = &Manager{}
+
+// NewManager returns a manager of trust bundles, merged with the mesh root of a file.
+func NewManager(meshRootFile string) *Manager {
+	return &Manager{
+		meshRootFile: meshRootFile,
+		bundles:      map[string][]*TrustBundle{},
+		fetched:      map[string][][]byte{},
+	}
+}
+
+// MergedRoots implements model.TrustBundle.
+func (m *Manager) MergedRoots() []byte {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.merged
+}
+
+// Update replaces the trust bundles of a source, and returns true if the merged roots changed.
+func (m *Manager) Update(source string, bundles []*TrustBundle) bool {
+	m.mu.Lock()
+	m.bundles[source] = bundles
+	m.mu.Unlock()
+	return m.Refresh()
+}
+
+// keyedBundle is a trust bundle with its key, unique across the sources.
+type keyedBundle struct {
+	key string
+	*TrustBundle
+}
+
+// allBundles returns the trust bundles of all the sources, sorted by source.
+func (m *Manager) allBundles() []keyedBundle {
+	sources := make([]string, 0, len(m.bundles))
+	for source := range m.bundles {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	var out []keyedBundle
+	for _, source := range sources {
+		for _, b := range m.bundles[source] {
+			out = append(out, keyedBundle{key: source + "/" + b.Name, TrustBundle: b})
+		}
+	}
+	return out
+}
+
+// Refresh fetches the roots of the SPIFFE bundle endpoints and merges the roots again, e.g. after a rotation of
+// the mesh root. It returns true if the merged roots changed.
+func (m *Manager) Refresh() bool {
+	m.mu.RLock()
+	bundles := m.allBundles()
+	m.mu.RUnlock()
+
+	fetched := map[string][][]byte{}
+	for _, b := range bundles {
+		if b.SpiffeBundleEndpoint == "" {
+			continue
+		}
+		roots, err := fetchSpiffeBundle(endpointClient(b.TrustBundle), b.SpiffeBundleEndpoint)
+		if err != nil {
+			log.Warnf("failed to fetch the trust bundle %s: %v", b.key, err)
+			m.mu.RLock()
+			roots = m.fetched[b.key]
+			m.mu.RUnlock()
+		}
+		fetched[b.key] = roots
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fetched = fetched
+	merged := m.merge()
+	if bytes.Equal(merged, m.merged) {
+		return false
+	}
+	m.merged = merged
+	return true
+}
+
+// merge returns the mesh root followed by the distinct roots of the bundles, nil without roots in the bundles or
+// if the mesh root can't be read, as the workloads would no longer trust the mesh.
+func (m *Manager) merge() []byte {
+	seen := map[string]bool{}
+	var roots [][]byte
+	add := func(certs [][]byte) {
+		for _, c := range certs {
+			if !seen[string(c)] {
+				seen[string(c)] = true
+				roots = append(roots, c)
+			}
+		}
+	}
+
+	meshRoot, err := ioutil.ReadFile(m.meshRootFile)
+	if err != nil {
+		log.Warnf("failed to read the mesh root %s, the trust bundles are ignored: %v", m.meshRootFile, err)
+		return nil
+	}
+	meshRoots, err := parseRoots(meshRoot)
+	if err != nil {
+		log.Warnf("invalid mesh root %s, the trust bundles are ignored: %v", m.meshRootFile, err)
+		return nil
+	}
+	add(meshRoots)
+	for _, b := range m.allBundles() {
+		if b.PEM != "" {
+			certs, _ := parseRoots([]byte(b.PEM))
+			add(certs)
+		} else {
+			add(m.fetched[b.key])
+		}
+	}
+	if len(roots) == len(meshRoots) {
+		return nil
+	}
+	return bytes.Join(roots, nil)
+}
+
+// Run refreshes the roots at the interval until the stop channel is closed, calling onChange when they change.
+func (m *Manager) Run(interval time.Duration, onChange func(), stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if m.Refresh() {
+				onChange()
+			}
+		}
+	}
+}
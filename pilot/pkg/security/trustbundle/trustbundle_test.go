@@ -0,0 +1,179 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trustbundle
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newRoot returns the DER of a self-signed root certificate.
+func newRoot(t *testing.T, name string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{name}},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func toPEM(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func writeFile(t *testing.T, dir, name string, content []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadTrustBundles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trustbundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	root, err := json.Marshal(string(toPEM(newRoot(t, "partner"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeFile(t, dir, "bundles.yaml", []byte(`
+- name: partner
+  pem: `+string(root)+`
+- name: federated
+  spiffeBundleEndpoint: https://federated.example.com/bundle
+`))
+	bundles, err := LoadTrustBundles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundles) != 2 || bundles[1].SpiffeBundleEndpoint != "https://federated.example.com/bundle" {
+		t.Fatalf("LoadTrustBundles() = %v", bundles)
+	}
+
+	for _, invalid := range []string{
+		"- pem: " + string(root),
+		"- name: both\n  pem: " + string(root) + "\n  spiffeBundleEndpoint: https://federated.example.com/bundle",
+		"- name: none",
+		"- name: garbage\n  pem: garbage",
+		"- name: plaintext\n  spiffeBundleEndpoint: http://federated.example.com/bundle",
+		"- name: garbage-ca\n  spiffeBundleEndpoint: https://federated.example.com/bundle\n  endpointCA: garbage",
+		"- name: pem-ca\n  pem: " + string(root) + "\n  endpointCA: " + string(root),
+	} {
+		path := writeFile(t, dir, "invalid.yaml", []byte(invalid))
+		if _, err := LoadTrustBundles(path); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trustbundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	meshRoot := toPEM(newRoot(t, "mesh"))
+	partnerRoot := toPEM(newRoot(t, "partner"))
+	federatedRoot := newRoot(t, "federated")
+
+	available := int32(1)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&available) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"keys": [
+			{"use": "jwt-svid", "kty": "EC"},
+			{"use": "x509-svid", "kty": "EC", "x5c": ["` + base64.StdEncoding.EncodeToString(federatedRoot) + `"]}
+		]}`))
+	}))
+	defer server.Close()
+
+	m := NewManager(writeFile(t, dir, "root-cert.pem", meshRoot))
+	if m.Update(FileSource, nil) || m.MergedRoots() != nil {
+		t.Fatalf("expected no merged roots without trust bundles, got %s", m.MergedRoots())
+	}
+
+	// The endpoint is not trusted by the system roots.
+	unpinned := []*TrustBundle{{Name: "federated", SpiffeBundleEndpoint: server.URL}}
+	if m.Update(ResourceSource, unpinned) || m.MergedRoots() != nil {
+		t.Fatalf("expected no merged roots from an endpoint not trusted, got %s", m.MergedRoots())
+	}
+
+	bundles := []*TrustBundle{
+		{Name: "partner", PEM: string(partnerRoot)},
+		// The mesh root is not duplicated.
+		{Name: "mesh", PEM: string(meshRoot)},
+	}
+	pinned := []*TrustBundle{
+		{Name: "federated", SpiffeBundleEndpoint: server.URL, EndpointCA: string(toPEM(server.Certificate().Raw))},
+	}
+	m.Update(FileSource, bundles)
+	if !m.Update(ResourceSource, pinned) {
+		t.Fatal("expected the merged roots to change")
+	}
+	want := bytes.Join([][]byte{meshRoot, partnerRoot, toPEM(federatedRoot)}, nil)
+	if !bytes.Equal(m.MergedRoots(), want) {
+		t.Fatalf("MergedRoots() = %s, want %s", m.MergedRoots(), want)
+	}
+
+	// The last roots of an unavailable endpoint are kept.
+	atomic.StoreInt32(&available, 0)
+	if m.Refresh() || !bytes.Equal(m.MergedRoots(), want) {
+		t.Fatalf("expected the roots of the unavailable endpoint to be kept, got %s", m.MergedRoots())
+	}
+
+	// The trust bundles are ignored without the mesh root.
+	if err := os.Remove(filepath.Join(dir, "root-cert.pem")); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Refresh() || m.MergedRoots() != nil {
+		t.Fatalf("expected no merged roots without the mesh root, got %s", m.MergedRoots())
+	}
+}
@@ -16,11 +16,13 @@ package aggregate
 
 import (
 	"sync"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 
 	"istio.io/pkg/log"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/serviceregistry"
 	"istio.io/istio/pkg/config/host"
@@ -48,13 +50,25 @@ var (
 type Controller struct {
 	registries []Registry
 	storeLock  sync.RWMutex
+
+	// health of the registries by name and cluster ID. The registries failing failureThreshold consecutive
+	// times are not called for openDuration, so that one failing registry does not fail or slow down the pushes.
+	health           map[string]*registryHealth
+	healthMutex      sync.Mutex
+	failureThreshold int
+	openDuration     time.Duration
+	now              func() time.Time
 }
 
 // NewController creates a new Aggregate controller
 func NewController() *Controller {
 
 	return &Controller{
-		registries: []Registry{},
+		registries:       []Registry{},
+		health:           make(map[string]*registryHealth),
+		failureThreshold: features.RegistryFailureThreshold,
+		openDuration:     features.RegistryCircuitOpenDuration,
+		now:              time.Now,
 	}
 }
 
@@ -66,6 +80,7 @@ func (c *Controller) AddRegistry(registry Registry) {
 	registries := c.registries
 	registries = append(registries, registry)
 	c.registries = registries
+	registryHealthy.With(registryTag.Value(registryKey(registry))).Record(1)
 }
 
 // DeleteRegistry deletes specified registry from the aggregated controller
@@ -83,6 +98,9 @@ func (c *Controller) DeleteRegistry(clusterID string) {
 		return
 	}
 	registries := c.registries
+	c.healthMutex.Lock()
+	delete(c.health, registryKey(registries[index]))
+	c.healthMutex.Unlock()
 	registries = append(registries[:index], registries[index+1:]...)
 	c.registries = registries
 	log.Infof("Registry for the cluster %s has been deleted.", clusterID)
@@ -116,7 +134,7 @@ func (c *Controller) Services() ([]*model.Service, error) {
 	var errs error
 	// Locking Registries list while walking it to prevent inconsistent results
 	for _, r := range c.GetRegistries() {
-		svcs, err := r.Services()
+		svcs, err := c.registryServices(r)
 		if err != nil {
 			errs = multierror.Append(errs, err)
 			continue
@@ -170,10 +188,18 @@ func (c *Controller) Services() ([]*model.Service, error) {
 func (c *Controller) GetService(hostname host.Name) (*model.Service, error) {
 	var errs error
 	for _, r := range c.GetRegistries() {
+		if !c.allow(r) {
+			errs = multierror.Append(errs, c.circuitOpenError(r))
+			continue
+		}
 		service, err := r.GetService(hostname)
 		if err != nil {
+			c.recordFailure(r, err)
 			errs = multierror.Append(errs, err)
-		} else if service != nil {
+			continue
+		}
+		c.recordSuccess(r)
+		if service != nil {
 			if errs != nil {
 				log.Warnf("GetService() found match but encountered an error: %v", errs)
 			}
@@ -213,11 +239,19 @@ func (c *Controller) InstancesByPort(svc *model.Service, port int,
 	var instances, tmpInstances []*model.ServiceInstance
 	var errs error
 	for _, r := range c.GetRegistries() {
+		if !c.allow(r) {
+			errs = multierror.Append(errs, c.circuitOpenError(r))
+			continue
+		}
 		var err error
 		tmpInstances, err = r.InstancesByPort(svc, port, labels)
 		if err != nil {
+			c.recordFailure(r, err)
 			errs = multierror.Append(errs, err)
-		} else if len(tmpInstances) > 0 {
+			continue
+		}
+		c.recordSuccess(r)
+		if len(tmpInstances) > 0 {
 			if errs != nil {
 				log.Warnf("Instances() found match but encountered an error: %v", errs)
 			}
@@ -237,10 +271,18 @@ func (c *Controller) GetProxyServiceInstances(node *model.Proxy) ([]*model.Servi
 	// It doesn't make sense for a single proxy to be found in more than one registry.
 	// TODO: if otherwise, warning or else what to do about it.
 	for _, r := range c.GetRegistries() {
+		if !c.allow(r) {
+			errs = multierror.Append(errs, c.circuitOpenError(r))
+			continue
+		}
 		instances, err := r.GetProxyServiceInstances(node)
 		if err != nil {
+			c.recordFailure(r, err)
 			errs = multierror.Append(errs, err)
-		} else if len(instances) > 0 {
+			continue
+		}
+		c.recordSuccess(r)
+		if len(instances) > 0 {
 			out = append(out, instances...)
 			node.ClusterID = r.ClusterID
 			break
@@ -263,10 +305,18 @@ func (c *Controller) GetProxyWorkloadLabels(proxy *model.Proxy) (labels.Collecti
 	// It doesn't make sense for a single proxy to be found in more than one registry.
 	// TODO: if otherwise, warning or else what to do about it.
 	for _, r := range c.GetRegistries() {
+		if !c.allow(r) {
+			errs = multierror.Append(errs, c.circuitOpenError(r))
+			continue
+		}
 		wlLabels, err := r.GetProxyWorkloadLabels(proxy)
 		if err != nil {
+			c.recordFailure(r, err)
 			errs = multierror.Append(errs, err)
-		} else if len(wlLabels) > 0 {
+			continue
+		}
+		c.recordSuccess(r)
+		if len(wlLabels) > 0 {
 			out = append(out, wlLabels...)
 			break
 		}
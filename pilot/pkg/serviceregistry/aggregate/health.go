@@ -0,0 +1,205 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregate
+
+import (
+	"fmt"
+	"time"
+
+	"istio.io/pkg/log"
+	"istio.io/pkg/monitoring"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+var (
+	registryTag = monitoring.MustCreateLabel("registry")
+
+	registryHealthy = monitoring.NewGauge(
+		"pilot_registry_healthy",
+		"Whether the service registry is healthy (1) or its circuit is open after consecutive failures (0).",
+		monitoring.WithLabels(registryTag),
+	)
+
+	registryErrors = monitoring.NewSum(
+		"pilot_registry_errors",
+		"Errors returned by the service registry.",
+		monitoring.WithLabels(registryTag),
+	)
+)
+
+func init() {
+	monitoring.MustRegister(registryHealthy, registryErrors)
+}
+
+// RegistryHealth is the health of a registry of the aggregate controller.
+type RegistryHealth struct {
+	Registry  string `json:"registry"`
+	ClusterID string `json:"clusterID,omitempty"`
+	// CircuitOpen is true while the registry is not called after consecutive failures.
+	CircuitOpen         bool   `json:"circuitOpen"`
+	ConsecutiveFailures int    `json:"consecutiveFailures"`
+	LastError           string `json:"lastError,omitempty"`
+	// ServingStaleData is true if the last services of the registry are served instead of the current ones.
+	ServingStaleData bool `json:"servingStaleData"`
+}
+
+// Healthy returns true if the last call to the registry succeeded.
+func (h RegistryHealth) Healthy() bool {
+	return h.ConsecutiveFailures == 0
+}
+
+// registryHealth tracks the failures of a registry and its last services, served while it fails.
+type registryHealth struct {
+	failures  int
+	openUntil time.Time
+	lastError error
+	stale     bool
+
+	services    []*model.Service
+	hasServices bool
+}
+
+func registryKey(r Registry) string {
+	if r.ClusterID == "" {
+		return string(r.Name)
+	}
+	return string(r.Name) + "/" + r.ClusterID
+}
+
+func (c *Controller) registryHealth(r Registry) *registryHealth {
+	if c.health == nil {
+		c.health = make(map[string]*registryHealth)
+	}
+	key := registryKey(r)
+	h, ok := c.health[key]
+	if !ok {
+		h = &registryHealth{}
+		c.health[key] = h
+	}
+	return h
+}
+
+func (c *Controller) clock() time.Time {
+	if c.now == nil {
+		return time.Now()
+	}
+	return c.now()
+}
+
+// allow returns false while the circuit of the registry is open. Once the open duration elapses, the registry is
+// called again, and the circuit opens again on the first failure.
+func (c *Controller) allow(r Registry) bool {
+	c.healthMutex.Lock()
+	defer c.healthMutex.Unlock()
+	return !c.clock().Before(c.registryHealth(r).openUntil)
+}
+
+// circuitOpenError is the error of a registry skipped while its circuit is open, returned if no other registry
+// matches, since the registry may have the instances or labels asked for.
+func (c *Controller) circuitOpenError(r Registry) error {
+	c.healthMutex.Lock()
+	defer c.healthMutex.Unlock()
+	return fmt.Errorf("registry %s is unavailable, its circuit is open: %v", registryKey(r), c.registryHealth(r).lastError)
+}
+
+func (c *Controller) recordSuccess(r Registry) {
+	c.healthMutex.Lock()
+	defer c.healthMutex.Unlock()
+	h := c.registryHealth(r)
+	if h.failures == 0 {
+		return
+	}
+	if c.failureThreshold > 0 && h.failures >= c.failureThreshold {
+		log.Infof("Registry %s recovered", registryKey(r))
+		registryHealthy.With(registryTag.Value(registryKey(r))).Record(1)
+	}
+	h.failures = 0
+	h.openUntil = time.Time{}
+	h.lastError = nil
+	h.stale = false
+}
+
+func (c *Controller) recordFailure(r Registry, err error) {
+	c.healthMutex.Lock()
+	defer c.healthMutex.Unlock()
+	h := c.registryHealth(r)
+	h.failures++
+	h.lastError = err
+	registryErrors.With(registryTag.Value(registryKey(r))).Increment()
+	if c.failureThreshold > 0 && h.failures >= c.failureThreshold {
+		if h.failures == c.failureThreshold {
+			log.Warnf("Registry %s failed %d times, not calling it for %v: %v",
+				registryKey(r), h.failures, c.openDuration, err)
+		}
+		h.openUntil = c.clock().Add(c.openDuration)
+		registryHealthy.With(registryTag.Value(registryKey(r))).Record(0)
+	}
+}
+
+// registryServices returns the services of the registry, or its last services if it fails or its circuit is open.
+// An error is returned only if the registry fails before returning any services.
+func (c *Controller) registryServices(r Registry) ([]*model.Service, error) {
+	if c.allow(r) {
+		svcs, err := r.Services()
+		if err == nil {
+			c.recordSuccess(r)
+			c.healthMutex.Lock()
+			h := c.registryHealth(r)
+			h.services, h.hasServices = svcs, true
+			c.healthMutex.Unlock()
+			return svcs, nil
+		}
+		c.recordFailure(r, err)
+	}
+
+	c.healthMutex.Lock()
+	defer c.healthMutex.Unlock()
+	h := c.registryHealth(r)
+	if !h.hasServices {
+		return nil, fmt.Errorf("registry %s is unavailable: %v", registryKey(r), h.lastError)
+	}
+	if !h.stale {
+		log.Warnf("Registry %s is unavailable, serving its last %d services: %v",
+			registryKey(r), len(h.services), h.lastError)
+	}
+	h.stale = true
+	return h.services, nil
+}
+
+// RegistryHealth returns the health of the registries, in the order of the registries.
+func (c *Controller) RegistryHealth() []RegistryHealth {
+	registries := c.GetRegistries()
+	now := c.clock()
+
+	c.healthMutex.Lock()
+	defer c.healthMutex.Unlock()
+	out := make([]RegistryHealth, 0, len(registries))
+	for _, r := range registries {
+		h := c.registryHealth(r)
+		health := RegistryHealth{
+			Registry:            string(r.Name),
+			ClusterID:           r.ClusterID,
+			CircuitOpen:         now.Before(h.openUntil),
+			ConsecutiveFailures: h.failures,
+			ServingStaleData:    h.stale,
+		}
+		if h.lastError != nil {
+			health.LastError = h.lastError.Error()
+		}
+		out = append(out, health)
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregate
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry/memory"
+)
+
+func TestRegistryCircuitBreaking(t *testing.T) {
+	aggregateCtl := buildMockController()
+	aggregateCtl.failureThreshold = 2
+	aggregateCtl.openDuration = time.Minute
+	now := time.Now()
+	aggregateCtl.now = func() time.Time { return now }
+
+	expectServices := func(want int) {
+		t.Helper()
+		svcs, err := aggregateCtl.Services()
+		if err != nil {
+			t.Fatalf("Services() got error %v", err)
+		}
+		if len(svcs) != want {
+			t.Fatalf("Services() got %d services, want %d", len(svcs), want)
+		}
+	}
+	expectHealth := func(failures int, open, stale bool) {
+		t.Helper()
+		h := aggregateCtl.RegistryHealth()[0]
+		if h.ConsecutiveFailures != failures || h.CircuitOpen != open || h.ServingStaleData != stale {
+			t.Fatalf("got health %+v, want %d failures, circuit open %t, stale data %t", h, failures, open, stale)
+		}
+		if h.Healthy() != (failures == 0) {
+			t.Fatalf("got healthy %t with %d failures", h.Healthy(), failures)
+		}
+	}
+
+	expectServices(4)
+	expectHealth(0, false, false)
+
+	// The last services of the failing registry are served.
+	discovery1.ServicesError = errors.New("mock Services() error")
+	expectServices(4)
+	expectHealth(1, false, true)
+	expectServices(4)
+	expectHealth(2, true, true)
+	if h := aggregateCtl.RegistryHealth()[1]; !h.Healthy() {
+		t.Fatalf("got health %+v for the other registry, want healthy", h)
+	}
+
+	// The registry is not called while the circuit is open.
+	discovery1.ServicesError = nil
+	discovery1.AddService(memory.WorldService.Hostname, memory.WorldService)
+	expectServices(4)
+	expectHealth(2, true, true)
+
+	// The registry is called again after the open duration.
+	now = now.Add(2 * time.Minute)
+	expectServices(5)
+	expectHealth(0, false, false)
+}
+
+func TestRegistryCircuitOpenWithoutServices(t *testing.T) {
+	aggregateCtl := buildMockController()
+	aggregateCtl.failureThreshold = 1
+	aggregateCtl.openDuration = time.Minute
+
+	discovery1.ServicesError = errors.New("mock Services() error")
+	for i := 0; i < 2; i++ {
+		if _, err := aggregateCtl.Services(); err == nil {
+			t.Fatal("Services() got no error for a registry failing before returning any services")
+		}
+	}
+	if h := aggregateCtl.RegistryHealth()[0]; !h.CircuitOpen || h.ConsecutiveFailures != 1 {
+		t.Fatalf("got health %+v, want the circuit open after 1 failure", h)
+	}
+
+	// The other registries are called while the circuit is open.
+	if svc, err := aggregateCtl.GetService(memory.WorldService.Hostname); err != nil || svc == nil {
+		t.Fatalf("GetService() got %v, %v, want the service of the other registry", svc, err)
+	}
+
+	// The proxies of no other registry get the error of the open circuit rather than no instances or labels.
+	proxy := &model.Proxy{IPAddresses: []string{"10.10.10.10"}}
+	if instances, err := aggregateCtl.GetProxyServiceInstances(proxy); err == nil {
+		t.Fatalf("GetProxyServiceInstances() got %v, want the error of the open circuit", instances)
+	}
+	if wlLabels, err := aggregateCtl.GetProxyWorkloadLabels(proxy); err == nil {
+		t.Fatalf("GetProxyWorkloadLabels() got %v, want the error of the open circuit", wlLabels)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// autoScalingGroupTag is the tag set by EC2 auto scaling on the instances of the groups.
+const autoScalingGroupTag = "aws:autoscaling:groupName"
+
+// awsProvider lists the running instances of EC2 auto scaling groups, with the default credentials of the
+// AWS SDK.
+type awsProvider struct {
+	mutex   sync.Mutex
+	clients map[string]*ec2.EC2
+}
+
+func newAWSProvider() *awsProvider {
+	return &awsProvider{clients: make(map[string]*ec2.EC2)}
+}
+
+func (p *awsProvider) client(region string) (*ec2.EC2, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if c, f := p.clients[region]; f {
+		return c, nil
+	}
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(region)})
+	if err != nil {
+		return nil, err
+	}
+	c := ec2.New(sess)
+	p.clients[region] = c
+	return c, nil
+}
+
+func (p *awsProvider) Instances(group *InstanceGroup) ([]Instance, error) {
+	c, err := p.client(group.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("tag:" + autoScalingGroupTag), Values: aws.StringSlice([]string{group.Group})},
+			{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{ec2.InstanceStateNameRunning})},
+		},
+	}
+	var out []Instance
+	err = c.DescribeInstancesPages(input, func(page *ec2.DescribeInstancesOutput, _ bool) bool {
+		for _, reservation := range page.Reservations {
+			for _, instance := range reservation.Instances {
+				address := aws.StringValue(instance.PrivateIpAddress)
+				if address == "" {
+					continue
+				}
+				zone := ""
+				if instance.Placement != nil {
+					zone = aws.StringValue(instance.Placement.AvailabilityZone)
+				}
+				out = append(out, Instance{
+					ID:      aws.StringValue(instance.InstanceId),
+					Address: address,
+					Region:  group.Region,
+					Zone:    zone,
+				})
+			}
+		}
+		return true
+	})
+	return out, err
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// AWSProvider syncs the instances of an EC2 auto scaling group.
+	AWSProvider = "aws"
+	// GCEProvider syncs the instances of a GCE instance group.
+	GCEProvider = "gce"
+)
+
+// InstanceGroup is a group of cloud instances synced to a ServiceEntry with the same name, whose endpoints are
+// the running instances of the group.
+type InstanceGroup struct {
+	// Name and Namespace of the ServiceEntry.
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+
+	// Provider is the cloud provider of the group, aws or gce.
+	Provider string `json:"provider"`
+	// Region of an EC2 auto scaling group.
+	Region string `json:"region,omitempty"`
+	// Project and Zone of a GCE instance group.
+	Project string `json:"project,omitempty"`
+	Zone    string `json:"zone,omitempty"`
+	// Group is the name of the auto scaling group or instance group.
+	Group string `json:"group"`
+
+	// Hosts and Ports of the ServiceEntry.
+	Hosts []string `json:"hosts"`
+	Ports []Port   `json:"ports"`
+	// Labels of the endpoints.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Network of the endpoints.
+	Network string `json:"network,omitempty"`
+}
+
+// Port is a port of the instances.
+type Port struct {
+	Number   uint32 `json:"number"`
+	Protocol string `json:"protocol"`
+	Name     string `json:"name"`
+}
+
+// LoadInstanceGroups reads the instance groups of a YAML or JSON file.
+func LoadInstanceGroups(path string) ([]*InstanceGroup, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var groups []*InstanceGroup
+	if err := yaml.Unmarshal(data, &groups); err != nil {
+		return nil, fmt.Errorf("failed to parse the instance groups of %s: %v", path, err)
+	}
+	names := make(map[string]bool, len(groups))
+	for _, g := range groups {
+		if err := g.validate(); err != nil {
+			return nil, fmt.Errorf("invalid instance group %s/%s of %s: %v", g.Namespace, g.Name, path, err)
+		}
+		key := g.Namespace + "/" + g.Name
+		if names[key] {
+			return nil, fmt.Errorf("instance group %s defined multiple times in %s", key, path)
+		}
+		names[key] = true
+	}
+	return groups, nil
+}
+
+func (g *InstanceGroup) validate() error {
+	if g.Name == "" || g.Namespace == "" {
+		return fmt.Errorf("name and namespace are required")
+	}
+	if g.Group == "" {
+		return fmt.Errorf("group is required")
+	}
+	switch g.Provider {
+	case AWSProvider:
+		if g.Region == "" {
+			return fmt.Errorf("region is required for provider %s", g.Provider)
+		}
+	case GCEProvider:
+		if g.Project == "" || g.Zone == "" {
+			return fmt.Errorf("project and zone are required for provider %s", g.Provider)
+		}
+	default:
+		return fmt.Errorf("unknown provider %q", g.Provider)
+	}
+	if len(g.Hosts) == 0 || len(g.Ports) == 0 {
+		return fmt.Errorf("hosts and ports are required")
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+
+	networking "istio.io/api/networking/v1alpha3"
+	istiolog "istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+var log = istiolog.RegisterScope("registry-cloud", "cloud instance group registry debugging", 0)
+
+// InstanceGroupAnnotation is set on the ServiceEntries synced from the cloud instance groups, to the provider and
+// name of the group. The ServiceEntries without the annotation are never modified.
+const InstanceGroupAnnotation = "networking.istio.io/cloudInstanceGroup"
+
+// Instance is a running cloud instance.
+type Instance struct {
+	ID      string
+	Address string
+	Region  string
+	Zone    string
+}
+
+// Provider lists the running instances of the instance groups of a cloud provider.
+type Provider interface {
+	Instances(group *InstanceGroup) ([]Instance, error)
+}
+
+// Controller periodically syncs the instances of cloud instance groups to ServiceEntries, for the VMs managed by
+// auto scaling groups rather than Kubernetes.
+type Controller struct {
+	store     model.ConfigStore
+	groups    []*InstanceGroup
+	providers map[string]Provider
+	interval  time.Duration
+}
+
+// NewController creates a controller syncing the instance groups to the ServiceEntries of the store.
+func NewController(store model.ConfigStore, groups []*InstanceGroup, interval time.Duration) *Controller {
+	return &Controller{
+		store:  store,
+		groups: groups,
+		providers: map[string]Provider{
+			AWSProvider: newAWSProvider(),
+			GCEProvider: newGCEProvider(),
+		},
+		interval: interval,
+	}
+}
+
+// Run syncs the instance groups until the stop channel is closed.
+func (c *Controller) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.sync()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Controller) sync() {
+	for _, g := range c.groups {
+		if err := c.syncGroup(g); err != nil {
+			log.Warnf("Failed to sync the instance group %s/%s: %v", g.Namespace, g.Name, err)
+		}
+	}
+}
+
+// syncGroup updates the ServiceEntry of a group to its running instances. The ServiceEntry is kept unchanged if
+// the instances can not be listed, and deleted if the group has no instance.
+func (c *Controller) syncGroup(g *InstanceGroup) error {
+	provider, f := c.providers[g.Provider]
+	if !f {
+		return fmt.Errorf("unknown provider %q", g.Provider)
+	}
+	instances, err := provider.Instances(g)
+	if err != nil {
+		return err
+	}
+
+	existing := c.store.Get(schemas.ServiceEntry.Type, g.Name, g.Namespace)
+	if existing != nil && existing.Annotations[InstanceGroupAnnotation] != groupID(g) {
+		return fmt.Errorf("ServiceEntry %s/%s is not managed by the instance group", g.Namespace, g.Name)
+	}
+
+	if len(instances) == 0 {
+		if existing == nil {
+			return nil
+		}
+		log.Infof("Instance group %s/%s has no running instance, deleting its ServiceEntry", g.Namespace, g.Name)
+		return c.store.Delete(schemas.ServiceEntry.Type, g.Name, g.Namespace)
+	}
+
+	spec := serviceEntry(g, instances)
+	if existing == nil {
+		log.Infof("Creating the ServiceEntry of instance group %s/%s with %d instances", g.Namespace, g.Name, len(instances))
+		_, err := c.store.Create(model.Config{
+			ConfigMeta: model.ConfigMeta{
+				Type:        schemas.ServiceEntry.Type,
+				Group:       schemas.ServiceEntry.Group,
+				Version:     schemas.ServiceEntry.Version,
+				Name:        g.Name,
+				Namespace:   g.Namespace,
+				Annotations: map[string]string{InstanceGroupAnnotation: groupID(g)},
+			},
+			Spec: spec,
+		})
+		return err
+	}
+	if proto.Equal(existing.Spec, spec) {
+		return nil
+	}
+	log.Infof("Updating the ServiceEntry of instance group %s/%s to %d instances", g.Namespace, g.Name, len(instances))
+	updated := *existing
+	updated.Spec = spec
+	_, err = c.store.Update(updated)
+	return err
+}
+
+func groupID(g *InstanceGroup) string {
+	return g.Provider + "/" + g.Group
+}
+
+// serviceEntry returns the ServiceEntry of the instances of a group, whose endpoints have the locality of
+// their zone.
+func serviceEntry(g *InstanceGroup, instances []Instance) *networking.ServiceEntry {
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Address < instances[j].Address })
+
+	se := &networking.ServiceEntry{
+		Hosts:      g.Hosts,
+		Location:   networking.ServiceEntry_MESH_INTERNAL,
+		Resolution: networking.ServiceEntry_STATIC,
+	}
+	for _, p := range g.Ports {
+		se.Ports = append(se.Ports, &networking.Port{
+			Number:   p.Number,
+			Protocol: p.Protocol,
+			Name:     p.Name,
+		})
+	}
+	for _, instance := range instances {
+		locality := instance.Region
+		if instance.Zone != "" {
+			locality += "/" + instance.Zone
+		}
+		se.Endpoints = append(se.Endpoints, &networking.ServiceEntry_Endpoint{
+			Address:  instance.Address,
+			Labels:   g.Labels,
+			Network:  g.Network,
+			Locality: locality,
+		})
+	}
+	return se
+}
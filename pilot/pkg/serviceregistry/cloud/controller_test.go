@@ -0,0 +1,223 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+type fakeProvider struct {
+	instances []Instance
+	err       error
+}
+
+func (p *fakeProvider) Instances(*InstanceGroup) ([]Instance, error) {
+	return p.instances, p.err
+}
+
+func TestControllerSync(t *testing.T) {
+	store := memory.Make(schemas.Istio)
+	group := &InstanceGroup{
+		Name:      "billing",
+		Namespace: "legacy",
+		Provider:  AWSProvider,
+		Region:    "us-east-1",
+		Group:     "billing-asg",
+		Hosts:     []string{"billing.legacy.internal"},
+		Ports:     []Port{{Number: 8080, Protocol: "HTTP", Name: "http"}},
+		Labels:    map[string]string{"app": "billing"},
+	}
+	provider := &fakeProvider{}
+	c := &Controller{
+		store:     store,
+		groups:    []*InstanceGroup{group},
+		providers: map[string]Provider{AWSProvider: provider},
+	}
+	endpoints := func() []*networking.ServiceEntry_Endpoint {
+		t.Helper()
+		cfg := store.Get(schemas.ServiceEntry.Type, group.Name, group.Namespace)
+		if cfg == nil {
+			return nil
+		}
+		if cfg.Annotations[InstanceGroupAnnotation] != "aws/billing-asg" {
+			t.Errorf("unexpected annotations %v", cfg.Annotations)
+		}
+		return cfg.Spec.(*networking.ServiceEntry).Endpoints
+	}
+
+	provider.instances = []Instance{
+		{ID: "i-2", Address: "10.0.0.2", Region: "us-east-1", Zone: "us-east-1b"},
+		{ID: "i-1", Address: "10.0.0.1", Region: "us-east-1", Zone: "us-east-1a"},
+	}
+	if err := c.syncGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	eps := endpoints()
+	if len(eps) != 2 || eps[0].Address != "10.0.0.1" || eps[0].Locality != "us-east-1/us-east-1a" ||
+		eps[0].Labels["app"] != "billing" || eps[1].Address != "10.0.0.2" {
+		t.Fatalf("unexpected endpoints %v", eps)
+	}
+
+	// The instances are kept if they can not be listed.
+	provider.instances, provider.err = nil, errors.New("throttled")
+	if err := c.syncGroup(group); err == nil {
+		t.Fatal("expected an error")
+	}
+	if eps := endpoints(); len(eps) != 2 {
+		t.Fatalf("unexpected endpoints %v", eps)
+	}
+
+	provider.instances = []Instance{{ID: "i-3", Address: "10.0.0.3", Region: "us-east-1", Zone: "us-east-1c"}}
+	provider.err = nil
+	if err := c.syncGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	if eps := endpoints(); len(eps) != 1 || eps[0].Address != "10.0.0.3" {
+		t.Fatalf("unexpected endpoints %v", eps)
+	}
+
+	// The ServiceEntry is deleted when the group is scaled to zero.
+	provider.instances = nil
+	if err := c.syncGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	if store.Get(schemas.ServiceEntry.Type, group.Name, group.Namespace) != nil {
+		t.Fatal("the ServiceEntry of the empty group was not deleted")
+	}
+}
+
+func TestControllerSyncUnmanagedServiceEntry(t *testing.T) {
+	store := memory.Make(schemas.Istio)
+	if _, err := store.Create(model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:      schemas.ServiceEntry.Type,
+			Name:      "billing",
+			Namespace: "legacy",
+		},
+		Spec: &networking.ServiceEntry{
+			Hosts:      []string{"billing.legacy.internal"},
+			Ports:      []*networking.Port{{Number: 80, Protocol: "HTTP", Name: "http"}},
+			Resolution: networking.ServiceEntry_DNS,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	group := &InstanceGroup{
+		Name:      "billing",
+		Namespace: "legacy",
+		Provider:  GCEProvider,
+		Group:     "billing",
+		Hosts:     []string{"billing.legacy.internal"},
+		Ports:     []Port{{Number: 8080, Protocol: "HTTP", Name: "http"}},
+	}
+	c := &Controller{
+		store: store,
+		providers: map[string]Provider{GCEProvider: &fakeProvider{
+			instances: []Instance{{ID: "1", Address: "10.0.0.1", Region: "us-central1", Zone: "us-central1-a"}},
+		}},
+	}
+	if err := c.syncGroup(group); err == nil {
+		t.Fatal("expected the ServiceEntry not managed by the group to be kept")
+	}
+	cfg := store.Get(schemas.ServiceEntry.Type, group.Name, group.Namespace)
+	if cfg.Spec.(*networking.ServiceEntry).Resolution != networking.ServiceEntry_DNS {
+		t.Fatalf("the ServiceEntry was modified: %v", cfg.Spec)
+	}
+}
+
+func TestLoadInstanceGroups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		name   string
+		config string
+		groups int
+		valid  bool
+	}{
+		{"valid", `
+- name: billing
+  namespace: legacy
+  provider: aws
+  region: us-east-1
+  group: billing-asg
+  hosts: [billing.legacy.internal]
+  ports:
+  - {number: 8080, protocol: HTTP, name: http}
+- name: reports
+  namespace: legacy
+  provider: gce
+  project: legacy-project
+  zone: us-central1-a
+  group: reports
+  hosts: [reports.legacy.internal]
+  ports:
+  - {number: 9090, protocol: GRPC, name: grpc}
+`, 2, true},
+		{"unknown provider", `
+- name: billing
+  namespace: legacy
+  provider: azure
+  group: billing
+  hosts: [billing.legacy.internal]
+  ports:
+  - {number: 8080, protocol: HTTP, name: http}
+`, 0, false},
+		{"missing zone", `
+- name: reports
+  namespace: legacy
+  provider: gce
+  project: legacy-project
+  group: reports
+  hosts: [reports.legacy.internal]
+  ports:
+  - {number: 9090, protocol: GRPC, name: grpc}
+`, 0, false},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "groups.yaml")
+			if err := ioutil.WriteFile(path, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			groups, err := LoadInstanceGroups(path)
+			if tt.valid != (err == nil) {
+				t.Fatalf("LoadInstanceGroups() = %v, want valid %v", err, tt.valid)
+			}
+			if len(groups) != tt.groups {
+				t.Fatalf("LoadInstanceGroups() returned %d groups, want %d", len(groups), tt.groups)
+			}
+		})
+	}
+}
+
+func TestGCERegion(t *testing.T) {
+	if got := gceRegion("us-central1-a"); got != "us-central1" {
+		t.Errorf("gceRegion() = %q", got)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+const gceRunningStatus = "RUNNING"
+
+// gceProvider lists the running instances of GCE instance groups, with the application default credentials.
+type gceProvider struct {
+	mutex   sync.Mutex
+	service *compute.Service
+}
+
+func newGCEProvider() *gceProvider {
+	return &gceProvider{}
+}
+
+func (p *gceProvider) client() (*compute.Service, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.service != nil {
+		return p.service, nil
+	}
+	s, err := compute.NewService(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	p.service = s
+	return s, nil
+}
+
+func (p *gceProvider) Instances(group *InstanceGroup) ([]Instance, error) {
+	s, err := p.client()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	var names []string
+	req := &compute.InstanceGroupsListInstancesRequest{InstanceState: gceRunningStatus}
+	err = s.InstanceGroups.ListInstances(group.Project, group.Zone, group.Group, req).Pages(ctx,
+		func(page *compute.InstanceGroupsListInstances) error {
+			for _, item := range page.Items {
+				// The instances are listed by URL.
+				names = append(names, lastSegment(item.Instance))
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	region := gceRegion(group.Zone)
+	out := make([]Instance, 0, len(names))
+	for _, name := range names {
+		instance, err := s.Instances.Get(group.Project, group.Zone, name).Context(ctx).Do()
+		if err != nil {
+			return nil, err
+		}
+		if instance.Status != gceRunningStatus || len(instance.NetworkInterfaces) == 0 {
+			continue
+		}
+		out = append(out, Instance{
+			ID:      strconv.FormatUint(instance.Id, 10),
+			Address: instance.NetworkInterfaces[0].NetworkIP,
+			Region:  region,
+			Zone:    group.Zone,
+		})
+	}
+	return out, nil
+}
+
+func lastSegment(url string) string {
+	return url[strings.LastIndex(url, "/")+1:]
+}
+
+// gceRegion returns the region of a zone, e.g. us-central1 for us-central1-a.
+func gceRegion(zone string) string {
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		return zone[:i]
+	}
+	return zone
+}
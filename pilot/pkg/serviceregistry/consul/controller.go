@@ -20,8 +20,6 @@ import (
 
 	"github.com/hashicorp/consul/api"
 
-	"istio.io/pkg/log"
-
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pkg/config/host"
 	"istio.io/istio/pkg/config/labels"
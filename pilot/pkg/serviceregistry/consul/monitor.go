@@ -20,7 +20,6 @@ import (
 	"github.com/hashicorp/consul/api"
 
 	"istio.io/istio/pilot/pkg/model"
-	"istio.io/pkg/log"
 )
 
 // Monitor handles service and instance changes
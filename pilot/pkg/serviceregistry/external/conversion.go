@@ -167,6 +167,7 @@ func convertEndpoint(service *model.Service, servicePort *networking.Port,
 		Service:   service,
 		Labels:    endpoint.Labels,
 		MTLSReady: mtlsReady,
+		TLSMode:   model.ParseEndpointTLSMode(endpoint.Labels[model.TLSModeLabelName]),
 	}
 }
 
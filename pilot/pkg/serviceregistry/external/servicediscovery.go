@@ -18,9 +18,14 @@ import (
 	"sync"
 	"time"
 
+	"github.com/gogo/protobuf/proto"
+
+	networking "istio.io/api/networking/v1alpha3"
+
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pkg/config/host"
 	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/protocol"
 	"istio.io/istio/pkg/config/schemas"
 )
 
@@ -46,6 +51,13 @@ type ServiceEntryStore struct {
 	changeMutex  sync.RWMutex
 	lastChange   time.Time
 	updateNeeded bool
+	// staticEntries holds the last seen spec of the STATIC ServiceEntries, by namespace/name, to detect the
+	// updates of their endpoints. Protected by changeMutex.
+	staticEntries map[string]*networking.ServiceEntry
+
+	// XDSUpdater, if set, is notified of the endpoints of the STATIC ServiceEntries whose endpoints alone
+	// changed, so the new endpoints are pushed through EDS instead of a full push.
+	XDSUpdater model.XDSUpdater
 }
 
 // NewServiceDiscovery creates a new ServiceEntry discovery service
@@ -57,6 +69,7 @@ func NewServiceDiscovery(callbacks model.ConfigStoreCache, store model.IstioConf
 		ip2instance:      map[string][]*model.ServiceInstance{},
 		instances:        map[host.Name]map[string][]*model.ServiceInstance{},
 		updateNeeded:     true,
+		staticEntries:    map[string]*networking.ServiceEntry{},
 	}
 	if callbacks != nil {
 		callbacks.RegisterEventHandler(schemas.ServiceEntry.Type, func(config model.Config, event model.Event) {
@@ -64,8 +77,18 @@ func NewServiceDiscovery(callbacks model.ConfigStoreCache, store model.IstioConf
 			c.changeMutex.Lock()
 			c.lastChange = time.Now()
 			c.updateNeeded = true
+			prev, endpointsOnly := c.recordStaticEntry(config, event)
 			c.changeMutex.Unlock()
 
+			if endpointsOnly && c.XDSUpdater != nil {
+				c.edsUpdate(config)
+				// The proxies running at the added or removed endpoints have new service instances.
+				for _, address := range changedEndpointAddresses(prev, config.Spec.(*networking.ServiceEntry)) {
+					c.XDSUpdater.ProxyUpdate("", address)
+				}
+				return
+			}
+
 			services := convertServices(config)
 			for _, handler := range c.serviceHandlers {
 				for _, service := range services {
@@ -85,6 +108,94 @@ func NewServiceDiscovery(callbacks model.ConfigStoreCache, store model.IstioConf
 	return c
 }
 
+// recordStaticEntry records the spec of a STATIC ServiceEntry, and returns its previous spec and true if the
+// event only updates its endpoints. Must be called with changeMutex held.
+func (d *ServiceEntryStore) recordStaticEntry(cfg model.Config, event model.Event) (*networking.ServiceEntry, bool) {
+	se, ok := cfg.Spec.(*networking.ServiceEntry)
+	if !ok {
+		return nil, false
+	}
+	key := cfg.Namespace + "/" + cfg.Name
+	prev := d.staticEntries[key]
+	if event == model.EventDelete || se.Resolution != networking.ServiceEntry_STATIC {
+		delete(d.staticEntries, key)
+		return prev, false
+	}
+	d.staticEntries[key] = se
+	return prev, event == model.EventUpdate && prev != nil && endpointsOnlyChanged(prev, se)
+}
+
+// endpointsOnlyChanged returns true if the endpoints of a ServiceEntry changed, and nothing else.
+func endpointsOnlyChanged(prev, cur *networking.ServiceEntry) bool {
+	if proto.Equal(prev, cur) {
+		return false
+	}
+
+	// Compare the rest of the specs, once the previous endpoints are restored.
+	restored := proto.Clone(cur).(*networking.ServiceEntry)
+	restored.Endpoints = prev.Endpoints
+	return proto.Equal(prev, restored)
+}
+
+// changedEndpointAddresses returns the addresses of the endpoints added to or removed from a ServiceEntry.
+func changedEndpointAddresses(prev, cur *networking.ServiceEntry) []string {
+	prevAddresses := make(map[string]bool, len(prev.Endpoints))
+	for _, ep := range prev.Endpoints {
+		prevAddresses[ep.Address] = true
+	}
+	curAddresses := make(map[string]bool, len(cur.Endpoints))
+	for _, ep := range cur.Endpoints {
+		curAddresses[ep.Address] = true
+	}
+
+	var out []string
+	for address := range curAddresses {
+		if !prevAddresses[address] {
+			out = append(out, address)
+		}
+	}
+	for address := range prevAddresses {
+		if !curAddresses[address] {
+			out = append(out, address)
+		}
+	}
+	return out
+}
+
+// edsUpdate notifies the XDSUpdater of the endpoints of the hosts of a ServiceEntry, including the ones of
+// the other ServiceEntries of the same hosts, the way the endpoint shards of the registry are reconciled on
+// full pushes.
+func (d *ServiceEntryStore) edsUpdate(cfg model.Config) {
+	for _, svc := range convertServices(cfg) {
+		endpoints := make([]*model.IstioEndpoint, 0)
+		for _, port := range svc.Ports {
+			if port.Protocol == protocol.UDP {
+				continue
+			}
+			instances, _ := d.InstancesByPort(svc, port.Port, nil)
+			for _, instance := range instances {
+				endpoints = append(endpoints, &model.IstioEndpoint{
+					Family:          instance.Endpoint.Family,
+					Address:         instance.Endpoint.Address,
+					EndpointPort:    uint32(instance.Endpoint.Port),
+					ServicePortName: port.Name,
+					Labels:          instance.Labels,
+					UID:             instance.Endpoint.UID,
+					ServiceAccount:  instance.ServiceAccount,
+					Network:         instance.Endpoint.Network,
+					Locality:        instance.GetLocality(),
+					LbWeight:        instance.Endpoint.LbWeight,
+					Attributes:      instance.Service.Attributes,
+					MTLSReady:       instance.MTLSReady,
+					TLSMode:         instance.TLSMode,
+				})
+			}
+		}
+		// The ServiceEntry registry is aggregated without cluster ID, which keys its endpoint shard.
+		_ = d.XDSUpdater.EDSUpdate("", string(svc.Hostname), svc.Attributes.Namespace, endpoints)
+	}
+}
+
 // AppendServiceHandler adds service resource event handler
 func (d *ServiceEntryStore) AppendServiceHandler(f func(*model.Service, model.Event)) error {
 	d.serviceHandlers = append(d.serviceHandlers, f)
@@ -18,6 +18,9 @@ import (
 	"fmt"
 	"sort"
 	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
 
 	networking "istio.io/api/networking/v1alpha3"
 
@@ -224,6 +227,158 @@ func TestNonServiceConfig(t *testing.T) {
 	}
 }
 
+type fakeEDSUpdater struct {
+	model.XDSUpdater
+	updates      chan []*model.IstioEndpoint
+	proxyUpdates chan string
+}
+
+func (f *fakeEDSUpdater) EDSUpdate(_, _ string, _ string, entry []*model.IstioEndpoint) error {
+	f.updates <- entry
+	return nil
+}
+
+func (f *fakeEDSUpdater) ProxyUpdate(_, ip string) {
+	f.proxyUpdates <- ip
+}
+
+func TestServiceDiscoveryEndpointWeightUpdate(t *testing.T) {
+	store, sd, stopFn := initServiceDiscovery()
+	defer stopFn()
+	updater := &fakeEDSUpdater{updates: make(chan []*model.IstioEndpoint, 10), proxyUpdates: make(chan string, 10)}
+	sd.XDSUpdater = updater
+
+	entry := *tcpStatic
+	entry.Spec = proto.Clone(tcpStatic.Spec)
+	createServiceEntries([]*model.Config{&entry}, store, t)
+
+	cfg := store.Get(schemas.ServiceEntry.Type, entry.Name, entry.Namespace)
+	if cfg == nil {
+		t.Fatalf("ServiceEntry %s not found", entry.Name)
+	}
+	// The store shares the spec with the registry, which must see the previous one.
+	cfg.Spec = proto.Clone(cfg.Spec)
+	cfg.Spec.(*networking.ServiceEntry).Endpoints[0].Weight = 10
+	if _, err := store.Update(*cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case endpoints := <-updater.updates:
+		weights := map[string]uint32{}
+		for _, ep := range endpoints {
+			weights[ep.Address] = ep.LbWeight
+		}
+		if weights["1.1.1.1"] != 10 || weights["2.2.2.2"] != 0 {
+			t.Errorf("got endpoint weights %v, want 10 for 1.1.1.1 and 0 for 2.2.2.2", weights)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("endpoint weight update was not pushed through EDS")
+	}
+}
+
+func TestServiceDiscoveryEndpointsUpdate(t *testing.T) {
+	store, sd, stopFn := initServiceDiscovery()
+	defer stopFn()
+	updater := &fakeEDSUpdater{updates: make(chan []*model.IstioEndpoint, 10), proxyUpdates: make(chan string, 10)}
+	sd.XDSUpdater = updater
+	fullPushes := make(chan *model.Service, 10)
+	if err := sd.AppendServiceHandler(func(svc *model.Service, _ model.Event) { fullPushes <- svc }); err != nil {
+		t.Fatal(err)
+	}
+
+	entry := *tcpStatic
+	entry.Spec = proto.Clone(tcpStatic.Spec)
+	createServiceEntries([]*model.Config{&entry}, store, t)
+	// Drain the full push of the creation.
+	select {
+	case <-fullPushes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServiceEntry creation did not trigger a full push")
+	}
+	for len(fullPushes) > 0 {
+		<-fullPushes
+	}
+
+	cfg := store.Get(schemas.ServiceEntry.Type, entry.Name, entry.Namespace)
+	if cfg == nil {
+		t.Fatalf("ServiceEntry %s not found", entry.Name)
+	}
+	cfg.Spec = proto.Clone(cfg.Spec)
+	se := cfg.Spec.(*networking.ServiceEntry)
+	se.Endpoints = append(se.Endpoints[1:], &networking.ServiceEntry_Endpoint{Address: "3.3.3.3"})
+	if _, err := store.Update(*cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case endpoints := <-updater.updates:
+		addresses := map[string]bool{}
+		for _, ep := range endpoints {
+			addresses[ep.Address] = true
+		}
+		if addresses["1.1.1.1"] || !addresses["2.2.2.2"] || !addresses["3.3.3.3"] {
+			t.Errorf("got endpoints %v, want 2.2.2.2 and 3.3.3.3", addresses)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("endpoint update was not pushed through EDS")
+	}
+
+	proxies := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case ip := <-updater.proxyUpdates:
+			proxies[ip] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("the proxies of the added and removed endpoints were not pushed")
+		}
+	}
+	if !proxies["1.1.1.1"] || !proxies["3.3.3.3"] {
+		t.Errorf("got proxy updates %v, want 1.1.1.1 and 3.3.3.3", proxies)
+	}
+
+	// An endpoint-only change keeps the CDS and LDS configs, so no full push is requested.
+	select {
+	case svc := <-fullPushes:
+		t.Errorf("endpoint update triggered a full push of %s", svc.Hostname)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestEndpointsOnlyChanged(t *testing.T) {
+	prev := tcpStatic.Spec.(*networking.ServiceEntry)
+	withWeight := func(weight uint32) *networking.ServiceEntry {
+		se := proto.Clone(prev).(*networking.ServiceEntry)
+		se.Endpoints[1].Weight = weight
+		return se
+	}
+	relabeled := withWeight(5)
+	relabeled.Endpoints[0].Labels = map[string]string{"version": "v2"}
+	moreEndpoints := withWeight(5)
+	moreEndpoints.Endpoints = append(moreEndpoints.Endpoints, &networking.ServiceEntry_Endpoint{Address: "3.3.3.3"})
+	newPort := withWeight(5)
+	newPort.Ports = append(newPort.Ports, &networking.Port{Number: 8080, Name: "http-alt", Protocol: "HTTP"})
+
+	cases := []struct {
+		name string
+		cur  *networking.ServiceEntry
+		want bool
+	}{
+		{"unchanged", withWeight(0), false},
+		{"weight changed", withWeight(5), true},
+		{"weight and labels changed", relabeled, true},
+		{"endpoint added", moreEndpoints, true},
+		{"port added", newPort, false},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := endpointsOnlyChanged(prev, tt.cur); got != tt.want {
+				t.Errorf("endpointsOnlyChanged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func sortServices(services []*model.Service) {
 	sort.Slice(services, func(i, j int) bool { return services[i].Hostname < services[j].Hostname })
 	for _, service := range services {
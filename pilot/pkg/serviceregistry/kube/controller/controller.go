@@ -34,7 +34,6 @@ import (
 	"k8s.io/client-go/tools/cache"
 
 	meshconfig "istio.io/api/mesh/v1alpha1"
-	"istio.io/pkg/log"
 	"istio.io/pkg/monitoring"
 
 	"istio.io/istio/pilot/pkg/features"
@@ -105,6 +104,10 @@ type Options struct {
 
 	// TrustDomain used in SPIFFE identity
 	TrustDomain string
+
+	// NetworkGatewayNamespace is the namespace of the services labeled with model.NetworkLabel that are the
+	// gateways of their network, IstioNamespace if not set.
+	NetworkGatewayNamespace string
 }
 
 // Controller is a collection of synchronized resource watchers
@@ -112,11 +115,12 @@ type Options struct {
 type Controller struct {
 	domainSuffix string
 
-	client    kubernetes.Interface
-	queue     kube.Queue
-	services  cacheHandler
-	endpoints cacheHandler
-	nodes     cacheHandler
+	client     kubernetes.Interface
+	queue      kube.Queue
+	services   cacheHandler
+	endpoints  cacheHandler
+	nodes      cacheHandler
+	namespaces cacheHandler
 
 	pods *PodCache
 
@@ -143,6 +147,13 @@ type Controller struct {
 
 	// Network name for the registry as specified by the MeshNetworks configmap
 	networkForRegistry string
+
+	// networkGateways stores service key ==> gateways of the network of the services labeled with their network
+	networkGateways map[string]*serviceNetworkGateways
+	// networkGatewayNamespace is the namespace of the network gateway services
+	networkGatewayNamespace string
+	// networkHandlers are called when the network gateways change
+	networkHandlers []func()
 }
 
 type cacheHandler struct {
@@ -165,12 +176,18 @@ func NewController(client kubernetes.Interface, options Options) *Controller {
 		XDSUpdater:                 options.XDSUpdater,
 		servicesMap:                make(map[host.Name]*model.Service),
 		externalNameSvcInstanceMap: make(map[host.Name][]*model.ServiceInstance),
+		networkGateways:            make(map[string]*serviceNetworkGateways),
+		networkGatewayNamespace:    options.NetworkGatewayNamespace,
+	}
+	if out.networkGatewayNamespace == "" {
+		out.networkGatewayNamespace = IstioNamespace
 	}
 
 	sharedInformers := informers.NewSharedInformerFactoryWithOptions(client, options.ResyncPeriod, informers.WithNamespace(options.WatchedNamespace))
 
 	svcInformer := sharedInformers.Core().V1().Services().Informer()
 	out.services = out.createCacheHandler(svcInformer, "Services")
+	out.services.handler.Append(out.updateNetworkGateways)
 
 	epInformer := sharedInformers.Core().V1().Endpoints().Informer()
 	out.endpoints = out.createEDSCacheHandler(epInformer, "Endpoints")
@@ -181,6 +198,10 @@ func NewController(client kubernetes.Interface, options Options) *Controller {
 	podInformer := sharedInformers.Core().V1().Pods().Informer()
 	out.pods = newPodCache(out.createCacheHandler(podInformer, "Pod"), out)
 
+	nsInformer := sharedInformers.Core().V1().Namespaces().Informer()
+	out.namespaces = out.createCacheHandler(nsInformer, "Namespaces")
+	out.namespaces.handler.Append(out.namespaceUpdated)
+
 	return out
 }
 
@@ -207,19 +228,19 @@ func (c *Controller) createCacheHandler(informer cache.SharedIndexInformer, otyp
 			// TODO: filtering functions to skip over un-referenced resources (perf)
 			AddFunc: func(obj interface{}) {
 				incrementEvent(otype, "add")
-				c.queue.Push(kube.Task{Handler: handler.Apply, Obj: obj, Event: model.EventAdd})
+				c.queue.Push(kube.NewTask(handler.Apply, obj, model.EventAdd))
 			},
 			UpdateFunc: func(old, cur interface{}) {
 				if !reflect.DeepEqual(old, cur) {
 					incrementEvent(otype, "update")
-					c.queue.Push(kube.Task{Handler: handler.Apply, Obj: cur, Event: model.EventUpdate})
+					c.queue.Push(kube.NewUpdateTask(handler.Apply, old, cur))
 				} else {
 					incrementEvent(otype, "updatesame")
 				}
 			},
 			DeleteFunc: func(obj interface{}) {
 				incrementEvent(otype, "delete")
-				c.queue.Push(kube.Task{Handler: handler.Apply, Obj: obj, Event: model.EventDelete})
+				c.queue.Push(kube.NewTask(handler.Apply, obj, model.EventDelete))
 			},
 		})
 
@@ -234,7 +255,7 @@ func (c *Controller) createEDSCacheHandler(informer cache.SharedIndexInformer, o
 			// TODO: filtering functions to skip over un-referenced resources (perf)
 			AddFunc: func(obj interface{}) {
 				incrementEvent(otype, "add")
-				c.queue.Push(kube.Task{Handler: handler.Apply, Obj: obj, Event: model.EventAdd})
+				c.queue.Push(kube.NewTask(handler.Apply, obj, model.EventAdd))
 			},
 			UpdateFunc: func(old, cur interface{}) {
 				// Avoid pushes if only resource version changed (kube-scheduller, cluster-autoscaller, etc)
@@ -243,7 +264,7 @@ func (c *Controller) createEDSCacheHandler(informer cache.SharedIndexInformer, o
 
 				if !reflect.DeepEqual(oldE.Subsets, curE.Subsets) {
 					incrementEvent(otype, "update")
-					c.queue.Push(kube.Task{Handler: handler.Apply, Obj: cur, Event: model.EventUpdate})
+					c.queue.Push(kube.NewUpdateTask(handler.Apply, old, cur))
 				} else {
 					incrementEvent(otype, "updatesame")
 				}
@@ -254,7 +275,7 @@ func (c *Controller) createEDSCacheHandler(informer cache.SharedIndexInformer, o
 				// deleting the service should delete the resources. The full sync replaces the
 				// maps.
 				// c.updateEDS(obj.(*v1.Endpoints))
-				c.queue.Push(kube.Task{Handler: handler.Apply, Obj: obj, Event: model.EventDelete})
+				c.queue.Push(kube.NewTask(handler.Apply, obj, model.EventDelete))
 			},
 		})
 
@@ -266,12 +287,19 @@ func (c *Controller) HasSynced() bool {
 	if !c.services.informer.HasSynced() ||
 		!c.endpoints.informer.HasSynced() ||
 		!c.pods.informer.HasSynced() ||
-		!c.nodes.informer.HasSynced() {
+		!c.nodes.informer.HasSynced() ||
+		!c.namespaces.informer.HasSynced() {
 		return false
 	}
 	return true
 }
 
+// AddQueueHooks adds hooks called around the processing of the events of the services, endpoints, pods, nodes
+// and namespaces, e.g. to trace them or record metrics.
+func (c *Controller) AddQueueHooks(hooks kube.Hooks) {
+	c.queue.AddHooks(hooks)
+}
+
 // Run all controllers until a signal is received
 func (c *Controller) Run(stop <-chan struct{}) {
 	go func() {
@@ -282,10 +310,11 @@ func (c *Controller) Run(stop <-chan struct{}) {
 	go c.services.informer.Run(stop)
 	go c.pods.informer.Run(stop)
 	go c.nodes.informer.Run(stop)
+	go c.namespaces.informer.Run(stop)
 
 	// To avoid endpoints without labels or ports, wait for sync.
 	cache.WaitForCacheSync(stop, c.nodes.informer.HasSynced, c.pods.informer.HasSynced,
-		c.services.informer.HasSynced)
+		c.services.informer.HasSynced, c.namespaces.informer.HasSynced)
 
 	go c.endpoints.informer.Run(stop)
 
@@ -462,6 +491,10 @@ func (c *Controller) InstancesByPort(svc *model.Service, reqSvcPort int,
 			pod := c.pods.getPodByIP(ea.IP)
 			if pod != nil {
 				podLabels = configKube.ConvertLabels(pod.ObjectMeta)
+			} else {
+				// For service without selector, the endpoints are managed externally and
+				// carry their own labels
+				podLabels = ep.Labels
 			}
 			// check that one of the input labels is a subset of the labels
 			if !labelsList.HasSubsetOf(podLabels) {
@@ -477,6 +510,9 @@ func (c *Controller) InstancesByPort(svc *model.Service, reqSvcPort int,
 				}
 			}
 			mtlsReady := kube.PodMTLSReady(pod)
+			if pod == nil {
+				mtlsReady = c.endpointsMTLSReady(ep)
+			}
 
 			// identify the port by name. K8S EndpointPort uses the service port name
 			for _, port := range ss.Ports {
@@ -495,6 +531,7 @@ func (c *Controller) InstancesByPort(svc *model.Service, reqSvcPort int,
 						Labels:         podLabels,
 						ServiceAccount: sa,
 						MTLSReady:      mtlsReady,
+						TLSMode:        kube.PodTLSMode(pod),
 					})
 				}
 			}
@@ -513,6 +550,10 @@ func (c *Controller) GetProxyServiceInstances(proxy *model.Proxy) ([]*model.Serv
 		// because multiple ips belong to the same pod
 		proxyIP := proxy.IPAddresses[0]
 		pod := c.pods.getPodByIP(proxyIP)
+		if pod == nil {
+			// A terminating proxy keeps its inbound listeners while it drains.
+			pod = c.pods.getTerminatingPodByIP(proxyIP)
+		}
 		if pod != nil {
 			// for split horizon EDS k8s multi cluster, in case there are pods of the same ip across clusters,
 			// which can happen when multi clusters using same pod cidr.
@@ -656,7 +697,7 @@ func findPortFromMetadata(svcPort v1.ServicePort, podPorts []model.PodPort) (int
 	case intstr.String:
 		name := target.StrVal
 		for _, port := range podPorts {
-			if port.Name == name {
+			if port.Name == name && sameProtocol(v1.Protocol(port.Protocol), svcPort.Protocol) {
 				return port.ContainerPort, nil
 			}
 		}
@@ -772,6 +813,7 @@ func (c *Controller) getEndpoints(podIP, address string, endpointPort int32, svc
 		Labels:         podLabels,
 		ServiceAccount: sa,
 		MTLSReady:      kube.PodMTLSReady(pod),
+		TLSMode:        kube.PodTLSMode(pod),
 	}
 }
 
@@ -842,6 +884,9 @@ func (c *Controller) AppendServiceHandler(f func(*model.Service, model.Event)) e
 		}
 
 		svcConv := kube.ConvertService(*svc, c.domainSuffix, c.ClusterID)
+		if c.namespaceMeshExternal(svc.Namespace) {
+			kube.MarkMeshExternal(svcConv)
+		}
 		instances := kube.ExternalNameServiceInstances(*svc, svcConv)
 		switch event {
 		case model.EventDelete:
@@ -869,6 +914,35 @@ func (c *Controller) AppendServiceHandler(f func(*model.Service, model.Event)) e
 	return nil
 }
 
+// namespaceUpdated re-processes the services of an updated namespace, so that namespace level
+// annotations are applied to them.
+func (c *Controller) namespaceUpdated(obj interface{}, event model.Event) error {
+	if event != model.EventUpdate {
+		return nil
+	}
+	ns, ok := obj.(*v1.Namespace)
+	if !ok {
+		return nil
+	}
+	svcs, err := c.services.informer.GetIndexer().ByIndex(cache.NamespaceIndex, ns.Name)
+	if err != nil {
+		return err
+	}
+	for _, svc := range svcs {
+		c.queue.Push(kube.NewTask(c.services.handler.Apply, svc, model.EventUpdate))
+	}
+	return nil
+}
+
+// namespaceMeshExternal returns true if all services of the namespace are opted out of mesh routing.
+func (c *Controller) namespaceMeshExternal(namespace string) bool {
+	obj, exists, err := c.namespaces.informer.GetStore().GetByKey(namespace)
+	if err != nil || !exists {
+		return false
+	}
+	return obj.(*v1.Namespace).Annotations[kube.MeshExternalAnnotation] == "true"
+}
+
 // AppendInstanceHandler implements a service catalog operation
 func (c *Controller) AppendInstanceHandler(f func(*model.ServiceInstance, model.Event)) error {
 	if c.endpoints.handler == nil {
@@ -905,6 +979,11 @@ func (c *Controller) updateEDS(ep *v1.Endpoints, event model.Event) {
 	if event != model.EventDelete {
 		for _, ss := range ep.Subsets {
 			for _, ea := range ss.Addresses {
+				if c.pods.isTerminating(ea) {
+					// The pod is being deleted, stop sending it requests while its proxy drains.
+					log.Debugf("Skipping terminating endpoint %s %s.%s", ea.IP, ep.Name, ep.Namespace)
+					continue
+				}
 				pod := c.pods.getPodByIP(ea.IP)
 				if pod == nil {
 					// This can not happen in usual case
@@ -921,6 +1000,7 @@ func (c *Controller) updateEDS(ep *v1.Endpoints, event model.Event) {
 
 				var labels map[string]string
 				locality, sa, uid := "", "", ""
+				mtlsReady := false
 				if pod != nil {
 					locality = c.GetPodLocality(pod)
 					sa = kube.SecureNamingSAN(pod)
@@ -928,10 +1008,12 @@ func (c *Controller) updateEDS(ep *v1.Endpoints, event model.Event) {
 						uid = fmt.Sprintf("kubernetes://%s.%s", pod.Name, pod.Namespace)
 					}
 					labels = map[string]string(configKube.ConvertLabels(pod.ObjectMeta))
+					mtlsReady = kube.PodMTLSReady(pod)
+				} else {
+					labels = ep.Labels
+					mtlsReady = c.endpointsMTLSReady(ep)
 				}
 
-				mtlsReady := kube.PodMTLSReady(pod)
-
 				// EDS and ServiceEntry use name for service port - ADS will need to
 				// map to numbers.
 				for _, port := range ss.Ports {
@@ -946,6 +1028,7 @@ func (c *Controller) updateEDS(ep *v1.Endpoints, event model.Event) {
 						Locality:        locality,
 						Attributes:      model.ServiceAttributes{Name: ep.Name, Namespace: ep.Namespace},
 						MTLSReady:       mtlsReady,
+						TLSMode:         kube.PodTLSMode(pod),
 					})
 				}
 			}
@@ -981,6 +1064,16 @@ func (c *Controller) updateEDS(ep *v1.Endpoints, event model.Event) {
 	_ = c.XDSUpdater.EDSUpdate(c.ClusterID, string(hostname), ep.Namespace, endpoints)
 }
 
+// endpointsMTLSReady returns whether the addresses of the given endpoints that are not backed by
+// pods, as is the case for services without selector, can be configured with Istio mTLS.
+func (c *Controller) endpointsMTLSReady(ep *v1.Endpoints) bool {
+	obj, exists, err := c.services.informer.GetIndexer().GetByKey(kube.KeyFunc(ep.Name, ep.Namespace))
+	if err != nil || !exists {
+		return false
+	}
+	return kube.EndpointsMTLSReady(obj.(*v1.Service))
+}
+
 // namedRangerEntry for holding network's CIDR and name
 type namedRangerEntry struct {
 	name    string
@@ -1024,6 +1117,11 @@ func (c *Controller) InitNetworkLookup(meshNetworks *meshconfig.MeshNetworks) {
 
 // return the mesh network for the endpoint IP. Empty string if not found.
 func (c *Controller) endpointNetwork(endpointIP string) string {
+	// The network label of the pod of the endpoint takes precedence over the mesh networks configuration
+	if network := c.podNetwork(endpointIP); network != "" {
+		return network
+	}
+
 	// If networkForRegistry is set then all endpoints discovered by this registry
 	// belong to the configured network so simply return it
 	if len(c.networkForRegistry) != 0 {
@@ -1062,7 +1160,7 @@ func FindPort(pod *v1.Pod, svcPort *v1.ServicePort) (int, error) {
 		name := portName.StrVal
 		for _, container := range pod.Spec.Containers {
 			for _, port := range container.Ports {
-				if port.Name == name && port.Protocol == svcPort.Protocol {
+				if port.Name == name && sameProtocol(port.Protocol, svcPort.Protocol) {
 					return int(port.ContainerPort), nil
 				}
 			}
@@ -1073,3 +1171,15 @@ func FindPort(pod *v1.Pod, svcPort *v1.ServicePort) (int, error) {
 
 	return 0, fmt.Errorf("no suitable port for manifest: %s", pod.UID)
 }
+
+// sameProtocol compares the protocols of ports, which default to TCP when they are not defaulted by Kubernetes,
+// e.g. in the proxy metadata.
+func sameProtocol(a, b v1.Protocol) bool {
+	if a == "" {
+		a = v1.ProtocolTCP
+	}
+	if b == "" {
+		b = v1.ProtocolTCP
+	}
+	return a == b
+}
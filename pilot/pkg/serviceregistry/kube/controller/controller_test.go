@@ -32,7 +32,6 @@ import (
 
 	"istio.io/api/annotation"
 	meshconfig "istio.io/api/mesh/v1alpha1"
-	"istio.io/pkg/log"
 
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/serviceregistry"
@@ -1152,6 +1151,90 @@ func TestController_ExternalNameService(t *testing.T) {
 	}
 }
 
+func TestController_ServiceWithoutSelector(t *testing.T) {
+	controller, fx := newFakeController(t)
+	defer controller.Stop()
+
+	createService(controller, "svc1", "nsA",
+		map[string]string{kube.EndpointsMTLSReadyAnnotation: "true"},
+		[]int32{8080}, nil, t)
+	if ev := fx.Wait("service"); ev == nil {
+		t.Fatal("Timeout creating service")
+	}
+
+	// Endpoints of a service without selector are managed externally and not backed by pods.
+	endpoint := &coreV1.Endpoints{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      "svc1",
+			Namespace: "nsA",
+			Labels:    map[string]string{"app": "external"},
+		},
+		Subsets: []coreV1.EndpointSubset{{
+			Addresses: []coreV1.EndpointAddress{{IP: "10.10.1.1"}, {IP: "10.10.1.2"}},
+			Ports:     []coreV1.EndpointPort{{Name: "tcp-port", Port: 9090}},
+		}},
+	}
+	if _, err := controller.client.CoreV1().Endpoints("nsA").Create(endpoint); err != nil {
+		t.Fatalf("failed to create endpoints (error %v)", err)
+	}
+	if ev := fx.Wait("eds"); ev == nil {
+		t.Fatal("Timeout incremental eds")
+	}
+
+	svc, _ := controller.GetService(kube.ServiceHostname("svc1", "nsA", domainSuffix))
+	if svc == nil {
+		t.Fatal("service without selector not found")
+	}
+	instances, err := controller.InstancesByPort(svc, 8080, labels.Collection{{"app": "external"}})
+	if err != nil {
+		t.Fatalf("error getting instances by port: %s", err)
+	}
+	if len(instances) != 2 {
+		t.Fatalf("expected 2 instances, got %d", len(instances))
+	}
+	for _, inst := range instances {
+		if inst.Endpoint.Port != 9090 {
+			t.Errorf("wrong endpoint port for %s: got %d, want 9090", inst.Endpoint.Address, inst.Endpoint.Port)
+		}
+		if !inst.MTLSReady {
+			t.Errorf("endpoint %s should be mTLS ready", inst.Endpoint.Address)
+		}
+		if inst.Labels["app"] != "external" {
+			t.Errorf("endpoint %s should carry the Endpoints labels, got %v", inst.Endpoint.Address, inst.Labels)
+		}
+	}
+}
+
+func TestController_MeshExternalNamespace(t *testing.T) {
+	controller, fx := newFakeController(t)
+	defer controller.Stop()
+
+	ns := &coreV1.Namespace{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:        "infra",
+			Annotations: map[string]string{kube.MeshExternalAnnotation: "true"},
+		},
+	}
+	if _, err := controller.client.CoreV1().Namespaces().Create(ns); err != nil {
+		t.Fatalf("failed to create namespace (error %v)", err)
+	}
+
+	createService(controller, "metrics", "infra", nil,
+		[]int32{9090}, map[string]string{"app": "metrics"}, t)
+	if ev := fx.Wait("service"); ev == nil {
+		t.Fatal("Timeout creating service")
+	}
+
+	svc, _ := controller.GetService(kube.ServiceHostname("metrics", "infra", domainSuffix))
+	if svc == nil {
+		t.Fatal("service not found")
+	}
+	if !svc.MeshExternal || svc.Resolution != model.Passthrough {
+		t.Errorf("service in annotated namespace should be mesh external, got MeshExternal=%v Resolution=%v",
+			svc.MeshExternal, svc.Resolution)
+	}
+}
+
 func createEndpoints(controller *Controller, name, namespace string, portNames, ips []string, t *testing.T) {
 	eas := make([]coreV1.EndpointAddress, 0)
 	for _, ip := range ips {
@@ -1460,3 +1543,65 @@ func TestEndpointUpdate(t *testing.T) {
 		t.Errorf("Timeout xds push")
 	}
 }
+
+func TestFindTargetPort(t *testing.T) {
+	pod := &coreV1.Pod{
+		Spec: coreV1.PodSpec{
+			Containers: []coreV1.Container{{
+				Ports: []coreV1.ContainerPort{
+					{Name: "dns", ContainerPort: 5353, Protocol: coreV1.ProtocolUDP},
+					{Name: "http", ContainerPort: 9080},
+				},
+			}},
+		},
+	}
+	podPorts := []model.PodPort{
+		{Name: "dns", ContainerPort: 5353, Protocol: "UDP"},
+		{Name: "http", ContainerPort: 9080},
+	}
+
+	cases := []struct {
+		name    string
+		port    coreV1.ServicePort
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "number",
+			port: coreV1.ServicePort{Port: 80, TargetPort: intstr.FromInt(8080), Protocol: coreV1.ProtocolTCP},
+			want: 8080,
+		},
+		{
+			name: "name with defaulted protocol",
+			port: coreV1.ServicePort{Port: 80, TargetPort: intstr.FromString("http"), Protocol: coreV1.ProtocolTCP},
+			want: 9080,
+		},
+		{
+			name: "name and protocol",
+			port: coreV1.ServicePort{Port: 53, TargetPort: intstr.FromString("dns"), Protocol: coreV1.ProtocolUDP},
+			want: 5353,
+		},
+		{
+			name:    "name of another protocol",
+			port:    coreV1.ServicePort{Port: 53, TargetPort: intstr.FromString("dns"), Protocol: coreV1.ProtocolTCP},
+			wantErr: true,
+		},
+		{
+			name:    "unknown name",
+			port:    coreV1.ServicePort{Port: 80, TargetPort: intstr.FromString("grpc"), Protocol: coreV1.ProtocolTCP},
+			wantErr: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := FindPort(pod, &tc.port)
+			if (err != nil) != tc.wantErr || got != tc.want {
+				t.Errorf("FindPort() got %v, %v, want %v", got, err, tc.want)
+			}
+			got, err = findPortFromMetadata(tc.port, podPorts)
+			if (err != nil) != tc.wantErr || got != tc.want {
+				t.Errorf("findPortFromMetadata() got %v, %v, want %v", got, err, tc.want)
+			}
+		})
+	}
+}
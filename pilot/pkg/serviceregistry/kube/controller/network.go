@@ -0,0 +1,167 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry/kube"
+)
+
+// serviceNetworkGateways are the gateways of the network of a service labeled with model.NetworkLabel.
+type serviceNetworkGateways struct {
+	network  string
+	gateways []*meshconfig.Network_IstioNetworkGateway
+}
+
+// networkGatewaysForService returns the gateways of the network of the service, one per load balancer ingress
+// address of the service, or nil if the service is not labeled with its network. Only the services of the gateway
+// namespace are gateways, as the label would otherwise let any namespace redirect the traffic of a network. The
+// external IPs of the service are ignored, as they can be set by any user allowed to create services.
+func networkGatewaysForService(svc *v1.Service, gatewayNamespace string) *serviceNetworkGateways {
+	network := svc.Labels[model.NetworkLabel]
+	if network == "" {
+		return nil
+	}
+	if svc.Namespace != gatewayNamespace {
+		log.Warnf("ignoring the %s label of the service %s/%s, the network gateways must be in namespace %s",
+			model.NetworkLabel, svc.Namespace, svc.Name, gatewayNamespace)
+		return nil
+	}
+	port := uint32(model.DefaultNetworkGatewayPort)
+	if value, f := svc.Annotations[model.NetworkGatewayPortAnnotation]; f {
+		p, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || p == 0 || p > 65535 {
+			log.Warnf("invalid %s annotation %q of the gateway service %s/%s, using port %d",
+				model.NetworkGatewayPortAnnotation, value, svc.Namespace, svc.Name, port)
+		} else {
+			port = uint32(p)
+		}
+	}
+
+	// The hostnames of the load balancers are resolved with the other gateway addresses of the mesh networks.
+	var addresses []string
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			addresses = append(addresses, ingress.IP)
+		} else if ingress.Hostname != "" {
+			addresses = append(addresses, ingress.Hostname)
+		}
+	}
+	if len(addresses) == 0 {
+		log.Debugf("the gateway service %s/%s of network %s has no external address yet", svc.Namespace, svc.Name, network)
+		return nil
+	}
+
+	out := &serviceNetworkGateways{network: network}
+	for _, address := range addresses {
+		out.gateways = append(out.gateways, &meshconfig.Network_IstioNetworkGateway{
+			Gw:   &meshconfig.Network_IstioNetworkGateway_Address{Address: address},
+			Port: port,
+		})
+	}
+	return out
+}
+
+// updateNetworkGateways updates the discovered gateways of the networks on the service events, and calls the
+// network handlers if they changed.
+func (c *Controller) updateNetworkGateways(obj interface{}, event model.Event) error {
+	svc, ok := obj.(*v1.Service)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			return nil
+		}
+		if svc, ok = tombstone.Obj.(*v1.Service); !ok {
+			return nil
+		}
+	}
+
+	var gateways *serviceNetworkGateways
+	if event != model.EventDelete {
+		gateways = networkGatewaysForService(svc, c.networkGatewayNamespace)
+	}
+	key := kube.KeyFunc(svc.Name, svc.Namespace)
+
+	c.Lock()
+	old := c.networkGateways[key]
+	if gateways == nil {
+		delete(c.networkGateways, key)
+	} else {
+		c.networkGateways[key] = gateways
+	}
+	c.Unlock()
+
+	if reflect.DeepEqual(old, gateways) {
+		return nil
+	}
+	log.Infof("gateways of network %s updated by service %s", networkOf(old, gateways), key)
+	for _, f := range c.networkHandlers {
+		f()
+	}
+	return nil
+}
+
+func networkOf(old, cur *serviceNetworkGateways) string {
+	if cur != nil {
+		return cur.network
+	}
+	return old.network
+}
+
+// NetworkGateways returns the gateways of the networks discovered from the services labeled with
+// model.NetworkLabel.
+func (c *Controller) NetworkGateways() model.NetworkGateways {
+	c.RLock()
+	defer c.RUnlock()
+	keys := make([]string, 0, len(c.networkGateways))
+	for key := range c.networkGateways {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := make(model.NetworkGateways)
+	for _, key := range keys {
+		gateways := c.networkGateways[key]
+		out[gateways.network] = append(out[gateways.network], gateways.gateways...)
+	}
+	return out
+}
+
+// AppendNetworkHandler adds a handler called when the discovered gateways of the networks change. It must be
+// called before the controller is run.
+func (c *Controller) AppendNetworkHandler(f func()) {
+	c.networkHandlers = append(c.networkHandlers, f)
+}
+
+// podNetwork returns the network of the pod of the endpoint IP from its model.NetworkLabel, or an empty string.
+func (c *Controller) podNetwork(endpointIP string) string {
+	if c.pods == nil {
+		return ""
+	}
+	pod := c.pods.getPodByIP(endpointIP)
+	if pod == nil {
+		return ""
+	}
+	return pod.Labels[model.NetworkLabel]
+}
@@ -0,0 +1,258 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry/kube"
+)
+
+func gatewayService(name, network string, annotations map[string]string, ips ...string) *coreV1.Service {
+	svc := &coreV1.Service{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:        name,
+			Namespace:   "istio-system",
+			Labels:      map[string]string{},
+			Annotations: annotations,
+		},
+	}
+	if network != "" {
+		svc.Labels[model.NetworkLabel] = network
+	}
+	for _, ip := range ips {
+		svc.Status.LoadBalancer.Ingress = append(svc.Status.LoadBalancer.Ingress, coreV1.LoadBalancerIngress{IP: ip})
+	}
+	return svc
+}
+
+func addressGateway(address string, port uint32) *meshconfig.Network_IstioNetworkGateway {
+	return &meshconfig.Network_IstioNetworkGateway{
+		Gw:   &meshconfig.Network_IstioNetworkGateway_Address{Address: address},
+		Port: port,
+	}
+}
+
+func TestNetworkGatewaysForService(t *testing.T) {
+	hostnameSvc := gatewayService("hostname", "network1", nil)
+	hostnameSvc.Status.LoadBalancer.Ingress = []coreV1.LoadBalancerIngress{{Hostname: "gateway.example.com"}}
+	externalIPSvc := gatewayService("external", "network1", nil)
+	externalIPSvc.Spec.ExternalIPs = []string{"3.3.3.3"}
+	otherNamespaceSvc := gatewayService("gateway", "network1", nil, "1.1.1.1")
+	otherNamespaceSvc.Namespace = "default"
+
+	cases := []struct {
+		name string
+		svc  *coreV1.Service
+		want *serviceNetworkGateways
+	}{
+		{
+			name: "not a gateway",
+			svc:  gatewayService("gateway", "", nil, "1.1.1.1"),
+		},
+		{
+			name: "no external address",
+			svc:  gatewayService("gateway", "network1", nil),
+		},
+		{
+			name: "default port",
+			svc:  gatewayService("gateway", "network1", nil, "1.1.1.1", "2.2.2.2"),
+			want: &serviceNetworkGateways{
+				network: "network1",
+				gateways: []*meshconfig.Network_IstioNetworkGateway{
+					addressGateway("1.1.1.1", model.DefaultNetworkGatewayPort),
+					addressGateway("2.2.2.2", model.DefaultNetworkGatewayPort),
+				},
+			},
+		},
+		{
+			name: "port annotation",
+			svc:  gatewayService("gateway", "network1", map[string]string{model.NetworkGatewayPortAnnotation: "443"}, "1.1.1.1"),
+			want: &serviceNetworkGateways{
+				network:  "network1",
+				gateways: []*meshconfig.Network_IstioNetworkGateway{addressGateway("1.1.1.1", 443)},
+			},
+		},
+		{
+			name: "invalid port annotation",
+			svc:  gatewayService("gateway", "network1", map[string]string{model.NetworkGatewayPortAnnotation: "x"}, "1.1.1.1"),
+			want: &serviceNetworkGateways{
+				network:  "network1",
+				gateways: []*meshconfig.Network_IstioNetworkGateway{addressGateway("1.1.1.1", model.DefaultNetworkGatewayPort)},
+			},
+		},
+		{
+			name: "load balancer hostname",
+			svc:  hostnameSvc,
+			want: &serviceNetworkGateways{
+				network: "network1",
+				gateways: []*meshconfig.Network_IstioNetworkGateway{
+					addressGateway("gateway.example.com", model.DefaultNetworkGatewayPort),
+				},
+			},
+		},
+		{
+			name: "external IP",
+			svc:  externalIPSvc,
+		},
+		{
+			name: "not in the gateway namespace",
+			svc:  otherNamespaceSvc,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := networkGatewaysForService(tc.svc, "istio-system"); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("networkGatewaysForService() got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUpdateNetworkGateways(t *testing.T) {
+	c := NewController(fake.NewSimpleClientset(), Options{DomainSuffix: domainSuffix})
+	updates := 0
+	c.AppendNetworkHandler(func() { updates++ })
+
+	apply := func(svc *coreV1.Service, event model.Event, wantUpdates int, want model.NetworkGateways) {
+		t.Helper()
+		if err := c.updateNetworkGateways(svc, event); err != nil {
+			t.Fatal(err)
+		}
+		if updates != wantUpdates {
+			t.Errorf("got %d network updates, want %d", updates, wantUpdates)
+		}
+		if got := c.NetworkGateways(); !reflect.DeepEqual(got, want) {
+			t.Errorf("NetworkGateways() got %v, want %v", got, want)
+		}
+	}
+
+	apply(gatewayService("gateway-a", "network1", nil, "1.1.1.1"), model.EventAdd, 1, model.NetworkGateways{
+		"network1": {addressGateway("1.1.1.1", model.DefaultNetworkGatewayPort)},
+	})
+	apply(gatewayService("gateway-b", "network1", nil, "2.2.2.2"), model.EventAdd, 2, model.NetworkGateways{
+		"network1": {
+			addressGateway("1.1.1.1", model.DefaultNetworkGatewayPort),
+			addressGateway("2.2.2.2", model.DefaultNetworkGatewayPort),
+		},
+	})
+	// Unchanged gateways and services of no network do not update the networks.
+	apply(gatewayService("gateway-b", "network1", nil, "2.2.2.2"), model.EventUpdate, 2, model.NetworkGateways{
+		"network1": {
+			addressGateway("1.1.1.1", model.DefaultNetworkGatewayPort),
+			addressGateway("2.2.2.2", model.DefaultNetworkGatewayPort),
+		},
+	})
+	apply(gatewayService("other", "", nil, "3.3.3.3"), model.EventAdd, 2, model.NetworkGateways{
+		"network1": {
+			addressGateway("1.1.1.1", model.DefaultNetworkGatewayPort),
+			addressGateway("2.2.2.2", model.DefaultNetworkGatewayPort),
+		},
+	})
+	apply(gatewayService("gateway-b", "network2", nil, "2.2.2.2"), model.EventUpdate, 3, model.NetworkGateways{
+		"network1": {addressGateway("1.1.1.1", model.DefaultNetworkGatewayPort)},
+		"network2": {addressGateway("2.2.2.2", model.DefaultNetworkGatewayPort)},
+	})
+	apply(gatewayService("gateway-a", "network1", nil, "1.1.1.1"), model.EventDelete, 4, model.NetworkGateways{
+		"network2": {addressGateway("2.2.2.2", model.DefaultNetworkGatewayPort)},
+	})
+}
+
+func TestEndpointNetworkFromPodLabel(t *testing.T) {
+	controller, _ := newFakeController(t)
+	defer controller.Stop()
+	controller.InitNetworkLookup(&meshconfig.MeshNetworks{
+		Networks: map[string]*meshconfig.Network{
+			"network1": {
+				Endpoints: []*meshconfig.NetworkEndpoints{
+					{Ne: &meshconfig.NetworkEndpoints_FromCidr{FromCidr: "10.0.0.0/16"}},
+				},
+			},
+		},
+	})
+
+	addPods(t, controller,
+		generatePod("10.0.0.1", "labeled", "nsA", "", "", map[string]string{model.NetworkLabel: "network2"}, nil),
+		generatePod("10.0.0.2", "unlabeled", "nsA", "", "", map[string]string{}, nil))
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		if err := waitForPod(controller, ip); err != nil {
+			t.Fatalf("wait for pod err: %v", err)
+		}
+	}
+
+	if got := controller.endpointNetwork("10.0.0.1"); got != "network2" {
+		t.Errorf("got network %q for the labeled pod, want network2", got)
+	}
+	if got := controller.endpointNetwork("10.0.0.2"); got != "network1" {
+		t.Errorf("got network %q for the unlabeled pod, want network1", got)
+	}
+}
+
+func TestEndpointsUpdatedOnPodNetworkChange(t *testing.T) {
+	c, fx := newFakeController(t)
+	defer c.Stop()
+
+	ns := "nsa"
+	ip := "172.0.3.37"
+	pod := &coreV1.Pod{
+		ObjectMeta: metaV1.ObjectMeta{Name: "pod1", Namespace: ns, Labels: map[string]string{}},
+		Status:     coreV1.PodStatus{PodIP: ip, Phase: coreV1.PodRunning},
+	}
+	ep := &coreV1.Endpoints{
+		ObjectMeta: metaV1.ObjectMeta{Name: "svc1", Namespace: ns},
+		Subsets:    []coreV1.EndpointSubset{{Addresses: []coreV1.EndpointAddress{{IP: ip}}}},
+	}
+	if err := c.endpoints.informer.GetStore().Add(ep); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.pods.event(pod, model.EventAdd); err != nil {
+		t.Fatal(err)
+	}
+	fx.Clear()
+
+	// Unchanged labels do not update the endpoints.
+	if err := c.pods.event(pod, model.EventUpdate); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-fx.Events:
+		t.Errorf("got event %v, want none for unchanged labels", ev)
+	default:
+	}
+	labeled := pod.DeepCopy()
+	labeled.Labels[model.NetworkLabel] = "network2"
+	if err := c.pods.event(labeled, model.EventUpdate); err != nil {
+		t.Fatal(err)
+	}
+	if ev := fx.Wait("eds"); ev == nil || ev.ID != string(kube.ServiceHostname("svc1", ns, domainSuffix)) {
+		t.Errorf("got event %v, want the endpoints of svc1 updated", ev)
+	}
+	fx.Clear()
+
+	if err := c.pods.event(pod, model.EventUpdate); err != nil {
+		t.Fatal(err)
+	}
+	if ev := fx.Wait("eds"); ev == nil || ev.ID != string(kube.ServiceHostname("svc1", ns, domainSuffix)) {
+		t.Errorf("got event %v, want the endpoints of svc1 updated when the label is removed", ev)
+	}
+}
@@ -25,8 +25,6 @@ import (
 	"istio.io/istio/pilot/pkg/serviceregistry/kube"
 	configKube "istio.io/istio/pkg/config/kube"
 	"istio.io/istio/pkg/config/labels"
-
-	"istio.io/pkg/log"
 )
 
 // PodCache is an eventually consistent pod cache
@@ -38,6 +36,13 @@ type PodCache struct {
 	// this allows us to retrieve the latest status by pod IP.
 	// This should only contain RUNNING or PENDING pods with an allocated IP.
 	podsByIP map[string]string
+	// terminating maintains the name key to pod IP mapping of the pods being deleted. They are
+	// removed from the endpoints right away, but their proxies keep serving until they drained.
+	// It is keyed by pod as a new pod may be assigned the IP of a terminating one.
+	terminating map[string]string
+	// networks maintains the name key to model.NetworkLabel mapping of the labeled pods, to update the
+	// endpoints of a pod when its network changes.
+	networks map[string]string
 
 	c *Controller
 }
@@ -47,6 +52,8 @@ func newPodCache(ch cacheHandler, c *Controller) *PodCache {
 		cacheHandler: ch,
 		c:            c,
 		podsByIP:     make(map[string]string),
+		terminating:  make(map[string]string),
+		networks:     make(map[string]string),
 	}
 
 	ch.handler.Append(out.event)
@@ -55,9 +62,6 @@ func newPodCache(ch cacheHandler, c *Controller) *PodCache {
 
 // event updates the IP-based index (pc.podsByIP).
 func (pc *PodCache) event(obj interface{}, ev model.Event) error {
-	pc.Lock()
-	defer pc.Unlock()
-
 	// When a pod is deleted obj could be an *v1.Pod or a DeletionFinalStateUnknown marker item.
 	pod, ok := obj.(*v1.Pod)
 	if !ok {
@@ -71,6 +75,39 @@ func (pc *PodCache) event(obj interface{}, ev model.Event) error {
 		}
 	}
 
+	terminated := pc.update(pod, ev)
+	networkChanged := pc.updateNetwork(pod, ev)
+	if terminated || networkChanged {
+		// Remove the pod from the endpoints without waiting for the Endpoints to be updated, which
+		// may happen after its proxy started draining, and move its endpoints to its new network, as
+		// the Endpoints are not updated when the labels of a pod change.
+		pc.endpointsUpdates(pod)
+	}
+	return nil
+}
+
+// updateNetwork updates the network of the pod, returning true when the model.NetworkLabel of an existing pod
+// changed.
+func (pc *PodCache) updateNetwork(pod *v1.Pod, ev model.Event) bool {
+	pc.Lock()
+	defer pc.Unlock()
+
+	key := kube.KeyFunc(pod.Name, pod.Namespace)
+	old := pc.networks[key]
+	network := pod.Labels[model.NetworkLabel]
+	if network == "" || ev == model.EventDelete {
+		delete(pc.networks, key)
+	} else {
+		pc.networks[key] = network
+	}
+	return ev == model.EventUpdate && network != old
+}
+
+// update updates the IP-based indexes, returning true when the pod just started terminating.
+func (pc *PodCache) update(pod *v1.Pod, ev model.Event) bool {
+	pc.Lock()
+	defer pc.Unlock()
+
 	ip := pod.Status.PodIP
 	// PodIP will be empty when pod is just created, but before the IP is assigned
 	// via UpdateStatus.
@@ -80,6 +117,10 @@ func (pc *PodCache) event(obj interface{}, ev model.Event) error {
 		key := kube.KeyFunc(pod.Name, pod.Namespace)
 		switch ev {
 		case model.EventAdd:
+			if pod.DeletionTimestamp != nil {
+				pc.terminating[key] = ip
+				return false
+			}
 			switch pod.Status.Phase {
 			case v1.PodPending, v1.PodRunning:
 				if _, ok := pc.podsByIP[ip]; !ok {
@@ -94,7 +135,11 @@ func (pc *PodCache) event(obj interface{}, ev model.Event) error {
 				if pc.podsByIP[ip] == key {
 					delete(pc.podsByIP, ip)
 				}
-				return nil
+				if pc.terminating[key] == ip {
+					return false
+				}
+				pc.terminating[key] = ip
+				return true
 			}
 			switch pod.Status.Phase {
 			case v1.PodPending, v1.PodRunning:
@@ -115,9 +160,38 @@ func (pc *PodCache) event(obj interface{}, ev model.Event) error {
 			if pc.podsByIP[ip] == key {
 				delete(pc.podsByIP, ip)
 			}
+			delete(pc.terminating, key)
+		}
+	}
+	return false
+}
+
+// endpointsUpdates recomputes the EDS of the endpoints of the namespace of the pod that include its IP.
+func (pc *PodCache) endpointsUpdates(pod *v1.Pod) {
+	if pc.c == nil || pc.c.XDSUpdater == nil {
+		return
+	}
+	for _, item := range pc.c.endpoints.informer.GetStore().List() {
+		ep := item.(*v1.Endpoints)
+		if ep.Namespace != pod.Namespace {
+			continue
+		}
+		if endpointsContainIP(ep, pod.Status.PodIP) {
+			log.Infof("Updating the endpoints %s for pod %s in namespace %s", ep.Name, pod.Name, pod.Namespace)
+			pc.c.updateEDS(ep, model.EventUpdate)
 		}
 	}
-	return nil
+}
+
+func endpointsContainIP(ep *v1.Endpoints, ip string) bool {
+	for _, ss := range ep.Subsets {
+		for _, ea := range ss.Addresses {
+			if ea.IP == ip {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func (pc *PodCache) proxyUpdates(ip string) {
@@ -134,6 +208,46 @@ func (pc *PodCache) getPodKey(addr string) (string, bool) {
 	return key, exists
 }
 
+// isTerminating returns whether the pod of the endpoint address is being deleted. The pod is identified by the
+// target of the address, or else by its IP if no other pod has it.
+func (pc *PodCache) isTerminating(ea v1.EndpointAddress) bool {
+	pc.RLock()
+	defer pc.RUnlock()
+	if ea.TargetRef != nil && ea.TargetRef.Kind == "Pod" {
+		return pc.terminating[kube.KeyFunc(ea.TargetRef.Name, ea.TargetRef.Namespace)] == ea.IP
+	}
+	if _, f := pc.podsByIP[ea.IP]; f {
+		return false
+	}
+	for _, ip := range pc.terminating {
+		if ip == ea.IP {
+			return true
+		}
+	}
+	return false
+}
+
+// getTerminatingPodByIP returns the pod being deleted or nil if pod not found or an error occurred
+func (pc *PodCache) getTerminatingPodByIP(addr string) *v1.Pod {
+	pc.RLock()
+	var key string
+	for k, ip := range pc.terminating {
+		if ip == addr {
+			key = k
+			break
+		}
+	}
+	pc.RUnlock()
+	if key == "" {
+		return nil
+	}
+	item, exists, err := pc.informer.GetStore().GetByKey(key)
+	if !exists || err != nil {
+		return nil
+	}
+	return item.(*v1.Pod)
+}
+
 // getPodByIp returns the pod or nil if pod not found or an error occurred
 func (pc *PodCache) getPodByIP(addr string) *v1.Pod {
 	key, exists := pc.getPodKey(addr)
@@ -224,3 +224,72 @@ func TestPodCacheEvents(t *testing.T) {
 		t.Errorf("getPodKey => got %s, want none", pod)
 	}
 }
+
+// Checks that terminating pods are removed from the endpoints right away, but can still be looked up
+// for the inbound configuration of their proxies.
+func TestPodCacheTerminating(t *testing.T) {
+	c, fx := newFakeController(t)
+	defer c.Stop()
+
+	ns := "nsa"
+	ip := "172.0.3.36"
+	meta := metav1.ObjectMeta{Name: "pod1", Namespace: ns}
+	running := &v1.Pod{ObjectMeta: meta, Status: v1.PodStatus{PodIP: ip, Phase: v1.PodRunning}}
+	ep := &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "svc1", Namespace: ns},
+		Subsets:    []v1.EndpointSubset{{Addresses: []v1.EndpointAddress{{IP: ip}}}},
+	}
+	if err := c.endpoints.informer.GetStore().Add(ep); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.pods.event(running, model.EventAdd); err != nil {
+		t.Fatal(err)
+	}
+	fx.Clear()
+
+	terminating := running.DeepCopy()
+	terminating.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	if err := c.pods.informer.GetStore().Add(terminating); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.pods.event(terminating, model.EventUpdate); err != nil {
+		t.Fatal(err)
+	}
+	if ev := fx.Wait("eds"); ev == nil || ev.ID != string(kube.ServiceHostname("svc1", ns, domainSuffix)) {
+		t.Errorf("got event %v, want the endpoints of svc1 updated", ev)
+	}
+	if pod, exists := c.pods.getPodKey(ip); exists {
+		t.Errorf("getPodKey => got %s, want none", pod)
+	}
+	if !c.pods.isTerminating(v1.EndpointAddress{IP: ip}) {
+		t.Errorf("pod %s not terminating", ip)
+	}
+	if pod := c.pods.getTerminatingPodByIP(ip); pod == nil || pod.Name != "pod1" {
+		t.Errorf("getTerminatingPodByIP => got %v, want pod1", pod)
+	}
+
+	// A new pod reusing the IP of the terminating pod is not terminating.
+	reused := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod2", Namespace: ns},
+		Status:     v1.PodStatus{PodIP: ip, Phase: v1.PodRunning},
+	}
+	if err := c.pods.event(reused, model.EventAdd); err != nil {
+		t.Fatal(err)
+	}
+	target := func(name string) v1.EndpointAddress {
+		return v1.EndpointAddress{IP: ip, TargetRef: &v1.ObjectReference{Kind: "Pod", Name: name, Namespace: ns}}
+	}
+	if c.pods.isTerminating(target("pod2")) || c.pods.isTerminating(v1.EndpointAddress{IP: ip}) {
+		t.Errorf("pod2 reusing %s terminating", ip)
+	}
+	if !c.pods.isTerminating(target("pod1")) {
+		t.Errorf("pod1 not terminating")
+	}
+
+	if err := c.pods.event(terminating, model.EventDelete); err != nil {
+		t.Fatal(err)
+	}
+	if c.pods.isTerminating(target("pod1")) {
+		t.Errorf("deleted pod %s still terminating", ip)
+	}
+}
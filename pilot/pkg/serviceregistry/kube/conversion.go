@@ -43,6 +43,26 @@ const (
 	// responsible for it
 	IngressClassAnnotation = "kubernetes.io/ingress.class"
 
+	// EndpointsMTLSReadyAnnotation can be set on a Service without a selector to declare that its
+	// manually managed endpoints accept Istio mTLS. Such endpoints are not backed by pods, so this
+	// cannot be inferred from the sidecar injection label.
+	EndpointsMTLSReadyAnnotation = "networking.istio.io/endpointsMTLSReady"
+
+	// ExternalNameHostRewriteAnnotation can be set on an ExternalName Service to rewrite the Host
+	// header of requests sent to it to the external name.
+	ExternalNameHostRewriteAnnotation = "networking.istio.io/externalNameHostRewrite"
+
+	// MeshExternalAnnotation can be set on a Service, or on its namespace, to have the service treated
+	// as external to the mesh. Traffic to it is never upgraded to mTLS and is forwarded to the original
+	// destination rather than load balanced over the endpoints. This is meant for infrastructure
+	// services such as the kube-apiserver.
+	MeshExternalAnnotation = "networking.istio.io/meshExternal"
+
+	// ActivatorAnnotation can be set on a Service which can be scaled to zero, by an external activator, to the
+	// <hostname>:<port> of the activator. While the service has no endpoints, its requests are sent to the
+	// activator.
+	ActivatorAnnotation = "networking.istio.io/activator"
+
 	managementPortPrefix = "mgmt-"
 )
 
@@ -115,6 +135,19 @@ func ConvertService(svc coreV1.Service, domainSuffix string, clusterID string) *
 		},
 	}
 
+	if svc.Annotations[MeshExternalAnnotation] == "true" {
+		MarkMeshExternal(istioService)
+	}
+
+	if activator := svc.Annotations[ActivatorAnnotation]; activator != "" {
+		istioService.Attributes.Activator = activator
+	}
+
+	if external != "" {
+		istioService.Attributes.ExternalName = external
+		istioService.Attributes.RewriteHostToExternalName = svc.Annotations[ExternalNameHostRewriteAnnotation] == "true"
+	}
+
 	if svc.Spec.Type == coreV1.ServiceTypeLoadBalancer && len(svc.Status.LoadBalancer.Ingress) > 0 {
 		var lbAddrs []string
 		for _, ingress := range svc.Status.LoadBalancer.Ingress {
@@ -135,6 +168,15 @@ func ConvertService(svc coreV1.Service, domainSuffix string, clusterID string) *
 	return istioService
 }
 
+// MarkMeshExternal opts a service out of mesh routing. Services load balanced by the proxy are
+// switched to passthrough, so that no EDS is used for them.
+func MarkMeshExternal(svc *model.Service) {
+	svc.MeshExternal = true
+	if svc.Resolution == model.ClientSideLB {
+		svc.Resolution = model.Passthrough
+	}
+}
+
 func ExternalNameServiceInstances(k8sSvc coreV1.Service, svc *model.Service) []*model.ServiceInstance {
 	if k8sSvc.Spec.Type != coreV1.ServiceTypeExternalName || k8sSvc.Spec.ExternalName == "" {
 		return nil
@@ -144,7 +186,7 @@ func ExternalNameServiceInstances(k8sSvc coreV1.Service, svc *model.Service) []*
 		out = append(out, &model.ServiceInstance{
 			Endpoint: model.NetworkEndpoint{
 				Address:     k8sSvc.Spec.ExternalName,
-				Port:        portEntry.Port,
+				Port:        externalNameTargetPort(k8sSvc, portEntry),
 				ServicePort: portEntry,
 			},
 			Service: svc,
@@ -154,6 +196,20 @@ func ExternalNameServiceInstances(k8sSvc coreV1.Service, svc *model.Service) []*
 	return out
 }
 
+// externalNameTargetPort returns the port of the external name the given service port maps to.
+// Only numeric target ports can be honored, as there are no pods to resolve named ports against.
+func externalNameTargetPort(k8sSvc coreV1.Service, port *model.Port) int {
+	for _, p := range k8sSvc.Spec.Ports {
+		if int(p.Port) == port.Port && p.Name == port.Name {
+			if p.TargetPort.Type == intstr.Int && p.TargetPort.IntValue() > 0 {
+				return p.TargetPort.IntValue()
+			}
+			break
+		}
+	}
+	return port.Port
+}
+
 // ServiceHostname produces FQDN for a k8s service
 func ServiceHostname(name, namespace, domainSuffix string) host.Name {
 	return host.Name(fmt.Sprintf("%s.%s.svc.%s", name, namespace, domainSuffix))
@@ -183,6 +239,23 @@ func PodMTLSReady(pod *coreV1.Pod) bool {
 	return pod.Labels[model.MTLSReadyLabelName] == "true"
 }
 
+// PodTLSMode returns the inbound TLS mode advertised by the annotation of the pod, unset if the pod is nil
+func PodTLSMode(pod *coreV1.Pod) model.EndpointTLSMode {
+	if pod == nil {
+		return model.EndpointTLSModeUnset
+	}
+	return model.ParseEndpointTLSMode(pod.Annotations[model.TLSModeLabelName])
+}
+
+// EndpointsMTLSReady returns true if the endpoints of a Service that are not backed by pods
+// are declared ready to configure Istio mTLS
+func EndpointsMTLSReady(svc *coreV1.Service) bool {
+	if svc == nil {
+		return false
+	}
+	return svc.Annotations[EndpointsMTLSReadyAnnotation] == "true"
+}
+
 // KeyFunc is the internal API key function that returns "namespace"/"name" or
 // "name" if "namespace" is empty
 func KeyFunc(name, namespace string) string {
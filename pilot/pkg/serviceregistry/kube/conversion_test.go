@@ -291,6 +291,89 @@ func TestExternalServiceConversion(t *testing.T) {
 	}
 }
 
+func TestExternalNameServiceInstances(t *testing.T) {
+	extSvc := coreV1.Service{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:        "service1",
+			Namespace:   "default",
+			Annotations: map[string]string{ExternalNameHostRewriteAnnotation: "true"},
+		},
+		Spec: coreV1.ServiceSpec{
+			Ports: []coreV1.ServicePort{
+				{
+					Name:       "https",
+					Port:       443,
+					TargetPort: intstr.FromInt(8443),
+					Protocol:   coreV1.ProtocolTCP,
+				},
+				{
+					Name:     "http",
+					Port:     80,
+					Protocol: coreV1.ProtocolTCP,
+				},
+			},
+			Type:         coreV1.ServiceTypeExternalName,
+			ExternalName: "api.example.com",
+		},
+	}
+
+	service := ConvertService(extSvc, domainSuffix, clusterID)
+	if service.Resolution != model.DNSLB {
+		t.Fatalf("resolution => %v, want %v", service.Resolution, model.DNSLB)
+	}
+	if service.Attributes.ExternalName != "api.example.com" {
+		t.Fatalf("external name => %q, want %q", service.Attributes.ExternalName, "api.example.com")
+	}
+	if !service.Attributes.RewriteHostToExternalName {
+		t.Fatal("host rewrite should be enabled by annotation")
+	}
+
+	instances := ExternalNameServiceInstances(extSvc, service)
+	if len(instances) != 2 {
+		t.Fatalf("incorrect number of instances => %v, want 2", len(instances))
+	}
+	expected := map[string]int{"https": 8443, "http": 80}
+	for _, instance := range instances {
+		if instance.Endpoint.Address != "api.example.com" {
+			t.Errorf("instance address => %q, want %q", instance.Endpoint.Address, "api.example.com")
+		}
+		if want := expected[instance.Endpoint.ServicePort.Name]; instance.Endpoint.Port != want {
+			t.Errorf("instance port for %s => %v, want %v", instance.Endpoint.ServicePort.Name, instance.Endpoint.Port, want)
+		}
+	}
+}
+
+func TestMeshExternalServiceConversion(t *testing.T) {
+	svc := coreV1.Service{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:        "kubernetes",
+			Namespace:   "default",
+			Annotations: map[string]string{MeshExternalAnnotation: "true"},
+		},
+		Spec: coreV1.ServiceSpec{
+			ClusterIP: "10.0.0.1",
+			Ports: []coreV1.ServicePort{
+				{
+					Name:     "https",
+					Port:     443,
+					Protocol: coreV1.ProtocolTCP,
+				},
+			},
+		},
+	}
+
+	service := ConvertService(svc, domainSuffix, clusterID)
+	if !service.MeshExternal {
+		t.Fatal("service should be mesh external")
+	}
+	if service.Resolution != model.Passthrough {
+		t.Fatalf("resolution => %v, want %v", service.Resolution, model.Passthrough)
+	}
+	if service.Address != "10.0.0.1" {
+		t.Fatalf("service address => %q, want %q", service.Address, "10.0.0.1")
+	}
+}
+
 func TestExternalClusterLocalServiceConversion(t *testing.T) {
 	serviceName := "service1"
 	namespace := "default"
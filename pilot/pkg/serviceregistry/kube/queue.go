@@ -15,9 +15,15 @@
 package kube
 
 import (
+	"reflect"
+	"strings"
 	"sync"
 	"time"
 
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/pkg/log"
 )
@@ -28,6 +34,18 @@ type Queue interface {
 	Push(Task)
 	// Run the loop until a signal on the channel
 	Run(<-chan struct{})
+	// AddHooks adds hooks called around the processing of every task, after the hooks already added
+	AddHooks(Hooks)
+}
+
+// Hooks are called around the handler of every task of a queue, so that tracing and metrics can be attached to
+// the processing of the events without modifying the handlers. Either function may be nil.
+type Hooks struct {
+	// PreProcess is called before the handler of the task.
+	PreProcess func(task Task)
+	// PostProcess is called after the handler of the task, with its error and duration. Failed tasks are retried
+	// after the error delay of the queue, calling the hooks again.
+	PostProcess func(task Task, err error, duration time.Duration)
 }
 
 // Handler specifies a function to apply on an object for a given event type
@@ -38,11 +56,69 @@ type Task struct {
 	Handler Handler
 	Obj     interface{}
 	Event   model.Event
+
+	// OldObj is the previous object of an update event.
+	OldObj interface{}
+	// Kind, Namespace and Name identify the object of the event, if it is a Kubernetes object.
+	Kind      string
+	Namespace string
+	Name      string
 }
 
 // NewTask creates a task from a work item
 func NewTask(handler Handler, obj interface{}, event model.Event) Task {
-	return Task{Handler: handler, Obj: obj, Event: event}
+	task := Task{Handler: handler, Obj: obj, Event: event}
+	task.Kind, task.Namespace, task.Name = objectID(obj)
+	return task
+}
+
+// NewUpdateTask creates a task for the update of an object from old to cur
+func NewUpdateTask(handler Handler, old, cur interface{}) Task {
+	task := NewTask(handler, cur, model.EventUpdate)
+	task.OldObj = old
+	return task
+}
+
+// objectID returns the kind, namespace and name of a Kubernetes object, or of the object of a tombstone. The kind
+// is the name of the Go type if the type meta of the object is not set, as for the objects of the informers.
+func objectID(obj interface{}) (kind, namespace, name string) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		if tombstone.Obj != nil {
+			kind, namespace, name = objectID(tombstone.Obj)
+			if name != "" {
+				return
+			}
+		}
+		namespace, name, _ = cache.SplitMetaNamespaceKey(tombstone.Key)
+		return
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return "", "", ""
+	}
+	if o, ok := obj.(runtime.Object); ok {
+		kind = o.GetObjectKind().GroupVersionKind().Kind
+	}
+	if kind == "" {
+		kind = reflect.Indirect(reflect.ValueOf(obj)).Type().Name()
+	}
+	return kind, accessor.GetNamespace(), accessor.GetName()
+}
+
+// String returns the event and the object of the task, e.g. "update Service default/foo".
+func (t Task) String() string {
+	parts := []string{t.Event.String()}
+	if t.Kind != "" {
+		parts = append(parts, t.Kind)
+	}
+	if t.Name != "" {
+		if t.Namespace != "" {
+			parts = append(parts, t.Namespace+"/"+t.Name)
+		} else {
+			parts = append(parts, t.Name)
+		}
+	}
+	return strings.Join(parts, " ")
 }
 
 type queueImpl struct {
@@ -50,6 +126,7 @@ type queueImpl struct {
 	queue   []Task
 	cond    *sync.Cond
 	closing bool
+	hooks   []Hooks
 }
 
 // NewQueue instantiates a queue with a processing function
@@ -62,6 +139,12 @@ func NewQueue(errorDelay time.Duration) Queue {
 	}
 }
 
+func (q *queueImpl) AddHooks(hooks Hooks) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	q.hooks = append(q.hooks, hooks)
+}
+
 func (q *queueImpl) Push(item Task) {
 	q.cond.L.Lock()
 	defer q.cond.L.Unlock()
@@ -94,10 +177,11 @@ func (q *queueImpl) Run(stop <-chan struct{}) {
 
 		var item Task
 		item, q.queue = q.queue[0], q.queue[1:]
+		hooks := q.hooks
 		q.cond.L.Unlock()
 		// 调用相应的处理函数，实际上就是下面的 Apply 函数
-		if err := item.Handler(item.Obj, item.Event); err != nil {
-			log.Infof("Work item handle failed (%v), retry after delay %v", err, q.delay)
+		if err := q.process(item, hooks); err != nil {
+			log.Infof("Work item %v handle failed (%v), retry after delay %v", item, err, q.delay)
 			time.AfterFunc(q.delay, func() {
 				q.Push(item)
 			})
@@ -106,6 +190,24 @@ func (q *queueImpl) Run(stop <-chan struct{}) {
 	}
 }
 
+// process calls the handler of the task between the hooks.
+func (q *queueImpl) process(item Task, hooks []Hooks) error {
+	for _, h := range hooks {
+		if h.PreProcess != nil {
+			h.PreProcess(item)
+		}
+	}
+	start := time.Now()
+	err := item.Handler(item.Obj, item.Event)
+	duration := time.Since(start)
+	for _, h := range hooks {
+		if h.PostProcess != nil {
+			h.PostProcess(item, err, duration)
+		}
+	}
+	return err
+}
+
 // ChainHandler applies handlers in a sequence
 type ChainHandler struct {
 	Funcs []Handler
@@ -16,9 +16,14 @@ package kube
 
 import (
 	"errors"
+	"sync"
 	"testing"
 	"time"
 
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
 	"istio.io/istio/pilot/pkg/model"
 )
 
@@ -85,3 +90,100 @@ func TestChainedHandler(t *testing.T) {
 	<-done
 	close(stop)
 }
+
+func TestNewTask(t *testing.T) {
+	handler := func(interface{}, model.Event) error { return nil }
+	old := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", ResourceVersion: "1"}}
+	cur := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", ResourceVersion: "2"}}
+
+	cases := []struct {
+		name string
+		task Task
+		want string
+	}{
+		{"add", NewTask(handler, cur, model.EventAdd), "add Service default/foo"},
+		{"update", NewUpdateTask(handler, old, cur), "update Service default/foo"},
+		{"type meta", NewTask(handler, &v1.Node{
+			TypeMeta:   metav1.TypeMeta{Kind: "Machine"},
+			ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		}, model.EventAdd), "add Machine node1"},
+		{"tombstone", NewTask(handler, cache.DeletedFinalStateUnknown{Key: "default/foo", Obj: cur}, model.EventDelete),
+			"delete Service default/foo"},
+		{"tombstone without object", NewTask(handler, cache.DeletedFinalStateUnknown{Key: "default/foo"}, model.EventDelete),
+			"delete default/foo"},
+		{"not an object", NewTask(handler, "Start leading", model.EventUpdate), "update"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.task.String(); got != tc.want {
+				t.Errorf("got task %q, want %q", got, tc.want)
+			}
+		})
+	}
+	if task := NewUpdateTask(handler, old, cur); task.OldObj != old || task.Obj != cur {
+		t.Errorf("got update task from %v to %v, want from %v to %v", task.OldObj, task.Obj, old, cur)
+	}
+}
+
+func TestQueueHooks(t *testing.T) {
+	q := NewQueue(1 * time.Microsecond)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+	q.AddHooks(Hooks{
+		PreProcess: func(task Task) { record("pre " + task.Name) },
+		PostProcess: func(task Task, err error, duration time.Duration) {
+			if duration < 0 {
+				t.Errorf("got negative duration %v", duration)
+			}
+			record("post " + task.Name + " " + errString(err))
+			if err == nil {
+				close(done)
+			}
+		},
+	})
+	q.AddHooks(Hooks{PreProcess: func(task Task) { record("pre2 " + task.Name) }})
+	go q.Run(stop)
+
+	failed := false
+	q.Push(NewTask(func(interface{}, model.Event) error {
+		if !failed {
+			failed = true
+			return errors.New("intentional error")
+		}
+		return nil
+	}, &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod1"}}, model.EventAdd))
+
+	<-done
+	close(stop)
+
+	want := []string{
+		"pre pod1", "pre2 pod1", "post pod1 intentional error",
+		"pre pod1", "pre2 pod1", "post pod1 ",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != len(want) {
+		t.Fatalf("got hook calls %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("got hook calls %v, want %v", events, want)
+			break
+		}
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -26,4 +26,8 @@ const (
 	ConsulRegistry ServiceRegistry = "Consul"
 	// MCPRegistry is a service registry backed by MCP ServiceEntries
 	MCPRegistry ServiceRegistry = "MCP"
+	// CloudRegistry is a service registry syncing cloud instance groups to ServiceEntries
+	CloudRegistry ServiceRegistry = "Cloud"
+	// StaticRegistry is a service registry backed by a static workload catalog file
+	StaticRegistry ServiceRegistry = "Static"
 )
@@ -0,0 +1,153 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package static provides a registry of the services of a static workload catalog, e.g. the containers of a
+// Docker Compose development mesh, for running Pilot without Kubernetes.
+package static
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+
+	"github.com/ghodss/yaml"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry/external"
+	"istio.io/istio/pkg/config/schema"
+	"istio.io/istio/pkg/config/schemas"
+	"istio.io/istio/pkg/spiffe"
+)
+
+const defaultNamespace = "default"
+
+// Catalog is a static catalog of services and their workloads.
+type Catalog struct {
+	Services []Service `json:"services"`
+}
+
+// Service is a service of the catalog, with the hostname <name>.<namespace>.svc.<domain suffix>.
+type Service struct {
+	Name      string     `json:"name"`
+	Namespace string     `json:"namespace,omitempty"`
+	Ports     []Port     `json:"ports"`
+	Workloads []Workload `json:"workloads"`
+}
+
+// Port is a port of a service.
+type Port struct {
+	Number   uint32 `json:"number"`
+	Protocol string `json:"protocol"`
+	Name     string `json:"name"`
+}
+
+// Workload is a workload of a service. The address is an IP, or a hostname resolved by DNS such as the name of a
+// Docker Compose service. The sidecars are associated with the workloads having their IP.
+type Workload struct {
+	Address        string            `json:"address"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	ServiceAccount string            `json:"serviceAccount,omitempty"`
+}
+
+// LoadCatalog reads a catalog from a YAML or JSON file, and returns its services as ServiceEntries.
+func LoadCatalog(path, domainSuffix string) ([]model.Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	catalog := &Catalog{}
+	if err := yaml.Unmarshal(data, catalog); err != nil {
+		return nil, fmt.Errorf("failed to parse the workload catalog %s: %v", path, err)
+	}
+
+	out := make([]model.Config, 0, len(catalog.Services))
+	for _, svc := range catalog.Services {
+		cfg, err := serviceEntry(svc, domainSuffix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid service %s of the workload catalog %s: %v", svc.Name, path, err)
+		}
+		out = append(out, cfg)
+	}
+	return out, nil
+}
+
+func serviceEntry(svc Service, domainSuffix string) (model.Config, error) {
+	if svc.Name == "" {
+		return model.Config{}, fmt.Errorf("name is required")
+	}
+	namespace := svc.Namespace
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+
+	se := &networking.ServiceEntry{
+		Hosts:      []string{fmt.Sprintf("%s.%s.svc.%s", svc.Name, namespace, domainSuffix)},
+		Location:   networking.ServiceEntry_MESH_INTERNAL,
+		Resolution: networking.ServiceEntry_STATIC,
+	}
+	for _, p := range svc.Ports {
+		se.Ports = append(se.Ports, &networking.Port{Number: p.Number, Protocol: p.Protocol, Name: p.Name})
+	}
+	for _, w := range svc.Workloads {
+		// The workloads addressed by hostname are resolved by Envoy.
+		if net.ParseIP(w.Address) == nil {
+			se.Resolution = networking.ServiceEntry_DNS
+		}
+		labels := map[string]string{"app": svc.Name}
+		for k, v := range w.Labels {
+			labels[k] = v
+		}
+		ep := &networking.ServiceEntry_Endpoint{
+			Address: w.Address,
+			Labels:  labels,
+		}
+		if w.ServiceAccount != "" {
+			ep.ServiceAccount = spiffe.MustGenSpiffeURI(namespace, w.ServiceAccount)
+		}
+		se.Endpoints = append(se.Endpoints, ep)
+	}
+
+	cfg := model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:      schemas.ServiceEntry.Type,
+			Group:     schemas.ServiceEntry.Group,
+			Version:   schemas.ServiceEntry.Version,
+			Name:      svc.Name,
+			Namespace: namespace,
+		},
+		Spec: se,
+	}
+	if err := schemas.ServiceEntry.Validate(cfg.Name, cfg.Namespace, cfg.Spec); err != nil {
+		return model.Config{}, err
+	}
+	return cfg, nil
+}
+
+// NewRegistry returns the registry of the services of a catalog file, and its controller.
+func NewRegistry(path, domainSuffix string) (*external.ServiceEntryStore, model.ConfigStoreCache, error) {
+	configs, err := LoadCatalog(path, domainSuffix)
+	if err != nil {
+		return nil, nil, err
+	}
+	controller := memory.NewController(memory.Make(schema.Set{schemas.ServiceEntry}))
+	for _, cfg := range configs {
+		if _, err := controller.Create(cfg); err != nil {
+			return nil, nil, err
+		}
+	}
+	return external.NewServiceDiscovery(controller, model.MakeIstioStore(controller)), controller, nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package static
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/host"
+)
+
+const catalog = `
+services:
+- name: productpage
+  ports:
+  - {number: 9080, protocol: HTTP, name: http}
+  workloads:
+  - address: 172.20.0.10
+    serviceAccount: bookinfo-productpage
+- name: reviews
+  namespace: bookinfo
+  ports:
+  - {number: 9080, protocol: HTTP, name: http}
+  workloads:
+  - address: reviews-v1
+    labels: {version: v1}
+  - address: reviews-v2
+    labels: {version: v2}
+`
+
+func writeCatalog(t *testing.T, content string) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "catalog.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { _ = os.RemoveAll(dir) }
+}
+
+func TestLoadCatalog(t *testing.T) {
+	path, cleanup := writeCatalog(t, catalog)
+	defer cleanup()
+
+	configs, err := LoadCatalog(path, "cluster.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("LoadCatalog() returned %d services, want 2", len(configs))
+	}
+
+	productpage := configs[0].Spec.(*networking.ServiceEntry)
+	if configs[0].Namespace != "default" || productpage.Hosts[0] != "productpage.default.svc.cluster.local" {
+		t.Errorf("unexpected service %v", configs[0])
+	}
+	if productpage.Resolution != networking.ServiceEntry_STATIC {
+		t.Errorf("services with IP workloads should be static, got %v", productpage.Resolution)
+	}
+	ep := productpage.Endpoints[0]
+	if ep.ServiceAccount != "spiffe://cluster.local/ns/default/sa/bookinfo-productpage" || ep.Labels["app"] != "productpage" {
+		t.Errorf("unexpected workload %v", ep)
+	}
+
+	reviews := configs[1].Spec.(*networking.ServiceEntry)
+	if reviews.Hosts[0] != "reviews.bookinfo.svc.cluster.local" || reviews.Resolution != networking.ServiceEntry_DNS {
+		t.Errorf("unexpected service %v", reviews)
+	}
+	if reviews.Endpoints[1].Labels["version"] != "v2" || reviews.Endpoints[1].Labels["app"] != "reviews" {
+		t.Errorf("unexpected workload %v", reviews.Endpoints[1])
+	}
+}
+
+func TestLoadCatalogInvalid(t *testing.T) {
+	path, cleanup := writeCatalog(t, `
+services:
+- name: reviews
+  workloads:
+  - address: 172.20.0.10
+`)
+	defer cleanup()
+
+	if _, err := LoadCatalog(path, "cluster.local"); err == nil {
+		t.Fatal("expected an error for a service without ports")
+	}
+}
+
+func TestNewRegistry(t *testing.T) {
+	path, cleanup := writeCatalog(t, catalog)
+	defer cleanup()
+
+	registry, _, err := NewRegistry(path, "cluster.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, err := registry.GetService(host.Name("productpage.default.svc.cluster.local"))
+	if err != nil || svc == nil {
+		t.Fatalf("GetService() = %v, %v", svc, err)
+	}
+	instances, err := registry.GetProxyServiceInstances(&model.Proxy{IPAddresses: []string{"172.20.0.10"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 1 || instances[0].Service.Hostname != svc.Hostname {
+		t.Fatalf("GetProxyServiceInstances() = %v", instances)
+	}
+}
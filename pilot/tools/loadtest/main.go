@@ -0,0 +1,324 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tool to load test pilot. It simulates a fleet of sidecars, each opening an ADS connection with
+// node metadata similar to the one sent by the injected proxies, then periodically triggers full
+// pushes and measures:
+//
+// * the time for each proxy to receive its initial configuration,
+// * the push latency, from the push trigger to the reception of the clusters by each proxy,
+// * the rate of acked responses and the rejections reported by pilot,
+// * the memory used by pilot, scraped from its monitoring port.
+//
+// Usage, against a pilot running locally:
+// ```bash
+// go run ./pilot/tools/loadtest --proxies 2000 --namespaces 20 --duration 5m
+// ```
+//
+// The run fails when the push latency or the memory exceed the --maxPushLatency or --maxMemoryMB
+// thresholds, so it can be used to catch performance regressions before a release.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pstruct "github.com/golang/protobuf/ptypes/struct"
+
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pkg/adsc"
+)
+
+var (
+	pilotAddr      = flag.String("pilot", "localhost:15010", "Address of the pilot gRPC server")
+	debugAddr      = flag.String("debug", "localhost:8080", "Address of the pilot HTTP debug server, used to trigger pushes")
+	monitoringAddr = flag.String("monitoring", "localhost:15014", "Address of the pilot monitoring server, used to scrape metrics")
+	certDir        = flag.String("certDir", "", "Directory of the certificates used for mTLS, plain text if empty")
+	proxyCount     = flag.Int("proxies", 1000, "Number of simulated proxies")
+	namespaces     = flag.Int("namespaces", 10, "Number of namespaces the proxies are spread over")
+	apps           = flag.Int("apps", 100, "Number of apps the proxies are spread over, each app is a workload label set")
+	istioVersion   = flag.String("istioVersion", "1.4.0", "Istio version reported by the proxies")
+	rampUp         = flag.Duration("rampUp", 30*time.Second, "Duration over which the proxies connect")
+	duration       = flag.Duration("duration", 5*time.Minute, "Duration of the test, after the ramp up")
+	pushInterval   = flag.Duration("pushInterval", 30*time.Second, "Interval between the triggered full pushes")
+	pushTimeout    = flag.Duration("pushTimeout", 30*time.Second, "Time to wait for all the proxies to receive a push")
+	maxPushLatency = flag.Duration("maxPushLatency", 0, "Fail if the p99 push latency exceeds it, 0 to disable")
+	maxMemoryMB    = flag.Int("maxMemoryMB", 0, "Fail if the pilot resident memory exceeds it, 0 to disable")
+)
+
+// proxy is a simulated sidecar.
+type proxy struct {
+	id  int
+	ads *adsc.ADSC
+
+	// initialLoad is the time to receive the initial clusters and listeners.
+	initialLoad time.Duration
+	// lastClusters is the time the clusters were last received, in unix nanoseconds.
+	lastClusters int64
+	// responses is the number of acked responses.
+	responses int64
+	closed    int32
+}
+
+func (p *proxy) ip() string {
+	n := p.id + 1
+	return fmt.Sprintf("10.%d.%d.%d", (n>>16)&0xff, (n>>8)&0xff, n&0xff)
+}
+
+func (p *proxy) namespace() string {
+	return fmt.Sprintf("loadtest-%d", p.id%*namespaces)
+}
+
+func (p *proxy) app() string {
+	return fmt.Sprintf("app-%d", p.id%*apps)
+}
+
+// metadata returns node metadata similar to the one of an injected sidecar.
+func (p *proxy) metadata() *pstruct.Struct {
+	str := func(s string) *pstruct.Value {
+		return &pstruct.Value{Kind: &pstruct.Value_StringValue{StringValue: s}}
+	}
+	return &pstruct.Struct{Fields: map[string]*pstruct.Value{
+		"ISTIO_VERSION":     str(*istioVersion),
+		"CONFIG_NAMESPACE":  str(p.namespace()),
+		"NAMESPACE":         str(p.namespace()),
+		"INTERCEPTION_MODE": str("REDIRECT"),
+		"INSTANCE_IPS":      str(p.ip()),
+		"SERVICE_ACCOUNT":   str(p.app()),
+		"WORKLOAD_NAME":     str(p.app()),
+		"CLUSTER_ID":        str("Kubernetes"),
+		"LABELS": {Kind: &pstruct.Value_StructValue{StructValue: &pstruct.Struct{Fields: map[string]*pstruct.Value{
+			"app":     str(p.app()),
+			"version": str("v1"),
+		}}}},
+	}}
+}
+
+func (p *proxy) connect() error {
+	ads, err := adsc.Dial(*pilotAddr, *certDir, &adsc.Config{
+		Namespace: p.namespace(),
+		Workload:  fmt.Sprintf("%s-%d", p.app(), p.id),
+		IP:        p.ip(),
+		Meta:      p.metadata(),
+	})
+	if err != nil {
+		return err
+	}
+	p.ads = ads
+
+	start := time.Now()
+	ads.Watch()
+	if _, err := ads.Wait(*pushTimeout, "cds", "lds"); err != nil {
+		return err
+	}
+	p.initialLoad = time.Since(start)
+	atomic.StoreInt64(&p.lastClusters, time.Now().UnixNano())
+	go p.watch()
+	return nil
+}
+
+// watch records the updates received until the connection is closed.
+func (p *proxy) watch() {
+	for update := range p.ads.Updates {
+		switch update {
+		case "close":
+			atomic.StoreInt32(&p.closed, 1)
+			return
+		case "cds":
+			atomic.StoreInt64(&p.lastClusters, time.Now().UnixNano())
+		}
+		atomic.AddInt64(&p.responses, 1)
+	}
+}
+
+// percentile returns the p-th percentile of the sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted)-1) * p / 100)
+	return sorted[i]
+}
+
+func summary(durations []time.Duration) string {
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	return fmt.Sprintf("p50=%v p90=%v p99=%v max=%v", percentile(durations, 50), percentile(durations, 90),
+		percentile(durations, 99), percentile(durations, 100))
+}
+
+// triggerPush triggers a full push and returns the push latency of each proxy receiving it in time.
+func triggerPush(proxies []*proxy) ([]time.Duration, error) {
+	start := time.Now()
+	resp, err := http.Get(fmt.Sprintf("http://%s/debug/adsz?push=true", *debugAddr))
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+
+	deadline := start.Add(*pushTimeout)
+	pending := proxies
+	var latencies []time.Duration
+	for len(pending) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		var next []*proxy
+		for _, p := range pending {
+			if last := atomic.LoadInt64(&p.lastClusters); last > start.UnixNano() {
+				latencies = append(latencies, time.Duration(last-start.UnixNano()))
+			} else if atomic.LoadInt32(&p.closed) == 0 {
+				next = append(next, p)
+			}
+		}
+		pending = next
+	}
+	if len(pending) > 0 {
+		log.Warnf("%d proxies did not receive the push within %v", len(pending), *pushTimeout)
+	}
+	return latencies, nil
+}
+
+// scrapeMetrics returns the pilot metrics of interest, summed over their labels.
+func scrapeMetrics() (map[string]float64, error) {
+	resp, err := http.Get(fmt.Sprintf("http://%s/metrics", *monitoringAddr))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	wanted := []string{"process_resident_memory_bytes", "go_memstats_heap_inuse_bytes", "pilot_total_xds_rejects",
+		"pilot_xds_push_timeout", "pilot_xds"}
+	out := map[string]float64{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		name := fields[0]
+		if i := strings.Index(name, "{"); i >= 0 {
+			name = name[:i]
+		}
+		for _, w := range wanted {
+			if name == w {
+				v, err := strconv.ParseFloat(fields[1], 64)
+				if err == nil {
+					out[name] += v
+				}
+			}
+		}
+	}
+	return out, scanner.Err()
+}
+
+func main() {
+	flag.Parse()
+
+	proxies := make([]*proxy, *proxyCount)
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		connected []*proxy
+		failures  int
+	)
+	interval := *rampUp / time.Duration(*proxyCount)
+	for i := range proxies {
+		proxies[i] = &proxy{id: i}
+		wg.Add(1)
+		go func(p *proxy) {
+			defer wg.Done()
+			err := p.connect()
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Warnf("proxy %d failed to connect: %v", p.id, err)
+				failures++
+				return
+			}
+			connected = append(connected, p)
+		}(proxies[i])
+		time.Sleep(interval)
+	}
+	wg.Wait()
+
+	initial := make([]time.Duration, 0, len(connected))
+	for _, p := range connected {
+		initial = append(initial, p.initialLoad)
+	}
+	log.Infof("connected %d proxies, %d failures, initial config %s", len(connected), failures, summary(initial))
+
+	failed := false
+	var responses int64
+	var pushLatencies []time.Duration
+	var maxMemory float64
+	lastReport := time.Now()
+	for end := time.Now().Add(*duration); time.Now().Before(end); time.Sleep(*pushInterval) {
+		latencies, err := triggerPush(connected)
+		if err != nil {
+			log.Errorf("failed to trigger push: %v", err)
+			continue
+		}
+		pushLatencies = append(pushLatencies, latencies...)
+
+		var total int64
+		for _, p := range connected {
+			total += atomic.LoadInt64(&p.responses)
+		}
+		rate := float64(total-responses) / time.Since(lastReport).Seconds()
+		responses, lastReport = total, time.Now()
+
+		metrics, err := scrapeMetrics()
+		if err != nil {
+			log.Warnf("failed to scrape pilot metrics: %v", err)
+		}
+		if m := metrics["process_resident_memory_bytes"]; m > maxMemory {
+			maxMemory = m
+		}
+		log.Infof("push to %d/%d proxies %s, acks %.1f/s, rejects %.0f, push timeouts %.0f, rss %.0fMB, heap %.0fMB",
+			len(latencies), len(connected), summary(latencies), rate, metrics["pilot_total_xds_rejects"],
+			metrics["pilot_xds_push_timeout"], metrics["process_resident_memory_bytes"]/1e6,
+			metrics["go_memstats_heap_inuse_bytes"]/1e6)
+	}
+
+	log.Infof("push latency %s, max rss %.0fMB", summary(pushLatencies), maxMemory/1e6)
+	if *maxPushLatency > 0 {
+		if p99 := percentile(pushLatencies, 99); p99 > *maxPushLatency {
+			log.Errorf("p99 push latency %v exceeds %v", p99, *maxPushLatency)
+			failed = true
+		}
+	}
+	if *maxMemoryMB > 0 && maxMemory/1e6 > float64(*maxMemoryMB) {
+		log.Errorf("max rss %.0fMB exceeds %dMB", maxMemory/1e6, *maxMemoryMB)
+		failed = true
+	}
+
+	for _, p := range connected {
+		p.ads.Close()
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
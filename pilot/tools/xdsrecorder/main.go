@@ -0,0 +1,339 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tool to record the ADS exchanges of a proxy with Pilot, and to replay them against a server, e.g. to debug
+// the NACK loops of a proxy.
+//
+// Usage:
+//
+// To record, run the tool between the proxy and Pilot, and point the discovery address of the proxy to it:
+// ```bash
+// go run ./pilot/tools/xdsrecorder --mode record --listen :15010 --upstream istio-pilot.istio-system:15010 --file xds.jsonl
+// ```
+// Each line of the file is a request of the proxy or a response of Pilot, with its time, stream, type, version,
+// nonce, resource names and error detail, and the message itself.
+//
+// To replay the requests of the proxy against a server, e.g. a local Pilot, and print its responses:
+// ```bash
+// go run ./pilot/tools/xdsrecorder --mode replay --file xds.jsonl --upstream localhost:15010
+// ```
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	ads "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+
+	"istio.io/pkg/log"
+)
+
+const (
+	requestDirection  = "request"
+	responseDirection = "response"
+)
+
+// record is a line of the record file.
+type record struct {
+	Time          time.Time `json:"time"`
+	Stream        int64     `json:"stream"`
+	Direction     string    `json:"direction"`
+	Node          string    `json:"node,omitempty"`
+	TypeURL       string    `json:"type_url"`
+	Version       string    `json:"version,omitempty"`
+	Nonce         string    `json:"nonce,omitempty"`
+	ResourceNames []string  `json:"resource_names,omitempty"`
+	Resources     int       `json:"resources,omitempty"`
+	ErrorDetail   string    `json:"error_detail,omitempty"`
+	// Message is the message, serialized as protobuf, as the resources of the responses embed types of
+	// many packages.
+	Message []byte `json:"message"`
+}
+
+func requestRecord(stream int64, req *xdsapi.DiscoveryRequest) (*record, error) {
+	msg, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	r := &record{
+		Time:          time.Now(),
+		Stream:        stream,
+		Direction:     requestDirection,
+		Node:          req.GetNode().GetId(),
+		TypeURL:       req.TypeUrl,
+		Version:       req.VersionInfo,
+		Nonce:         req.ResponseNonce,
+		ResourceNames: req.ResourceNames,
+		Message:       msg,
+	}
+	if req.ErrorDetail != nil {
+		r.ErrorDetail = req.ErrorDetail.Message
+	}
+	return r, nil
+}
+
+func responseRecord(stream int64, res *xdsapi.DiscoveryResponse) (*record, error) {
+	msg, err := proto.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return &record{
+		Time:      time.Now(),
+		Stream:    stream,
+		Direction: responseDirection,
+		TypeURL:   res.TypeUrl,
+		Version:   res.VersionInfo,
+		Nonce:     res.Nonce,
+		Resources: len(res.Resources),
+		Message:   msg,
+	}, nil
+}
+
+// recorder is an ADS server proxying the streams to an upstream server, and recording their messages.
+type recorder struct {
+	upstream ads.AggregatedDiscoveryServiceClient
+
+	mutex   sync.Mutex
+	encoder *json.Encoder
+	streams int64
+}
+
+func (r *recorder) write(rec *record) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.encoder.Encode(rec); err != nil {
+		log.Errorf("failed to record message: %v", err)
+	}
+}
+
+func (r *recorder) StreamAggregatedResources(downstream ads.AggregatedDiscoveryService_StreamAggregatedResourcesServer) error {
+	r.mutex.Lock()
+	r.streams++
+	id := r.streams
+	r.mutex.Unlock()
+
+	ctx, cancel := context.WithCancel(downstream.Context())
+	defer cancel()
+	upstream, err := r.upstream.StreamAggregatedResources(ctx)
+	if err != nil {
+		return err
+	}
+	log.Infof("stream %d: connected", id)
+
+	errCh := make(chan error, 2)
+	go func() {
+		for {
+			req, err := downstream.Recv()
+			if err != nil {
+				errCh <- err
+				return
+			}
+			if rec, err := requestRecord(id, req); err == nil {
+				r.write(rec)
+			}
+			if err := upstream.Send(req); err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+	go func() {
+		for {
+			res, err := upstream.Recv()
+			if err != nil {
+				errCh <- err
+				return
+			}
+			if rec, err := responseRecord(id, res); err == nil {
+				r.write(rec)
+			}
+			if err := downstream.Send(res); err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+
+	err = <-errCh
+	log.Infof("stream %d: closed: %v", id, err)
+	return err
+}
+
+func (r *recorder) DeltaAggregatedResources(ads.AggregatedDiscoveryService_DeltaAggregatedResourcesServer) error {
+	return fmt.Errorf("not implemented")
+}
+
+func runRecord(listen, file string, upstream ads.AggregatedDiscoveryServiceClient) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	l, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	server := grpc.NewServer()
+	ads.RegisterAggregatedDiscoveryServiceServer(server, &recorder{
+		upstream: upstream,
+		encoder:  json.NewEncoder(f),
+	})
+	log.Infof("recording the ADS streams of %s to %s", listen, file)
+	return server.Serve(l)
+}
+
+// readRequests returns the recorded requests, by stream.
+func readRequests(file string) (map[int64][]*record, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	out := make(map[int64][]*record)
+	decoder := json.NewDecoder(f)
+	for decoder.More() {
+		rec := &record{}
+		if err := decoder.Decode(rec); err != nil {
+			return nil, err
+		}
+		if rec.Direction == requestDirection {
+			out[rec.Stream] = append(out[rec.Stream], rec)
+		}
+	}
+	return out, nil
+}
+
+// replayStream sends the requests of a stream, with their recorded delays, and prints the responses.
+func replayStream(id int64, requests []*record, upstream ads.AggregatedDiscoveryServiceClient, wait time.Duration) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := upstream.StreamAggregatedResources(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The nonces of the recorded requests are the ones of the recorded server, so the requests acknowledging a
+	// response carry the nonce of the latest response of their type received from the live server instead.
+	var noncesMutex sync.Mutex
+	nonces := make(map[string]string)
+	go func() {
+		for {
+			res, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			noncesMutex.Lock()
+			nonces[res.TypeUrl] = res.Nonce
+			noncesMutex.Unlock()
+			fmt.Printf("stream %d: response %s version=%s nonce=%s resources=%d\n",
+				id, res.TypeUrl, res.VersionInfo, res.Nonce, len(res.Resources))
+		}
+	}()
+
+	for i, rec := range requests {
+		if i > 0 {
+			time.Sleep(rec.Time.Sub(requests[i-1].Time))
+		}
+		req := &xdsapi.DiscoveryRequest{}
+		if err := proto.Unmarshal(rec.Message, req); err != nil {
+			return err
+		}
+		if req.ResponseNonce != "" {
+			noncesMutex.Lock()
+			req.ResponseNonce = nonces[req.TypeUrl]
+			noncesMutex.Unlock()
+		}
+		status := "ACK"
+		if req.ErrorDetail != nil {
+			status = "NACK: " + req.ErrorDetail.Message
+		}
+		fmt.Printf("stream %d: request %s version=%s nonce=%s resources=%v %s\n",
+			id, req.TypeUrl, req.VersionInfo, req.ResponseNonce, req.ResourceNames, status)
+		if err := stream.Send(req); err != nil {
+			return err
+		}
+	}
+
+	// Wait for the responses to the last requests.
+	time.Sleep(wait)
+	return nil
+}
+
+func runReplay(file string, upstream ads.AggregatedDiscoveryServiceClient, wait time.Duration) error {
+	streams, err := readRequests(file)
+	if err != nil {
+		return err
+	}
+	ids := make([]int64, 0, len(streams))
+	for id := range streams {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id int64) {
+			defer wg.Done()
+			if err := replayStream(id, streams[id], upstream, wait); err != nil {
+				log.Errorf("stream %d: replay failed: %v", id, err)
+			}
+		}(id)
+	}
+	wg.Wait()
+	return nil
+}
+
+func main() {
+	mode := flag.String("mode", "record", "record or replay")
+	listen := flag.String("listen", ":15010", "Address of the ADS server recording the streams, in record mode")
+	upstream := flag.String("upstream", "localhost:15010", "Address of the ADS server the streams are sent to")
+	file := flag.String("file", "xds.jsonl", "File of the recorded messages")
+	wait := flag.Duration("wait", 5*time.Second, "Time to wait for the responses after the last request, in replay mode")
+	flag.Parse()
+
+	conn, err := grpc.Dial(*upstream, grpc.WithInsecure())
+	if err != nil {
+		log.Errorf("failed to connect to %s: %v", *upstream, err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+	client := ads.NewAggregatedDiscoveryServiceClient(conn)
+
+	switch *mode {
+	case "record":
+		err = runRecord(*listen, *file, client)
+	case "replay":
+		err = runReplay(*file, client, *wait)
+	default:
+		err = fmt.Errorf("unknown mode %q", *mode)
+	}
+	if err != nil {
+		log.Errora(err)
+		os.Exit(1)
+	}
+}
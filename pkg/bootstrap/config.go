@@ -17,9 +17,11 @@ package bootstrap
 import (
 	"context"
 	"encoding/json"
+	"math"
 	"net"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -50,6 +52,16 @@ const (
 	requiredEnvoyStatsMatcherInclusionPrefixes = "cluster_manager,listener_manager,http_mixer_filter,tcp_mixer_filter,server,cluster.xds-grpc"
 	requiredEnvoyStatsMatcherInclusionSuffix   = "ssl_context_update_by_sds"
 
+	// Security stats of the listeners: the TLS handshakes, the handshake failures and the client
+	// certificates rejected by the listeners requiring mutual TLS, in particular for a SAN mismatch,
+	// as well as the decisions of the RBAC filters, per HTTP connection manager for HTTP and under
+	// the tcp.rbac prefix for TCP. Envoy has no latency stat of the RBAC decisions: the filters
+	// decide synchronously from the connection and request attributes, so the time of the decision
+	// is only part of the downstream connection and request times.
+	requiredEnvoyStatsMatcherInclusionRegexps = `listener\..*\.ssl\.(handshake|connection_error|` +
+		`fail_verify_no_cert|fail_verify_error|fail_verify_san|fail_verify_cert_hash),` +
+		`(http|tcp)\..*rbac\.(allowed|denied|shadow_allowed|shadow_denied)`
+
 	// Prefixes of V2 metrics.
 	// "reporter" prefix is for istio standard metrics.
 	// "component" prefix is for istio_build metric.
@@ -125,6 +137,11 @@ func (cfg Config) toTemplateParams() (map[string]interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Report the worker threads of the proxy, chosen at injection, to Pilot and istioctl.
+	if cfg.Proxy != nil && cfg.Proxy.Concurrency > 0 {
+		meta.ProxyConcurrency = strconv.Itoa(int(cfg.Proxy.Concurrency))
+		rawMeta["PROXY_CONCURRENCY"] = meta.ProxyConcurrency
+	}
 	opts = append(opts, getNodeMetadataOptions(meta, rawMeta, cfg.PlatEnv)...)
 
 	// Check if nodeIP carries IPv4 or IPv6 and set up proxy accordingly
@@ -190,7 +207,7 @@ func getStatsOptions(meta *model.NodeMetadata, nodeIPs []string) []option.Instan
 	return []option.Instance{
 		option.EnvoyStatsMatcherInclusionPrefix(parseOption(meta.StatsInclusionPrefixes, requiredEnvoyStatsMatcherInclusionPrefixes)),
 		option.EnvoyStatsMatcherInclusionSuffix(parseOption(meta.StatsInclusionSuffixes, requiredEnvoyStatsMatcherInclusionSuffix)),
-		option.EnvoyStatsMatcherInclusionRegexp(parseOption(meta.StatsInclusionRegexps, "")),
+		option.EnvoyStatsMatcherInclusionRegexp(parseOption(meta.StatsInclusionRegexps, requiredEnvoyStatsMatcherInclusionRegexps)),
 	}
 }
 
@@ -219,10 +236,56 @@ func getNodeMetadataOptions(meta *model.NodeMetadata, rawMeta map[string]interfa
 
 	opts = append(opts, getStatsOptions(meta, meta.InstanceIPs)...)
 
+	opts = append(opts, option.OutlierLogPath(meta.OutlierLogPath))
+
+	opts = append(opts, getOverloadOptions(meta)...)
+
 	opts = append(opts, option.NodeMetadata(meta, rawMeta))
 	return opts
 }
 
+// defaultOverloadShedHeapPercent is the percentage of the max heap size at which the proxy stops accepting
+// requests when the workload does not set it.
+const defaultOverloadShedHeapPercent = 95
+
+// getOverloadOptions returns the options of the overload manager shedding the load of the proxy as its heap
+// reaches the OverloadShedHeapPercent of OverloadMaxHeapSize, releasing the free heap memory slightly before,
+// and of the limit of the active downstream connections. The invalid settings are ignored.
+func getOverloadOptions(meta *model.NodeMetadata) []option.Instance {
+	var opts []option.Instance
+	if meta.OverloadMaxHeapSize != "" {
+		heapSize, err := strconv.ParseUint(meta.OverloadMaxHeapSize, 10, 64)
+		if err != nil || heapSize == 0 {
+			log.Warnf("ignoring invalid overload max heap size %q", meta.OverloadMaxHeapSize)
+		} else {
+			percent := uint64(defaultOverloadShedHeapPercent)
+			if meta.OverloadShedHeapPercent != "" {
+				if p, err := strconv.ParseUint(meta.OverloadShedHeapPercent, 10, 64); err != nil || p == 0 || p > 100 {
+					log.Warnf("ignoring invalid overload shed heap percent %q, using %d",
+						meta.OverloadShedHeapPercent, defaultOverloadShedHeapPercent)
+				} else {
+					percent = p
+				}
+			}
+			shed := float64(percent) / 100
+			opts = append(opts,
+				option.OverloadMaxHeapSize(heapSize),
+				option.OverloadShrinkHeapThreshold(math.Round(shed*95)/100),
+				option.OverloadShedHeapThreshold(shed))
+		}
+	}
+
+	if meta.MaxDownstreamConnections != "" {
+		connections, err := strconv.ParseUint(meta.MaxDownstreamConnections, 10, 64)
+		if err != nil || connections == 0 {
+			log.Warnf("ignoring invalid max downstream connections %q", meta.MaxDownstreamConnections)
+		} else {
+			opts = append(opts, option.MaxDownstreamConnections(connections))
+		}
+	}
+	return opts
+}
+
 func getLocalityOptions(meta *model.NodeMetadata, platEnv platform.Environment) []option.Instance {
 	l := util.ConvertLocality(model.GetLocalityOrDefault(meta.LocalityLabel, ""))
 	if l == nil {
@@ -249,6 +312,9 @@ func getProxyConfigOptions(config *meshAPI.ProxyConfig, metadata *model.NodeMeta
 		switch tracer := config.Tracing.Tracer.(type) {
 		case *meshAPI.Tracing_Zipkin_:
 			opts = append(opts, option.ZipkinAddress(tracer.Zipkin.Address))
+			if meshCollectorsVar.Get() {
+				opts = append(opts, option.ZipkinMeshCluster(tracer.Zipkin.Address))
+			}
 		case *meshAPI.Tracing_Lightstep_:
 			// Create the token file.
 			lightstepAccessTokenPath := lightstepAccessTokenFile(config.ConfigPath)
@@ -290,6 +356,9 @@ func getProxyConfigOptions(config *meshAPI.ProxyConfig, metadata *model.NodeMeta
 		opts = append(opts, option.EnvoyMetricsServiceAddress(config.EnvoyMetricsService.Address),
 			option.EnvoyMetricsServiceTLS(config.EnvoyMetricsService.TlsSettings, metadata),
 			option.EnvoyMetricsServiceTCPKeepalive(config.EnvoyMetricsService.TcpKeepalive))
+		if meshCollectorsVar.Get() {
+			opts = append(opts, option.EnvoyMetricsServiceMeshCluster(config.EnvoyMetricsService.Address))
+		}
 	} else if config.EnvoyMetricsServiceAddress != "" {
 		opts = append(opts, option.EnvoyMetricsServiceAddress(config.EnvoyMetricsService.Address))
 	}
@@ -35,6 +35,10 @@ const (
 var (
 	// TODO(nmittler): Move this to application code. This shouldn't be declared in a library.
 	overrideVar = env.RegisterStringVar("ISTIO_BOOTSTRAP", "", "")
+
+	meshCollectorsVar = env.RegisterBoolVar("ISTIO_BOOTSTRAP_MESH_COLLECTORS", false,
+		"If enabled, the zipkin collector and the Envoy metrics service are mesh services whose endpoints are "+
+			"read from Pilot through EDS, instead of addresses resolved with DNS.")
 )
 
 // Instance of a configured Envoy bootstrap writer.
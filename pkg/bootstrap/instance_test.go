@@ -416,6 +416,12 @@ func checkStatsMatcher(t *testing.T, got, want *v2.Bootstrap, stats stats) {
 		stats.suffixes += "," + requiredEnvoyStatsMatcherInclusionSuffix
 	}
 
+	if stats.regexps == "" {
+		stats.regexps = requiredEnvoyStatsMatcherInclusionRegexps
+	} else {
+		stats.regexps += "," + requiredEnvoyStatsMatcherInclusionRegexps
+	}
+
 	if err := gsm.Validate(); err != nil {
 		t.Fatalf("Generated invalid matcher: %v", err)
 	}
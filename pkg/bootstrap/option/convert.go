@@ -19,6 +19,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
 
 	envoyAPI "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	envoyAPICore "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
@@ -32,8 +34,35 @@ import (
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pkg/bootstrap/auth"
 	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/config/host"
 )
 
+// defaultClusterDomain is the domain short Kubernetes service names are expanded with.
+const defaultClusterDomain = "cluster.local"
+
+// meshClusterConverter converts the host:port address of a mesh service to the name of the outbound cluster
+// of the service in Pilot. Short Kubernetes names, e.g. zipkin.istio-system, are expanded with the default
+// cluster domain.
+func meshClusterConverter(value string) convertFunc {
+	return func(*instance) (interface{}, error) {
+		hostname, portValue, err := net.SplitHostPort(value)
+		if err != nil {
+			return nil, err
+		}
+		if net.ParseIP(hostname) != nil {
+			return nil, fmt.Errorf("%s is not the address of a mesh service", value)
+		}
+		port, err := strconv.Atoi(portValue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port in address %s: %v", value, err)
+		}
+		if strings.Count(hostname, ".") == 1 {
+			hostname += ".svc." + defaultClusterDomain
+		}
+		return model.BuildSubsetKey(model.TrafficDirectionOutbound, "", host.Name(hostname), port), nil
+	}
+}
+
 func keepaliveConverter(value *networkingAPI.ConnectionPoolSettings_TCPSettings_TcpKeepalive) convertFunc {
 	return func(*instance) (interface{}, error) {
 		upstreamConnectionOptions := &envoyAPI.UpstreamConnectionOptions{
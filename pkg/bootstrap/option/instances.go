@@ -178,6 +178,12 @@ func ZipkinAddress(value string) Instance {
 	return newOptionOrSkipIfZero("zipkin", value).withConvert(addressConverter(value))
 }
 
+// ZipkinMeshCluster is the outbound cluster of the zipkin collector, when it is a mesh service whose endpoints
+// are read through EDS.
+func ZipkinMeshCluster(value string) Instance {
+	return newOptionOrSkipIfZero("zipkin_eds_cluster", value).withConvert(meshClusterConverter(value))
+}
+
 func DataDogAddress(value string) Instance {
 	return newOptionOrSkipIfZero("datadog", value).withConvert(addressConverter(value))
 }
@@ -190,6 +196,12 @@ func EnvoyMetricsServiceAddress(value string) Instance {
 	return newOptionOrSkipIfZero("envoy_metrics_service_address", value).withConvert(addressConverter(value))
 }
 
+// EnvoyMetricsServiceMeshCluster is the outbound cluster of the Envoy metrics service, when it is a mesh
+// service whose endpoints are read through EDS.
+func EnvoyMetricsServiceMeshCluster(value string) Instance {
+	return newOptionOrSkipIfZero("envoy_metrics_service_eds_cluster", value).withConvert(meshClusterConverter(value))
+}
+
 func EnvoyMetricsServiceTLS(value *networkingAPI.TLSSettings, metadata *model.NodeMetadata) Instance {
 	return newOptionOrSkipIfZero("envoy_metrics_service_tls", value).
 		withConvert(tlsConverter(value, "envoy_metrics_service", metadata))
@@ -212,6 +224,26 @@ func EnvoyAccessLogServiceTCPKeepalive(value *networkingAPI.ConnectionPoolSettin
 	return newTCPKeepaliveOption("envoy_accesslog_service_tcp_keepalive", value)
 }
 
+func OutlierLogPath(value string) Instance {
+	return newOptionOrSkipIfZero("outlier_log_path", value)
+}
+
+func OverloadMaxHeapSize(value uint64) Instance {
+	return newOptionOrSkipIfZero("overload_max_heap_size", value)
+}
+
+func OverloadShrinkHeapThreshold(value float64) Instance {
+	return newOptionOrSkipIfZero("overload_shrink_heap_threshold", value)
+}
+
+func OverloadShedHeapThreshold(value float64) Instance {
+	return newOptionOrSkipIfZero("overload_shed_heap_threshold", value)
+}
+
+func MaxDownstreamConnections(value uint64) Instance {
+	return newOptionOrSkipIfZero("max_downstream_connections", value)
+}
+
 func EnvoyStatsMatcherInclusionPrefix(value []string) Instance {
 	return newStringArrayOptionOrSkipIfEmpty("inclusionPrefix", value)
 }
@@ -390,6 +390,36 @@ func TestOptions(t *testing.T) {
 			option:      option.ZipkinAddress("127.0.0.1"),
 			expectError: true,
 		},
+		{
+			testName: "zipkin mesh cluster empty",
+			key:      "zipkin_eds_cluster",
+			option:   option.ZipkinMeshCluster(""),
+			expected: nil,
+		},
+		{
+			testName: "zipkin mesh cluster short name",
+			key:      "zipkin_eds_cluster",
+			option:   option.ZipkinMeshCluster("zipkin.istio-system:9411"),
+			expected: "outbound|9411||zipkin.istio-system.svc.cluster.local",
+		},
+		{
+			testName: "zipkin mesh cluster fqdn",
+			key:      "zipkin_eds_cluster",
+			option:   option.ZipkinMeshCluster("zipkin.tracing.svc.cluster.local:9411"),
+			expected: "outbound|9411||zipkin.tracing.svc.cluster.local",
+		},
+		{
+			testName:    "zipkin mesh cluster ip",
+			key:         "zipkin_eds_cluster",
+			option:      option.ZipkinMeshCluster("127.0.0.1:9411"),
+			expectError: true,
+		},
+		{
+			testName: "envoy metrics service mesh cluster",
+			key:      "envoy_metrics_service_eds_cluster",
+			option:   option.EnvoyMetricsServiceMeshCluster("metrics.monitoring:15000"),
+			expected: "outbound|15000||metrics.monitoring.svc.cluster.local",
+		},
 		{
 			testName: "datadog address empty",
 			key:      "datadog",
@@ -614,6 +644,42 @@ func TestOptions(t *testing.T) {
 			}),
 			expected: "{\"tcp_keepalive\":{\"keepalive_time\":{\"value\":1}}}",
 		},
+		{
+			testName: "outlier log path empty",
+			key:      "outlier_log_path",
+			option:   option.OutlierLogPath(""),
+			expected: nil,
+		},
+		{
+			testName: "outlier log path",
+			key:      "outlier_log_path",
+			option:   option.OutlierLogPath("/var/log/outlier.log"),
+			expected: "/var/log/outlier.log",
+		},
+		{
+			testName: "overload max heap size empty",
+			key:      "overload_max_heap_size",
+			option:   option.OverloadMaxHeapSize(0),
+			expected: nil,
+		},
+		{
+			testName: "overload max heap size",
+			key:      "overload_max_heap_size",
+			option:   option.OverloadMaxHeapSize(1073741824),
+			expected: uint64(1073741824),
+		},
+		{
+			testName: "overload shed heap threshold",
+			key:      "overload_shed_heap_threshold",
+			option:   option.OverloadShedHeapThreshold(0.95),
+			expected: 0.95,
+		},
+		{
+			testName: "max downstream connections",
+			key:      "max_downstream_connections",
+			option:   option.MaxDownstreamConnections(10000),
+			expected: uint64(10000),
+		},
 		{
 			testName: "envoy stats matcher inclusion prefix nil",
 			key:      "inclusionPrefix",
@@ -55,3 +55,8 @@ func IsPassThroughServer(server *v1alpha3.Server) bool {
 
 	return false
 }
+
+// SubjectAltNameRegexPrefix marks the subject alt names of a server TLS options that are regular
+// expressions rather than exact values, e.g. "regex:spiffe://partner\.com/.*". The proxies only
+// verify the exact subject alt names of the client certificates, so these are rejected.
+const SubjectAltNameRegexPrefix = "regex:"
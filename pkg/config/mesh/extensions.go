@@ -0,0 +1,78 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mesh
+
+import (
+	"fmt"
+
+	"github.com/ghodss/yaml"
+)
+
+// The telemetry exporters of TelemetryExport.
+const (
+	// TelemetryExporterStackdriver exports metrics and access logs to Stackdriver.
+	TelemetryExporterStackdriver = "stackdriver"
+	// TelemetryExporterOpenTelemetry exposes the Istio standard metrics for collection by an OpenTelemetry collector.
+	TelemetryExporterOpenTelemetry = "opentelemetry"
+)
+
+// Extensions are the mesh settings of Pilot which are not fields of the MeshConfig API. They are set at the top
+// level of the same mesh config, whose MeshConfig parsing ignores them, e.g.:
+//
+//	telemetryExport:
+//	  exporter: stackdriver
+//	  projectId: my-project
+type Extensions struct {
+	// TelemetryExport generates the proxy telemetry filters exporting to a cloud-managed backend.
+	TelemetryExport TelemetryExport `json:"telemetryExport,omitempty"`
+}
+
+// TelemetryExport configures the telemetry filters Pilot generates for the proxies.
+type TelemetryExport struct {
+	// Exporter is the backend the proxies export to, TelemetryExporterStackdriver or
+	// TelemetryExporterOpenTelemetry. The filters are not generated if it is empty, to rely on Mixer or
+	// EnvoyFilters.
+	Exporter string `json:"exporter,omitempty"`
+
+	// ProjectID is the cloud project telemetry is exported to, for the proxies not reporting one in their
+	// platform metadata.
+	ProjectID string `json:"projectId,omitempty"`
+
+	// AccessLogging exports the access logs along with the metrics.
+	AccessLogging bool `json:"accessLogging,omitempty"`
+}
+
+// ApplyMeshExtensions returns the extensions of the mesh config YAML, ignoring the MeshConfig fields.
+func ApplyMeshExtensions(yml string) (*Extensions, error) {
+	out := &Extensions{}
+	if err := yaml.Unmarshal([]byte(yml), out); err != nil {
+		return nil, fmt.Errorf("invalid mesh config extensions: %v", err)
+	}
+	if err := ValidateMeshExtensions(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ValidateMeshExtensions checks the extensions of the mesh config.
+func ValidateMeshExtensions(e *Extensions) error {
+	switch e.TelemetryExport.Exporter {
+	case "", TelemetryExporterStackdriver, TelemetryExporterOpenTelemetry:
+	default:
+		return fmt.Errorf("unsupported telemetry exporter %q: must be %s or %s", e.TelemetryExport.Exporter,
+			TelemetryExporterStackdriver, TelemetryExporterOpenTelemetry)
+	}
+	return nil
+}
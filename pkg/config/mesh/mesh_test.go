@@ -121,3 +121,33 @@ networks:
 		t.Fatalf("Wrong values:\n got %#v \nwant %#v", got, &want)
 	}
 }
+
+func TestApplyMeshExtensions(t *testing.T) {
+	yaml := `
+defaultConfig:
+  configPath: /test/config/patch
+telemetryExport:
+  exporter: stackdriver
+  projectId: my-project
+  accessLogging: true
+`
+	want := &mesh.Extensions{TelemetryExport: mesh.TelemetryExport{
+		Exporter:      mesh.TelemetryExporterStackdriver,
+		ProjectID:     "my-project",
+		AccessLogging: true,
+	}}
+	got, err := mesh.ApplyMeshExtensions(yaml)
+	if err != nil {
+		t.Fatalf("ApplyMeshExtensions() failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Wrong values:\n got %#v \nwant %#v", got, want)
+	}
+	if _, err := mesh.ApplyMeshConfigDefaults(yaml); err != nil {
+		t.Fatalf("ApplyMeshConfigDefaults() failed with the extensions: %v", err)
+	}
+
+	if _, err := mesh.ApplyMeshExtensions("telemetryExport:\n  exporter: zipkin\n"); err == nil {
+		t.Fatal("ApplyMeshExtensions() accepted an unsupported telemetry exporter")
+	}
+}
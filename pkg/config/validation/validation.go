@@ -380,6 +380,13 @@ func validateTLSOptions(tls *networking.Server_TLSOptions) (errs error) {
 		return
 	}
 
+	for _, san := range tls.SubjectAltNames {
+		if strings.HasPrefix(san, gateway.SubjectAltNameRegexPrefix) {
+			errs = appendErrors(errs, fmt.Errorf("subject alt name %q: regular expressions are not supported, "+
+				"the subject alt names must be exact", san))
+		}
+	}
+
 	if tls.Mode == networking.Server_TLSOptions_ISTIO_MUTUAL {
 		// ISTIO_MUTUAL TLS mode uses either SDS or default certificate mount paths
 		// therefore, we should fail validation if other TLS fields are set
@@ -1986,7 +1993,21 @@ func validateHTTPRoute(http *networking.HTTPRoute) (errs error) {
 					errs = appendErrors(errs, fmt.Errorf("header match %v cannot be null", name))
 				}
 				errs = appendErrors(errs, ValidateHTTPHeaderName(name))
+				errs = appendErrors(errs, validateStringMatchRegexp(header, "headers"))
 			}
+			for name, param := range match.QueryParams {
+				if name == "" {
+					errs = appendErrors(errs, errors.New("query param name cannot be empty"))
+				}
+				if param == nil {
+					errs = appendErrors(errs, fmt.Errorf("query param match %v cannot be null", name))
+				}
+				errs = appendErrors(errs, validateStringMatchRegexp(param, "queryParams"))
+			}
+			errs = appendErrors(errs, validateStringMatchRegexp(match.Uri, "uri"))
+			errs = appendErrors(errs, validateStringMatchRegexp(match.Method, "method"))
+			errs = appendErrors(errs, validateStringMatchRegexp(match.Authority, "authority"))
+			errs = appendErrors(errs, validateStringMatchRegexp(match.Scheme, "scheme"))
 
 			if match.Port != 0 {
 				errs = appendErrors(errs, ValidatePort(int(match.Port)))
@@ -2014,6 +2035,21 @@ func validateHTTPRoute(http *networking.HTTPRoute) (errs error) {
 	return
 }
 
+// validateStringMatchRegexp validates the regex of a string match, compiled by the RE2 engine of the proxies.
+func validateStringMatchRegexp(sm *networking.StringMatch, where string) error {
+	re := sm.GetRegex()
+	if re == "" {
+		if _, ok := sm.GetMatchType().(*networking.StringMatch_Regex); ok {
+			return fmt.Errorf("%q: regex string match should not be empty", where)
+		}
+		return nil
+	}
+	if _, err := regexp.Compile(re); err != nil {
+		return fmt.Errorf("%q: %v", where, err)
+	}
+	return nil
+}
+
 func validateGatewayNames(gatewayNames []string) (errs error) {
 	for _, gatewayName := range gatewayNames {
 		parts := strings.SplitN(gatewayName, "/", 2)
@@ -1474,6 +1474,18 @@ func TestValidateTlsOptions(t *testing.T) {
 				Mode:       networking.Server_TLSOptions_ISTIO_MUTUAL,
 				PrivateKey: "Khan Noonien Singh"},
 			"cannot have associated private key"},
+		{"mutual with subject alt names",
+			&networking.Server_TLSOptions{
+				Mode:            networking.Server_TLSOptions_MUTUAL,
+				CredentialName:  "sds-name",
+				SubjectAltNames: []string{"spiffe://partner.com/admin"}},
+			""},
+		{"mutual with subject alt name regex",
+			&networking.Server_TLSOptions{
+				Mode:            networking.Server_TLSOptions_MUTUAL,
+				CredentialName:  "sds-name",
+				SubjectAltNames: []string{"regex:spiffe://partner\\.com/.*"}},
+			"regular expressions are not supported"},
 	}
 
 	for _, tt := range tests {
@@ -2226,6 +2238,33 @@ func TestValidateHTTPRoute(t *testing.T) {
 				},
 			}},
 		}, valid: false},
+		{name: "presence header and query param match", route: &networking.HTTPRoute{
+			Route: []*networking.HTTPRouteDestination{{
+				Destination: &networking.Destination{Host: "foo.bar"},
+			}},
+			Match: []*networking.HTTPMatchRequest{{
+				Headers:     map[string]*networking.StringMatch{"header": {}},
+				QueryParams: map[string]*networking.StringMatch{"param": {}},
+			}},
+		}, valid: true},
+		{name: "invalid query param regex", route: &networking.HTTPRoute{
+			Route: []*networking.HTTPRouteDestination{{
+				Destination: &networking.Destination{Host: "foo.bar"},
+			}},
+			Match: []*networking.HTTPMatchRequest{{
+				QueryParams: map[string]*networking.StringMatch{
+					"param": {MatchType: &networking.StringMatch_Regex{Regex: "[a-z"}},
+				},
+			}},
+		}, valid: false},
+		{name: "invalid uri regex", route: &networking.HTTPRoute{
+			Route: []*networking.HTTPRouteDestination{{
+				Destination: &networking.Destination{Host: "foo.bar"},
+			}},
+			Match: []*networking.HTTPMatchRequest{{
+				Uri: &networking.StringMatch{MatchType: &networking.StringMatch_Regex{Regex: "/(a"}},
+			}},
+		}, valid: false},
 		{name: "nil match", route: &networking.HTTPRoute{
 			Route: []*networking.HTTPRouteDestination{{
 				Destination: &networking.Destination{Host: "foo.bar"},
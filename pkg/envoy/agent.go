@@ -69,13 +69,15 @@ var errAbort = errors.New("epoch aborted")
 
 const errOutOfMemory = "signal: killed"
 
-// NewAgent creates a new proxy agent for the proxy start-up and clean-up functions.
-func NewAgent(proxy Proxy, terminationDrainDuration time.Duration) Agent {
+// NewAgent creates a new proxy agent for the proxy start-up and clean-up functions. On termination, the
+// proxy keeps serving for the terminationServeDuration, then drains for the rest of the terminationDrainDuration.
+func NewAgent(proxy Proxy, terminationDrainDuration, terminationServeDuration time.Duration) Agent {
 	return &agent{
 		proxy:                    proxy,
 		statusCh:                 make(chan exitStatus),
 		activeEpochs:             map[int]chan error{},
 		terminationDrainDuration: terminationDrainDuration,
+		terminationServeDuration: terminationServeDuration,
 		currentEpoch:             -1,
 	}
 }
@@ -114,6 +116,10 @@ type agent struct {
 
 	// time to allow for the proxy to drain before terminating all remaining proxy processes
 	terminationDrainDuration time.Duration
+
+	// part of the terminationDrainDuration during which the proxy keeps serving before draining, while the
+	// endpoint removal propagates to the other proxies
+	terminationServeDuration time.Duration
 }
 
 type exitStatus struct {
@@ -243,10 +249,18 @@ func (a *agent) Run(ctx context.Context) error {
 }
 
 func (a *agent) terminate() {
+	serve := a.terminationServeDuration
+	if serve > a.terminationDrainDuration {
+		serve = a.terminationDrainDuration
+	}
+	if serve > 0 {
+		log.Infof("Agent serving for %v before draining Proxy", serve)
+		time.Sleep(serve)
+	}
 	log.Infof("Agent draining Proxy")
 	a.Restart(DrainConfig{})
-	log.Infof("Graceful termination period is %v, starting...", a.terminationDrainDuration)
-	time.Sleep(a.terminationDrainDuration)
+	log.Infof("Graceful termination period is %v, starting...", a.terminationDrainDuration-serve)
+	time.Sleep(a.terminationDrainDuration - serve)
 	log.Infof("Graceful termination period complete, terminating remaining proxies.")
 	a.abortAll()
 }
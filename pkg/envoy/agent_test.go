@@ -56,7 +56,7 @@ func (tp TestProxy) Cleanup(epoch int) {
 func TestStartExit(t *testing.T) {
 	ctx := context.Background()
 	done := make(chan struct{})
-	a := NewAgent(TestProxy{}, 0)
+	a := NewAgent(TestProxy{}, 0, 0)
 	go func() {
 		_ = a.Run(ctx)
 		done <- struct{}{}
@@ -97,7 +97,7 @@ func TestStartDrain(t *testing.T) {
 		}
 		return nil
 	}
-	a := NewAgent(TestProxy{run: start}, -10*time.Second)
+	a := NewAgent(TestProxy{run: start}, -10*time.Second, 0)
 	go func() { _ = a.Run(ctx) }()
 	a.Restart(startConfig)
 	<-blockChan
@@ -147,7 +147,7 @@ func TestWaitForLive(t *testing.T) {
 	isLive := func() bool {
 		return atomic.LoadUint32(&live) > 0
 	}
-	a := NewAgent(TestProxy{run: start, live: isLive}, -10*time.Second)
+	a := NewAgent(TestProxy{run: start, live: isLive}, -10*time.Second, 0)
 	go func() { _ = a.Run(ctx) }()
 
 	// Start the first epoch.
@@ -190,7 +190,7 @@ func TestExitDuringWaitForLive(t *testing.T) {
 		// Never go live.
 		return false
 	}
-	a := NewAgent(TestProxy{run: start, live: neverLive}, -10*time.Second)
+	a := NewAgent(TestProxy{run: start, live: neverLive}, -10*time.Second, 0)
 	go func() { _ = a.Run(ctx) }()
 
 	// Start the first epoch.
@@ -232,7 +232,7 @@ func TestApplyTwice(t *testing.T) {
 		<-ctx.Done()
 		return nil
 	}
-	a := NewAgent(TestProxy{run: start}, -10*time.Second)
+	a := NewAgent(TestProxy{run: start}, -10*time.Second, 0)
 	go func() { _ = a.Run(ctx) }()
 	a.Restart(desired)
 	applyCount++
@@ -291,7 +291,7 @@ func TestStartTwiceStop(t *testing.T) {
 			cancel()
 		}
 	}
-	a := NewAgent(TestProxy{run: start, cleanup: cleanup}, 0)
+	a := NewAgent(TestProxy{run: start, cleanup: cleanup}, 0, 0)
 	go func() { _ = a.Run(ctx) }()
 	a.Restart(desired0)
 	a.Restart(desired1)
@@ -315,7 +315,7 @@ func TestRecovery(t *testing.T) {
 		<-ctx.Done()
 		return nil
 	}
-	a := NewAgent(TestProxy{run: start}, 0)
+	a := NewAgent(TestProxy{run: start}, 0, 0)
 	go func() { _ = a.Run(ctx) }()
 	a.Restart(desired)
 
@@ -323,3 +323,35 @@ func TestRecovery(t *testing.T) {
 	<-time.After(100 * time.Millisecond)
 	cancel()
 }
+
+// TestTerminationServeDuration tests that the proxy keeps serving before draining on termination
+func TestTerminationServeDuration(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	drained := make(chan time.Time, 1)
+	start := func(config interface{}, epoch int, abort <-chan error) error {
+		if _, ok := config.(DrainConfig); ok {
+			drained <- time.Now()
+		}
+		<-abort
+		return nil
+	}
+	a := NewAgent(TestProxy{run: start}, 300*time.Millisecond, 100*time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		_ = a.Run(ctx)
+		close(done)
+	}()
+	a.Restart("config")
+
+	terminated := time.Now()
+	cancel()
+	select {
+	case at := <-drained:
+		if served := at.Sub(terminated); served < 100*time.Millisecond {
+			t.Errorf("drained after %v, want at least the serve duration", served)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the proxy was not drained")
+	}
+	<-done
+}
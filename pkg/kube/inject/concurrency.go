@@ -29,6 +29,15 @@ import (
 const (
 	// concurrencyCmdFlagName
 	concurrencyCmdFlagName = "concurrency"
+
+	// ProxyConcurrencyAnnotation sets the number of worker threads of the proxy of a workload,
+	// overriding the concurrency of the mesh proxy config. It is either a number of threads, 0
+	// meaning one per CPU core of the node, or ProxyConcurrencyAuto.
+	ProxyConcurrencyAnnotation = "proxy.istio.io/concurrency"
+
+	// ProxyConcurrencyAuto sizes the worker threads to the CPU limit of the proxy container, or
+	// its CPU request when there is no limit.
+	ProxyConcurrencyAuto = "auto"
 )
 
 var (
@@ -71,11 +80,72 @@ func extractConcurrency(sidecar *corev1.Container) int {
 	return 0
 }
 
+// ProxyConcurrency returns the worker threads of the injected proxy of the pod, 0 when it is not
+// bounded and the proxy runs one worker thread per CPU core of the node.
+func ProxyConcurrency(pod *corev1.Pod) int {
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == ProxyContainerName {
+			return extractConcurrency(&pod.Spec.Containers[i])
+		}
+	}
+	return 0
+}
+
+// validateConcurrency validates the value of the ProxyConcurrencyAnnotation.
+func validateConcurrency(value string) error {
+	if value == ProxyConcurrencyAuto {
+		return nil
+	}
+	if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+		return fmt.Errorf("must be %q or a number of threads", ProxyConcurrencyAuto)
+	}
+	return nil
+}
+
+// removeConcurrency removes the concurrency flag and its value from the sidecar container args.
+func removeConcurrency(sidecar *corev1.Container) {
+	args := make([]string, 0, len(sidecar.Args))
+	for i := 0; i < len(sidecar.Args); i++ {
+		match := concurrencyPattern.FindStringSubmatch(strings.TrimSpace(sidecar.Args[i]))
+		if match == nil {
+			args = append(args, sidecar.Args[i])
+			continue
+		}
+		if match[1] == "" {
+			// Skip the value in the next arg.
+			i++
+		}
+	}
+	sidecar.Args = args
+}
+
 // applyConcurrency changes sidecar containers' concurrency to equals the cpu cores of the container
 // if not set. It is inferred from the container's resource limit or request.
-func applyConcurrency(containers []corev1.Container) {
+// The ProxyConcurrencyAnnotation of the workload, if any, takes precedence over the concurrency of
+// the proxy config.
+func applyConcurrency(containers []corev1.Container, annotations map[string]string) {
 	for i, c := range containers {
 		if c.Name == ProxyContainerName {
+			if value, ok := annotations[ProxyConcurrencyAnnotation]; ok {
+				if value != ProxyConcurrencyAuto {
+					removeConcurrency(&containers[i])
+					if concurrency, err := strconv.Atoi(value); err == nil && concurrency > 0 {
+						containers[i].Args = append(containers[i].Args, fmt.Sprintf("--%s", concurrencyCmdFlagName), value)
+					}
+					return
+				}
+				// Keep the concurrency of the proxy config when the cpu is not bounded.
+				cpu := c.Resources.Limits.Cpu().MilliValue()
+				if cpu == 0 {
+					cpu = c.Resources.Requests.Cpu().MilliValue()
+				}
+				if cpu > 0 {
+					removeConcurrency(&containers[i])
+					updateConcurrency(&containers[i], cpu)
+				}
+				return
+			}
+
 			concurrency := extractConcurrency(&c)
 			// do not change it when it is already set
 			if concurrency > 0 {
@@ -25,6 +25,8 @@ import (
 func TestApplyConcurrency(t *testing.T) {
 	tests := []struct {
 		name string
+		// annotations of the workload.
+		annotations map[string]string
 		// containers before injection.
 		original []corev1.Container
 		// containers after injection.
@@ -260,13 +262,101 @@ func TestApplyConcurrency(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:        "annotation overrides --concurrency",
+			annotations: map[string]string{ProxyConcurrencyAnnotation: "8"},
+			original: []corev1.Container{
+				{
+					Name: "istio-proxy",
+					Args: []string{"--foo", "--concurrency", "2", "--bar"},
+				},
+			},
+			want: []corev1.Container{
+				{
+					Name: "istio-proxy",
+					Args: []string{"--foo", "--bar", "--concurrency", "8"},
+				},
+			},
+		},
+		{
+			name:        "annotation 0 uses all cores",
+			annotations: map[string]string{ProxyConcurrencyAnnotation: "0"},
+			original: []corev1.Container{
+				{
+					Name: "istio-proxy",
+					Args: []string{"--foo", "--concurrency=2"},
+				},
+			},
+			want: []corev1.Container{
+				{
+					Name: "istio-proxy",
+					Args: []string{"--foo"},
+				},
+			},
+		},
+		{
+			name:        "auto annotation sizes to cpu limit",
+			annotations: map[string]string{ProxyConcurrencyAnnotation: ProxyConcurrencyAuto},
+			original: []corev1.Container{
+				{
+					Name: "istio-proxy",
+					Args: []string{"--foo", "--concurrency", "2"},
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU: resource.MustParse("500m"),
+						},
+						Limits: corev1.ResourceList{
+							corev1.ResourceCPU: resource.MustParse("3500m"),
+						},
+					},
+				},
+			},
+			want: []corev1.Container{
+				{
+					Name: "istio-proxy",
+					Args: []string{"--foo", "--concurrency", "4"},
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU: resource.MustParse("500m"),
+						},
+						Limits: corev1.ResourceList{
+							corev1.ResourceCPU: resource.MustParse("3500m"),
+						},
+					},
+				},
+			},
+		},
+		{
+			name:        "auto annotation without cpu keeps --concurrency",
+			annotations: map[string]string{ProxyConcurrencyAnnotation: ProxyConcurrencyAuto},
+			original: []corev1.Container{
+				{
+					Name: "istio-proxy",
+					Args: []string{"--foo", "--concurrency", "2"},
+				},
+			},
+			want: []corev1.Container{
+				{
+					Name: "istio-proxy",
+					Args: []string{"--foo", "--concurrency", "2"},
+				},
+			},
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			applyConcurrency(tc.original)
+			applyConcurrency(tc.original, tc.annotations)
 			if !reflect.DeepEqual(tc.original, tc.want) {
 				t.Errorf("[%v] failed, want %+v, got %+v", tc.name, tc.want, tc.original)
 			}
 		})
 	}
 }
+
+func TestValidateConcurrency(t *testing.T) {
+	for value, valid := range map[string]bool{"auto": true, "0": true, "4": true, "-1": false, "two": false, "": false} {
+		if err := validateConcurrency(value); (err == nil) != valid {
+			t.Errorf("validateConcurrency(%q) got error %v, want valid %v", value, err, valid)
+		}
+	}
+}
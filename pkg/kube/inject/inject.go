@@ -86,9 +86,20 @@ var (
 		annotation.SidecarTrafficExcludeInboundPorts.Name:         ValidateExcludeInboundPorts,
 		annotation.SidecarTrafficExcludeOutboundPorts.Name:        ValidateExcludeOutboundPorts,
 		annotation.SidecarTrafficKubevirtInterfaces.Name:          alwaysValidFunc,
+		ProxyConcurrencyAnnotation:                                validateConcurrency,
+		TerminationDrainDurationAnnotation:                        validateUInt32,
+		TerminationServeDurationAnnotation:                        validateUInt32,
 	}
 )
 
+const (
+	// TerminationDrainDurationAnnotation sets the seconds the proxy keeps running after the pod is deleted.
+	TerminationDrainDurationAnnotation = "sidecar.istio.io/terminationDrainDurationSeconds"
+	// TerminationServeDurationAnnotation sets the first part of the drain duration during which the proxy keeps
+	// serving new connections, while the other proxies receive the removal of the pod from the endpoints.
+	TerminationServeDurationAnnotation = "sidecar.istio.io/terminationServeDurationSeconds"
+)
+
 func validateAnnotations(annotations map[string]string) (err error) {
 	for name, value := range annotations {
 		if v, ok := annotationRegistry[name]; ok {
@@ -604,7 +615,7 @@ func InjectionData(sidecarTemplate, valuesConfig, version string, typeMetadata *
 	}
 
 	// set sidecar --concurrency
-	applyConcurrency(sic.Containers)
+	applyConcurrency(sic.Containers, metadata.GetAnnotations())
 
 	status := &SidecarInjectionStatus{Version: version}
 	for _, c := range sic.InitContainers {
@@ -23,6 +23,7 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/cobra/doc"
+	certclient "k8s.io/client-go/kubernetes/typed/certificates/v1beta1"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -53,6 +54,9 @@ const (
 	selfSignedRootCertGracePeriodPercentile = "CITADEL_SELF_SIGNED_ROOT_CERT_GRACE_PERIOD_PERCENTILE"
 	workloadCertMinGracePeriod              = "CITADEL_WORKLOAD_CERT_MIN_GRACE_PERIOD"
 	enableJitterForRootCertRotator          = "CITADEL_ENABLE_JITTER_FOR_ROOT_CERT_ROTATOR"
+
+	// The CA certificate of the Kubernetes cluster, which must not be the root of the Kubernetes CSR signer.
+	kubeCACertFile = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
 )
 
 type cliOptions struct { // nolint: maligned
@@ -123,6 +127,24 @@ type cliOptions struct { // nolint: maligned
 
 	// Whether SDS is enabled on.
 	sdsEnabled bool
+
+	// CSR approval policies, applied to every certificate signed by the gRPC server.
+	// Comma separated identities and namespaces for which certificates are never issued.
+	csrDeniedIdentities string
+	csrDeniedNamespaces string
+	// Comma separated regular expressions, one of which every issued identity must match.
+	csrIdentityPatterns string
+	// Maximum number of certificates issued per namespace in csrNamespaceQuotaWindow. 0 disables the quota.
+	csrNamespaceQuota       int
+	csrNamespaceQuotaWindow time.Duration
+	// URL of an external service approving CSRs.
+	csrApprovalWebhook        string
+	csrApprovalWebhookTimeout time.Duration
+
+	// If set, the workload certificates are signed by this signer through the Kubernetes CSR API, instead of
+	// by the Citadel signing key.
+	kubeCSRSignerName    string
+	kubeCSRSignerTimeout time.Duration
 }
 
 var (
@@ -276,6 +298,32 @@ func initCLI() {
 
 	flags.BoolVar(&opts.sdsEnabled, "sds-enabled", false, "Whether SDS is enabled.")
 
+	// CSR approval
+	flags.StringVar(&opts.csrDeniedIdentities, "csr-denied-identities", "",
+		"The list of identities Citadel never issues certificates for, separated by comma.")
+	flags.StringVar(&opts.csrDeniedNamespaces, "csr-denied-namespaces", "",
+		"The list of namespaces Citadel never issues certificates for, separated by comma.")
+	flags.StringVar(&opts.csrIdentityPatterns, "csr-identity-patterns", "",
+		"The list of regular expressions, separated by comma, one of which every identity in an issued certificate "+
+			"must fully match. If empty, any identity is allowed.")
+	flags.IntVar(&opts.csrNamespaceQuota, "csr-namespace-quota", 0,
+		"The maximum number of certificates issued per namespace in --csr-namespace-quota-window. 0 disables the quota.")
+	flags.DurationVar(&opts.csrNamespaceQuotaWindow, "csr-namespace-quota-window", time.Minute,
+		"The time window of --csr-namespace-quota.")
+	flags.StringVar(&opts.csrApprovalWebhook, "csr-approval-webhook", "",
+		"The URL of an external service approving certificate signing requests. If empty, no webhook is called.")
+	flags.DurationVar(&opts.csrApprovalWebhookTimeout, "csr-approval-webhook-timeout", 5*time.Second,
+		"The timeout of calls to --csr-approval-webhook. Requests are denied on timeout.")
+
+	// Signing through the Kubernetes CSR API
+	flags.StringVar(&opts.kubeCSRSignerName, "k8s-csr-signer-name", "",
+		"When set, the workload certificates are signed through the certificates.k8s.io API by the signer, recorded "+
+			"in the "+ca.SignerNameAnnotation+" annotation of the CSRs, instead of by Citadel. The signer must be a "+
+			"dedicated CA approving the CSRs, whose root certificate, distinct from the Kubernetes cluster CA, is read "+
+			"from '--root-cert'. The '--self-signed-ca', '--signing-cert' and '--signing-key' options are ignored.")
+	flags.DurationVar(&opts.kubeCSRSignerTimeout, "k8s-csr-signer-timeout", 30*time.Second,
+		"The maximum time waiting for a CSR to be signed by '--k8s-csr-signer-name'.")
+
 	rootCmd.AddCommand(version.CobraCommand())
 
 	rootCmd.AddCommand(collateral.CobraCommand(rootCmd, &doc.GenManHeader{
@@ -305,6 +353,40 @@ func main() {
 	}
 }
 
+// addCSRApprovers configures the CSR approval policies of the CA server from the command line options.
+func addCSRApprovers(caServer *caserver.Server) error {
+	if opts.csrDeniedIdentities != "" || opts.csrDeniedNamespaces != "" {
+		caServer.AddApprover(&caserver.DenyListApprover{
+			Identities: splitNonEmpty(opts.csrDeniedIdentities),
+			Namespaces: splitNonEmpty(opts.csrDeniedNamespaces),
+		})
+	}
+	if opts.csrIdentityPatterns != "" {
+		approver, err := caserver.NewIdentityPatternApprover(splitNonEmpty(opts.csrIdentityPatterns))
+		if err != nil {
+			return err
+		}
+		caServer.AddApprover(approver)
+	}
+	if opts.csrNamespaceQuota > 0 {
+		caServer.AddApprover(caserver.NewNamespaceQuotaApprover(opts.csrNamespaceQuota, opts.csrNamespaceQuotaWindow))
+	}
+	if opts.csrApprovalWebhook != "" {
+		caServer.AddApprover(caserver.NewWebhookApprover(opts.csrApprovalWebhook, opts.csrApprovalWebhookTimeout))
+	}
+	return nil
+}
+
+func splitNonEmpty(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
 // fqdn returns the k8s cluster dns name for the Citadel service.
 func fqdn() string {
 	return fmt.Sprintf("istio-citadel.%v.svc.cluster.local", opts.istioCaStorageNamespace)
@@ -342,7 +424,12 @@ func runCA() {
 	if err != nil {
 		fatalf("Could not create k8s clientset: %v", err)
 	}
-	ca := createCA(cs.CoreV1())
+	var ca caserver.CertificateAuthority
+	if opts.kubeCSRSignerName != "" {
+		ca = createKubeCSRSigner(cs.CertificatesV1beta1().CertificateSigningRequests())
+	} else {
+		ca = createCA(cs.CoreV1())
+	}
 
 	stopCh := make(chan struct{})
 	if !opts.serverOnly {
@@ -392,6 +479,9 @@ func runCA() {
 		if startErr != nil {
 			fatalf("Failed to create istio ca server: %v", startErr)
 		}
+		if err := addCSRApprovers(caServer); err != nil {
+			fatalf("Failed to configure CSR approval: %v", err)
+		}
 		if serverErr := caServer.Run(); serverErr != nil {
 			// stop the registry-related controllers
 			ch <- struct{}{}
@@ -510,7 +600,27 @@ func createCA(client corev1.CoreV1Interface) *ca.IstioCA {
 	return istioCA
 }
 
+func createKubeCSRSigner(client certclient.CertificateSigningRequestInterface) *ca.KubeCSRSigner {
+	log.Infof("Use the Kubernetes CSR API to sign the workload certificates by %s", opts.kubeCSRSignerName)
+	spiffe.SetTrustDomain(spiffe.DetermineTrustDomain(opts.trustDomain, true))
+	signer, err := ca.NewKubeCSRSigner(client, opts.kubeCSRSignerName, opts.rootCertFile, kubeCACertFile,
+		opts.kubeCSRSignerTimeout)
+	if err != nil {
+		fatalf("Failed to create the Kubernetes CSR signer (error: %v)", err)
+	}
+	return signer
+}
+
 func verifyCommandLineOptions() {
+	if opts.kubeCSRSignerName != "" {
+		if opts.cAClientConfig.CAAddress != "" {
+			fatalf("'--k8s-csr-signer-name' cannot be used with '--upstream-ca-address'")
+		}
+		if opts.rootCertFile == "" {
+			fatalf("'--k8s-csr-signer-name' requires the root certificate of the signer in '--root-cert'")
+		}
+		return
+	}
 	if opts.selfSignedCA {
 		return
 	}
@@ -28,6 +28,7 @@ import (
 
 	"istio.io/istio/pkg/cmd"
 	"istio.io/istio/security/pkg/nodeagent/cache"
+	"istio.io/istio/security/pkg/nodeagent/plugin"
 	"istio.io/istio/security/pkg/nodeagent/sds"
 	"istio.io/istio/security/pkg/nodeagent/secretfetcher"
 	"istio.io/istio/security/pkg/server/monitoring"
@@ -106,6 +107,17 @@ const (
 	SecretRefreshGraceDuration     = "SECRET_GRACE_DURATION"
 	secretRefreshGraceDurationFlag = "secretRefreshGraceDuration"
 
+	// The environmental variable name for the per namespace or service account secret TTL and grace
+	// duration, overriding SECRET_TTL and SECRET_GRACE_DURATION.
+	// example value format like "secure=1h:15m,default/legacy=48h"
+	SecretRotationPolicies     = "SECRET_ROTATION_POLICIES"
+	secretRotationPoliciesFlag = "secretRotationPolicies"
+
+	// The environmental variable name for the maximum random duration secrets are refreshed early by.
+	// example value format like "5m"
+	SecretRotationJitter     = "SECRET_ROTATION_JITTER"
+	secretRotationJitterFlag = "secretRotationJitter"
+
 	// The environmental variable name for key rotation job running interval.
 	// example value format like "20m"
 	SecretRotationInterval     = "SECRET_JOB_RUN_INTERVAL"
@@ -130,6 +142,7 @@ var (
 	gatewaySdsCacheOptions  cache.Options
 	serverOptions           sds.Options
 	gatewaySecretChan       chan struct{}
+	secretRotationPolicies  string
 	loggingOptions          = log.DefaultOptions()
 	ctrlzOptions            = ctrlz.DefaultOptions()
 	// rootCmd defines the command for node agent.
@@ -149,6 +162,13 @@ var (
 				return err
 			}
 
+			policies, err := cache.ParseRotationPolicies(secretRotationPolicies,
+				workloadSdsCacheOptions.SecretRefreshGraceDuration, workloadSdsCacheOptions.RotationJitter)
+			if err != nil {
+				return err
+			}
+			workloadSdsCacheOptions.RotationPolicies = policies
+
 			stop := make(chan struct{})
 
 			workloadSecretCache, gatewaySecretCache := newSecretCache(serverOptions)
@@ -246,6 +266,8 @@ var (
 	secretTTLEnv                       = env.RegisterDurationVar(secretTTL, 24*time.Hour, "").Get()
 	secretRefreshGraceDurationEnv      = env.RegisterDurationVar(SecretRefreshGraceDuration, 1*time.Hour, "").Get()
 	secretRotationIntervalEnv          = env.RegisterDurationVar(SecretRotationInterval, 10*time.Minute, "").Get()
+	secretRotationPoliciesEnv          = env.RegisterStringVar(SecretRotationPolicies, "", "").Get()
+	secretRotationJitterEnv            = env.RegisterDurationVar(SecretRotationJitter, 0, "").Get()
 	staledConnectionRecycleIntervalEnv = env.RegisterDurationVar(staledConnectionRecycleInterval, 5*time.Minute, "").Get()
 	initialBackoffEnv                  = env.RegisterIntVar(InitialBackoff, 10, "").Get()
 	monitoringPortEnv                  = env.RegisterIntVar(MonitoringPort, 15014,
@@ -317,6 +339,14 @@ func applyEnvVars(cmd *cobra.Command) {
 		workloadSdsCacheOptions.RotationInterval = secretRotationIntervalEnv
 	}
 
+	if !cmd.Flag(secretRotationPoliciesFlag).Changed {
+		secretRotationPolicies = secretRotationPoliciesEnv
+	}
+
+	if !cmd.Flag(secretRotationJitterFlag).Changed {
+		workloadSdsCacheOptions.RotationJitter = secretRotationJitterEnv
+	}
+
 	if !cmd.Flag(skipValidateCertFlag).Changed {
 		workloadSdsCacheOptions.SkipValidateCert = skipValidateCertFlagEnv
 	}
@@ -343,6 +373,17 @@ func validateOptions() error {
 		return fmt.Errorf("UDS paths for ingress gateway and workload cannot be the same: %s", serverOptions.IngressGatewayUDSPath)
 	}
 
+	// Secrets are refreshed up to the jitter earlier than their grace duration requires.
+	jitter := workloadSdsCacheOptions.RotationJitter
+	if jitter < 0 {
+		return fmt.Errorf("secret rotation jitter cannot be negative, found: %v", jitter)
+	}
+	grace, ttl := workloadSdsCacheOptions.SecretRefreshGraceDuration, workloadSdsCacheOptions.SecretTTL
+	if grace+jitter >= ttl {
+		return fmt.Errorf("secret refresh grace duration %v plus rotation jitter %v must be shorter than the secret TTL %v",
+			grace, jitter, ttl)
+	}
+
 	if serverOptions.EnableWorkloadSDS {
 		if serverOptions.CAProviderName == "" {
 			return fmt.Errorf("CA provider cannot be empty when workload SDS is enabled")
@@ -375,6 +416,15 @@ func main() {
 	rootCmd.PersistentFlags().StringArrayVar(&serverOptions.PluginNames, pluginNamesFlag,
 		[]string{}, "authentication provider specific plugin names")
 
+	rootCmd.PersistentFlags().StringVar(&serverOptions.CloudCredentialUDSPath, "cloudCredentialUDSPath", "",
+		"Unix domain socket through which workloads exchange their token for cloud credentials, "+
+			"using the cloudCredentialPlugin. Disabled if empty.")
+	rootCmd.PersistentFlags().StringVar(&serverOptions.CloudCredentialPlugin, "cloudCredentialPlugin", "",
+		"Token exchange plugin of the cloud credentials, "+plugin.GoogleTokenExchange+" or "+plugin.AWSTokenExchange+
+			". It is not used for the workload certificates.")
+	rootCmd.PersistentFlags().IntVar(&serverOptions.CloudCredentialUDSGroup, "cloudCredentialUDSGroup", -1,
+		"Group ID allowed to access cloudCredentialUDSPath. Only the user of the agent can access it if negative.")
+
 	rootCmd.PersistentFlags().StringVar(&serverOptions.CertFile, "sdsCertFile", "", "SDS gRPC TLS server-side certificate")
 	rootCmd.PersistentFlags().StringVar(&serverOptions.KeyFile, "sdsKeyFile", "", "SDS gRPC TLS server-side key")
 
@@ -385,6 +435,12 @@ func main() {
 	rootCmd.PersistentFlags().DurationVar(&workloadSdsCacheOptions.RotationInterval, secretRotationIntervalFlag,
 		10*time.Minute, "Secret rotation job running interval")
 
+	rootCmd.PersistentFlags().StringVar(&secretRotationPolicies, secretRotationPoliciesFlag, "",
+		"Secret TTL and refresh grace duration per namespace or service account, overriding --secretTtl and "+
+			"--secretRefreshGraceDuration. Format: <namespace>[/<service account>]=<ttl>[:<grace>], separated by comma.")
+	rootCmd.PersistentFlags().DurationVar(&workloadSdsCacheOptions.RotationJitter, secretRotationJitterFlag, 0,
+		"Maximum random duration by which secrets are refreshed earlier than their grace duration requires")
+
 	rootCmd.PersistentFlags().Int64Var(&workloadSdsCacheOptions.InitialBackoff, InitialBackoffFlag, 10,
 		"The initial backoff interval in milliseconds, must be within the range [10, 120000]")
 
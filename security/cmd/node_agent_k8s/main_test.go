@@ -17,6 +17,7 @@ package main
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"istio.io/istio/security/pkg/nodeagent/cache"
 	"istio.io/istio/security/pkg/nodeagent/sds"
@@ -53,6 +54,13 @@ func TestValidateOptions(t *testing.T) {
 			},
 			errorMsg: "UDS paths for ingress gateway and workload cannot be the same",
 		},
+		{
+			name: "rotation jitter too large",
+			setExtraOptions: func() {
+				workloadSdsCacheOptions.RotationJitter = 23 * time.Hour
+			},
+			errorMsg: "secret refresh grace duration 1h0m0s plus rotation jitter 23h0m0s must be shorter than the secret TTL",
+		},
 		{
 			name: "empty CA provider when workload SDS enabled",
 			setExtraOptions: func() {
@@ -73,7 +81,9 @@ func TestValidateOptions(t *testing.T) {
 
 		// Set the valid options as the base for the testing.
 		workloadSdsCacheOptions = cache.Options{
-			InitialBackoff: 10,
+			InitialBackoff:             10,
+			SecretTTL:                  24 * time.Hour,
+			SecretRefreshGraceDuration: time.Hour,
 		}
 		serverOptions = sds.Options{
 			EnableIngressGatewaySDS: true,
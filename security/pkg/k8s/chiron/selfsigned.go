@@ -0,0 +1,380 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chiron
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	admissionv1 "k8s.io/client-go/kubernetes/typed/admissionregistration/v1beta1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/pkg/log"
+)
+
+/* #nosec: disable gas linter */
+const (
+	// The Istio self-signed CA secret type
+	IstioSelfSignedCASecretType = "istio.io/self-signed-ca"
+
+	// The keys of the root certificate and private key in the self-signed CA secret.
+	selfSignedCACertID = "ca-cert.pem"
+	selfSignedCAKeyID  = "ca-key.pem"
+	// The key of the root certificate replaced by the last rotation, still trusted until it expires.
+	selfSignedPreviousCACertID = "previous-ca-cert.pem"
+
+	selfSignedOrg = "Istio self-signed"
+
+	defaultSelfSignedCheckInterval = time.Minute
+
+	// The names of the files the self-signed key, certificate chain and root certificates are written to,
+	// distinct from the ones of the SPIFFE certificates so that they never replace them.
+	SelfSignedCertChainFile = "self-signed-cert-chain.pem"
+	SelfSignedRootCertFile  = "self-signed-root-cert.pem"
+	SelfSignedKeyFile       = "self-signed-key.pem"
+)
+
+// SelfSignedOptions configure a SelfSignedController.
+type SelfSignedOptions struct {
+	// Namespace and SecretName locate the secret holding the root CA, shared by the replicas.
+	Namespace  string
+	SecretName string
+	// DNSNames are the subject alternative names of the serving certificate.
+	DNSNames []string
+	// CertDir is the directory the key, certificate chain and root certificates are written to, if set.
+	CertDir string
+	// RootTTL and CertTTL are the lifetimes of the root and the serving certificates.
+	RootTTL time.Duration
+	CertTTL time.Duration
+	// Certificates are rotated once in their grace period, the ratio of their lifetime before expiry,
+	// and no later than MinGracePeriod before expiry.
+	GracePeriodRatio float32
+	MinGracePeriod   time.Duration
+	// CheckInterval is the period at which the certificates are checked, one minute by default.
+	CheckInterval time.Duration
+	// MutatingWebhooks and ValidatingWebhooks are the names of the webhook configurations
+	// the caBundle of every webhook is kept in sync with the root certificates in.
+	MutatingWebhooks   []string
+	ValidatingWebhooks []string
+}
+
+// SelfSignedController provisions and rotates a serving certificate for DNS names, signed by a self-signed
+// root CA it also rotates, and patches the caBundle of webhook configurations with the root certificates.
+// It doesn't depend on the Kubernetes CA, unlike the WebhookController.
+type SelfSignedController struct {
+	opts      SelfSignedOptions
+	core      corev1.CoreV1Interface
+	admission admissionv1.AdmissionregistrationV1beta1Interface
+
+	mutex sync.RWMutex
+	cert  *tls.Certificate
+	leaf  *x509.Certificate
+	// The PEM encoded root certificates trusted by clients, the current one first.
+	caBundle []byte
+}
+
+// NewSelfSignedController returns a pointer to a newly constructed SelfSignedController instance.
+func NewSelfSignedController(opts SelfSignedOptions, core corev1.CoreV1Interface,
+	admission admissionv1.AdmissionregistrationV1beta1Interface) (*SelfSignedController, error) {
+	if len(opts.DNSNames) == 0 {
+		return nil, fmt.Errorf("no DNS names to provision a certificate for")
+	}
+	if opts.SecretName == "" || opts.Namespace == "" {
+		return nil, fmt.Errorf("the name and namespace of the CA secret must be set")
+	}
+	if opts.GracePeriodRatio < 0 || opts.GracePeriodRatio > 1 {
+		return nil, fmt.Errorf("grace period ratio %f should be within [0, 1]", opts.GracePeriodRatio)
+	}
+	if opts.RootTTL <= 0 || opts.CertTTL <= 0 {
+		return nil, fmt.Errorf("the root and certificate TTLs must be positive")
+	}
+	if opts.CertTTL > opts.RootTTL {
+		log.Warnf("certificate TTL %v exceeds root TTL %v, certificates will expire with the root",
+			opts.CertTTL, opts.RootTTL)
+	}
+	if opts.CheckInterval <= 0 {
+		opts.CheckInterval = defaultSelfSignedCheckInterval
+	}
+	return &SelfSignedController{
+		opts:      opts,
+		core:      core,
+		admission: admission,
+	}, nil
+}
+
+// Run checks the certificates periodically until stopCh is notified.
+func (c *SelfSignedController) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(c.opts.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if err := c.Reconcile(); err != nil {
+				log.Errorf("failed to reconcile self-signed certificates: %v", err)
+			}
+		}
+	}
+}
+
+// Reconcile creates or rotates the root CA and the serving certificate when needed,
+// and patches the webhook configurations with the root certificates.
+func (c *SelfSignedController) Reconcile() error {
+	caCert, caKey, caBundle, err := c.ensureRoot()
+	if err != nil {
+		return fmt.Errorf("failed to get the root CA: %v", err)
+	}
+
+	c.mutex.RLock()
+	leaf := c.leaf
+	c.mutex.RUnlock()
+	if leaf == nil || c.inGracePeriod(leaf) || leaf.CheckSignatureFrom(caCert) != nil {
+		if err := c.issueCert(caCert, caKey, caBundle); err != nil {
+			return fmt.Errorf("failed to issue the certificate: %v", err)
+		}
+	} else {
+		c.mutex.Lock()
+		c.caBundle = caBundle
+		c.mutex.Unlock()
+	}
+
+	return c.patchWebhooks(caBundle)
+}
+
+// GetCertificate returns the current serving certificate, for tls.Config.
+func (c *SelfSignedController) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.cert == nil {
+		return nil, fmt.Errorf("no certificate provisioned yet")
+	}
+	return c.cert, nil
+}
+
+// CABundle returns the PEM encoded root certificates trusted by clients, the current one first.
+func (c *SelfSignedController) CABundle() []byte {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return append([]byte(nil), c.caBundle...)
+}
+
+// ensureRoot reads the root CA from its secret, creating or rotating it first if needed.
+func (c *SelfSignedController) ensureRoot() (*x509.Certificate, interface{}, []byte, error) {
+	secrets := c.core.Secrets(c.opts.Namespace)
+	scrt, err := secrets.Get(c.opts.SecretName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		scrt = &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: c.opts.SecretName, Namespace: c.opts.Namespace},
+			Data:       map[string][]byte{},
+			Type:       IstioSelfSignedCASecretType,
+		}
+		if err = c.rotateRoot(scrt); err != nil {
+			return nil, nil, nil, err
+		}
+		created, err := secrets.Create(scrt)
+		if errors.IsAlreadyExists(err) {
+			// Another replica created the root CA first.
+			created, err = secrets.Get(c.opts.SecretName, metav1.GetOptions{})
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		log.Infof("created self-signed root CA in secret %s/%s", c.opts.Namespace, c.opts.SecretName)
+		scrt = created
+	case err != nil:
+		return nil, nil, nil, err
+	default:
+		cert, err := util.ParsePemEncodedCertificate(scrt.Data[selfSignedCACertID])
+		if err != nil || c.inGracePeriod(cert) {
+			if err = c.rotateRoot(scrt); err != nil {
+				return nil, nil, nil, err
+			}
+			// A conflict means another replica rotated the root CA, which is picked up at the next check.
+			if scrt, err = secrets.Update(scrt); err != nil {
+				return nil, nil, nil, err
+			}
+			log.Infof("rotated self-signed root CA in secret %s/%s", c.opts.Namespace, c.opts.SecretName)
+		}
+	}
+
+	cert, err := util.ParsePemEncodedCertificate(scrt.Data[selfSignedCACertID])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	key, err := util.ParsePemEncodedKey(scrt.Data[selfSignedCAKeyID])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	caBundle := append([]byte(nil), scrt.Data[selfSignedCACertID]...)
+	if previous, err := util.ParsePemEncodedCertificate(scrt.Data[selfSignedPreviousCACertID]); err == nil &&
+		time.Now().Before(previous.NotAfter) {
+		// Clients keep trusting the previous root until the certificates it signed expired.
+		caBundle = append(caBundle, scrt.Data[selfSignedPreviousCACertID]...)
+	}
+	return cert, key, caBundle, nil
+}
+
+// rotateRoot generates a new root CA in the secret, keeping the current one as the previous one.
+func (c *SelfSignedController) rotateRoot(scrt *v1.Secret) error {
+	certPEM, keyPEM, err := util.GenCertKeyFromOptions(util.CertOptions{
+		TTL:          c.opts.RootTTL,
+		Org:          selfSignedOrg,
+		IsCA:         true,
+		IsSelfSigned: true,
+		RSAKeySize:   keySize,
+	})
+	if err != nil {
+		return err
+	}
+	if scrt.Data == nil {
+		scrt.Data = map[string][]byte{}
+	}
+	if current, ok := scrt.Data[selfSignedCACertID]; ok {
+		scrt.Data[selfSignedPreviousCACertID] = current
+	}
+	scrt.Data[selfSignedCACertID] = certPEM
+	scrt.Data[selfSignedCAKeyID] = keyPEM
+	return nil
+}
+
+// issueCert issues a new serving certificate signed by the root CA, and writes it to the certificate directory.
+func (c *SelfSignedController) issueCert(caCert *x509.Certificate, caKey interface{}, caBundle []byte) error {
+	certPEM, keyPEM, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Host:       strings.Join(c.opts.DNSNames, ","),
+		TTL:        c.opts.CertTTL,
+		SignerCert: caCert,
+		SignerPriv: caKey,
+		Org:        selfSignedOrg,
+		IsServer:   true,
+		RSAKeySize: keySize,
+	})
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	leaf, err := util.ParsePemEncodedCertificate(certPEM)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	c.cert = &cert
+	c.leaf = leaf
+	c.caBundle = caBundle
+	c.mutex.Unlock()
+	log.Infof("issued self-signed certificate for %v, expiring at %v", c.opts.DNSNames, leaf.NotAfter)
+
+	if c.opts.CertDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(c.opts.CertDir, 0700); err != nil {
+		return err
+	}
+	files := []struct {
+		name string
+		data []byte
+		perm os.FileMode
+	}{
+		{SelfSignedCertChainFile, certPEM, 0644},
+		{SelfSignedRootCertFile, caBundle, 0644},
+		{SelfSignedKeyFile, keyPEM, 0600},
+	}
+	for _, f := range files {
+		if err := ioutil.WriteFile(path.Join(c.opts.CertDir, f.name), f.data, f.perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patchWebhooks sets the caBundle of all the webhooks of the configured webhook configurations.
+func (c *SelfSignedController) patchWebhooks(caBundle []byte) error {
+	var errs error
+	mutating := c.admission.MutatingWebhookConfigurations()
+	for _, name := range c.opts.MutatingWebhooks {
+		config, err := mutating.Get(name, metav1.GetOptions{})
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("mutating webhook configuration %s: %v", name, err))
+			continue
+		}
+		updated := false
+		for i := range config.Webhooks {
+			if !bytes.Equal(config.Webhooks[i].ClientConfig.CABundle, caBundle) {
+				config.Webhooks[i].ClientConfig.CABundle = caBundle
+				updated = true
+			}
+		}
+		if updated {
+			if _, err := mutating.Update(config); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("mutating webhook configuration %s: %v", name, err))
+				continue
+			}
+			log.Infof("patched caBundle of mutating webhook configuration %s", name)
+		}
+	}
+
+	validating := c.admission.ValidatingWebhookConfigurations()
+	for _, name := range c.opts.ValidatingWebhooks {
+		config, err := validating.Get(name, metav1.GetOptions{})
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("validating webhook configuration %s: %v", name, err))
+			continue
+		}
+		updated := false
+		for i := range config.Webhooks {
+			if !bytes.Equal(config.Webhooks[i].ClientConfig.CABundle, caBundle) {
+				config.Webhooks[i].ClientConfig.CABundle = caBundle
+				updated = true
+			}
+		}
+		if updated {
+			if _, err := validating.Update(config); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("validating webhook configuration %s: %v", name, err))
+				continue
+			}
+			log.Infof("patched caBundle of validating webhook configuration %s", name)
+		}
+	}
+	return errs
+}
+
+// inGracePeriod returns whether the certificate is about to expire and should be rotated.
+func (c *SelfSignedController) inGracePeriod(cert *x509.Certificate) bool {
+	certLifeTime := cert.NotAfter.Sub(cert.NotBefore)
+	// Because time.Duration only takes int type, multiply gracePeriodRatio by 1000 and then divide it.
+	gracePeriod := time.Duration(c.opts.GracePeriodRatio*1000) * certLifeTime / 1000
+	if gracePeriod < c.opts.MinGracePeriod {
+		gracePeriod = c.opts.MinGracePeriod
+	}
+	return time.Until(cert.NotAfter) < gracePeriod
+}
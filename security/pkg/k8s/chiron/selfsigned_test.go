@@ -0,0 +1,176 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chiron
+
+import (
+	"bytes"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"k8s.io/api/admissionregistration/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSelfSignedController(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&v1beta1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "istio-sidecar-injector"},
+			Webhooks:   []v1beta1.MutatingWebhook{{Name: "sidecar-injector.istio.io"}},
+		},
+		&v1beta1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "istio-galley"},
+			Webhooks:   []v1beta1.ValidatingWebhook{{Name: "pilot.validation.istio.io"}, {Name: "mixer.validation.istio.io"}},
+		},
+	)
+	certDir, err := ioutil.TempDir("", "self-signed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(certDir)
+	opts := SelfSignedOptions{
+		Namespace:          "istio-system",
+		SecretName:         "istio-self-signed-ca",
+		DNSNames:           []string{"istio-pilot.istio-system.svc", "istio-pilot.istio-system.svc.cluster.local"},
+		CertDir:            certDir,
+		RootTTL:            24 * time.Hour,
+		CertTTL:            time.Hour,
+		GracePeriodRatio:   0.5,
+		MutatingWebhooks:   []string{"istio-sidecar-injector"},
+		ValidatingWebhooks: []string{"istio-galley"},
+	}
+	c, err := NewSelfSignedController(opts, client.CoreV1(), client.AdmissionregistrationV1beta1())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Reconcile(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The certificate is valid for the DNS names against the root certificate of the webhooks.
+	cert, err := c.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutating, err := client.AdmissionregistrationV1beta1().MutatingWebhookConfigurations().Get(
+		"istio-sidecar-injector", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caBundle := mutating.Webhooks[0].ClientConfig.CABundle
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caBundle) {
+		t.Fatalf("invalid caBundle %q", caBundle)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range opts.DNSNames {
+		if _, err := leaf.Verify(x509.VerifyOptions{DNSName: name, Roots: roots}); err != nil {
+			t.Errorf("certificate not valid for %s: %v", name, err)
+		}
+	}
+	validating, err := client.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Get(
+		"istio-galley", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range validating.Webhooks {
+		if !bytes.Equal(w.ClientConfig.CABundle, caBundle) {
+			t.Errorf("caBundle of webhook %s not patched", w.Name)
+		}
+	}
+	for _, name := range []string{SelfSignedCertChainFile, SelfSignedRootCertFile, SelfSignedKeyFile} {
+		if _, err := os.Stat(path.Join(certDir, name)); err != nil {
+			t.Errorf("file %s not written: %v", name, err)
+		}
+	}
+
+	// The certificate is kept until its grace period.
+	if err := c.Reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	if same, _ := c.GetCertificate(nil); same != cert {
+		t.Errorf("certificate rotated before its grace period")
+	}
+
+	// Another replica shares the root CA.
+	replica, err := NewSelfSignedController(opts, client.CoreV1(), client.AdmissionregistrationV1beta1())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.Reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(replica.CABundle(), caBundle) {
+		t.Errorf("replica root CA differs")
+	}
+
+	// Rotating the root CA reissues the certificate and keeps trusting the previous root.
+	rotating := opts
+	rotating.MinGracePeriod = 48 * time.Hour
+	r, err := NewSelfSignedController(rotating, client.CoreV1(), client.AdmissionregistrationV1beta1())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	rotated := r.CABundle()
+	if !bytes.HasSuffix(rotated, caBundle) || bytes.Equal(rotated, caBundle) {
+		t.Errorf("rotated caBundle should hold the new and the previous roots")
+	}
+	mutating, err = client.AdmissionregistrationV1beta1().MutatingWebhookConfigurations().Get(
+		"istio-sidecar-injector", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(mutating.Webhooks[0].ClientConfig.CABundle, rotated) {
+		t.Errorf("caBundle not patched after the root rotation")
+	}
+}
+
+func TestNewSelfSignedControllerErrors(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	valid := SelfSignedOptions{
+		Namespace:        "istio-system",
+		SecretName:       "istio-self-signed-ca",
+		DNSNames:         []string{"istio-pilot.istio-system.svc"},
+		RootTTL:          time.Hour,
+		CertTTL:          time.Hour,
+		GracePeriodRatio: 0.5,
+	}
+	cases := map[string]func(*SelfSignedOptions){
+		"no DNS names":  func(o *SelfSignedOptions) { o.DNSNames = nil },
+		"no secret":     func(o *SelfSignedOptions) { o.SecretName = "" },
+		"invalid ratio": func(o *SelfSignedOptions) { o.GracePeriodRatio = 2 },
+		"no TTL":        func(o *SelfSignedOptions) { o.CertTTL = 0 },
+		"negative root": func(o *SelfSignedOptions) { o.RootTTL = -time.Hour },
+	}
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			opts := valid
+			mutate(&opts)
+			if _, err := NewSelfSignedController(opts, client.CoreV1(), client.AdmissionregistrationV1beta1()); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
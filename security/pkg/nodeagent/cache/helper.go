@@ -25,9 +25,24 @@ import (
 
 func constructCSRHostName(trustDomain, token string) (string, error) {
 	// If token is jwt format, construct host name from jwt with format like spiffe://cluster.local/ns/foo/sa/sleep,
+	ns, sa, err := k8sServiceAccount(token)
+	if err != nil {
+		return "", err
+	}
+
+	domain := "cluster.local"
+	if trustDomain != "" {
+		domain = trustDomain
+	}
+
+	return fmt.Sprintf(identityTemplate, domain, ns, sa), nil
+}
+
+// k8sServiceAccount returns the namespace and service account of a k8s jwt token.
+func k8sServiceAccount(token string) (string, string, error) {
 	strs := strings.Split(token, ".")
 	if len(strs) != 3 {
-		return "", fmt.Errorf("invalid k8s jwt token")
+		return "", "", fmt.Errorf("invalid k8s jwt token")
 	}
 
 	payload := strs[1]
@@ -36,28 +51,20 @@ func constructCSRHostName(trustDomain, token string) (string, error) {
 	}
 	dp, err := base64.URLEncoding.DecodeString(payload)
 	if err != nil {
-		return "", fmt.Errorf("invalid k8s jwt token: %v", err)
+		return "", "", fmt.Errorf("invalid k8s jwt token: %v", err)
 	}
 
 	var jp k8sJwtPayload
 	if err = json.Unmarshal(dp, &jp); err != nil {
-		return "", fmt.Errorf("invalid k8s jwt token: %v", err)
+		return "", "", fmt.Errorf("invalid k8s jwt token: %v", err)
 	}
 
 	// sub field in jwt should be in format like: system:serviceaccount:foo:bar
 	ss := strings.Split(jp.Sub, ":")
 	if len(ss) != 4 {
-		return "", fmt.Errorf("invalid sub field in k8s jwt token")
+		return "", "", fmt.Errorf("invalid sub field in k8s jwt token")
 	}
-	ns := ss[2] //namespace
-	sa := ss[3] //service account
-
-	domain := "cluster.local"
-	if trustDomain != "" {
-		domain = trustDomain
-	}
-
-	return fmt.Sprintf(identityTemplate, domain, ns, sa), nil
+	return ss[2], ss[3], nil
 }
 
 // isRetryableErr checks if a failed request should be retry based on gRPC resp code or http status code.
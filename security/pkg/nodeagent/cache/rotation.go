@@ -0,0 +1,109 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"istio.io/istio/security/pkg/nodeagent/model"
+)
+
+// RotationPolicy overrides the secret TTL and refresh grace duration of the workloads of a
+// namespace or service account.
+type RotationPolicy struct {
+	// SecretTTL is the TTL of the certificates requested for the workloads.
+	SecretTTL time.Duration
+
+	// SecretRefreshGraceDuration is how long before expiration the certificates are refreshed.
+	SecretRefreshGraceDuration time.Duration
+}
+
+// ParseRotationPolicies parses a comma separated list of rotation policies, in the format
+// <namespace>[/<service account>]=<ttl>[:<grace duration>], e.g. "secure=1h:15m,default/legacy=48h".
+// If the grace duration is omitted, defaultGrace is used, capped to half of the TTL. Since secrets are
+// refreshed up to jitter earlier than their grace duration requires, the grace duration plus the jitter
+// must be shorter than the TTL.
+func ParseRotationPolicies(value string, defaultGrace, jitter time.Duration) (map[string]RotationPolicy, error) {
+	out := make(map[string]RotationPolicy)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid rotation policy %q: expected <namespace>[/<service account>]=<ttl>[:<grace>]", entry)
+		}
+		durations := strings.SplitN(parts[1], ":", 2)
+		ttl, err := time.ParseDuration(durations[0])
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid TTL in rotation policy %q", entry)
+		}
+		grace := defaultGrace
+		if grace > ttl/2 {
+			grace = ttl / 2
+		}
+		if len(durations) == 2 {
+			if grace, err = time.ParseDuration(durations[1]); err != nil || grace < 0 || grace >= ttl {
+				return nil, fmt.Errorf("invalid grace duration in rotation policy %q: must be shorter than the TTL", entry)
+			}
+		}
+		if grace+jitter >= ttl {
+			return nil, fmt.Errorf("invalid rotation policy %q: the grace duration %v plus the rotation jitter %v "+
+				"must be shorter than the TTL", entry, grace, jitter)
+		}
+		out[parts[0]] = RotationPolicy{SecretTTL: ttl, SecretRefreshGraceDuration: grace}
+	}
+	return out, nil
+}
+
+// rotationPolicy returns the rotation policy of the workload authenticated by the k8s jwt token.
+// Policies of the service account take precedence over the policies of the namespace.
+func (sc *SecretCache) rotationPolicy(token string) RotationPolicy {
+	policy := RotationPolicy{
+		SecretTTL:                  sc.configOptions.SecretTTL,
+		SecretRefreshGraceDuration: sc.configOptions.SecretRefreshGraceDuration,
+	}
+	if len(sc.configOptions.RotationPolicies) == 0 {
+		return policy
+	}
+	ns, sa, err := k8sServiceAccount(token)
+	if err != nil {
+		return policy
+	}
+	if p, f := sc.configOptions.RotationPolicies[ns+"/"+sa]; f {
+		return p
+	}
+	if p, f := sc.configOptions.RotationPolicies[ns]; f {
+		return p
+	}
+	return policy
+}
+
+// refreshJitter returns how much earlier than required by its grace duration a secret is refreshed,
+// so that secrets created at the same time are not all rotated at once. The jitter is derived from
+// the secret, so that it stays the same across rotation job runs.
+func (sc *SecretCache) refreshJitter(s *model.SecretItem) time.Duration {
+	if sc.configOptions.RotationJitter <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s.Token))
+	_, _ = h.Write([]byte(s.Version))
+	return time.Duration(h.Sum64() % uint64(sc.configOptions.RotationJitter))
+}
@@ -0,0 +1,139 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"istio.io/istio/security/pkg/nodeagent/model"
+)
+
+func TestParseRotationPolicies(t *testing.T) {
+	got, err := ParseRotationPolicies("secure=1h:15m, default/legacy=48h,short=1h", time.Hour, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]RotationPolicy{
+		"secure":         {SecretTTL: time.Hour, SecretRefreshGraceDuration: 15 * time.Minute},
+		"default/legacy": {SecretTTL: 48 * time.Hour, SecretRefreshGraceDuration: time.Hour},
+		// The default grace duration is capped to half of the TTL.
+		"short": {SecretTTL: time.Hour, SecretRefreshGraceDuration: 30 * time.Minute},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseRotationPolicies() => %v, want %v", got, want)
+	}
+
+	for _, invalid := range []string{"secure", "secure=abc", "secure=1h:2h", "=1h", "secure=-1h"} {
+		if _, err := ParseRotationPolicies(invalid, time.Hour, 0); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+
+	// The secrets would be refreshed as soon as they are issued.
+	for _, invalid := range []string{"secure=1h:45m", "short=1h"} {
+		if _, err := ParseRotationPolicies(invalid, time.Hour, 30*time.Minute); err == nil {
+			t.Errorf("expected error for %q with a 30m jitter", invalid)
+		}
+	}
+}
+
+func TestRotationPolicy(t *testing.T) {
+	data, err := ioutil.ReadFile("./testdata/testjwt")
+	if err != nil {
+		t.Fatalf("failed to read test jwt file %v", err)
+	}
+	// The test jwt is for the sleep service account of the default namespace.
+	testJwt := string(data)
+
+	defaults := RotationPolicy{SecretTTL: 24 * time.Hour, SecretRefreshGraceDuration: time.Hour}
+	namespace := RotationPolicy{SecretTTL: time.Hour, SecretRefreshGraceDuration: 10 * time.Minute}
+	serviceAccount := RotationPolicy{SecretTTL: 2 * time.Hour, SecretRefreshGraceDuration: 20 * time.Minute}
+
+	cases := []struct {
+		name     string
+		policies map[string]RotationPolicy
+		token    string
+		want     RotationPolicy
+	}{
+		{
+			name:  "no policies",
+			token: testJwt,
+			want:  defaults,
+		},
+		{
+			name:     "namespace policy",
+			policies: map[string]RotationPolicy{"default": namespace},
+			token:    testJwt,
+			want:     namespace,
+		},
+		{
+			name:     "service account policy takes precedence",
+			policies: map[string]RotationPolicy{"default": namespace, "default/sleep": serviceAccount},
+			token:    testJwt,
+			want:     serviceAccount,
+		},
+		{
+			name:     "other namespace",
+			policies: map[string]RotationPolicy{"secure": namespace},
+			token:    testJwt,
+			want:     defaults,
+		},
+		{
+			name:     "not a jwt",
+			policies: map[string]RotationPolicy{"default": namespace},
+			token:    "faketoken",
+			want:     defaults,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sc := &SecretCache{configOptions: Options{
+				SecretTTL:                  defaults.SecretTTL,
+				SecretRefreshGraceDuration: defaults.SecretRefreshGraceDuration,
+				RotationPolicies:           c.policies,
+			}}
+			if got := sc.rotationPolicy(c.token); got != c.want {
+				t.Errorf("rotationPolicy() => %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestShouldRefreshWithJitter(t *testing.T) {
+	sc := &SecretCache{configOptions: Options{
+		SecretTTL:                  time.Hour,
+		SecretRefreshGraceDuration: 10 * time.Minute,
+		RotationJitter:             5 * time.Minute,
+	}}
+	s := &model.SecretItem{Token: "token", Version: "v1", ExpireTime: time.Now().Add(20 * time.Minute)}
+
+	jitter := sc.refreshJitter(s)
+	if jitter < 0 || jitter >= 5*time.Minute {
+		t.Fatalf("jitter %v out of range", jitter)
+	}
+	if jitter != sc.refreshJitter(s) {
+		t.Errorf("jitter should be stable for a secret")
+	}
+	if sc.shouldRefresh(s) {
+		t.Errorf("secret outside of grace and jitter duration should not be refreshed")
+	}
+	s.ExpireTime = time.Now().Add(10*time.Minute + jitter - time.Second)
+	if !sc.shouldRefresh(s) {
+		t.Errorf("secret within jittered grace duration should be refreshed")
+	}
+}
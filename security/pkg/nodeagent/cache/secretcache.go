@@ -105,6 +105,14 @@ type Options struct {
 
 	// set this flag to true if skip validate format for certificate chain returned from CA.
 	SkipValidateCert bool
+
+	// RotationPolicies overrides SecretTTL and SecretRefreshGraceDuration for the workloads of a
+	// namespace, keyed by "<namespace>", or of a service account, keyed by "<namespace>/<service account>".
+	RotationPolicies map[string]RotationPolicy
+
+	// RotationJitter is the maximum random duration by which secrets are refreshed earlier than
+	// their refresh grace duration requires, to spread the rotation of secrets created together.
+	RotationJitter time.Duration
 }
 
 // SecretManager defines secrets management interface which is used by SDS.
@@ -607,7 +615,8 @@ func (sc *SecretCache) generateSecret(ctx context.Context, token string, connKey
 
 	numOutgoingRequests.With(RequestType.Value(CSR)).Increment()
 	timeBeforeCSR := time.Now()
-	certChainPEM, err := sc.sendRetriableRequest(ctx, csrPEM, exchangedToken, connKey, true)
+	policy := sc.rotationPolicy(token)
+	certChainPEM, err := sc.sendRetriableRequest(ctx, csrPEM, exchangedToken, connKey, true, policy.SecretTTL)
 	csrLatency := float64(time.Since(timeBeforeCSR).Nanoseconds()) / float64(time.Millisecond)
 	outgoingLatency.With(RequestType.Value(CSR)).Record(csrLatency)
 	if err != nil {
@@ -623,10 +632,10 @@ func (sc *SecretCache) generateSecret(ctx context.Context, token string, connKey
 		certChain = append(certChain, []byte(c)...)
 	}
 
-	// Cert expire time by default is createTime + sc.configOptions.SecretTTL.
+	// Cert expire time by default is createTime + the SecretTTL of the workload's rotation policy.
 	// Citadel respects SecretTTL that passed to it and use it decide TTL of cert it issued.
 	// Some customer CA may override TTL param that's passed to it.
-	expireTime := t.Add(sc.configOptions.SecretTTL)
+	expireTime := t.Add(policy.SecretTTL)
 	if !sc.configOptions.SkipValidateCert {
 		if expireTime, err = nodeagentutil.ParseCertAndGetExpiryTimestamp(certChain); err != nil {
 			cacheLog.Errorf("%s failed to extract expire time from server certificate in CSR response %+v: %v",
@@ -669,7 +678,8 @@ func (sc *SecretCache) generateSecret(ctx context.Context, token string, connKey
 
 func (sc *SecretCache) shouldRefresh(s *model.SecretItem) bool {
 	// secret should be refreshed before it expired, SecretRefreshGraceDuration is the grace period;
-	return time.Now().After(s.ExpireTime.Add(-sc.configOptions.SecretRefreshGraceDuration))
+	grace := sc.rotationPolicy(s.Token).SecretRefreshGraceDuration + sc.refreshJitter(s)
+	return time.Now().After(s.ExpireTime.Add(-grace))
 }
 
 func (sc *SecretCache) isTokenExpired() bool {
@@ -688,7 +698,7 @@ func (sc *SecretCache) isTokenExpired() bool {
 // sendRetriableRequest sends retriable requests for either CSR or ExchangeToken.
 // Prior to sending the request, it also sleep random millisecond to avoid thundering herd problem.
 func (sc *SecretCache) sendRetriableRequest(ctx context.Context, csrPEM []byte,
-	providedExchangedToken string, connKey ConnKey, isCSR bool) ([]string, error) {
+	providedExchangedToken string, connKey ConnKey, isCSR bool, ttl time.Duration) ([]string, error) {
 	sc.randMutex.Lock()
 	backOffInMilliSec := sc.rand.Int63n(sc.configOptions.InitialBackoff)
 	sc.randMutex.Unlock()
@@ -710,7 +720,7 @@ func (sc *SecretCache) sendRetriableRequest(ctx context.Context, csrPEM []byte,
 		if isCSR {
 			requestErrorString = fmt.Sprintf("%s CSR", conIDresourceNamePrefix)
 			certChainPEM, err = sc.fetcher.CaClient.CSRSign(
-				ctx, csrPEM, exchangedToken, int64(sc.configOptions.SecretTTL.Seconds()))
+				ctx, csrPEM, exchangedToken, int64(ttl.Seconds()))
 		} else {
 			requestErrorString = fmt.Sprintf("%s token exchange", conIDresourceNamePrefix)
 			p := sc.configOptions.Plugins[0]
@@ -766,7 +776,7 @@ func (sc *SecretCache) getExchangedToken(ctx context.Context, k8sJwtToken string
 		return "", fmt.Errorf("found more than one plugin")
 	}
 	exchangedTokens, err := sc.sendRetriableRequest(ctx, nil, k8sJwtToken,
-		ConnKey{ConnectionID: "", ResourceName: ""}, false)
+		ConnKey{ConnectionID: "", ResourceName: ""}, false, 0)
 	if err != nil || len(exchangedTokens) == 0 {
 		cacheLog.Errorf("Failed to exchange token for %s: %v", conIDresourceNamePrefix, err)
 		return "", err
@@ -0,0 +1,198 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cloudcredential serves cloud credentials to workloads, obtained by exchanging the
+// workload's mesh identity token with the cloud provider, so calls to cloud APIs can be
+// authorized by the identity of the workload.
+package cloudcredential
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"istio.io/istio/security/pkg/nodeagent/plugin"
+	"istio.io/pkg/log"
+)
+
+const (
+	// TokenPath is the HTTP path credentials are served on.
+	TokenPath = "/token"
+
+	// refreshGracePeriod is how long before expiration cached credentials are refreshed.
+	refreshGracePeriod = 5 * time.Minute
+
+	bearerPrefix = "Bearer "
+)
+
+var credLog = log.RegisterScope("cloudcredential", "Cloud credential server debugging", 0)
+
+// TokenResponse is the response returned to workloads requesting credentials.
+type TokenResponse struct {
+	// AccessToken is the credential returned by the cloud provider. For AWS this is the JSON
+	// encoded temporary credentials of the assumed role.
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	// ExpiresIn is the lifetime of the credential in seconds.
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+type cachedCredential struct {
+	token      string
+	expireTime time.Time
+}
+
+// Server exchanges workload tokens for cloud credentials and serves them over a unix domain socket.
+type Server struct {
+	trustDomain string
+	plugin      plugin.Plugin
+
+	mu    sync.Mutex
+	cache map[string]cachedCredential
+
+	listener   net.Listener
+	httpServer *http.Server
+
+	// now is overridden in tests.
+	now func() time.Time
+}
+
+// NewServer creates a cloud credential server using the given token exchange plugin.
+func NewServer(trustDomain string, p plugin.Plugin) *Server {
+	s := &Server{
+		trustDomain: trustDomain,
+		plugin:      p,
+		cache:       make(map[string]cachedCredential),
+		now:         time.Now,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(TokenPath, s.handleToken)
+	s.httpServer = &http.Server{Handler: mux}
+	return s
+}
+
+// Start starts serving credentials on the unix domain socket at udsPath. The socket is only accessible to the
+// user of the agent, and to the group gid if it is not negative, e.g. the group of the workload containers
+// allowed to get cloud credentials.
+func (s *Server) Start(udsPath string, gid int) error {
+	if _, err := os.Stat(udsPath); err == nil {
+		if err := os.Remove(udsPath); err != nil {
+			return err
+		}
+	}
+	l, err := net.Listen("unix", udsPath)
+	if err != nil {
+		return err
+	}
+	mode := os.FileMode(0600)
+	if gid >= 0 {
+		if err := os.Chown(udsPath, -1, gid); err != nil {
+			_ = l.Close()
+			return err
+		}
+		mode = 0660
+	}
+	if err := os.Chmod(udsPath, mode); err != nil {
+		_ = l.Close()
+		return err
+	}
+	s.listener = l
+	go func() {
+		if err := s.httpServer.Serve(l); err != nil && err != http.ErrServerClosed {
+			credLog.Errorf("cloud credential server failure: %v", err)
+		}
+	}()
+	credLog.Infof("Cloud credential server listening on %q", udsPath)
+	return nil
+}
+
+// Stop stops the server.
+func (s *Server) Stop() {
+	if s == nil || s.listener == nil {
+		return
+	}
+	if err := s.httpServer.Shutdown(context.TODO()); err != nil {
+		credLog.Errorf("failed to shut down cloud credential server: %v", err)
+	}
+}
+
+// credential returns the cloud credential for the workload token, exchanging it if no valid
+// credential is cached.
+func (s *Server) credential(ctx context.Context, token string) (cachedCredential, int, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+
+	s.mu.Lock()
+	cred, f := s.cache[key]
+	now := s.now()
+	// Drop expired entries so tokens of deleted workloads do not accumulate.
+	for k, c := range s.cache {
+		if !c.expireTime.After(now) {
+			delete(s.cache, k)
+		}
+	}
+	s.mu.Unlock()
+	if f && cred.expireTime.Sub(now) > refreshGracePeriod {
+		return cred, http.StatusOK, nil
+	}
+
+	exchanged, expireTime, code, err := s.plugin.ExchangeToken(ctx, s.trustDomain, token)
+	if err != nil {
+		return cachedCredential{}, code, err
+	}
+	cred = cachedCredential{token: exchanged, expireTime: expireTime}
+	s.mu.Lock()
+	s.cache[key] = cred
+	s.mu.Unlock()
+	return cred, http.StatusOK, nil
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, req *http.Request) {
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, bearerPrefix) {
+		http.Error(w, "missing bearer token", http.StatusUnauthorized)
+		return
+	}
+	token := strings.TrimPrefix(auth, bearerPrefix)
+
+	cred, code, err := s.credential(req.Context(), token)
+	if err != nil {
+		credLog.Warnf("Failed to exchange workload token: %v", err)
+		if code == http.StatusUnauthorized || code == http.StatusForbidden || code == http.StatusBadRequest {
+			http.Error(w, "token exchange rejected", http.StatusForbidden)
+		} else {
+			http.Error(w, "token exchange failed", http.StatusBadGateway)
+		}
+		return
+	}
+
+	out, err := json.Marshal(TokenResponse{
+		AccessToken: cred.token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(cred.expireTime.Sub(s.now()).Seconds()),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(out)
+}
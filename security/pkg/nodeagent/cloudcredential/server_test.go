@@ -0,0 +1,111 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudcredential
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type fakeExchanger struct {
+	calls  int
+	expire time.Time
+}
+
+func (f *fakeExchanger) ExchangeToken(_ context.Context, _, token string) (string, time.Time, int, error) {
+	f.calls++
+	if token == "bad" {
+		return "", time.Time{}, http.StatusForbidden, errors.New("forbidden")
+	}
+	return "cloud-" + token, f.expire, http.StatusOK, nil
+}
+
+func TestHandleToken(t *testing.T) {
+	now := time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)
+	exchanger := &fakeExchanger{expire: now.Add(time.Hour)}
+	s := NewServer("cluster.local", exchanger)
+	s.now = func() time.Time { return now }
+
+	get := func(auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", TokenPath, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		s.handleToken(rec, req)
+		return rec
+	}
+
+	if rec := get(""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("missing token => %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := get("Bearer bad"); rec.Code != http.StatusForbidden {
+		t.Errorf("rejected token => %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	rec := get("Bearer jwt")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("valid token => %d, want %d", rec.Code, http.StatusOK)
+	}
+	resp := TokenResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.AccessToken != "cloud-jwt" || resp.ExpiresIn != 3600 {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	// Cached until the credential is close to expiration.
+	calls := exchanger.calls
+	get("Bearer jwt")
+	if exchanger.calls != calls {
+		t.Errorf("expected cached credential to be used")
+	}
+	now = now.Add(58 * time.Minute)
+	get("Bearer jwt")
+	if exchanger.calls != calls+1 {
+		t.Errorf("expected credential to be refreshed before expiration")
+	}
+}
+
+func TestStartSocketMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudcredential")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	udsPath := filepath.Join(dir, "credentials")
+	s := NewServer("cluster.local", &fakeExchanger{})
+	if err := s.Start(udsPath, -1); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	info, err := os.Stat(udsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("got socket mode %v, want only the agent user to access it", mode)
+	}
+}
@@ -22,6 +22,9 @@ import (
 const (
 	// GoogleTokenExchange is the name of the google token exchange plugin.
 	GoogleTokenExchange = "GoogleTokenExchange"
+
+	// AWSTokenExchange is the name of the AWS web identity token exchange plugin.
+	AWSTokenExchange = "AWSTokenExchange"
 )
 
 // Plugin provides common interfaces so that authentication providers could choose to implement their specific logic.
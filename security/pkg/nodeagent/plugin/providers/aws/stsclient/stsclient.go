@@ -0,0 +1,141 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stsclient is for AWS STS web identity federation, exchanging the workload's
+// JWT for temporary AWS credentials of an IAM role.
+package stsclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"istio.io/istio/security/pkg/nodeagent/plugin"
+	"istio.io/pkg/env"
+	"istio.io/pkg/log"
+)
+
+var (
+	stsEndpoint     = "https://sts.amazonaws.com/"
+	roleARN         = env.RegisterStringVar("AWS_ROLE_ARN", "", "The ARN of the IAM role workloads assume").Get()
+	roleSessionName = env.RegisterStringVar("AWS_ROLE_SESSION_NAME", "istio-agent",
+		"The session name used when assuming the IAM role").Get()
+	stsClientLog = log.RegisterScope("awsStsClientLog", "AWS STS client debugging", 0)
+)
+
+const (
+	httpTimeOutInSec = 5
+	contentType      = "application/x-www-form-urlencoded"
+	stsAPIVersion    = "2011-06-15"
+)
+
+// Credentials are the temporary AWS credentials returned by the token exchange, serialized as the
+// exchanged token.
+type Credentials struct {
+	AccessKeyID     string    `xml:"AccessKeyId" json:"AccessKeyId"`
+	SecretAccessKey string    `xml:"SecretAccessKey" json:"SecretAccessKey"`
+	SessionToken    string    `xml:"SessionToken" json:"Token"`
+	Expiration      time.Time `xml:"Expiration" json:"Expiration"`
+}
+
+type assumeRoleWithWebIdentityResponse struct {
+	Credentials Credentials `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+}
+
+// Plugin for AWS STS interaction.
+type Plugin struct {
+	hTTPClient      *http.Client
+	roleARN         string
+	roleSessionName string
+}
+
+// NewPlugin returns an instance of AWS secure token service client plugin
+func NewPlugin() plugin.Plugin {
+	caCertPool, err := x509.SystemCertPool()
+	if err != nil {
+		stsClientLog.Errorf("Failed to get SystemCertPool: %v", err)
+		return nil
+	}
+	return Plugin{
+		hTTPClient: &http.Client{
+			Timeout: httpTimeOutInSec * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					RootCAs: caCertPool,
+				},
+			},
+		},
+		roleARN:         roleARN,
+		roleSessionName: roleSessionName,
+	}
+}
+
+// ExchangeToken exchanges the k8s sa jwt for temporary credentials of the configured IAM role.
+// The credentials are returned JSON encoded, in the format of the AWS credential process.
+func (p Plugin) ExchangeToken(ctx context.Context, trustDomain, k8sSAjwt string) (
+	string /*credentials*/, time.Time /*expireTime*/, int /*httpRespCode*/, error) {
+	if p.roleARN == "" {
+		return "", time.Now(), 0, errors.New("AWS_ROLE_ARN is not set")
+	}
+
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {stsAPIVersion},
+		"RoleArn":          {p.roleARN},
+		"RoleSessionName":  {p.roleSessionName},
+		"WebIdentityToken": {k8sSAjwt},
+	}
+	req, err := http.NewRequest("POST", stsEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Now(), 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := p.hTTPClient.Do(req)
+	if err != nil {
+		stsClientLog.Errorf("Failed to call AssumeRoleWithWebIdentity: %v", err)
+		return "", time.Now(), 0, errors.New("failed to exchange token")
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		stsClientLog.Errorf("AssumeRoleWithWebIdentity failed (HTTP status %d): %s", resp.StatusCode, string(body))
+		return "", time.Now(), resp.StatusCode, fmt.Errorf("failed to exchange token: HTTP status %d", resp.StatusCode)
+	}
+	respData := &assumeRoleWithWebIdentityResponse{}
+	if err := xml.Unmarshal(body, respData); err != nil {
+		stsClientLog.Errorf("Failed to unmarshal response data: (HTTP status %d) %v", resp.StatusCode, err)
+		return "", time.Now(), resp.StatusCode, errors.New("failed to exchange token")
+	}
+
+	creds, err := json.Marshal(struct {
+		Version int `json:"Version"`
+		Credentials
+	}{Version: 1, Credentials: respData.Credentials})
+	if err != nil {
+		return "", time.Now(), resp.StatusCode, err
+	}
+	return string(creds), respData.Credentials.Expiration, resp.StatusCode, nil
+}
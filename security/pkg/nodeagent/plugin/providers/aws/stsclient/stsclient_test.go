@@ -0,0 +1,77 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stsclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	fakeRoleARN      = "arn:aws:iam::123456789012:role/reviews"
+	fakeSubjectToken = "subject-token"
+	fakeResponse     = `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>ASIAEXAMPLE</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>session</SessionToken>
+      <Expiration>2019-11-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`
+)
+
+func TestExchangeToken(t *testing.T) {
+	ms := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if req.Form.Get("Action") != "AssumeRoleWithWebIdentity" || req.Form.Get("RoleArn") != fakeRoleARN ||
+			req.Form.Get("WebIdentityToken") != fakeSubjectToken {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(fakeResponse))
+	}))
+	defer ms.Close()
+	stsEndpoint = ms.URL
+	defer func() { stsEndpoint = "https://sts.amazonaws.com/" }()
+
+	p := NewPlugin().(Plugin)
+	p.roleARN = fakeRoleARN
+	token, expire, _, err := p.ExchangeToken(context.Background(), "cluster.local", fakeSubjectToken)
+	if err != nil {
+		t.Fatalf("failed to exchange token: %v", err)
+	}
+	if expire.Year() != 2019 {
+		t.Errorf("unexpected expiration %v", expire)
+	}
+	creds := Credentials{}
+	if err := json.Unmarshal([]byte(token), &creds); err != nil {
+		t.Fatalf("invalid credentials %q: %v", token, err)
+	}
+	if creds.AccessKeyID != "ASIAEXAMPLE" || creds.SecretAccessKey != "secret" || creds.SessionToken != "session" {
+		t.Errorf("unexpected credentials %+v", creds)
+	}
+
+	if _, _, code, err := p.ExchangeToken(context.Background(), "cluster.local", "bad-token"); err == nil || code != http.StatusForbidden {
+		t.Errorf("expected exchange to fail with 403, got %d, %v", code, err)
+	}
+}
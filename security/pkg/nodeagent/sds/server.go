@@ -26,7 +26,9 @@ import (
 	"google.golang.org/grpc/credentials"
 
 	"istio.io/istio/security/pkg/nodeagent/cache"
+	"istio.io/istio/security/pkg/nodeagent/cloudcredential"
 	"istio.io/istio/security/pkg/nodeagent/plugin"
+	awsstsclient "istio.io/istio/security/pkg/nodeagent/plugin/providers/aws/stsclient"
 	"istio.io/istio/security/pkg/nodeagent/plugin/providers/google/stsclient"
 	"istio.io/pkg/version"
 )
@@ -94,6 +96,18 @@ type Options struct {
 
 	// Debug server port from which node_agent serves SDS configuration dumps
 	DebugPort int
+
+	// CloudCredentialUDSPath is the unix domain socket through which workloads exchange their token
+	// for cloud credentials, using CloudCredentialPlugin. Disabled if empty.
+	CloudCredentialUDSPath string
+
+	// CloudCredentialPlugin is the name of the token exchange plugin of the cloud credential server. It is
+	// independent of PluginNames, which exchange the tokens sent to the CA.
+	CloudCredentialPlugin string
+
+	// CloudCredentialUDSGroup, if not negative, is the group allowed to access CloudCredentialUDSPath, in
+	// addition to the user of the agent.
+	CloudCredentialUDSGroup int
 }
 
 // Server is the gPRC server that exposes SDS through UDS.
@@ -107,6 +121,8 @@ type Server struct {
 	grpcWorkloadServer *grpc.Server
 	grpcGatewayServer  *grpc.Server
 	debugServer        *http.Server
+
+	cloudCredentialServer *cloudcredential.Server
 }
 
 // NewServer creates and starts the Grpc server for SDS.
@@ -131,6 +147,12 @@ func NewServer(options Options, workloadSecretCache, gatewaySecretCache cache.Se
 		sdsServiceLog.Infof("SDS gRPC server for ingress gateway controller starts, listening on %q \n",
 			options.IngressGatewayUDSPath)
 	}
+	if options.CloudCredentialUDSPath != "" {
+		if err := s.initCloudCredentialServer(&options); err != nil {
+			sdsServiceLog.Errorf("Failed to initialize cloud credential server: %v", err)
+			return nil, err
+		}
+	}
 	version.Info.RecordComponentBuildTag("citadel_agent")
 
 	s.initDebugServer(options.DebugPort)
@@ -159,6 +181,8 @@ func (s *Server) Stop() {
 		s.grpcGatewayServer.Stop()
 	}
 
+	s.cloudCredentialServer.Stop()
+
 	if s.debugServer != nil {
 		if err := s.debugServer.Shutdown(context.TODO()); err != nil {
 			sdsServiceLog.Error("failed to shut down debug server")
@@ -180,6 +204,33 @@ func NewPlugins(in []string) []plugin.Plugin {
 	return plugins
 }
 
+// NewCloudCredentialPlugin returns the token exchange plugin of the cloud credential server, or nil if the name is
+// unknown. The cloud credentials are served from the own cache of the server, and never from the workload SDS
+// cache, whose plugins exchange the tokens sent to the CA.
+func NewCloudCredentialPlugin(name string) plugin.Plugin {
+	switch name {
+	case plugin.GoogleTokenExchange:
+		return stsclient.NewPlugin()
+	case plugin.AWSTokenExchange:
+		return awsstsclient.NewPlugin()
+	}
+	return nil
+}
+
+func (s *Server) initCloudCredentialServer(options *Options) error {
+	p := NewCloudCredentialPlugin(options.CloudCredentialPlugin)
+	if p == nil {
+		return fmt.Errorf("unknown cloud credential plugin %q, must be %s or %s", options.CloudCredentialPlugin,
+			plugin.GoogleTokenExchange, plugin.AWSTokenExchange)
+	}
+	server := cloudcredential.NewServer(options.TrustDomain, p)
+	if err := server.Start(options.CloudCredentialUDSPath, options.CloudCredentialUDSGroup); err != nil {
+		return err
+	}
+	s.cloudCredentialServer = server
+	return nil
+}
+
 func (s *Server) initDebugServer(port int) {
 	mux := http.NewServeMux()
 	mux.HandleFunc(fmt.Sprintf("%s/sds/workload", debugBase), s.workloadSds.debugHTTPHandler)
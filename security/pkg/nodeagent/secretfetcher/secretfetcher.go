@@ -447,6 +447,9 @@ func (sf *SecretFetcher) scrtUpdated(oldObj, newObj interface{}) {
 // If there is a fallback secret named FallbackSecretName, return the fall back secret.
 func (sf *SecretFetcher) FindIngressGatewaySecret(key string) (secret model.SecretItem, ok bool) {
 	secretFetcherLog.Debugf("SecretFetcher search for secret %s", key)
+	if strings.Contains(key, "/") {
+		return sf.findCrossNamespaceSecret(key)
+	}
 	val, exist := sf.secrets.Load(key)
 	secretFetcherLog.Debugf("load secret %s from secret fetcher: %v", key, exist)
 	if !exist {
@@ -483,6 +486,41 @@ func (sf *SecretFetcher) FindIngressGatewaySecret(key string) (secret model.Secr
 	return e, true
 }
 
+// findCrossNamespaceSecret returns the secret referenced by a key of the form <namespace>/<name>. The access of
+// the gateway to the secret is authorized by Pilot, which only sends the SDS configs of the secrets granting it.
+// The secrets of other namespaces are not watched, they are fetched with an API call and the fallback secret is
+// never used.
+func (sf *SecretFetcher) findCrossNamespaceSecret(key string) (model.SecretItem, bool) {
+	parts := strings.SplitN(key, "/", 2)
+	namespace, name := parts[0], parts[1]
+	if sf.coreV1 == nil {
+		secretFetcherLog.Errorf("cannot fetch secret %s: kubernetes client is not initialized", key)
+		return model.SecretItem{}, false
+	}
+
+	// The client CA cert is either in a CA only secret, or in a compound secret with the server key/cert.
+	scrt, err := sf.coreV1.Secrets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil && strings.HasSuffix(name, IngressGatewaySdsCaSuffix) {
+		scrt, err = sf.coreV1.Secrets(namespace).Get(strings.TrimSuffix(name, IngressGatewaySdsCaSuffix), metav1.GetOptions{})
+	}
+	if err != nil {
+		secretFetcherLog.Errorf("cannot find secret %s: %v", key, err)
+		return model.SecretItem{}, false
+	}
+	serverItem, clientCAItem, _ := extractK8sSecretIntoSecretItem(scrt, time.Now())
+	item := serverItem
+	if strings.HasSuffix(name, IngressGatewaySdsCaSuffix) {
+		item = clientCAItem
+	}
+	if item == nil {
+		secretFetcherLog.Errorf("fail to extract secret %s", key)
+		return model.SecretItem{}, false
+	}
+	item.ResourceName = key
+	secretFetcherLog.Infof("Return secret %s of namespace %s", name, namespace)
+	return *item, true
+}
+
 // AddSecret adds obj into local store. Only used for testing.
 func (sf *SecretFetcher) AddSecret(obj interface{}) {
 	sf.scrtAdded(obj)
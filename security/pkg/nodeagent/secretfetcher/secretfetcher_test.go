@@ -758,3 +758,42 @@ func testUpdateSecret(t *testing.T, sf *SecretFetcher, k8sOldsecret, k8sNewsecre
 		}
 	}
 }
+
+// TestSecretFetcherCrossNamespaceSecret verifies that a secret of another namespace is fetched with its client
+// CA cert.
+func TestSecretFetcherCrossNamespaceSecret(t *testing.T) {
+	sharedSecret := k8sTestGenericSecretA.DeepCopy()
+	sharedSecret.Namespace = "shared-certs"
+
+	gSecretFetcher := &SecretFetcher{
+		UseCaClient: false,
+		DeleteCache: func(secretName string) {},
+		UpdateCache: func(secretName string, ns model.SecretItem) {},
+	}
+	gSecretFetcher.InitWithKubeClient(fake.NewSimpleClientset(sharedSecret).CoreV1())
+	gSecretFetcher.secretNamespace = "istio-system"
+
+	key := "shared-certs/" + k8sSecretNameA
+	secret, ok := gSecretFetcher.FindIngressGatewaySecret(key)
+	if !ok {
+		t.Fatalf("secretFetcher should return secret %s", key)
+	}
+	if secret.ResourceName != key {
+		t.Errorf("secret name does not match, expected %v but got %v", key, secret.ResourceName)
+	}
+	if !bytes.Equal(k8sCertChainA, secret.CertificateChain) || !bytes.Equal(k8sKeyA, secret.PrivateKey) {
+		t.Errorf("secretFetcher returns unexpected key/cert for secret %s", key)
+	}
+
+	caSecret, ok := gSecretFetcher.FindIngressGatewaySecret(key + IngressGatewaySdsCaSuffix)
+	if !ok {
+		t.Fatalf("secretFetcher should return the client CA cert of secret %s", key)
+	}
+	if !bytes.Equal(k8sCaCertA, caSecret.RootCert) {
+		t.Errorf("root cert verification error: expected %v but got %v", k8sCaCertA, caSecret.RootCert)
+	}
+
+	if _, ok := gSecretFetcher.FindIngressGatewaySecret("private-certs/" + k8sSecretNameA); ok {
+		t.Error("secretFetcher should not return a secret that does not exist")
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	cert "k8s.io/api/certificates/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	certclient "k8s.io/client-go/kubernetes/typed/certificates/v1beta1"
+
+	caerror "istio.io/istio/security/pkg/pki/error"
+	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/pkg/log"
+)
+
+const (
+	// SignerNameAnnotation on the Kubernetes CSRs submitted by the KubeCSRSigner is the name of the signer
+	// expected to issue the certificates, e.g. "example.com/mesh-signer", so that external signers can select
+	// them. The CertificateSigningRequestSpec of certificates.k8s.io/v1beta1 has no signer name field yet.
+	SignerNameAnnotation = "security.istio.io/signerName"
+
+	// kubernetesSignerPrefix is the prefix of the names of the signers of Kubernetes, whose certificates are
+	// trusted by the API server.
+	kubernetesSignerPrefix = "kubernetes.io/"
+
+	kubeCSRNamePrefix     = "istio-csr-"
+	kubeCSRPollInterval   = time.Second
+	defaultKubeCSRTimeout = 30 * time.Second
+)
+
+// commonNameOID is the OID of the common name attribute of the subject of the certificates.
+var commonNameOID = asn1.ObjectIdentifier{2, 5, 4, 3}
+
+// KubeCSRSigner signs the workload certificates through the certificates.k8s.io API of Kubernetes, by a dedicated
+// signer watching the CSRs, e.g. an enterprise CA. The certificates are delivered to the workloads by Citadel as
+// before.
+//
+// Citadel never approves the CSRs, the signer or its approver does. The certificates.k8s.io/v1beta1 CSRs have no
+// signer name, and the approved ones are signed by the Kubernetes controller manager as well, with the cluster CA
+// and the client auth usage. So the signer must be a dedicated CA, distinct from the cluster CA, the certificates
+// not chaining to its root are rejected, and the CSRs must have no subject, other than the common name of the dual
+// use certificates, so that their certificates can't carry Kubernetes users or groups.
+type KubeCSRSigner struct {
+	client     certclient.CertificateSigningRequestInterface
+	signerName string
+	// timeout is the maximum time waiting for a CSR to be signed.
+	timeout       time.Duration
+	keyCertBundle util.KeyCertBundle
+}
+
+// NewKubeCSRSigner creates a KubeCSRSigner for the signer, whose root certificate is read from rootCertFile. The
+// signer must not be a signer of Kubernetes, and its root must not be the cluster CA, read from clusterCACertFile
+// if it exists. The TTL of the certificates is decided by the signer.
+func NewKubeCSRSigner(client certclient.CertificateSigningRequestInterface, signerName, rootCertFile,
+	clusterCACertFile string, timeout time.Duration) (*KubeCSRSigner, error) {
+	if signerName == "" || strings.HasPrefix(signerName, kubernetesSignerPrefix) {
+		return nil, fmt.Errorf("invalid signer %q: must be a dedicated signer, not a signer of Kubernetes", signerName)
+	}
+	if rootCertFile == "" {
+		return nil, fmt.Errorf("the root certificate of the signer %s is required", signerName)
+	}
+	keyCertBundle, err := util.NewKeyCertBundleWithRootCertFromFile(rootCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the root certificate of the signer: %v", err)
+	}
+	if err := checkNotClusterCA(keyCertBundle.GetRootCertPem(), clusterCACertFile); err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = defaultKubeCSRTimeout
+	}
+	return &KubeCSRSigner{
+		client:        client,
+		signerName:    signerName,
+		timeout:       timeout,
+		keyCertBundle: keyCertBundle,
+	}, nil
+}
+
+// Sign submits the CSR to Kubernetes, and returns the certificate issued by the signer once it approves it. The
+// identities of the CSR must be the subject IDs, as the signer issues the certificate for the identities of the
+// CSR, and its subject must be empty.
+func (s *KubeCSRSigner) Sign(csrPEM []byte, subjectIDs []string, _ time.Duration, forCA bool) ([]byte, error) {
+	if forCA {
+		return nil, caerror.NewError(caerror.CSRError, fmt.Errorf("CA certificates cannot be signed by %s", s.signerName))
+	}
+	csr, err := util.ParsePemEncodedCSR(csrPEM)
+	if err != nil {
+		return nil, caerror.NewError(caerror.CSRError, err)
+	}
+	ids, err := util.ExtractIDs(csr.Extensions)
+	if err != nil {
+		return nil, caerror.NewError(caerror.CSRError, err)
+	}
+	if !sameIdentities(ids, subjectIDs) {
+		return nil, caerror.NewError(caerror.CSRError, fmt.Errorf(
+			"the identities of the CSR %v are not the identities of the caller %v", ids, subjectIDs))
+	}
+	if err := checkSubject(csr, subjectIDs); err != nil {
+		return nil, caerror.NewError(caerror.CSRError, err)
+	}
+
+	r, err := s.client.Create(&cert.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: kubeCSRNamePrefix,
+			Annotations:  map[string]string{SignerNameAnnotation: s.signerName},
+		},
+		Spec: cert.CertificateSigningRequestSpec{
+			Request: csrPEM,
+			Usages: []cert.KeyUsage{
+				cert.UsageDigitalSignature,
+				cert.UsageKeyEncipherment,
+				cert.UsageServerAuth,
+				cert.UsageClientAuth,
+			},
+		},
+	})
+	if err != nil {
+		return nil, caerror.NewError(caerror.CANotReady, fmt.Errorf("failed to create the Kubernetes CSR: %v", err))
+	}
+	defer func() {
+		if err := s.client.Delete(r.Name, nil); err != nil {
+			log.Warnf("failed to delete the Kubernetes CSR %s: %v", r.Name, err)
+		}
+	}()
+
+	certPEM, err := s.waitForCertificate(r)
+	if err != nil {
+		return nil, caerror.NewError(caerror.CertGenError, err)
+	}
+	if err := s.verify(certPEM); err != nil {
+		return nil, caerror.NewError(caerror.CertGenError, err)
+	}
+	return certPEM, nil
+}
+
+// SignWithCertChain is the same as Sign, as the certificate issued by the signer includes its chain.
+func (s *KubeCSRSigner) SignWithCertChain(csrPEM []byte, subjectIDs []string, ttl time.Duration,
+	forCA bool) ([]byte, error) {
+	return s.Sign(csrPEM, subjectIDs, ttl, forCA)
+}
+
+// GetCAKeyCertBundle returns the KeyCertBundle with the root certificate of the signer only.
+func (s *KubeCSRSigner) GetCAKeyCertBundle() util.KeyCertBundle {
+	return s.keyCertBundle
+}
+
+// waitForCertificate returns the certificate of the CSR once it is issued.
+func (s *KubeCSRSigner) waitForCertificate(r *cert.CertificateSigningRequest) ([]byte, error) {
+	if len(r.Status.Certificate) > 0 {
+		return r.Status.Certificate, nil
+	}
+	var certPEM []byte
+	err := wait.PollImmediate(kubeCSRPollInterval, s.timeout, func() (bool, error) {
+		current, err := s.client.Get(r.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, c := range current.Status.Conditions {
+			if c.Type == cert.CertificateDenied {
+				return false, fmt.Errorf("the Kubernetes CSR %s is denied: %s", r.Name, c.Message)
+			}
+		}
+		certPEM = current.Status.Certificate
+		return len(certPEM) > 0, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return nil, fmt.Errorf("the Kubernetes CSR %s is not signed by %s after %v", r.Name, s.signerName, s.timeout)
+	}
+	return certPEM, err
+}
+
+// verify checks that the certificate issued by the signer chains to its root certificate.
+func (s *KubeCSRSigner) verify(certPEM []byte) error {
+	certs, err := parseCertificates(certPEM)
+	if err != nil {
+		return err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(s.keyCertBundle.GetRootCertPem()) {
+		return fmt.Errorf("failed to load the root certificate of the signer")
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("the certificate issued by %s is not signed by its root certificate: %v", s.signerName, err)
+	}
+	return nil
+}
+
+// checkSubject checks that the subject of the CSR is empty, but for a common name among the subject IDs, as set
+// for the dual use certificates. Istio sets an empty organization.
+func checkSubject(csr *x509.CertificateRequest, subjectIDs []string) error {
+	for _, attr := range csr.Subject.Names {
+		value, _ := attr.Value.(string)
+		if attr.Type.Equal(commonNameOID) && (value == "" || contains(subjectIDs, value)) {
+			continue
+		}
+		if value != "" {
+			return fmt.Errorf("the CSR subject must be empty, got %s %q", attr.Type, value)
+		}
+	}
+	if len(csr.Subject.ExtraNames) > 0 {
+		return fmt.Errorf("the CSR subject must be empty, got %v", csr.Subject.ExtraNames)
+	}
+	return nil
+}
+
+// checkNotClusterCA returns an error if a certificate of the root is a certificate of the cluster CA file.
+func checkNotClusterCA(rootPEM []byte, clusterCACertFile string) error {
+	if clusterCACertFile == "" {
+		return nil
+	}
+	clusterCAPEM, err := ioutil.ReadFile(clusterCACertFile)
+	if err != nil {
+		log.Infof("Not checking the signer root against the cluster CA: %v", err)
+		return nil
+	}
+	roots, err := parseCertificates(rootPEM)
+	if err != nil {
+		return err
+	}
+	clusterCAs, err := parseCertificates(clusterCAPEM)
+	if err != nil {
+		return fmt.Errorf("failed to read the cluster CA: %v", err)
+	}
+	for _, root := range roots {
+		for _, clusterCA := range clusterCAs {
+			if root.Equal(clusterCA) {
+				return fmt.Errorf("the root of the signer must be a dedicated CA, not the Kubernetes cluster CA")
+			}
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCertificates(certPEM []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(certPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the issued certificate: %v", err)
+		}
+		certs = append(certs, c)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate is issued")
+	}
+	return certs, nil
+}
+
+func sameIdentities(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string{}, a...)
+	b = append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,246 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	cert "k8s.io/api/certificates/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	caerror "istio.io/istio/security/pkg/pki/error"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+type testSigner struct {
+	certPEM []byte
+	cert    *x509.Certificate
+	key     crypto.PrivateKey
+}
+
+func newTestSigner(t *testing.T, org string) *testSigner {
+	t.Helper()
+	certPEM, keyPEM, err := util.GenCertKeyFromOptions(util.CertOptions{
+		IsCA:         true,
+		IsSelfSigned: true,
+		TTL:          time.Hour,
+		Org:          org,
+		RSAKeySize:   2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := util.ParsePemEncodedCertificate(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := util.ParsePemEncodedKey(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSigner{certPEM: certPEM, cert: c, key: key}
+}
+
+func (s *testSigner) sign(t *testing.T, csrPEM []byte) []byte {
+	t.Helper()
+	csr, err := util.ParsePemEncodedCSR(csrPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := util.ExtractIDs(csr.Extensions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := util.GenCertFromCSR(csr, s.cert, csr.PublicKey, s.key, ids, time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestKubeCSRSigner(t *testing.T) {
+	const id = "spiffe://cluster.local/ns/default/sa/foo"
+	root := newTestSigner(t, "Root CA")
+	other := newTestSigner(t, "Other CA")
+
+	rootCertFile, err := ioutil.TempFile("", "root-cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(rootCertFile.Name())
+	if _, err := rootCertFile.Write(root.certPEM); err != nil {
+		t.Fatal(err)
+	}
+	rootCertFile.Close()
+
+	csrPEM, _, err := util.GenCSR(util.CertOptions{Host: id, RSAKeySize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mastersCSRPEM, _, err := util.GenCSR(util.CertOptions{Host: id, Org: "system:masters", RSAKeySize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name       string
+		csrPEM     []byte
+		subjectIDs []string
+		forCA      bool
+		// issue sets the status of the Kubernetes CSR when it is created.
+		issue       func(r *cert.CertificateSigningRequest)
+		wantErr     string
+		wantErrType string
+	}{
+		{
+			name:       "signed",
+			subjectIDs: []string{id},
+			issue: func(r *cert.CertificateSigningRequest) {
+				r.Status.Certificate = root.sign(t, r.Spec.Request)
+			},
+		},
+		{
+			name:        "identities of another caller",
+			subjectIDs:  []string{"spiffe://cluster.local/ns/default/sa/bar"},
+			wantErr:     "are not the identities of the caller",
+			wantErrType: "CSR_ERROR",
+		},
+		{
+			name:        "CSR subject",
+			csrPEM:      mastersCSRPEM,
+			subjectIDs:  []string{id},
+			wantErr:     "the CSR subject must be empty",
+			wantErrType: "CSR_ERROR",
+		},
+		{
+			name:        "CA certificate",
+			subjectIDs:  []string{id},
+			forCA:       true,
+			wantErr:     "CA certificates cannot be signed",
+			wantErrType: "CSR_ERROR",
+		},
+		{
+			name:       "denied",
+			subjectIDs: []string{id},
+			issue: func(r *cert.CertificateSigningRequest) {
+				r.Status.Conditions = append(r.Status.Conditions, cert.CertificateSigningRequestCondition{
+					Type:    cert.CertificateDenied,
+					Message: "not allowed",
+				})
+			},
+			wantErr:     "is denied: not allowed",
+			wantErrType: "CERT_GEN_ERROR",
+		},
+		{
+			name:       "signed by another signer",
+			subjectIDs: []string{id},
+			issue: func(r *cert.CertificateSigningRequest) {
+				r.Status.Certificate = other.sign(t, r.Spec.Request)
+			},
+			wantErr:     "is not signed by its root certificate",
+			wantErrType: "CERT_GEN_ERROR",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			var annotations map[string]string
+			client.PrependReactor("create", "certificatesigningrequests",
+				func(action k8stesting.Action) (bool, runtime.Object, error) {
+					r := action.(k8stesting.CreateAction).GetObject().(*cert.CertificateSigningRequest)
+					r.Name = r.GenerateName + "1"
+					annotations = r.Annotations
+					if tc.issue != nil {
+						tc.issue(r)
+					}
+					return false, nil, nil
+				})
+			csrClient := client.CertificatesV1beta1().CertificateSigningRequests()
+
+			signer, err := NewKubeCSRSigner(csrClient, "example.com/mesh", rootCertFile.Name(), "", time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request := csrPEM
+			if tc.csrPEM != nil {
+				request = tc.csrPEM
+			}
+			certPEM, err := signer.Sign(request, tc.subjectIDs, time.Hour, tc.forCA)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Sign() got error %v, want %q", err, tc.wantErr)
+				}
+				if got := err.(*caerror.Error).ErrorType(); got != tc.wantErrType {
+					t.Errorf("Sign() got error type %v, want %v", got, tc.wantErrType)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Sign() got error %v", err)
+				}
+				c, err := util.ParsePemEncodedCertificate(certPEM)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(c.URIs) != 1 || c.URIs[0].String() != id {
+					t.Errorf("got certificate for %v, want %s", c.URIs, id)
+				}
+				if annotations[SignerNameAnnotation] != "example.com/mesh" {
+					t.Errorf("got CSR annotations %v, want the signer name", annotations)
+				}
+			}
+
+			for _, action := range client.Actions() {
+				if action.GetSubresource() == "approval" {
+					t.Errorf("got the Kubernetes CSR approved by the signer, want it approved by the external signer")
+				}
+			}
+			csrs, err := csrClient.List(metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(csrs.Items) != 0 {
+				t.Errorf("got %d Kubernetes CSRs after signing, want them deleted", len(csrs.Items))
+			}
+		})
+	}
+
+	csrClient := fake.NewSimpleClientset().CertificatesV1beta1().CertificateSigningRequests()
+	if _, err := NewKubeCSRSigner(csrClient, "example.com/mesh", "/nonexistent", "", 0); err == nil {
+		t.Error("NewKubeCSRSigner() got no error for a missing root certificate")
+	}
+	if _, err := NewKubeCSRSigner(csrClient, "example.com/mesh", "", "", 0); err == nil {
+		t.Error("NewKubeCSRSigner() got no error without root certificate")
+	}
+	if _, err := NewKubeCSRSigner(csrClient, "kubernetes.io/legacy-unknown", rootCertFile.Name(), "", 0); err == nil {
+		t.Error("NewKubeCSRSigner() got no error for a signer of Kubernetes")
+	}
+	if _, err := NewKubeCSRSigner(csrClient, "example.com/mesh", rootCertFile.Name(), rootCertFile.Name(), 0); err == nil ||
+		!strings.Contains(err.Error(), "not the Kubernetes cluster CA") {
+		t.Errorf("NewKubeCSRSigner() got error %v for the cluster CA, want it rejected", err)
+	}
+	if _, err := NewKubeCSRSigner(csrClient, "example.com/mesh", rootCertFile.Name(), "/nonexistent", 0); err != nil {
+		t.Errorf("NewKubeCSRSigner() got error %v without cluster CA", err)
+	}
+}
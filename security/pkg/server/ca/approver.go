@@ -0,0 +1,272 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"istio.io/istio/security/pkg/server/ca/authenticate"
+)
+
+// ApprovalRequest describes a certificate about to be issued.
+type ApprovalRequest struct {
+	// Caller is the authenticated requester.
+	Caller *authenticate.Caller
+	// Identities are the identities that will be encoded in the certificate SAN.
+	Identities []string
+	// TTL is the requested validity duration of the certificate.
+	TTL time.Duration
+}
+
+// Approver makes an approval decision on a certificate signing request, after the requester has
+// been authenticated and before the certificate is signed. A non-nil error denies the request.
+type Approver interface {
+	// Name identifies the approver in logs and metrics.
+	Name() string
+	Approve(req *ApprovalRequest) error
+}
+
+// AddApprover adds an approver to the certificate signing flow. All approvers must approve a
+// request for the certificate to be issued. Not safe to call once the server is running.
+func (s *Server) AddApprover(a Approver) {
+	s.approvers = append(s.approvers, a)
+}
+
+// approve runs the approvers of the server, returning the error of the first one denying the request.
+func (s *Server) approve(req *ApprovalRequest) error {
+	for _, a := range s.approvers {
+		if err := a.Approve(req); err != nil {
+			serverCaLog.Warnf("CSR for %v denied by %s approver: %v", req.Identities, a.Name(), err)
+			s.monitoring.GetCSRDenied(a.Name()).Increment()
+			return err
+		}
+	}
+	return nil
+}
+
+// spiffeNamespace returns the namespace of a SPIFFE identity of the form
+// spiffe://<trust domain>/ns/<namespace>/sa/<service account>, or "" if the identity has another form.
+func spiffeNamespace(identity string) string {
+	if !strings.HasPrefix(identity, "spiffe://") {
+		return ""
+	}
+	parts := strings.Split(strings.TrimPrefix(identity, "spiffe://"), "/")
+	if len(parts) != 5 || parts[1] != "ns" || parts[3] != "sa" {
+		return ""
+	}
+	return parts[2]
+}
+
+// DenyListApprover denies certificates for the listed identities, or for any identity of the
+// listed namespaces.
+type DenyListApprover struct {
+	Identities []string
+	Namespaces []string
+}
+
+// Name implements Approver.
+func (*DenyListApprover) Name() string {
+	return "deny_list"
+}
+
+// Approve implements Approver.
+func (a *DenyListApprover) Approve(req *ApprovalRequest) error {
+	for _, id := range req.Identities {
+		for _, denied := range a.Identities {
+			if id == denied {
+				return fmt.Errorf("identity %q is denied", id)
+			}
+		}
+		ns := spiffeNamespace(id)
+		for _, denied := range a.Namespaces {
+			if ns != "" && ns == denied {
+				return fmt.Errorf("namespace %q is denied", ns)
+			}
+		}
+	}
+	return nil
+}
+
+// IdentityPatternApprover requires every identity to match one of the patterns.
+type IdentityPatternApprover struct {
+	Patterns []*regexp.Regexp
+}
+
+// NewIdentityPatternApprover compiles the patterns of an IdentityPatternApprover. Patterns are
+// anchored, so they must match the whole identity.
+func NewIdentityPatternApprover(patterns []string) (*IdentityPatternApprover, error) {
+	a := &IdentityPatternApprover{}
+	for _, p := range patterns {
+		re, err := regexp.Compile("^(?:" + p + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity pattern %q: %v", p, err)
+		}
+		a.Patterns = append(a.Patterns, re)
+	}
+	return a, nil
+}
+
+// Name implements Approver.
+func (*IdentityPatternApprover) Name() string {
+	return "identity_pattern"
+}
+
+// Approve implements Approver.
+func (a *IdentityPatternApprover) Approve(req *ApprovalRequest) error {
+	for _, id := range req.Identities {
+		matched := false
+		for _, p := range a.Patterns {
+			if p.MatchString(id) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("identity %q does not match any allowed pattern", id)
+		}
+	}
+	return nil
+}
+
+// NamespaceQuotaApprover limits the number of certificates issued per namespace in a time window,
+// bounding how fast a compromised namespace can mint certificates.
+type NamespaceQuotaApprover struct {
+	// Limit is the maximum number of certificates issued per namespace in Window.
+	Limit  int
+	Window time.Duration
+
+	mu          sync.Mutex
+	windowStart time.Time
+	issued      map[string]int
+
+	// now is overridden in tests.
+	now func() time.Time
+}
+
+// NewNamespaceQuotaApprover returns an approver allowing limit certificates per namespace every window.
+func NewNamespaceQuotaApprover(limit int, window time.Duration) *NamespaceQuotaApprover {
+	return &NamespaceQuotaApprover{
+		Limit:  limit,
+		Window: window,
+		issued: make(map[string]int),
+		now:    time.Now,
+	}
+}
+
+// Name implements Approver.
+func (*NamespaceQuotaApprover) Name() string {
+	return "namespace_quota"
+}
+
+// Approve implements Approver.
+func (a *NamespaceQuotaApprover) Approve(req *ApprovalRequest) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	if now.Sub(a.windowStart) >= a.Window {
+		a.windowStart = now
+		a.issued = make(map[string]int)
+	}
+
+	namespaces := make(map[string]bool)
+	for _, id := range req.Identities {
+		if ns := spiffeNamespace(id); ns != "" {
+			namespaces[ns] = true
+		}
+	}
+	for ns := range namespaces {
+		if a.issued[ns] >= a.Limit {
+			return fmt.Errorf("namespace %q exceeded its quota of %d certificates per %v", ns, a.Limit, a.Window)
+		}
+	}
+	for ns := range namespaces {
+		a.issued[ns]++
+	}
+	return nil
+}
+
+// WebhookApprover delegates the approval decision to an external HTTP service. The service
+// receives a JSON webhookApprovalRequest and must reply with a webhookApprovalResponse.
+type WebhookApprover struct {
+	URL    string
+	Client *http.Client
+}
+
+type webhookApprovalRequest struct {
+	CallerIdentities []string `json:"caller_identities"`
+	AuthSource       int      `json:"auth_source"`
+	Identities       []string `json:"identities"`
+	TTLSeconds       int64    `json:"ttl_seconds"`
+}
+
+type webhookApprovalResponse struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// NewWebhookApprover returns an approver calling the webhook at url.
+func NewWebhookApprover(url string, timeout time.Duration) *WebhookApprover {
+	return &WebhookApprover{
+		URL:    url,
+		Client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Name implements Approver.
+func (*WebhookApprover) Name() string {
+	return "webhook"
+}
+
+// Approve implements Approver. Requests are denied if the webhook cannot be reached.
+func (a *WebhookApprover) Approve(req *ApprovalRequest) error {
+	body, err := json.Marshal(webhookApprovalRequest{
+		CallerIdentities: req.Caller.Identities,
+		AuthSource:       int(req.Caller.AuthSource),
+		Identities:       req.Identities,
+		TTLSeconds:       int64(req.TTL.Seconds()),
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := a.Client.Post(a.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("approval webhook failure: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("approval webhook failure: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("approval webhook returned HTTP status %d", resp.StatusCode)
+	}
+	decision := webhookApprovalResponse{}
+	if err := json.Unmarshal(respBody, &decision); err != nil {
+		return fmt.Errorf("invalid approval webhook response: %v", err)
+	}
+	if !decision.Allowed {
+		return fmt.Errorf("denied by approval webhook: %s", decision.Reason)
+	}
+	return nil
+}
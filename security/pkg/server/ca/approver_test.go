@@ -0,0 +1,126 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"istio.io/istio/security/pkg/server/ca/authenticate"
+)
+
+func approvalRequest(ids ...string) *ApprovalRequest {
+	return &ApprovalRequest{
+		Caller:     &authenticate.Caller{Identities: ids},
+		Identities: ids,
+		TTL:        time.Hour,
+	}
+}
+
+func TestDenyListApprover(t *testing.T) {
+	a := &DenyListApprover{
+		Identities: []string{"spiffe://cluster.local/ns/default/sa/admin"},
+		Namespaces: []string{"compromised"},
+	}
+	cases := map[string]bool{
+		"spiffe://cluster.local/ns/default/sa/admin":       false,
+		"spiffe://cluster.local/ns/compromised/sa/default": false,
+		"spiffe://cluster.local/ns/default/sa/default":     true,
+	}
+	for id, approved := range cases {
+		if err := a.Approve(approvalRequest(id)); (err == nil) != approved {
+			t.Errorf("%s: approved => %v, want %v", id, err == nil, approved)
+		}
+	}
+}
+
+func TestIdentityPatternApprover(t *testing.T) {
+	if _, err := NewIdentityPatternApprover([]string{"("}); err == nil {
+		t.Errorf("expected invalid pattern error")
+	}
+	a, err := NewIdentityPatternApprover([]string{"spiffe://cluster.local/ns/[a-z-]+/sa/[a-z-]+"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Approve(approvalRequest("spiffe://cluster.local/ns/foo/sa/bar")); err != nil {
+		t.Errorf("expected approval: %v", err)
+	}
+	// Patterns must match the whole identity.
+	if err := a.Approve(approvalRequest("spiffe://cluster.local/ns/foo/sa/bar/extra")); err == nil {
+		t.Errorf("expected denial of identity not fully matching")
+	}
+	if err := a.Approve(approvalRequest("spiffe://other.domain/ns/foo/sa/bar")); err == nil {
+		t.Errorf("expected denial of foreign trust domain")
+	}
+}
+
+func TestNamespaceQuotaApprover(t *testing.T) {
+	now := time.Now()
+	a := NewNamespaceQuotaApprover(2, time.Minute)
+	a.now = func() time.Time { return now }
+
+	foo := approvalRequest("spiffe://cluster.local/ns/foo/sa/default")
+	bar := approvalRequest("spiffe://cluster.local/ns/bar/sa/default")
+	for i := 0; i < 2; i++ {
+		if err := a.Approve(foo); err != nil {
+			t.Fatalf("expected approval %d: %v", i, err)
+		}
+	}
+	if err := a.Approve(foo); err == nil {
+		t.Errorf("expected quota to be exceeded")
+	}
+	if err := a.Approve(bar); err != nil {
+		t.Errorf("quota should be per namespace: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := a.Approve(foo); err != nil {
+		t.Errorf("expected quota to reset with the window: %v", err)
+	}
+}
+
+func TestWebhookApprover(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := webhookApprovalRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resp := webhookApprovalResponse{Allowed: true}
+		for _, id := range req.Identities {
+			if spiffeNamespace(id) == "denied" {
+				resp = webhookApprovalResponse{Allowed: false, Reason: "namespace denied"}
+			}
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer ts.Close()
+
+	a := NewWebhookApprover(ts.URL, time.Second)
+	if err := a.Approve(approvalRequest("spiffe://cluster.local/ns/foo/sa/default")); err != nil {
+		t.Errorf("expected approval: %v", err)
+	}
+	if err := a.Approve(approvalRequest("spiffe://cluster.local/ns/denied/sa/default")); err == nil {
+		t.Errorf("expected denial")
+	}
+
+	unreachable := NewWebhookApprover("http://127.0.0.1:1", time.Second)
+	if err := unreachable.Approve(approvalRequest("spiffe://cluster.local/ns/foo/sa/default")); err == nil {
+		t.Errorf("expected denial when webhook is unreachable")
+	}
+}
@@ -19,11 +19,13 @@ import (
 )
 
 const (
-	errorlabel = "error"
+	errorlabel    = "error"
+	approverLabel = "approver"
 )
 
 var (
-	errorTag = monitoring.MustCreateLabel(errorlabel)
+	errorTag    = monitoring.MustCreateLabel(errorlabel)
+	approverTag = monitoring.MustCreateLabel(approverLabel)
 
 	csrCounts = monitoring.NewSum(
 		"citadel_server_csr_count",
@@ -51,6 +53,12 @@ var (
 		monitoring.WithLabels(errorTag),
 	)
 
+	csrDeniedCounts = monitoring.NewSum(
+		"citadel_server_csr_denied_count",
+		"The number of CSRs denied by an approver.",
+		monitoring.WithLabels(approverTag),
+	)
+
 	successCounts = monitoring.NewSum(
 		"citadel_server_success_cert_issuance_count",
 		"The number of certificates issuances that have succeeded.",
@@ -70,6 +78,7 @@ func init() {
 		csrParsingErrorCounts,
 		idExtractionErrorCounts,
 		certSignErrorCounts,
+		csrDeniedCounts,
 		successCounts,
 		rootCertExpiryTimestamp,
 	)
@@ -83,6 +92,7 @@ type monitoringMetrics struct {
 	CSRError          monitoring.Metric
 	IDExtractionError monitoring.Metric
 	certSignErrors    monitoring.Metric
+	csrDenied         monitoring.Metric
 }
 
 // newMonitoringMetrics creates a new monitoringMetrics.
@@ -94,9 +104,14 @@ func newMonitoringMetrics() monitoringMetrics {
 		CSRError:          csrParsingErrorCounts,
 		IDExtractionError: idExtractionErrorCounts,
 		certSignErrors:    certSignErrorCounts,
+		csrDenied:         csrDeniedCounts,
 	}
 }
 
 func (m *monitoringMetrics) GetCertSignError(err string) monitoring.Metric {
 	return m.certSignErrors.With(errorTag.Value(err))
 }
+
+func (m *monitoringMetrics) GetCSRDenied(approver string) monitoring.Metric {
+	return m.csrDenied.With(approverTag.Value(approver))
+}
@@ -70,6 +70,7 @@ type Server struct {
 	authenticators []authenticator
 	hostnames      []string
 	authorizer     authorizer
+	approvers      []Approver
 	ca             CertificateAuthority
 	serverCertTTL  time.Duration
 	certificate    *tls.Certificate
@@ -94,6 +95,14 @@ func (s *Server) CreateCertificate(ctx context.Context, request *pb.IstioCertifi
 
 	// TODO: Call authorizer.
 
+	if err := s.approve(&ApprovalRequest{
+		Caller:     caller,
+		Identities: caller.Identities,
+		TTL:        time.Duration(request.ValidityDuration) * time.Second,
+	}); err != nil {
+		return nil, status.Errorf(codes.PermissionDenied, "CSR denied (%v)", err)
+	}
+
 	_, _, certChainBytes, rootCertBytes := s.ca.GetCAKeyCertBundle().GetAll()
 	cert, signErr := s.ca.Sign(
 		[]byte(request.Csr), caller.Identities, time.Duration(request.ValidityDuration)*time.Second, false)
@@ -160,6 +169,14 @@ func (s *Server) HandleCSR(ctx context.Context, request *pb.CsrRequest) (*pb.Csr
 
 	// TODO: Call authorizer.
 
+	if err := s.approve(&ApprovalRequest{
+		Caller:     caller,
+		Identities: caller.Identities,
+		TTL:        time.Duration(request.RequestedTtlMinutes) * time.Minute,
+	}); err != nil {
+		return nil, status.Errorf(codes.PermissionDenied, "CSR denied (%v)", err)
+	}
+
 	_, _, certChainBytes, _ := s.ca.GetCAKeyCertBundle().GetAll()
 	cert, signErr := s.ca.Sign(
 		request.CsrPem, caller.Identities, time.Duration(request.RequestedTtlMinutes)*time.Minute, s.forCA)
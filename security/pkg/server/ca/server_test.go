@@ -154,6 +154,7 @@ func TestCreateCertificate(t *testing.T) {
 	testCases := map[string]struct {
 		authenticators []authenticator
 		authorizer     *mockAuthorizer
+		approvers      []Approver
 		ca             CertificateAuthority
 		certChain      []string
 		code           codes.Code
@@ -209,6 +210,15 @@ func TestCreateCertificate(t *testing.T) {
 			certChain: []string{"cert", "cert_chain", "root_cert"},
 			code:      codes.OK,
 		},
+		"Denied by approver": {
+			authenticators: []authenticator{&mockAuthenticator{
+				identities: []string{"spiffe://cluster.local/ns/compromised/sa/default"},
+			}},
+			authorizer: &mockAuthorizer{},
+			approvers:  []Approver{&DenyListApprover{Namespaces: []string{"compromised"}}},
+			ca:         &mockca.FakeCA{SignedCert: []byte("cert")},
+			code:       codes.PermissionDenied,
+		},
 	}
 
 	for id, c := range testCases {
@@ -217,6 +227,7 @@ func TestCreateCertificate(t *testing.T) {
 			hostnames:      []string{"hostname"},
 			port:           8080,
 			authorizer:     c.authorizer,
+			approvers:      c.approvers,
 			authenticators: c.authenticators,
 			monitoring:     newMonitoringMetrics(),
 		}